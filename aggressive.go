@@ -0,0 +1,278 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// aggressive.go 文件定义了 AggressiveNSECResponser，
+// 用于评估解析器对 RFC 8198 "Aggressive Use of DNSSEC-Validated Cache" 的实现。
+// 其会刻意回复相互重叠或相互矛盾的 NSEC 区间，并按客户端记录查询历史，
+// 之后可根据已回复的区间与查询历史，判断解析器抑制了哪些后续查询。
+
+package xdns
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// NSECRangeMode 表示 NSEC 区间的生成方式
+type NSECRangeMode int
+
+const (
+	// NSECRangeExact 回复覆盖查询名称的最小区间，即正常的 NSEC 链
+	NSECRangeExact NSECRangeMode = iota
+	// NSECRangeOverlapping 回复以前驱名称为起点、以查询名称的子名称为终点的区间，
+	// 不同查询所得到的区间相互重叠，但与区域数据保持一致
+	NSECRangeOverlapping
+	// NSECRangeContradictory 回复跨越一个存在名称的区间，
+	// 之后查询该名称时仍正常回复，从而与此前的否定回答相矛盾
+	NSECRangeContradictory
+)
+
+// AggressiveNSECConfig 记录 AggressiveNSECResponser 的配置
+type AggressiveNSECConfig struct {
+	// 区域名称
+	Zone string
+	// 区域中存在的名称（不含区域顶点），其 A 记录指向 ServerIP
+	Names []string
+	// NSEC 区间的生成方式
+	Mode NSECRangeMode
+	// 回复 A 记录所使用的地址
+	ServerIP net.IP
+	// 记录的 TTL，同时用作 SOA MINIMUM
+	TTL uint32
+	// DNSSEC 配置
+	DNSSEC DNSSECConfig
+}
+
+// ServedNSEC 表示一条已回复给客户端的 NSEC 区间
+type ServedNSEC struct {
+	Owner string
+	Next  string
+	Time  time.Time
+}
+
+// AggressiveNSECResponser 是一个用于评估激进 NSEC 缓存行为的回复器实现。
+type AggressiveNSECResponser struct {
+	Config AggressiveNSECConfig
+	// 按客户端记录的查询历史
+	History *QueryHistory
+
+	// 按规范顺序排列的区域名称，首个元素为区域顶点
+	names []string
+	// 按客户端记录的已回复 NSEC 区间
+	served map[string][]ServedNSEC
+	mu     sync.Mutex
+	// 区域名与其相应 DNSSEC 材料的映射
+	materialMap sync.Map
+}
+
+// NewAggressiveNSECResponser 根据配置创建一个新的 AggressiveNSECResponser
+func NewAggressiveNSECResponser(conf AggressiveNSECConfig) *AggressiveNSECResponser {
+	conf.Zone = dns.CanonicalizeDomainName(&conf.Zone)
+	names := []string{conf.Zone}
+	for _, name := range conf.Names {
+		names = append(names, dns.CanonicalizeDomainName(&name))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return dns.CompareDomainName(names[i], names[j]) < 0
+	})
+
+	return &AggressiveNSECResponser{
+		Config:  conf,
+		History: NewQueryHistory(0),
+		names:   names,
+		served:  make(map[string][]ServedNSEC),
+	}
+}
+
+// exists 检查名称是否存在于区域中
+func (r *AggressiveNSECResponser) exists(name string) bool {
+	for _, n := range r.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nsecRange 根据生成方式返回覆盖指定名称的 NSEC 区间
+func (r *AggressiveNSECResponser) nsecRange(name string) (string, string) {
+	// 寻找名称的前驱
+	i := len(r.names) - 1
+	for j, n := range r.names {
+		if dns.CompareDomainName(n, name) > 0 {
+			i = j - 1
+			break
+		}
+	}
+	next := r.names[(i+1)%len(r.names)]
+
+	switch r.Config.Mode {
+	case NSECRangeOverlapping:
+		// "\000.<name>" 按规范顺序紧随 name 之后
+		return r.names[i], "\x00." + name
+	case NSECRangeContradictory:
+		return r.names[i], r.names[(i+2)%len(r.names)]
+	default:
+		return r.names[i], next
+	}
+}
+
+// newNSEC 生成 NSEC 记录
+func (r *AggressiveNSECResponser) newNSEC(owner, next string) dns.DNSResourceRecord {
+	types := []dns.DNSType{dns.DNSRRTypeA, dns.DNSRRTypeRRSIG, dns.DNSRRTypeNSEC}
+	if owner == r.Config.Zone {
+		types = []dns.DNSType{dns.DNSRRTypeSOA, dns.DNSRRTypeRRSIG, dns.DNSRRTypeNSEC, dns.DNSRRTypeDNSKEY}
+	}
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(owner),
+		Type:  dns.DNSRRTypeNSEC,
+		Class: dns.DNSClassIN,
+		TTL:   r.Config.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATANSEC{NextDomainName: next, TypeBitMaps: types},
+	}
+}
+
+// newSOA 生成区域的 SOA 记录
+func (r *AggressiveNSECResponser) newSOA() dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(r.Config.Zone),
+		Type:  dns.DNSRRTypeSOA,
+		Class: dns.DNSClassIN,
+		TTL:   r.Config.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATASOA{
+			MName:   "ns." + r.Config.Zone,
+			RName:   "hostmaster." + r.Config.Zone,
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			Minimum: r.Config.TTL,
+		},
+	}
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *AggressiveNSECResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+	clientIP := connInfo.ClientIP()
+	r.History.Record(clientIP, qName, qType)
+
+	resp := InitNXDOMAIN(qry)
+	if qName != r.Config.Zone && !strings.HasSuffix(qName, "."+r.Config.Zone) {
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	dMats := GetSignerMaterials(r.Config.Zone, &r.materialMap, r.Config.DNSSEC)
+	zsks := []CryptoMaterial{}
+	for _, dMat := range dMats {
+		zsks = append(zsks, ZSKCryptoMaterial(r.Config.Zone, dMat, r.Config.DNSSEC))
+	}
+
+	if r.exists(qName) {
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+		switch {
+		case qName == r.Config.Zone && qType == dns.DNSRRTypeDNSKEY:
+			keys := []dns.DNSResourceRecord{}
+			for _, dMat := range dMats {
+				keys = append(keys, dMat.ZSKRecord, dMat.KSKRecord)
+			}
+			resp.Answer = append(resp.Answer, keys...)
+			for _, dMat := range dMats {
+				resp.Answer = append(resp.Answer, SignSet(keys, KSKCryptoMaterial(r.Config.Zone, dMat, r.Config.DNSSEC)))
+			}
+		case qName == r.Config.Zone && qType == dns.DNSRRTypeSOA:
+			resp.Answer = SignSectionMulti(dns.DNSResponseSection{r.newSOA()}, zsks)
+		case qName != r.Config.Zone && qType == dns.DNSRRTypeA:
+			resp.Answer = SignSectionMulti(dns.DNSResponseSection{{
+				Name:  *dns.NewDNSName(qName),
+				Type:  dns.DNSRRTypeA,
+				Class: dns.DNSClassIN,
+				TTL:   r.Config.TTL,
+				RDLen: 0,
+				RData: &dns.DNSRDATAA{Address: r.Config.ServerIP},
+			}}, zsks)
+		default:
+			// NODATA
+			resp.Authority = SignSectionMulti(dns.DNSResponseSection{r.newSOA()}, zsks)
+		}
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	// NXDOMAIN：回复覆盖查询名称及通配符的 NSEC 区间
+	authority := dns.DNSResponseSection{r.newSOA()}
+	owner, next := r.nsecRange(qName)
+	authority = append(authority, r.newNSEC(owner, next))
+	r.serve(clientIP, owner, next)
+
+	wildcard := "*." + r.Config.Zone
+	if !dns.NSECCovers(owner, next, wildcard) {
+		wOwner, wNext := r.nsecRange(wildcard)
+		if wOwner != owner {
+			authority = append(authority, r.newNSEC(wOwner, wNext))
+			r.serve(clientIP, wOwner, wNext)
+		}
+	}
+	resp.Authority = SignSectionMulti(authority, zsks)
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
+
+// serve 记录回复给客户端的 NSEC 区间
+func (r *AggressiveNSECResponser) serve(clientIP net.IP, owner, next string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := clientIP.String()
+	r.served[key] = append(r.served[key], ServedNSEC{Owner: owner, Next: next, Time: time.Now()})
+}
+
+// Served 返回已回复给指定客户端的 NSEC 区间
+func (r *AggressiveNSECResponser) Served(clientIP net.IP) []ServedNSEC {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ServedNSEC{}, r.served[clientIP.String()]...)
+}
+
+// Evaluate 根据已回复的 NSEC 区间和查询历史，对探测名称进行分类
+// 其接受参数为：
+//   - clientIP net.IP，解析器的地址
+//   - probes []string，实验者经由解析器查询的探测名称
+//
+// 返回值为：
+//   - suppressed []string，被已回复区间覆盖、且此后未到达本服务器的名称，即被解析器抑制的查询
+//   - forwarded []string，被已回复区间覆盖、但此后仍到达本服务器的名称
+//
+// 未被任何已回复区间覆盖的探测名称不会出现在返回值中。
+// 探测名称应为此前未被查询过的新名称，否则其自身的查询会被误判。
+func (r *AggressiveNSECResponser) Evaluate(clientIP net.IP, probes []string) (suppressed []string, forwarded []string) {
+	served := r.Served(clientIP)
+	for _, probe := range probes {
+		probe = dns.CanonicalizeDomainName(&probe)
+		for _, nsec := range served {
+			if !dns.NSECCovers(nsec.Owner, nsec.Next, probe) {
+				continue
+			}
+			if r.History.Queried(clientIP, probe, nsec.Time) {
+				forwarded = append(forwarded, probe)
+			} else {
+				suppressed = append(suppressed, probe)
+			}
+			break
+		}
+	}
+	return suppressed, forwarded
+}
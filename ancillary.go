@@ -0,0 +1,72 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// ancillary.go 文件定义了 PacketInfo 数据包辅助信息。
+// 启用 ServerConfig.ReceiveAncillary 后，Netter 经由控制消息（IP_PKTINFO、IP_RECVTTL
+// 及其 IPv6 对应选项）取得 UDP 查询的接收接口、目的地址及 TTL / 跳数限制，
+// 并记录于 ConnectionInfo.Ancillary，使监听通配地址时也能得知客户端所查询的具体地址，
+// 支持任播式多地址实验。此时 UDP 回复将以查询的目的地址作为源地址发出。
+// 经由 TCP 的查询仅能取得目的地址。
+//
+// 平台相关的部分位于：
+//   - ancillary_linux.go：Linux 使用 IP_PKTINFO 等控制消息；
+//   - ancillary_other.go：其他平台不支持辅助信息，Ancillary 为零值。
+
+package xdns
+
+import (
+	"net"
+)
+
+// ancillaryBufferSize 为接收控制消息的缓冲区大小，足以容纳 PKTINFO 及 TTL 两条控制消息
+const ancillaryBufferSize = 128
+
+// PacketInfo 记录收到数据包时的辅助信息，无法取得的字段为零值
+type PacketInfo struct {
+	// 接收数据包的网络接口索引，0 表示未知
+	InterfaceIndex int
+	// 数据包的目的 IP 地址，即客户端所查询的本机地址，nil 表示未知
+	Destination net.IP
+	// 数据包到达时的 IPv4 TTL 或 IPv6 跳数限制，0 表示未知
+	TTL int
+}
+
+// Interface 返回接收数据包的网络接口，未知或查找失败时返回 nil
+func (p PacketInfo) Interface() *net.Interface {
+	if p.InterfaceIndex == 0 {
+		return nil
+	}
+	iface, err := net.InterfaceByIndex(p.InterfaceIndex)
+	if err != nil {
+		return nil
+	}
+	return iface
+}
+
+// readUDPWithAncillary 读取一个 UDP 数据包及其辅助信息
+func readUDPWithAncillary(conn *net.UDPConn, buf, oob []byte) (int, net.Addr, PacketInfo, error) {
+	n, oobn, _, addr, err := conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		return n, nil, PacketInfo{}, err
+	}
+	return n, addr, parseAncillary(oob[:oobn]), nil
+}
+
+// streamPacketInfo 返回流式链接的辅助信息，仅包含目的地址
+func streamPacketInfo(conn net.Conn) PacketInfo {
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		return PacketInfo{Destination: addr.IP}
+	}
+	return PacketInfo{}
+}
+
+// writePacket 将 UDP 回复写入查询所在的链接，
+// 已知查询的目的地址时以其作为回复的源地址，使监听通配地址时回复仍从客户端所查询的地址发出
+func writePacket(connInfo ConnectionInfo, data []byte) (int, error) {
+	conn, ok := connInfo.PacketConn.(*net.UDPConn)
+	addr, isUDP := connInfo.Address.(*net.UDPAddr)
+	if !ok || !isUDP || connInfo.Ancillary.Destination == nil {
+		return connInfo.PacketConn.WriteTo(data, connInfo.Address)
+	}
+	n, _, err := conn.WriteMsgUDP(data, sourceControlMessage(connInfo.Ancillary.Destination), addr)
+	return n, err
+}
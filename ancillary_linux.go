@@ -0,0 +1,89 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build linux
+
+package xdns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// enableAncillary 在 UDP 链接上启用 PKTINFO 及 TTL 控制消息，
+// 双栈套接字需同时启用 IPv4 及 IPv6 的选项，两者均失败时返回错误
+func enableAncillary(conn *net.UDPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("function enableAncillary failed:\n%v", err)
+	}
+	var err4, err6 error
+	ctrlErr := raw.Control(func(fd uintptr) {
+		s := int(fd)
+		if err4 = syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1); err4 == nil {
+			err4 = syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_RECVTTL, 1)
+		}
+		if err6 = syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO, 1); err6 == nil {
+			err6 = syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_RECVHOPLIMIT, 1)
+		}
+	})
+	if ctrlErr != nil {
+		return fmt.Errorf("function enableAncillary failed:\n%v", ctrlErr)
+	}
+	if err4 != nil && err6 != nil {
+		return fmt.Errorf("function enableAncillary failed:\n%v\n%v", err4, err6)
+	}
+	return nil
+}
+
+// parseAncillary 解析控制消息中的辅助信息
+func parseAncillary(oob []byte) PacketInfo {
+	info := PacketInfo{}
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return info
+	}
+	for _, msg := range msgs {
+		data := msg.Data
+		switch {
+		// struct in_pktinfo { int ipi_ifindex; struct in_addr ipi_spec_dst; struct in_addr ipi_addr; }
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_PKTINFO && len(data) >= 12:
+			info.InterfaceIndex = int(binary.NativeEndian.Uint32(data[0:4]))
+			info.Destination = net.IPv4(data[8], data[9], data[10], data[11])
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TTL && len(data) >= 4:
+			info.TTL = int(binary.NativeEndian.Uint32(data[0:4]))
+		// struct in6_pktinfo { struct in6_addr ipi6_addr; unsigned int ipi6_ifindex; }
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_PKTINFO && len(data) >= 20:
+			info.Destination = append(net.IP{}, data[0:16]...)
+			info.InterfaceIndex = int(binary.NativeEndian.Uint32(data[16:20]))
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_HOPLIMIT && len(data) >= 4:
+			info.TTL = int(binary.NativeEndian.Uint32(data[0:4]))
+		}
+	}
+	return info
+}
+
+// sourceControlMessage 返回以 src 作为 UDP 回复源地址的控制消息，src 为 nil 时返回 nil
+func sourceControlMessage(src net.IP) []byte {
+	if src == nil {
+		return nil
+	}
+	if ip4 := src.To4(); ip4 != nil {
+		oob := make([]byte, syscall.CmsgSpace(12))
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		h.Level = syscall.IPPROTO_IP
+		h.Type = syscall.IP_PKTINFO
+		h.SetLen(syscall.CmsgLen(12))
+		copy(oob[syscall.CmsgLen(0)+4:], ip4)
+		return oob
+	}
+	oob := make([]byte, syscall.CmsgSpace(20))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = syscall.IPPROTO_IPV6
+	h.Type = syscall.IPV6_PKTINFO
+	h.SetLen(syscall.CmsgLen(20))
+	copy(oob[syscall.CmsgLen(0):], src.To16())
+	return oob
+}
@@ -0,0 +1,26 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build !linux
+
+package xdns
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// enableAncillary 在不支持的平台上返回错误，UDP 查询的 Ancillary 将为零值
+func enableAncillary(conn *net.UDPConn) error {
+	return fmt.Errorf("function enableAncillary failed: ancillary data is not supported on %s", runtime.GOOS)
+}
+
+// parseAncillary 在不支持的平台上返回零值
+func parseAncillary(oob []byte) PacketInfo {
+	return PacketInfo{}
+}
+
+// sourceControlMessage 在不支持的平台上返回 nil，UDP 回复的源地址由系统选择
+func sourceControlMessage(src net.IP) []byte {
+	return nil
+}
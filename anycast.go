@@ -0,0 +1,216 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// anycast.go 文件定义了 AnycastResponser 任播模拟回复器。
+// 其使单个进程呈现多个逻辑服务器身份（模拟的任播节点），各身份具有不同的
+// NSID（RFC 5001）、SOA MNAME 及回复延迟，用于研究解析器在任播节点之间的选择行为。
+//
+// 身份按收到查询的本地监听地址选择，未匹配任何监听地址时按客户端 IP 的哈希选择，
+// 使得同一客户端总是到达同一节点，与任播路由的稳定性一致。
+// 改写 SOA MNAME 将使覆盖 SOA 的签名失效，如需有效签名，应在内层回复器中按身份签名。
+
+package xdns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// AnycastIdentity 表示一个逻辑服务器身份
+type AnycastIdentity struct {
+	// 身份名称，记录在追踪属性中
+	Name string
+	// NSID 选项的内容，查询携带 NSID 选项时在回复中返回，为空时不返回
+	NSID string
+	// 回复中 SOA 记录的 MNAME，为空时不改写
+	MName string
+	// 回复前的额外延迟
+	Latency time.Duration
+	// 该身份负责的本地监听地址，形如 "192.0.2.1:53"、"192.0.2.1" 或 ":5353"，
+	// 为空时仅参与按客户端哈希的选择
+	Listeners []string
+}
+
+// AnycastResponser 任播模拟回复器：包装一个回复器，并以选中的身份改写其回复。
+type AnycastResponser struct {
+	Responser Responser
+	// 逻辑服务器身份，不能为空
+	Identities []AnycastIdentity
+
+	mu     sync.Mutex
+	served map[string]uint64
+}
+
+// Select 返回负责该查询的身份
+// 其接受参数为：
+//   - connInfo ConnectionInfo，链接信息
+//
+// 返回值为：
+//   - *AnycastIdentity，首个负责查询所到达监听地址的身份，
+//     均不匹配时为按客户端 IP 哈希选择的身份
+func (r *AnycastResponser) Select(connInfo ConnectionInfo) *AnycastIdentity {
+	if local := localAddr(connInfo); local != nil {
+		for i := range r.Identities {
+			for _, listener := range r.Identities[i].Listeners {
+				if matchListener(listener, local) {
+					return &r.Identities[i]
+				}
+			}
+		}
+	}
+	h := fnv.New32a()
+	h.Write(connInfo.ClientIP())
+	return &r.Identities[h.Sum32()%uint32(len(r.Identities))]
+}
+
+// localAddr 返回收到查询的本地地址，无法取得时返回 nil，
+// 记录了辅助信息时以查询的目的地址代替监听的通配地址
+func localAddr(connInfo ConnectionInfo) net.Addr {
+	var local net.Addr
+	switch {
+	case connInfo.StreamConn != nil:
+		local = connInfo.StreamConn.LocalAddr()
+	case connInfo.PacketConn != nil:
+		local = connInfo.PacketConn.LocalAddr()
+	}
+	if dst := connInfo.Ancillary.Destination; dst != nil {
+		if udp, ok := local.(*net.UDPAddr); ok {
+			return &net.UDPAddr{IP: dst, Port: udp.Port}
+		}
+	}
+	return local
+}
+
+// matchListener 检查本地地址是否与监听地址相符，监听地址的 IP 或端口为空时匹配任意值
+func matchListener(listener string, local net.Addr) bool {
+	host, port, err := net.SplitHostPort(listener)
+	if err != nil {
+		host, port = listener, ""
+	}
+	localHost, localPort, err := net.SplitHostPort(local.String())
+	if err != nil {
+		return false
+	}
+	if host != "" && !net.ParseIP(host).Equal(net.ParseIP(localHost)) {
+		return false
+	}
+	return port == "" || port == localPort
+}
+
+// Response 以选中的身份生成被包装回复器的回复。
+func (r *AnycastResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+// 等待身份的延迟时，若上下文先行结束，则返回上下文的错误。
+func (r *AnycastResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	identity := r.Select(connInfo)
+	SpanFromContext(ctx).SetAttribute("xdns.anycast.identity", identity.Name)
+	r.mu.Lock()
+	if r.served == nil {
+		r.served = make(map[string]uint64)
+	}
+	r.served[identity.Name]++
+	r.mu.Unlock()
+
+	if identity.Latency > 0 {
+		timer := time.NewTimer(identity.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	data, err := Respond(ctx, r.Responser, connInfo)
+	if err != nil {
+		return data, err
+	}
+	wantNSID := false
+	if identity.NSID != "" {
+		if qry, err := ParseQuery(connInfo); err == nil {
+			if opt, ok := qry.OPT(); ok {
+				wantNSID = hasEDNSOption(ednsOptions(opt.RData), dns.EDNSOptionCodeNSID)
+			}
+		}
+	}
+	if !wantNSID && identity.MName == "" {
+		return data, nil
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return data, fmt.Errorf("method AnycastResponser ResponseContext failed: decode response failed.\n%v", err)
+	}
+	if identity.MName != "" {
+		for _, section := range []dns.DNSResponseSection{resp.Answer, resp.Authority} {
+			for i := range section {
+				if soa, ok := section[i].RData.(*dns.DNSRDATASOA); ok {
+					soa.MName = identity.MName
+					section[i].RDLen = uint16(soa.Size())
+				}
+			}
+		}
+	}
+	if wantNSID {
+		addEDNSOption(&resp, dns.EDNSOptionCodeNSID, []byte(identity.NSID))
+	}
+	FixCount(&resp)
+	return EncodeResponse(ctx, &resp), nil
+}
+
+// Served 返回各身份已回复的查询数量
+func (r *AnycastResponser) Served() map[string]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	served := make(map[string]uint64, len(r.served))
+	for name, n := range r.served {
+		served[name] = n
+	}
+	return served
+}
+
+// ednsOptions 返回 OPT 记录 RDATA 中全部选项的原始字节
+func ednsOptions(rdata dns.DNSRRRDATA) []byte {
+	if rdata == nil {
+		return nil
+	}
+	if _, ok := dns.OptionCodeOf(rdata); !ok {
+		return nil
+	}
+	return rdata.Encode()
+}
+
+// addEDNSOption 在消息的 OPT 记录中追加一个选项，消息没有 OPT 记录时添加之。
+// 由于 DNSRDATAOPT 只能表示单个选项，追加后的 RDATA 以原始字节表示。
+func addEDNSOption(msg *dns.DNSMessage, code uint16, data []byte) {
+	optIdx := -1
+	for i, rr := range msg.Additional {
+		if rr.Type == dns.DNSRRTypeOPT {
+			optIdx = i
+			break
+		}
+	}
+	if optIdx == -1 {
+		msg.Additional = append(msg.Additional, *dns.NewDNSRROPT(1232, 0, &dns.DNSRDATAOPT{}))
+		optIdx = len(msg.Additional) - 1
+	}
+
+	opt := &msg.Additional[optIdx]
+	options := append([]byte{}, ednsOptions(opt.RData)...)
+	option := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(option, code)
+	binary.BigEndian.PutUint16(option[2:], uint16(len(data)))
+	options = append(options, append(option, data...)...)
+	opt.RData = &dns.DNSRDATAUnknown{RRType: dns.DNSRRTypeOPT, RData: options}
+	opt.RDLen = uint16(len(options))
+	opt.IsStatic = false
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// budget.go 文件定义了单个回复构造过程的内存预算。
+// Go 无法限制单个协程的内存分配，因此预算是协作式的：
+// 服务器在 ServerConfig.ResponseMemoryLimit 不为 0 时为每个查询的上下文附加一个 MemoryBudget，
+// 回复器在生成大量记录前后调用 ChargeMemory 或 ChargeRecords 计入预计的内存占用，
+// 超出预算时返回 ErrMemoryBudgetExceeded 并中止构造，服务器将回复 SERVFAIL 并记录日志。
+// 这样，参数配置错误的攻击向量（如 DynamicCollidedDSNum）不会耗尽整个进程的内存。
+
+package xdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ErrMemoryBudgetExceeded 表示回复构造超出了内存预算
+var ErrMemoryBudgetExceeded = errors.New("response memory budget exceeded")
+
+// MemoryBudget 内存预算：记录单个回复构造过程已计入的内存占用。
+type MemoryBudget struct {
+	// 预算上限，单位为字节
+	Limit int64
+
+	used int64
+}
+
+// NewMemoryBudget 创建一个新的内存预算
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	return &MemoryBudget{
+		Limit: limit,
+	}
+}
+
+// Charge 计入指定字节数，超出预算时返回包装了 ErrMemoryBudgetExceeded 的错误
+// 超出预算后的计入仍会被累计，以便在日志中报告实际的需求。
+func (b *MemoryBudget) Charge(size int64) error {
+	used := atomic.AddInt64(&b.used, size)
+	if used > b.Limit {
+		return fmt.Errorf("%w: %d of %d bytes", ErrMemoryBudgetExceeded, used, b.Limit)
+	}
+	return nil
+}
+
+// Used 返回已计入的字节数
+func (b *MemoryBudget) Used() int64 {
+	return atomic.LoadInt64(&b.used)
+}
+
+// Remaining 返回预算中剩余的字节数，超出预算时为负数
+func (b *MemoryBudget) Remaining() int64 {
+	return b.Limit - b.Used()
+}
+
+// WithMemoryBudget 返回携带内存预算的上下文
+func WithMemoryBudget(ctx context.Context, budget *MemoryBudget) context.Context {
+	return context.WithValue(ctx, memoryBudgetKey, budget)
+}
+
+// MemoryBudgetFromContext 返回上下文中的内存预算，不存在时返回 nil
+func MemoryBudgetFromContext(ctx context.Context) *MemoryBudget {
+	budget, _ := ctx.Value(memoryBudgetKey).(*MemoryBudget)
+	return budget
+}
+
+// ChargeMemory 向上下文中的内存预算计入指定字节数，上下文未携带预算时总是返回 nil
+// 其接受参数为：
+//   - ctx context.Context，请求上下文
+//   - size int，计入的字节数
+//
+// 返回值为：
+//   - error，超出预算时返回包装了 ErrMemoryBudgetExceeded 的错误
+func ChargeMemory(ctx context.Context, size int) error {
+	budget := MemoryBudgetFromContext(ctx)
+	if budget == nil {
+		return nil
+	}
+	return budget.Charge(int64(size))
+}
+
+// ChargeRecords 按资源记录的大小向上下文中的内存预算计入，
+// 记录在内存中的实际占用大于其线路格式大小，因此该值为下界
+func ChargeRecords(ctx context.Context, rrs ...dns.DNSResourceRecord) error {
+	if MemoryBudgetFromContext(ctx) == nil {
+		return nil
+	}
+	size := 0
+	for _, rr := range rrs {
+		size += rr.Size()
+	}
+	return ChargeMemory(ctx, size)
+}
@@ -0,0 +1,269 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// catalog.go 文件实现了 DNS 目录区域（Catalog Zone，RFC 9432）的生成与解析。
+// 目录区域以普通区域的形式列出一组成员区域，
+// 次级服务器通过区域传送获取目录区域后，即可自动配置其中的成员区域，
+// 从而便于将大量实验区域批量下发至其他权威服务器，或从其他服务器处获取。
+
+package xdns
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// CatalogZoneVersion 为所生成目录区域的 schema 版本
+const CatalogZoneVersion = "2"
+
+// CatalogZone 表示一个目录区域
+type CatalogZone struct {
+	// 目录区域名称，如 "catalog.example"
+	Name string
+	// SOA 序列号，成员区域变化时自动递增
+	Serial uint32
+	// 目录区域记录的 TTL
+	TTL uint32
+
+	// 成员区域，键为成员唯一标识，值为成员区域名称
+	members map[string]string
+	mu      sync.RWMutex
+}
+
+// NewCatalogZone 创建一个新的空目录区域
+// 其接受参数为：
+//   - name string，目录区域名称
+//   - serial uint32，初始 SOA 序列号
+//
+// 返回值为：
+//   - *CatalogZone，创建的目录区域
+func NewCatalogZone(name string, serial uint32) *CatalogZone {
+	return &CatalogZone{
+		Name:    strings.ToLower(name),
+		Serial:  serial,
+		TTL:     0,
+		members: make(map[string]string),
+	}
+}
+
+// CatalogMemberID 根据成员区域名称生成其唯一标识。
+// 唯一标识为规范化域名的 SHA-1 摘要的十六进制表示，
+// 同一成员区域在不同目录区域中将得到相同的唯一标识。
+func CatalogMemberID(member string) string {
+	sum := sha1.Sum([]byte(dns.CanonicalizeDomainName(&member)))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddMember 向目录区域添加成员区域，并递增序列号
+// 若成员区域已存在，则不做任何改动。
+// 返回值为成员区域的唯一标识。
+func (c *CatalogZone) AddMember(member string) string {
+	member = strings.ToLower(member)
+	id := CatalogMemberID(member)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.members[id]; !ok {
+		c.members[id] = member
+		c.Serial++
+	}
+	return id
+}
+
+// RemoveMember 从目录区域中移除成员区域，并递增序列号
+// 返回值表示成员区域是否存在。
+func (c *CatalogZone) RemoveMember(member string) bool {
+	id := CatalogMemberID(strings.ToLower(member))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.members[id]; !ok {
+		return false
+	}
+	delete(c.members, id)
+	c.Serial++
+	return true
+}
+
+// Members 返回按名称排序的成员区域列表
+func (c *CatalogZone) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	members := make([]string, 0, len(c.members))
+	for _, member := range c.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// SOA 返回目录区域的 SOA 记录
+func (c *CatalogZone) SOA() dns.DNSResourceRecord {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(c.Name),
+		Type:  dns.DNSRRTypeSOA,
+		Class: dns.DNSClassIN,
+		TTL:   c.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATASOA{
+			MName:   "invalid",
+			RName:   "invalid",
+			Serial:  c.Serial,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  2147483646,
+			Minimum: 0,
+		},
+	}
+}
+
+// Records 返回目录区域的全部记录，顺序为：
+// SOA、NS、version TXT，以及按唯一标识排序的成员 PTR 记录。
+func (c *CatalogZone) Records() []dns.DNSResourceRecord {
+	rrs := []dns.DNSResourceRecord{c.SOA()}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// RFC 9432 要求目录区域具有一条指向 "invalid." 的 NS 记录
+	rrs = append(rrs, dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(c.Name),
+		Type:  dns.DNSRRTypeNS,
+		Class: dns.DNSClassIN,
+		TTL:   c.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATANS{NSDNAME: "invalid"},
+	})
+	rrs = append(rrs, dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName("version." + c.Name),
+		Type:  dns.DNSRRTypeTXT,
+		Class: dns.DNSClassIN,
+		TTL:   c.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATATXT{TXT: []string{CatalogZoneVersion}},
+	})
+
+	ids := make([]string, 0, len(c.members))
+	for id := range c.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rrs = append(rrs, dns.DNSResourceRecord{
+			Name:  *dns.NewDNSName(id + ".zones." + c.Name),
+			Type:  dns.DNSRRTypePTR,
+			Class: dns.DNSClassIN,
+			TTL:   c.TTL,
+			RDLen: 0,
+			RData: &dns.DNSRDATAPTR{PTR: c.members[id]},
+		})
+	}
+	return rrs
+}
+
+// ParseCatalogZone 从目录区域的记录中解析出目录区域，
+// 可用于处理从其他权威服务器处传送得到的目录区域。
+// 其接受参数为：
+//   - name string，目录区域名称
+//   - rrs []dns.DNSResourceRecord，目录区域的全部记录
+//
+// 返回值为：
+//   - *CatalogZone，解析得到的目录区域
+//   - error，错误信息，当 schema 版本不受支持时返回错误
+func ParseCatalogZone(name string, rrs []dns.DNSResourceRecord) (*CatalogZone, error) {
+	catalog := NewCatalogZone(name, 0)
+	zonesSuffix := ".zones." + catalog.Name
+	versionName := "version." + catalog.Name
+	version := ""
+
+	for _, rr := range rrs {
+		owner := strings.ToLower(rr.Name.DomainName)
+		switch {
+		case rr.Type == dns.DNSRRTypeSOA && owner == catalog.Name:
+			if soa, ok := rr.RData.(*dns.DNSRDATASOA); ok {
+				catalog.Serial = soa.Serial
+				catalog.TTL = rr.TTL
+			}
+		case rr.Type == dns.DNSRRTypeTXT && owner == versionName:
+			if txt, ok := rr.RData.(*dns.DNSRDATATXT); ok {
+				version = txt.Text()
+			}
+		case rr.Type == dns.DNSRRTypePTR && strings.HasSuffix(owner, zonesSuffix):
+			id := strings.TrimSuffix(owner, zonesSuffix)
+			// 跳过成员属性（如 group.<id>.zones.<catalog>）
+			if strings.Contains(id, ".") {
+				continue
+			}
+			if ptr, ok := rr.RData.(*dns.DNSRDATAPTR); ok {
+				catalog.members[id] = strings.ToLower(ptr.PTR)
+			}
+		}
+	}
+
+	if version != CatalogZoneVersion {
+		return nil, fmt.Errorf("function ParseCatalogZone failed: unsupported catalog zone version %q", version)
+	}
+	return catalog, nil
+}
+
+// CatalogResponser 是一个提供目录区域服务的回复器实现。
+// 其回复目录区域内的查询，并支持通过 TCP 进行 AXFR 区域传送。
+type CatalogResponser struct {
+	Catalog *CatalogZone
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *CatalogResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	resp := InitNXDOMAIN(qry)
+	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+
+	if qName != r.Catalog.Name && !strings.HasSuffix(qName, "."+r.Catalog.Name) {
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	rrs := r.Catalog.Records()
+	if qType == dns.DNSQTypeAXFR {
+		if connInfo.Protocol != ProtocolTCP {
+			resp.Header.RCode = dns.DNSResponseCodeRefused
+		} else {
+			resp.Header.RCode = dns.DNSResponseCodeNoErr
+			resp.Answer = append(rrs, rrs[0])
+		}
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	nameExists := false
+	for _, rr := range rrs {
+		if strings.ToLower(rr.Name.DomainName) != qName {
+			continue
+		}
+		nameExists = true
+		if rr.Type == qType {
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+	if nameExists {
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+	}
+	if len(resp.Answer) == 0 {
+		resp.Authority = append(resp.Authority, rrs[0])
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// chain.go 文件定义了 ChainGenerator 别名链生成器，
+// 其可以生成长度、分支数、跨区域跳转及环路均可配置的 CNAME / DNAME 链，
+// 并按一次性回复完整链或按查询逐跳回复的方式生成记录，
+// 从而在无需自行解析标签的情况下，测绘解析器的别名链长度及环路检测上限。
+
+package xdns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ChainMode 表示别名链的回复方式
+type ChainMode int
+
+const (
+	// ChainModeStep 每次查询仅回复被查询名称所在的一跳
+	ChainModeStep ChainMode = iota
+	// ChainModeFull 每次查询回复自被查询名称起的完整链
+	ChainModeFull
+)
+
+// ChainConfig 记录别名链生成器的配置
+type ChainConfig struct {
+	// 别名链所在的区域，至少包含一个区域，第 d 跳位于 Zones[d % len(Zones)]，
+	// 配置多个区域即可产生跨区域跳转
+	Zones []string
+	// 链长度，即任一路径上别名记录的数量
+	Length int
+	// 分支数，每一跳指向的下一跳数量，大于 1 时将产生包含多条 CNAME 的非法 RRset，
+	// 第 d 跳共有 Branching^d 个节点
+	Branching int
+	// 是否产生环路，为 true 时最后一跳将指回第 CycleTo 跳，链中不再包含终点
+	Cycle bool
+	// 环路起点，需小于 Length
+	CycleTo int
+	// 是否使用 DNAME 记录代替 CNAME 记录
+	DNAME bool
+	// 回复方式
+	Mode ChainMode
+	// 终点 A 记录的地址
+	Address net.IP
+	// 记录的 TTL
+	TTL uint32
+}
+
+// ChainGenerator 别名链生成器：根据配置生成 CNAME / DNAME 链中的记录。
+type ChainGenerator struct {
+	Config ChainConfig
+
+	// 别名节点名称与其目标名称的映射
+	targets map[string][]string
+	// 终点节点名称
+	terminals map[string]bool
+}
+
+// NewChainGenerator 根据配置创建一个新的别名链生成器
+func NewChainGenerator(conf ChainConfig) *ChainGenerator {
+	if conf.Branching < 1 {
+		conf.Branching = 1
+	}
+	if conf.Length < 0 {
+		conf.Length = 0
+	}
+	if conf.CycleTo < 0 || conf.CycleTo >= conf.Length {
+		conf.Cycle = false
+	}
+	zones := make([]string, 0, len(conf.Zones))
+	for _, zone := range conf.Zones {
+		zones = append(zones, dns.CanonicalizeDomainName(&zone))
+	}
+	conf.Zones = zones
+
+	g := &ChainGenerator{
+		Config:    conf,
+		targets:   make(map[string][]string),
+		terminals: make(map[string]bool),
+	}
+
+	width := 1
+	for d := 0; d < conf.Length; d++ {
+		for k := 0; k < width; k++ {
+			owner := g.nodeName(d, k)
+			for j := 0; j < conf.Branching; j++ {
+				var target string
+				if d == conf.Length-1 && conf.Cycle {
+					target = g.nodeName(conf.CycleTo, (k*conf.Branching+j)%g.width(conf.CycleTo))
+				} else {
+					target = g.nodeName(d+1, k*conf.Branching+j)
+				}
+				g.targets[owner] = append(g.targets[owner], target)
+			}
+		}
+		width *= conf.Branching
+	}
+	if !conf.Cycle {
+		for k := 0; k < width; k++ {
+			g.terminals[g.nodeName(conf.Length, k)] = true
+		}
+	}
+	return g
+}
+
+// width 返回第 d 跳的节点数量
+func (g *ChainGenerator) width(d int) int {
+	width := 1
+	for i := 0; i < d; i++ {
+		width *= g.Config.Branching
+	}
+	return width
+}
+
+// nodeName 返回第 d 跳中第 k 个节点的名称
+func (g *ChainGenerator) nodeName(d, k int) string {
+	zone := g.Config.Zones[d%len(g.Config.Zones)]
+	return fmt.Sprintf("c%d-%d.%s", d, k, zone)
+}
+
+// Start 返回链的起始名称，DNAME 链的起始名称位于起始节点之下
+func (g *ChainGenerator) Start() string {
+	if g.Config.DNAME {
+		return "www." + g.nodeName(0, 0)
+	}
+	return g.nodeName(0, 0)
+}
+
+// step 返回被查询名称所在一跳的记录，以及其指向的下一跳名称
+func (g *ChainGenerator) step(qName string) ([]dns.DNSResourceRecord, []string) {
+	qName = strings.ToLower(qName)
+	if !g.Config.DNAME {
+		if g.terminals[qName] {
+			return []dns.DNSResourceRecord{g.newRR(qName, &dns.DNSRDATAA{Address: g.Config.Address})}, nil
+		}
+		rrs := []dns.DNSResourceRecord{}
+		for _, target := range g.targets[qName] {
+			rrs = append(rrs, g.newRR(qName, &dns.DNSRDATACNAME{CNAME: target}))
+		}
+		return rrs, g.targets[qName]
+	}
+
+	// DNAME 仅作用于其所有者名称之下的名称
+	for owner, targets := range g.targets {
+		if !strings.HasSuffix(qName, "."+owner) {
+			continue
+		}
+		prefix := strings.TrimSuffix(qName, "."+owner)
+		rrs := []dns.DNSResourceRecord{}
+		next := []string{}
+		for _, target := range targets {
+			rrs = append(rrs, g.newRR(owner, &dns.DNSRDATADNAME{DNAME: target}))
+		}
+		for _, target := range targets {
+			synthesized := prefix + "." + target
+			rrs = append(rrs, g.newRR(qName, &dns.DNSRDATACNAME{CNAME: synthesized}))
+			next = append(next, synthesized)
+		}
+		return rrs, next
+	}
+	for terminal := range g.terminals {
+		if strings.HasSuffix(qName, "."+terminal) {
+			return []dns.DNSResourceRecord{g.newRR(qName, &dns.DNSRDATAA{Address: g.Config.Address})}, nil
+		}
+	}
+	return []dns.DNSResourceRecord{}, nil
+}
+
+// Step 返回被查询名称所在一跳的记录
+// 对于别名节点，返回其 CNAME（或 DNAME 及合成的 CNAME）记录；
+// 对于终点节点，返回其 A 记录；名称不在链中时返回空切片。
+func (g *ChainGenerator) Step(qName string) []dns.DNSResourceRecord {
+	rrs, _ := g.step(qName)
+	return rrs
+}
+
+// Chain 返回自被查询名称起的完整链，遇到已访问过的名称（即环路）时停止展开
+func (g *ChainGenerator) Chain(qName string) []dns.DNSResourceRecord {
+	rrs := []dns.DNSResourceRecord{}
+	visited := map[string]bool{}
+	queue := []string{strings.ToLower(qName)}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		stepRRs, next := g.step(name)
+		rrs = append(rrs, stepRRs...)
+		queue = append(queue, next...)
+	}
+	return rrs
+}
+
+// Records 根据回复方式返回被查询名称的回答记录
+func (g *ChainGenerator) Records(qName string) []dns.DNSResourceRecord {
+	if g.Config.Mode == ChainModeFull {
+		return g.Chain(qName)
+	}
+	return g.Step(qName)
+}
+
+// newRR 生成链中的资源记录
+func (g *ChainGenerator) newRR(owner string, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(owner),
+		Type:  rdata.Type(),
+		Class: dns.DNSClassIN,
+		TTL:   g.Config.TTL,
+		RDLen: 0,
+		RData: rdata,
+	}
+}
+
+// ChainResponser 是一个使用 ChainGenerator 回复别名链的回复器实现。
+// 链以外的名称将得到 NXDOMAIN 回复。
+type ChainResponser struct {
+	Generator *ChainGenerator
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *ChainResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	resp := InitNXDOMAIN(qry)
+	resp.Answer = r.Generator.Records(qry.Question[0].Name.DomainName)
+	if len(resp.Answer) != 0 {
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
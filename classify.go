@@ -0,0 +1,154 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// classify.go 文件定义了 QueryClassCache 查询分类缓存。
+// 解析器超时重传时会发送问题部分完全相同的查询，
+// 回复器对其所作的分类决定（如所属区域、攻击向量分支）也必然相同。
+// 查询分类缓存以问题部分的原始字节为键缓存这些决定，
+// 使得重复的查询无需再次解码并逐个比较查询名称，减少计时敏感实验中的延迟抖动。
+//
+// 键直接取自数据包，区分大小写：经 0x20 混淆的重传查询将各自缓存。
+
+package xdns
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueryClassCapacity 为查询分类缓存默认的最大条目数量
+const DefaultQueryClassCapacity = 4096
+
+// classEntry 表示查询分类缓存中的一个条目
+type classEntry struct {
+	key   string
+	class interface{}
+}
+
+// QueryClassCache 查询分类缓存：以问题部分的原始字节为键的 LRU 缓存。
+// 其零值即可使用，并发安全。
+type QueryClassCache struct {
+	// 最大条目数量，超出时淘汰最久未使用的条目，0 表示 DefaultQueryClassCapacity
+	Capacity int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	hits    uint64
+	misses  uint64
+}
+
+// NewQueryClassCache 创建一个新的查询分类缓存
+func NewQueryClassCache(capacity int) *QueryClassCache {
+	return &QueryClassCache{Capacity: capacity}
+}
+
+// questionKey 返回数据包中问题部分（第一个问题的名称、类型及类别）的原始字节。
+// 数据包不完整、不含问题或名称使用压缩指针时返回 false。
+func questionKey(packet []byte) ([]byte, bool) {
+	if len(packet) < 12 || packet[4] == 0 && packet[5] == 0 {
+		return nil, false
+	}
+	offset := 12
+	for offset < len(packet) {
+		labelLen := int(packet[offset])
+		if labelLen == 0 {
+			if offset+5 > len(packet) {
+				return nil, false
+			}
+			return packet[12 : offset+5], true
+		}
+		// 查询中的名称不应被压缩
+		if labelLen&0xC0 != 0 {
+			return nil, false
+		}
+		offset += labelLen + 1
+	}
+	return nil, false
+}
+
+// Get 返回数据包所对应的分类决定
+// 其接受参数为：
+//   - packet []byte，查询数据包
+//
+// 返回值为：
+//   - interface{}，由 Add 记录的分类决定
+//   - bool，是否命中缓存
+func (c *QueryClassCache) Get(packet []byte) (interface{}, bool) {
+	key, ok := questionKey(packet)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	// 以 string(key) 作为 map 索引时不会复制 key
+	elem, ok := c.entries[string(key)]
+	if ok {
+		c.order.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	serverVars.Add("query_class_hits", 1)
+	return elem.Value.(*classEntry).class, true
+}
+
+// Add 记录数据包所对应的分类决定，无法取得问题部分的数据包将被忽略。
+// 分类决定应仅取决于问题部分，而与报文 ID、标志位及客户端无关。
+func (c *QueryClassCache) Add(packet []byte, class interface{}) {
+	key, ok := questionKey(packet)
+	if !ok {
+		return
+	}
+	capacity := c.Capacity
+	if capacity <= 0 {
+		capacity = DefaultQueryClassCapacity
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+	if elem, ok := c.entries[string(key)]; ok {
+		elem.Value.(*classEntry).class = class
+		c.order.MoveToFront(elem)
+		return
+	}
+	entry := &classEntry{key: string(key), class: class}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*classEntry).key)
+	}
+}
+
+// Len 返回缓存中的条目数量
+func (c *QueryClassCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Reset 清空全部条目，分类规则改变后应调用
+func (c *QueryClassCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.order = nil
+}
+
+// Hits 返回命中缓存的查询数量
+func (c *QueryClassCache) Hits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+// Misses 返回未命中缓存的查询数量
+func (c *QueryClassCache) Misses() uint64 {
+	return atomic.LoadUint64(&c.misses)
+}
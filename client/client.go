@@ -0,0 +1,234 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// Package client 实现了一个简单的 DNS 客户端，
+// 可用于向 xdns 自身或其他 DNS 服务器发送查询，以便进行测量及实验。
+//
+// 客户端默认使用 UDP 发送查询，当回复被截断（TC 标志）时，自动改用 TCP 重新查询。
+// 配置了 Validator 时，客户端如同验证解析器一样验证每个回复，详见 Validator。
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ClientConfig 记录 DNS 客户端的配置
+type ClientConfig struct {
+	// 服务器地址，形如 "127.0.0.1:53"
+	Server string
+	// 单次查询的超时时间，0 表示 5 秒
+	Timeout time.Duration
+	// EDNS UDP 载荷大小，0 表示不发送 OPT 记录
+	UDPSize uint16
+	// 是否设置 DO 标志，请求 DNSSEC 记录，仅在 UDPSize 不为 0 时生效
+	DNSSECOK bool
+	// 是否总是使用 TCP
+	ForceTCP bool
+	// 出站查询引擎，设置后 UDP 查询经由引擎的套接字发送，由引擎负责重传，为 nil 时每次查询新建套接字
+	Engine *Engine
+	// 回复验证器，如 xperi.StubValidator，为 nil 时不验证回复。
+	// 设置后查询总是携带 DO 标志，UDPSize 为 0 时使用 DefaultValidatingUDPSize
+	Validator Validator
+}
+
+// DefaultValidatingUDPSize 为验证模式下未配置 UDPSize 时使用的 EDNS UDP 载荷大小
+const DefaultValidatingUDPSize = 1232
+
+// Validator 回复验证器。
+// 客户端在 Exchange 收到回复后调用 Validate，验证失败时 Exchange 返回回复及验证错误。
+type Validator interface {
+	// Validate 验证回复，
+	// query 用于查询验证所需的 DNSKEY、DS 等记录，其查询携带 DO 标志，回复不经过验证
+	Validate(query func(qName string, qType dns.DNSType) (dns.DNSMessage, error), qry, resp dns.DNSMessage) error
+}
+
+// Client 是一个 DNS 客户端
+type Client struct {
+	Config ClientConfig
+}
+
+// NewClient 根据配置创建一个新的 DNS 客户端
+func NewClient(conf ClientConfig) *Client {
+	if conf.Timeout == 0 {
+		conf.Timeout = 5 * time.Second
+	}
+	if conf.Validator != nil {
+		if conf.UDPSize == 0 {
+			conf.UDPSize = DefaultValidatingUDPSize
+		}
+		conf.DNSSECOK = true
+	}
+	return &Client{
+		Config: conf,
+	}
+}
+
+// randomID 返回密码学安全的随机事务 ID，使事务 ID 不可被预测，以抵御伪造回复
+func randomID() uint16 {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintln("function randomID failed: read crypto/rand failed:\n", err))
+	}
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// NewQuery 根据客户端配置构造一个查询消息
+// 其接受参数为：
+//   - qName string，查询名称
+//   - qType dns.DNSType，查询类型
+//
+// 返回值为：
+//   - dns.DNSMessage，构造的查询消息
+func (c *Client) NewQuery(qName string, qType dns.DNSType) dns.DNSMessage {
+	qry := dns.DNSMessage{
+		Header: dns.DNSHeader{
+			ID:     randomID(),
+			QR:     false,
+			OpCode: dns.DNSOpCodeQuery,
+			RD:     false,
+		},
+		Question: dns.DNSQuestionSection{
+			{
+				Name:  *dns.NewDNSName(qName),
+				Type:  qType,
+				Class: dns.DNSClassIN,
+			},
+		},
+		Answer:     dns.DNSResponseSection{},
+		Authority:  dns.DNSResponseSection{},
+		Additional: dns.DNSResponseSection{},
+	}
+	if c.Config.UDPSize != 0 {
+		opt := dns.DNSOPTRecord{
+			UDPPayloadSize: c.Config.UDPSize,
+			DO:             c.Config.DNSSECOK,
+		}
+		qry.Additional = append(qry.Additional, opt.ResourceRecord())
+	}
+	qry.Header.QDCount = uint16(len(qry.Question))
+	qry.Header.ARCount = uint16(len(qry.Additional))
+	return qry
+}
+
+// Query 构造并发送查询，返回解析后的回复
+func (c *Client) Query(qName string, qType dns.DNSType) (dns.DNSMessage, error) {
+	return c.Exchange(c.NewQuery(qName, qType))
+}
+
+// Exchange 发送查询消息并返回解析后的回复。
+// 若使用 UDP 收到的回复被截断，将自动改用 TCP 重新查询。
+// 配置了 Validator 时验证回复，验证失败时同时返回回复及错误。
+func (c *Client) Exchange(qry dns.DNSMessage) (dns.DNSMessage, error) {
+	resp, err := c.exchange(qry)
+	if err != nil || c.Config.Validator == nil {
+		return resp, err
+	}
+	if err := c.Config.Validator.Validate(c.queryUnvalidated, qry, resp); err != nil {
+		return resp, fmt.Errorf("method Client Exchange failed: response is bogus.\n%w", err)
+	}
+	return resp, nil
+}
+
+// queryUnvalidated 构造并发送查询，其回复不经过验证，供验证器查询 DNSKEY、DS 等记录
+func (c *Client) queryUnvalidated(qName string, qType dns.DNSType) (dns.DNSMessage, error) {
+	return c.exchange(c.NewQuery(qName, qType))
+}
+
+// exchange 发送查询消息并返回解析后的回复，UDP 回复被截断时改用 TCP 重新查询
+func (c *Client) exchange(qry dns.DNSMessage) (dns.DNSMessage, error) {
+	if !c.Config.ForceTCP {
+		resp, err := c.ExchangeUDP(qry)
+		if err != nil || !resp.Header.TC {
+			return resp, err
+		}
+	}
+	return c.ExchangeTCP(qry)
+}
+
+// ExchangeUDP 使用 UDP 发送查询消息并返回解析后的回复，
+// 配置了 Engine 时经由引擎发送，超时时间为引擎全部重传的总时长上限。
+func (c *Client) ExchangeUDP(qry dns.DNSMessage) (dns.DNSMessage, error) {
+	if c.Config.Engine != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Config.Timeout)
+		defer cancel()
+		return c.Config.Engine.Exchange(ctx, c.Config.Server, qry)
+	}
+	data, err := c.ExchangeRaw(qry.Encode(), "udp")
+	if err != nil {
+		return dns.DNSMessage{}, err
+	}
+	return decodeResponse(qry, data)
+}
+
+// ExchangeTCP 使用 TCP 发送查询消息并返回解析后的回复
+func (c *Client) ExchangeTCP(qry dns.DNSMessage) (dns.DNSMessage, error) {
+	data, err := c.ExchangeRaw(qry.Encode(), "tcp")
+	if err != nil {
+		return dns.DNSMessage{}, err
+	}
+	return decodeResponse(qry, data)
+}
+
+// ExchangeRaw 发送原始的查询字节，并返回原始的回复字节，
+// 可用于发送刻意构造的畸形查询。
+// 其接受参数为：
+//   - packet []byte，查询字节
+//   - network string，"udp" 或 "tcp"
+//
+// 返回值为：
+//   - []byte，回复字节
+//   - error，错误信息
+func (c *Client) ExchangeRaw(packet []byte, network string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, c.Config.Server, c.Config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("method Client ExchangeRaw failed: dial %s failed.\n%v", c.Config.Server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Config.Timeout))
+
+	if network == "tcp" {
+		lenBytes := make([]byte, 2)
+		binary.BigEndian.PutUint16(lenBytes, uint16(len(packet)))
+		buffers := net.Buffers{lenBytes, packet}
+		if _, err := buffers.WriteTo(conn); err != nil {
+			return nil, fmt.Errorf("method Client ExchangeRaw failed: write query failed.\n%v", err)
+		}
+		if _, err := io.ReadFull(conn, lenBytes); err != nil {
+			return nil, fmt.Errorf("method Client ExchangeRaw failed: read length failed.\n%v", err)
+		}
+		data := make([]byte, binary.BigEndian.Uint16(lenBytes))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return nil, fmt.Errorf("method Client ExchangeRaw failed: read response failed.\n%v", err)
+		}
+		return data, nil
+	}
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, fmt.Errorf("method Client ExchangeRaw failed: write query failed.\n%v", err)
+	}
+	data := make([]byte, 65535)
+	n, err := conn.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("method Client ExchangeRaw failed: read response failed.\n%v", err)
+	}
+	return data[:n], nil
+}
+
+// decodeResponse 解码回复，并检查其 ID 是否与查询一致
+func decodeResponse(qry dns.DNSMessage, data []byte) (dns.DNSMessage, error) {
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return dns.DNSMessage{}, fmt.Errorf("decode response failed.\n%v", err)
+	}
+	if resp.Header.ID != qry.Header.ID {
+		return resp, fmt.Errorf("response ID %d mismatches query ID %d", resp.Header.ID, qry.Header.ID)
+	}
+	return resp, nil
+}
@@ -0,0 +1,375 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// engine.go 文件定义了出站查询引擎 Engine。
+// 不同于 Client 每次查询都新建一个套接字，引擎在单个长期打开的 UDP 套接字上收发全部出站查询：
+// 为每个查询分配同一目的地址的在途查询中不重复的事务 ID，未收到回复时以指数退避重传，
+// 识别重传引起的重复回复及来源、ID 或问题不符的回复，并限制每个目的地址的在途查询数量。
+//
+// 在 ClientConfig 中设置 Engine 后，客户端的 UDP 查询均经由引擎发送，
+// 从而使转发、次级区域及客户端共享同一个套接字及同一套重传策略。
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// EngineConfig 记录出站查询引擎的配置
+type EngineConfig struct {
+	// 本地地址，形如 "0.0.0.0:0"，为空时由系统选择
+	LocalAddr string
+	// 首次发送后等待回复的时间，0 表示 500 毫秒，此后每次重传等待时间加倍
+	InitialTimeout time.Duration
+	// 重传等待时间的上限，0 表示 4 秒
+	MaxTimeout time.Duration
+	// 每个查询最多发送的次数（含首次发送），0 表示 3
+	Attempts int
+	// 每个目的地址的最大在途查询数量，0 表示 64，超出时查询等待其他查询完成
+	MaxPerDestination int
+	// 日志输出，为 nil 时不输出日志
+	LogWriter io.Writer
+}
+
+// EngineStats 记录出站查询引擎的统计
+type EngineStats struct {
+	// 发送的查询数据包数量，含重传
+	Sent uint64 `json:"sent"`
+	// 重传的数量
+	Retransmitted uint64 `json:"retransmitted"`
+	// 收到回复的查询数量
+	Answered uint64 `json:"answered"`
+	// 全部重传后仍未收到回复的查询数量
+	TimedOut uint64 `json:"timed_out"`
+	// 查询已收到回复后再次收到的回复数量，通常由重传引起
+	Duplicates uint64 `json:"duplicates"`
+	// 来源及 ID 与任何查询均不符的回复数量
+	Unexpected uint64 `json:"unexpected"`
+	// 来源及 ID 相符但问题不符的回复数量，此类回复被丢弃
+	Mismatched uint64 `json:"mismatched"`
+	// 无法解析的数据包数量
+	Malformed uint64 `json:"malformed"`
+}
+
+// pendingKey 标识一个在途查询：目的地址及事务 ID
+type pendingKey struct {
+	dest string
+	id   uint16
+}
+
+// pendingQuery 记录一个在途查询
+type pendingQuery struct {
+	question dns.DNSQuestionSection
+	resp     chan dns.DNSMessage
+	answered bool
+}
+
+// Engine 出站查询引擎
+type Engine struct {
+	Config       EngineConfig
+	EngineLogger *log.Logger
+
+	conn   net.PacketConn
+	closed chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	pending map[pendingKey]*pendingQuery
+	// 已完成查询的完成时间，用于识别迟到的重复回复
+	recent map[pendingKey]time.Time
+	limits map[string]chan struct{}
+	stats  EngineStats
+}
+
+// NewEngine 根据配置创建一个新的出站查询引擎，打开其 UDP 套接字并开始接收回复
+// 其接受参数为：
+//   - conf EngineConfig，出站查询引擎配置
+//
+// 返回值为：
+//   - *Engine，创建的出站查询引擎
+//   - error，打开套接字失败时返回错误
+func NewEngine(conf EngineConfig) (*Engine, error) {
+	if conf.InitialTimeout <= 0 {
+		conf.InitialTimeout = 500 * time.Millisecond
+	}
+	if conf.MaxTimeout <= 0 {
+		conf.MaxTimeout = 4 * time.Second
+	}
+	if conf.Attempts <= 0 {
+		conf.Attempts = 3
+	}
+	if conf.MaxPerDestination <= 0 {
+		conf.MaxPerDestination = 64
+	}
+	if conf.LogWriter == nil {
+		conf.LogWriter = io.Discard
+	}
+	conn, err := net.ListenPacket("udp", conf.LocalAddr)
+	if err != nil {
+		return nil, fmt.Errorf("function NewEngine failed: listen on %q failed.\n%v", conf.LocalAddr, err)
+	}
+	return newEngine(conf, conn), nil
+}
+
+// newEngine 在已打开的套接字上创建引擎并开始接收回复，conf 须已填充默认值
+func newEngine(conf EngineConfig, conn net.PacketConn) *Engine {
+	e := &Engine{
+		Config:       conf,
+		EngineLogger: log.New(conf.LogWriter, "Engine: ", log.LstdFlags),
+		conn:         conn,
+		closed:       make(chan struct{}),
+		pending:      map[pendingKey]*pendingQuery{},
+		recent:       map[pendingKey]time.Time{},
+		limits:       map[string]chan struct{}{},
+	}
+	go e.receive()
+	return e
+}
+
+// LocalAddr 返回引擎套接字的本地地址
+func (e *Engine) LocalAddr() net.Addr {
+	return e.conn.LocalAddr()
+}
+
+// Stats 返回引擎的统计
+func (e *Engine) Stats() EngineStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// Close 关闭引擎的套接字，在途的查询立即返回错误
+func (e *Engine) Close() error {
+	err := error(nil)
+	e.once.Do(func() {
+		close(e.closed)
+		err = e.conn.Close()
+	})
+	return err
+}
+
+// Exchange 经由引擎向服务器发送查询，并返回解析后的回复。
+// 查询的事务 ID 由引擎分配，回复的 ID 被恢复为查询原有的 ID。
+// 其接受参数为：
+//   - ctx context.Context，上下文，结束时停止等待回复
+//   - server string，服务器地址，形如 "127.0.0.1:53"
+//   - qry dns.DNSMessage，查询消息
+//
+// 返回值为：
+//   - dns.DNSMessage，解析后的回复
+//   - error，全部重传后仍未收到回复、上下文结束或引擎已关闭时返回错误
+func (e *Engine) Exchange(ctx context.Context, server string, qry dns.DNSMessage) (dns.DNSMessage, error) {
+	addr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: resolve %s failed.\n%v", server, err)
+	}
+	dest := addr.String()
+
+	limit := e.limit(dest)
+	select {
+	case limit <- struct{}{}:
+		defer func() { <-limit }()
+	case <-ctx.Done():
+		return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: %v", ctx.Err())
+	case <-e.closed:
+		return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: engine closed")
+	}
+
+	p := &pendingQuery{question: qry.Question, resp: make(chan dns.DNSMessage, 1)}
+	id := e.register(dest, p)
+	defer e.unregister(dest, id)
+	originalID := qry.Header.ID
+	qry.Header.ID = id
+	packet := qry.Encode()
+
+	timeout := e.Config.InitialTimeout
+	for attempt := 0; attempt < e.Config.Attempts; attempt++ {
+		if _, err := e.conn.WriteTo(packet, addr); err != nil {
+			return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: write query failed.\n%v", err)
+		}
+		e.mu.Lock()
+		e.stats.Sent++
+		if attempt > 0 {
+			e.stats.Retransmitted++
+		}
+		e.mu.Unlock()
+
+		timer := time.NewTimer(timeout)
+		select {
+		case resp := <-p.resp:
+			timer.Stop()
+			resp.Header.ID = originalID
+			return resp, nil
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: %v", ctx.Err())
+		case <-e.closed:
+			timer.Stop()
+			return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: engine closed")
+		}
+		timeout = e.nextTimeout(timeout)
+	}
+
+	e.mu.Lock()
+	e.stats.TimedOut++
+	e.mu.Unlock()
+	return dns.DNSMessage{}, fmt.Errorf("method Engine Exchange failed: no response from %s after %d attempts", server, e.Config.Attempts)
+}
+
+// nextTimeout 返回下一次重传的等待时间：加倍，但不超过 MaxTimeout
+func (e *Engine) nextTimeout(timeout time.Duration) time.Duration {
+	if timeout *= 2; timeout > e.Config.MaxTimeout {
+		timeout = e.Config.MaxTimeout
+	}
+	return timeout
+}
+
+// limit 返回目的地址的在途查询信号量
+func (e *Engine) limit(dest string) chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	limit, ok := e.limits[dest]
+	if !ok {
+		limit = make(chan struct{}, e.Config.MaxPerDestination)
+		e.limits[dest] = limit
+	}
+	return limit
+}
+
+// register 为查询分配一个在该目的地址的在途查询中不重复的事务 ID 并登记该查询。
+// 在途查询数量受 MaxPerDestination 限制，远小于 ID 空间，故总能找到可用的 ID。
+func (e *Engine) register(dest string, p *pendingQuery) uint16 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for {
+		key := pendingKey{dest, randomID()}
+		if _, ok := e.pending[key]; ok {
+			continue
+		}
+		delete(e.recent, key)
+		e.pending[key] = p
+		return key.id
+	}
+}
+
+// unregister 注销查询，并记录其完成时间，以便识别此后迟到的重复回复
+func (e *Engine) unregister(dest string, id uint16) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := pendingKey{dest, id}
+	delete(e.pending, key)
+	now := time.Now()
+	e.recent[key] = now
+	// 超过最大重传等待时间的迟到回复不再视为重复回复
+	for k, t := range e.recent {
+		if now.Sub(t) > e.Config.MaxTimeout {
+			delete(e.recent, k)
+		}
+	}
+}
+
+// receive 持续接收回复，将其交给对应的在途查询，直至套接字被关闭。
+// 读取发生临时错误时退避后重试，发生其他错误时关闭引擎，使在途查询立即返回。
+func (e *Engine) receive() {
+	buffer := make([]byte, 65535)
+	delay := time.Duration(0)
+	for {
+		n, from, err := e.conn.ReadFrom(buffer)
+		if err != nil {
+			select {
+			case <-e.closed:
+				return
+			default:
+			}
+			if !isTemporary(err) {
+				e.EngineLogger.Printf("Error reading udp packet, closing engine: %v", err)
+				e.Close()
+				return
+			}
+			delay = readBackoff(delay)
+			e.EngineLogger.Printf("Error reading udp packet, retrying in %v: %v", delay, err)
+			select {
+			case <-time.After(delay):
+			case <-e.closed:
+				return
+			}
+			continue
+		}
+		delay = 0
+		// 解析结果可能引用数据包的内存，故解析其副本，使接收缓冲区可以复用
+		data := append([]byte{}, buffer[:n]...)
+		resp := dns.DNSMessage{}
+		if _, err := resp.DecodeFromBuffer(data, 0); err != nil || !resp.Header.QR {
+			e.mu.Lock()
+			e.stats.Malformed++
+			e.mu.Unlock()
+			continue
+		}
+		e.deliver(pendingKey{from.String(), resp.Header.ID}, resp)
+	}
+}
+
+// readBackoff 返回读取错误后的下一次退避时间：自 5 毫秒起加倍，不超过 1 秒
+func readBackoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	if delay *= 2; delay > time.Second {
+		delay = time.Second
+	}
+	return delay
+}
+
+// isTemporary 判断读取错误是否为临时错误，如被信号中断或超时
+func isTemporary(err error) bool {
+	var temporary interface{ Temporary() bool }
+	var timeout interface{ Timeout() bool }
+	return (errors.As(err, &temporary) && temporary.Temporary()) || (errors.As(err, &timeout) && timeout.Timeout())
+}
+
+// deliver 将回复交给对应的在途查询，并统计重复、意外及问题不符的回复
+func (e *Engine) deliver(key pendingKey, resp dns.DNSMessage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.pending[key]
+	switch {
+	case !ok:
+		if _, recent := e.recent[key]; recent {
+			e.stats.Duplicates++
+		} else {
+			e.stats.Unexpected++
+		}
+	case p.answered:
+		e.stats.Duplicates++
+	case !sameQuestion(p.question, resp.Question):
+		e.stats.Mismatched++
+	default:
+		p.answered = true
+		e.stats.Answered++
+		p.resp <- resp
+	}
+}
+
+// sameQuestion 检查回复的问题是否与查询一致，名称比较不区分大小写
+func sameQuestion(a, b dns.DNSQuestionSection) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Class != b[i].Class ||
+			!strings.EqualFold(strings.TrimSuffix(a[i].Name.DomainName, "."), strings.TrimSuffix(b[i].Name.DomainName, ".")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,399 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// engine_test.go 文件用于对出站查询引擎进行测试。
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// fakeServer 回环地址上的 UDP 服务器，以 handle 处理收到的每个查询
+type fakeServer struct {
+	conn net.PacketConn
+
+	mu       sync.Mutex
+	received []dns.DNSMessage
+	from     []net.Addr
+}
+
+// newFakeServer 创建并启动一个回环地址上的 UDP 服务器，测试结束时关闭之。
+// handle 的参数 n 为收到的查询数量（含本次），为 nil 时不回复任何查询。
+func newFakeServer(t *testing.T, handle func(s *fakeServer, n int, qry dns.DNSMessage, from net.Addr)) *fakeServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("function ListenPacket() failed:\n%v", err)
+	}
+	s := &fakeServer{conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buffer := make([]byte, 65535)
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			qry := dns.DNSMessage{}
+			if _, err := qry.DecodeFromBuffer(append([]byte{}, buffer[:n]...), 0); err != nil {
+				continue
+			}
+			s.mu.Lock()
+			s.received = append(s.received, qry)
+			s.from = append(s.from, from)
+			count := len(s.received)
+			s.mu.Unlock()
+			if handle != nil {
+				handle(s, count, qry, from)
+			}
+		}
+	}()
+	return s
+}
+
+// Addr 返回服务器的地址
+func (s *fakeServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Received 返回服务器收到的查询数量
+func (s *fakeServer) Received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.received)
+}
+
+// reply 回复第 i 个收到的查询，mutate 不为 nil 时在编码前修改回复
+func (s *fakeServer) reply(i int, mutate func(resp *dns.DNSMessage)) {
+	s.mu.Lock()
+	qry, from := s.received[i], s.from[i]
+	s.mu.Unlock()
+	s.conn.WriteTo(testResponse(qry, mutate), from)
+}
+
+// testResponse 构造查询的回复，mutate 不为 nil 时在编码前修改回复
+func testResponse(qry dns.DNSMessage, mutate func(resp *dns.DNSMessage)) []byte {
+	resp := qry
+	resp.Header.QR = true
+	resp.Answer = dns.DNSResponseSection{{
+		Name:  qry.Question[0].Name,
+		Type:  dns.DNSRRTypeA,
+		Class: dns.DNSClassIN,
+		TTL:   300,
+		RData: &dns.DNSRDATAA{Address: net.IPv4(10, 0, 0, 1)},
+	}}
+	resp.Header.ANCount = 1
+	if mutate != nil {
+		mutate(&resp)
+	}
+	return resp.Encode()
+}
+
+// newTestQuery 构造测试使用的查询，其事务 ID 为 0x1234
+func newTestQuery(qName string) dns.DNSMessage {
+	return dns.DNSMessage{
+		Header: dns.DNSHeader{ID: 0x1234, RD: true, QDCount: 1},
+		Question: dns.DNSQuestionSection{
+			{Name: *dns.NewDNSName(qName), Type: dns.DNSRRTypeA, Class: dns.DNSClassIN},
+		},
+	}
+}
+
+// newTestEngine 创建监听回环地址的引擎，测试结束时关闭之
+func newTestEngine(t *testing.T, conf EngineConfig) *Engine {
+	conf.LocalAddr = "127.0.0.1:0"
+	e, err := NewEngine(conf)
+	if err != nil {
+		t.Fatalf("function NewEngine() failed:\n%v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// waitFor 等待 cond 成立，超过 2 秒时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 测试 Engine 的 Exchange 方法在首个查询丢失时重传，并统计重复回复
+func TestEngineExchangeRetransmit(t *testing.T) {
+	// 丢弃首个查询，此后每个查询回复两次
+	server := newFakeServer(t, func(s *fakeServer, n int, qry dns.DNSMessage, from net.Addr) {
+		if n == 1 {
+			return
+		}
+		s.reply(n-1, nil)
+		s.reply(n-1, nil)
+	})
+	e := newTestEngine(t, EngineConfig{InitialTimeout: 50 * time.Millisecond})
+
+	resp, err := e.Exchange(context.Background(), server.Addr(), newTestQuery("www.test"))
+	if err != nil {
+		t.Fatalf("method Engine Exchange() failed:\n%v", err)
+	}
+	// 回复的 ID 被恢复为查询原有的 ID
+	if resp.Header.ID != 0x1234 || len(resp.Answer) != 1 {
+		t.Errorf("method Engine Exchange() failed:\ngot: ID 0x%04x with %d answers\nexpected: ID 0x1234 with 1 answer", resp.Header.ID, len(resp.Answer))
+	}
+	// 重传的查询使用相同的事务 ID
+	server.mu.Lock()
+	if len(server.received) != 2 || server.received[0].Header.ID != server.received[1].Header.ID {
+		t.Errorf("method Engine Exchange() failed: retransmission changed the transaction ID: %d queries", len(server.received))
+	}
+	server.mu.Unlock()
+
+	waitFor(t, "the duplicate response", func() bool { return e.Stats().Duplicates == 1 })
+	expected := EngineStats{Sent: 2, Retransmitted: 1, Answered: 1, Duplicates: 1}
+	if stats := e.Stats(); stats != expected {
+		t.Errorf("method Engine Stats() failed:\ngot: %+v\nexpected: %+v", stats, expected)
+	}
+}
+
+// 测试 Engine 统计来源或 ID 不符、问题不符及无法解析的回复
+func TestEngineExchangeUnexpected(t *testing.T) {
+	other, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("function ListenPacket() failed:\n%v", err)
+	}
+	defer other.Close()
+
+	server := newFakeServer(t, func(s *fakeServer, n int, qry dns.DNSMessage, from net.Addr) {
+		// ID 不符
+		s.reply(n-1, func(resp *dns.DNSMessage) { resp.Header.ID++ })
+		// 问题不符
+		s.reply(n-1, func(resp *dns.DNSMessage) { resp.Question[0].Name = *dns.NewDNSName("evil.test") })
+		// 来源不符
+		other.WriteTo(testResponse(qry, nil), from)
+		// 无法解析及不是回复的数据包
+		s.conn.WriteTo([]byte{0x00}, from)
+		s.conn.WriteTo(qry.Encode(), from)
+		// 名称大小写不同的正确回复
+		s.reply(n-1, func(resp *dns.DNSMessage) { resp.Question[0].Name = *dns.NewDNSName("WWW.Test") })
+	})
+	e := newTestEngine(t, EngineConfig{InitialTimeout: time.Second, Attempts: 1})
+
+	resp, err := e.Exchange(context.Background(), server.Addr(), newTestQuery("www.test"))
+	if err != nil {
+		t.Fatalf("method Engine Exchange() failed:\n%v", err)
+	}
+	if resp.Question[0].Name.DomainName != "WWW.Test" {
+		t.Errorf("method Engine Exchange() failed: accepted response for %s", resp.Question[0].Name.DomainName)
+	}
+	expected := EngineStats{Sent: 1, Answered: 1, Unexpected: 2, Mismatched: 1, Malformed: 2}
+	if stats := e.Stats(); stats != expected {
+		t.Errorf("method Engine Stats() failed:\ngot: %+v\nexpected: %+v", stats, expected)
+	}
+}
+
+// 测试 Engine 的 register 方法按目的地址分配不重复的事务 ID
+func TestEngineRegister(t *testing.T) {
+	e := &Engine{
+		Config:  EngineConfig{MaxTimeout: time.Second},
+		pending: map[pendingKey]*pendingQuery{},
+		recent:  map[pendingKey]time.Time{},
+	}
+	// 占用 "a" 上除 0x4242 外的全部 ID
+	for id := 0; id <= 0xffff; id++ {
+		if id != 0x4242 {
+			e.pending[pendingKey{"a", uint16(id)}] = &pendingQuery{}
+		}
+	}
+	e.recent[pendingKey{"a", 0x4242}] = time.Now()
+	if id := e.register("a", &pendingQuery{}); id != 0x4242 {
+		t.Errorf("method Engine register() failed:\ngot: 0x%04x\nexpected: 0x4242", id)
+	}
+	// 重新分配的 ID 不再被视为已完成的查询
+	if _, ok := e.recent[pendingKey{"a", 0x4242}]; ok {
+		t.Errorf("method Engine register() failed: reused ID still recorded as recent")
+	}
+	// 其他目的地址的 ID 空间相互独立
+	id := e.register("b", &pendingQuery{})
+	if _, ok := e.pending[pendingKey{"b", id}]; !ok || len(e.pending) != 0x10001 {
+		t.Errorf("method Engine register() failed: query to another destination not registered")
+	}
+
+	// 注销后迟到的回复计为重复回复，不会送达
+	e.unregister("b", id)
+	e.deliver(pendingKey{"b", id}, dns.DNSMessage{})
+	e.deliver(pendingKey{"c", id}, dns.DNSMessage{})
+	if e.stats.Duplicates != 1 || e.stats.Unexpected != 1 {
+		t.Errorf("method Engine deliver() failed:\ngot: %+v\nexpected 1 duplicate and 1 unexpected response", e.stats)
+	}
+}
+
+// 测试 Engine 的重传等待时间以指数增长，且不超过 MaxTimeout
+func TestEngineBackoff(t *testing.T) {
+	e := &Engine{Config: EngineConfig{MaxTimeout: 120 * time.Millisecond}}
+	timeout := 50 * time.Millisecond
+	for _, expected := range []time.Duration{100, 120, 120} {
+		if timeout = e.nextTimeout(timeout); timeout != expected*time.Millisecond {
+			t.Errorf("method Engine nextTimeout() failed:\ngot: %v\nexpected: %v", timeout, expected*time.Millisecond)
+		}
+	}
+
+	// 等待时间依次为 20、40、40、40、40、40 毫秒，共 220 毫秒，不设上限时将为 1260 毫秒
+	server := newFakeServer(t, nil)
+	e = newTestEngine(t, EngineConfig{InitialTimeout: 20 * time.Millisecond, MaxTimeout: 40 * time.Millisecond, Attempts: 6})
+	start := time.Now()
+	_, err := e.Exchange(context.Background(), server.Addr(), newTestQuery("www.test"))
+	elapsed := time.Since(start)
+	if err == nil || !strings.Contains(err.Error(), "after 6 attempts") {
+		t.Errorf("method Engine Exchange() failed:\ngot: %v\nexpected an error after 6 attempts", err)
+	}
+	if elapsed < 220*time.Millisecond || elapsed > time.Second {
+		t.Errorf("method Engine Exchange() failed: gave up after %v, expected about 220ms", elapsed)
+	}
+	waitFor(t, "all retransmissions", func() bool { return server.Received() == 6 })
+	expected := EngineStats{Sent: 6, Retransmitted: 5, TimedOut: 1}
+	if stats := e.Stats(); stats != expected {
+		t.Errorf("method Engine Stats() failed:\ngot: %+v\nexpected: %+v", stats, expected)
+	}
+}
+
+// 测试 Engine 限制每个目的地址的在途查询数量
+func TestEngineMaxPerDestination(t *testing.T) {
+	server := newFakeServer(t, nil)
+	e := newTestEngine(t, EngineConfig{InitialTimeout: 5 * time.Second, Attempts: 1, MaxPerDestination: 2})
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := e.Exchange(context.Background(), server.Addr(), newTestQuery("www.test"))
+			errs <- err
+		}()
+	}
+	waitFor(t, "two queries", func() bool { return server.Received() == 2 })
+	// 第三个查询等待在途查询完成
+	time.Sleep(100 * time.Millisecond)
+	if n := server.Received(); n != 2 {
+		t.Fatalf("method Engine Exchange() failed: %d queries in flight, expected 2", n)
+	}
+
+	server.reply(0, nil)
+	if err := <-errs; err != nil {
+		t.Errorf("method Engine Exchange() failed:\n%v", err)
+	}
+	waitFor(t, "the third query", func() bool { return server.Received() == 3 })
+	server.reply(1, nil)
+	server.reply(2, nil)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("method Engine Exchange() failed:\n%v", err)
+		}
+	}
+}
+
+// 测试 Engine 的 Close 方法使在途及等待中的查询立即返回
+func TestEngineClose(t *testing.T) {
+	server := newFakeServer(t, nil)
+	e := newTestEngine(t, EngineConfig{InitialTimeout: 10 * time.Second, Attempts: 1, MaxPerDestination: 1})
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := e.Exchange(context.Background(), server.Addr(), newTestQuery("www.test"))
+			errs <- err
+		}()
+	}
+	waitFor(t, "the first query", func() bool { return server.Received() == 1 })
+	e.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if err == nil || !strings.Contains(err.Error(), "engine closed") {
+				t.Errorf("method Engine Exchange() failed:\ngot: %v\nexpected: engine closed", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("method Engine Close() failed: Exchange still blocked")
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("method Engine Close() failed: second Close returned %v", err)
+	}
+}
+
+// tempError 为临时的读取错误
+type tempError struct{}
+
+func (tempError) Error() string   { return "temporary failure" }
+func (tempError) Temporary() bool { return true }
+func (tempError) Timeout() bool   { return false }
+
+// errorConn 依次返回 errs 中错误的数据包链接
+type errorConn struct {
+	net.PacketConn
+	mu   sync.Mutex
+	errs []error
+}
+
+func (c *errorConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.errs[0]
+	if len(c.errs) > 1 {
+		c.errs = c.errs[1:]
+	}
+	return 0, nil, err
+}
+
+func (c *errorConn) Close() error {
+	return nil
+}
+
+// 测试 Engine 的 receive 方法在临时错误后退避重试，在其他错误后关闭引擎
+func TestEngineReceiveErrors(t *testing.T) {
+	delay := time.Duration(0)
+	for _, expected := range []time.Duration{5, 10, 20} {
+		if delay = readBackoff(delay); delay != expected*time.Millisecond {
+			t.Errorf("function readBackoff() failed:\ngot: %v\nexpected: %v", delay, expected*time.Millisecond)
+		}
+	}
+	if delay := readBackoff(800 * time.Millisecond); delay != time.Second {
+		t.Errorf("function readBackoff() failed:\ngot: %v\nexpected: 1s", delay)
+	}
+
+	logs := &syncBuffer{}
+	conn := &errorConn{errs: []error{tempError{}, tempError{}, errors.New("socket broken")}}
+	e := newEngine(EngineConfig{LogWriter: logs}, conn)
+	select {
+	case <-e.closed:
+	case <-time.After(time.Second):
+		t.Fatalf("method Engine receive() failed: engine not closed after a permanent read error")
+	}
+	if got := logs.String(); strings.Count(got, "retrying") != 2 || !strings.Contains(got, "closing engine: socket broken") {
+		t.Errorf("method Engine receive() failed: unexpected log:\n%s", got)
+	}
+}
+
+// syncBuffer 为可并发写入的缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
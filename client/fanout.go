@@ -0,0 +1,285 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// fanout.go 文件定义了查询扇出协调器 Fanout。
+// 其将同一组探测查询分别经由多个解析器（如实验网络中的 Unbound、BIND、Knot 实例）发送，
+// 收集各解析器的回复码、回答、标志位及时延，生成解析器间的对比矩阵，
+// 以取代手工维护的跨实现对比表格。矩阵可输出为 Markdown 表格，亦可直接编码为 JSON。
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// FanoutResolver 表示参与对比的一个解析器
+type FanoutResolver struct {
+	// 解析器名称，如 "unbound-1.19"，为空时使用地址
+	Name string `json:"name"`
+	// 解析器地址，形如 "10.10.1.5:53"，省略端口时为 53
+	Address string `json:"address"`
+}
+
+// FanoutProbe 表示一个探测查询
+type FanoutProbe struct {
+	Name string      `json:"name"`
+	Type dns.DNSType `json:"type"`
+}
+
+func (p FanoutProbe) String() string {
+	return p.Name + " " + p.Type.String()
+}
+
+// FanoutConfig 记录查询扇出协调器的配置
+type FanoutConfig struct {
+	// 参与对比的解析器
+	Resolvers []FanoutResolver
+	// 查询参数，其中的 Server 被忽略
+	Client ClientConfig
+	// 为 true 时不设置 RD 标志，用于直接对比多个权威服务器
+	NoRecursion bool
+}
+
+// FanoutResult 记录一个解析器对一个探测查询的回复
+type FanoutResult struct {
+	// 解析器名称
+	Resolver string `json:"resolver"`
+	// 回复码的助记符，如 "NOERROR"，未收到回复时为空
+	RCode string `json:"rcode,omitempty"`
+	// AD 及 TC 标志
+	AD bool `json:"ad"`
+	TC bool `json:"tc"`
+	// Answer 部分中除 RRSIG 外的记录，形如 "www.test. A 10.10.1.4"，已排序
+	Answers []string `json:"answers"`
+	// Answer 部分中 RRSIG 记录的数量
+	Signatures int `json:"signatures"`
+	// 查询时延
+	Latency time.Duration `json:"latency"`
+	// 未收到回复时的错误信息
+	Error string `json:"error,omitempty"`
+}
+
+// outcome 返回用于比较回复是否一致的摘要：回复码及回答，不含 TTL 及时延
+func (r FanoutResult) outcome() string {
+	if r.Error != "" {
+		return "error"
+	}
+	return r.RCode + "|" + strings.Join(r.Answers, "|")
+}
+
+// FanoutRow 记录一个探测查询在全部解析器上的结果
+type FanoutRow struct {
+	Probe FanoutProbe `json:"probe"`
+	// 按 FanoutConfig.Resolvers 的顺序排列的结果
+	Results []FanoutResult `json:"results"`
+	// 全部解析器均收到回复，且回复码及回答一致
+	Agree bool `json:"agree"`
+}
+
+// FanoutMatrix 对比矩阵，每行为一个探测查询，每列为一个解析器
+type FanoutMatrix struct {
+	Resolvers []string    `json:"resolvers"`
+	Rows      []FanoutRow `json:"rows"`
+}
+
+// Disagreements 返回解析器结果不一致的行
+func (m *FanoutMatrix) Disagreements() []FanoutRow {
+	rows := []FanoutRow{}
+	for _, row := range m.Rows {
+		if !row.Agree {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// Markdown 将对比矩阵输出为 Markdown 表格，
+// 单元格形如 "NOERROR 2 RR AD 3ms"，未收到回复时为 "no response"。
+func (m *FanoutMatrix) Markdown() string {
+	sb := strings.Builder{}
+	sb.WriteString("| probe | " + strings.Join(m.Resolvers, " | ") + " | agree |\n")
+	sb.WriteString("|---|" + strings.Repeat("---|", len(m.Resolvers)) + "---|\n")
+	for _, row := range m.Rows {
+		cells := []string{row.Probe.String()}
+		for _, r := range row.Results {
+			cells = append(cells, fanoutCell(r))
+		}
+		agree := "no"
+		if row.Agree {
+			agree = "yes"
+		}
+		cells = append(cells, agree)
+		sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return sb.String()
+}
+
+// fanoutCell 返回结果在表格中的简要表示
+func fanoutCell(r FanoutResult) string {
+	if r.Error != "" {
+		return "no response"
+	}
+	parts := []string{r.RCode, fmt.Sprintf("%d RR", len(r.Answers))}
+	if r.Signatures > 0 {
+		parts = append(parts, fmt.Sprintf("%d RRSIG", r.Signatures))
+	}
+	if r.AD {
+		parts = append(parts, "AD")
+	}
+	if r.TC {
+		parts = append(parts, "TC")
+	}
+	parts = append(parts, r.Latency.Round(time.Millisecond).String())
+	return strings.Join(parts, " ")
+}
+
+// Fanout 查询扇出协调器
+type Fanout struct {
+	Config FanoutConfig
+
+	names   []string
+	clients []*Client
+}
+
+// NewFanout 根据配置创建一个新的查询扇出协调器
+func NewFanout(conf FanoutConfig) *Fanout {
+	f := &Fanout{Config: conf}
+	for _, r := range conf.Resolvers {
+		addr := r.Address
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		name := r.Name
+		if name == "" {
+			name = r.Address
+		}
+		cConf := conf.Client
+		cConf.Server = addr
+		f.names = append(f.names, name)
+		f.clients = append(f.clients, NewClient(cConf))
+	}
+	return f
+}
+
+// Probe 将一个探测查询同时发往全部解析器，并等待全部结果
+// 其接受参数为：
+//   - qName string，查询名称
+//   - qType dns.DNSType，查询类型
+//
+// 返回值为：
+//   - FanoutRow，该探测查询在全部解析器上的结果
+func (f *Fanout) Probe(qName string, qType dns.DNSType) FanoutRow {
+	row := FanoutRow{
+		Probe:   FanoutProbe{Name: qName, Type: qType},
+		Results: make([]FanoutResult, len(f.clients)),
+	}
+	wg := sync.WaitGroup{}
+	for i, c := range f.clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			row.Results[i] = f.exchange(f.names[i], c, qName, qType)
+		}(i, c)
+	}
+	wg.Wait()
+
+	row.Agree = len(row.Results) > 0
+	for _, r := range row.Results {
+		if r.Error != "" || r.outcome() != row.Results[0].outcome() {
+			row.Agree = false
+		}
+	}
+	return row
+}
+
+// exchange 向一个解析器发送查询并记录其结果
+func (f *Fanout) exchange(name string, c *Client, qName string, qType dns.DNSType) FanoutResult {
+	qry := c.NewQuery(qName, qType)
+	qry.Header.RD = !f.Config.NoRecursion
+
+	start := time.Now()
+	resp, err := c.Exchange(qry)
+	result := FanoutResult{Resolver: name, Latency: time.Since(start), Answers: []string{}}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.RCode = rCodeMnemonic(resp.Header.RCode)
+	result.AD, result.TC = resp.Header.Z&0x02 != 0, resp.Header.TC
+	for _, rr := range resp.Answer {
+		if rr.Type == dns.DNSRRTypeRRSIG {
+			result.Signatures++
+			continue
+		}
+		result.Answers = append(result.Answers, answerText(rr))
+	}
+	sort.Strings(result.Answers)
+	return result
+}
+
+// Run 依次发送全部探测查询，生成对比矩阵
+// 其接受参数为：
+//   - ctx context.Context，上下文，结束时不再发送后续的探测查询
+//   - probes []FanoutProbe，探测查询
+//
+// 返回值为：
+//   - *FanoutMatrix，对比矩阵，上下文结束时仅包含已完成的探测查询
+//   - error，未配置解析器或上下文结束时返回错误
+func (f *Fanout) Run(ctx context.Context, probes []FanoutProbe) (*FanoutMatrix, error) {
+	if len(f.clients) == 0 {
+		return nil, fmt.Errorf("method Fanout Run failed: no resolvers")
+	}
+	m := &FanoutMatrix{Resolvers: append([]string{}, f.names...), Rows: []FanoutRow{}}
+	for _, p := range probes {
+		if err := ctx.Err(); err != nil {
+			return m, fmt.Errorf("method Fanout Run failed: %v", err)
+		}
+		m.Rows = append(m.Rows, f.Probe(p.Name, p.Type))
+	}
+	return m, nil
+}
+
+// rCodeMnemonic 返回回复码的助记符
+func rCodeMnemonic(rCode dns.DNSResponseCode) string {
+	switch rCode {
+	case dns.DNSResponseCodeNoErr:
+		return "NOERROR"
+	case dns.DNSResponseCodeFormErr:
+		return "FORMERR"
+	case dns.DNSResponseCodeServFail:
+		return "SERVFAIL"
+	case dns.DNSResponseCodeNXDomain:
+		return "NXDOMAIN"
+	case dns.DNSResponseCodeNotImp:
+		return "NOTIMP"
+	case dns.DNSResponseCodeRefused:
+		return "REFUSED"
+	}
+	return fmt.Sprintf("RCODE%d", rCode)
+}
+
+// answerText 返回回答记录的文本表示，不含 TTL，以便比较不同解析器的缓存结果。
+// 常见类型的记录数据以其文本格式表示，其余类型使用 RFC 3597 的通用格式。
+func answerText(rr dns.DNSResourceRecord) string {
+	data := ""
+	switch rdata := rr.RData.(type) {
+	case *dns.DNSRDATAA:
+		data = rdata.Address.String()
+	case *dns.DNSRDATAAAAA:
+		data = rdata.Address.String()
+	case *dns.DNSRDATACNAME:
+		data = rdata.CNAME
+	case *dns.DNSRDATANS:
+		data = rdata.NSDNAME
+	default:
+		data = dns.FormatRDATAGeneric(rr.RData)
+	}
+	return fmt.Sprintf("%s %s %s", strings.ToLower(rr.Name.DomainName), rr.Type, data)
+}
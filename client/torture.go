@@ -0,0 +1,297 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// torture.go 文件定义了 WaterTorture 随机子域查询生成器。
+// 其以可配置的速率向服务器发送目标区域下随机标签的查询（Water Torture / 随机子域攻击），
+// 随机标签的熵可配置，并按秒统计发送及回复情况，
+// 既可用于测试 xdns 自身，也可用于测试实验网络中的第三方解析器。
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// DefaultTortureAlphabet 为随机标签默认使用的字符集
+const DefaultTortureAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// WaterTortureConfig 记录随机子域查询生成器的配置
+type WaterTortureConfig struct {
+	// 查询所发往的服务器及客户端参数
+	Client ClientConfig
+	// 目标区域，查询名称形如 "<随机标签>.<目标区域>"
+	Zone string
+	// 查询类型，0 表示 A
+	Type dns.DNSType
+	// 是否设置 RD 标志，向递归解析器发送查询时应设置
+	Recursion bool
+
+	// 每秒发送的查询数量
+	Rate int
+	// 持续时长，0 表示直至上下文结束
+	Duration time.Duration
+	// 并发发送查询的数量，0 表示 16
+	Workers int
+
+	// 随机标签的长度，0 表示 12
+	LabelLength int
+	// 随机标签的字符集，为空时为 DefaultTortureAlphabet
+	Alphabet string
+	// 不同随机标签的数量，0 表示不限制，即每个查询均使用新的标签；
+	// 限制数量可降低熵，使部分查询命中解析器的缓存
+	Pool int
+	// 随机数种子，0 表示使用当前时间，设置了 Intn 时被忽略
+	Seed int64
+	// 随机数来源，如 xperi.RandomIntn，使标签与种子设置的共享随机源一同复现；为 nil 时使用 Seed
+	Intn func(n int) int
+
+	// 每秒统计完成时的回调，可为 nil
+	OnSecond func(TortureSecond)
+}
+
+// TortureSecond 表示一秒内的查询统计，回复按收到回复的时刻计入
+type TortureSecond struct {
+	// 该秒的起始时间
+	Time time.Time `json:"time"`
+	// 已发送的查询数量
+	Sent uint64 `json:"sent"`
+	// 因全部并发均忙碌而未能发送的查询数量
+	Skipped uint64 `json:"skipped"`
+	// 按回复码统计的回复数量
+	NoError  uint64 `json:"noerror"`
+	NXDomain uint64 `json:"nxdomain"`
+	ServFail uint64 `json:"servfail"`
+	Refused  uint64 `json:"refused"`
+	Other    uint64 `json:"other"`
+	// 未收到回复（超时或网络错误）的查询数量
+	Unanswered uint64 `json:"unanswered"`
+	// 收到回复的查询的平均时延
+	MeanLatency time.Duration `json:"mean_latency"`
+
+	latencySum uint64
+}
+
+// Answered 返回该秒内收到回复的查询数量
+func (s TortureSecond) Answered() uint64 {
+	return s.NoError + s.NXDomain + s.ServFail + s.Refused + s.Other
+}
+
+// WaterTorture 随机子域查询生成器
+type WaterTorture struct {
+	Config WaterTortureConfig
+
+	client *Client
+	intn   func(n int) int
+	pool   []string
+
+	mu      sync.Mutex
+	current *TortureSecond
+	seconds []TortureSecond
+}
+
+// NewWaterTorture 根据配置创建一个新的随机子域查询生成器
+func NewWaterTorture(conf WaterTortureConfig) *WaterTorture {
+	if conf.Type == 0 {
+		conf.Type = dns.DNSRRTypeA
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = 16
+	}
+	if conf.LabelLength <= 0 {
+		conf.LabelLength = 12
+	}
+	if conf.Alphabet == "" {
+		conf.Alphabet = DefaultTortureAlphabet
+	}
+	intn := conf.Intn
+	if intn == nil {
+		seed := conf.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		intn = rand.New(rand.NewSource(seed)).Intn
+	}
+	conf.Zone = strings.TrimSuffix(conf.Zone, ".")
+	return &WaterTorture{
+		Config: conf,
+		client: NewClient(conf.Client),
+		intn:   intn,
+	}
+}
+
+// EntropyBits 返回查询名称中随机部分的熵，单位为比特
+func (w *WaterTorture) EntropyBits() float64 {
+	bits := float64(w.Config.LabelLength) * math.Log2(float64(len(w.Config.Alphabet)))
+	if w.Config.Pool > 0 {
+		bits = math.Min(bits, math.Log2(float64(w.Config.Pool)))
+	}
+	return bits
+}
+
+// randomLabel 生成一个随机标签
+func (w *WaterTorture) randomLabel() string {
+	label := make([]byte, w.Config.LabelLength)
+	for i := range label {
+		label[i] = w.Config.Alphabet[w.intn(len(w.Config.Alphabet))]
+	}
+	return string(label)
+}
+
+// NextName 返回下一个查询名称，非并发安全，仅由 Run 的调度协程调用
+func (w *WaterTorture) NextName() string {
+	if w.Config.Pool <= 0 {
+		return w.randomLabel() + "." + w.Config.Zone
+	}
+	if len(w.pool) < w.Config.Pool {
+		w.pool = append(w.pool, w.randomLabel()+"."+w.Config.Zone)
+		return w.pool[len(w.pool)-1]
+	}
+	return w.pool[w.intn(len(w.pool))]
+}
+
+// Run 按配置的速率发送查询，直至持续时长结束或上下文结束
+// 其接受参数为：
+//   - ctx context.Context，上下文，结束时停止发送并等待已发送的查询完成
+//
+// 返回值为：
+//   - []TortureSecond，按秒统计的结果
+//   - error，配置无效时返回错误
+func (w *WaterTorture) Run(ctx context.Context) ([]TortureSecond, error) {
+	if w.Config.Rate <= 0 {
+		return nil, fmt.Errorf("method WaterTorture Run failed: invalid rate %d", w.Config.Rate)
+	}
+	if w.Config.Zone == "" {
+		return nil, fmt.Errorf("method WaterTorture Run failed: no target zone")
+	}
+	if w.Config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Config.Duration)
+		defer cancel()
+	}
+
+	names := make(chan string, w.Config.Workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < w.Config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				w.exchange(name)
+			}
+		}()
+	}
+
+	// 以 10 毫秒为间隔补发应当发送的查询，避免高速率下计时器精度不足
+	start := time.Now()
+	w.rotate(start)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	var scheduled int64
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case now := <-ticker.C:
+			if now.Sub(w.currentTime()) >= time.Second {
+				w.rotate(now)
+			}
+			due := int64(now.Sub(start).Seconds() * float64(w.Config.Rate))
+			for ; scheduled < due; scheduled++ {
+				select {
+				case names <- w.NextName():
+				default:
+					w.record(func(s *TortureSecond) { s.Skipped++ })
+				}
+			}
+		}
+	}
+	ticker.Stop()
+	close(names)
+	wg.Wait()
+	w.rotate(time.Time{})
+	return w.Seconds(), nil
+}
+
+// exchange 发送一个查询并记录其结果
+func (w *WaterTorture) exchange(name string) {
+	qry := w.client.NewQuery(name, w.Config.Type)
+	qry.Header.RD = w.Config.Recursion
+	w.record(func(s *TortureSecond) { s.Sent++ })
+
+	start := time.Now()
+	resp, err := w.client.Exchange(qry)
+	latency := time.Since(start)
+	w.record(func(s *TortureSecond) {
+		if err != nil {
+			s.Unanswered++
+			return
+		}
+		s.latencySum += uint64(latency)
+		switch resp.Header.RCode {
+		case dns.DNSResponseCodeNoErr:
+			s.NoError++
+		case dns.DNSResponseCodeNXDomain:
+			s.NXDomain++
+		case dns.DNSResponseCodeServFail:
+			s.ServFail++
+		case dns.DNSResponseCodeRefused:
+			s.Refused++
+		default:
+			s.Other++
+		}
+	})
+}
+
+// record 更新当前一秒的统计
+func (w *WaterTorture) record(update func(*TortureSecond)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current != nil {
+		update(w.current)
+	}
+}
+
+// currentTime 返回当前一秒的起始时间
+func (w *WaterTorture) currentTime() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current == nil {
+		return time.Time{}
+	}
+	return w.current.Time
+}
+
+// rotate 结束当前一秒的统计，并在 now 不为零值时开始新的一秒
+func (w *WaterTorture) rotate(now time.Time) {
+	w.mu.Lock()
+	finished := w.current
+	w.current = nil
+	if !now.IsZero() {
+		w.current = &TortureSecond{Time: now}
+	}
+	if finished != nil {
+		if answered := finished.Answered(); answered > 0 {
+			finished.MeanLatency = time.Duration(finished.latencySum / answered)
+		}
+		w.seconds = append(w.seconds, *finished)
+	}
+	w.mu.Unlock()
+
+	if finished != nil && w.Config.OnSecond != nil {
+		w.Config.OnSecond(*finished)
+	}
+}
+
+// Seconds 返回已完成的按秒统计结果
+func (w *WaterTorture) Seconds() []TortureSecond {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]TortureSecond{}, w.seconds...)
+}
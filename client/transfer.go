@@ -0,0 +1,120 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// transfer.go 文件定义了客户端的区域传送方法。
+// 区域传送（AXFR，RFC 5936；IXFR，RFC 1995）的回复可能由同一 TCP 链接上的多个消息组成，
+// Transfer 持续读取消息，直至收到标志传送结束的 SOA 记录。
+
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// AXFR 请求完整区域传送
+// 其接受参数为：
+//   - zone string，区域名称
+//
+// 返回值为：
+//   - []dns.DNSResourceRecord，区域传送的记录，以区域的 SOA 记录开头及结尾
+//   - error，错误信息
+func (c *Client) AXFR(zone string) ([]dns.DNSResourceRecord, error) {
+	qry := c.NewQuery(zone, dns.DNSQTypeAXFR)
+	return c.Transfer(qry)
+}
+
+// IXFR 请求增量区域传送，其权威部分携带客户端当前的 SOA 记录
+// 其接受参数为：
+//   - zone string，区域名称
+//   - soa dns.DNSResourceRecord，客户端当前的 SOA 记录
+//
+// 返回值为：
+//   - []dns.DNSResourceRecord，区域传送的记录，格式详见 RFC 1995 第 4 节，
+//     区域已是最新时仅包含服务器的 SOA 记录，服务器亦可能以完整区域传送的格式回复
+//   - error，错误信息
+func (c *Client) IXFR(zone string, soa dns.DNSResourceRecord) ([]dns.DNSResourceRecord, error) {
+	qry := c.NewQuery(zone, dns.DNSRRTypeIXFR)
+	qry.Authority = append(qry.Authority, soa)
+	qry.Header.NSCount = uint16(len(qry.Authority))
+	return c.Transfer(qry)
+}
+
+// Transfer 经由 TCP 发送区域传送查询，读取全部回复消息，返回其回答部分中的记录
+// 其接受参数为：
+//   - qry dns.DNSMessage，AXFR 或 IXFR 查询
+//
+// 返回值为：
+//   - []dns.DNSResourceRecord，区域传送的记录
+//   - error，任一回复消息的 RCODE 不为 NOERROR、格式错误或超时时返回错误
+func (c *Client) Transfer(qry dns.DNSMessage) ([]dns.DNSResourceRecord, error) {
+	conn, err := net.DialTimeout("tcp", c.Config.Server, c.Config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("method Client Transfer failed: dial %s failed.\n%v", c.Config.Server, err)
+	}
+	defer conn.Close()
+
+	packet := qry.Encode()
+	lenBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(lenBytes, uint16(len(packet)))
+	conn.SetDeadline(time.Now().Add(c.Config.Timeout))
+	buffers := net.Buffers{lenBytes, packet}
+	if _, err := buffers.WriteTo(conn); err != nil {
+		return nil, fmt.Errorf("method Client Transfer failed: write query failed.\n%v", err)
+	}
+
+	ixfr := len(qry.Question) > 0 && qry.Question[0].Type == dns.DNSRRTypeIXFR
+	rrs := []dns.DNSResourceRecord{}
+	for first := true; ; first = false {
+		// 每个回复消息均重新计算超时，使大区域的传送不受单次超时时间的限制
+		conn.SetDeadline(time.Now().Add(c.Config.Timeout))
+		if _, err := io.ReadFull(conn, lenBytes); err != nil {
+			return nil, fmt.Errorf("method Client Transfer failed: read length failed.\n%v", err)
+		}
+		data := make([]byte, binary.BigEndian.Uint16(lenBytes))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return nil, fmt.Errorf("method Client Transfer failed: read response failed.\n%v", err)
+		}
+		resp, err := decodeResponse(qry, data)
+		if err != nil {
+			return nil, fmt.Errorf("method Client Transfer failed: %v", err)
+		}
+		if resp.Header.RCode != dns.DNSResponseCodeNoErr {
+			return nil, fmt.Errorf("method Client Transfer failed: rcode %s", resp.Header.RCode)
+		}
+		rrs = append(rrs, resp.Answer...)
+
+		if len(rrs) == 0 || rrs[0].Type != dns.DNSRRTypeSOA {
+			return nil, fmt.Errorf("method Client Transfer failed: transfer does not start with SOA")
+		}
+		// 区域已是最新的 IXFR 回复仅包含一条 SOA 记录
+		if ixfr && first && len(rrs) == 1 {
+			return rrs, nil
+		}
+		if transferComplete(rrs, ixfr) {
+			return rrs, nil
+		}
+	}
+}
+
+// transferComplete 检查区域传送的记录是否已经完整。
+// 完整区域传送以 SOA 记录开头及结尾，其间不含 SOA 记录；
+// 增量区域传送中，新 SOA 记录出现在开头、最后一次变更的新增部分之首及结尾。
+func transferComplete(rrs []dns.DNSResourceRecord, ixfr bool) bool {
+	serial := rrs[0].RData.(*dns.DNSRDATASOA).Serial
+	incremental := ixfr && len(rrs) > 1 && rrs[1].Type == dns.DNSRRTypeSOA
+	count := 0
+	for _, rr := range rrs {
+		if soa, ok := rr.RData.(*dns.DNSRDATASOA); ok && soa.Serial == serial {
+			count++
+		}
+	}
+	if incremental {
+		return count >= 3
+	}
+	return count >= 2
+}
@@ -0,0 +1,277 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// clientconf.go 文件定义了客户端配置生成器。
+// 其根据 ServerConfig 生成将测试解析器及客户端接入实验服务器所需的配置片段，包括：
+//   - DNS Stamp（sdns://），支持普通 DNS、DoH 及 DoT 端点
+//   - resolv.conf 片段
+//   - unbound 的 forward-zone / stub-zone 配置
+//   - BIND 的 forward / stub 区域配置
+//
+// DNS Stamp 的格式详见 https://dnscrypt.info/stamps-specifications 。
+
+package xdns
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// DNS Stamp 的协议标识
+const (
+	stampProtoPlain byte = 0x00
+	stampProtoDoH   byte = 0x02
+	stampProtoDoT   byte = 0x03
+)
+
+// DNS Stamp 的属性位
+const (
+	// StampDNSSEC 表示服务器支持 DNSSEC
+	StampDNSSEC uint64 = 1 << 0
+	// StampNoLog 表示服务器不记录查询
+	StampNoLog uint64 = 1 << 1
+	// StampNoFilter 表示服务器不过滤回复
+	StampNoFilter uint64 = 1 << 2
+)
+
+// ClientConfConfig 记录客户端配置生成器的配置
+type ClientConfConfig struct {
+	// 实验服务器的配置，使用其中的 IP 及 Port
+	Server ServerConfig
+	// 需要转发至实验服务器的区域，为空时转发全部名称（根区域）
+	Zones []string
+	// 是否将实验服务器作为权威服务器（stub-zone），否则作为上游递归服务器（forward-zone）
+	Stub bool
+	// 实验服务器是否对回复签名，影响 Stamp 的属性及是否生成 domain-insecure
+	DNSSEC bool
+
+	// DoH 端点的 URL，如 "https://lab.example:8443/dns-query"，为空时不生成 DoH Stamp
+	DoHURL string
+	// DoT 端点地址，如 "192.0.2.1:853"，为空时不生成 DoT Stamp
+	DoTAddr string
+	// DoT 证书校验使用的主机名，为空时使用 DoTAddr 的主机部分
+	DoTHostname string
+	// 证书链中受信任证书的 SHA-256 摘要，为空时由客户端按常规方式校验证书
+	CertHashes [][]byte
+}
+
+// ClientConf 客户端配置生成器
+type ClientConf struct {
+	Config ClientConfConfig
+
+	doh *url.URL
+}
+
+// NewClientConf 根据配置创建一个新的客户端配置生成器
+// 其接受参数为：
+//   - conf ClientConfConfig，生成器配置
+//
+// 返回值为：
+//   - *ClientConf，客户端配置生成器
+//   - error，服务器地址未设置或端点格式错误时返回错误
+func NewClientConf(conf ClientConfConfig) (*ClientConf, error) {
+	if conf.Server.IP == nil || conf.Server.IP.IsUnspecified() {
+		return nil, fmt.Errorf("function NewClientConf failed: server IP is not set")
+	}
+	if conf.Server.Port == 0 {
+		conf.Server.Port = DefaultServerPort
+	}
+	if len(conf.Zones) == 0 {
+		conf.Zones = []string{"."}
+	}
+	c := &ClientConf{Config: conf}
+	if conf.DoHURL != "" {
+		doh, err := url.Parse(conf.DoHURL)
+		if err != nil || doh.Scheme != "https" || doh.Host == "" {
+			return nil, fmt.Errorf("function NewClientConf failed: invalid DoH URL %q", conf.DoHURL)
+		}
+		c.doh = doh
+	}
+	if conf.DoTAddr != "" {
+		if _, _, err := net.SplitHostPort(conf.DoTAddr); err != nil {
+			return nil, fmt.Errorf("function NewClientConf failed: invalid DoT address %q.\n%v", conf.DoTAddr, err)
+		}
+	}
+	return c, nil
+}
+
+// props 返回 Stamp 的属性字段
+func (c *ClientConf) props() []byte {
+	props := StampNoFilter
+	if c.Config.DNSSEC {
+		props |= StampDNSSEC
+	}
+	return binary.LittleEndian.AppendUint64(nil, props)
+}
+
+// stampAddr 返回 Stamp 中的地址，端口为默认值时省略端口
+func stampAddr(host string, port, defaultPort int) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port == defaultPort {
+		return host
+	}
+	return host + ":" + strconv.Itoa(port)
+}
+
+// appendLP 以长度前缀（LP）编码追加字符串
+func appendLP(dst []byte, s string) []byte {
+	return append(append(dst, byte(len(s))), s...)
+}
+
+// appendVLP 以可变长度前缀（VLP）编码追加一组字节串，除最后一项外长度字节的最高位均被置位
+func appendVLP(dst []byte, items [][]byte) []byte {
+	if len(items) == 0 {
+		return append(dst, 0)
+	}
+	for i, item := range items {
+		length := byte(len(item))
+		if i < len(items)-1 {
+			length |= 0x80
+		}
+		dst = append(append(dst, length), item...)
+	}
+	return dst
+}
+
+// encodeStamp 返回 Stamp 的文本形式
+func encodeStamp(stamp []byte) string {
+	return "sdns://" + base64.RawURLEncoding.EncodeToString(stamp)
+}
+
+// PlainStamp 返回实验服务器普通 DNS 端点的 Stamp
+func (c *ClientConf) PlainStamp() string {
+	stamp := append([]byte{stampProtoPlain}, c.props()...)
+	stamp = appendLP(stamp, stampAddr(c.Config.Server.IP.String(), c.Config.Server.Port, 53))
+	return encodeStamp(stamp)
+}
+
+// DoHStamp 返回 DoH 端点的 Stamp，未配置 DoHURL 时返回空字符串
+func (c *ClientConf) DoHStamp() string {
+	if c.doh == nil {
+		return ""
+	}
+	port := 443
+	if p := c.doh.Port(); p != "" {
+		port, _ = strconv.Atoi(p)
+	}
+	path := c.doh.EscapedPath()
+	if path == "" {
+		path = "/dns-query"
+	}
+	stamp := append([]byte{stampProtoDoH}, c.props()...)
+	stamp = appendLP(stamp, stampAddr(c.Config.Server.IP.String(), port, 443))
+	stamp = appendVLP(stamp, c.Config.CertHashes)
+	stamp = appendLP(stamp, stampAddr(c.doh.Hostname(), port, 443))
+	stamp = appendLP(stamp, path)
+	return encodeStamp(stamp)
+}
+
+// DoTStamp 返回 DoT 端点的 Stamp，未配置 DoTAddr 时返回空字符串
+func (c *ClientConf) DoTStamp() string {
+	if c.Config.DoTAddr == "" {
+		return ""
+	}
+	host, p, _ := net.SplitHostPort(c.Config.DoTAddr)
+	port, _ := strconv.Atoi(p)
+	hostname := c.Config.DoTHostname
+	if hostname == "" {
+		hostname = host
+	}
+	stamp := append([]byte{stampProtoDoT}, c.props()...)
+	stamp = appendLP(stamp, stampAddr(host, port, 853))
+	stamp = appendVLP(stamp, c.Config.CertHashes)
+	stamp = appendLP(stamp, stampAddr(hostname, port, 853))
+	return encodeStamp(stamp)
+}
+
+// zoneName 返回以 "." 结尾的区域名称
+func zoneName(zone string) string {
+	if zone == "" {
+		return "."
+	}
+	return fqdn(dns.CanonicalizeDomainName(&zone))
+}
+
+// ResolvConf 返回 resolv.conf 片段，resolv.conf 无法指定端口，端口不为 53 时将给出提示
+func (c *ClientConf) ResolvConf() string {
+	sb := strings.Builder{}
+	if c.Config.Server.Port != 53 {
+		fmt.Fprintf(&sb, "# resolv.conf cannot specify a port, the server listens on port %d\n", c.Config.Server.Port)
+	}
+	fmt.Fprintf(&sb, "nameserver %s\n", c.Config.Server.IP)
+	sb.WriteString("options edns0 trust-ad\n")
+	return sb.String()
+}
+
+// Unbound 返回 unbound 的 forward-zone 或 stub-zone 配置
+func (c *ClientConf) Unbound() string {
+	sb := strings.Builder{}
+	addr := fmt.Sprintf("%s@%d", c.Config.Server.IP, c.Config.Server.Port)
+	if !c.Config.DNSSEC {
+		sb.WriteString("server:\n")
+		for _, zone := range c.Config.Zones {
+			fmt.Fprintf(&sb, "    domain-insecure: \"%s\"\n", zoneName(zone))
+		}
+	}
+	for _, zone := range c.Config.Zones {
+		if c.Config.Stub {
+			fmt.Fprintf(&sb, "stub-zone:\n    name: \"%s\"\n    stub-addr: %s\n", zoneName(zone), addr)
+		} else {
+			fmt.Fprintf(&sb, "forward-zone:\n    name: \"%s\"\n    forward-addr: %s\n", zoneName(zone), addr)
+		}
+	}
+	return sb.String()
+}
+
+// BIND 返回 BIND 的 forward 或 stub 区域配置
+func (c *ClientConf) BIND() string {
+	sb := strings.Builder{}
+	addr := fmt.Sprintf("%s port %d", c.Config.Server.IP, c.Config.Server.Port)
+	for _, zone := range c.Config.Zones {
+		fmt.Fprintf(&sb, "zone \"%s\" {\n", zoneName(zone))
+		if c.Config.Stub {
+			fmt.Fprintf(&sb, "    type stub;\n    primaries { %s; };\n", addr)
+		} else {
+			fmt.Fprintf(&sb, "    type forward;\n    forward only;\n    forwarders { %s; };\n", addr)
+		}
+		sb.WriteString("};\n")
+	}
+	if !c.Config.DNSSEC {
+		sb.WriteString("# add to the options block:\n#   validate-except {")
+		for _, zone := range c.Config.Zones {
+			fmt.Fprintf(&sb, " \"%s\";", zoneName(zone))
+		}
+		sb.WriteString(" };\n")
+	}
+	return sb.String()
+}
+
+// WriteTo 将全部配置片段写入 w，各片段之前以注释行标明其用途
+func (c *ClientConf) WriteTo(w io.Writer) (int64, error) {
+	sb := strings.Builder{}
+	sb.WriteString("# DNS stamps\n")
+	for _, stamp := range []string{c.PlainStamp(), c.DoHStamp(), c.DoTStamp()} {
+		if stamp != "" {
+			sb.WriteString(stamp + "\n")
+		}
+	}
+	sections := []struct{ name, body string }{
+		{"resolv.conf", c.ResolvConf()},
+		{"unbound.conf", c.Unbound()},
+		{"named.conf", c.BIND()},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(&sb, "\n# %s\n%s", section.name, section.body)
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
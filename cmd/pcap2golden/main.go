@@ -0,0 +1,136 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// pcap2golden 从抓包文件中提取 DNS 消息，并将其转换为 dns 包的测试用例。
+// 默认输出为 golden 文件，即每个 DNS 消息一个原始报文文件，
+// 存放于 dns/testdata/pcap 目录下的文件会被 dns 包的测试逐一解码检查；
+// 指定 -format go 时则向标准输出打印 Go 源码形式的测试数据。
+//
+// 用法：
+//
+//	pcap2golden -in capture.pcap -out dns/testdata/pcap -prefix capture
+//	pcap2golden -in capture.pcap -failing -format go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/pcap"
+)
+
+func main() {
+	in := flag.String("in", "", "path to the pcap file")
+	out := flag.String("out", "dns/testdata/pcap", "directory of the golden files")
+	prefix := flag.String("prefix", "", "name prefix of the fixtures, defaults to the pcap file name")
+	format := flag.String("format", "golden", "output format: golden or go")
+	failing := flag.Bool("failing", false, "only keep messages that the dns package fails to decode")
+	ports := flag.String("ports", "53", "comma separated DNS ports")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "pcap2golden: ", 0)
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *prefix == "" {
+		*prefix = strings.TrimSuffix(filepath.Base(*in), filepath.Ext(*in))
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		logger.Fatalf("Error opening capture: %v", err)
+	}
+	defer f.Close()
+	reader, err := pcap.NewReader(f)
+	if err != nil {
+		logger.Fatalf("Error reading capture: %v", err)
+	}
+	for _, p := range strings.Split(*ports, ",") {
+		port, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+		if err != nil {
+			logger.Fatalf("Invalid port %q", p)
+		}
+		reader.Ports = append(reader.Ports, uint16(port))
+	}
+
+	fixtures := [][]byte{}
+	for {
+		packets, err := reader.Next()
+		if err != nil {
+			if err != io.EOF {
+				logger.Printf("Stopped at a broken record: %v", err)
+			}
+			break
+		}
+		for _, packet := range packets {
+			if *failing && decodes(packet.Payload) {
+				continue
+			}
+			fixtures = append(fixtures, packet.Payload)
+		}
+	}
+	logger.Printf("Extracted %d messages from %s.", len(fixtures), *in)
+
+	switch *format {
+	case "golden":
+		if err := os.MkdirAll(*out, 0755); err != nil {
+			logger.Fatalf("Error creating %s: %v", *out, err)
+		}
+		for i, fixture := range fixtures {
+			path := filepath.Join(*out, fmt.Sprintf("%s-%04d.bin", *prefix, i))
+			if err := os.WriteFile(path, fixture, 0644); err != nil {
+				logger.Fatalf("Error writing %s: %v", path, err)
+			}
+		}
+	case "go":
+		fmt.Print(goFixtures(*prefix, fixtures))
+	default:
+		logger.Fatalf("Unknown format %q", *format)
+	}
+}
+
+// decodes 判断 dns 包能否解码指定的消息
+func decodes(payload []byte) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	msg := dns.DNSMessage{}
+	_, err := msg.DecodeFromBuffer(payload, 0)
+	return err == nil
+}
+
+// goFixtures 将消息格式化为 Go 源码形式的测试数据
+func goFixtures(prefix string, fixtures [][]byte) string {
+	name := "pcapFixtures"
+	for _, part := range strings.FieldsFunc(prefix, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		name += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	src := strings.Builder{}
+	fmt.Fprintf(&src, "// %s 由 pcap2golden 自抓包中提取。\nvar %s = [][]byte{\n", name, name)
+	for _, fixture := range fixtures {
+		src.WriteString("\t{")
+		for i, b := range fixture {
+			if i%16 == 0 {
+				src.WriteString("\n\t\t")
+			} else {
+				src.WriteByte(' ')
+			}
+			fmt.Fprintf(&src, "0x%02x,", b)
+		}
+		src.WriteString("\n\t},\n")
+	}
+	src.WriteString("}\n")
+	return src.String()
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// benchmark.go 文件实现了 -benchmark-algorithms 选项：
+// 依次使用每个受支持的 DNSSEC 算法签名配置中的静态区域，
+// 将与 -selftest 相同的参考查询重复若干轮，直接交由组装好的回复器回复，
+// 记录服务器端的密钥生成时间、回复及签名吞吐量和回复大小，输出各算法的对比报告，
+// 以便为最大放大倍数或更贴近真实部署的实验选择算法。
+//
+// 基准测试仅使用配置中的服务器、DNSSEC 及静态区域，不启用签名缓存，
+// 实验模块、延迟、人格等包装层均不参与，以免干扰测量。
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+)
+
+// benchmarkAlgorithms 为参与基准测试的算法，即 xperi 能够签名的全部算法
+var benchmarkAlgorithms = []dns.DNSSECAlgorithm{
+	dns.DNSSECAlgorithmRSASHA1,
+	dns.DNSSECAlgorithmRSASHA256,
+	dns.DNSSECAlgorithmRSASHA512,
+	dns.DNSSECAlgorithmECDSAP256SHA256,
+	dns.DNSSECAlgorithmECDSAP384SHA384,
+	dns.DNSSECAlgorithmED25519,
+}
+
+// benchmarkAlgorithmNames 记录参与基准测试的算法的助记符
+var benchmarkAlgorithmNames = map[dns.DNSSECAlgorithm]string{
+	dns.DNSSECAlgorithmRSASHA1:         "RSASHA1",
+	dns.DNSSECAlgorithmRSASHA256:       "RSASHA256",
+	dns.DNSSECAlgorithmRSASHA512:       "RSASHA512",
+	dns.DNSSECAlgorithmECDSAP256SHA256: "ECDSAP256SHA256",
+	dns.DNSSECAlgorithmECDSAP384SHA384: "ECDSAP384SHA384",
+	dns.DNSSECAlgorithmED25519:         "ED25519",
+}
+
+// AlgorithmBenchmark 记录一个算法的基准测试结果
+type AlgorithmBenchmark struct {
+	Algorithm dns.DNSSECAlgorithm `json:"algorithm"`
+	Name      string              `json:"name"`
+	// 首轮查询（含密钥生成）的耗时
+	KeyGeneration time.Duration `json:"key_generation_ns"`
+	// 计时轮次中的回复数量及吞吐量
+	Responses          int     `json:"responses"`
+	ResponsesPerSecond float64 `json:"responses_per_second"`
+	// 计时轮次中生成的签名数量及吞吐量
+	Signatures          int     `json:"signatures"`
+	SignaturesPerSecond float64 `json:"signatures_per_second"`
+	// 回复大小，单位为字节
+	MeanResponseSize float64 `json:"mean_response_size"`
+	MaxResponseSize  int     `json:"max_response_size"`
+	// 区域 DNSKEY 查询的平均回复大小
+	DNSKEYResponseSize float64 `json:"dnskey_response_size"`
+	// 放大倍数：平均回复大小 / 平均查询大小
+	Amplification float64 `json:"amplification"`
+}
+
+// benchmarkConfig 返回基准测试使用的配置，仅保留服务器、静态区域及使用指定算法的 DNSSEC 配置
+func benchmarkConfig(conf Config, algo dns.DNSSECAlgorithm) Config {
+	bConf := Config{
+		Server: conf.Server,
+		DNSSEC: conf.DNSSEC,
+		Zones:  conf.Zones,
+		Seed:   conf.Seed,
+	}
+	bConf.DNSSEC.Enabled = true
+	bConf.DNSSEC.Algorithm = uint8(algo)
+	// 签名缓存会掩盖签名的开销
+	bConf.DNSSEC.ResignWindow = ""
+	bConf.DNSSEC.ResignJitter = ""
+	return bConf
+}
+
+// benchmarkPacket 返回参考查询的编码
+func benchmarkPacket(q selfTestQuery) []byte {
+	qry := dns.DNSMessage{
+		Header: dns.DNSHeader{ID: 1, QDCount: 1, ARCount: 1},
+		Question: dns.DNSQuestionSection{
+			{Name: *dns.NewDNSName(q.name), Type: q.qType, Class: dns.DNSClassIN},
+		},
+		Additional: dns.DNSResponseSection{
+			(&dns.DNSOPTRecord{UDPPayloadSize: 65535, DO: true}).ResourceRecord(),
+		},
+	}
+	return qry.Encode()
+}
+
+// benchmarkAlgorithm 使用一个算法构建回复器并测量其回复参考查询的性能
+func benchmarkAlgorithm(conf Config, algo dns.DNSSECAlgorithm, rounds int) (AlgorithmBenchmark, error) {
+	result := AlgorithmBenchmark{Algorithm: algo, Name: benchmarkAlgorithmNames[algo]}
+	bConf := benchmarkConfig(conf, algo)
+	queries, err := selfTestQueries(bConf)
+	if err != nil {
+		return result, err
+	}
+	responser, closers, err := Build(bConf)
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	if err != nil {
+		return result, err
+	}
+
+	packets := make([][]byte, len(queries))
+	for i, q := range queries {
+		packets[i] = benchmarkPacket(q)
+	}
+	respond := func(packet []byte) (dns.DNSMessage, int, error) {
+		data, err := xdns.Respond(context.Background(), responser, xdns.ConnectionInfo{
+			Protocol: xdns.ProtocolTCP,
+			Address:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Packet:   packet,
+		})
+		if err != nil {
+			return dns.DNSMessage{}, 0, err
+		}
+		resp := dns.DNSMessage{}
+		if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+			return dns.DNSMessage{}, 0, err
+		}
+		return resp, len(data), nil
+	}
+
+	// 首轮查询生成各区域的密钥，单独计时
+	start := time.Now()
+	for _, packet := range packets {
+		if _, _, err := respond(packet); err != nil {
+			return result, err
+		}
+	}
+	result.KeyGeneration = time.Since(start)
+
+	querySize, responseSize := 0, 0
+	dnskeySize, dnskeyCount := 0, 0
+	start = time.Now()
+	for round := 0; round < rounds; round++ {
+		for i, packet := range packets {
+			resp, size, err := respond(packet)
+			if err != nil {
+				return result, err
+			}
+			result.Responses++
+			querySize += len(packet)
+			responseSize += size
+			if size > result.MaxResponseSize {
+				result.MaxResponseSize = size
+			}
+			if queries[i].qType == dns.DNSRRTypeDNSKEY {
+				dnskeySize += size
+				dnskeyCount++
+			}
+			for _, section := range []dns.DNSResponseSection{resp.Answer, resp.Authority, resp.Additional} {
+				for _, rr := range section {
+					if rr.Type == dns.DNSRRTypeRRSIG {
+						result.Signatures++
+					}
+				}
+			}
+		}
+	}
+	elapsed := time.Since(start).Seconds()
+
+	if result.Responses > 0 {
+		result.ResponsesPerSecond = float64(result.Responses) / elapsed
+		result.SignaturesPerSecond = float64(result.Signatures) / elapsed
+		result.MeanResponseSize = float64(responseSize) / float64(result.Responses)
+		result.Amplification = float64(responseSize) / float64(querySize)
+	}
+	if dnskeyCount > 0 {
+		result.DNSKEYResponseSize = float64(dnskeySize) / float64(dnskeyCount)
+	}
+	return result, nil
+}
+
+// BenchmarkAlgorithms 依次使用每个受支持的算法对静态区域进行基准测试，并输出对比报告
+// 其接受参数为：
+//   - conf Config，xdnsd 配置
+//   - rounds int，计时的查询轮数，每轮包含全部参考查询
+//   - format string，输出格式，"text" 或 "json"
+//   - w io.Writer，输出
+//
+// 返回值为：
+//   - error，构建回复器或回复查询失败时的错误信息
+func BenchmarkAlgorithms(conf Config, rounds int, format string, w io.Writer) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("function BenchmarkAlgorithms failed: unknown report format %q", format)
+	}
+	if len(conf.Zones) == 0 {
+		return fmt.Errorf("function BenchmarkAlgorithms failed: no static zone to benchmark")
+	}
+	if rounds <= 0 {
+		rounds = 1
+	}
+
+	results := []AlgorithmBenchmark{}
+	for _, algo := range benchmarkAlgorithms {
+		result, err := benchmarkAlgorithm(conf, algo, rounds)
+		if err != nil {
+			return fmt.Errorf("function BenchmarkAlgorithms failed: algorithm %d.\n%v", algo, err)
+		}
+		results = append(results, result)
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "algorithm\tkeygen\tresponses/s\tsignatures/s\tmean size\tmax size\tdnskey size\tamplification\t")
+	largest, fastest := results[0], results[0]
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s (%d)\t%s\t%.0f\t%.0f\t%.0f\t%d\t%.0f\t%.2f\t\n",
+			r.Name, r.Algorithm, r.KeyGeneration.Round(time.Millisecond), r.ResponsesPerSecond, r.SignaturesPerSecond,
+			r.MeanResponseSize, r.MaxResponseSize, r.DNSKEYResponseSize, r.Amplification)
+		if r.Amplification > largest.Amplification {
+			largest = r
+		}
+		if r.SignaturesPerSecond > fastest.SignaturesPerSecond {
+			fastest = r
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nlargest amplification: %s (%.2fx), fastest signing: %s (%.0f signatures/s), %d rounds\n",
+		largest.Name, largest.Amplification, fastest.Name, fastest.SignaturesPerSecond, rounds)
+	return err
+}
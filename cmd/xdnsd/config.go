@@ -0,0 +1,756 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// config.go 文件定义了 xdnsd 的 JSON 配置文件格式。
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// Config 记录 xdnsd 的全部配置
+type Config struct {
+	Server    ServerSection    `json:"server"`
+	DNSSEC    DNSSECSection    `json:"dnssec"`
+	Zones     []ZoneSection    `json:"zones"`
+	Modules   []ModuleSection  `json:"modules"`
+	QueryLog  QueryLogSection  `json:"query_log"`
+	Stats     StatsSection     `json:"stats"`
+	Tracing   TracingSection   `json:"tracing"`
+	Coalesce  CoalesceSection  `json:"coalesce"`
+	Ordering  OrderingSection  `json:"ordering"`
+	Outage    OutageSection    `json:"outage"`
+	Split     SplitSection     `json:"transport_split"`
+	Telemetry TelemetrySection `json:"telemetry"`
+	Entropy   EntropySection   `json:"entropy"`
+	Anycast   AnycastSection   `json:"anycast"`
+	Phantom   PhantomSection   `json:"phantom"`
+	DoH       DoHSection       `json:"doh"`
+	MDNS      MDNSSection      `json:"mdns"`
+	// 客户端人格分配，用于在单个实例上比较不同解析器群体的盲测实验
+	Personality PersonalitySection `json:"personality"`
+	// 问题回显变异，用于探测解析器匹配回复与查询时的严格程度
+	QuestionEcho QuestionEchoSection `json:"question_echo"`
+	// UDP 回复副本，用于研究解析器接受并缓存同一查询的哪一份回复
+	Duplicate DuplicateSection `json:"duplicate"`
+	// 迟到回复，用于刻画解析器在超时后的重试及抑制行为
+	Late LateSection `json:"late"`
+	// 双栈回复，用于研究解析器及客户端的双栈回退行为
+	DualStack DualStackSection `json:"dual_stack"`
+	// 只读检视 API，供仪表盘监控运行中的实验
+	Inspect InspectSection `json:"inspect"`
+	// 管理监听器，提供实验仪表盘，用于教学演示
+	Admin AdminSection `json:"admin"`
+	// 随机生成（随机签名、随机摘要、冲突密钥等）所使用的种子，使实验可以复现，0 表示不设置种子
+	Seed int64 `json:"seed"`
+}
+
+// ServerSection 记录服务器的监听配置，与 xdns.ServerConfig 对应
+type ServerSection struct {
+	IP                  string `json:"ip"`
+	Port                int    `json:"port"`
+	EnableTCP           bool   `json:"enable_tcp"`
+	TCPThreshold        int    `json:"tcp_threshold"`
+	EnforcePayloadSize  bool   `json:"enforce_payload_size"`
+	EnableProxyProtocol bool   `json:"proxy_protocol"`
+	SocketActivation    bool   `json:"socket_activation"`
+	User                string `json:"user"`
+	Group               string `json:"group"`
+	// 诊断服务地址，如 "127.0.0.1:6060"，为空时不启用
+	DiagnosticsAddr string `json:"diagnostics_addr"`
+	// 单个回复构造过程的内存预算，单位为字节，0 表示不限制
+	ResponseMemoryLimit int64 `json:"response_memory_limit"`
+	// 回复大小的上限，超出时回复 SERVFAIL，设置了 allow_overrun 的模块除外
+	ResponseLimits ResponseLimitsSection `json:"response_limits"`
+	// 是否测量每个回复的 CPU 时间及签名、摘要操作的次数，累计于诊断服务的 /debug/vars
+	CostAccounting bool `json:"cost_accounting"`
+	// 是否将每个回复的开销以 TXT 记录附加于其附加部分，需启用 cost_accounting
+	CostDebugTXT bool `json:"cost_debug_txt"`
+	// 是否记录查询的接收接口、目的地址及 TTL，监听通配地址时任播身份据此匹配客户端所查询的地址
+	ReceiveAncillary bool `json:"receive_ancillary"`
+	// TCP 回复的分帧篡改，用于测试解析器对字节流的解析
+	StreamFraming StreamFramingSection `json:"stream_framing"`
+}
+
+// ResponseLimitsSection 记录回复大小的上限，与 xdns.ResponseLimits 对应，各字段为 0 时不限制
+type ResponseLimitsSection struct {
+	MaxAnswerRRs     int `json:"max_answer_rrs"`
+	MaxAuthorityRRs  int `json:"max_authority_rrs"`
+	MaxAdditionalRRs int `json:"max_additional_rrs"`
+	MaxResponseBytes int `json:"max_response_bytes"`
+}
+
+// StreamFramingSection 记录 TCP 回复的分帧篡改配置，与 xdns.StreamFraming 对应，
+// 各字段均为零值时不进行篡改
+type StreamFramingSection struct {
+	// 每个分段的字节数，0 表示不分段
+	SegmentSize int `json:"segment_size"`
+	// 相邻分段之间的延迟，如 "50ms"
+	SegmentDelay string `json:"segment_delay"`
+	// 插入的垃圾字节的十六进制编码，为空时插入 garbage_length 个随机字节
+	Garbage       string `json:"garbage"`
+	GarbageLength int    `json:"garbage_length"`
+	// 垃圾字节的位置："before_length"（默认）或 "after_length"
+	GarbagePosition string `json:"garbage_position"`
+}
+
+// garbagePositions 记录垃圾字节位置名称与 xdns.GarbagePosition 的对应关系
+var garbagePositions = map[string]xdns.GarbagePosition{
+	"":              xdns.GarbageBeforeLength,
+	"before_length": xdns.GarbageBeforeLength,
+	"after_length":  xdns.GarbageAfterLength,
+}
+
+// Enabled 判断是否配置了分帧篡改
+func (s StreamFramingSection) Enabled() bool {
+	return s.SegmentSize > 0 || s.Garbage != "" || s.GarbageLength > 0
+}
+
+// StreamFraming 返回对应的 xdns.StreamFraming，未配置分帧篡改时返回 nil，需先经 check 检查
+func (s StreamFramingSection) StreamFraming() *xdns.StreamFraming {
+	if !s.Enabled() {
+		return nil
+	}
+	garbage, _ := hex.DecodeString(s.Garbage)
+	delay, _ := time.ParseDuration(s.SegmentDelay)
+	return &xdns.StreamFraming{
+		SegmentSize:     s.SegmentSize,
+		SegmentDelay:    delay,
+		Garbage:         garbage,
+		GarbageLength:   s.GarbageLength,
+		GarbagePosition: garbagePositions[s.GarbagePosition],
+	}
+}
+
+// DNSSECSection 记录 DNSSEC 配置，启用后区域数据及模块的回复均会被签名
+type DNSSECSection struct {
+	Enabled    bool  `json:"enabled"`
+	Algorithm  uint8 `json:"algorithm"`
+	DigestType uint8 `json:"digest_type"`
+	// 签名有效期，单位为秒，以服务器当前时间为基准，0 表示 86400
+	Validity uint32 `json:"validity"`
+	// 签名有效期的抖动，单位为秒，每个回复中的生效及过期时间各自随机偏移，使验证解析器无法复用验证结果，0 表示不抖动
+	ValidityJitter uint32 `json:"validity_jitter"`
+	// 生成 DNSKEY 时使用的密钥参数，如 {"rsa_bits": 4096, "rsa_exponent": 3, "padding": 0}
+	KeyParams xperi.KeyParams `json:"key_params"`
+	// 重新签名的刷新窗口，如 "6h"，非空时缓存签名，并在签名距过期不足该时长时自动重新签名
+	ResignWindow string `json:"resign_window"`
+	// 重新签名的随机抖动，如 "30m"，为空表示不使用抖动
+	ResignJitter string `json:"resign_jitter"`
+	// RRSIG Labels 字段的篡改方式，如 {"offset": -1, "reconstruct": true, "types": ["A"]}
+	RRSIGLabels RRSIGLabelsSection `json:"rrsig_labels"`
+	// 区域顶点，如 ["test", "a.test"]，非空时显式区分父区域与子区域：
+	// DNSKEY 仅在区域顶点回复，DS 仅在区域切割处由父区域回复，为空时视每个被查询的名称为区域顶点
+	ZoneCuts []string `json:"zone_cuts"`
+	// 在区域顶点由子区域回复并签名 DS，用于错误配置实验，仅在设置 zone_cuts 时生效
+	ChildSideDS bool `json:"child_side_ds"`
+}
+
+// RRSIGLabelsSection 记录 RRSIG Labels 字段的篡改配置，与 xdns.RRSIGLabels 对应
+type RRSIGLabelsSection struct {
+	// Labels 字段相对于所有者名称标签数的偏移，负数声明通配符展开，正数生成非法值，0 表示不篡改
+	Offset int `json:"offset"`
+	// 是否以重建的通配符所有者名称签名
+	Reconstruct bool `json:"reconstruct"`
+	// 仅篡改这些类型的 RRSIG，为空时篡改除 DNSKEY 外的全部类型
+	Types []string `json:"types"`
+}
+
+// ZoneSection 记录一个静态区域
+type ZoneSection struct {
+	Name string `json:"name"`
+	// 存储后端："memory"（默认）或 "bolt:<路径>"
+	Store   string          `json:"store"`
+	Records []RecordSection `json:"records"`
+}
+
+// RecordSection 记录一条资源记录，Data 为记录数据的文本表示
+type RecordSection struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// ModuleSection 记录一个实验模块，其负责 Zone 及其下的全部名称
+type ModuleSection struct {
+	// 模块类型："chain"、"aggressive-nsec"、"nsec3"、"referral"、"proxy"、"misconfig"、"referral-loop"、"nxns"、"script"、"secondary" 或 "validity-sweep"
+	Type string `json:"type"`
+	Zone string `json:"zone"`
+	// 模块参数，格式取决于模块类型，详见 modules.go
+	Options json.RawMessage `json:"options"`
+	// 匹配条件，为空时模块负责区域内的全部查询
+	Match MatchSection `json:"match"`
+	// 是否允许模块的回复超出 server.response_limits，用于有意生成超大回复的实验
+	AllowOverrun bool `json:"allow_overrun"`
+}
+
+// MatchSection 记录模块路由的匹配条件，如
+// {"min_labels": 3, "max_labels": 3, "label_prefix": ["^cname\\d+$"], "types": ["A", "CNAME"]}
+type MatchSection struct {
+	// 查询名称标签数的下限及上限，0 表示不限
+	MinLabels int `json:"min_labels"`
+	MaxLabels int `json:"max_labels"`
+	// 依次匹配查询名称自左向右各标签的正则表达式，标签为小写
+	LabelPrefix []string `json:"label_prefix"`
+	// 查询类型集合，为空时匹配全部类型
+	Types []string `json:"types"`
+}
+
+// check 检查匹配条件的格式
+func (m MatchSection) check() error {
+	if m.MinLabels < 0 || m.MaxLabels < 0 || (m.MaxLabels > 0 && m.MaxLabels < m.MinLabels) {
+		return fmt.Errorf("invalid label count range [%d, %d]", m.MinLabels, m.MaxLabels)
+	}
+	for _, expr := range m.LabelPrefix {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid label prefix %q: %v", expr, err)
+		}
+	}
+	for _, t := range m.Types {
+		if _, err := ParseType(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RouteMatcher 返回对应的路由匹配条件，需先经 check 检查
+func (m MatchSection) RouteMatcher() RouteMatcher {
+	matcher := RouteMatcher{MinLabels: m.MinLabels, MaxLabels: m.MaxLabels}
+	for _, expr := range m.LabelPrefix {
+		matcher.LabelPrefix = append(matcher.LabelPrefix, regexp.MustCompile(expr))
+	}
+	for _, t := range m.Types {
+		rrType, _ := ParseType(t)
+		matcher.Types = append(matcher.Types, rrType)
+	}
+	return matcher
+}
+
+// QueryLogSection 记录 BIND 格式查询日志的配置
+type QueryLogSection struct {
+	// 日志文件路径，"-" 表示标准输出，为空时不记录
+	Path          string `json:"path"`
+	PrintTime     bool   `json:"print_time"`
+	PrintCategory bool   `json:"print_category"`
+	PrintSeverity bool   `json:"print_severity"`
+}
+
+// StatsSection 记录统计快照的配置
+type StatsSection struct {
+	// 快照目录，为空时不统计
+	Directory string `json:"directory"`
+	// 快照间隔，形如 "1m"
+	Interval string `json:"interval"`
+	Keep     int    `json:"keep"`
+	TopN     int    `json:"top_n"`
+}
+
+// TracingSection 记录追踪的配置
+type TracingSection struct {
+	// OTLP/HTTP 收集器地址，形如 "http://127.0.0.1:4318/v1/traces"，为空时不追踪
+	Endpoint    string `json:"endpoint"`
+	ServiceName string `json:"service_name"`
+}
+
+// CoalesceSection 记录查询合并的配置
+type CoalesceSection struct {
+	Enabled bool `json:"enabled"`
+	// 是否合并来自不同客户端的相同查询，默认仅合并同一客户端的重传
+	Global bool `json:"global"`
+}
+
+// OrderingSection 记录回答中 RR 集合排序的配置
+type OrderingSection struct {
+	// 排序策略："fixed"（默认）、"cyclic" 或 "random"
+	Policy string `json:"policy"`
+	// 需要排序的记录类型，如 ["A", "AAAA"]，为空时对全部类型生效
+	Types []string `json:"types"`
+}
+
+// OutageSection 记录停服模拟的配置，用于测量解析器的 serve-stale 行为
+type OutageSection struct {
+	// 停服控制 API 的监听地址，如 "127.0.0.1:8053"，为空时不启用控制 API
+	ControlAddr string `json:"control_addr"`
+	// 预先安排的停服时间窗口
+	Windows []OutageWindowSection `json:"windows"`
+}
+
+// SplitSection 记录传输差异回复的配置，用于研究解析器在截断后经由 TCP 重新查询的行为
+type SplitSection struct {
+	// 启用差异回复的区域，其经由 UDP 的查询仅得到截断的回复
+	Zones []string `json:"zones"`
+}
+
+// OutageWindowSection 记录一个停服时间窗口，时间相对于 xdnsd 的启动时刻
+type OutageWindowSection struct {
+	Zone string `json:"zone"`
+	// 窗口开始前的时长，形如 "5m"
+	After string `json:"after"`
+	// 窗口的持续时长，形如 "10m"
+	Duration string `json:"duration"`
+}
+
+// TelemetrySection 记录解析器遥测数据收集的配置
+type TelemetrySection struct {
+	// 遥测端点的监听地址，如 "0.0.0.0:8054"，为空时不收集
+	ListenAddr string `json:"listen_addr"`
+	// 实验轮次名称
+	Run string `json:"run"`
+	// 退出时写入关联报告的路径，以 ".csv" 结尾时为 CSV 格式，否则为 JSON 格式
+	ReportPath string `json:"report_path"`
+}
+
+// EntropySection 记录源端口及事务 ID 熵分析的配置
+type EntropySection struct {
+	// 熵报告端点的监听地址，如 "127.0.0.1:8055"，为空时不分析
+	ListenAddr string `json:"listen_addr"`
+	// 每个客户端保留的样本数量，0 表示 65536
+	Limit int `json:"limit"`
+}
+
+// AnycastSection 记录任播模拟的配置，用于研究解析器在任播节点之间的选择行为
+type AnycastSection struct {
+	// 逻辑服务器身份，为空时不模拟
+	Identities []AnycastIdentitySection `json:"identities"`
+}
+
+// AnycastIdentitySection 记录一个逻辑服务器身份，与 xdns.AnycastIdentity 对应
+type AnycastIdentitySection struct {
+	Name  string `json:"name"`
+	NSID  string `json:"nsid"`
+	MName string `json:"mname"`
+	// 回复延迟，形如 "20ms"，为空表示不延迟
+	Latency string `json:"latency"`
+	// 该身份负责的本地监听地址，如 ["192.0.2.1:53"]，为空时按客户端 IP 的哈希选择
+	Listeners []string `json:"listeners"`
+}
+
+// PhantomSection 记录幻影域模拟的配置，用于测量解析器的未完成查询数量上限
+type PhantomSection struct {
+	// 幻影域，为空时不模拟
+	Zones []string `json:"zones"`
+	// 回复的比例，位于 [0, 1] 之间，其余查询不作回复
+	AnswerRatio float64 `json:"answer_ratio"`
+	// 延迟分布："constant"（默认）、"uniform" 或 "exponential"
+	Distribution string `json:"distribution"`
+	// 延迟参数，形如 "10s"
+	MinDelay  string `json:"min_delay"`
+	MaxDelay  string `json:"max_delay"`
+	MeanDelay string `json:"mean_delay"`
+}
+
+// DoHSection 记录 DNS over HTTPS 服务的配置，除线格式外还提供 application/dns-json 接口
+type DoHSection struct {
+	// 监听地址，如 "0.0.0.0:443"，为空时不启用
+	ListenAddr string `json:"listen_addr"`
+	// TLS 证书及私钥文件，均为空时以明文 HTTP 提供服务，以便由反向代理终结 TLS
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// 客户端访问 DoH 服务时使用的主机名，用于 -client-config 生成的 DNS Stamp，为空时不生成
+	Hostname string `json:"hostname"`
+}
+
+// MDNSSection 记录多播 DNS 服务的配置，用于研究本地网络中的链路本地解析行为
+type MDNSSection struct {
+	// 负责回复的记录，名称应位于 .local 之下，为空时不启用
+	Records []RecordSection `json:"records"`
+	// 加入多播组所使用的网络接口名称，如 "eth0"，为空时由系统选择
+	Interface string `json:"interface"`
+	// 作为共享记录回复（不设置缓存刷新位）的记录类型，如 ["PTR"]
+	SharedTypes []string `json:"shared_types"`
+}
+
+// PersonalitySection 记录客户端人格分配的配置，人格名称为
+// "normal"、"slow"、"bogus-dnssec" 或 "truncate-always"
+type PersonalitySection struct {
+	// 静态分配，按顺序使用首个包含客户端的前缀
+	Static []PersonalityAssignmentSection `json:"static"`
+	// 未被静态分配的客户端按 IP 哈希在其中选择的人格，为空时均为 "normal"
+	Rotation []string `json:"rotation"`
+	// 轮换周期，形如 "10m"，为空时不随时间轮换
+	Period string `json:"period"`
+	// slow 人格的回复延迟，形如 "2s"，为空时为 2 秒
+	SlowDelay string `json:"slow_delay"`
+}
+
+// PersonalityAssignmentSection 记录一条静态人格分配
+type PersonalityAssignmentSection struct {
+	Prefix      string `json:"prefix"`
+	Personality string `json:"personality"`
+}
+
+// personalities 记录人格名称与 xdns.Personality 的对应关系
+var personalities = map[string]xdns.Personality{
+	"normal":          xdns.PersonalityNormal,
+	"slow":            xdns.PersonalitySlow,
+	"bogus-dnssec":    xdns.PersonalityBogusDNSSEC,
+	"truncate-always": xdns.PersonalityTruncateAlways,
+}
+
+// QuestionEchoSection 记录问题回显变异的配置，变异名称为
+// "none"、"case"、"trailing-dot"、"inject-label" 或 "embedded-null"
+type QuestionEchoSection struct {
+	// 可选的变异，每个回复从中随机选择一个，为空时不启用
+	Mutations []string `json:"mutations"`
+	// 重试窗口，形如 "5s"，为空时为 5 秒
+	RetryWindow string `json:"retry_window"`
+	// inject-label 注入的标签，为空时为 "xdns"
+	Label string `json:"label"`
+}
+
+// questionMutations 记录变异名称与 xdns.QuestionMutation 的对应关系
+var questionMutations = map[string]xdns.QuestionMutation{
+	"none":          xdns.QuestionMutationNone,
+	"case":          xdns.QuestionMutationCase,
+	"trailing-dot":  xdns.QuestionMutationTrailingDot,
+	"inject-label":  xdns.QuestionMutationInjectLabel,
+	"embedded-null": xdns.QuestionMutationEmbeddedNull,
+}
+
+// DuplicateSection 记录 UDP 回复副本的配置，变化名称为
+// "identical"、"conflicting"、"wrong-id" 或 "bogus-signature"
+type DuplicateSection struct {
+	// 依次发送的副本的变化方式，为空时不启用
+	Copies []string `json:"copies"`
+	// 相邻两份回复之间的间隔，形如 "10ms"，为空时连续发送
+	Interval string `json:"interval"`
+	// 是否在原回复之后发送副本
+	After bool `json:"after"`
+	// conflicting 副本使用的地址，为空时使用随机地址
+	ConflictIP string `json:"conflict_ip"`
+}
+
+// duplicateVariations 记录变化名称与 xdns.DuplicateVariation 的对应关系
+var duplicateVariations = map[string]xdns.DuplicateVariation{
+	"identical":       xdns.DuplicateIdentical,
+	"conflicting":     xdns.DuplicateConflicting,
+	"wrong-id":        xdns.DuplicateWrongID,
+	"bogus-signature": xdns.DuplicateBogusSignature,
+}
+
+// LateSection 记录迟到回复的配置
+type LateSection struct {
+	// 延迟回复的区域，为空时不启用，"." 表示全部区域
+	Zones []string `json:"zones"`
+	// 回复延迟，形如 "12s"，为空时为 12 秒
+	Delay string `json:"delay"`
+	// 迟到回复发出后的观察窗口，形如 "30s"，为空时为 30 秒
+	HoldWindow string `json:"hold_window"`
+}
+
+// DualStackSection 记录双栈回复的配置
+type DualStackSection struct {
+	// 生效的区域，为空时不启用，"." 表示全部区域
+	Zones []string `json:"zones"`
+	// 对 A 及 AAAA 查询的处理方式
+	A    FamilyPolicySection `json:"a"`
+	AAAA FamilyPolicySection `json:"aaaa"`
+	// A 与 AAAA 查询的配对窗口，形如 "5s"，为空时为 5 秒
+	PairWindow string `json:"pair_window"`
+}
+
+// FamilyPolicySection 记录对一个地址族查询的处理方式，与 xdns.FamilyPolicy 对应，回复方式为
+// "working"（默认）、"unreachable"、"nodata"、"servfail" 或 "drop"
+type FamilyPolicySection struct {
+	// 回复前的延迟，形如 "300ms"
+	Latency  string `json:"latency"`
+	Behavior string `json:"behavior"`
+	// unreachable 使用的地址，为空时使用文档保留地址
+	Address string `json:"address"`
+}
+
+// familyBehaviors 记录回复方式名称与 xdns.FamilyBehavior 的对应关系
+var familyBehaviors = map[string]xdns.FamilyBehavior{
+	"":            xdns.FamilyWorking,
+	"working":     xdns.FamilyWorking,
+	"unreachable": xdns.FamilyUnreachable,
+	"nodata":      xdns.FamilyNoData,
+	"servfail":    xdns.FamilyServFail,
+	"drop":        xdns.FamilyDrop,
+}
+
+// check 检查地址族处理方式的合法性
+func (f FamilyPolicySection) check(family string) error {
+	if f.Latency != "" {
+		if v, err := time.ParseDuration(f.Latency); err != nil || v < 0 {
+			return fmt.Errorf("invalid dual stack %s latency %q", family, f.Latency)
+		}
+	}
+	if _, ok := familyBehaviors[f.Behavior]; !ok {
+		return fmt.Errorf("invalid dual stack %s behavior %q", family, f.Behavior)
+	}
+	if f.Address != "" && net.ParseIP(f.Address) == nil {
+		return fmt.Errorf("invalid dual stack %s address %q", family, f.Address)
+	}
+	return nil
+}
+
+// FamilyPolicy 返回对应的 xdns.FamilyPolicy，需先经 check 检查
+func (f FamilyPolicySection) FamilyPolicy() xdns.FamilyPolicy {
+	latency, _ := time.ParseDuration(f.Latency)
+	return xdns.FamilyPolicy{
+		Latency:  latency,
+		Behavior: familyBehaviors[f.Behavior],
+		Address:  net.ParseIP(f.Address),
+	}
+}
+
+// InspectSection 记录只读检视 API 的配置
+type InspectSection struct {
+	// 检视 API 的监听地址，如 "127.0.0.1:8056"，为空时不启用
+	ListenAddr string `json:"listen_addr"`
+	// 保留的最近查询样本数量，0 表示 1000
+	Samples int `json:"samples"`
+}
+
+// AdminSection 记录管理监听器的配置，其提供实验仪表盘、检视 API 及攻击参数的控制
+type AdminSection struct {
+	// 管理监听器的地址，如 "127.0.0.1:8057"，为空时不启用
+	ListenAddr string `json:"listen_addr"`
+}
+
+// phantomDistributions 记录延迟分布名称与 xdns.PhantomDistribution 的对应关系
+var phantomDistributions = map[string]xdns.PhantomDistribution{
+	"":            xdns.PhantomDistributionConstant,
+	"constant":    xdns.PhantomDistributionConstant,
+	"uniform":     xdns.PhantomDistributionUniform,
+	"exponential": xdns.PhantomDistributionExponential,
+}
+
+// orderPolicies 记录排序策略名称与 xdns.OrderPolicy 的对应关系
+var orderPolicies = map[string]xdns.OrderPolicy{
+	"":       xdns.OrderPolicyFixed,
+	"fixed":  xdns.OrderPolicyFixed,
+	"cyclic": xdns.OrderPolicyCyclic,
+	"random": xdns.OrderPolicyRandom,
+}
+
+// LoadConfig 读取并检查配置文件
+func LoadConfig(path string) (Config, error) {
+	conf := Config{
+		Server: ServerSection{
+			Port:         53,
+			TCPThreshold: 1232,
+		},
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("function LoadConfig failed: read %s failed.\n%v", path, err)
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return Config{}, fmt.Errorf("function LoadConfig failed: parse %s failed.\n%v", path, err)
+	}
+	if err := conf.check(); err != nil {
+		return Config{}, fmt.Errorf("function LoadConfig failed: %v", err)
+	}
+	return conf, nil
+}
+
+// check 检查配置的合法性
+func (c *Config) check() error {
+	if c.Server.IP != "" && net.ParseIP(c.Server.IP) == nil {
+		return fmt.Errorf("invalid server ip %q", c.Server.IP)
+	}
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("invalid server port %d", c.Server.Port)
+	}
+	if f := c.Server.StreamFraming; f.SegmentSize < 0 || f.GarbageLength < 0 {
+		return fmt.Errorf("invalid stream framing segment size %d or garbage length %d", f.SegmentSize, f.GarbageLength)
+	}
+	if d := c.Server.StreamFraming.SegmentDelay; d != "" {
+		if v, err := time.ParseDuration(d); err != nil || v < 0 {
+			return fmt.Errorf("invalid stream framing segment delay %q", d)
+		}
+	}
+	if _, err := hex.DecodeString(c.Server.StreamFraming.Garbage); err != nil {
+		return fmt.Errorf("invalid stream framing garbage %q", c.Server.StreamFraming.Garbage)
+	}
+	if _, ok := garbagePositions[c.Server.StreamFraming.GarbagePosition]; !ok {
+		return fmt.Errorf("invalid stream framing garbage position %q", c.Server.StreamFraming.GarbagePosition)
+	}
+	if c.Stats.Interval != "" {
+		if _, err := time.ParseDuration(c.Stats.Interval); err != nil {
+			return fmt.Errorf("invalid stats interval %q", c.Stats.Interval)
+		}
+	}
+	if e := c.DNSSEC.KeyParams.RSAExponent; e != 0 && (e < 3 || e%2 == 0) {
+		return fmt.Errorf("invalid dnssec rsa exponent %d", e)
+	}
+	if c.DNSSEC.KeyParams.Padding < 0 {
+		return fmt.Errorf("invalid dnssec key padding %d", c.DNSSEC.KeyParams.Padding)
+	}
+	if c.DNSSEC.ResignWindow != "" {
+		if d, err := time.ParseDuration(c.DNSSEC.ResignWindow); err != nil || d <= 0 {
+			return fmt.Errorf("invalid dnssec resign window %q", c.DNSSEC.ResignWindow)
+		}
+	}
+	if c.DNSSEC.ValidityJitter != 0 && c.DNSSEC.ResignWindow != "" {
+		return fmt.Errorf("dnssec validity jitter cannot be combined with resign window")
+	}
+	if c.DNSSEC.RRSIGLabels.Offset < -255 || c.DNSSEC.RRSIGLabels.Offset > 255 {
+		return fmt.Errorf("invalid dnssec rrsig labels offset %d", c.DNSSEC.RRSIGLabels.Offset)
+	}
+	if l := c.Server.ResponseLimits; l.MaxAnswerRRs < 0 || l.MaxAuthorityRRs < 0 || l.MaxAdditionalRRs < 0 || l.MaxResponseBytes < 0 {
+		return fmt.Errorf("invalid response limits %+v", l)
+	}
+	if c.Server.CostDebugTXT && !c.Server.CostAccounting {
+		return fmt.Errorf("cost debug txt requires cost accounting")
+	}
+	if c.DNSSEC.ChildSideDS && len(c.DNSSEC.ZoneCuts) == 0 {
+		return fmt.Errorf("dnssec child side ds requires zone cuts")
+	}
+	if c.DNSSEC.RRSIGLabels.Offset != 0 && c.DNSSEC.ResignWindow != "" {
+		return fmt.Errorf("dnssec rrsig labels cannot be combined with resign window")
+	}
+	for _, t := range c.DNSSEC.RRSIGLabels.Types {
+		if _, err := ParseType(t); err != nil {
+			return fmt.Errorf("invalid dnssec rrsig labels type %q", t)
+		}
+	}
+	if c.DNSSEC.ResignJitter != "" {
+		if d, err := time.ParseDuration(c.DNSSEC.ResignJitter); err != nil || d < 0 {
+			return fmt.Errorf("invalid dnssec resign jitter %q", c.DNSSEC.ResignJitter)
+		}
+	}
+	if c.Inspect.Samples < 0 {
+		return fmt.Errorf("invalid inspect sample count %d", c.Inspect.Samples)
+	}
+	if c.Entropy.Limit < 0 {
+		return fmt.Errorf("invalid entropy sample limit %d", c.Entropy.Limit)
+	}
+	for _, id := range c.Anycast.Identities {
+		if id.Latency != "" {
+			if d, err := time.ParseDuration(id.Latency); err != nil || d < 0 {
+				return fmt.Errorf("invalid anycast latency %q of identity %s", id.Latency, id.Name)
+			}
+		}
+	}
+	if c.Phantom.AnswerRatio < 0 || c.Phantom.AnswerRatio > 1 {
+		return fmt.Errorf("invalid phantom answer ratio %v", c.Phantom.AnswerRatio)
+	}
+	for _, t := range c.MDNS.SharedTypes {
+		if _, err := ParseType(t); err != nil {
+			return fmt.Errorf("invalid mdns shared type %q", t)
+		}
+	}
+	if (c.DoH.CertFile == "") != (c.DoH.KeyFile == "") {
+		return fmt.Errorf("doh cert_file and key_file must be set together")
+	}
+	if _, ok := phantomDistributions[c.Phantom.Distribution]; !ok {
+		return fmt.Errorf("invalid phantom distribution %q", c.Phantom.Distribution)
+	}
+	for _, delay := range []string{c.Phantom.MinDelay, c.Phantom.MaxDelay, c.Phantom.MeanDelay} {
+		if delay != "" {
+			if d, err := time.ParseDuration(delay); err != nil || d < 0 {
+				return fmt.Errorf("invalid phantom delay %q", delay)
+			}
+		}
+	}
+	for _, a := range c.Personality.Static {
+		if _, _, err := net.ParseCIDR(a.Prefix); err != nil {
+			return fmt.Errorf("invalid personality prefix %q", a.Prefix)
+		}
+		if _, ok := personalities[a.Personality]; !ok {
+			return fmt.Errorf("invalid personality %q", a.Personality)
+		}
+	}
+	for _, name := range c.Personality.Rotation {
+		if _, ok := personalities[name]; !ok {
+			return fmt.Errorf("invalid personality %q", name)
+		}
+	}
+	for _, d := range []string{c.Personality.Period, c.Personality.SlowDelay} {
+		if d != "" {
+			if v, err := time.ParseDuration(d); err != nil || v < 0 {
+				return fmt.Errorf("invalid personality duration %q", d)
+			}
+		}
+	}
+	for _, name := range c.QuestionEcho.Mutations {
+		if _, ok := questionMutations[name]; !ok {
+			return fmt.Errorf("invalid question echo mutation %q", name)
+		}
+	}
+	if w := c.QuestionEcho.RetryWindow; w != "" {
+		if v, err := time.ParseDuration(w); err != nil || v <= 0 {
+			return fmt.Errorf("invalid question echo retry window %q", w)
+		}
+	}
+	for _, name := range c.Duplicate.Copies {
+		if _, ok := duplicateVariations[name]; !ok {
+			return fmt.Errorf("invalid duplicate variation %q", name)
+		}
+	}
+	if d := c.Duplicate.Interval; d != "" {
+		if v, err := time.ParseDuration(d); err != nil || v < 0 {
+			return fmt.Errorf("invalid duplicate interval %q", d)
+		}
+	}
+	if c.Duplicate.ConflictIP != "" && net.ParseIP(c.Duplicate.ConflictIP) == nil {
+		return fmt.Errorf("invalid duplicate conflict ip %q", c.Duplicate.ConflictIP)
+	}
+	for _, w := range []string{c.Late.Delay, c.Late.HoldWindow} {
+		if w == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(w); err != nil || v <= 0 {
+			return fmt.Errorf("invalid late duration %q", w)
+		}
+	}
+	if err := c.DualStack.A.check("a"); err != nil {
+		return err
+	}
+	if err := c.DualStack.AAAA.check("aaaa"); err != nil {
+		return err
+	}
+	if w := c.DualStack.PairWindow; w != "" {
+		if v, err := time.ParseDuration(w); err != nil || v <= 0 {
+			return fmt.Errorf("invalid dual stack pair window %q", w)
+		}
+	}
+	if len(c.QuestionEcho.Label) > 63 {
+		return fmt.Errorf("invalid question echo label %q", c.QuestionEcho.Label)
+	}
+	for _, z := range c.Zones {
+		if z.Name == "" {
+			return fmt.Errorf("zone without name")
+		}
+	}
+	for _, m := range c.Modules {
+		if m.Zone == "" {
+			return fmt.Errorf("module %s without zone", m.Type)
+		}
+		if err := m.Match.check(); err != nil {
+			return fmt.Errorf("module %s for %s: %v", m.Type, m.Zone, err)
+		}
+	}
+	for _, w := range c.Outage.Windows {
+		after, err := time.ParseDuration(w.After)
+		if err != nil || after < 0 {
+			return fmt.Errorf("invalid outage window offset %q", w.After)
+		}
+		if d, err := time.ParseDuration(w.Duration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid outage window duration %q", w.Duration)
+		}
+	}
+	if _, ok := orderPolicies[c.Ordering.Policy]; !ok {
+		return fmt.Errorf("invalid ordering policy %q", c.Ordering.Policy)
+	}
+	for _, t := range c.Ordering.Types {
+		if _, err := ParseType(t); err != nil {
+			return fmt.Errorf("invalid ordering type %q", t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// export.go 文件实现了 -export-chain 选项：
+// 在不监听端口的情况下，直接向组装好的回复器查询配置中各区域的 DNSKEY 及 DS，
+// 并将标注后的信任链以 Graphviz DOT 或 JSON 格式输出，以便在部署前检查。
+// 注意 DNSSEC 密钥在每次启动时重新生成，因此导出的 Key Tag 仅反映信任链的结构。
+//
+// 此外还实现了 -client-config 选项：输出将测试解析器接入服务器所需的
+// DNS Stamp、resolv.conf、unbound 及 BIND 配置片段；
+// 以及 -export-zones 选项：将各静态区域经回复器签名后的全部记录（含配置的攻击记录）
+// 以主文件格式写入指定目录，以便将相同的数据载入 BIND / NSD 进行对比实验。
+// 实验模块的回复依赖于查询，无法枚举，因此不被导出，但回复器对模块区域回复的 DS 会被导出至上级静态区域。
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// localQuerier 返回直接向回复器查询的查询函数
+func localQuerier(responser xdns.Responser) xperi.ChainQuerier {
+	return func(qName string, qType dns.DNSType) (dns.DNSMessage, error) {
+		qry := dns.DNSMessage{
+			Header: dns.DNSHeader{ID: 1, QDCount: 1, ARCount: 1},
+			Question: dns.DNSQuestionSection{
+				{Name: *dns.NewDNSName(qName), Type: qType, Class: dns.DNSClassIN},
+			},
+			Additional: dns.DNSResponseSection{
+				(&dns.DNSOPTRecord{UDPPayloadSize: 1232, DO: true}).ResourceRecord(),
+			},
+		}
+		data, err := xdns.Respond(context.Background(), responser, xdns.ConnectionInfo{
+			Protocol: xdns.ProtocolTCP,
+			Address:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			Packet:   qry.Encode(),
+		})
+		if err != nil {
+			return dns.DNSMessage{}, err
+		}
+		resp := dns.DNSMessage{}
+		if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+			return dns.DNSMessage{}, err
+		}
+		return resp, nil
+	}
+}
+
+// ExportChain 导出配置中全部区域及模块区域的信任链
+// 其接受参数为：
+//   - conf Config，xdnsd 配置
+//   - responser xdns.Responser，由 Build 组装的回复器
+//   - format string，输出格式，"dot" 或 "json"
+//   - w io.Writer，输出
+func ExportChain(conf Config, responser xdns.Responser, format string, w io.Writer) error {
+	zones := []string{}
+	for _, zConf := range conf.Zones {
+		zones = append(zones, zConf.Name)
+	}
+	for _, mConf := range conf.Modules {
+		zones = append(zones, mConf.Zone)
+	}
+	chain, err := xperi.ExportTrustChain(localQuerier(responser), zones)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "dot":
+		_, err = io.WriteString(w, chain.DOT())
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(chain)
+	default:
+		err = fmt.Errorf("unknown chain export format %q", format)
+	}
+	return err
+}
+
+// ExportClientConf 输出将测试解析器接入服务器所需的配置片段，
+// 配置中的全部区域及模块区域均以 stub-zone 形式指向服务器。
+// 其接受参数为：
+//   - conf Config，xdnsd 配置
+//   - w io.Writer，输出
+func ExportClientConf(conf Config, w io.Writer) error {
+	zones := []string{}
+	for _, zConf := range conf.Zones {
+		zones = append(zones, zConf.Name)
+	}
+	for _, mConf := range conf.Modules {
+		zones = append(zones, mConf.Zone)
+	}
+	cConf := xdns.ClientConfConfig{
+		Server: xdns.ServerConfig{IP: net.ParseIP(conf.Server.IP), Port: conf.Server.Port},
+		Zones:  zones,
+		Stub:   true,
+		DNSSEC: conf.DNSSEC.Enabled,
+	}
+	if conf.DoH.ListenAddr != "" && conf.DoH.Hostname != "" {
+		_, port, _ := net.SplitHostPort(conf.DoH.ListenAddr)
+		cConf.DoHURL = fmt.Sprintf("https://%s/dns-query", net.JoinHostPort(conf.DoH.Hostname, port))
+	}
+	clientConf, err := xdns.NewClientConf(cConf)
+	if err != nil {
+		return err
+	}
+	_, err = clientConf.WriteTo(w)
+	return err
+}
+
+// exportZoneQueries 返回导出静态区域时的查询：区域中每条记录的 名称/类型，
+// 及以该区域为最近上级静态区域的其他区域及模块区域的 DS
+func exportZoneQueries(conf Config, zConf ZoneSection) ([]xdns.ZoneExportQuery, error) {
+	zone := canonical(zConf.Name)
+	queries := []xdns.ZoneExportQuery{}
+	for _, rConf := range zConf.Records {
+		qType, err := ParseType(rConf.Type)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, xdns.ZoneExportQuery{Name: canonical(rConf.Name), Type: qType})
+	}
+
+	children := []string{}
+	for _, other := range conf.Zones {
+		children = append(children, canonical(other.Name))
+	}
+	for _, mConf := range conf.Modules {
+		children = append(children, canonical(mConf.Zone))
+	}
+	for _, child := range children {
+		if child == zone || !inZone(child, zone) {
+			continue
+		}
+		// 子区域位于更近的静态区域之内时，其 DS 属于该区域
+		nearest := true
+		for _, other := range conf.Zones {
+			if parent := canonical(other.Name); parent != zone && parent != child && inZone(child, parent) && inZone(parent, zone) {
+				nearest = false
+				break
+			}
+		}
+		if nearest {
+			queries = append(queries, xdns.ZoneExportQuery{Name: child, Type: dns.DNSRRTypeDS})
+		}
+	}
+	return queries, nil
+}
+
+// exportZoneFile 返回区域主文件的文件名，根区域为 "root.zone"
+func exportZoneFile(zone string) string {
+	if zone == "" {
+		return "root.zone"
+	}
+	return zone + ".zone"
+}
+
+// ExportZones 将配置中每个静态区域经回复器签名后的全部记录以主文件格式写入目录
+// 其接受参数为：
+//   - conf Config，xdnsd 配置
+//   - responser xdns.Responser，由 Build 组装的回复器
+//   - dir string，输出目录，每个区域写入一个 <区域名>.zone 文件
+//   - w io.Writer，导出报告的输出
+func ExportZones(conf Config, responser xdns.Responser, dir string, w io.Writer) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("function ExportZones failed: %v", err)
+	}
+	for _, zConf := range conf.Zones {
+		zone := canonical(zConf.Name)
+		queries, err := exportZoneQueries(conf, zConf)
+		if err != nil {
+			return fmt.Errorf("function ExportZones failed: zone %s: %v", zConf.Name, err)
+		}
+		exporter := xdns.NewZoneExporter(xdns.ZoneExportConfig{
+			Zone:    zone,
+			Queries: queries,
+			DNSSEC:  conf.DNSSEC.Enabled,
+		}, responser)
+
+		path := filepath.Join(dir, exportZoneFile(zone))
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("function ExportZones failed: %v", err)
+		}
+		n, err := exporter.Export(context.Background(), file)
+		if cErr := file.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			return fmt.Errorf("function ExportZones failed: zone %s:\n%v", zConf.Name, err)
+		}
+		fmt.Fprintf(w, "export: %s: %d records written to %s\n", zConf.Name, n, path)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// inspect.go 文件定义了检视 API 所列出的攻击向量，其由配置中启用的实验模块及回复器组成。
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/tochusc/xdns"
+)
+
+// inspectSampleLimit 检视 API 默认保留的查询样本数量
+const inspectSampleLimit = 1000
+
+// attackVectors 返回配置中启用的实验模块及回复器，启用条件与 Build 一致
+func attackVectors(conf Config) []xdns.AttackVector {
+	vectors := []xdns.AttackVector{}
+	for _, m := range conf.Modules {
+		vectors = append(vectors, xdns.AttackVector{Name: m.Type, Zone: m.Zone, Options: m.Options})
+	}
+	add := func(name string, enabled bool, options interface{}) {
+		if !enabled {
+			return
+		}
+		data, _ := json.Marshal(options)
+		vectors = append(vectors, xdns.AttackVector{Name: name, Options: data})
+	}
+	add("rrsig_labels", conf.DNSSEC.Enabled && conf.DNSSEC.RRSIGLabels.Offset != 0, conf.DNSSEC.RRSIGLabels)
+	add("validity_jitter", conf.DNSSEC.Enabled && conf.DNSSEC.ValidityJitter != 0, conf.DNSSEC.ValidityJitter)
+	add("stream_framing", conf.Server.StreamFraming.Enabled(), conf.Server.StreamFraming)
+	add("coalesce", conf.Coalesce.Enabled, conf.Coalesce)
+	add("ordering", orderPolicies[conf.Ordering.Policy] != xdns.OrderPolicyFixed, conf.Ordering)
+	add("transport_split", len(conf.Split.Zones) > 0, conf.Split)
+	add("anycast", len(conf.Anycast.Identities) > 0, conf.Anycast)
+	add("phantom", len(conf.Phantom.Zones) > 0, conf.Phantom)
+	add("dual_stack", len(conf.DualStack.Zones) > 0, conf.DualStack)
+	add("late", len(conf.Late.Zones) > 0, conf.Late)
+	add("personality", len(conf.Personality.Static) > 0 || len(conf.Personality.Rotation) > 0, conf.Personality)
+	add("question_echo", len(conf.QuestionEcho.Mutations) > 0, conf.QuestionEcho)
+	add("duplicate", len(conf.Duplicate.Copies) > 0, conf.Duplicate)
+	add("outage", conf.Outage.ControlAddr != "" || len(conf.Outage.Windows) > 0, conf.Outage)
+	return vectors
+}
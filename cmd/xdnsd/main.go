@@ -0,0 +1,569 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// xdnsd 是一个由配置文件驱动的 xdns 服务器，
+// 其将静态区域、DNSSEC、实验模块、查询日志及统计快照组装为一个服务器，
+// 使得常见的实验无需再各自维护一份 main.go，便于打包为容器镜像部署。
+//
+// 用法：
+//
+//	xdnsd -config /etc/xdnsd.json
+//	xdnsd -config /etc/xdnsd.json -export-chain dot | dot -Tsvg > chain.svg
+//	xdnsd -config /etc/xdnsd.json -selftest
+//	xdnsd -config /etc/xdnsd.json -client-config
+//	xdnsd -config /etc/xdnsd.json -export-zones ./zones
+//
+// 配置文件格式详见 config.go 及 modules.go。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+func main() {
+	configPath := flag.String("config", "xdnsd.json", "path to the configuration file")
+	exportChain := flag.String("export-chain", "", "print the DNSSEC chain of trust as dot or json and exit")
+	exportZones := flag.String("export-zones", "", "write every static zone, signed as served, as a master file into the given directory and exit")
+	clientConf := flag.Bool("client-config", false, "print DNS stamps and resolver configuration snippets for the server and exit")
+	selfTest := flag.Bool("selftest", false, "verify the signatures of the configured zones before serving, exit on failure")
+	benchmark := flag.String("benchmark-algorithms", "", "benchmark every supported dnssec algorithm on the static zones, print a text or json report and exit")
+	benchmarkRounds := flag.Int("benchmark-rounds", 20, "number of timed query rounds per algorithm for -benchmark-algorithms")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "xdnsd: ", log.LstdFlags)
+	conf, err := LoadConfig(*configPath)
+	if err != nil {
+		logger.Fatalf("Error loading configuration: %v", err)
+	}
+
+	if *clientConf {
+		if err := ExportClientConf(conf, os.Stdout); err != nil {
+			logger.Fatalf("Error generating client configuration: %v", err)
+		}
+		return
+	}
+
+	if *benchmark != "" {
+		if err := BenchmarkAlgorithms(conf, *benchmarkRounds, *benchmark, os.Stdout); err != nil {
+			logger.Fatalf("Error benchmarking algorithms: %v", err)
+		}
+		return
+	}
+
+	if *exportChain != "" || *exportZones != "" {
+		// 导出信任链或区域时不记录查询，以免查询日志混入输出，也不启用检视 API 及管理监听器
+		conf.QueryLog.Path = ""
+		conf.Inspect.ListenAddr = ""
+		conf.Admin.ListenAddr = ""
+	}
+	responser, closers, err := Build(conf)
+	if err != nil {
+		logger.Fatalf("Error building server: %v", err)
+	}
+	if *exportChain != "" {
+		err := ExportChain(conf, responser, *exportChain, os.Stdout)
+		for _, c := range closers {
+			c.Close()
+		}
+		if err != nil {
+			logger.Fatalf("Error exporting chain of trust: %v", err)
+		}
+		return
+	}
+	if *exportZones != "" {
+		err := ExportZones(conf, responser, *exportZones, os.Stdout)
+		for _, c := range closers {
+			c.Close()
+		}
+		if err != nil {
+			logger.Fatalf("Error exporting zones: %v", err)
+		}
+		return
+	}
+	if *selfTest {
+		if err := SelfTest(conf, responser, os.Stdout); err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			logger.Fatalf("Self-test failed: %v", err)
+		}
+	}
+
+	var tracer *xdns.Tracer
+	if conf.Tracing.Endpoint != "" {
+		tracer = xdns.NewTracer(xdns.TracerConfig{
+			Endpoint:    conf.Tracing.Endpoint,
+			ServiceName: conf.Tracing.ServiceName,
+			LogWriter:   os.Stdout,
+		})
+	}
+
+	var snapshotter *xdns.StatsSnapshotter
+	if conf.Stats.Directory != "" {
+		stats := xdns.NewStatistics()
+		responser = &xdns.StatsResponser{Responser: responser, Stats: stats}
+		interval, _ := time.ParseDuration(conf.Stats.Interval)
+		snapshotter = xdns.NewStatsSnapshotter(xdns.StatsSnapshotterConfig{
+			Stats:     stats,
+			Directory: conf.Stats.Directory,
+			Interval:  interval,
+			Keep:      conf.Stats.Keep,
+			TopN:      conf.Stats.TopN,
+			LogWriter: os.Stdout,
+		})
+		snapshotter.Start()
+	}
+
+	if conf.Entropy.ListenAddr != "" {
+		limit := conf.Entropy.Limit
+		if limit == 0 {
+			limit = entropySampleLimit
+		}
+		analyzer := xdns.NewEntropyAnalyzer(limit)
+		responser = &xdns.EntropyResponser{Responser: responser, Analyzer: analyzer}
+		listener, err := net.Listen("tcp", conf.Entropy.ListenAddr)
+		if err != nil {
+			logger.Fatalf("Error listening for entropy reports: %v", err)
+		}
+		go http.Serve(listener, xdns.NewEntropyHandler(analyzer))
+	}
+
+	// 查询记录仅在收集遥测数据时启用，用于与解析器的资源采样进行关联
+	var timing *xdns.TimingRecorder
+	var telemetry *xdns.TelemetryCollector
+	if conf.Telemetry.ListenAddr != "" {
+		timing = xdns.NewTimingRecorder(telemetryTimingLimit)
+		telemetry = xdns.NewTelemetryCollector(conf.Telemetry.Run, timing)
+		listener, err := net.Listen("tcp", conf.Telemetry.ListenAddr)
+		if err != nil {
+			logger.Fatalf("Error listening for telemetry: %v", err)
+		}
+		go http.Serve(listener, xdns.NewTelemetryHandler(telemetry))
+	}
+
+	server := xdns.NewXdnsServer(xdns.ServerConfig{
+		IP:                  net.ParseIP(conf.Server.IP),
+		Port:                conf.Server.Port,
+		LogWriter:           os.Stdout,
+		EnableTCP:           conf.Server.EnableTCP,
+		TCPThreshold:        conf.Server.TCPThreshold,
+		EnforcePayloadSize:  conf.Server.EnforcePayloadSize,
+		EnableProxyProtocol: conf.Server.EnableProxyProtocol,
+		SocketActivation:    conf.Server.SocketActivation,
+		User:                conf.Server.User,
+		Group:               conf.Server.Group,
+		Tracer:              tracer,
+		DiagnosticsAddr:     conf.Server.DiagnosticsAddr,
+		ResponseMemoryLimit: conf.Server.ResponseMemoryLimit,
+		ResponseLimits:      xdns.ResponseLimits(conf.Server.ResponseLimits),
+		CostAccounting:      conf.Server.CostAccounting,
+		CostDebugTXT:        conf.Server.CostDebugTXT,
+		StreamFraming:       conf.Server.StreamFraming.StreamFraming(),
+		ReceiveAncillary:    conf.Server.ReceiveAncillary,
+		Timing:              timing,
+	}, responser)
+
+	// 收到终止信号时停止服务器，写入最后一份统计快照并关闭存储
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Printf("Received %v, shutting down.", sig)
+		server.Stop()
+	}()
+
+	server.Start()
+
+	if snapshotter != nil {
+		if err := snapshotter.Stop(); err != nil {
+			logger.Printf("Error writing final snapshot: %v", err)
+		}
+	}
+	if telemetry != nil && conf.Telemetry.ReportPath != "" {
+		if err := writeTelemetryReport(telemetry.Report(), conf.Telemetry.ReportPath); err != nil {
+			logger.Printf("Error writing telemetry report: %v", err)
+		}
+	}
+	if tracer != nil {
+		tracer.Close()
+	}
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// telemetryTimingLimit 收集遥测数据时每个客户端保留的查询记录数量
+const telemetryTimingLimit = 1 << 20
+
+// entropySampleLimit 熵分析时每个客户端默认保留的样本数量
+const entropySampleLimit = 1 << 16
+
+// writeTelemetryReport 将关联报告写入文件，路径以 ".csv" 结尾时为 CSV 格式，否则为 JSON 格式
+func writeTelemetryReport(report xdns.TelemetryReport, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".csv") {
+		return report.WriteCSV(f)
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// closerFunc 将无返回值的停止函数适配为 io.Closer
+type closerFunc func()
+
+// Close 调用停止函数
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
+
+// Build 根据配置构建服务器的回复器
+// 返回值为：
+//   - xdns.Responser，回复器
+//   - []io.Closer，退出时需要关闭的资源
+//   - error，错误信息
+func Build(conf Config) (xdns.Responser, []io.Closer, error) {
+	closers := []io.Closer{}
+
+	if conf.Seed != 0 {
+		xperi.Seed(conf.Seed)
+	}
+
+	var dConf *xdns.DNSSECConfig
+	if conf.DNSSEC.Enabled {
+		validity := conf.DNSSEC.Validity
+		if validity == 0 {
+			validity = xdns.DefaultValidityPeriod
+		}
+		dConf = &xdns.DNSSECConfig{
+			Algo: dns.DNSSECAlgorithm(conf.DNSSEC.Algorithm),
+			Type: dns.DNSSECDigestType(conf.DNSSEC.DigestType),
+			Validity: xdns.SignatureValidity{
+				Mode:             xdns.ValidityRelative,
+				ExpirationOffset: int64(validity),
+				Jitter:           int64(conf.DNSSEC.ValidityJitter),
+			},
+			KeyParams: conf.DNSSEC.KeyParams,
+			Labels: xdns.RRSIGLabels{
+				Offset:      conf.DNSSEC.RRSIGLabels.Offset,
+				Reconstruct: conf.DNSSEC.RRSIGLabels.Reconstruct,
+			},
+		}
+		for _, t := range conf.DNSSEC.RRSIGLabels.Types {
+			rrType, _ := ParseType(t)
+			dConf.Labels.Types = append(dConf.Labels.Types, rrType)
+		}
+		if len(conf.DNSSEC.ZoneCuts) > 0 {
+			dConf.ZoneCuts = xdns.NewZoneCuts(conf.DNSSEC.ZoneCuts...)
+			dConf.ChildSideDS = conf.DNSSEC.ChildSideDS
+		}
+		if conf.DNSSEC.ResignWindow != "" {
+			window, _ := time.ParseDuration(conf.DNSSEC.ResignWindow)
+			jitter, _ := time.ParseDuration(conf.DNSSEC.ResignJitter)
+			dConf.Signatures = xdns.NewSignatureCache()
+			resigner := xdns.NewResigner(xdns.ResignerConfig{
+				Cache:         dConf.Signatures,
+				RefreshWindow: window,
+				Jitter:        jitter,
+				LogWriter:     os.Stdout,
+			})
+			resigner.Start()
+			closers = append(closers, closerFunc(resigner.Stop))
+		}
+	}
+
+	router := &Router{Classes: xdns.NewQueryClassCache(xdns.DefaultQueryClassCapacity)}
+	materials := &sync.Map{}
+	// 仪表盘的流量统计及攻击参数控制，仅在启用管理监听器时使用
+	var meter *xdns.TrafficMeter
+	controls := []xdns.DashboardControl{}
+	var inspector *xdns.Inspector
+	if conf.Inspect.ListenAddr != "" || conf.Admin.ListenAddr != "" {
+		limit := conf.Inspect.Samples
+		if limit == 0 {
+			limit = inspectSampleLimit
+		}
+		inspector = &xdns.Inspector{
+			Materials: materials,
+			DNSSEC:    dConf,
+			Vectors:   attackVectors(conf),
+			Sampler:   xdns.NewQuerySampler(limit),
+		}
+	}
+	for _, zConf := range conf.Zones {
+		zone, err := NewZoneResponser(zConf, dConf, materials)
+		if err != nil {
+			return nil, closers, err
+		}
+		closers = append(closers, zone.Store)
+		if inspector != nil {
+			inspector.AddZone(zone.Zone, zone.Store)
+		}
+		router.Handle(zConf.Name, zone, map[string]interface{}{"xdns.module": "zone"})
+	}
+	for _, mConf := range conf.Modules {
+		module, err := NewModule(mConf, dConf)
+		if err != nil {
+			return nil, closers, err
+		}
+		if closer, ok := module.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+		if mConf.AllowOverrun {
+			module = &xdns.OverrunResponser{Responser: module}
+		}
+		router.HandleMatch(mConf.Zone, mConf.Match.RouteMatcher(), module, map[string]interface{}{
+			"xdns.module":         mConf.Type,
+			"xdns.module.options": string(mConf.Options),
+		})
+	}
+
+	var responser xdns.Responser = router
+	// 合并位于查询日志之内，被合并的查询仍会各自记录
+	if conf.Coalesce.Enabled {
+		scope := xdns.CoalesceByClient
+		if conf.Coalesce.Global {
+			scope = xdns.CoalesceGlobal
+		}
+		responser = &xdns.CoalescingResponser{Responser: responser, Scope: scope}
+	}
+	// 排序位于合并之外，使得被合并的查询同样按各自的次序轮转
+	if policy := orderPolicies[conf.Ordering.Policy]; policy != xdns.OrderPolicyFixed {
+		types := []dns.DNSType{}
+		for _, t := range conf.Ordering.Types {
+			rrType, _ := ParseType(t)
+			types = append(types, rrType)
+		}
+		responser = &xdns.OrderingResponser{Responser: responser, Policy: policy, Types: types}
+	}
+	// 传输差异位于停服之内，停服时的查询不再区分传输协议
+	if len(conf.Split.Zones) > 0 {
+		split := &xdns.TransportSplitResponser{Responser: responser}
+		for _, zone := range conf.Split.Zones {
+			split.Enable(zone)
+		}
+		controls = append(controls, xdns.TransportSplitControl(split))
+		responser = split
+	}
+	// 任播模拟位于停服之内，停服时的查询不再经历身份的延迟
+	if len(conf.Anycast.Identities) > 0 {
+		anycast := &xdns.AnycastResponser{Responser: responser}
+		for _, id := range conf.Anycast.Identities {
+			latency, _ := time.ParseDuration(id.Latency)
+			anycast.Identities = append(anycast.Identities, xdns.AnycastIdentity{
+				Name:      id.Name,
+				NSID:      id.NSID,
+				MName:     id.MName,
+				Latency:   latency,
+				Listeners: id.Listeners,
+			})
+		}
+		responser = anycast
+	}
+	// 幻影域同样位于停服之内，停服时的查询不再经历延迟
+	if len(conf.Phantom.Zones) > 0 {
+		minDelay, _ := time.ParseDuration(conf.Phantom.MinDelay)
+		maxDelay, _ := time.ParseDuration(conf.Phantom.MaxDelay)
+		meanDelay, _ := time.ParseDuration(conf.Phantom.MeanDelay)
+		responser = &xdns.PhantomResponser{
+			Responser:    responser,
+			Zones:        conf.Phantom.Zones,
+			AnswerRatio:  conf.Phantom.AnswerRatio,
+			Distribution: phantomDistributions[conf.Phantom.Distribution],
+			MinDelay:     minDelay,
+			MaxDelay:     maxDelay,
+			MeanDelay:    meanDelay,
+		}
+	}
+	// 双栈回复位于迟到回复之内，两者的延迟相互叠加
+	if len(conf.DualStack.Zones) > 0 {
+		dualStack := &xdns.DualStackResponser{
+			Responser: responser,
+			Zones:     conf.DualStack.Zones,
+			A:         conf.DualStack.A.FamilyPolicy(),
+			AAAA:      conf.DualStack.AAAA.FamilyPolicy(),
+		}
+		dualStack.PairWindow, _ = time.ParseDuration(conf.DualStack.PairWindow)
+		responser = dualStack
+	}
+	// 迟到回复位于人格之内，各人格的回复均被延迟
+	if len(conf.Late.Zones) > 0 {
+		late := &xdns.LateResponser{Responser: responser, Zones: conf.Late.Zones}
+		late.Delay, _ = time.ParseDuration(conf.Late.Delay)
+		late.HoldWindow, _ = time.ParseDuration(conf.Late.HoldWindow)
+		responser = late
+	}
+	// 人格位于停服之内，停服时的查询不再经历缓慢人格的延迟
+	if len(conf.Personality.Static) > 0 || len(conf.Personality.Rotation) > 0 {
+		personality := &xdns.PersonalityResponser{Responser: responser, Epoch: time.Now()}
+		for _, a := range conf.Personality.Static {
+			_, prefix, _ := net.ParseCIDR(a.Prefix)
+			personality.Static = append(personality.Static, xdns.PersonalityAssignment{
+				Prefix:      prefix,
+				Personality: personalities[a.Personality],
+			})
+		}
+		for _, name := range conf.Personality.Rotation {
+			personality.Rotation = append(personality.Rotation, personalities[name])
+		}
+		personality.Period, _ = time.ParseDuration(conf.Personality.Period)
+		personality.SlowDelay, _ = time.ParseDuration(conf.Personality.SlowDelay)
+		responser = personality
+	}
+	// 问题回显变异位于人格之外，缓慢人格的回复同样得到变异，重试的查询也会被其观察到
+	if len(conf.QuestionEcho.Mutations) > 0 {
+		echo := &xdns.QuestionEchoResponser{Responser: responser, Label: conf.QuestionEcho.Label}
+		for _, name := range conf.QuestionEcho.Mutations {
+			echo.Mutations = append(echo.Mutations, questionMutations[name])
+		}
+		echo.RetryWindow, _ = time.ParseDuration(conf.QuestionEcho.RetryWindow)
+		responser = echo
+	}
+	// 副本位于问题回显变异之外，副本与原回复回显相同的问题
+	if len(conf.Duplicate.Copies) > 0 {
+		duplicate := &xdns.DuplicateResponser{
+			Responser:  responser,
+			After:      conf.Duplicate.After,
+			ConflictIP: net.ParseIP(conf.Duplicate.ConflictIP),
+		}
+		for _, name := range conf.Duplicate.Copies {
+			duplicate.Copies = append(duplicate.Copies, duplicateVariations[name])
+		}
+		duplicate.Interval, _ = time.ParseDuration(conf.Duplicate.Interval)
+		responser = duplicate
+	}
+	// 停服位于查询日志之内，被丢弃的查询仍会被记录
+	if conf.Outage.ControlAddr != "" || len(conf.Outage.Windows) > 0 {
+		outage := &xdns.OutageResponser{Responser: responser}
+		now := time.Now()
+		for _, w := range conf.Outage.Windows {
+			after, _ := time.ParseDuration(w.After)
+			duration, _ := time.ParseDuration(w.Duration)
+			outage.Schedule(xdns.OutageWindow{
+				Zone:  w.Zone,
+				Start: now.Add(after),
+				End:   now.Add(after + duration),
+			})
+		}
+		if conf.Outage.ControlAddr != "" {
+			listener, err := net.Listen("tcp", conf.Outage.ControlAddr)
+			if err != nil {
+				return nil, closers, err
+			}
+			control := &http.Server{Handler: xdns.NewOutageHandler(outage)}
+			closers = append(closers, control)
+			go control.Serve(listener)
+		}
+		controls = append(controls, xdns.OutageControl(outage))
+		responser = outage
+	}
+	if conf.QueryLog.Path != "" {
+		var w io.Writer = os.Stdout
+		if conf.QueryLog.Path != "-" {
+			f, err := os.OpenFile(conf.QueryLog.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, closers, err
+			}
+			closers = append(closers, f)
+			w = f
+		}
+		responser = &xdns.QueryLogResponser{
+			Responser: responser,
+			Writer:    w,
+			Config: xdns.QueryLogConfig{
+				PrintTime:     conf.QueryLog.PrintTime,
+				PrintCategory: conf.QueryLog.PrintCategory,
+				PrintSeverity: conf.QueryLog.PrintSeverity,
+			},
+		}
+	}
+	// 采样位于查询日志之外，并先于 DoH 服务包装，使经由 DoH 的查询同样被采样
+	if inspector != nil {
+		if conf.Admin.ListenAddr != "" {
+			meter = xdns.NewTrafficMeter(xdns.DefaultTrafficWindow)
+		}
+		responser = &xdns.SamplingResponser{Responser: responser, Sampler: inspector.Sampler, Meter: meter}
+	}
+	if conf.Inspect.ListenAddr != "" {
+		listener, err := net.Listen("tcp", conf.Inspect.ListenAddr)
+		if err != nil {
+			return nil, closers, err
+		}
+		inspect := &http.Server{Handler: xdns.NewInspectionHandler(inspector)}
+		closers = append(closers, inspect)
+		go inspect.Serve(listener)
+	}
+	if conf.Admin.ListenAddr != "" {
+		listener, err := net.Listen("tcp", conf.Admin.ListenAddr)
+		if err != nil {
+			return nil, closers, err
+		}
+		admin := &http.Server{Handler: xdns.NewDashboardHandler(&xdns.Dashboard{
+			Inspector: inspector,
+			Meter:     meter,
+			Controls:  controls,
+		})}
+		closers = append(closers, admin)
+		go admin.Serve(listener)
+	}
+	if conf.DoH.ListenAddr != "" {
+		listener, err := net.Listen("tcp", conf.DoH.ListenAddr)
+		if err != nil {
+			return nil, closers, err
+		}
+		doh := &http.Server{Handler: xdns.NewDoHHandler(responser)}
+		closers = append(closers, doh)
+		if conf.DoH.CertFile != "" {
+			go doh.ServeTLS(listener, conf.DoH.CertFile, conf.DoH.KeyFile)
+		} else {
+			go doh.Serve(listener)
+		}
+	}
+	if len(conf.MDNS.Records) > 0 {
+		mConf := xdns.MDNSConfig{LogWriter: os.Stdout}
+		if conf.MDNS.Interface != "" {
+			ifi, err := net.InterfaceByName(conf.MDNS.Interface)
+			if err != nil {
+				return nil, closers, err
+			}
+			mConf.Interface = ifi
+		}
+		shared := map[dns.DNSType]bool{}
+		for _, t := range conf.MDNS.SharedTypes {
+			rrType, _ := ParseType(t)
+			shared[rrType] = true
+		}
+		for _, rConf := range conf.MDNS.Records {
+			rr, err := ParseRecord(rConf)
+			if err != nil {
+				return nil, closers, err
+			}
+			mConf.Records = append(mConf.Records, xdns.MDNSRecord{RR: rr, Shared: shared[rr.Type]})
+		}
+		mdns := xdns.NewMDNSServer(mConf)
+		if err := mdns.Start(); err != nil {
+			return nil, closers, err
+		}
+		closers = append(closers, mdns)
+	}
+	return responser, closers, nil
+}
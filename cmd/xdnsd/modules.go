@@ -0,0 +1,590 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// modules.go 文件根据配置构建实验模块的回复器。
+// 每个模块的 options 字段对应一个 JSON 对象：
+//
+//	"chain":           {"zones": [...], "length": 8, "branching": 1, "cycle": false, "cycle_to": 0,
+//	                    "dname": false, "full": false, "address": "10.0.0.1", "ttl": 60}
+//	"aggressive-nsec": {"names": [...], "mode": "exact" | "overlapping" | "contradictory",
+//	                    "address": "10.0.0.1", "ttl": 60}
+//	"nsec3":           {"names": [...], "iterations": 0, "salt": "aabbccdd", "opt_out": false,
+//	                    "address": "10.0.0.1", "ttl": 60}
+//	"referral":        {"delegations": [{"child": "...", "name_servers": [...],
+//	                    "glue": {"ns.example": ["10.0.0.1"]}, "out_of_bailiwick_glue": false}], "ttl": 60}
+//	"proxy":           {"upstream": "8.8.8.8:53", "timeout": "5s", "rules": [{"zone": "...",
+//	                    "strip_rrsig": false, "max_ttl": 0, "replace_a": "10.0.0.1", "replace_aaaa": "",
+//	                    "inject_additional": [{"name": "...", "type": "A", "ttl": 60, "data": "10.0.0.1"}]}]}
+//	"misconfig":       {"role": "parent" | "child" | "auto", "delegations": [{"child": "...", "name_servers": [...],
+//	                    "address": "10.0.0.1", "lame": false, "missing_glue": false, "ns_cname": false,
+//	                    "ns_mismatch": false, "expired_ds": false, "missing_ds": false, "mismatched_ds": false}],
+//	                    "trust_anchor_file": "islands.ds", "ttl": 60}
+//	"referral-loop":   {"zones": [...], "length": 4, "addresses": ["10.0.0.1"], "ttl": 60}
+//	"nxns":            {"victims": [...], "fanout": 100, "lab_prefixes": ["10.0.0.0/16"],
+//	                    "lab_zones": ["test"], "ttl": 60}
+//	"script":          {"path": "hook.star", "timeout": "2s"}
+//	"secondary":       {"primary": "10.0.0.1:53", "store": "memory", "refresh": "", "retry": "", "timeout": "5s",
+//	                    "disable_ixfr": false, "rules": [{"name": "...", "strip_rrsig": false, "remove_types": ["DS"],
+//	                    "max_ttl": 0, "replace_a": "10.0.0.1", "replace_aaaa": "",
+//	                    "add": [{"name": "...", "type": "TXT", "ttl": 60, "data": "\"tampered\""}]}]}
+//	"validity-sweep":  {"steps": [{"name": "...", "inception_offset": 60, "expiration_offset": 86400}],
+//	                    "address": "10.0.0.1", "ttl": 60}
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/tochusc/xdns"
+)
+
+// chainOptions 记录 chain 模块的参数
+type chainOptions struct {
+	Zones     []string `json:"zones"`
+	Length    int      `json:"length"`
+	Branching int      `json:"branching"`
+	Cycle     bool     `json:"cycle"`
+	CycleTo   int      `json:"cycle_to"`
+	DNAME     bool     `json:"dname"`
+	Full      bool     `json:"full"`
+	Address   string   `json:"address"`
+	TTL       uint32   `json:"ttl"`
+}
+
+// aggressiveNSECOptions 记录 aggressive-nsec 模块的参数
+type aggressiveNSECOptions struct {
+	Names   []string `json:"names"`
+	Mode    string   `json:"mode"`
+	Address string   `json:"address"`
+	TTL     uint32   `json:"ttl"`
+}
+
+// nsec3Options 记录 nsec3 模块的参数
+type nsec3Options struct {
+	Names      []string `json:"names"`
+	Iterations uint16   `json:"iterations"`
+	Salt       string   `json:"salt"`
+	OptOut     bool     `json:"opt_out"`
+	Address    string   `json:"address"`
+	TTL        uint32   `json:"ttl"`
+}
+
+// delegationOptions 记录 referral 模块中的一个委派
+type delegationOptions struct {
+	Child              string              `json:"child"`
+	NameServers        []string            `json:"name_servers"`
+	Glue               map[string][]string `json:"glue"`
+	OutOfBailiwickGlue bool                `json:"out_of_bailiwick_glue"`
+}
+
+// referralOptions 记录 referral 模块的参数
+type referralOptions struct {
+	Delegations []delegationOptions `json:"delegations"`
+	TTL         uint32              `json:"ttl"`
+}
+
+// proxyRuleOptions 记录 proxy 模块中的一条变换规则
+type proxyRuleOptions struct {
+	Zone             string          `json:"zone"`
+	StripRRSIG       bool            `json:"strip_rrsig"`
+	MaxTTL           uint32          `json:"max_ttl"`
+	ReplaceA         string          `json:"replace_a"`
+	ReplaceAAAA      string          `json:"replace_aaaa"`
+	InjectAdditional []RecordSection `json:"inject_additional"`
+}
+
+// proxyOptions 记录 proxy 模块的参数
+type proxyOptions struct {
+	Upstream string             `json:"upstream"`
+	Timeout  string             `json:"timeout"`
+	Rules    []proxyRuleOptions `json:"rules"`
+}
+
+// misconfigDelegationOptions 记录 misconfig 模块中的一个委派
+type misconfigDelegationOptions struct {
+	Child        string   `json:"child"`
+	NameServers  []string `json:"name_servers"`
+	Address      string   `json:"address"`
+	Lame         bool     `json:"lame"`
+	MissingGlue  bool     `json:"missing_glue"`
+	NSCNAME      bool     `json:"ns_cname"`
+	NSMismatch   bool     `json:"ns_mismatch"`
+	ExpiredDS    bool     `json:"expired_ds"`
+	MissingDS    bool     `json:"missing_ds"`
+	MismatchedDS bool     `json:"mismatched_ds"`
+}
+
+// misconfigOptions 记录 misconfig 模块的参数
+type misconfigOptions struct {
+	Role        string                       `json:"role"`
+	Delegations []misconfigDelegationOptions `json:"delegations"`
+	// 信任孤岛的信任锚写入的文件，为空时不写入
+	TrustAnchorFile string `json:"trust_anchor_file"`
+	TTL             uint32 `json:"ttl"`
+}
+
+// misconfigRoles 回复身份名称与其取值的映射
+var misconfigRoles = map[string]xdns.MisconfigRole{
+	"":       xdns.MisconfigRoleParent,
+	"parent": xdns.MisconfigRoleParent,
+	"child":  xdns.MisconfigRoleChild,
+	"auto":   xdns.MisconfigRoleAuto,
+}
+
+// referralLoopOptions 记录 referral-loop 模块的参数
+type referralLoopOptions struct {
+	Zones     []string `json:"zones"`
+	Length    int      `json:"length"`
+	Addresses []string `json:"addresses"`
+	TTL       uint32   `json:"ttl"`
+}
+
+// nxnsOptions 记录 nxns 模块的参数
+type nxnsOptions struct {
+	Victims     []string `json:"victims"`
+	Fanout      int      `json:"fanout"`
+	LabPrefixes []string `json:"lab_prefixes"`
+	LabZones    []string `json:"lab_zones"`
+	TTL         uint32   `json:"ttl"`
+}
+
+// scriptOptions 记录 script 模块的参数
+type scriptOptions struct {
+	// Starlark 脚本文件路径，脚本须定义 respond(query) 函数，详见 xdns.ScriptResponser
+	Path    string `json:"path"`
+	Timeout string `json:"timeout"`
+}
+
+// secondaryRuleOptions 记录 secondary 模块中的一条变异规则
+type secondaryRuleOptions struct {
+	Name        string          `json:"name"`
+	StripRRSIG  bool            `json:"strip_rrsig"`
+	RemoveTypes []string        `json:"remove_types"`
+	MaxTTL      uint32          `json:"max_ttl"`
+	ReplaceA    string          `json:"replace_a"`
+	ReplaceAAAA string          `json:"replace_aaaa"`
+	Add         []RecordSection `json:"add"`
+}
+
+// secondaryOptions 记录 secondary 模块的参数，模块的区域即为从主服务器传送的区域
+type secondaryOptions struct {
+	Primary string `json:"primary"`
+	// 存储后端，格式同静态区域
+	Store       string                 `json:"store"`
+	Refresh     string                 `json:"refresh"`
+	Retry       string                 `json:"retry"`
+	Timeout     string                 `json:"timeout"`
+	DisableIXFR bool                   `json:"disable_ixfr"`
+	Rules       []secondaryRuleOptions `json:"rules"`
+}
+
+// validitySweepOptions 记录 validity-sweep 模块的参数，steps 为空时使用默认的扫描步骤
+type validitySweepOptions struct {
+	Steps   []xdns.ValiditySweepStep `json:"steps"`
+	Address string                   `json:"address"`
+	TTL     uint32                   `json:"ttl"`
+}
+
+// nsecRangeModes NSEC 区间生成方式名称与其取值的映射
+var nsecRangeModes = map[string]xdns.NSECRangeMode{
+	"":              xdns.NSECRangeExact,
+	"exact":         xdns.NSECRangeExact,
+	"overlapping":   xdns.NSECRangeOverlapping,
+	"contradictory": xdns.NSECRangeContradictory,
+}
+
+// NewModule 根据配置构建实验模块的回复器
+// 其接受参数为：
+//   - mConf ModuleSection，模块配置
+//   - dConf *xdns.DNSSECConfig，DNSSEC 配置，为 nil 时不启用 DNSSEC
+//
+// 返回值为：
+//   - xdns.Responser，模块的回复器
+//   - error，错误信息
+func NewModule(mConf ModuleSection, dConf *xdns.DNSSECConfig) (xdns.Responser, error) {
+	decode := func(v interface{}) error {
+		if len(mConf.Options) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(mConf.Options, v); err != nil {
+			return fmt.Errorf("function NewModule failed: parse options of %s module failed.\n%v", mConf.Type, err)
+		}
+		return nil
+	}
+
+	switch mConf.Type {
+	case "chain":
+		opts := chainOptions{Length: 8, TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		if len(opts.Zones) == 0 {
+			opts.Zones = []string{mConf.Zone}
+		}
+		mode := xdns.ChainModeStep
+		if opts.Full {
+			mode = xdns.ChainModeFull
+		}
+		return &xdns.ChainResponser{
+			Generator: xdns.NewChainGenerator(xdns.ChainConfig{
+				Zones:     opts.Zones,
+				Length:    opts.Length,
+				Branching: opts.Branching,
+				Cycle:     opts.Cycle,
+				CycleTo:   opts.CycleTo,
+				DNAME:     opts.DNAME,
+				Mode:      mode,
+				Address:   net.ParseIP(opts.Address),
+				TTL:       opts.TTL,
+			}),
+		}, nil
+
+	case "aggressive-nsec":
+		opts := aggressiveNSECOptions{TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		mode, ok := nsecRangeModes[opts.Mode]
+		if !ok {
+			return nil, fmt.Errorf("function NewModule failed: unknown NSEC range mode %q", opts.Mode)
+		}
+		if dConf == nil {
+			return nil, fmt.Errorf("function NewModule failed: aggressive-nsec module requires dnssec")
+		}
+		return xdns.NewAggressiveNSECResponser(xdns.AggressiveNSECConfig{
+			Zone:     mConf.Zone,
+			Names:    opts.Names,
+			Mode:     mode,
+			ServerIP: net.ParseIP(opts.Address),
+			TTL:      opts.TTL,
+			DNSSEC:   *dConf,
+		}), nil
+
+	case "nsec3":
+		opts := nsec3Options{TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		salt, err := hex.DecodeString(opts.Salt)
+		if err != nil || len(salt) > 255 {
+			return nil, fmt.Errorf("function NewModule failed: invalid NSEC3 salt %q", opts.Salt)
+		}
+		if dConf == nil {
+			return nil, fmt.Errorf("function NewModule failed: nsec3 module requires dnssec")
+		}
+		return xdns.NewNSEC3Responser(xdns.NSEC3Config{
+			Zone:       mConf.Zone,
+			Names:      opts.Names,
+			Iterations: opts.Iterations,
+			Salt:       salt,
+			OptOut:     opts.OptOut,
+			ServerIP:   net.ParseIP(opts.Address),
+			TTL:        opts.TTL,
+			DNSSEC:     *dConf,
+		}), nil
+
+	case "referral":
+		opts := referralOptions{TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		delegations := []xdns.Delegation{}
+		for _, d := range opts.Delegations {
+			glue := map[string][]net.IP{}
+			for ns, addrs := range d.Glue {
+				for _, addr := range addrs {
+					ip := net.ParseIP(addr)
+					if ip == nil {
+						return nil, fmt.Errorf("function NewModule failed: invalid glue address %q", addr)
+					}
+					glue[ns] = append(glue[ns], ip)
+				}
+			}
+			delegations = append(delegations, xdns.Delegation{
+				Child:              d.Child,
+				NameServers:        d.NameServers,
+				Glue:               glue,
+				OutOfBailiwickGlue: d.OutOfBailiwickGlue,
+			})
+		}
+		return &xdns.ReferralResponser{
+			Builder: xdns.NewReferralBuilder(xdns.ReferralBuilderConfig{
+				Zone:        mConf.Zone,
+				Delegations: delegations,
+				TTL:         opts.TTL,
+				DNSSEC:      dConf,
+			}),
+		}, nil
+
+	case "proxy":
+		opts := proxyOptions{}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		if opts.Upstream == "" {
+			return nil, fmt.Errorf("function NewModule failed: proxy module requires upstream")
+		}
+		var timeout time.Duration
+		if opts.Timeout != "" {
+			d, err := time.ParseDuration(opts.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("function NewModule failed: invalid proxy timeout %q", opts.Timeout)
+			}
+			timeout = d
+		}
+		rules := []xdns.ProxyRule{}
+		for _, r := range opts.Rules {
+			rule := xdns.ProxyRule{
+				Zone:       r.Zone,
+				StripRRSIG: r.StripRRSIG,
+				MaxTTL:     r.MaxTTL,
+			}
+			if r.ReplaceA != "" {
+				if rule.ReplaceA = net.ParseIP(r.ReplaceA).To4(); rule.ReplaceA == nil {
+					return nil, fmt.Errorf("function NewModule failed: invalid proxy replace_a %q", r.ReplaceA)
+				}
+			}
+			if r.ReplaceAAAA != "" {
+				if rule.ReplaceAAAA = net.ParseIP(r.ReplaceAAAA); rule.ReplaceAAAA == nil {
+					return nil, fmt.Errorf("function NewModule failed: invalid proxy replace_aaaa %q", r.ReplaceAAAA)
+				}
+			}
+			for _, rConf := range r.InjectAdditional {
+				rr, err := ParseRecord(rConf)
+				if err != nil {
+					return nil, fmt.Errorf("function NewModule failed: proxy inject_additional: %v", err)
+				}
+				rule.InjectAdditional = append(rule.InjectAdditional, rr)
+			}
+			rules = append(rules, rule)
+		}
+		return xdns.NewProxyResponser(xdns.ProxyConfig{
+			Upstream:  opts.Upstream,
+			Timeout:   timeout,
+			Rules:     rules,
+			LogWriter: os.Stdout,
+		}), nil
+
+	case "misconfig":
+		opts := misconfigOptions{TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		role, ok := misconfigRoles[opts.Role]
+		if !ok {
+			return nil, fmt.Errorf("function NewModule failed: unknown misconfig role %q", opts.Role)
+		}
+		delegations := []xdns.MisconfigDelegation{}
+		for _, d := range opts.Delegations {
+			var addr net.IP
+			if d.Address != "" {
+				if addr = net.ParseIP(d.Address); addr == nil {
+					return nil, fmt.Errorf("function NewModule failed: invalid misconfig address %q", d.Address)
+				}
+			}
+			delegations = append(delegations, xdns.MisconfigDelegation{
+				Child:        d.Child,
+				NameServers:  d.NameServers,
+				Address:      addr,
+				Lame:         d.Lame,
+				MissingGlue:  d.MissingGlue,
+				NSCNAME:      d.NSCNAME,
+				NSMismatch:   d.NSMismatch,
+				ExpiredDS:    d.ExpiredDS,
+				MissingDS:    d.MissingDS,
+				MismatchedDS: d.MismatchedDS,
+			})
+		}
+		misconfig := xdns.NewMisconfigResponser(xdns.MisconfigConfig{
+			Zone:        mConf.Zone,
+			Delegations: delegations,
+			Role:        role,
+			TTL:         opts.TTL,
+			DNSSEC:      dConf,
+		})
+		if opts.TrustAnchorFile != "" {
+			if dConf == nil {
+				return nil, fmt.Errorf("function NewModule failed: misconfig trust_anchor_file requires dnssec")
+			}
+			file, err := os.Create(opts.TrustAnchorFile)
+			if err != nil {
+				return nil, fmt.Errorf("function NewModule failed: create trust anchor file failed.\n%v", err)
+			}
+			err = misconfig.WriteTrustAnchors(file)
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, fmt.Errorf("function NewModule failed: write trust anchor file failed.\n%v", err)
+			}
+		}
+		return misconfig, nil
+
+	case "referral-loop":
+		opts := referralLoopOptions{Length: 4, TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		if len(opts.Zones) == 0 {
+			opts.Zones = []string{mConf.Zone}
+		}
+		addrs := []net.IP{}
+		for _, addr := range opts.Addresses {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("function NewModule failed: invalid referral-loop address %q", addr)
+			}
+			addrs = append(addrs, ip)
+		}
+		return &xdns.ReferralLoopResponser{
+			Generator: xdns.NewReferralLoopGenerator(xdns.ReferralLoopConfig{
+				Zones:     opts.Zones,
+				Length:    opts.Length,
+				Addresses: addrs,
+				TTL:       opts.TTL,
+			}),
+		}, nil
+
+	case "nxns":
+		opts := nxnsOptions{Fanout: 100, TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		prefixes := []*net.IPNet{}
+		for _, cidr := range opts.LabPrefixes {
+			_, prefix, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("function NewModule failed: invalid nxns lab prefix %q", cidr)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		g, err := xdns.NewNXNSGenerator(xdns.NXNSConfig{
+			Zone:        mConf.Zone,
+			Victims:     opts.Victims,
+			Fanout:      opts.Fanout,
+			LabPrefixes: prefixes,
+			LabZones:    opts.LabZones,
+			TTL:         opts.TTL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("function NewModule failed: %v", err)
+		}
+		return &xdns.NXNSResponser{Generator: g}, nil
+
+	case "script":
+		opts := scriptOptions{}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		timeout, err := time.ParseDuration(opts.Timeout)
+		if opts.Timeout != "" && err != nil {
+			return nil, fmt.Errorf("function NewModule failed: invalid script timeout %q", opts.Timeout)
+		}
+		r, err := xdns.NewScriptResponser(xdns.ScriptConfig{
+			Path:      opts.Path,
+			Timeout:   timeout,
+			DNSSEC:    dConf,
+			LogWriter: os.Stdout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("function NewModule failed: %v", err)
+		}
+		return r, nil
+
+	case "secondary":
+		opts := secondaryOptions{}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		if opts.Primary == "" {
+			return nil, fmt.Errorf("function NewModule failed: secondary module requires primary")
+		}
+		var refresh, retry, timeout time.Duration
+		for _, d := range []struct {
+			name  string
+			value string
+			out   *time.Duration
+		}{{"refresh", opts.Refresh, &refresh}, {"retry", opts.Retry, &retry}, {"timeout", opts.Timeout, &timeout}} {
+			if d.value == "" {
+				continue
+			}
+			v, err := time.ParseDuration(d.value)
+			if err != nil || v <= 0 {
+				return nil, fmt.Errorf("function NewModule failed: invalid secondary %s %q", d.name, d.value)
+			}
+			*d.out = v
+		}
+		rules := []xdns.SecondaryRule{}
+		for _, r := range opts.Rules {
+			rule := xdns.SecondaryRule{
+				Name:       r.Name,
+				StripRRSIG: r.StripRRSIG,
+				MaxTTL:     r.MaxTTL,
+			}
+			for _, t := range r.RemoveTypes {
+				rrType, err := ParseType(t)
+				if err != nil {
+					return nil, fmt.Errorf("function NewModule failed: secondary remove_types: %v", err)
+				}
+				rule.RemoveTypes = append(rule.RemoveTypes, rrType)
+			}
+			if r.ReplaceA != "" {
+				if rule.ReplaceA = net.ParseIP(r.ReplaceA).To4(); rule.ReplaceA == nil {
+					return nil, fmt.Errorf("function NewModule failed: invalid secondary replace_a %q", r.ReplaceA)
+				}
+			}
+			if r.ReplaceAAAA != "" {
+				if rule.ReplaceAAAA = net.ParseIP(r.ReplaceAAAA); rule.ReplaceAAAA == nil {
+					return nil, fmt.Errorf("function NewModule failed: invalid secondary replace_aaaa %q", r.ReplaceAAAA)
+				}
+			}
+			for _, rConf := range r.Add {
+				rr, err := ParseRecord(rConf)
+				if err != nil {
+					return nil, fmt.Errorf("function NewModule failed: secondary add: %v", err)
+				}
+				rule.Add = append(rule.Add, rr)
+			}
+			rules = append(rules, rule)
+		}
+		zs, err := openStore(opts.Store)
+		if err != nil {
+			return nil, fmt.Errorf("function NewModule failed: %v", err)
+		}
+		zone := xdns.NewSecondaryZone(xdns.SecondaryConfig{
+			Zone:        mConf.Zone,
+			Primary:     opts.Primary,
+			Store:       zs,
+			Rules:       rules,
+			Refresh:     refresh,
+			Retry:       retry,
+			DisableIXFR: opts.DisableIXFR,
+			Timeout:     timeout,
+			LogWriter:   os.Stdout,
+		})
+		zone.Start()
+		return zone, nil
+
+	case "validity-sweep":
+		opts := validitySweepOptions{TTL: 60}
+		if err := decode(&opts); err != nil {
+			return nil, err
+		}
+		if dConf == nil {
+			return nil, fmt.Errorf("function NewModule failed: validity-sweep module requires dnssec")
+		}
+		return xdns.NewValiditySweepResponser(xdns.ValiditySweepConfig{
+			Zone:      mConf.Zone,
+			Steps:     opts.Steps,
+			ServerIP:  net.ParseIP(opts.Address),
+			TTL:       opts.TTL,
+			DNSSEC:    *dConf,
+			LogWriter: os.Stdout,
+		}), nil
+	}
+	return nil, fmt.Errorf("function NewModule failed: unknown module type %q", mConf.Type)
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// router.go 文件定义了按查询名称所属区域分发查询的路由回复器。
+// 路由可附加 RouteMatcher 匹配条件（标签数、标签前缀及查询类型），
+// 从而将同一区域内不同形状的查询交由不同的回复器处理，
+// 取代在回复器中对 strings.Split 的结果逐层判断的写法。
+
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+)
+
+// RouteMatcher 记录路由在区域之外的匹配条件，零值匹配区域内的全部查询
+type RouteMatcher struct {
+	// 查询名称标签数的下限及上限（不含根标签），0 表示不限
+	MinLabels int
+	MaxLabels int
+	// 标签前缀：第 i 个表达式须匹配查询名称的第 i 个标签（自左向右，小写），
+	// 如 ^cname\d+$ 仅匹配首个标签形如 cname12 的查询，标签数不足时不匹配
+	LabelPrefix []*regexp.Regexp
+	// 查询类型集合，为空时匹配全部类型
+	Types []dns.DNSType
+}
+
+// IsZero 检查匹配条件是否为空
+func (m RouteMatcher) IsZero() bool {
+	return m.MinLabels == 0 && m.MaxLabels == 0 && len(m.LabelPrefix) == 0 && len(m.Types) == 0
+}
+
+// Match 检查查询是否满足匹配条件，qName 须为 canonical 的结果
+func (m RouteMatcher) Match(qName string, qType dns.DNSType) bool {
+	count := labelCount(qName)
+	if (m.MinLabels > 0 && count < m.MinLabels) || (m.MaxLabels > 0 && count > m.MaxLabels) {
+		return false
+	}
+	if len(m.LabelPrefix) > count {
+		return false
+	}
+	if len(m.LabelPrefix) > 0 {
+		labels := strings.SplitN(qName, ".", len(m.LabelPrefix)+1)
+		for i, re := range m.LabelPrefix {
+			if !re.MatchString(labels[i]) {
+				return false
+			}
+		}
+	}
+	if len(m.Types) == 0 {
+		return true
+	}
+	for _, t := range m.Types {
+		if t == qType {
+			return true
+		}
+	}
+	return false
+}
+
+// route 表示一条路由：区域、匹配条件及负责该区域的回复器
+type route struct {
+	zone      string
+	matcher   RouteMatcher
+	responser xdns.Responser
+	// 追踪属性，如模块类型及其参数
+	attributes map[string]interface{}
+}
+
+// Router 路由回复器：将查询交由负责最接近查询名称的区域的回复器处理，
+// 不属于任何区域的查询将得到 REFUSED 回复。
+type Router struct {
+	routes []route
+	// 查询分类缓存，记录问题部分相同的查询所匹配的路由，为 nil 时每次查询均重新匹配
+	Classes *xdns.QueryClassCache
+}
+
+// Handle 添加一条匹配区域内全部查询的路由，attributes 将在追踪时记录至当前 span
+func (r *Router) Handle(zone string, responser xdns.Responser, attributes map[string]interface{}) {
+	r.HandleMatch(zone, RouteMatcher{}, responser, attributes)
+}
+
+// HandleMatch 添加一条仅匹配区域内满足匹配条件的查询的路由
+func (r *Router) HandleMatch(zone string, matcher RouteMatcher, responser xdns.Responser, attributes map[string]interface{}) {
+	r.routes = append(r.routes, route{
+		zone:       canonical(zone),
+		matcher:    matcher,
+		responser:  responser,
+		attributes: attributes,
+	})
+	// 按标签数降序排列，使得最长匹配优先；
+	// 同一区域中带有匹配条件的路由优先，其余按添加顺序
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		li, lj := labelCount(r.routes[i].zone), labelCount(r.routes[j].zone)
+		if li != lj {
+			return li > lj
+		}
+		return !r.routes[i].matcher.IsZero() && r.routes[j].matcher.IsZero()
+	})
+	// 路由表改变后，已缓存的路由不再有效
+	if r.Classes != nil {
+		r.Classes.Reset()
+	}
+}
+
+// Match 返回负责查询的路由，未找到时返回 nil
+func (r *Router) Match(qName string, qType dns.DNSType) *route {
+	qName = canonical(qName)
+	for i := range r.routes {
+		if inZone(qName, r.routes[i].zone) && r.routes[i].matcher.Match(qName, qType) {
+			return &r.routes[i]
+		}
+	}
+	return nil
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *Router) Response(connInfo xdns.ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给负责的回复器。
+// 问题部分命中查询分类缓存时，不再解码查询。
+func (r *Router) ResponseContext(ctx context.Context, connInfo xdns.ConnectionInfo) ([]byte, error) {
+	if r.Classes != nil {
+		if rt, ok := r.Classes.Get(connInfo.Packet); ok {
+			return r.dispatch(ctx, rt.(*route), connInfo)
+		}
+	}
+	qry, err := xdns.ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+	if rt := r.Match(qry.Question[0].Name.DomainName, qry.Question[0].Type); rt != nil {
+		if r.Classes != nil {
+			r.Classes.Add(connInfo.Packet, rt)
+		}
+		return r.dispatch(ctx, rt, connInfo)
+	}
+	resp := xdns.InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeRefused
+	xdns.FixCount(&resp)
+	return resp.Encode(), nil
+}
+
+// dispatch 将查询交由路由的回复器处理，并在追踪时记录路由的属性
+func (r *Router) dispatch(ctx context.Context, rt *route, connInfo xdns.ConnectionInfo) ([]byte, error) {
+	span := xdns.SpanFromContext(ctx)
+	span.SetAttribute("xdns.zone", rt.zone)
+	for k, v := range rt.attributes {
+		span.SetAttribute(k, v)
+	}
+	return xdns.Respond(ctx, rt.responser, connInfo)
+}
+
+// canonical 返回名称的小写形式，并去除末尾的点
+func canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// inZone 判断名称是否位于区域之内，根区域包含全部名称
+func inZone(name, zone string) bool {
+	if zone == "" {
+		return true
+	}
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// labelCount 返回名称的标签数
+func labelCount(name string) int {
+	if name == "" {
+		return 0
+	}
+	return strings.Count(name, ".") + 1
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// router_test.go 文件用于对路由回复器及路由匹配条件进行测试。
+
+package main
+
+import (
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+)
+
+// 测试 RouteMatcher 的 Match 方法
+func TestRouteMatcherMatch(t *testing.T) {
+	cname := regexp.MustCompile(`^cname\d+$`)
+	anyLabel := regexp.MustCompile(`.*`)
+	tests := []struct {
+		name     string
+		matcher  RouteMatcher
+		qName    string
+		qType    dns.DNSType
+		expected bool
+	}{
+		{"zero matcher", RouteMatcher{}, "a.b.c.test", dns.DNSRRTypeTXT, true},
+		{"root name", RouteMatcher{}, "", dns.DNSRRTypeNS, true},
+
+		// 标签数的上下限均包含边界
+		{"below min labels", RouteMatcher{MinLabels: 3}, "a.test", dns.DNSRRTypeA, false},
+		{"at min labels", RouteMatcher{MinLabels: 3}, "a.b.test", dns.DNSRRTypeA, true},
+		{"at max labels", RouteMatcher{MaxLabels: 3}, "a.b.test", dns.DNSRRTypeA, true},
+		{"above max labels", RouteMatcher{MaxLabels: 3}, "a.b.c.test", dns.DNSRRTypeA, false},
+		{"exact label count", RouteMatcher{MinLabels: 2, MaxLabels: 2}, "a.test", dns.DNSRRTypeA, true},
+		{"exact label count, longer name", RouteMatcher{MinLabels: 2, MaxLabels: 2}, "a.b.test", dns.DNSRRTypeA, false},
+
+		// 标签前缀自左向右逐个匹配
+		{"label prefix", RouteMatcher{LabelPrefix: []*regexp.Regexp{cname}}, "cname12.test", dns.DNSRRTypeA, true},
+		{"label prefix mismatch", RouteMatcher{LabelPrefix: []*regexp.Regexp{cname}}, "www.test", dns.DNSRRTypeA, false},
+		{"second label prefix", RouteMatcher{LabelPrefix: []*regexp.Regexp{anyLabel, cname}}, "x.cname3.test", dns.DNSRRTypeA, true},
+		{"second label prefix mismatch", RouteMatcher{LabelPrefix: []*regexp.Regexp{anyLabel, cname}}, "cname3.x.test", dns.DNSRRTypeA, false},
+		// 前缀只匹配单个标签，不跨越标签边界
+		{"prefix within label", RouteMatcher{LabelPrefix: []*regexp.Regexp{regexp.MustCompile(`^a\.b$`)}}, "a.b.test", dns.DNSRRTypeA, false},
+		// 前缀数多于标签数时不匹配，即使表达式可匹配空标签
+		{"prefix longer than name", RouteMatcher{LabelPrefix: []*regexp.Regexp{anyLabel, anyLabel, anyLabel}}, "a.test", dns.DNSRRTypeA, false},
+		{"prefix as long as name", RouteMatcher{LabelPrefix: []*regexp.Regexp{anyLabel, anyLabel}}, "a.test", dns.DNSRRTypeA, true},
+		{"prefix on root name", RouteMatcher{LabelPrefix: []*regexp.Regexp{anyLabel}}, "", dns.DNSRRTypeA, false},
+
+		// 查询类型集合
+		{"type in set", RouteMatcher{Types: []dns.DNSType{dns.DNSRRTypeA, dns.DNSRRTypeAAAA}}, "a.test", dns.DNSRRTypeAAAA, true},
+		{"type not in set", RouteMatcher{Types: []dns.DNSType{dns.DNSRRTypeA, dns.DNSRRTypeAAAA}}, "a.test", dns.DNSRRTypeTXT, false},
+		{"ANY is not a wildcard", RouteMatcher{Types: []dns.DNSType{dns.DNSRRTypeA}}, "a.test", dns.DNSQTypeANY, false},
+
+		// 全部条件须同时满足
+		{"all conditions", RouteMatcher{MinLabels: 2, MaxLabels: 3, LabelPrefix: []*regexp.Regexp{cname}, Types: []dns.DNSType{dns.DNSRRTypeCNAME}},
+			"cname1.a.test", dns.DNSRRTypeCNAME, true},
+		{"all but type", RouteMatcher{MinLabels: 2, MaxLabels: 3, LabelPrefix: []*regexp.Regexp{cname}, Types: []dns.DNSType{dns.DNSRRTypeCNAME}},
+			"cname1.a.test", dns.DNSRRTypeA, false},
+	}
+	for _, tt := range tests {
+		if got := tt.matcher.Match(tt.qName, tt.qType); got != tt.expected {
+			t.Errorf("method RouteMatcher Match() failed: %s: %q %s:\ngot: %v\nexpected: %v", tt.name, tt.qName, tt.qType, got, tt.expected)
+		}
+	}
+}
+
+// 测试 RouteMatcher 的 IsZero 方法
+func TestRouteMatcherIsZero(t *testing.T) {
+	if !(RouteMatcher{}).IsZero() {
+		t.Errorf("method RouteMatcher IsZero() failed: zero value is not zero")
+	}
+	nonZero := []RouteMatcher{
+		{MinLabels: 1},
+		{MaxLabels: 1},
+		{LabelPrefix: []*regexp.Regexp{regexp.MustCompile(`x`)}},
+		{Types: []dns.DNSType{dns.DNSRRTypeA}},
+	}
+	for _, m := range nonZero {
+		if m.IsZero() {
+			t.Errorf("method RouteMatcher IsZero() failed: %+v is zero", m)
+		}
+	}
+}
+
+// newTestRouter 按顺序添加路由，每条路由的 "route" 属性为其名称
+func newTestRouter(routes ...struct {
+	name    string
+	zone    string
+	matcher RouteMatcher
+}) *Router {
+	r := &Router{}
+	for _, rt := range routes {
+		r.HandleMatch(rt.zone, rt.matcher, &xdns.DullResponser{}, map[string]interface{}{"route": rt.name})
+	}
+	return r
+}
+
+// 测试 Router 的 Match 方法选择路由的顺序
+func TestRouterMatch(t *testing.T) {
+	type testRoute = struct {
+		name    string
+		zone    string
+		matcher RouteMatcher
+	}
+	cname := RouteMatcher{LabelPrefix: []*regexp.Regexp{regexp.MustCompile(`^cname\d+$`)}}
+	txt := RouteMatcher{Types: []dns.DNSType{dns.DNSRRTypeTXT}}
+	deep := RouteMatcher{MinLabels: 4}
+	// 同一区域的全匹配路由先于带有匹配条件的路由添加
+	r := newTestRouter(
+		testRoute{"test", "test", RouteMatcher{}},
+		testRoute{"test-cname", "test", cname},
+		testRoute{"test-txt", "test.", txt},
+		testRoute{"sub", "Sub.Test", RouteMatcher{}},
+		testRoute{"test-deep", "test", deep},
+		testRoute{"root", ".", RouteMatcher{}},
+	)
+
+	tests := []struct {
+		qName    string
+		qType    dns.DNSType
+		expected string
+	}{
+		// 同一区域中带有匹配条件的路由先于全匹配路由
+		{"cname1.test", dns.DNSRRTypeA, "test-cname"},
+		{"www.test", dns.DNSRRTypeTXT, "test-txt"},
+		{"a.b.c.test", dns.DNSRRTypeA, "test-deep"},
+		{"www.test", dns.DNSRRTypeA, "test"},
+		// 带有匹配条件的路由之间按添加顺序
+		{"cname1.test.", dns.DNSRRTypeTXT, "test-cname"},
+		{"a.b.c.test", dns.DNSRRTypeTXT, "test-txt"},
+		// 更长的区域优先于父区域中带有匹配条件的路由，名称不区分大小写
+		{"cname1.SUB.test", dns.DNSRRTypeTXT, "sub"},
+		{"sub.test", dns.DNSRRTypeA, "sub"},
+		// 不属于 test 的名称由根区域负责
+		{"example.com", dns.DNSRRTypeA, "root"},
+		{"attest", dns.DNSRRTypeA, "root"},
+	}
+	for _, tt := range tests {
+		rt := r.Match(tt.qName, tt.qType)
+		if rt == nil || rt.attributes["route"] != tt.expected {
+			got := "<nil>"
+			if rt != nil {
+				got = rt.attributes["route"].(string)
+			}
+			t.Errorf("method Router Match() failed: %q %s:\ngot: %s\nexpected: %s", tt.qName, tt.qType, got, tt.expected)
+		}
+	}
+
+	// 不属于任何区域的查询没有路由
+	r = newTestRouter(testRoute{"test", "test", RouteMatcher{}}, testRoute{"test-txt", "test", txt})
+	if rt := r.Match("example.com", dns.DNSRRTypeTXT); rt != nil {
+		t.Errorf("method Router Match() failed: example.com matched route %v", rt.attributes["route"])
+	}
+	// 区域内不满足任何匹配条件、且没有全匹配路由的查询没有路由
+	r = newTestRouter(testRoute{"test-txt", "test", txt})
+	if rt := r.Match("www.test", dns.DNSRRTypeA); rt != nil {
+		t.Errorf("method Router Match() failed: www.test A matched route %v", rt.attributes["route"])
+	}
+}
+
+// 测试 Router 对不属于任何区域的查询回复 REFUSED
+func TestRouterResponseRefused(t *testing.T) {
+	r := &Router{}
+	r.Handle("test", &xdns.DullResponser{}, nil)
+	for _, tt := range []struct {
+		qName string
+		rCode dns.DNSResponseCode
+	}{
+		{"www.test", dns.DNSResponseCodeNoErr},
+		{"www.example", dns.DNSResponseCodeRefused},
+	} {
+		qry := dns.DNSMessage{
+			Header:   dns.DNSHeader{ID: 0x1234, QDCount: 1},
+			Question: dns.DNSQuestionSection{{Name: *dns.NewDNSName(tt.qName), Type: dns.DNSRRTypeA, Class: dns.DNSClassIN}},
+		}
+		data, err := r.Response(xdns.ConnectionInfo{
+			Protocol: xdns.ProtocolUDP,
+			Address:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53000},
+			Packet:   qry.Encode(),
+		})
+		resp := dns.DNSMessage{}
+		if err != nil {
+			t.Errorf("method Router Response() failed: %s:\n%v", tt.qName, err)
+		} else if _, err := resp.DecodeFromBuffer(data, 0); err != nil || resp.Header.RCode != tt.rCode {
+			t.Errorf("method Router Response() failed: %s:\ngot: %s\nexpected: %s", tt.qName, resp.Header.RCode, tt.rCode)
+		}
+	}
+}
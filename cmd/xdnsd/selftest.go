@@ -0,0 +1,124 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// selftest.go 文件实现了 -selftest 选项：
+// 在开始监听之前，为配置中每个静态区域的每个 名称/类型 以及区域的 DNSKEY、DS 生成参考查询，
+// 直接交由组装好的回复器回复，并使用 xperi.ChainValidator 验证回复中的签名及信任链，
+// 任何本应有效的签名验证失败时立即退出，以免在部署后才发现签名错误。
+//
+// 实验模块的回复可能刻意包含无效签名，因此不在自检范围内；
+// 不受支持算法的随机签名同样被忽略。
+// 未被任何上级配置区域覆盖的区域被视为信任锚，
+// 签名者不由本服务器负责（如区域顶点记录由上级区域签名）时无法在本地验证，仅记录为跳过。
+// 自检查询与普通查询一样会被记录在查询日志中。
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// selfTestQuery 表示一个参考查询
+type selfTestQuery struct {
+	name  string
+	qType dns.DNSType
+}
+
+// selfTestQueries 返回配置中静态区域的参考查询，按名称及类型排序
+func selfTestQueries(conf Config) ([]selfTestQuery, error) {
+	seen := map[selfTestQuery]bool{}
+	for _, zConf := range conf.Zones {
+		zone := canonical(zConf.Name)
+		seen[selfTestQuery{zone, dns.DNSRRTypeDNSKEY}] = true
+		seen[selfTestQuery{zone, dns.DNSRRTypeDS}] = true
+		for _, rConf := range zConf.Records {
+			qType, err := ParseType(rConf.Type)
+			if err != nil {
+				return nil, err
+			}
+			seen[selfTestQuery{canonical(rConf.Name), qType}] = true
+		}
+	}
+
+	queries := make([]selfTestQuery, 0, len(seen))
+	for q := range seen {
+		queries = append(queries, q)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].name != queries[j].name {
+			return queries[i].name < queries[j].name
+		}
+		return queries[i].qType < queries[j].qType
+	})
+	return queries, nil
+}
+
+// selfTestAnchors 返回不位于其他静态区域之内的静态区域，作为自检的信任锚
+func selfTestAnchors(conf Config) []string {
+	anchors := []string{}
+	for _, zConf := range conf.Zones {
+		zone := canonical(zConf.Name)
+		anchor := true
+		for _, other := range conf.Zones {
+			if parent := canonical(other.Name); parent != zone && inZone(zone, parent) {
+				anchor = false
+				break
+			}
+		}
+		if anchor {
+			anchors = append(anchors, zone)
+		}
+	}
+	return anchors
+}
+
+// SelfTest 使用回复器回复静态区域的参考查询，并验证回复中的签名及信任链
+// 其接受参数为：
+//   - conf Config，xdnsd 配置
+//   - responser xdns.Responser，由 Build 组装的回复器
+//   - w io.Writer，自检报告的输出
+//
+// 返回值为：
+//   - error，第一个验证失败的签名的错误信息
+func SelfTest(conf Config, responser xdns.Responser, w io.Writer) error {
+	if !conf.DNSSEC.Enabled {
+		fmt.Fprintln(w, "selftest: dnssec is disabled, nothing to verify")
+		return nil
+	}
+	queries, err := selfTestQueries(conf)
+	if err != nil {
+		return fmt.Errorf("function SelfTest failed: %v", err)
+	}
+
+	query := localQuerier(responser)
+	validator := &xperi.ChainValidator{Query: query, Anchors: selfTestAnchors(conf)}
+	verified, skipped := 0, 0
+	for _, q := range queries {
+		qType := dns.FormatDNSType(q.qType)
+		resp, err := query(q.name, q.qType)
+		if err != nil {
+			return fmt.Errorf("function SelfTest failed: query %s %s failed.\n%v", q.name, qType, err)
+		}
+		n, err := validator.ValidateMessage(resp)
+		verified += n
+		switch {
+		case errors.Is(err, xperi.ErrNoDNSKEY):
+			skipped++
+			fmt.Fprintf(w, "selftest: %s %s: skipped, %v\n", q.name, qType, err)
+		case err != nil:
+			return fmt.Errorf("function SelfTest failed: %s %s:\n%v", q.name, qType, err)
+		default:
+			fmt.Fprintf(w, "selftest: %s %s: %d signatures verified\n", q.name, qType, n)
+		}
+	}
+	fmt.Fprintf(w, "selftest: %d queries, %d signatures verified, %d skipped, trust anchors %s\n",
+		len(queries), verified, skipped, strings.Join(validator.Anchors, ", "))
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// zone.go 文件定义了基于 store.ZoneStore 回复静态区域数据的回复器，
+// 及将配置文件中的资源记录解析为 dns.DNSResourceRecord 的辅助函数。
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/store"
+)
+
+// ZoneResponser 区域回复器：根据存储中的区域数据回复查询。
+type ZoneResponser struct {
+	Zone  string
+	Store store.ZoneStore
+	// DNSSEC 配置，为 nil 时不进行签名
+	DNSSEC *xdns.DNSSECConfig
+
+	// 区域中存在的名称，用于区分 NXDOMAIN 与 NODATA
+	names map[string]bool
+	// 区域名与其相应 DNSSEC 材料的映射，由全部区域共享
+	materials *sync.Map
+}
+
+// NewZoneResponser 根据配置创建区域回复器，并将配置中的记录写入存储。
+// materials 为区域名与 DNSSEC 材料的映射，应由全部区域共享，
+// 使得子区域 DS 的签名与上级区域回复的 DNSKEY 一致。
+func NewZoneResponser(zConf ZoneSection, dConf *xdns.DNSSECConfig, materials *sync.Map) (*ZoneResponser, error) {
+	zs, err := openStore(zConf.Store)
+	if err != nil {
+		return nil, fmt.Errorf("function NewZoneResponser failed: %v", err)
+	}
+	z := &ZoneResponser{
+		Zone:      canonical(zConf.Name),
+		Store:     zs,
+		DNSSEC:    dConf,
+		names:     map[string]bool{},
+		materials: materials,
+	}
+
+	rrSets := map[string][]dns.DNSResourceRecord{}
+	for _, rConf := range zConf.Records {
+		rr, err := ParseRecord(rConf)
+		if err != nil {
+			return nil, fmt.Errorf("function NewZoneResponser failed: zone %s: %v", zConf.Name, err)
+		}
+		key := rr.Name.DomainName + "/" + strconv.Itoa(int(rr.Type))
+		rrSets[key] = append(rrSets[key], rr)
+	}
+	for _, rrSet := range rrSets {
+		if err := zs.PutRRSet(rrSet[0].Name.DomainName, rrSet[0].Type, rrSet); err != nil {
+			return nil, fmt.Errorf("function NewZoneResponser failed: %v", err)
+		}
+	}
+	// 存储中可能已有此前写入的数据，因此从存储中收集存在的名称
+	err = zs.Iterate(func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool {
+		z.names[canonical(name)] = true
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("function NewZoneResponser failed: %v", err)
+	}
+	return z, nil
+}
+
+// openStore 根据配置打开存储后端
+func openStore(spec string) (store.ZoneStore, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return store.NewMemoryStore(), nil
+	case strings.HasPrefix(spec, "bolt:"):
+		return store.NewBoltStore(strings.TrimPrefix(spec, "bolt:"))
+	}
+	return nil, fmt.Errorf("unknown store %q", spec)
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (z *ZoneResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error) {
+	return z.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并在追踪时记录 "sign" 及 "encode" span。
+func (z *ZoneResponser) ResponseContext(ctx context.Context, connInfo xdns.ConnectionInfo) ([]byte, error) {
+	qry, err := xdns.ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+	qName := canonical(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+
+	resp := xdns.InitNXDOMAIN(qry)
+	if z.names[qName] {
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+		rrSet, err := z.Store.GetRRSet(qName, qType)
+		if err != nil {
+			return []byte{}, err
+		}
+		if len(rrSet) == 0 && qType != dns.DNSRRTypeCNAME {
+			rrSet, err = z.Store.GetRRSet(qName, dns.DNSRRTypeCNAME)
+			if err != nil {
+				return []byte{}, err
+			}
+		}
+		resp.Answer = append(resp.Answer, rrSet...)
+	}
+	if len(resp.Answer) == 0 {
+		soa, err := z.Store.GetRRSet(z.Zone, dns.DNSRRTypeSOA)
+		if err != nil {
+			return []byte{}, err
+		}
+		resp.Authority = append(resp.Authority, soa...)
+	}
+
+	if z.DNSSEC != nil {
+		xdns.EnableDNSSECContext(ctx, qry, &resp, *z.DNSSEC, z.materials)
+	}
+	xdns.FixCount(&resp)
+
+	_, span := xdns.StartSpan(ctx, "encode", xdns.SpanKindInternal)
+	defer span.Finish()
+	return xdns.EncodeResponse(ctx, &resp), nil
+}
+
+// ParseType 解析记录类型助记符，也接受 RFC 3597 的 TYPEn 形式
+func ParseType(s string) (dns.DNSType, error) {
+	t, err := dns.ParseDNSType(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown record type %q", s)
+	}
+	return t, nil
+}
+
+// ParseRecord 将配置文件中的记录解析为资源记录，记录数据的格式详见 xdns.ParseRDATA，
+// 任意类型的数据均可使用 RFC 3597 的通用格式，如 type 为 "TYPE4096"、data 为 "\# 4 0A0A0A0A"。
+func ParseRecord(rConf RecordSection) (dns.DNSResourceRecord, error) {
+	rrType, err := ParseType(rConf.Type)
+	if err != nil {
+		return dns.DNSResourceRecord{}, err
+	}
+	name := canonical(rConf.Name)
+	if name == "" {
+		name = "."
+	}
+
+	rdata, err := xdns.ParseRDATA(rrType, rConf.Data)
+	if err != nil {
+		return dns.DNSResourceRecord{}, fmt.Errorf("invalid data %q for %s: %v", rConf.Data, rConf.Name, err)
+	}
+
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(name),
+		Type:  rrType,
+		Class: dns.DNSClassIN,
+		TTL:   rConf.TTL,
+		RDLen: uint16(rdata.Size()),
+		RData: rdata,
+	}, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// coalesce.go 文件定义了 CoalescingResponser 合并回复器。
+// 解析器在超时重传时会发送完全相同的查询，而 DNSSEC 签名等回复的构造代价很高，
+// 合并回复器使得同时在途的相同查询只调用一次被包装的回复器，
+// 其余查询等待该次调用完成后共享其回复，仅改写报文 ID。
+
+package xdns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// CoalesceScope 表示查询合并的范围
+type CoalesceScope int
+
+const (
+	// CoalesceByClient 仅合并来自同一客户端 IP 地址的相同查询
+	CoalesceByClient CoalesceScope = iota
+	// CoalesceGlobal 合并来自任意客户端的相同查询，
+	// 仅适用于回复不依赖于客户端的回复器
+	CoalesceGlobal
+)
+
+// coalescedCall 表示一次在途的回复器调用
+type coalescedCall struct {
+	done chan struct{}
+	resp []byte
+	err  error
+}
+
+// CoalescingResponser 合并回复器：包装一个回复器，并合并同时在途的相同查询。
+// 查询名称（区分大小写，以保留 0x20 混淆）、类型、类别、传输协议、RD、CD 及 DO 标志均相同时视为相同查询。
+// 其零值即可使用，无法解析或不含问题的查询直接交由被包装的回复器处理。
+type CoalescingResponser struct {
+	Responser Responser
+	// 合并范围
+	Scope CoalesceScope
+
+	mu        sync.Mutex
+	calls     map[string]*coalescedCall
+	executed  uint64
+	coalesced uint64
+}
+
+// Response 生成被包装回复器的回复，与在途的相同查询共享同一次调用。
+func (r *CoalescingResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+// 等待其他查询的调用完成时，若上下文先行结束，则返回上下文的错误。
+func (r *CoalescingResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil || len(qry.Question) == 0 {
+		return Respond(ctx, r.Responser, connInfo)
+	}
+	key := r.key(connInfo, qry)
+
+	r.mu.Lock()
+	if r.calls == nil {
+		r.calls = make(map[string]*coalescedCall)
+	}
+	if call, ok := r.calls[key]; ok {
+		r.mu.Unlock()
+		atomic.AddUint64(&r.coalesced, 1)
+		serverVars.Add("coalesced", 1)
+		SpanFromContext(ctx).SetAttribute("dns.coalesced", true)
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err != nil {
+			return nil, call.err
+		}
+		return withMessageID(call.resp, qry.Header.ID), nil
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	r.calls[key] = call
+	r.mu.Unlock()
+	atomic.AddUint64(&r.executed, 1)
+
+	resp, err := Respond(ctx, r.Responser, connInfo)
+	// 服务器可能原地修改返回的回复，并在发送后将其归还编码缓冲池，因此共享的是其副本
+	call.resp, call.err = append([]byte{}, resp...), err
+
+	r.mu.Lock()
+	delete(r.calls, key)
+	r.mu.Unlock()
+	close(call.done)
+	return resp, err
+}
+
+// Executed 返回实际调用被包装回复器的次数
+func (r *CoalescingResponser) Executed() uint64 {
+	return atomic.LoadUint64(&r.executed)
+}
+
+// Coalesced 返回被合并至在途调用的查询数量
+func (r *CoalescingResponser) Coalesced() uint64 {
+	return atomic.LoadUint64(&r.coalesced)
+}
+
+// key 返回查询的合并键
+func (r *CoalescingResponser) key(connInfo ConnectionInfo, qry dns.DNSMessage) string {
+	client := ""
+	if r.Scope == CoalesceByClient {
+		client = connInfo.ClientIP().String()
+	}
+	do := false
+	if opt, ok := qry.OPT(); ok {
+		do = opt.DO
+	}
+	question := qry.Question[0]
+	return fmt.Sprintf("%s|%s|%s|%d|%d|%t|%d|%t",
+		client, connInfo.Protocol, question.Name.DomainName, question.Type, question.Class,
+		qry.Header.RD, qry.Header.Z&0x01, do)
+}
+
+// withMessageID 返回报文 ID 被替换为指定值的回复副本
+func withMessageID(resp []byte, id uint16) []byte {
+	resp = append([]byte{}, resp...)
+	if len(resp) >= 2 {
+		binary.BigEndian.PutUint16(resp, id)
+	}
+	return resp
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// context.go 文件定义了 ContextResponser 接口，及请求上下文的相关辅助函数。
+// 服务器为每个查询创建一个上下文，其携带：
+//   - 取消信号：服务器停止时取消；
+//   - 截止时间：ServerConfig.ResponseTimeout 不为 0 时设置；
+//   - 请求范围的值：追踪 ID 及客户端指纹。
+//
+// 实现 ContextResponser 接口的回复器可以据此实现超时、追踪及取消，
+// 仅实现 Responser 接口的回复器仍可正常使用，见 Respond 函数。
+
+package xdns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ContextResponser 是支持上下文的 DNS 回复器接口。
+type ContextResponser interface {
+	Responser
+	// ResponseContext 根据 DNS 查询信息生成 DNS 回复信息。
+	// 其参数为：
+	//   - ctx context.Context，请求上下文，携带取消信号、截止时间及请求范围的值
+	//   - connInfo ConnectionInfo，链接信息
+	// 返回值为：
+	//   - []byte，DNS 回复信息
+	//   - error，错误信息
+	ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error)
+}
+
+// Respond 使用上下文调用回复器
+// 若回复器实现了 ContextResponser 接口，则调用其 ResponseContext 方法；
+// 否则若上下文设置了截止时间（如 ServerConfig.ResponseTimeout），在新的协程中调用其 Response 方法，
+// 并在上下文结束时立即返回上下文的错误，此时该协程仍会运行至 Response 返回，其结果将被丢弃；
+// 上下文未设置截止时间时直接调用 Response 方法，不为每个查询额外创建协程。
+// 其接受参数为：
+//   - ctx context.Context，请求上下文
+//   - r Responser，回复器
+//   - connInfo ConnectionInfo，链接信息
+//
+// 返回值为：
+//   - []byte，DNS 回复信息
+//   - error，错误信息
+func Respond(ctx context.Context, r Responser, connInfo ConnectionInfo) ([]byte, error) {
+	if cr, ok := r.(ContextResponser); ok {
+		return cr.ResponseContext(ctx, connInfo)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return r.Response(connInfo)
+	}
+	if err := ctx.Err(); err != nil {
+		return []byte{}, err
+	}
+
+	type result struct {
+		resp []byte
+		err  error
+	}
+	resultChan := make(chan result, 1)
+	go func() {
+		resp, err := r.Response(connInfo)
+		resultChan <- result{resp, err}
+	}()
+	select {
+	case res := <-resultChan:
+		return res.resp, res.err
+	case <-ctx.Done():
+		return []byte{}, ctx.Err()
+	}
+}
+
+// contextKey 是请求上下文中值的键类型，避免与其他包的键冲突
+type contextKey int
+
+const (
+	traceIDKey contextKey = iota
+	fingerprintKey
+	tracerKey
+	spanKey
+	memoryBudgetKey
+	oversizeKey
+	costMeterKey
+	overrunKey
+	encodeBuffersKey
+)
+
+// NewTraceID 生成一个随机的 128 位追踪 ID，以 32 位十六进制字符串表示，
+// 与 W3C Trace Context 的 trace-id 格式相同
+func NewTraceID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithTraceID 返回携带追踪 ID 的上下文
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// TraceIDFromContext 返回上下文中的追踪 ID
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey).(string)
+	return traceID, ok
+}
+
+// WithClientFingerprint 返回携带客户端指纹的上下文
+func WithClientFingerprint(ctx context.Context, fingerprint string) context.Context {
+	return context.WithValue(ctx, fingerprintKey, fingerprint)
+}
+
+// ClientFingerprintFromContext 返回上下文中的客户端指纹
+func ClientFingerprintFromContext(ctx context.Context) (string, bool) {
+	fingerprint, ok := ctx.Value(fingerprintKey).(string)
+	return fingerprint, ok
+}
+
+// ClientFingerprint 根据查询的特征生成客户端指纹，
+// 不同的解析器实现在标志位、EDNS 参数及选项上往往有所不同，可据此粗略区分解析器。
+// 指纹形如 "udp:rd=0,cd=1,edns=1232,do=1,opts=10.12"，未携带 OPT 记录时 edns=none。
+func ClientFingerprint(connInfo ConnectionInfo, qry dns.DNSMessage) string {
+	flag := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	fp := fmt.Sprintf("%s:rd=%d,cd=%d", connInfo.Protocol, flag(qry.Header.RD), qry.Header.Z&0x01)
+	if opt, ok := qry.OPT(); ok {
+		codes := []string{}
+		if opt.RData != nil {
+			rdata := opt.RData.Encode()
+			for len(rdata) >= 4 {
+				codes = append(codes, fmt.Sprint(uint16(rdata[0])<<8|uint16(rdata[1])))
+				optLen := int(rdata[2])<<8 | int(rdata[3])
+				if len(rdata) < 4+optLen {
+					break
+				}
+				rdata = rdata[4+optLen:]
+			}
+		}
+		return fmt.Sprintf("%s,edns=%d,do=%d,opts=%s", fp, opt.UDPPayloadSize, flag(opt.DO), strings.Join(codes, "."))
+	}
+	return fp + ",edns=none"
+}
+
+// NewConnectionContext 为查询创建请求上下文，其携带新的追踪 ID 及客户端指纹
+// 其接受参数为：
+//   - parent context.Context，父上下文
+//   - connInfo ConnectionInfo，链接信息
+//
+// 返回值为：
+//   - context.Context，请求上下文
+func NewConnectionContext(parent context.Context, connInfo ConnectionInfo) context.Context {
+	ctx := WithTraceID(parent, NewTraceID())
+	if qry, err := ParseQuery(connInfo); err == nil {
+		ctx = WithClientFingerprint(ctx, ClientFingerprint(connInfo, qry))
+	}
+	return ctx
+}
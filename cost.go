@@ -0,0 +1,153 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// cost.go 文件定义了单个回复的开销计量。
+// 服务器在 ServerConfig.CostAccounting 启用时为每个查询的上下文附加一个 CostMeter，
+// 并测量生成回复所消耗的 CPU 时间；回复器经由 DNSSECConfig.WithMeter 或 CountSignatures、
+// CountHashes 计入签名及摘要操作的次数。与内存预算相同，计量是协作式的，
+// 仅对使用请求上下文的回复器生效。
+//
+// 全部回复的开销累计于 /debug/vars 的 "xdns" 变量（"signatures"、"hash_ops" 及 "cpu_ns"），
+// 启用 CostDebugTXT 时，每个回复的开销亦以 TXT 记录附加于其附加部分，
+// 用于量化服务器与受害解析器之间的开销不对称。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// CostMeter 开销计量：记录单个回复构造过程中的签名及摘要操作次数，可被并发使用
+type CostMeter struct {
+	signatures int64
+	hashes     int64
+}
+
+// NewCostMeter 创建一个新的开销计量
+func NewCostMeter() *CostMeter {
+	return &CostMeter{}
+}
+
+// AddSignatures 计入签名操作的次数，m 为 nil 时不计入
+func (m *CostMeter) AddSignatures(n int) {
+	if m != nil {
+		atomic.AddInt64(&m.signatures, int64(n))
+	}
+}
+
+// AddHashes 计入摘要操作（DS 摘要、NSEC3 哈希的每次迭代等，不含签名自身的摘要）的次数，m 为 nil 时不计入
+func (m *CostMeter) AddHashes(n int) {
+	if m != nil {
+		atomic.AddInt64(&m.hashes, int64(n))
+	}
+}
+
+// Signatures 返回已计入的签名操作次数
+func (m *CostMeter) Signatures() int64 {
+	return atomic.LoadInt64(&m.signatures)
+}
+
+// Hashes 返回已计入的摘要操作次数
+func (m *CostMeter) Hashes() int64 {
+	return atomic.LoadInt64(&m.hashes)
+}
+
+// WithCostMeter 返回携带开销计量的上下文
+func WithCostMeter(ctx context.Context, meter *CostMeter) context.Context {
+	return context.WithValue(ctx, costMeterKey, meter)
+}
+
+// CostMeterFromContext 返回上下文中的开销计量，不存在时返回 nil
+func CostMeterFromContext(ctx context.Context) *CostMeter {
+	meter, _ := ctx.Value(costMeterKey).(*CostMeter)
+	return meter
+}
+
+// CountSignatures 向上下文中的开销计量计入签名操作的次数，上下文未携带计量时不计入
+func CountSignatures(ctx context.Context, n int) {
+	CostMeterFromContext(ctx).AddSignatures(n)
+}
+
+// CountHashes 向上下文中的开销计量计入摘要操作的次数，上下文未携带计量时不计入
+func CountHashes(ctx context.Context, n int) {
+	CostMeterFromContext(ctx).AddHashes(n)
+}
+
+// WithMeter 返回 DNSSEC 配置的副本，使用该副本的签名及 DS 摘要计入上下文中的开销计量
+func (c DNSSECConfig) WithMeter(ctx context.Context) DNSSECConfig {
+	c.Meter = CostMeterFromContext(ctx)
+	return c
+}
+
+// ResponseCost 记录单个回复的开销
+type ResponseCost struct {
+	Signatures int64 `json:"signatures"`
+	Hashes     int64 `json:"hash_ops"`
+	// 生成回复消耗的 CPU 时间，不支持线程 CPU 时间的平台上为墙上时间
+	CPU time.Duration `json:"cpu"`
+}
+
+// String 返回开销的文本表示，形如 "signatures=3 hash_ops=1 cpu_us=850"
+func (c ResponseCost) String() string {
+	return fmt.Sprintf("signatures=%d hash_ops=%d cpu_us=%d", c.Signatures, c.Hashes, c.CPU.Microseconds())
+}
+
+// CostDebugName 为携带回复开销的 TXT 记录的所有者名称
+const CostDebugName = "debug"
+
+// CostDebugRecord 返回携带回复开销的 TXT 记录，其 TTL 为 0，不应被缓存
+func CostDebugRecord(cost ResponseCost) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(CostDebugName),
+		Type:  dns.DNSRRTypeTXT,
+		Class: dns.DNSClassIN,
+		TTL:   0,
+		RDLen: 0,
+		RData: &dns.DNSRDATATXT{TXT: []string{cost.String()}},
+	}
+}
+
+// respondMetered 生成回复并测量其开销。
+// 为测量线程 CPU 时间，生成回复期间当前协程被绑定至操作系统线程，
+// 回复器另起的协程所消耗的 CPU 时间不被计入。
+func respondMetered(ctx context.Context, r Responser, connInfo ConnectionInfo) ([]byte, ResponseCost, error) {
+	meter := NewCostMeter()
+	ctx = WithCostMeter(ctx, meter)
+
+	runtime.LockOSThread()
+	start := time.Now()
+	cpuStart, ok := threadCPUTime()
+	resp, err := Respond(ctx, r, connInfo)
+	cpuEnd, _ := threadCPUTime()
+	elapsed := time.Since(start)
+	runtime.UnlockOSThread()
+
+	cost := ResponseCost{
+		Signatures: meter.Signatures(),
+		Hashes:     meter.Hashes(),
+		CPU:        elapsed,
+	}
+	if ok {
+		cost.CPU = cpuEnd - cpuStart
+	}
+	serverVars.Add("signatures", cost.Signatures)
+	serverVars.Add("hash_ops", cost.Hashes)
+	serverVars.Add("cpu_ns", cost.CPU.Nanoseconds())
+	return resp, cost, err
+}
+
+// appendCostRecord 将携带回复开销的 TXT 记录附加于回复的附加部分，无法解析回复时返回原回复
+func appendCostRecord(resp []byte, cost ResponseCost) []byte {
+	msg := dns.DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(resp, 0); err != nil {
+		return resp
+	}
+	msg.Additional = append(msg.Additional, CostDebugRecord(cost))
+	FixCount(&msg)
+	return msg.Encode()
+}
@@ -0,0 +1,19 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build linux
+
+package xdns
+
+import (
+	"syscall"
+	"time"
+)
+
+// threadCPUTime 返回当前线程已消耗的用户态及内核态 CPU 时间
+func threadCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_THREAD, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
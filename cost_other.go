@@ -0,0 +1,12 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build !linux
+
+package xdns
+
+import "time"
+
+// threadCPUTime 在不支持的平台上返回 false，回复的开销将使用墙上时间
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
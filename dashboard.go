@@ -0,0 +1,305 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// dashboard.go 文件定义了内嵌于程序中的实验仪表盘，便于在教学演示时无需在多个终端之间切换。
+// 仪表盘由管理监听器提供，其包括以下端点：
+//   - /：仪表盘页面，以实时图表展示每秒查询数、RCODE 构成及回复大小分布，并提供攻击参数的控制
+//   - /dashboard/traffic：最近一段时间内逐秒的流量统计，JSON 格式
+//   - /dashboard/controls：GET 列出可控制的攻击参数及其当前值，
+//     POST /dashboard/controls?name=<名称>&value=<值> 修改参数
+//   - /inspect 及 /inspect/：与 inspect.go 中的检视 API 相同
+//
+// 管理监听器可以修改服务器的行为，且不进行任何认证，应仅监听于本地或受信任的网络。
+
+package xdns
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// DefaultTrafficWindow 为流量统计默认保留的时长
+const DefaultTrafficWindow = 5 * time.Minute
+
+// TrafficSizeBounds 为回复大小分布各区间的上界（含），单位为字节，最后一个区间为大于最大上界的回复
+var TrafficSizeBounds = []int{128, 256, 512, 1232, 1472, 4096}
+
+// TrafficPoint 记录一秒内的流量
+type TrafficPoint struct {
+	Time    time.Time `json:"time"`
+	Queries uint64    `json:"queries"`
+	// 被刻意丢弃的回复数量
+	Dropped uint64 `json:"dropped"`
+	// 回复的总字节数
+	Bytes  uint64            `json:"bytes"`
+	RCodes map[string]uint64 `json:"rcodes"`
+}
+
+// TrafficReport 记录一段时间内的流量统计
+type TrafficReport struct {
+	// 逐秒的流量，按时间顺序排列，没有查询的秒亦包含在内
+	Points []TrafficPoint `json:"points"`
+	// 时间段内的 RCODE 构成
+	RCodes map[string]uint64 `json:"rcodes"`
+	// 回复大小分布，Sizes[i] 为大小不超过 SizeBounds[i] 且超过前一上界的回复数量，
+	// 最后一个元素为超过全部上界的回复数量
+	SizeBounds []int    `json:"size_bounds"`
+	Sizes      []uint64 `json:"sizes"`
+}
+
+// trafficBucket 记录一秒内的流量及回复大小分布
+type trafficBucket struct {
+	point TrafficPoint
+	sizes []uint64
+}
+
+// TrafficMeter 流量计：按秒统计查询数量、RCODE 构成及回复大小，仅保留最近 Window 时长的统计。
+type TrafficMeter struct {
+	// 保留的时长，0 表示 DefaultTrafficWindow
+	Window time.Duration
+
+	mu      sync.Mutex
+	buckets map[int64]*trafficBucket
+}
+
+// NewTrafficMeter 创建一个保留最近 window 时长统计的流量计
+func NewTrafficMeter(window time.Duration) *TrafficMeter {
+	return &TrafficMeter{Window: window, buckets: make(map[int64]*trafficBucket)}
+}
+
+// window 返回保留的时长
+func (m *TrafficMeter) window() time.Duration {
+	if m.Window <= 0 {
+		return DefaultTrafficWindow
+	}
+	return m.Window
+}
+
+// Observe 记录一个查询的回复，rCode 为空表示未回复
+func (m *TrafficMeter) Observe(now time.Time, rCode string, size int, dropped bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets == nil {
+		m.buckets = make(map[int64]*trafficBucket)
+	}
+	second := now.Unix()
+	b, ok := m.buckets[second]
+	if !ok {
+		// 新的一秒开始时移除过期的统计
+		oldest := now.Add(-m.window()).Unix()
+		for s := range m.buckets {
+			if s <= oldest {
+				delete(m.buckets, s)
+			}
+		}
+		b = &trafficBucket{
+			point: TrafficPoint{Time: time.Unix(second, 0), RCodes: map[string]uint64{}},
+			sizes: make([]uint64, len(TrafficSizeBounds)+1),
+		}
+		m.buckets[second] = b
+	}
+	b.point.Queries++
+	if dropped {
+		b.point.Dropped++
+	}
+	if rCode == "" {
+		return
+	}
+	b.point.RCodes[rCode]++
+	b.point.Bytes += uint64(size)
+	i := sort.SearchInts(TrafficSizeBounds, size)
+	b.sizes[i]++
+}
+
+// Report 返回截至 now 的流量统计
+func (m *TrafficMeter) Report(now time.Time) TrafficReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := TrafficReport{
+		Points:     []TrafficPoint{},
+		RCodes:     map[string]uint64{},
+		SizeBounds: append([]int{}, TrafficSizeBounds...),
+		Sizes:      make([]uint64, len(TrafficSizeBounds)+1),
+	}
+	last := now.Unix()
+	for s := now.Add(-m.window()).Unix() + 1; s <= last; s++ {
+		b, ok := m.buckets[s]
+		if !ok {
+			report.Points = append(report.Points, TrafficPoint{Time: time.Unix(s, 0), RCodes: map[string]uint64{}})
+			continue
+		}
+		point := b.point
+		point.RCodes = map[string]uint64{}
+		for rCode, n := range b.point.RCodes {
+			point.RCodes[rCode] = n
+			report.RCodes[rCode] += n
+		}
+		report.Points = append(report.Points, point)
+		for i, n := range b.sizes {
+			report.Sizes[i] += n
+		}
+	}
+	return report
+}
+
+// DashboardControl 表示仪表盘中一个可控制的攻击参数
+type DashboardControl struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// 取得参数的当前值
+	Get func() string `json:"-"`
+	// 修改参数，值不合法时返回错误
+	Set func(value string) error `json:"-"`
+}
+
+// splitZones 将逗号分隔的区域列表拆分为区域名
+func splitZones(value string) []string {
+	zones := []string{}
+	for _, zone := range strings.Split(value, ",") {
+		if zone = strings.TrimSpace(zone); zone != "" {
+			zones = append(zones, normalizeZone(zone))
+		}
+	}
+	return zones
+}
+
+// setZones 以 enable 及 disable 将区域集合从 current 修改为 value 中列出的区域
+func setZones(current []string, value string, enable, disable func(zone string)) {
+	wanted := map[string]bool{}
+	for _, zone := range splitZones(value) {
+		wanted[zone] = true
+	}
+	for _, zone := range current {
+		if !wanted[normalizeZone(zone)] {
+			disable(zone)
+		}
+	}
+	for zone := range wanted {
+		enable(zone)
+	}
+}
+
+// OutageControl 返回控制停服区域的参数，其值为以逗号分隔的停服区域，"." 表示全部区域
+func OutageControl(o *OutageResponser) DashboardControl {
+	return DashboardControl{
+		Name:        "outage",
+		Description: "zones that are down, separated by commas, \".\" for all zones",
+		Get: func() string {
+			return strings.Join(o.Status().Down, ",")
+		},
+		Set: func(value string) error {
+			setZones(o.Status().Down, value, o.Down, o.Up)
+			return nil
+		},
+	}
+}
+
+// TransportSplitControl 返回控制传输差异回复区域的参数，其值为以逗号分隔的区域
+func TransportSplitControl(t *TransportSplitResponser) DashboardControl {
+	return DashboardControl{
+		Name:        "transport_split",
+		Description: "zones whose UDP answers are truncated, separated by commas",
+		Get: func() string {
+			return strings.Join(t.Status().Zones, ",")
+		},
+		Set: func(value string) error {
+			setZones(t.Status().Zones, value, t.Enable, t.Disable)
+			return nil
+		},
+	}
+}
+
+// Dashboard 实验仪表盘，各字段均可为空，相应部分此时不显示
+type Dashboard struct {
+	// 服务器状态检视器，其 API 由仪表盘一并提供
+	Inspector *Inspector
+	// 流量计，应与 SamplingResponser.Meter 相同
+	Meter *TrafficMeter
+	// 可控制的攻击参数
+	Controls []DashboardControl
+}
+
+// dashboardControlState 记录参数及其当前值
+type dashboardControlState struct {
+	DashboardControl
+	Value string `json:"value"`
+}
+
+// controls 返回全部参数的当前值
+func (d *Dashboard) controls() []dashboardControlState {
+	states := []dashboardControlState{}
+	for _, c := range d.Controls {
+		states = append(states, dashboardControlState{DashboardControl: c, Value: c.Get()})
+	}
+	return states
+}
+
+// NewDashboardHandler 创建仪表盘的 HTTP 处理器，端点详见文件注释
+// 其接受参数为：
+//   - d *Dashboard，仪表盘
+//
+// 返回值为：
+//   - http.Handler，仪表盘的 HTTP 处理器
+func NewDashboardHandler(d *Dashboard) http.Handler {
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardPage)
+	})
+	mux.HandleFunc("/dashboard/traffic", func(w http.ResponseWriter, r *http.Request) {
+		if d.Meter == nil {
+			writeJSON(w, nil)
+			return
+		}
+		writeJSON(w, d.Meter.Report(time.Now()))
+	})
+	mux.HandleFunc("/dashboard/controls", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			name, value := r.URL.Query().Get("name"), r.URL.Query().Get("value")
+			found := false
+			for _, c := range d.Controls {
+				if c.Name != name {
+					continue
+				}
+				found = true
+				if err := c.Set(value); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if !found {
+				http.Error(w, fmt.Sprintf("unknown control %q", name), http.StatusNotFound)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, d.controls())
+	})
+	if d.Inspector != nil {
+		inspect := NewInspectionHandler(d.Inspector)
+		mux.Handle("/inspect", inspect)
+		mux.Handle("/inspect/", inspect)
+	}
+	return mux
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// diagnostics.go 文件定义了可选的运行时诊断 HTTP 服务，
+// 在 ServerConfig.DiagnosticsAddr 不为空时随服务器启动，提供以下端点：
+//   - /debug/pprof/：pprof 性能剖析，如 /debug/pprof/profile?seconds=30
+//   - /debug/vars：expvar 变量，包括内存统计及 xdns 查询计数
+//   - /debug/goroutines：全部协程的调用栈
+//   - /health：健康检查，返回 JSON 格式的运行状态
+//
+// 诊断服务不进行任何认证，应仅监听于本地或受信任的网络，如 "127.0.0.1:6060"。
+
+package xdns
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// serverVars 记录服务器的查询计数，经由 /debug/vars 中的 "xdns" 变量导出
+var serverVars = expvar.NewMap("xdns")
+
+// NewDiagnosticsHandler 创建诊断服务的 HTTP 处理器
+// 其接受参数为：
+//   - started time.Time，服务器的启动时间，用于计算运行时长
+//
+// 返回值为：
+//   - http.Handler，诊断服务的 HTTP 处理器
+func NewDiagnosticsHandler(started time.Time) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	mux.HandleFunc("/debug/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		pprof.Handler("goroutine").ServeHTTP(w, withQuery(r, "debug", "2"))
+	})
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     "ok",
+			"uptime":     time.Since(started).String(),
+			"goroutines": runtime.NumGoroutine(),
+		})
+	})
+	return mux
+}
+
+// withQuery 返回设置了指定查询参数的请求副本
+func withQuery(r *http.Request, key, value string) *http.Request {
+	r = r.Clone(r.Context())
+	query := r.URL.Query()
+	query.Set(key, value)
+	r.URL.RawQuery = query.Encode()
+	return r
+}
+
+// startDiagnostics 在后台启动诊断服务
+func (s *XdnsServer) startDiagnostics() {
+	s.diagnostics = &http.Server{
+		Addr:    s.Config.DiagnosticsAddr,
+		Handler: NewDiagnosticsHandler(time.Now()),
+	}
+	go func() {
+		s.Logger.Printf("Diagnostics listening on %s.", s.Config.DiagnosticsAddr)
+		if err := s.diagnostics.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.Logger.Printf("Error serving diagnostics: %v", err)
+		}
+	}()
+}
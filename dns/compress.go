@@ -0,0 +1,142 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// compress.go 文件实现了 DNS 消息的名称压缩（RFC 1035 4.1.4 节）。
+// 压缩作用于已解码的 DNSMessage：问题及资源记录的所有者名称，
+// 以及允许压缩的 RDATA 中的域名（NS、CNAME、PTR、SOA 的 MNAME 与 RNAME，RFC 3597 4 节）
+// 均以指向先前出现的相同后缀的指针代替，并按压缩后的 RDATA 长度重新计算 RDLEN。
+// 其余类型（如 DNAME、RRSIG、NSEC、MX 等以未知类型解码的记录）的 RDATA 原样写出，
+// 以免不识别该类型的接收方无法解析其中的指针。
+//
+// 后缀按字节精确匹配，不忽略大小写，使压缩后的消息保留每个名称原有的大小写。
+
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxCompressionOffset 为压缩指针可以表示的最大偏移量
+const maxCompressionOffset = 0x3FFF
+
+// nameCompressor 记录消息中已写出的名称后缀及其偏移量
+type nameCompressor struct {
+	offsets map[string]int
+}
+
+// appendName 将名称的线路格式追加到 msg 之后，compress 为 true 时以指针代替已出现过的最长后缀。
+// 新写出的每个后缀均被记录，以供之后的名称引用；不合法的线路格式将被原样写出且不被记录。
+func (c *nameCompressor) appendName(msg, wire []byte, compress bool) []byte {
+	if !wellFormedName(wire) {
+		return append(msg, wire...)
+	}
+	start := len(msg)
+	for i := 0; wire[i] != 0; i += int(wire[i]) + 1 {
+		if compress {
+			if ptr, ok := c.offsets[string(wire[i:])]; ok {
+				msg = append(msg, wire[:i]...)
+				msg = binary.BigEndian.AppendUint16(msg, uint16(0xC000|ptr))
+				c.record(wire[:i], wire[i:], start)
+				return msg
+			}
+		}
+	}
+	msg = append(msg, wire...)
+	c.record(wire[:len(wire)-1], wire[len(wire)-1:], start)
+	return msg
+}
+
+// record 记录以 start 为起点写出的名称中，位于 prefix 部分的每个后缀，suffix 为其后已存在的部分
+func (c *nameCompressor) record(prefix, suffix []byte, start int) {
+	for i := 0; i < len(prefix); i += int(prefix[i]) + 1 {
+		if start+i > maxCompressionOffset {
+			return
+		}
+		key := string(prefix[i:]) + string(suffix)
+		if _, ok := c.offsets[key]; !ok {
+			c.offsets[key] = start + i
+		}
+	}
+}
+
+// wellFormedName 检查名称的线路格式是否为不含指针、以根标签结尾的标签序列
+func wellFormedName(wire []byte) bool {
+	i := 0
+	for i < len(wire) && wire[i] != 0 {
+		if wire[i] > 63 {
+			return false
+		}
+		i += int(wire[i]) + 1
+	}
+	return i == len(wire)-1
+}
+
+// appendRDATA 将 RDATA 追加到 msg 之后，允许压缩的域名经由压缩器写出
+func (c *nameCompressor) appendRDATA(msg []byte, rdata DNSRRRDATA) []byte {
+	switch rdata := rdata.(type) {
+	case *DNSRDATANS:
+		return c.appendName(msg, EncodeDomainName(&rdata.NSDNAME), true)
+	case *DNSRDATACNAME:
+		return c.appendName(msg, EncodeDomainName(&rdata.CNAME), true)
+	case *DNSRDATAPTR:
+		return c.appendName(msg, EncodeDomainName(&rdata.PTR), true)
+	case *DNSRDATASOA:
+		msg = c.appendName(msg, EncodeDomainName(&rdata.MName), true)
+		msg = c.appendName(msg, EncodeDomainName(&rdata.RName), true)
+		msg = binary.BigEndian.AppendUint32(msg, rdata.Serial)
+		msg = binary.BigEndian.AppendUint32(msg, rdata.Refresh)
+		msg = binary.BigEndian.AppendUint32(msg, rdata.Retry)
+		msg = binary.BigEndian.AppendUint32(msg, rdata.Expire)
+		return binary.BigEndian.AppendUint32(msg, rdata.Minimum)
+	}
+	return append(msg, rdata.Encode()...)
+}
+
+// EncodeCompressed 将 DNS 消息编码为压缩格式。
+// - 其返回值为 压缩后的字节切片 和 错误信息。
+// 资源记录的 RDLen 字段将被忽略，RDLEN 按实际写出的 RDATA 长度填写；
+// 头部的计数字段原样写出，与 Encode 相同。
+func (dnsMessage *DNSMessage) EncodeCompressed() ([]byte, error) {
+	c := nameCompressor{offsets: make(map[string]int)}
+	msg := make([]byte, 0, dnsMessage.Size())
+	msg = append(msg, dnsMessage.Header.Encode()...)
+
+	for _, question := range dnsMessage.Question {
+		msg = c.appendName(msg, question.Name.WiredBytes, true)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(question.Type))
+		msg = binary.BigEndian.AppendUint16(msg, uint16(question.Class))
+	}
+	for _, section := range []DNSResponseSection{dnsMessage.Answer, dnsMessage.Authority, dnsMessage.Additional} {
+		for _, rr := range section {
+			msg = c.appendName(msg, rr.Name.WiredBytes, true)
+			msg = binary.BigEndian.AppendUint16(msg, uint16(rr.Type))
+			msg = binary.BigEndian.AppendUint16(msg, uint16(rr.Class))
+			msg = binary.BigEndian.AppendUint32(msg, rr.TTL)
+			rdLenOffset := len(msg)
+			msg = append(msg, 0, 0)
+			msg = c.appendRDATA(msg, rr.RData)
+			rdLen := len(msg) - rdLenOffset - 2
+			if rdLen > 0xFFFF {
+				return nil, fmt.Errorf("method DNSMessage EncodeCompressed failed: RDATA of %s %s is %d bytes long", rr.Name.DomainName, rr.Type, rdLen)
+			}
+			binary.BigEndian.PutUint16(msg[rdLenOffset:], uint16(rdLen))
+		}
+	}
+	return msg, nil
+}
+
+// CompressDNSMessage 对 DNS 消息进行压缩。
+// - 其接收参数为 编码后的 DNS 消息，其本身可以已被压缩，
+// - 返回值为 压缩后的 DNS 消息 及 错误信息。
+// 消息将被解码后经由 EncodeCompressed 重新编码，详见 compress.go。
+func CompressDNSMessage(msg []byte) ([]byte, error) {
+	dnsMessage := DNSMessage{}
+	if _, err := dnsMessage.DecodeFromBuffer(msg, 0); err != nil {
+		return nil, fmt.Errorf("function CompressDNSMessage failed: decode message failed.\n%v", err)
+	}
+	cMsg, err := dnsMessage.EncodeCompressed()
+	if err != nil {
+		return nil, fmt.Errorf("function CompressDNSMessage failed:\n%v", err)
+	}
+	return cMsg, nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// compress_test.go 文件定义了对 compress.go 的单元测试。
+// 随机生成的消息经压缩后应能被解码器还原，且压缩后的消息不长于未压缩的消息。
+
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// compressLabels 为随机名称使用的标签，数量较少以使名称之间共享后缀
+var compressLabels = []string{"www", "mail", "ns1", "example", "com", "net", "a", "Example", "sub"}
+
+// randomSharedName 生成由 compressLabels 组成的随机名称
+func randomSharedName(r *rand.Rand) string {
+	if r.Intn(15) == 0 {
+		return "."
+	}
+	labels := make([]string, 1+r.Intn(4))
+	for i := range labels {
+		labels[i] = compressLabels[r.Intn(len(compressLabels))]
+	}
+	return strings.Join(labels, ".")
+}
+
+// randomCompressRR 生成随机的资源记录，其 RDATA 类型覆盖允许及不允许压缩的类型
+func randomCompressRR(r *rand.Rand) DNSResourceRecord {
+	rr := DNSResourceRecord{
+		Name:  *NewDNSName(randomSharedName(r)),
+		Class: DNSClassIN,
+		TTL:   r.Uint32(),
+	}
+	switch r.Intn(8) {
+	case 0:
+		rr.RData = &DNSRDATAA{Address: IPv4(byte(r.Intn(256)), 0, 2, 1)}
+	case 1:
+		rr.RData = &DNSRDATANS{NSDNAME: randomSharedName(r)}
+	case 2:
+		rr.RData = &DNSRDATACNAME{CNAME: randomSharedName(r)}
+	case 3:
+		rr.RData = &DNSRDATAPTR{PTR: randomSharedName(r)}
+	case 4:
+		rr.RData = &DNSRDATASOA{MName: randomSharedName(r), RName: randomSharedName(r), Serial: r.Uint32(), Minimum: r.Uint32()}
+	case 5:
+		rr.RData = &DNSRDATADNAME{DNAME: randomSharedName(r)}
+	case 6:
+		// 以未知类型解码的 MX
+		rdata := binary.BigEndian.AppendUint16(nil, uint16(r.Intn(100)))
+		name := randomSharedName(r)
+		rr.RData = &DNSRDATAUnknown{RRType: DNSRRTypeMX, RData: append(rdata, EncodeDomainName(&name)...)}
+	default:
+		names := []string{"RRSIG", "NSEC", "TXT"}
+		rr.RData = propertyGenerators[names[r.Intn(len(names))]](r)
+	}
+	rr.Type = rr.RData.Type()
+	rr.RDLen = uint16(rr.RData.Size())
+	return rr
+}
+
+// randomCompressMessage 生成随机的 DNS 消息
+func randomCompressMessage(r *rand.Rand) DNSMessage {
+	msg := DNSMessage{
+		Header: DNSHeader{ID: uint16(r.Intn(1 << 16)), QR: true, RD: true},
+		Question: []DNSQuestion{
+			{Name: *NewDNSName(randomSharedName(r)), Type: DNSRRTypeA, Class: DNSClassIN},
+		},
+	}
+	for _, section := range []*DNSResponseSection{&msg.Answer, &msg.Authority, &msg.Additional} {
+		for n := r.Intn(6); n > 0; n-- {
+			*section = append(*section, randomCompressRR(r))
+		}
+	}
+	msg.Header.QDCount = uint16(len(msg.Question))
+	msg.Header.ANCount = uint16(len(msg.Answer))
+	msg.Header.NSCount = uint16(len(msg.Authority))
+	msg.Header.ARCount = uint16(len(msg.Additional))
+	return msg
+}
+
+// compareRecords 比较解码所得的资源记录与原资源记录，不比较 RDLen
+func compareRecords(t *testing.T, got, expected DNSResponseSection) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("record count not match: got %d, expected %d", len(got), len(expected))
+	}
+	for i := range expected {
+		g, e := got[i], expected[i]
+		if g.Name.DomainName != e.Name.DomainName || !bytes.Equal(g.Name.WiredBytes, e.Name.WiredBytes) {
+			t.Fatalf("owner name not match: got %s (%x), expected %s (%x)", g.Name.DomainName, g.Name.WiredBytes, e.Name.DomainName, e.Name.WiredBytes)
+		}
+		if g.Type != e.Type || g.Class != e.Class || g.TTL != e.TTL {
+			t.Fatalf("record %s fields not match:\ngot: %s %d %d\nexpected: %s %d %d", e.Name.DomainName, g.Type, g.Class, g.TTL, e.Type, e.Class, e.TTL)
+		}
+		if int(g.RDLen) != len(g.RData.Encode()) && !compressible(e.Type) {
+			t.Fatalf("record %s %s RDLEN %d, RDATA is %d bytes", e.Name.DomainName, e.Type, g.RDLen, len(g.RData.Encode()))
+		}
+		if !g.RData.Equal(e.RData) {
+			t.Fatalf("record %s %s RDATA not match:\ngot:\n%s\nexpected:\n%s", e.Name.DomainName, e.Type, g.RData, e.RData)
+		}
+	}
+}
+
+// compressible 判断类型的 RDATA 中是否存在允许压缩的名称
+func compressible(t DNSType) bool {
+	return t == DNSRRTypeNS || t == DNSRRTypeCNAME || t == DNSRRTypePTR || t == DNSRRTypeSOA
+}
+
+// checkPointers 检查压缩消息中的名称指针均指向其之前的位置
+func checkPointers(t *testing.T, msg []byte) {
+	t.Helper()
+	var walk func(offset int, limit int)
+	walk = func(offset, limit int) {
+		for msg[offset] != 0 {
+			if msg[offset] >= NamePointerFlag {
+				ptr := int(binary.BigEndian.Uint16(msg[offset:]) & 0x3FFF)
+				if ptr >= limit {
+					t.Fatalf("pointer at %d points forward to %d", offset, ptr)
+				}
+				walk(ptr, ptr)
+				return
+			}
+			offset += int(msg[offset]) + 1
+		}
+	}
+	// 逐个检查问题及资源记录的所有者名称
+	offset := 12
+	qdCount := int(binary.BigEndian.Uint16(msg[4:]))
+	rrCount := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	for i := 0; i < qdCount+rrCount; i++ {
+		walk(offset, offset)
+		_, next, err := DecodeDomainNameFromBuffer(msg, offset)
+		if err != nil {
+			t.Fatalf("decode owner name at %d failed: %v", offset, err)
+		}
+		offset = next + 4
+		if i >= qdCount {
+			offset += 6 + int(binary.BigEndian.Uint16(msg[offset+4:]))
+		}
+	}
+	if offset != len(msg) {
+		t.Fatalf("message walked to %d, expected %d", offset, len(msg))
+	}
+}
+
+// TestEncodeCompressedRoundTrip 测试随机消息经压缩后能被解码器还原
+func TestEncodeCompressedRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(20241015))
+	for i := 0; i < propertyIterations; i++ {
+		msg := randomCompressMessage(r)
+		plain := msg.Encode()
+		compressed, err := msg.EncodeCompressed()
+		if err != nil {
+			t.Fatalf("function EncodeCompressed() failed:\n%v", err)
+		}
+		if len(compressed) > len(plain) {
+			t.Fatalf("compressed message is longer: %d > %d", len(compressed), len(plain))
+		}
+		checkPointers(t, compressed)
+
+		decoded := DNSMessage{}
+		end, err := decoded.DecodeFromBuffer(compressed, 0)
+		if err != nil {
+			t.Fatalf("function DecodeFromBuffer() failed:\n%v\nmessage: %x", err, compressed)
+		}
+		if end != len(compressed) {
+			t.Fatalf("function DecodeFromBuffer() stopped at %d, expected %d", end, len(compressed))
+		}
+		if decoded.Header != msg.Header {
+			t.Fatalf("header not match:\ngot: %+v\nexpected: %+v", decoded.Header, msg.Header)
+		}
+		if decoded.Question[0].Name.DomainName != msg.Question[0].Name.DomainName {
+			t.Fatalf("question not match: got %s, expected %s", decoded.Question[0].Name.DomainName, msg.Question[0].Name.DomainName)
+		}
+		compareRecords(t, decoded.Answer, msg.Answer)
+		compareRecords(t, decoded.Authority, msg.Authority)
+		compareRecords(t, decoded.Additional, msg.Additional)
+
+		// 解码所得的消息以未压缩的格式重新编码后应与原消息相同
+		for _, section := range []DNSResponseSection{decoded.Answer, decoded.Authority, decoded.Additional} {
+			for j := range section {
+				section[j].RDLen = 0
+			}
+		}
+		if reencoded := decoded.Encode(); !bytes.Equal(reencoded, plain) {
+			t.Fatalf("re-encoded message not match:\ngot: %x\nexpected: %x", reencoded, plain)
+		}
+
+		// 压缩已压缩的消息不改变其内容
+		again, err := CompressDNSMessage(compressed)
+		if err != nil {
+			t.Fatalf("function CompressDNSMessage() failed:\n%v", err)
+		}
+		if !bytes.Equal(again, compressed) {
+			t.Fatalf("function CompressDNSMessage() is not idempotent:\ngot: %x\nexpected: %x", again, compressed)
+		}
+	}
+}
+
+// TestEncodeCompressedNames 测试各类名称的压缩方式
+func TestEncodeCompressedNames(t *testing.T) {
+	msg := DNSMessage{
+		Header: DNSHeader{ID: 1, QR: true, QDCount: 1, ANCount: 4, NSCount: 1},
+		Question: []DNSQuestion{
+			{Name: *NewDNSName("www.example.com"), Type: DNSRRTypeA, Class: DNSClassIN},
+		},
+		Answer: []DNSResourceRecord{
+			{Name: *NewDNSName("www.example.com"), Type: DNSRRTypeCNAME, Class: DNSClassIN, TTL: 60,
+				RData: &DNSRDATACNAME{CNAME: "mail.example.com"}},
+			{Name: *NewDNSName("MAIL.example.com"), Type: DNSRRTypeA, Class: DNSClassIN, TTL: 60,
+				RData: &DNSRDATAA{Address: IPv4(192, 0, 2, 1)}},
+			{Name: *NewDNSName("a.example.com"), Type: DNSRRTypeDNAME, Class: DNSClassIN, TTL: 60,
+				RData: &DNSRDATADNAME{DNAME: "example.com"}},
+			{Name: *NewDNSName("www.example.com"), Type: DNSRRTypeRRSIG, Class: DNSClassIN, TTL: 60,
+				RData: &DNSRDATARRSIG{TypeCovered: DNSRRTypeCNAME, SignerName: "example.com", Signature: []byte{1, 2, 3}}},
+		},
+		Authority: []DNSResourceRecord{
+			{Name: *NewDNSName("example.com"), Type: DNSRRTypeSOA, Class: DNSClassIN, TTL: 60,
+				RData: &DNSRDATASOA{MName: "ns1.example.com", RName: "hostmaster.example.com"}},
+		},
+	}
+	compressed, err := msg.EncodeCompressed()
+	if err != nil {
+		t.Fatalf("function EncodeCompressed() failed:\n%v", err)
+	}
+
+	// 问题名称位于偏移量 12，"example.com" 后缀位于偏移量 16
+	pointer := func(offset int) []byte { return []byte{0xC0, byte(offset)} }
+	offset := 12 + 17 + 4
+	expected := [][]byte{
+		// CNAME 的所有者名称整体压缩
+		pointer(12),
+		// CNAME RDATA 中的名称压缩后缀
+		append([]byte("\x04mail"), pointer(16)...),
+	}
+	for _, e := range expected {
+		if !bytes.Contains(compressed[offset:], e) {
+			t.Fatalf("compressed name %x not found in %x", e, compressed[offset:])
+		}
+	}
+	// 大小写不同的标签不被压缩
+	if !bytes.Contains(compressed, []byte("\x04MAIL")) {
+		t.Errorf("owner name MAIL.example.com should keep its case")
+	}
+	// DNAME 及 RRSIG 的 RDATA 原样写出
+	for _, rr := range msg.Answer[2:] {
+		if !bytes.Contains(compressed, rr.RData.Encode()) {
+			t.Errorf("RDATA of %s should not be compressed", rr.Type)
+		}
+	}
+	// SOA 的两个名称均被压缩
+	soa := append(append([]byte("\x03ns1"), pointer(16)...), append([]byte("\x0ahostmaster"), pointer(16)...)...)
+	if !bytes.Contains(compressed, soa) {
+		t.Errorf("SOA names should be compressed: %x", compressed)
+	}
+
+	decoded := DNSMessage{}
+	if _, err := decoded.DecodeFromBuffer(compressed, 0); err != nil {
+		t.Fatalf("function DecodeFromBuffer() failed:\n%v", err)
+	}
+	compareRecords(t, decoded.Answer, msg.Answer)
+	compareRecords(t, decoded.Authority, msg.Authority)
+}
+
+// TestCompressDNSMessageInvalid 测试无法解码的消息
+func TestCompressDNSMessageInvalid(t *testing.T) {
+	if _, err := CompressDNSMessage([]byte{0, 1, 2}); err == nil {
+		t.Errorf("function CompressDNSMessage() should fail on a truncated message")
+	}
+}
+
+// TestWellFormedName 测试名称线路格式的检查
+func TestWellFormedName(t *testing.T) {
+	names := []string{".", "com", "www.example.com"}
+	for _, name := range names {
+		if !wellFormedName(EncodeDomainName(&name)) {
+			t.Errorf("%s should be well formed", name)
+		}
+	}
+	malformed := [][]byte{{}, {3, 'c', 'o', 'm'}, {0xC0, 12}, {3, 'c', 'o', 'm', 0, 0}}
+	for _, wire := range malformed {
+		if wellFormedName(wire) {
+			t.Errorf("%x should not be well formed", wire)
+		}
+	}
+}
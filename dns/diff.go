@@ -0,0 +1,106 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// diff.go 文件提供了 DNS 消息的差异比较工具。
+// 不同于 Equal 方法只返回是否相等，Diff 会给出逐字段的差异描述，
+// 便于在重构回复器时定位两份回复之间的不同之处。
+
+package dns
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Diff 比较两个 DNS 消息，返回其逐字段的差异描述。
+// 其接受参数为：
+//   - a *DNSMessage，待比较的 DNS 消息
+//   - b *DNSMessage，待比较的另一个 DNS 消息
+//
+// 返回值为：
+//   - []string，差异描述，两个消息相等时返回空切片
+func Diff(a, b *DNSMessage) []string {
+	diffs := []string{}
+	if a.Header != b.Header {
+		diffs = append(diffs, fmt.Sprintf("Header: %+v != %+v", a.Header, b.Header))
+	}
+
+	if len(a.Question) != len(b.Question) {
+		diffs = append(diffs, fmt.Sprintf("Question: length %d != %d", len(a.Question), len(b.Question)))
+	} else {
+		for i, q := range a.Question {
+			if !q.Equal(b.Question[i]) {
+				diffs = append(diffs, fmt.Sprintf("Question#%d: %s %s != %s %s",
+					i, q.Name.DomainName, q.Type, b.Question[i].Name.DomainName, b.Question[i].Type))
+			}
+		}
+	}
+
+	diffs = append(diffs, diffSection("Answer", a.Answer, b.Answer)...)
+	diffs = append(diffs, diffSection("Authority", a.Authority, b.Authority)...)
+	diffs = append(diffs, diffSection("Additional", a.Additional, b.Additional)...)
+	return diffs
+}
+
+// diffSection 比较两个响应部分，返回其差异描述。
+func diffSection(name string, a, b DNSResponseSection) []string {
+	diffs := []string{}
+	if len(a) != len(b) {
+		diffs = append(diffs, fmt.Sprintf("%s: length %d != %d", name, len(a), len(b)))
+	}
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		ra, rb := a[i], b[i]
+		prefix := fmt.Sprintf("%s#%d(%s %s)", name, i, ra.Name.DomainName, ra.Type)
+		if !ra.Name.Equal(&rb.Name) {
+			diffs = append(diffs, fmt.Sprintf("%s: Name %s != %s", prefix, ra.Name.DomainName, rb.Name.DomainName))
+		}
+		if ra.Type != rb.Type {
+			diffs = append(diffs, fmt.Sprintf("%s: Type %s != %s", prefix, ra.Type, rb.Type))
+		}
+		if ra.Class != rb.Class {
+			diffs = append(diffs, fmt.Sprintf("%s: Class %s != %s", prefix, ra.Class, rb.Class))
+		}
+		if ra.TTL != rb.TTL {
+			diffs = append(diffs, fmt.Sprintf("%s: TTL %d != %d", prefix, ra.TTL, rb.TTL))
+		}
+		if ra.RDLen != rb.RDLen {
+			diffs = append(diffs, fmt.Sprintf("%s: RDLen %d != %d", prefix, ra.RDLen, rb.RDLen))
+		}
+		if !bytes.Equal(ra.RData.Encode(), rb.RData.Encode()) {
+			diffs = append(diffs, fmt.Sprintf("%s: RData %s != %s", prefix, ra.RData.String(), rb.RData.String()))
+		}
+	}
+	return diffs
+}
+
+// DiffBytes 比较两段 DNS 消息的编码结果，返回其差异描述。
+// 若两者字节完全一致，返回空切片；
+// 若某一方无法解码，则只给出字节层面的差异描述。
+// 其接受参数为：
+//   - a []byte，待比较的 DNS 消息编码
+//   - b []byte，待比较的另一个 DNS 消息编码
+//
+// 返回值为：
+//   - []string，差异描述
+func DiffBytes(a, b []byte) []string {
+	if bytes.Equal(a, b) {
+		return []string{}
+	}
+
+	msgA, msgB := DNSMessage{}, DNSMessage{}
+	_, errA := msgA.DecodeFromBuffer(a, 0)
+	_, errB := msgB.DecodeFromBuffer(b, 0)
+	if errA != nil || errB != nil {
+		return []string{fmt.Sprintf("Bytes: %d bytes != %d bytes (decode errors: %v, %v)", len(a), len(b), errA, errB)}
+	}
+
+	diffs := Diff(&msgA, &msgB)
+	if len(diffs) == 0 {
+		// 解码结果一致，但编码不同（如名称压缩方式不同）
+		diffs = append(diffs, fmt.Sprintf("Bytes: %d bytes != %d bytes, decoded messages are equal", len(a), len(b)))
+	}
+	return diffs
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// diff_test.go 文件用于对 diff.go 文件所实现的 DNS 消息差异比较进行测试。
+
+package dns
+
+import (
+	"testing"
+)
+
+// 测试 Diff 函数
+func TestDiff(t *testing.T) {
+	// 相等的情况
+	if diffs := Diff(&testedDNS, &testedDNS); len(diffs) != 0 {
+		t.Errorf(" function Diff() failed: expected no diff but got:\n%v", diffs)
+	}
+
+	// 头部及回答部分不同的情况
+	other := testedDNS
+	other.Header.ID = 0x4321
+	other.Answer = DNSResponseSection{
+		{
+			Name:  *NewDNSName("www.example.com"),
+			Type:  DNSRRTypeA,
+			Class: DNSClassIN,
+			TTL:   3600,
+			RData: &DNSRDATAA{Address: IPv4(10, 10, 0, 3)},
+		},
+	}
+	diffs := Diff(&testedDNS, &other)
+	if len(diffs) != 2 {
+		t.Errorf(" function Diff() failed:\ngot:%d diffs\n%v\nexpected: 2", len(diffs), diffs)
+	}
+}
+
+// 测试 DiffBytes 函数
+func TestDiffBytes(t *testing.T) {
+	if diffs := DiffBytes(testedDNSEncoded, testedDNSEncoded); len(diffs) != 0 {
+		t.Errorf(" function DiffBytes() failed: expected no diff but got:\n%v", diffs)
+	}
+
+	// 无法解码的情况
+	diffs := DiffBytes(testedDNSEncoded, testedDNSEncoded[:5])
+	if len(diffs) != 1 {
+		t.Errorf(" function DiffBytes() failed:\ngot:%d diffs\n%v\nexpected: 1", len(diffs), diffs)
+	}
+}
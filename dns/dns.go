@@ -10,6 +10,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
 )
 
 // DNS消息结构定义在 RFC 1034 / RFC 1035 中
@@ -208,43 +209,28 @@ func (dnsMessage *DNSMessage) Equal(other *DNSMessage) bool {
 }
 
 // Encode 将DNSMessage编码到字节切片中。
+// 按 Size 一次性分配结果切片，各部分直接写入其中，不产生中间切片；
+// 消息较大时并行编码，见 encode.go。
 func (dnsMessage *DNSMessage) Encode() []byte {
 	bytesArray := make([]byte, dnsMessage.Size())
-	// 编码头部
-	offset, err := dnsMessage.Header.EncodeToBuffer(bytesArray)
-	if err != nil {
-		panic(fmt.Sprintln("method DNSMessage Encode error(Header):\n", err))
-	}
-
-	// 编码查询部分
-	increment, err := dnsMessage.Question.EncodeToBuffer(bytesArray[offset:])
-	offset += increment
-	if err != nil {
-		panic(fmt.Sprintln("method DNSMessage Encode error(Question Section):\n", err))
-	}
-	// 编码回答部分
-	increment, err = dnsMessage.Answer.EncodeToBuffer(bytesArray[offset:])
-	offset += increment
-	if err != nil {
-		panic(fmt.Sprintln("method DNSMessage Encode error(Answer Section):\n", err))
-	}
-
-	// 编码权威部分
-	increment, err = dnsMessage.Authority.EncodeToBuffer(bytesArray[offset:])
-	offset += increment
-	if err != nil {
-		panic(fmt.Sprintln("method DNSMessage Encode error(Authority Section):\n", err))
+	if _, err := dnsMessage.encodeSized(bytesArray); err != nil {
+		panic(fmt.Sprintln("method DNSMessage Encode error:\n", err))
 	}
+	// 编码完成⚡
+	return bytesArray
+}
 
-	// 编码附加部分
-	increment, err = dnsMessage.Additional.EncodeToBuffer(bytesArray[offset:])
-	offset += increment
+// AppendEncode 将DNS消息编码后追加到 dst 之后。
+// - 其接收参数：目标切片，容量不足时按 Size 扩容一次
+// - 返回值为 追加后的切片 和 错误信息。
+func (dnsMessage *DNSMessage) AppendEncode(dst []byte) ([]byte, error) {
+	size := dnsMessage.Size()
+	dst = slices.Grow(dst, size)
+	n, err := dnsMessage.encodeSized(dst[len(dst) : len(dst)+size])
 	if err != nil {
-		panic(fmt.Sprintln("method DNSMessage Encode error(Additional Section):\n", err))
+		return dst, fmt.Errorf("method DNSMessage AppendEncode failed:\n%v", err)
 	}
-
-	// 编码完成⚡
-	return bytesArray
+	return dst[:len(dst)+n], nil
 }
 
 // EncodeToBuffer 将DNS消息编码到传入的缓冲区中。
@@ -724,6 +710,15 @@ func (rr *DNSResourceRecord) Equal(other DNSResourceRecord) bool {
 // String 以*易读的形式*返回 DNS 资源记录的字符串表示。
 //   - 其返回值为 DNS 资源记录的字符串表示。
 func (rr *DNSResourceRecord) String() string {
+	// OPT 记录的 CLASS 及 TTL 字段另有含义，以类型化字段的形式展示
+	if rr.Type == DNSRRTypeOPT {
+		return fmt.Sprint(
+			"### DNS Resource Record ###\n",
+			"Name:", rr.Name.String(), "\n",
+			"RDLen:", rr.RDLen, "\n",
+			optRecordOf(rr).String(),
+		)
+	}
 	return fmt.Sprint(
 		"### DNS Resource Record ###\n",
 		"Name:", rr.Name.String(), "\n",
@@ -316,3 +316,63 @@ func TestDNSDecodeFromBuffer2(t *testing.T) {
 	}
 	t.Logf("DNS DecodeFromBuffer2():\n%s", decodedDNS.String())
 }
+
+// 测试 DNS 的 AppendEncode 方法
+func TestDNSAppendEncode(t *testing.T) {
+	prefix := []byte{0xde, 0xad}
+	appended, err := testedDNS.AppendEncode(prefix)
+	if err != nil {
+		t.Fatalf(" function DNSAppendEncode() failed:\n%s", err)
+	}
+	if !bytes.Equal(appended, append([]byte{0xde, 0xad}, testedDNSEncoded...)) {
+		t.Errorf(" function DNSAppendEncode() failed:\ngot:\n%v\nexpected:\n%v",
+			appended, testedDNSEncoded)
+	}
+}
+
+// benchmarkDNSMessage 返回约 60KB 的回复，包含大量 TXT 记录及 RRSIG 记录
+func benchmarkDNSMessage() DNSMessage {
+	msg := DNSMessage{
+		Header:   DNSHeader{ID: 0x1234, QR: true, AA: true},
+		Question: []DNSQuestion{testedDNSQuestion},
+	}
+	txt := &DNSRDATATXT{TXT: []string{string(bytes.Repeat([]byte{'x'}, 255))}}
+	rrsig := &DNSRDATARRSIG{
+		TypeCovered: DNSRRTypeTXT,
+		Algorithm:   DNSSECAlgorithmRSASHA256,
+		Labels:      3,
+		OriginalTTL: 3600,
+		SignerName:  "example.com.",
+		Signature:   bytes.Repeat([]byte{0xab}, 256),
+	}
+	for msg.Size() < 60000 {
+		msg.Answer = append(msg.Answer,
+			DNSResourceRecord{Name: *NewDNSName("www.example.com."), Type: DNSRRTypeTXT, Class: DNSClassIN, TTL: 3600, RData: txt},
+			DNSResourceRecord{Name: *NewDNSName("www.example.com."), Type: DNSRRTypeRRSIG, Class: DNSClassIN, TTL: 3600, RData: rrsig},
+		)
+	}
+	msg.Header.ANCount = uint16(len(msg.Answer))
+	return msg
+}
+
+// 基准测试 DNS 的 Encode 方法
+func BenchmarkDNSEncode(b *testing.B) {
+	msg := benchmarkDNSMessage()
+	b.SetBytes(int64(msg.Size()))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.Encode()
+	}
+}
+
+// 基准测试并发调用 DNS 的 Encode 方法，模拟并发回复
+func BenchmarkDNSEncodeParallel(b *testing.B) {
+	msg := benchmarkDNSMessage()
+	b.SetBytes(int64(msg.Size()))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			msg.Encode()
+		}
+	})
+}
@@ -27,5 +27,14 @@ dns包中的每个结构体基本都实现了以下方法：
 
 dns包对 DNS 消息的格式没有强制限制，并且支持对 未知类型的资源记录 进行编解码，
 这使得其可以随意构造和解析 DNS 消息，来满足实验需求。
+
+dns包的编解码层不依赖 net 包及套接字，可以以 GOOS=js GOARCH=wasm 编译，
+供浏览器中的演示工具解码及展示 xdns 生成的消息：
+
+	GOOS=js GOARCH=wasm go build ./dns
+
+A 及 AAAA 记录的地址类型为 [IP]，在原生平台上即 net.IP 的别名，
+在 js/wasm 平台上则为提供相同语义的独立实现，
+须在两种平台上编译的代码应使用 [IPv4] 而非 net.IPv4 构造地址。
 */
 package dns
@@ -0,0 +1,169 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// encode.go 文件实现了大消息的并行编码，及供发送路径复用的编码缓冲池。
+// 编码不进行名称压缩，每条资源记录写出的长度即其 Size()，
+// 因此可以预先算出各记录在消息中的偏移，由多个协程向互不重叠的区间同时写入。
+// 数十 KB 的攻击回复（大量 RRSIG、DNSKEY 等）的编码因此不再受单个协程拷贝速度的限制。
+//
+// 编码缓冲池按 2 的幂分级，EncodePooled 借出的缓冲区须由持有者在不再引用时
+// 以 ReleaseEncodeBuffer 归还，归还后其内容会被之后的消息覆盖。
+
+package dns
+
+import (
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// parallelEncodeThreshold 为并行编码的最小消息大小，较小的消息按顺序编码更快
+	parallelEncodeThreshold = 16 << 10
+	// parallelEncodeChunk 为每个编码协程至少负责的字节数
+	parallelEncodeChunk = 8 << 10
+
+	// minPooledBufferShift 及 maxPooledBufferShift 为编码缓冲池中缓冲区容量的上下限（2 的幂次），
+	// 超出上限的消息不经缓冲池分配
+	minPooledBufferShift = 9
+	maxPooledBufferShift = 17
+)
+
+// encodeBufferPools 为各级编码缓冲池，第 i 级缓冲区的容量为 1 << (minPooledBufferShift + i)
+var encodeBufferPools [maxPooledBufferShift - minPooledBufferShift + 1]sync.Pool
+
+// pooledBufferClass 返回容纳 size 字节所需的缓冲池级别，超出上限时返回 -1
+func pooledBufferClass(size int) int {
+	if size <= 1<<minPooledBufferShift {
+		return 0
+	}
+	shift := bits.Len(uint(size - 1))
+	if shift > maxPooledBufferShift {
+		return -1
+	}
+	return shift - minPooledBufferShift
+}
+
+// EncodePooled 将DNS消息编码到借自编码缓冲池的缓冲区中，缓冲区按 Size 选取。
+// 返回的切片在持有者调用 ReleaseEncodeBuffer 之前始终有效；
+// 未归还的缓冲区由垃圾回收器回收，不会造成泄漏。
+func (dnsMessage *DNSMessage) EncodePooled() []byte {
+	size := dnsMessage.Size()
+	class := pooledBufferClass(size)
+	if class < 0 {
+		return dnsMessage.Encode()
+	}
+	var buffer []byte
+	if p, ok := encodeBufferPools[class].Get().(*[]byte); ok {
+		buffer = (*p)[:size]
+	} else {
+		buffer = make([]byte, size, 1<<(minPooledBufferShift+class))
+	}
+	if _, err := dnsMessage.encodeSized(buffer); err != nil {
+		ReleaseEncodeBuffer(buffer)
+		panic(fmt.Sprintln("method DNSMessage EncodePooled error:\n", err))
+	}
+	return buffer
+}
+
+// ReleaseEncodeBuffer 将 EncodePooled 返回的缓冲区归还编码缓冲池。
+// 调用者须保证此后不再有任何对该缓冲区（及其子切片）的引用，且同一缓冲区只归还一次；
+// 容量不属于任何缓冲池级别的切片被忽略。
+func ReleaseEncodeBuffer(buffer []byte) {
+	c := cap(buffer)
+	if c < 1<<minPooledBufferShift || c > 1<<maxPooledBufferShift || c&(c-1) != 0 {
+		return
+	}
+	buffer = buffer[:0]
+	encodeBufferPools[bits.Len(uint(c))-1-minPooledBufferShift].Put(&buffer)
+}
+
+// encodeSized 将DNS消息编码到长度恰为 Size 的缓冲区中，消息足够大时并行编码
+func (dnsMessage *DNSMessage) encodeSized(buffer []byte) (int, error) {
+	if workers := encodeWorkers(len(buffer)); workers > 1 {
+		if n, ok := dnsMessage.encodeParallel(buffer, workers); ok {
+			return n, nil
+		}
+	}
+	return dnsMessage.EncodeToBuffer(buffer)
+}
+
+// encodeWorkers 返回编码 size 字节的消息所用的协程数
+func encodeWorkers(size int) int {
+	if size < parallelEncodeThreshold {
+		return 1
+	}
+	return min(runtime.GOMAXPROCS(0), size/parallelEncodeChunk)
+}
+
+// encodeParallel 由 workers 个协程将DNS消息编码到缓冲区中。
+// 头部及问题部分按顺序写出，各部分的资源记录依次排列后按字节数均分为连续的若干段，每段由一个协程写出。
+// 任一记录写出的长度与其 Size 不符、编码出错或缓冲区不足时返回 false，
+// 由调用者按顺序重新编码，以得到与 EncodeToBuffer 相同的结果或错误。
+func (dnsMessage *DNSMessage) encodeParallel(buffer []byte, workers int) (int, bool) {
+	offset, err := dnsMessage.Header.EncodeToBuffer(buffer)
+	if err != nil {
+		return -1, false
+	}
+	for _, question := range dnsMessage.Question {
+		increment, err := question.EncodeToBuffer(buffer[offset:])
+		if err != nil {
+			return -1, false
+		}
+		offset += increment
+	}
+
+	count := len(dnsMessage.Answer) + len(dnsMessage.Authority) + len(dnsMessage.Additional)
+	records := make([]*DNSResourceRecord, 0, count)
+	for _, section := range []DNSResponseSection{dnsMessage.Answer, dnsMessage.Authority, dnsMessage.Additional} {
+		for i := range section {
+			records = append(records, &section[i])
+		}
+	}
+	sizes := make([]int, count)
+	total := 0
+	for i, rr := range records {
+		sizes[i] = rr.Size()
+		total += sizes[i]
+	}
+	if offset+total > len(buffer) {
+		return -1, false
+	}
+
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	chunk := (total + workers - 1) / workers
+	start, startOffset, length := 0, offset, 0
+	for i := range records {
+		length += sizes[i]
+		if length < chunk && i < count-1 {
+			continue
+		}
+		wg.Add(1)
+		go func(records []*DNSResourceRecord, sizes []int, part []byte) {
+			defer wg.Done()
+			// 写出的长度超出 Size 时会越界，视为编码失败
+			defer func() {
+				if recover() != nil {
+					failed.Store(true)
+				}
+			}()
+			offset := 0
+			for i, rr := range records {
+				n, err := rr.EncodeToBuffer(part[offset:])
+				if err != nil || n != sizes[i] {
+					failed.Store(true)
+					return
+				}
+				offset += n
+			}
+		}(records[start:i+1], sizes[start:i+1], buffer[startOffset:startOffset+length])
+		start, startOffset, length = i+1, startOffset+length, 0
+	}
+	wg.Wait()
+	if failed.Load() {
+		return -1, false
+	}
+	return offset + total, true
+}
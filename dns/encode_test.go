@@ -0,0 +1,130 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// encode_test.go 文件用于对 encode.go 文件所实现的并行编码及编码缓冲池进行测试。
+
+package dns
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encodeTestMessage 返回各部分均含有记录、大小超过并行编码阈值的消息
+func encodeTestMessage() DNSMessage {
+	msg := benchmarkDNSMessage()
+	msg.Authority = DNSResponseSection{
+		{Name: *NewDNSName("example.com."), Type: DNSRRTypeNS, Class: DNSClassIN, TTL: 3600, RData: &DNSRDATANS{NSDNAME: "ns.example.com."}},
+	}
+	msg.Additional = DNSResponseSection{
+		{Name: *NewDNSName("ns.example.com."), Type: DNSRRTypeA, Class: DNSClassIN, TTL: 3600, RData: &DNSRDATAA{Address: IPv4(192, 0, 2, 53)}},
+	}
+	msg.Header.NSCount, msg.Header.ARCount = 1, 1
+	return msg
+}
+
+// 测试 DNSMessage 的 encodeParallel 方法与 EncodeToBuffer 的结果相同
+func TestDNSEncodeParallel(t *testing.T) {
+	msg := encodeTestMessage()
+	expected := make([]byte, msg.Size())
+	if _, err := msg.EncodeToBuffer(expected); err != nil {
+		t.Fatalf("method DNSMessage EncodeToBuffer() failed:\n%v", err)
+	}
+	// 协程数不受 GOMAXPROCS 限制，段数多于记录数时每段至少包含一条记录
+	for _, workers := range []int{2, 3, 4, 7, len(msg.Answer) + 2} {
+		buffer := make([]byte, msg.Size())
+		n, ok := msg.encodeParallel(buffer, workers)
+		if !ok || n != len(expected) || !bytes.Equal(buffer, expected) {
+			t.Errorf("method DNSMessage encodeParallel(%d) failed: ok %v, wrote %d of %d bytes", workers, ok, n, len(expected))
+		}
+	}
+
+	// 缓冲区不足时交由顺序编码报告错误
+	if _, ok := msg.encodeParallel(make([]byte, msg.Size()-1), 4); ok {
+		t.Errorf("method DNSMessage encodeParallel() failed: short buffer accepted")
+	}
+	// 写出的长度与 Size 不符的记录使并行编码失败，而不是越界写入其他记录
+	for _, i := range []int{0, len(msg.Answer) / 2, len(msg.Answer) - 1} {
+		broken := encodeTestMessage()
+		broken.Answer[i].RData = undersizedRDATA{&DNSRDATATXT{TXT: []string{"xdns"}}}
+		if _, ok := broken.encodeParallel(make([]byte, broken.Size()), 4); ok {
+			t.Errorf("method DNSMessage encodeParallel() failed: record %d with wrong Size accepted", i)
+		}
+	}
+}
+
+// undersizedRDATA 的 Size 比其实际写出的长度少 1 字节
+type undersizedRDATA struct {
+	*DNSRDATATXT
+}
+
+func (rdata undersizedRDATA) Size() int {
+	return rdata.DNSRDATATXT.Size() - 1
+}
+
+// 测试 pooledBufferClass 函数
+func TestPooledBufferClass(t *testing.T) {
+	tests := []struct {
+		size     int
+		expected int
+	}{
+		{0, 0},
+		{512, 0},
+		{513, 1},
+		{1024, 1},
+		{65535, 7},
+		{1 << 17, 8},
+		{1<<17 + 1, -1},
+	}
+	for _, tt := range tests {
+		if got := pooledBufferClass(tt.size); got != tt.expected {
+			t.Errorf("function pooledBufferClass(%d) failed:\ngot: %d\nexpected: %d", tt.size, got, tt.expected)
+		}
+	}
+}
+
+// 测试 DNSMessage 的 EncodePooled 方法及 ReleaseEncodeBuffer 函数
+func TestDNSEncodePooled(t *testing.T) {
+	msg := encodeTestMessage()
+	expected := msg.Encode()
+	for i := 0; i < 3; i++ {
+		buffer := msg.EncodePooled()
+		if !bytes.Equal(buffer, expected) || cap(buffer) != 1<<16 {
+			t.Errorf("method DNSMessage EncodePooled() failed: round %d: len %d, cap %d", i, len(buffer), cap(buffer))
+		}
+		// 归还后的缓冲区被之后的消息覆盖，内容须与新消息一致
+		buffer[0], buffer[len(buffer)-1] = 0xff, 0xff
+		ReleaseEncodeBuffer(buffer)
+	}
+
+	small := testedDNS.EncodePooled()
+	if !bytes.Equal(small, testedDNSEncoded) || cap(small) != 512 {
+		t.Errorf("method DNSMessage EncodePooled() failed:\ngot: %v\nexpected: %v", small, testedDNSEncoded)
+	}
+	ReleaseEncodeBuffer(small)
+	// 不属于缓冲池的切片被忽略
+	ReleaseEncodeBuffer(make([]byte, 100))
+	ReleaseEncodeBuffer(make([]byte, 0, 1<<18))
+}
+
+// 基准测试按顺序将 DNS 消息编码到预先分配的缓冲区中，作为并行编码的对照
+func BenchmarkDNSEncodeSequential(b *testing.B) {
+	msg := benchmarkDNSMessage()
+	buffer := make([]byte, msg.Size())
+	b.SetBytes(int64(msg.Size()))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.EncodeToBuffer(buffer)
+	}
+}
+
+// 基准测试 DNS 的 EncodePooled 方法
+func BenchmarkDNSEncodePooled(b *testing.B) {
+	msg := benchmarkDNSMessage()
+	b.SetBytes(int64(msg.Size()))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ReleaseEncodeBuffer(msg.EncodePooled())
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// generic.go 文件实现了 RFC 3597 所定义的未知资源记录类型的表示格式。
+// 任意类型的资源记录均可表示为 "TYPE4096 \# 4 0A0A0A0A" 的形式：
+// 类型以 TYPEn 表示，RDATA 以 "\#"、RDATA 长度及十六进制编码的 RDATA 表示，
+// 十六进制部分可以以空白分隔为多段。
+
+package dns
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatDNSType 返回资源记录类型的助记符，未知类型返回 RFC 3597 的 TYPEn 形式。
+func FormatDNSType(rrType DNSType) string {
+	s := rrType.String()
+	if strings.HasPrefix(s, "Unknown") {
+		return fmt.Sprintf("TYPE%d", uint16(rrType))
+	}
+	return s
+}
+
+// ParseDNSType 解析资源记录类型的助记符或 RFC 3597 的 TYPEn 形式，不区分大小写。
+// 其接受参数为：
+//   - s string，类型助记符，如 "A"、"TYPE4096"
+//
+// 返回值为：
+//   - DNSType，资源记录类型
+//   - error，无法识别时返回错误
+func ParseDNSType(s string) (DNSType, error) {
+	s = strings.ToUpper(s)
+	if t, ok := dnsTypeMnemonics[s]; ok {
+		return t, nil
+	}
+	if strings.HasPrefix(s, "TYPE") {
+		if v, err := strconv.ParseUint(s[4:], 10, 16); err == nil {
+			return DNSType(v), nil
+		}
+	}
+	return 0, fmt.Errorf("function ParseDNSType failed: unknown record type %q", s)
+}
+
+// dnsTypeMnemonics 记录类型助记符与类型值的映射
+var dnsTypeMnemonics = func() map[string]DNSType {
+	types := map[string]DNSType{}
+	for t := 1; t < 65536; t++ {
+		s := DNSType(t).String()
+		if !strings.HasPrefix(s, "Unknown") {
+			types[s] = DNSType(t)
+		}
+	}
+	return types
+}()
+
+// FormatRDATAGeneric 以 RFC 3597 的通用格式表示任意 RDATA，如 "\# 4 0A0A0A0A"。
+// RDATA 为空时返回 "\# 0"。
+func FormatRDATAGeneric(rdata DNSRRRDATA) string {
+	wire := rdata.Encode()
+	if len(wire) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(wire), strings.ToUpper(hex.EncodeToString(wire)))
+}
+
+// ParseRDATAGeneric 解析 RFC 3597 通用格式的 RDATA。
+// 无论类型是否已知，结果均为 DNSRDATAUnknown，其编码结果即为所给出的字节，
+// 以便构造任意类型及任意内容的资源记录。
+// 其接受参数为：
+//   - rrType DNSType，资源记录类型
+//   - s string，通用格式的 RDATA，如 "\# 4 0A0A0A0A"
+//
+// 返回值为：
+//   - *DNSRDATAUnknown，解析后的 RDATA
+//   - error，格式错误或长度与数据不符时返回错误
+func ParseRDATAGeneric(rrType DNSType, s string) (*DNSRDATAUnknown, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, fmt.Errorf("function ParseRDATAGeneric failed: %q is not in the \\# <length> <hex> form", s)
+	}
+	length, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("function ParseRDATAGeneric failed: invalid RDATA length %q", fields[1])
+	}
+	wire, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("function ParseRDATAGeneric failed: invalid hex data.\n%v", err)
+	}
+	if len(wire) != int(length) {
+		return nil, fmt.Errorf("function ParseRDATAGeneric failed: RDATA length %d does not match %d bytes of data", length, len(wire))
+	}
+	return &DNSRDATAUnknown{
+		RRType: rrType,
+		RData:  wire,
+	}, nil
+}
+
+// IsRDATAGeneric 判断字符串是否为 RFC 3597 通用格式的 RDATA
+func IsRDATAGeneric(s string) bool {
+	fields := strings.Fields(s)
+	return len(fields) > 0 && fields[0] == `\#`
+}
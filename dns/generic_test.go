@@ -0,0 +1,84 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// generic_test.go 文件定义了对 generic.go 的单元测试
+
+package dns
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 测试资源记录类型的格式化及解析
+func TestFormatParseDNSType(t *testing.T) {
+	cases := []struct {
+		rrType DNSType
+		text   string
+	}{
+		{DNSRRTypeA, "A"},
+		{DNSRRTypeRRSIG, "RRSIG"},
+		{4096, "TYPE4096"},
+		{65535, "TYPE65535"},
+	}
+	for _, c := range cases {
+		if s := FormatDNSType(c.rrType); s != c.text {
+			t.Errorf("function FormatDNSType() failed:\ngot:%s\nexpected: %s", s, c.text)
+		}
+		rrType, err := ParseDNSType(c.text)
+		if err != nil || rrType != c.rrType {
+			t.Errorf("function ParseDNSType() failed:\ngot:%d, %v\nexpected: %d", rrType, err, c.rrType)
+		}
+	}
+
+	// 已知类型同样可以以 TYPEn 形式表示，且不区分大小写
+	if rrType, err := ParseDNSType("type1"); err != nil || rrType != DNSRRTypeA {
+		t.Errorf("function ParseDNSType() failed:\ngot:%d, %v\nexpected: %d", rrType, err, DNSRRTypeA)
+	}
+	for _, s := range []string{"", "TYPE", "TYPE65536", "NOPE"} {
+		if _, err := ParseDNSType(s); err == nil {
+			t.Errorf("function ParseDNSType() failed: expected an error for %q", s)
+		}
+	}
+}
+
+// 测试 RFC 3597 通用格式 RDATA 的格式化及解析
+func TestFormatParseRDATAGeneric(t *testing.T) {
+	rdata, err := ParseRDATAGeneric(4096, `\# 4 0A0A0A0A`)
+	if err != nil {
+		t.Fatalf("function ParseRDATAGeneric() failed:\n%s", err)
+	}
+	if rdata.Type() != 4096 || !bytes.Equal(rdata.Encode(), []byte{10, 10, 10, 10}) {
+		t.Errorf("function ParseRDATAGeneric() failed:\ngot:\n%s", rdata.String())
+	}
+	if s := FormatRDATAGeneric(rdata); s != `\# 4 0A0A0A0A` {
+		t.Errorf("function FormatRDATAGeneric() failed:\ngot:%s\nexpected: \\# 4 0A0A0A0A", s)
+	}
+
+	// 十六进制部分以空白分隔，且可用于已知类型
+	rdata, err = ParseRDATAGeneric(DNSRRTypeA, "\\# 4 0a0a\n 00 03")
+	if err != nil {
+		t.Fatalf("function ParseRDATAGeneric() failed:\n%s", err)
+	}
+	if !bytes.Equal(rdata.Encode(), testedDNSRDATAAEncoded) {
+		t.Errorf("function ParseRDATAGeneric() failed:\ngot:\n%v\nexpected:\n%v", rdata.Encode(), testedDNSRDATAAEncoded)
+	}
+	if s := FormatRDATAGeneric(&testedDNSRDATAA); s != `\# 4 0A0A0003` {
+		t.Errorf("function FormatRDATAGeneric() failed:\ngot:%s\nexpected: \\# 4 0A0A0003", s)
+	}
+
+	// 空 RDATA
+	rdata, err = ParseRDATAGeneric(DNSRRTypeOPT, `\# 0`)
+	if err != nil || rdata.Size() != 0 {
+		t.Errorf("function ParseRDATAGeneric() failed:\ngot:%v, %v", rdata, err)
+	}
+	if s := FormatRDATAGeneric(rdata); s != `\# 0` {
+		t.Errorf("function FormatRDATAGeneric() failed:\ngot:%s\nexpected: \\# 0", s)
+	}
+
+	// 格式错误
+	for _, s := range []string{"", "0A0A0A0A", `\#`, `\# x 0A`, `\# 2 0A`, `\# 1 0G`, `\# 70000 00`} {
+		if _, err := ParseRDATAGeneric(4096, s); err == nil {
+			t.Errorf("function ParseRDATAGeneric() failed: expected an error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// golden_test.go 文件实现了基于 golden 文件的 RDATA 往返测试框架。
+// testdata/golden 目录下的每个 .hex 文件记录一种资源记录 RDATA 的线路格式，
+// 以十六进制表示，"#" 之后为注释。对于每个文件，测试断言：
+//   - DecodeFromBuffer 解码出期望的结构体，并返回正确的偏移量；
+//   - Encode 与 EncodeToBuffer 的结果与 golden 文件逐字节相同；
+//   - Size 返回 golden 文件的长度；
+//   - 经由 DNSResourceRecord 编解码整条资源记录后结果不变。
+//
+// 新增 RDATA 类型时，应在 goldenCases 中添加用例并提供相应的 golden 文件。
+
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goldenCase 表示一个 golden 文件用例
+type goldenCase struct {
+	// golden 文件名，位于 testdata/golden 目录下
+	file string
+	// 资源记录类型
+	rrType DNSType
+	// 创建空的 RDATA 用于解码
+	new func() DNSRRRDATA
+	// 期望的解码结果
+	expected DNSRRRDATA
+}
+
+// goldenCases 记录全部 golden 文件用例
+var goldenCases = []goldenCase{
+	{"a.hex", DNSRRTypeA, func() DNSRRRDATA { return &DNSRDATAA{} },
+		&DNSRDATAA{Address: IPv4(192, 0, 2, 1)}},
+	{"aaaa.hex", DNSRRTypeAAAA, func() DNSRRRDATA { return &DNSRDATAAAAA{} },
+		&DNSRDATAAAAA{Address: IP{0x20, 0x01, 0x0d, 0xb8, 15: 0x01}}},
+	{"ns.hex", DNSRRTypeNS, func() DNSRRRDATA { return &DNSRDATANS{} },
+		&DNSRDATANS{NSDNAME: "ns1.example.com"}},
+	{"cname.hex", DNSRRTypeCNAME, func() DNSRRRDATA { return &DNSRDATACNAME{} },
+		&DNSRDATACNAME{CNAME: "www.example.com"}},
+	{"ptr.hex", DNSRRTypePTR, func() DNSRRRDATA { return &DNSRDATAPTR{} },
+		&DNSRDATAPTR{PTR: "host.example.com"}},
+	{"dname.hex", DNSRRTypeDNAME, func() DNSRRRDATA { return &DNSRDATADNAME{} },
+		&DNSRDATADNAME{DNAME: "example.net"}},
+	{"soa.hex", DNSRRTypeSOA, func() DNSRRRDATA { return &DNSRDATASOA{} },
+		&DNSRDATASOA{
+			MName: "ns.example.com", RName: "hostmaster.example.com",
+			Serial: 2024101501, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300,
+		}},
+	{"txt.hex", DNSRRTypeTXT, func() DNSRRRDATA { return &DNSRDATATXT{} },
+		&DNSRDATATXT{TXT: []string{"hello world"}}},
+	{"txt-multi.hex", DNSRRTypeTXT, func() DNSRRRDATA { return &DNSRDATATXT{} },
+		&DNSRDATATXT{TXT: []string{"v=spf1", "", "-all"}}},
+	{"rrsig.hex", DNSRRTypeRRSIG, func() DNSRRRDATA { return &DNSRDATARRSIG{} },
+		&DNSRDATARRSIG{
+			TypeCovered: DNSRRTypeA, Algorithm: 13, Labels: 2,
+			OriginalTTL: 3600, Expiration: 1731628800, Inception: 1728950400,
+			KeyTag: 12345, SignerName: "example.com",
+			Signature: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		}},
+	{"dnskey.hex", DNSRRTypeDNSKEY, func() DNSRRRDATA { return &DNSRDATADNSKEY{} },
+		&DNSRDATADNSKEY{
+			Flags: 257, Protocol: 3, Algorithm: 13,
+			PublicKey: []byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17},
+		}},
+	{"ds.hex", DNSRRTypeDS, func() DNSRRRDATA { return &DNSRDATADS{} },
+		&DNSRDATADS{KeyTag: 12345, Algorithm: 13, DigestType: 2, Digest: goldenSequence(0x20, 32)}},
+	{"nsec.hex", DNSRRTypeNSEC, func() DNSRRRDATA { return &DNSRDATANSEC{} },
+		&DNSRDATANSEC{
+			NextDomainName: "host.example.com",
+			TypeBitMaps:    []DNSType{DNSRRTypeA, DNSRRTypeRRSIG, DNSRRTypeNSEC},
+		}},
+	{"nsec3.hex", DNSRRTypeNSEC3, func() DNSRRRDATA { return &DNSRDATANSEC3{} },
+		&DNSRDATANSEC3{
+			HashAlgorithm: 1, Flags: 0, Iterations: 10,
+			SaltLength: 4, Salt: []byte{0xaa, 0xbb, 0xcc, 0xdd},
+			HashLength: 20, NextHashedOwnerName: goldenSequence(0x30, 20),
+			TypeBitMaps: []DNSType{DNSRRTypeA, DNSRRTypeRRSIG},
+		}},
+	{"opt.hex", DNSRRTypeOPT, func() DNSRRRDATA { return &DNSRDATAOPT{} },
+		&DNSRDATAOPT{OptionCode: 10, OptionLength: 8, OptionData: goldenSequence(0x50, 8)}},
+}
+
+// goldenKnownFailures 记录已知无法通过的用例及其原因，对应的子测试会被跳过。
+// 修复相应的问题后应将其从此处删除。
+var goldenKnownFailures = map[string]string{}
+
+// goldenSequence 返回自 start 起连续递增的 n 个字节
+func goldenSequence(start byte, n int) []byte {
+	seq := make([]byte, n)
+	for i := range seq {
+		seq[i] = start + byte(i)
+	}
+	return seq
+}
+
+// readGolden 读取十六进制格式的 golden 文件
+func readGolden(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	wire := []byte{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(line), ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		wire = append(wire, b...)
+	}
+	return wire, scanner.Err()
+}
+
+// encodeSafely 调用 Encode，并将其中的 panic 转换为错误
+func encodeSafely(rdata DNSRRRDATA) (encoded []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return rdata.Encode(), nil
+}
+
+// 测试全部 golden 文件的往返编解码
+func TestGoldenRoundTrip(t *testing.T) {
+	for _, gc := range goldenCases {
+		t.Run(gc.file, func(t *testing.T) {
+			if reason, ok := goldenKnownFailures[gc.file]; ok {
+				t.Skip("known failure: " + reason)
+			}
+			wire, err := readGolden(filepath.Join("testdata", "golden", gc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 在 RDATA 之前放置填充字节，以检查偏移量的处理
+			prefix := bytes.Repeat([]byte{0xff}, 12)
+			buffer := append(append([]byte{}, prefix...), wire...)
+			rdata := gc.new()
+			end, err := rdata.DecodeFromBuffer(buffer, len(prefix), len(wire))
+			if err != nil {
+				t.Fatalf("function DecodeFromBuffer() failed:\n%v", err)
+			}
+			if end != len(buffer) {
+				t.Errorf("function DecodeFromBuffer() failed: got offset %d, expected %d", end, len(buffer))
+			}
+			if !rdata.Equal(gc.expected) {
+				t.Errorf("function DecodeFromBuffer() failed:\ngot:\n%s\nexpected:\n%s", rdata, gc.expected)
+			}
+
+			if size := gc.expected.Size(); size != len(wire) {
+				t.Errorf("function Size() failed: got %d, expected %d", size, len(wire))
+			}
+			encoded, err := encodeSafely(gc.expected)
+			if err != nil {
+				t.Errorf("function Encode() failed:\n%v", err)
+			} else if !bytes.Equal(encoded, wire) {
+				t.Errorf("function Encode() failed:\ngot:\n%x\nexpected:\n%x", encoded, wire)
+			}
+			encoded = make([]byte, len(wire))
+			n, err := gc.expected.EncodeToBuffer(encoded)
+			if err != nil {
+				t.Errorf("function EncodeToBuffer() failed:\n%v", err)
+			} else if n != len(wire) || !bytes.Equal(encoded, wire) {
+				t.Errorf("function EncodeToBuffer() failed:\ngot %d bytes:\n%x\nexpected:\n%x", n, encoded, wire)
+			}
+
+			// 整条资源记录的往返编解码
+			rr := DNSResourceRecord{
+				Name:  *NewDNSName("example.com"),
+				Type:  gc.rrType,
+				Class: DNSClassIN,
+				TTL:   3600,
+				RDLen: uint16(len(wire)),
+				RData: gc.expected,
+			}
+			if gc.rrType == DNSRRTypeOPT {
+				rr = (&DNSOPTRecord{UDPPayloadSize: 1232, RData: gc.expected}).ResourceRecord()
+			}
+			rrWire := rr.Encode()
+			decoded := DNSResourceRecord{}
+			if _, err := decoded.DecodeFromBuffer(rrWire, 0); err != nil {
+				t.Fatalf("function DNSResourceRecord DecodeFromBuffer() failed:\n%v", err)
+			}
+			if !bytes.Equal(decoded.Encode(), rrWire) {
+				t.Errorf("resource record round trip failed:\ngot:\n%x\nexpected:\n%x", decoded.Encode(), rrWire)
+			}
+		})
+	}
+}
+
+// 测试每个 golden 文件都有对应的用例
+func TestGoldenFilesCovered(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	covered := map[string]bool{}
+	for _, gc := range goldenCases {
+		covered[gc.file] = true
+	}
+	for _, path := range paths {
+		if !covered[filepath.Base(path)] {
+			t.Errorf("golden file %s has no test case", path)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// idna.go 文件实现了国际化域名（IDN）在 Unicode 形式与 ASCII 兼容形式（ACE，"xn--" 前缀）之间的转换，
+// 其中标签的编解码采用 Punycode 算法，请参阅 RFC 3492。
+//
+// 为便于构造同形异义（homograph）等实验名称，ToASCII 不进行 IDNA2008（RFC 5891）的映射、
+// 规范化及码点合法性检查，标签中的码点被原样编码，大小写亦被保留。
+
+package dns
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// ACEPrefix 为 ASCII 兼容编码标签的前缀
+const ACEPrefix = "xn--"
+
+// Punycode 参数，RFC 3492 5 节
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// ToASCII 将 Unicode 形式的域名转换为 ASCII 兼容形式。
+//   - 其接收参数为 域名字符串，可为绝对或相对域名，
+//   - 返回值为 转换后的域名 及 错误信息。
+//
+// 仅含 ASCII 字符的标签原样保留，其余标签编码为 "xn--" 加 Punycode；
+// 编码后的标签超过 63 字节时返回错误。
+func ToASCII(name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		if !utf8.ValidString(label) {
+			return "", fmt.Errorf("function ToASCII failed: label %q is not valid UTF-8", label)
+		}
+		encoded, err := punycodeEncode([]rune(label))
+		if err != nil {
+			return "", fmt.Errorf("function ToASCII failed: encode label %q failed.\n%v", label, err)
+		}
+		if len(ACEPrefix)+len(encoded) > MaxLabelLength {
+			return "", fmt.Errorf("function ToASCII failed: encoded label of %q is %d bytes long", label, len(ACEPrefix)+len(encoded))
+		}
+		labels[i] = ACEPrefix + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// ToUnicode 将 ASCII 兼容形式的域名转换为 Unicode 形式。
+//   - 其接收参数为 域名字符串，
+//   - 返回值为 转换后的域名 及 错误信息。
+//
+// 以 "xn--"（不区分大小写）开头的标签经 Punycode 解码，其余标签原样保留；
+// 解码失败时返回错误。
+func ToUnicode(name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if len(label) < len(ACEPrefix) || !strings.EqualFold(label[:len(ACEPrefix)], ACEPrefix) {
+			continue
+		}
+		decoded, err := punycodeDecode(label[len(ACEPrefix):])
+		if err != nil {
+			return "", fmt.Errorf("function ToUnicode failed: decode label %q failed.\n%v", label, err)
+		}
+		labels[i] = string(decoded)
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// NewDNSNameFromUnicode 根据 Unicode 形式的域名创建 DNSName，
+// 其 DomainName 及 WiredBytes 均为 ASCII 兼容形式，Unicode 形式可经由 Unicode 方法取得。
+func NewDNSNameFromUnicode(name string) (*DNSName, error) {
+	ace, err := ToASCII(name)
+	if err != nil {
+		return nil, fmt.Errorf("function NewDNSNameFromUnicode failed:\n%v", err)
+	}
+	return NewDNSName(ace), nil
+}
+
+// Unicode 返回域名的 Unicode 形式，无法解码时返回 DomainName 本身
+func (dn *DNSName) Unicode() string {
+	name, err := ToUnicode(dn.DomainName)
+	if err != nil {
+		return dn.DomainName
+	}
+	return name
+}
+
+// IDNString 返回同时包含两种形式的域名，形如 "xn--bcher-kva.example (bücher.example)"，
+// 两种形式相同时仅返回 DomainName，用于日志记录
+func (dn *DNSName) IDNString() string {
+	if u := dn.Unicode(); u != dn.DomainName {
+		return fmt.Sprintf("%s (%s)", dn.DomainName, u)
+	}
+	return dn.DomainName
+}
+
+// isASCII 判断字符串是否仅含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// punyAdapt 调整偏置，RFC 3492 6.1 节
+func punyAdapt(delta, numPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// punyThreshold 返回位置 k 处的阈值 t
+func punyThreshold(k, bias int) int {
+	t := k - bias
+	if t < punyTMin {
+		return punyTMin
+	}
+	if t > punyTMax {
+		return punyTMax
+	}
+	return t
+}
+
+// punyEncodeDigit 返回数值 d 对应的基本码点，0-25 为 a-z，26-35 为 0-9
+func punyEncodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punyDecodeDigit 返回基本码点对应的数值，无效时返回 -1
+func punyDecodeDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a')
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	}
+	return -1
+}
+
+// punycodeEncode 以 Punycode 编码码点序列，RFC 3492 6.3 节
+func punycodeEncode(input []rune) (string, error) {
+	output := []byte{}
+	for _, r := range input {
+		if r < utf8.RuneSelf {
+			output = append(output, byte(r))
+		}
+	}
+	basic := len(output)
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for h := basic; h < len(input); {
+		m := math.MaxInt32
+		for _, r := range input {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		if (m - n) > (math.MaxInt32-delta)/(h+1) {
+			return "", fmt.Errorf("punycode overflow")
+		}
+		delta += (m - n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if int(r) < n {
+				if delta++; delta > math.MaxInt32-1 {
+					return "", fmt.Errorf("punycode overflow")
+				}
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				output = append(output, punyEncodeDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			output = append(output, punyEncodeDigit(q))
+			bias = punyAdapt(delta, h+1, h == basic)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
+
+// punycodeDecode 解码 Punycode 字符串，RFC 3492 6.2 节
+func punycodeDecode(input string) ([]rune, error) {
+	output := []rune{}
+	pos := 0
+	if b := strings.LastIndexByte(input, '-'); b >= 0 {
+		for i := 0; i < b; i++ {
+			if input[i] >= utf8.RuneSelf {
+				return nil, fmt.Errorf("non-basic code point in %q", input)
+			}
+			output = append(output, rune(input[i]))
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for pos < len(input) {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(input) {
+				return nil, fmt.Errorf("truncated punycode %q", input)
+			}
+			digit := punyDecodeDigit(input[pos])
+			pos++
+			if digit < 0 {
+				return nil, fmt.Errorf("invalid punycode digit %q", input[pos-1])
+			}
+			if digit > (math.MaxInt32-i)/w {
+				return nil, fmt.Errorf("punycode overflow")
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			if w > math.MaxInt32/(punyBase-t) {
+				return nil, fmt.Errorf("punycode overflow")
+			}
+			w *= punyBase - t
+		}
+		count := len(output) + 1
+		bias = punyAdapt(i-oldi, count, oldi == 0)
+		if i/count > math.MaxInt32-n {
+			return nil, fmt.Errorf("punycode overflow")
+		}
+		n += i / count
+		i %= count
+		if n > utf8.MaxRune {
+			return nil, fmt.Errorf("invalid code point %d", n)
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return output, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// idna_test.go 文件定义了对 idna.go 的单元测试
+
+package dns
+
+import (
+	"testing"
+)
+
+// 测试 Unicode 形式与 ASCII 兼容形式之间的转换
+func TestToASCII(t *testing.T) {
+	tests := map[string]string{
+		"bücher.example":     "xn--bcher-kva.example",
+		"münchen.de.":        "xn--mnchen-3ya.de.",
+		"пример.рф":          "xn--e1afmkfd.xn--p1ai",
+		"испытание":          "xn--80akhbyknj4f",
+		"テスト.中国":             "xn--zckzah.xn--fiqs8s",
+		"测试.example":         "xn--0zwm56d.example",
+		"www.example.com":    "www.example.com",
+		".":                  ".",
+		"WWW.Bücher.example": "WWW.xn--Bcher-kva.example",
+	}
+	for name, expected := range tests {
+		ace, err := ToASCII(name)
+		if err != nil {
+			t.Errorf("function ToASCII() failed: %s\n%s", name, err)
+			continue
+		}
+		if ace != expected {
+			t.Errorf("function ToASCII() failed: %s\ngot:%s\nexpected: %s", name, ace, expected)
+		}
+		unicode, err := ToUnicode(ace)
+		if err != nil || unicode != name {
+			t.Errorf("function ToUnicode() failed: %s\ngot:%s\nexpected: %s\n%v", ace, unicode, name, err)
+		}
+	}
+
+	// 前缀不区分大小写
+	if unicode, _ := ToUnicode("XN--bcher-kva.example"); unicode != "bücher.example" {
+		t.Errorf("function ToUnicode() failed: got %s", unicode)
+	}
+}
+
+// 测试无效的输入
+func TestIDNInvalid(t *testing.T) {
+	for _, name := range []string{"xn--a-ä.example", "xn--bcher-kv.example", "xn--99999999999.example"} {
+		if _, err := ToUnicode(name); err == nil {
+			t.Errorf("function ToUnicode() failed: expected an error for %q", name)
+		}
+	}
+	long := ""
+	for i := 0; i < 40; i++ {
+		long += string(rune(0x4E00 + i*97))
+	}
+	if _, err := ToASCII(long + ".example"); err == nil {
+		t.Errorf("function ToASCII() failed: expected an error for an encoded label over 63 bytes")
+	}
+	if _, err := ToASCII("\xff\xfe.example"); err == nil {
+		t.Errorf("function ToASCII() failed: expected an error for invalid UTF-8")
+	}
+}
+
+// 测试 DNSName 的 IDN 方法
+func TestDNSNameIDN(t *testing.T) {
+	name, err := NewDNSNameFromUnicode("bücher.example")
+	if err != nil {
+		t.Fatalf("function NewDNSNameFromUnicode() failed:\n%s", err)
+	}
+	if name.DomainName != "xn--bcher-kva.example" || string(name.WiredBytes[1:14]) != "xn--bcher-kva" {
+		t.Errorf("function NewDNSNameFromUnicode() failed: got %s %x", name.DomainName, name.WiredBytes)
+	}
+	if name.Unicode() != "bücher.example" {
+		t.Errorf("method DNSName Unicode() failed: got %s", name.Unicode())
+	}
+	if s := name.IDNString(); s != "xn--bcher-kva.example (bücher.example)" {
+		t.Errorf("method DNSName IDNString() failed: got %s", s)
+	}
+	if s := NewDNSName("www.example.com").IDNString(); s != "www.example.com" {
+		t.Errorf("method DNSName IDNString() failed: got %s", s)
+	}
+}
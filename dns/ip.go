@@ -0,0 +1,17 @@
+// Copyright 2024 TochusC, AOSP Lab. All rights reserved.
+
+//go:build !js
+
+package dns
+
+import "net"
+
+// IP 表示 A 及 AAAA 记录中的 IP 地址。
+// 在原生平台上 IP 即为 net.IP 的别名，与 net 包完全兼容；
+// 在 js/wasm 平台上则使用 ip_js.go 中不依赖 net 包的实现，详见包文档。
+type IP = net.IP
+
+// IPv4 返回 16 字节形式的 IPv4 地址，与 net.IPv4 相同
+func IPv4(a, b, c, d byte) IP {
+	return net.IPv4(a, b, c, d)
+}
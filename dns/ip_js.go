@@ -0,0 +1,98 @@
+// Copyright 2024 TochusC, AOSP Lab. All rights reserved.
+
+//go:build js
+
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// IP 表示 A 及 AAAA 记录中的 IP 地址。
+// js/wasm 平台上的实现不依赖 net 包，仅提供编解码所需的方法，语义与 net.IP 相同。
+type IP []byte
+
+// v4InV6Prefix 为 IPv4 映射地址的前缀
+var v4InV6Prefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
+// IPv4 返回 16 字节形式的 IPv4 地址，与 net.IPv4 相同
+func IPv4(a, b, c, d byte) IP {
+	return IP(append(append([]byte{}, v4InV6Prefix...), a, b, c, d))
+}
+
+// To4 返回 4 字节形式的 IPv4 地址，不是 IPv4 地址时返回 nil
+func (ip IP) To4() IP {
+	if len(ip) == 4 {
+		return ip
+	}
+	if len(ip) == 16 && bytes.Equal(ip[:12], v4InV6Prefix) {
+		return ip[12:16]
+	}
+	return nil
+}
+
+// To16 返回 16 字节形式的地址，长度错误时返回 nil
+func (ip IP) To16() IP {
+	if len(ip) == 4 {
+		return IPv4(ip[0], ip[1], ip[2], ip[3])
+	}
+	if len(ip) == 16 {
+		return ip
+	}
+	return nil
+}
+
+// Equal 判断两个地址是否相同，IPv4 地址的 4 字节与 16 字节形式视为相同
+func (ip IP) Equal(x IP) bool {
+	if len(ip) == len(x) {
+		return bytes.Equal(ip, x)
+	}
+	a, b := ip.To16(), x.To16()
+	return a != nil && b != nil && bytes.Equal(a, b)
+}
+
+// String 返回地址的文本形式，IPv6 地址中最长的连续零组以 "::" 缩写
+func (ip IP) String() string {
+	if len(ip) == 0 {
+		return "<nil>"
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return strconv.Itoa(int(ip4[0])) + "." + strconv.Itoa(int(ip4[1])) + "." +
+			strconv.Itoa(int(ip4[2])) + "." + strconv.Itoa(int(ip4[3]))
+	}
+	if len(ip) != 16 {
+		return "?" + hex.EncodeToString(ip)
+	}
+
+	// 寻找最长的连续零组，长度至少为 2
+	start, length := -1, 1
+	for i := 0; i < 16; i += 2 {
+		j := i
+		for j < 16 && ip[j] == 0 && ip[j+1] == 0 {
+			j += 2
+		}
+		if (j-i)/2 > length {
+			start, length = i, (j-i)/2
+		}
+		if j > i {
+			i = j - 2
+		}
+	}
+
+	sb := strings.Builder{}
+	for i := 0; i < 16; i += 2 {
+		if i == start {
+			sb.WriteString("::")
+			i += 2*length - 2
+			continue
+		}
+		if i > 0 && i != start+2*length {
+			sb.WriteByte(':')
+		}
+		sb.WriteString(strconv.FormatUint(uint64(ip[i])<<8|uint64(ip[i+1]), 16))
+	}
+	return sb.String()
+}
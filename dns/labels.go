@@ -0,0 +1,109 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// labels.go 文件定义了按标签构造域名的辅助函数，
+// 用于构造标签长度为 63 字节、线路格式恰为 255 字节等处于协议上限的名称，
+// 以及用于负面测试的、含有 64 字节标签等非法名称。
+//
+// 以字符串构造此类名称容易出错：EncodeDomainName 不检查长度，
+// 超过 255 字节的标签的长度字节会溢出，标签中的 '.' 亦会被当作分隔符。
+// 此处的函数直接由标签生成线路格式，DNSName 的 DomainName 仅供显示，
+// 编码时以 WiredBytes 为准。
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxLabelLength 为标签的最大长度，RFC 1035 2.3.4 节
+	MaxLabelLength = 63
+	// MaxDomainNameWireLength 为域名线路格式的最大长度，RFC 1035 2.3.4 节
+	MaxDomainNameWireLength = 255
+)
+
+// NewDNSNameFromLabels 由标签序列构造域名，标签可以包含包括 '.' 在内的任意字节。
+//   - 其接收参数为 按从左至右顺序排列的标签，不含根标签，无参数时构造根域名，
+//   - 返回值为 构造的域名 及 错误信息。
+//
+// 标签为空或超过 MaxLabelLength 字节，或线路格式超过 MaxDomainNameWireLength 字节时返回错误。
+func NewDNSNameFromLabels(labels ...string) (*DNSName, error) {
+	wireLen := 1
+	for i, label := range labels {
+		if len(label) == 0 || len(label) > MaxLabelLength {
+			return nil, fmt.Errorf("function NewDNSNameFromLabels failed: label %d is %d bytes long", i, len(label))
+		}
+		wireLen += len(label) + 1
+	}
+	if wireLen > MaxDomainNameWireLength {
+		return nil, fmt.Errorf("function NewDNSNameFromLabels failed: name is %d bytes in wire format", wireLen)
+	}
+	return newDNSNameFromLabels(labels), nil
+}
+
+// NewRawDNSNameFromLabels 与 NewDNSNameFromLabels 相同，但不检查标签及名称的长度，
+// 用于构造含有空标签、64 字节标签或超过 255 字节的非法名称。
+// 仅当标签长度超过 255 字节，即无法以长度字节表示时返回错误。
+func NewRawDNSNameFromLabels(labels ...string) (*DNSName, error) {
+	for i, label := range labels {
+		if len(label) > 0xFF {
+			return nil, fmt.Errorf("function NewRawDNSNameFromLabels failed: label %d is %d bytes long", i, len(label))
+		}
+	}
+	return newDNSNameFromLabels(labels), nil
+}
+
+// newDNSNameFromLabels 由标签序列生成域名，不作检查
+func newDNSNameFromLabels(labels []string) *DNSName {
+	if len(labels) == 0 {
+		return &DNSName{DomainName: ".", WiredBytes: []byte{0x00}}
+	}
+	wire := []byte{}
+	for _, label := range labels {
+		wire = append(wire, byte(len(label)))
+		wire = append(wire, label...)
+	}
+	return &DNSName{
+		DomainName: strings.Join(labels, "."),
+		WiredBytes: append(wire, 0x00),
+	}
+}
+
+// PadDomainName 在区域名之前添加由 fill 填充的标签，使域名的线路格式恰为 wireLen 字节。
+//   - 其接收参数为 区域名、目标线路格式长度 及 填充字节，
+//   - 返回值为 构造的域名 及 错误信息。
+//
+// 所添加的标签尽量为 MaxLabelLength 字节，如 PadDomainName("example.com", 255, 'a')
+// 构造一个线路格式恰为 255 字节的合法域名。
+// 区域名不合法、wireLen 超过 MaxDomainNameWireLength、小于区域名本身的长度，
+// 或与其恰差 1 字节（无法以标签填充）时返回错误。
+func PadDomainName(zone string, wireLen int, fill byte) (*DNSName, error) {
+	labels := []string{}
+	if trimmed := strings.TrimSuffix(zone, "."); trimmed != "" {
+		labels = strings.Split(trimmed, ".")
+	}
+	base, err := NewDNSNameFromLabels(labels...)
+	if err != nil {
+		return nil, fmt.Errorf("function PadDomainName failed: invalid zone %s\n%v", zone, err)
+	}
+	remain := wireLen - base.Length()
+	if wireLen > MaxDomainNameWireLength || remain < 0 || remain == 1 {
+		return nil, fmt.Errorf("function PadDomainName failed: can not pad %s (%d bytes) to %d bytes", zone, base.Length(), wireLen)
+	}
+
+	padding := []string{}
+	for remain > 0 {
+		size := remain - 1
+		if size > MaxLabelLength {
+			size = MaxLabelLength
+		}
+		// 避免剩余恰为 1 字节
+		if remain-size-1 == 1 {
+			size--
+		}
+		padding = append(padding, strings.Repeat(string([]byte{fill}), size))
+		remain -= size + 1
+	}
+	return NewDNSNameFromLabels(append(padding, labels...)...)
+}
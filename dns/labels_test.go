@@ -0,0 +1,118 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// labels_test.go 文件定义了对 labels.go 的单元测试
+
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// 测试按标签构造合法域名
+func TestNewDNSNameFromLabels(t *testing.T) {
+	label63 := strings.Repeat("a", MaxLabelLength)
+	name, err := NewDNSNameFromLabels(label63, "example", "com")
+	if err != nil {
+		t.Fatalf("function NewDNSNameFromLabels() failed:\n%s", err)
+	}
+	if name.Length() != 1+MaxLabelLength+1+7+1+3+1 || name.WiredBytes[0] != MaxLabelLength {
+		t.Errorf("function NewDNSNameFromLabels() failed: wire format %x", name.WiredBytes)
+	}
+	if name.DomainName != label63+".example.com" {
+		t.Errorf("function NewDNSNameFromLabels() failed: got name %s", name.DomainName)
+	}
+
+	// 标签中的 '.' 不作为分隔符
+	dotted, err := NewDNSNameFromLabels("a.b", "com")
+	if err != nil {
+		t.Fatalf("function NewDNSNameFromLabels() failed:\n%s", err)
+	}
+	if expected := []byte{3, 'a', '.', 'b', 3, 'c', 'o', 'm', 0}; !bytes.Equal(dotted.WiredBytes, expected) {
+		t.Errorf("function NewDNSNameFromLabels() failed:\ngot:%x\nexpected: %x", dotted.WiredBytes, expected)
+	}
+
+	root, err := NewDNSNameFromLabels()
+	if err != nil || root.DomainName != "." || !bytes.Equal(root.WiredBytes, []byte{0}) {
+		t.Errorf("function NewDNSNameFromLabels() failed: got root %v, %v", root, err)
+	}
+
+	invalid := [][]string{
+		{strings.Repeat("a", MaxLabelLength+1), "com"},
+		{"", "com"},
+		{label63, label63, label63, label63},
+	}
+	for _, labels := range invalid {
+		if _, err := NewDNSNameFromLabels(labels...); err == nil {
+			t.Errorf("function NewDNSNameFromLabels() failed: expected an error for %d labels", len(labels))
+		}
+	}
+}
+
+// 测试构造非法域名
+func TestNewRawDNSNameFromLabels(t *testing.T) {
+	label64 := strings.Repeat("a", MaxLabelLength+1)
+	name, err := NewRawDNSNameFromLabels(label64, "example", "com")
+	if err != nil {
+		t.Fatalf("function NewRawDNSNameFromLabels() failed:\n%s", err)
+	}
+	if name.WiredBytes[0] != 64 || name.Length() != 1+64+1+7+1+3+1 {
+		t.Errorf("function NewRawDNSNameFromLabels() failed: wire format %x", name.WiredBytes)
+	}
+
+	// 非法名称应原样编码，并被 Validate 报告
+	msg := DNSMessage{
+		Header:   DNSHeader{QDCount: 1},
+		Question: DNSQuestionSection{{Name: *name, Type: DNSRRTypeA, Class: DNSClassIN}},
+	}
+	if !bytes.Contains(msg.Encode(), name.WiredBytes) {
+		t.Errorf("method DNSMessage Encode() failed: raw name not found in the encoded message")
+	}
+	violations := Validate(&msg)
+	if len(violations) != 1 || violations[0].Kind != ViolationLabelLength {
+		t.Errorf("function Validate() failed: got %v", violations)
+	}
+
+	if _, err := NewRawDNSNameFromLabels(strings.Repeat("a", 256)); err == nil {
+		t.Errorf("function NewRawDNSNameFromLabels() failed: expected an error for a 256-byte label")
+	}
+}
+
+// 测试填充域名至指定长度
+func TestPadDomainName(t *testing.T) {
+	for _, zone := range []string{"example.com", "example.com.", ".", "a.b.c.d.example"} {
+		base := EncodeDomainName(&zone)
+		for wireLen := len(base); wireLen <= MaxDomainNameWireLength; wireLen++ {
+			if wireLen == len(base)+1 {
+				if _, err := PadDomainName(zone, wireLen, 'x'); err == nil {
+					t.Errorf("function PadDomainName() failed: expected an error for %s padded by 1 byte", zone)
+				}
+				continue
+			}
+			name, err := PadDomainName(zone, wireLen, 'x')
+			if err != nil {
+				t.Fatalf("function PadDomainName() failed: %s to %d bytes\n%s", zone, wireLen, err)
+			}
+			if name.Length() != wireLen || !bytes.HasSuffix(name.WiredBytes, base) {
+				t.Fatalf("function PadDomainName() failed: %s to %d bytes, got %x", zone, wireLen, name.WiredBytes)
+			}
+			if violations := validateName(name.DomainName); len(violations) != 0 {
+				t.Errorf("function PadDomainName() failed: %s to %d bytes, got violations %v", zone, wireLen, violations)
+			}
+			if decoded := DecodeDomainName(name.WiredBytes); decoded != name.DomainName {
+				t.Errorf("function PadDomainName() failed:\ngot:%s\nexpected: %s", decoded, name.DomainName)
+			}
+		}
+	}
+
+	name, _ := PadDomainName("example.com", MaxDomainNameWireLength, 'a')
+	if name.WiredBytes[0] != MaxLabelLength {
+		t.Errorf("function PadDomainName() failed: expected a leading %d-byte label, got %d", MaxLabelLength, name.WiredBytes[0])
+	}
+	for _, wireLen := range []int{MaxDomainNameWireLength + 1, 5} {
+		if _, err := PadDomainName("example.com", wireLen, 'a'); err == nil {
+			t.Errorf("function PadDomainName() failed: expected an error for %d bytes", wireLen)
+		}
+	}
+}
@@ -5,6 +5,14 @@ import (
 	"fmt"
 )
 
+// EDNS 选项码，详见 IANA "DNS EDNS0 Option Codes (OPT)" 注册表
+const (
+	EDNSOptionCodeNSID    uint16 = 3  // NSID [RFC5001]
+	EDNSOptionCodeECS     uint16 = 8  // Client Subnet [RFC7871]
+	EDNSOptionCodeCookie  uint16 = 10 // COOKIE [RFC7873]
+	EDNSOptionCodePadding uint16 = 12 // Padding [RFC7830]
+)
+
 var PseudoRRType = map[DNSType]interface{}{
 	DNSRRTypeOPT: nil,
 }
@@ -76,22 +84,230 @@ func SetDNSRROPTTTL(ercode int, version int, do bool, z int) uint32 {
 }
 
 func (opt *DNSRROPT) String() string {
-	rr := opt.rr
-	ttl := rr.TTL
-	bTTL := make([]byte, 4)
-	binary.BigEndian.PutUint32(bTTL, ttl)
-	ercode := int(ttl >> 24)
-	version := int(ttl >> 16 & 0xff)
-	do := (ttl>>15)&1 == 1
-	z := int(ttl & 0x7fff)
+	return optRecordOf(opt.rr).String()
+}
+
+// DNSOPTRecord 以类型化字段表示 OPT 伪资源记录。
+// OPT 记录借用了资源记录的 NAME、CLASS 及 TTL 字段：NAME 固定为根域名，
+// CLASS 为请求方的 UDP 载荷大小，TTL 为扩展 RCODE、EDNS 版本及标志位，详见 RFC 6891 6.1 节。
+// 可通过 DNSResourceRecord 的 OPT 方法及 DNSOPTRecord 的 ResourceRecord 方法相互转换。
+type DNSOPTRecord struct {
+	// 请求方的 UDP 载荷大小
+	UDPPayloadSize uint16
+	// 扩展 RCODE 的高 8 位
+	ExtendedRCode uint8
+	// EDNS 版本
+	Version uint8
+	// DNSSEC OK 标志
+	DO bool
+	// 其余 15 位标志位，应为 0
+	Z uint16
+	// 选项，为 nil 时 RDATA 为空
+	RData DNSRRRDATA
+}
+
+// TTL 返回 OPT 记录在 TTL 字段中的编码
+func (opt *DNSOPTRecord) TTL() uint32 {
+	return SetDNSRROPTTTL(int(opt.ExtendedRCode), int(opt.Version), opt.DO, int(opt.Z&0x7fff))
+}
+
+// ResourceRecord 将 OPT 记录转换为资源记录
+func (opt *DNSOPTRecord) ResourceRecord() DNSResourceRecord {
+	rdata := opt.RData
+	if rdata == nil {
+		rdata = &DNSRDATAUnknown{RRType: DNSRRTypeOPT}
+	}
+	return DNSResourceRecord{
+		Name:  *NewDNSName("."),
+		Type:  DNSRRTypeOPT,
+		Class: DNSClass(opt.UDPPayloadSize),
+		TTL:   opt.TTL(),
+		RDLen: 0,
+		RData: rdata,
+	}
+}
 
+func (opt *DNSOPTRecord) String() string {
+	rdata := "<empty>"
+	if opt.RData != nil {
+		rdata = opt.RData.String()
+	}
 	return fmt.Sprint(
-		"### Pseudo Rersouce Record OPT ###\n",
-		"UDP Payload Size:", int(rr.Class), "\n",
-		"Extended RCODE:", ercode, "\n",
-		"Version:", version, "\n",
-		"DO:", do, "\n",
-		"Z: ", z, "\n",
-		"RData:\n", rr.RData.String(),
+		"### Pseudo Resource Record OPT ###\n",
+		"UDP Payload Size:", opt.UDPPayloadSize, "\n",
+		"Extended RCODE:", opt.ExtendedRCode, "\n",
+		"Version:", opt.Version, "\n",
+		"DO:", opt.DO, "\n",
+		"Z:", opt.Z, "\n",
+		"RData:\n", rdata,
 	)
 }
+
+// OPT 以类型化字段解释 OPT 资源记录。
+// 返回值为：
+//   - *DNSOPTRecord，OPT 记录
+//   - error，资源记录的类型不为 OPT 或名称不为根域名时返回错误
+func (rr *DNSResourceRecord) OPT() (*DNSOPTRecord, error) {
+	if rr.Type != DNSRRTypeOPT {
+		return nil, fmt.Errorf("method DNSResourceRecord OPT failed: record type %s is not OPT", rr.Type)
+	}
+	if rr.Name.DomainName != "." && rr.Name.DomainName != "" {
+		return nil, fmt.Errorf("method DNSResourceRecord OPT failed: OPT record name %s is not the root", rr.Name.DomainName)
+	}
+	return optRecordOf(rr), nil
+}
+
+// optRecordOf 以类型化字段解释资源记录，不检查其类型及名称
+func optRecordOf(rr *DNSResourceRecord) *DNSOPTRecord {
+	return &DNSOPTRecord{
+		UDPPayloadSize: uint16(rr.Class),
+		ExtendedRCode:  uint8(rr.TTL >> 24),
+		Version:        uint8(rr.TTL >> 16),
+		DO:             rr.TTL&0x8000 != 0,
+		Z:              uint16(rr.TTL & 0x7fff),
+		RData:          rr.RData,
+	}
+}
+
+// OPT 返回 DNS 消息附加部分中的首个 OPT 记录，不存在时第二个返回值为 false。
+// 名称不为根域名的 OPT 记录同样会被返回，以便处理畸形的查询。
+func (dnsMessage *DNSMessage) OPT() (*DNSOPTRecord, bool) {
+	for i := range dnsMessage.Additional {
+		rr := &dnsMessage.Additional[i]
+		if rr.Type != DNSRRTypeOPT {
+			continue
+		}
+		return optRecordOf(rr), true
+	}
+	return nil, false
+}
+
+// OptionCodeOf 返回 OPT 记录 RDATA 中首个选项的选项码。
+// 解码得到的 OPT 记录 RDATA 可能为 DNSRDATAUnknown，此时从原始字节中读取选项码。
+// 若 RDATA 不携带任何选项，第二个返回值为 false。
+func OptionCodeOf(rdata DNSRRRDATA) (uint16, bool) {
+	switch rd := rdata.(type) {
+	case *DNSRDATAOPT:
+		if rd.Size() > 4 || rd.OptionLength > 0 || rd.OptionCode != 0 {
+			return rd.OptionCode, true
+		}
+	case *DNSRDATAUnknown:
+		if len(rd.RData) >= 2 {
+			return binary.BigEndian.Uint16(rd.RData), true
+		}
+	}
+	return 0, false
+}
+
+// NewDNSRDATAOPTPadding 创建一个指定填充长度的 Padding 选项 RDATA。
+// 根据 RFC 7830，填充内容应为全零。
+func NewDNSRDATAOPTPadding(length int) *DNSRDATAOPT {
+	return &DNSRDATAOPT{
+		OptionCode:   EDNSOptionCodePadding,
+		OptionLength: uint16(length),
+		OptionData:   make([]byte, length),
+	}
+}
+
+// PadDNSMessage 按块大小填充 DNS 消息，使其编码后的大小为 blockSize 的整数倍。
+// 其接受参数为：
+//   - msg *DNSMessage，待填充的 DNS 消息
+//   - blockSize int，块大小，RFC 8467 建议回复使用 468
+//
+// 返回值为：
+//   - error，错误信息
+//
+// 若消息的附加部分不存在 OPT 记录，则会添加一个 UDP 载荷大小为 1232 的 OPT 记录；
+// 若 OPT 记录已携带 Padding 选项，则会重新计算其长度，否则在其他选项之后追加 Padding 选项；
+// OPT 记录中的其他选项（如 COOKIE）保持原有顺序。
+// 函数不会修正头部的计数字段。
+func PadDNSMessage(msg *DNSMessage, blockSize int) error {
+	if blockSize <= 0 {
+		return fmt.Errorf("function PadDNSMessage failed: invalid block size %d", blockSize)
+	}
+
+	optIdx := -1
+	for i, rr := range msg.Additional {
+		if rr.Type == DNSRRTypeOPT {
+			optIdx = i
+			break
+		}
+	}
+	if optIdx == -1 {
+		msg.Additional = append(msg.Additional,
+			*NewDNSRROPT(1232, 0, NewDNSRDATAOPTPadding(0)))
+		optIdx = len(msg.Additional) - 1
+	}
+
+	opt := &msg.Additional[optIdx]
+	options, err := SplitEDNSOptions(opt.RData)
+	if err != nil {
+		return fmt.Errorf("function PadDNSMessage failed: %v", err)
+	}
+	padIdx := -1
+	for i, option := range options {
+		if option.OptionCode == EDNSOptionCodePadding {
+			padIdx = i
+			break
+		}
+	}
+	if padIdx == -1 {
+		options = append(options, DNSRDATAOPT{})
+		padIdx = len(options) - 1
+	}
+
+	// 先置空填充，再根据消息大小计算所需的填充长度
+	options[padIdx] = *NewDNSRDATAOPTPadding(0)
+	setEDNSOptions(opt, options)
+	padLen := (blockSize - msg.Size()%blockSize) % blockSize
+	options[padIdx] = *NewDNSRDATAOPTPadding(padLen)
+	setEDNSOptions(opt, options)
+	return nil
+}
+
+// SplitEDNSOptions 将 OPT 记录的 RDATA 拆分为各个选项。
+// 其接受参数为：
+//   - rdata DNSRRRDATA，OPT 记录的 RDATA，可为 DNSRDATAOPT 或解码得到的 DNSRDATAUnknown
+//
+// 返回值为：
+//   - []DNSRDATAOPT，按出现顺序排列的选项，RDATA 不携带选项时为空
+//   - error，选项长度超出 RDATA 时返回错误
+func SplitEDNSOptions(rdata DNSRRRDATA) ([]DNSRDATAOPT, error) {
+	if _, ok := OptionCodeOf(rdata); !ok {
+		return nil, nil
+	}
+	raw := rdata.Encode()
+	options := []DNSRDATAOPT{}
+	for len(raw) > 0 {
+		if len(raw) < 4 {
+			return nil, fmt.Errorf("function SplitEDNSOptions failed: %d trailing bytes in OPT RDATA", len(raw))
+		}
+		optLen := int(binary.BigEndian.Uint16(raw[2:]))
+		if len(raw) < 4+optLen {
+			return nil, fmt.Errorf("function SplitEDNSOptions failed: option %d length %d exceeds OPT RDATA", binary.BigEndian.Uint16(raw), optLen)
+		}
+		options = append(options, DNSRDATAOPT{
+			OptionCode:   binary.BigEndian.Uint16(raw),
+			OptionLength: uint16(optLen),
+			OptionData:   append([]byte{}, raw[4:4+optLen]...),
+		})
+		raw = raw[4+optLen:]
+	}
+	return options, nil
+}
+
+// setEDNSOptions 以给定的选项设置 OPT 记录的 RDATA。
+// 由于 DNSRDATAOPT 只能表示单个选项，多个选项以原始字节表示。
+func setEDNSOptions(opt *DNSResourceRecord, options []DNSRDATAOPT) {
+	if len(options) == 1 {
+		opt.RData = &options[0]
+	} else {
+		raw := []byte{}
+		for i := range options {
+			raw = append(raw, options[i].Encode()...)
+		}
+		opt.RData = &DNSRDATAUnknown{RRType: DNSRRTypeOPT, RData: raw}
+	}
+	opt.RDLen = uint16(opt.RData.Size())
+	opt.IsStatic = false
+}
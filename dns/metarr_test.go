@@ -17,3 +17,167 @@ func TestPseudoRRString(t *testing.T) {
 	prr := NewPseudoRR(rr)
 	t.Logf("PseudoRR String():\n%s", prr.String())
 }
+
+func TestPadDNSMessage(t *testing.T) {
+	msg := testedDNS
+	msg.Additional = DNSResponseSection{}
+	err := PadDNSMessage(&msg, 128)
+	if err != nil {
+		t.Errorf("function PadDNSMessage() failed:\n%s", err)
+	}
+	if len(msg.Additional) != 1 || msg.Additional[0].Type != DNSRRTypeOPT {
+		t.Errorf("function PadDNSMessage() failed: OPT record not added")
+	}
+	if len(msg.Encode())%128 != 0 {
+		t.Errorf("function PadDNSMessage() failed:\ngot size:%d\nexpected a multiple of 128", len(msg.Encode()))
+	}
+
+	// 重新填充至其他块大小
+	err = PadDNSMessage(&msg, 468)
+	if err != nil {
+		t.Errorf("function PadDNSMessage() failed:\n%s", err)
+	}
+	if len(msg.Additional) != 1 || len(msg.Encode()) != 468 {
+		t.Errorf("function PadDNSMessage() failed:\ngot size:%d\nexpected: 468", len(msg.Encode()))
+	}
+}
+
+// 测试 PadDNSMessage 在 OPT 记录携带其他选项时的填充
+func TestPadDNSMessageOptions(t *testing.T) {
+	cookie := DNSRDATAOPT{OptionCode: EDNSOptionCodeCookie, OptionLength: 8, OptionData: []byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	tests := []struct {
+		name    string
+		options []DNSRDATAOPT
+	}{
+		{"cookie only", []DNSRDATAOPT{cookie}},
+		{"padding then cookie", []DNSRDATAOPT{*NewDNSRDATAOPTPadding(7), cookie}},
+		{"cookie then padding", []DNSRDATAOPT{cookie, *NewDNSRDATAOPTPadding(300)}},
+	}
+	for _, tt := range tests {
+		msg := testedDNS
+		msg.Additional = DNSResponseSection{{Name: *NewDNSName("."), Type: DNSRRTypeOPT, Class: 1232}}
+		setEDNSOptions(&msg.Additional[0], tt.options)
+		// 以解码得到的原始字节表示 OPT 记录的 RDATA
+		msg.Additional[0].RData = &DNSRDATAUnknown{RRType: DNSRRTypeOPT, RData: msg.Additional[0].RData.Encode()}
+
+		if err := PadDNSMessage(&msg, 128); err != nil {
+			t.Errorf("function PadDNSMessage() failed: %s:\n%s", tt.name, err)
+			continue
+		}
+		if len(msg.Encode())%128 != 0 {
+			t.Errorf("function PadDNSMessage() failed: %s:\ngot size:%d\nexpected a multiple of 128", tt.name, len(msg.Encode()))
+		}
+		got, err := SplitEDNSOptions(msg.Additional[0].RData)
+		if err != nil {
+			t.Errorf("function SplitEDNSOptions() failed: %s:\n%s", tt.name, err)
+			continue
+		}
+		codes := []uint16{}
+		for _, option := range got {
+			codes = append(codes, option.OptionCode)
+			if option.OptionCode == EDNSOptionCodeCookie && !option.Equal(&cookie) {
+				t.Errorf("function PadDNSMessage() failed: %s: COOKIE option changed to %x", tt.name, option.OptionData)
+			}
+		}
+		// Padding 选项原地调整长度，不存在时追加于其他选项之后
+		expected := []uint16{EDNSOptionCodeCookie, EDNSOptionCodePadding}
+		if tt.options[0].OptionCode == EDNSOptionCodePadding {
+			expected = []uint16{EDNSOptionCodePadding, EDNSOptionCodeCookie}
+		}
+		if len(codes) != 2 || codes[0] != expected[0] || codes[1] != expected[1] {
+			t.Errorf("function PadDNSMessage() failed: %s:\ngot options: %v\nexpected: %v", tt.name, codes, expected)
+		}
+	}
+}
+
+func TestSplitEDNSOptions(t *testing.T) {
+	raw := []byte{0x00, 0x0a, 0x00, 0x02, 0xaa, 0xbb, 0x00, 0x0c, 0x00, 0x00}
+	options, err := SplitEDNSOptions(&DNSRDATAUnknown{RRType: DNSRRTypeOPT, RData: raw})
+	if err != nil || len(options) != 2 || options[0].OptionCode != EDNSOptionCodeCookie ||
+		options[1].OptionCode != EDNSOptionCodePadding || options[1].OptionLength != 0 {
+		t.Errorf("function SplitEDNSOptions() failed:\ngot: %+v, %v", options, err)
+	}
+	if options, err := SplitEDNSOptions(&DNSRDATAOPT{}); err != nil || len(options) != 0 {
+		t.Errorf("function SplitEDNSOptions() failed: empty OPT RDATA:\ngot: %+v, %v", options, err)
+	}
+	for _, malformed := range [][]byte{raw[:3], raw[:5], append(raw, 0x00)} {
+		if _, err := SplitEDNSOptions(&DNSRDATAUnknown{RRType: DNSRRTypeOPT, RData: malformed}); err == nil {
+			t.Errorf("function SplitEDNSOptions() failed: expected an error for %x", malformed)
+		}
+	}
+}
+
+func TestOptionCodeOf(t *testing.T) {
+	if code, ok := OptionCodeOf(NewDNSRDATAOPTPadding(4)); !ok || code != EDNSOptionCodePadding {
+		t.Errorf("function OptionCodeOf() failed:\ngot:%d, %v\nexpected: %d, true", code, ok, EDNSOptionCodePadding)
+	}
+	// 解码得到的 OPT RDATA
+	unknown := &DNSRDATAUnknown{RRType: DNSRRTypeOPT, RData: []byte{0x00, 0x0a, 0x00, 0x00}}
+	if code, ok := OptionCodeOf(unknown); !ok || code != EDNSOptionCodeCookie {
+		t.Errorf("function OptionCodeOf() failed:\ngot:%d, %v\nexpected: %d, true", code, ok, EDNSOptionCodeCookie)
+	}
+	if _, ok := OptionCodeOf(&DNSRDATAUnknown{RRType: DNSRRTypeOPT}); ok {
+		t.Errorf("function OptionCodeOf() failed: expected no option")
+	}
+}
+
+func TestDNSOPTRecord(t *testing.T) {
+	opt := DNSOPTRecord{
+		UDPPayloadSize: 1232,
+		ExtendedRCode:  1,
+		Version:        0,
+		DO:             true,
+		Z:              0x0102,
+		RData:          NewDNSRDATAOPTPadding(4),
+	}
+	if ttl := opt.TTL(); ttl != 0x01008102 {
+		t.Errorf("function TTL() failed:\ngot:0x%08x\nexpected: 0x01008102", ttl)
+	}
+
+	// 编码后解码，类型化字段应保持不变
+	rr := opt.ResourceRecord()
+	decoded := DNSResourceRecord{}
+	if _, err := decoded.DecodeFromBuffer(rr.Encode(), 0); err != nil {
+		t.Fatalf("function DecodeFromBuffer() failed:\n%s", err)
+	}
+	got, err := decoded.OPT()
+	if err != nil {
+		t.Fatalf("function OPT() failed:\n%s", err)
+	}
+	if got.UDPPayloadSize != opt.UDPPayloadSize || got.ExtendedRCode != opt.ExtendedRCode ||
+		got.Version != opt.Version || got.DO != opt.DO || got.Z != opt.Z {
+		t.Errorf("function OPT() failed:\ngot:\n%s\nexpected:\n%s", got, &opt)
+	}
+	if code, ok := OptionCodeOf(got.RData); !ok || code != EDNSOptionCodePadding {
+		t.Errorf("function OPT() failed: got option %d, %v", code, ok)
+	}
+
+	// 不携带选项的 OPT 记录
+	empty := (&DNSOPTRecord{UDPPayloadSize: 512}).ResourceRecord()
+	if size := len(empty.Encode()); size != 11 {
+		t.Errorf("function ResourceRecord() failed: got encoded size %d, expected 11", size)
+	}
+
+	// 类型或名称错误
+	notOPT := DNSResourceRecord{Name: *NewDNSName("."), Type: DNSRRTypeA, RData: &testedDNSRDATAA}
+	if _, err := notOPT.OPT(); err == nil {
+		t.Error("function OPT() failed: expected an error for a non-OPT record")
+	}
+	rr.Name = *NewDNSName("example.com")
+	if _, err := rr.OPT(); err == nil {
+		t.Error("function OPT() failed: expected an error for a non-root name")
+	}
+}
+
+func TestDNSMessageOPT(t *testing.T) {
+	msg := testedDNS
+	msg.Additional = DNSResponseSection{}
+	if _, ok := msg.OPT(); ok {
+		t.Error("function OPT() failed: expected no OPT record")
+	}
+	msg.Additional = append(msg.Additional, (&DNSOPTRecord{UDPPayloadSize: 4096, Version: 1}).ResourceRecord())
+	opt, ok := msg.OPT()
+	if !ok || opt.UDPPayloadSize != 4096 || opt.Version != 1 || opt.DO {
+		t.Errorf("function OPT() failed:\ngot:\n%v, %v", opt, ok)
+	}
+}
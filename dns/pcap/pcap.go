@@ -0,0 +1,270 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// pcap 包实现了一个最小的 pcap 抓包文件读取器，用于从抓包中提取 DNS 报文，
+// 以便将真实环境中解码失败的消息转换为 dns 包的测试用例（见 cmd/pcap2golden）。
+//
+// 其仅支持经典 pcap 格式（微秒及纳秒精度、大小端均可），不支持 pcapng；
+// 链路层支持 Ethernet（含 802.1Q VLAN）、Linux cooked capture、BSD loopback 及 RAW IP，
+// 网络层支持 IPv4（不处理分片）及 IPv6（不处理扩展头），传输层支持 UDP 及 TCP。
+// TCP 报文段不进行重组，仅提取报文段中带有 2 字节长度前缀的完整 DNS 消息。
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// 链路层类型
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+)
+
+// Packet 表示从抓包中提取出的一个 DNS 报文
+type Packet struct {
+	// 抓包时间
+	Time time.Time
+	// 源地址及目的地址
+	Src, Dst net.IP
+	// 源端口及目的端口
+	SrcPort, DstPort uint16
+	// 传输层协议，"udp" 或 "tcp"
+	Protocol string
+	// DNS 消息，不含 TCP 长度前缀
+	Payload []byte
+}
+
+// Reader 读取 pcap 文件中的 DNS 报文
+type Reader struct {
+	r        io.Reader
+	order    binary.ByteOrder
+	nanosec  bool
+	linkType uint32
+	// 视为 DNS 的端口，为空时为 53
+	Ports []uint16
+}
+
+// NewReader 读取 pcap 文件头并创建读取器
+// 其接受参数为：
+//   - r io.Reader，pcap 文件内容
+//
+// 返回值为：
+//   - *Reader，读取器
+//   - error，文件头无法识别时返回错误
+func NewReader(r io.Reader) (*Reader, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("function NewReader failed: read file header failed.\n%v", err)
+	}
+	reader := &Reader{r: r}
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4:
+		reader.order = binary.LittleEndian
+	case 0xd4c3b2a1:
+		reader.order = binary.BigEndian
+	case 0xa1b23c4d:
+		reader.order, reader.nanosec = binary.LittleEndian, true
+	case 0x4d3cb2a1:
+		reader.order, reader.nanosec = binary.BigEndian, true
+	case 0x0a0d0d0a:
+		return nil, fmt.Errorf("function NewReader failed: pcapng is not supported, convert it with \"editcap -F pcap\"")
+	default:
+		return nil, fmt.Errorf("function NewReader failed: unknown magic number 0x%08x", binary.LittleEndian.Uint32(header))
+	}
+	reader.linkType = reader.order.Uint32(header[20:]) & 0x0fffffff
+	switch reader.linkType {
+	case LinkTypeNull, LinkTypeEthernet, LinkTypeRaw, LinkTypeLinuxSLL:
+	default:
+		return nil, fmt.Errorf("function NewReader failed: unsupported link type %d", reader.linkType)
+	}
+	return reader, nil
+}
+
+// Next 返回下一个抓包记录中的 DNS 报文，非 DNS 的记录会被跳过
+// 返回值为：
+//   - []Packet，记录中的 DNS 报文，TCP 报文段中可能包含多个 DNS 消息
+//   - error，文件结束时返回 io.EOF
+func (r *Reader) Next() ([]Packet, error) {
+	for {
+		record := make([]byte, 16)
+		if _, err := io.ReadFull(r.r, record); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("method Reader Next failed: truncated record header")
+			}
+			return nil, err
+		}
+		sec, frac := r.order.Uint32(record), r.order.Uint32(record[4:])
+		capLen := r.order.Uint32(record[8:])
+		if capLen > 1<<18 {
+			return nil, fmt.Errorf("method Reader Next failed: record length %d is too large", capLen)
+		}
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return nil, fmt.Errorf("method Reader Next failed: truncated record.\n%v", err)
+		}
+
+		ts := time.Unix(int64(sec), int64(frac)*1000)
+		if r.nanosec {
+			ts = time.Unix(int64(sec), int64(frac))
+		}
+		packets := r.decode(data)
+		if len(packets) == 0 {
+			continue
+		}
+		for i := range packets {
+			packets[i].Time = ts
+		}
+		return packets, nil
+	}
+}
+
+// ReadAll 读取 pcap 文件中的全部 DNS 报文
+func ReadAll(r io.Reader) ([]Packet, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	all := []Packet{}
+	for {
+		packets, err := reader.Next()
+		if err == io.EOF {
+			return all, nil
+		}
+		if err != nil {
+			return all, err
+		}
+		all = append(all, packets...)
+	}
+}
+
+// decode 解析链路层，返回其中的 DNS 报文
+func (r *Reader) decode(data []byte) []Packet {
+	etherType := uint16(0)
+	switch r.linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		// 802.1Q VLAN 标签
+		for etherType == 0x8100 && len(data) >= 4 {
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case LinkTypeNull:
+		// 协议族以抓包主机的字节序存储
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	switch {
+	case etherType == 0x0800 || etherType == 0 && data[0]>>4 == 4:
+		return r.decodeIPv4(data)
+	case etherType == 0x86dd || etherType == 0 && data[0]>>4 == 6:
+		return r.decodeIPv6(data)
+	}
+	return nil
+}
+
+// decodeIPv4 解析 IPv4 报文，分片报文会被跳过
+func (r *Reader) decodeIPv4(data []byte) []Packet {
+	if len(data) < 20 {
+		return nil
+	}
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	if ihl < 20 || total < ihl || len(data) < ihl {
+		return nil
+	}
+	// More Fragments 标志或分片偏移不为 0
+	if binary.BigEndian.Uint16(data[6:])&0x3fff != 0 {
+		return nil
+	}
+	if total > len(data) {
+		total = len(data)
+	}
+	return r.decodeTransport(data[9], net.IP(data[12:16]), net.IP(data[16:20]), data[ihl:total])
+}
+
+// decodeIPv6 解析 IPv6 报文，带有扩展头的报文会被跳过
+func (r *Reader) decodeIPv6(data []byte) []Packet {
+	if len(data) < 40 {
+		return nil
+	}
+	end := 40 + int(binary.BigEndian.Uint16(data[4:]))
+	if end > len(data) {
+		end = len(data)
+	}
+	return r.decodeTransport(data[6], net.IP(data[8:24]), net.IP(data[24:40]), data[40:end])
+}
+
+// decodeTransport 解析 UDP 或 TCP 报文段
+func (r *Reader) decodeTransport(proto byte, src, dst net.IP, data []byte) []Packet {
+	packet := Packet{
+		Src: append(net.IP{}, src...),
+		Dst: append(net.IP{}, dst...),
+	}
+	switch proto {
+	case 17:
+		if len(data) < 8 {
+			return nil
+		}
+		packet.SrcPort, packet.DstPort = binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+		packet.Protocol = "udp"
+		if !r.isDNS(packet) {
+			return nil
+		}
+		packet.Payload = append([]byte{}, data[8:]...)
+		return []Packet{packet}
+	case 6:
+		if len(data) < 20 {
+			return nil
+		}
+		packet.SrcPort, packet.DstPort = binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+		packet.Protocol = "tcp"
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || len(data) < offset || !r.isDNS(packet) {
+			return nil
+		}
+		packets := []Packet{}
+		for payload := data[offset:]; len(payload) >= 2; {
+			length := int(binary.BigEndian.Uint16(payload))
+			if length == 0 || len(payload) < 2+length {
+				break
+			}
+			p := packet
+			p.Payload = append([]byte{}, payload[2:2+length]...)
+			packets = append(packets, p)
+			payload = payload[2+length:]
+		}
+		return packets
+	}
+	return nil
+}
+
+// isDNS 判断报文的源端口或目的端口是否为 DNS 端口
+func (r *Reader) isDNS(packet Packet) bool {
+	ports := r.Ports
+	if len(ports) == 0 {
+		ports = []uint16{53}
+	}
+	for _, port := range ports {
+		if packet.SrcPort == port || packet.DstPort == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// pcap_test.go 文件用于对 pcap.go 文件所实现的抓包读取器进行测试。
+
+package pcap
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"testing"
+)
+
+// 测试从抓包中提取 DNS 报文
+func TestReadAll(t *testing.T) {
+	f, err := os.Open("testdata/sample.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	packets, err := ReadAll(f)
+	if err != nil {
+		t.Fatalf("function ReadAll() failed:\n%v", err)
+	}
+	// 抓包中包含 UDP 及 TCP 上的查询与回复各一个，以及一个非 DNS 报文
+	expected := []struct {
+		protocol string
+		srcPort  uint16
+		dstPort  uint16
+	}{
+		{"udp", 40000, 53},
+		{"udp", 53, 40000},
+		{"tcp", 40001, 53},
+		{"tcp", 53, 40001},
+	}
+	if len(packets) != len(expected) {
+		t.Fatalf("function ReadAll() failed:\ngot %d packets\nexpected: %d", len(packets), len(expected))
+	}
+	for i, e := range expected {
+		p := packets[i]
+		if p.Protocol != e.protocol || p.SrcPort != e.srcPort || p.DstPort != e.dstPort {
+			t.Errorf("function ReadAll() failed: packet %d is %s %d->%d, expected %s %d->%d",
+				i, p.Protocol, p.SrcPort, p.DstPort, e.protocol, e.srcPort, e.dstPort)
+		}
+	}
+	if !packets[0].Src.Equal(net.IPv4(10, 0, 0, 2)) || !packets[0].Dst.Equal(net.IPv4(10, 10, 1, 4)) {
+		t.Errorf("function ReadAll() failed: unexpected addresses %s->%s", packets[0].Src, packets[0].Dst)
+	}
+	// TCP 载荷不应包含长度前缀
+	if !bytes.Equal(packets[0].Payload, packets[2].Payload) {
+		t.Errorf("function ReadAll() failed: UDP and TCP payloads differ:\n%v\n%v", packets[0].Payload, packets[2].Payload)
+	}
+}
+
+// 测试无法识别的文件头
+func TestNewReaderInvalid(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("function NewReader() failed: expected an error but got nil")
+	}
+	pcapng := []byte{0x0a, 0x0d, 0x0d, 0x0a}
+	if _, err := NewReader(bytes.NewReader(append(pcapng, make([]byte, 20)...))); err == nil {
+		t.Error("function NewReader() failed: expected an error for pcapng but got nil")
+	}
+}
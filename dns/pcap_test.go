@@ -0,0 +1,54 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// pcap_test.go 文件对 testdata/pcap 目录下自抓包中提取的 DNS 消息进行解码测试。
+// 新的用例可由 cmd/pcap2golden 生成，详见该命令的说明。
+
+package dns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// decodePcapFixture 解码用例，将解码过程中的 panic 转换为错误
+func decodePcapFixture(data []byte) (msg DNSMessage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic during decoding: %v", r)
+		}
+	}()
+	_, err = msg.DecodeFromBuffer(data, 0)
+	return msg, err
+}
+
+// 测试自抓包中提取的 DNS 消息能够被解码，且编码后再次解码的结果不变
+func TestPcapFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "pcap", "*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skip("no pcap fixtures")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := decodePcapFixture(data)
+			if err != nil {
+				t.Fatalf("function DecodeFromBuffer() failed:\n%v", err)
+			}
+			again, err := decodePcapFixture(msg.Encode())
+			if err != nil {
+				t.Fatalf("function DecodeFromBuffer() failed on re-encoded message:\n%v", err)
+			}
+			if diffs := Diff(&msg, &again); len(diffs) != 0 {
+				t.Errorf("re-encoded message differs:\n%v", diffs)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// property_test.go 文件对包含域名或变长字符串序列的 RDATA 类型进行基于随机输入的性质测试。
+// 对于随机生成的域名及字段值，测试断言：
+//   - Encode 与 EncodeToBuffer 的结果逐字节相同，且长度等于 Size；
+//   - DecodeFromBuffer 能够还原出原结构体，并返回 RDATA 之后的偏移量。
+
+package dns
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// propertyIterations 为每种 RDATA 类型的随机用例数量
+const propertyIterations = 500
+
+// propertyLabelChars 为随机标签使用的字符
+const propertyLabelChars = "abcdefghijklmnopqrstuvwxyz0123456789-"
+
+// randomDomainName 生成随机的域名，其线路格式长度不超过 255 字节
+func randomDomainName(r *rand.Rand) string {
+	if r.Intn(20) == 0 {
+		return "."
+	}
+	labels := []string{}
+	wireLen := 1
+	for n := 1 + r.Intn(6); len(labels) < n; {
+		label := make([]byte, 1+r.Intn(63))
+		for i := range label {
+			label[i] = propertyLabelChars[r.Intn(len(propertyLabelChars))]
+		}
+		if wireLen+1+len(label) > 255 {
+			break
+		}
+		wireLen += 1 + len(label)
+		labels = append(labels, string(label))
+	}
+	return strings.Join(labels, ".")
+}
+
+// randomBytes 生成长度为 [min, max] 的随机字节切片
+func randomBytes(r *rand.Rand, min, max int) []byte {
+	b := make([]byte, min+r.Intn(max-min+1))
+	r.Read(b)
+	return b
+}
+
+// randomTypeBitMaps 生成随机的、升序且不重复的类型列表
+func randomTypeBitMaps(r *rand.Rand) []DNSType {
+	seen := map[DNSType]bool{}
+	types := []DNSType{}
+	for n := 1 + r.Intn(8); len(types) < n; {
+		t := DNSType(1 + r.Intn(300))
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// propertyGenerators 记录各 RDATA 类型的随机生成函数
+var propertyGenerators = map[string]func(r *rand.Rand) DNSRRRDATA{
+	"NS": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATANS{NSDNAME: randomDomainName(r)}
+	},
+	"CNAME": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATACNAME{CNAME: randomDomainName(r)}
+	},
+	"PTR": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATAPTR{PTR: randomDomainName(r)}
+	},
+	"DNAME": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATADNAME{DNAME: randomDomainName(r)}
+	},
+	"SOA": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATASOA{
+			MName:   randomDomainName(r),
+			RName:   randomDomainName(r),
+			Serial:  r.Uint32(),
+			Refresh: r.Uint32(),
+			Retry:   r.Uint32(),
+			Expire:  r.Uint32(),
+			Minimum: r.Uint32(),
+		}
+	},
+	"RRSIG": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATARRSIG{
+			TypeCovered: DNSType(r.Intn(1 << 16)),
+			Algorithm:   DNSSECAlgorithm(r.Intn(1 << 8)),
+			Labels:      uint8(r.Intn(1 << 8)),
+			OriginalTTL: r.Uint32(),
+			Expiration:  r.Uint32(),
+			Inception:   r.Uint32(),
+			KeyTag:      uint16(r.Intn(1 << 16)),
+			SignerName:  randomDomainName(r),
+			Signature:   randomBytes(r, 0, 256),
+		}
+	},
+	"TXT": func(r *rand.Rand) DNSRRRDATA {
+		txt := []string{}
+		for n := 1 + r.Intn(4); len(txt) < n; {
+			txt = append(txt, string(randomBytes(r, 0, 255)))
+		}
+		return &DNSRDATATXT{TXT: txt}
+	},
+	"NSEC": func(r *rand.Rand) DNSRRRDATA {
+		return &DNSRDATANSEC{
+			NextDomainName: randomDomainName(r),
+			TypeBitMaps:    randomTypeBitMaps(r),
+		}
+	},
+}
+
+// 测试包含域名的 RDATA 类型的编解码性质
+func TestRDATAProperties(t *testing.T) {
+	for name, generate := range propertyGenerators {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(20241015))
+			for i := 0; i < propertyIterations; i++ {
+				rdata := generate(r)
+
+				encoded, err := encodeSafely(rdata)
+				if err != nil {
+					t.Fatalf("function Encode() failed:\n%v\nrdata:\n%s", err, rdata)
+				}
+				if len(encoded) != rdata.Size() {
+					t.Fatalf("function Encode() failed: got %d bytes, Size() is %d\nrdata:\n%s", len(encoded), rdata.Size(), rdata)
+				}
+				buffer := make([]byte, rdata.Size())
+				n, err := rdata.EncodeToBuffer(buffer)
+				if err != nil {
+					t.Fatalf("function EncodeToBuffer() failed:\n%v\nrdata:\n%s", err, rdata)
+				}
+				if n != len(encoded) || !bytes.Equal(buffer, encoded) {
+					t.Fatalf("function EncodeToBuffer() failed:\ngot %d bytes:\n%x\nEncode():\n%x", n, buffer, encoded)
+				}
+
+				// 以随机长度的填充字节作为前缀，以检查偏移量的处理
+				prefix := randomBytes(r, 0, 16)
+				wire := append(append([]byte{}, prefix...), encoded...)
+				decoded := reflect.New(reflect.TypeOf(rdata).Elem()).Interface().(DNSRRRDATA)
+				end, err := decoded.DecodeFromBuffer(wire, len(prefix), len(encoded))
+				if err != nil {
+					t.Fatalf("function DecodeFromBuffer() failed:\n%v\nrdata:\n%s", err, rdata)
+				}
+				if end != len(wire) {
+					t.Fatalf("function DecodeFromBuffer() failed: got offset %d, expected %d\nrdata:\n%s", end, len(wire), rdata)
+				}
+				if !decoded.Equal(rdata) {
+					t.Fatalf("function DecodeFromBuffer() failed:\ngot:\n%s\nexpected:\n%s", decoded, rdata)
+				}
+			}
+		})
+	}
+}
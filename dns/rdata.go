@@ -8,8 +8,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"net"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // DNSRRRDATA 接口表示 DNS 资源记录的 RDATA 部分,
@@ -78,12 +79,30 @@ func DNSRRRDATAFactory(rtype DNSType) DNSRRRDATA {
 	switch rtype {
 	case DNSRRTypeA:
 		return &DNSRDATAA{}
+	case DNSRRTypeAAAA:
+		return &DNSRDATAAAAA{}
 	case DNSRRTypeNS:
 		return &DNSRDATANS{}
 	case DNSRRTypeCNAME:
 		return &DNSRDATACNAME{}
+	case DNSRRTypePTR:
+		return &DNSRDATAPTR{}
+	case DNSRRTypeDNAME:
+		return &DNSRDATADNAME{}
+	case DNSRRTypeSOA:
+		return &DNSRDATASOA{}
 	case DNSRRTypeTXT:
 		return &DNSRDATATXT{}
+	case DNSRRTypeRRSIG:
+		return &DNSRDATARRSIG{}
+	case DNSRRTypeDNSKEY:
+		return &DNSRDATADNSKEY{}
+	case DNSRRTypeDS:
+		return &DNSRDATADS{}
+	case DNSRRTypeNSEC:
+		return &DNSRDATANSEC{}
+	case DNSRRTypeNSEC3:
+		return &DNSRDATANSEC3{}
 	default:
 		return &DNSRDATAUnknown{
 			RRType: rtype,
@@ -136,11 +155,11 @@ func (rdata *DNSRDATAUnknown) EncodeToBuffer(buffer []byte) (int, error) {
 }
 
 func (rdata *DNSRDATAUnknown) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
-	if len(buffer) < offset+rdata.Size() {
-		return -1, fmt.Errorf("method DNSRDATAUnknown DecodeFromBuffer failed: buffer length %d is less than offset %d + Unknown RDATA size %d", len(buffer), offset, rdata.Size())
+	if len(buffer) < offset+rdLen {
+		return -1, fmt.Errorf("method DNSRDATAUnknown DecodeFromBuffer failed: buffer length %d is less than offset %d + Unknown RDATA size %d", len(buffer), offset, rdLen)
 	}
-	rdata.RData = buffer[offset:]
-	return offset + rdata.Size(), nil
+	rdata.RData = append([]byte{}, buffer[offset:offset+rdLen]...)
+	return offset + rdLen, nil
 }
 
 // A RDATA 编码格式
@@ -154,7 +173,7 @@ func (rdata *DNSRDATAUnknown) DecodeFromBuffer(buffer []byte, offset int, rdLen
 // RFC 1035 3.4.1 节 定义了 A 类型的 DNS 资源记录的 RDATA 部分的编码格式。
 // 其 Type 值为 1。
 type DNSRDATAA struct {
-	Address net.IP
+	Address IP
 }
 
 func (rdata *DNSRDATAA) Type() DNSType {
@@ -162,7 +181,7 @@ func (rdata *DNSRDATAA) Type() DNSType {
 }
 
 func (rdata *DNSRDATAA) Size() int {
-	return net.IPv4len
+	return 4
 }
 
 func (rdata *DNSRDATAA) String() string {
@@ -206,7 +225,79 @@ func (rdata *DNSRDATAA) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (
 	if len(buffer) < offset+rdata.Size() {
 		return -1, fmt.Errorf("method DNSRDATAA DecodeFromBuffer failed: buffer length %d is less than offset %d + A RDATA size %d", len(buffer), offset, rdata.Size())
 	}
-	rdata.Address = net.IPv4(buffer[offset], buffer[offset+1], buffer[offset+2], buffer[offset+3])
+	rdata.Address = IPv4(buffer[offset], buffer[offset+1], buffer[offset+2], buffer[offset+3])
+	return offset + rdata.Size(), nil
+}
+
+// AAAA RDATA 编码格式
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// |                                               |
+// |                                               |
+// |                    ADDRESS                    |
+// |                                               |
+// |                                               |
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+
+// DNSRDATAAAAA 结构体表示 AAAA 类型的 DNS 资源记录的 RDATA 部分。
+//   - 其包含一个128位 IPv6 地址。
+//
+// RFC 3596 2.2 节 定义了 AAAA 类型的 DNS 资源记录的 RDATA 部分的编码格式。
+// 其 Type 值为 28。
+type DNSRDATAAAAA struct {
+	Address IP
+}
+
+func (rdata *DNSRDATAAAAA) Type() DNSType {
+	return DNSRRTypeAAAA
+}
+
+func (rdata *DNSRDATAAAAA) Size() int {
+	return 16
+}
+
+func (rdata *DNSRDATAAAAA) String() string {
+	return fmt.Sprint(
+		"### RDATA Section ###\n",
+		"Address: ", rdata.Address.String(),
+	)
+}
+
+func (rdata *DNSRDATAAAAA) Equal(rr DNSRRRDATA) bool {
+	rraaaa, ok := rr.(*DNSRDATAAAAA)
+	if !ok {
+		return false
+	}
+	return rdata.Address.Equal(rraaaa.Address)
+}
+
+func (rdata *DNSRDATAAAAA) Encode() []byte {
+	return rdata.Address.To16()
+}
+
+// EncodeToBuffer 方法将编码后的 RDATA 部分写入缓冲区。
+//   - 其接收 缓冲区切片 作为参数。
+//   - 返回值为 写入的字节数 和 错误信息。
+//
+// 如果缓冲区长度不足，返回 -1 和错误信息。
+func (rdata *DNSRDATAAAAA) EncodeToBuffer(buffer []byte) (int, error) {
+	if len(buffer) < rdata.Size() {
+		return -1, fmt.Errorf("method DNSRDATAAAAA EncodeToBuffer failed: buffer length %d is less than AAAA RDATA size %d", len(buffer), rdata.Size())
+	}
+	copy(buffer, rdata.Encode())
+	return rdata.Size(), nil
+}
+
+// DecodeFromBuffer 方法从包含 DNS消息 的缓冲区中解码 RDATA 部分。
+//   - 其接收 缓冲区, 偏移量 作为参数。
+//   - 返回值为 解码后的偏移量 和 错误信息。
+//
+// 如果出现错误，返回 -1, 及 相应报错 。
+func (rdata *DNSRDATAAAAA) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
+	if len(buffer) < offset+rdata.Size() {
+		return -1, fmt.Errorf("method DNSRDATAAAAA DecodeFromBuffer failed: buffer length %d is less than offset %d + AAAA RDATA size %d", len(buffer), offset, rdata.Size())
+	}
+	rdata.Address = make(IP, 16)
+	copy(rdata.Address, buffer[offset:offset+16])
 	return offset + rdata.Size(), nil
 }
 
@@ -332,6 +423,122 @@ func (rdata *DNSRDATACNAME) DecodeFromBuffer(buffer []byte, offset int, rdLen in
 	return offset, nil
 }
 
+// PTR RDATA 编码格式
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                   PTRDNAME                    /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+
+// DNSRDATAPTR 结构体表示 PTR 类型的 DNS 资源记录的 RDATA 部分。
+//   - 其包含一个 <domain-name> ，指向域名空间中的某个位置。
+//
+// RFC 1035 3.3.12 节 定义了 PTR 类型的 DNS 资源记录。
+// 其 Type 值为 12。
+type DNSRDATAPTR struct {
+	PTR string
+}
+
+func (rdata *DNSRDATAPTR) Type() DNSType {
+	return DNSRRTypePTR
+}
+
+func (rdata *DNSRDATAPTR) Size() int {
+	return GetDomainNameWireLen(&rdata.PTR)
+}
+
+func (rdata *DNSRDATAPTR) String() string {
+	return fmt.Sprint(
+		"### RDATA Section ###\n",
+		"PTR: ", rdata.PTR,
+	)
+}
+
+func (rdata *DNSRDATAPTR) Equal(rr DNSRRRDATA) bool {
+	rrptr, ok := rr.(*DNSRDATAPTR)
+	if !ok {
+		return false
+	}
+	return rdata.PTR == rrptr.PTR
+}
+
+func (rdata *DNSRDATAPTR) Encode() []byte {
+	return EncodeDomainName(&rdata.PTR)
+}
+
+func (rdata *DNSRDATAPTR) EncodeToBuffer(buffer []byte) (int, error) {
+	len, err := EncodeDomainNameToBuffer(&rdata.PTR, buffer)
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATAPTR EncodeToBuffer failed: encode PTR failed.\n%v", err)
+	}
+	return len, nil
+}
+
+func (rdata *DNSRDATAPTR) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
+	var err error
+	rdata.PTR, offset, err = DecodeDomainNameFromBuffer(buffer, offset)
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATAPTR DecodeFromBuffer failed: decode PTR failed.\n%v", err)
+	}
+	return offset, nil
+}
+
+// DNAME RDATA 编码格式
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+// /                    TARGET                     /
+// +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+
+// DNSRDATADNAME 结构体表示 DNAME 类型的 DNS 资源记录的 RDATA 部分。
+//   - 其包含一个 <domain-name> ，所有者名称之下的整个子树都将被重定向至该名称之下。
+//
+// RFC 6672 2.1 节 定义了 DNAME 类型的 DNS 资源记录。
+// 其 Type 值为 39，其 RDATA 中的名称不得被压缩。
+type DNSRDATADNAME struct {
+	DNAME string
+}
+
+func (rdata *DNSRDATADNAME) Type() DNSType {
+	return DNSRRTypeDNAME
+}
+
+func (rdata *DNSRDATADNAME) Size() int {
+	return GetDomainNameWireLen(&rdata.DNAME)
+}
+
+func (rdata *DNSRDATADNAME) String() string {
+	return fmt.Sprint(
+		"### RDATA Section ###\n",
+		"DNAME: ", rdata.DNAME,
+	)
+}
+
+func (rdata *DNSRDATADNAME) Equal(rr DNSRRRDATA) bool {
+	rrdname, ok := rr.(*DNSRDATADNAME)
+	if !ok {
+		return false
+	}
+	return rdata.DNAME == rrdname.DNAME
+}
+
+func (rdata *DNSRDATADNAME) Encode() []byte {
+	return EncodeDomainName(&rdata.DNAME)
+}
+
+func (rdata *DNSRDATADNAME) EncodeToBuffer(buffer []byte) (int, error) {
+	len, err := EncodeDomainNameToBuffer(&rdata.DNAME, buffer)
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATADNAME EncodeToBuffer failed: encode DNAME failed.\n%v", err)
+	}
+	return len, nil
+}
+
+func (rdata *DNSRDATADNAME) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
+	var err error
+	rdata.DNAME, offset, err = DecodeDomainNameFromBuffer(buffer, offset)
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATADNAME DecodeFromBuffer failed: decode DNAME failed.\n%v", err)
+	}
+	return offset, nil
+}
+
 // SOA RDATA 编码格式
 // +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 // /                     MNAME                     /
@@ -421,16 +628,16 @@ func (rdata *DNSRDATASOA) Encode() []byte {
 	if err != nil {
 		panic(fmt.Sprintf("method DNSRDATASOA Encode failed: encode RName failed.\n%v", err))
 	}
-	binary.BigEndian.PutUint32(bytesArray[offset+4:], rdata.Serial)
-	binary.BigEndian.PutUint32(bytesArray[offset+8:], rdata.Refresh)
-	binary.BigEndian.PutUint32(bytesArray[offset+12:], rdata.Retry)
-	binary.BigEndian.PutUint32(bytesArray[offset+16:], rdata.Expire)
-	binary.BigEndian.PutUint32(bytesArray[offset+20:], rdata.Minimum)
+	binary.BigEndian.PutUint32(bytesArray[offset:], rdata.Serial)
+	binary.BigEndian.PutUint32(bytesArray[offset+4:], rdata.Refresh)
+	binary.BigEndian.PutUint32(bytesArray[offset+8:], rdata.Retry)
+	binary.BigEndian.PutUint32(bytesArray[offset+12:], rdata.Expire)
+	binary.BigEndian.PutUint32(bytesArray[offset+16:], rdata.Minimum)
 	return bytesArray
 }
 
 func (rdata *DNSRDATASOA) EncodeToBuffer(buffer []byte) (int, error) {
-	if len(buffer) < 20 {
+	if len(buffer) < rdata.Size() {
 		return -1, fmt.Errorf("method DNSRDATASOA EncodeToBuffer failed: buffer length %d is less than SOA RDATA size %d", len(buffer), rdata.Size())
 	}
 	offset := 0
@@ -454,20 +661,26 @@ func (rdata *DNSRDATASOA) EncodeToBuffer(buffer []byte) (int, error) {
 
 func (rdata *DNSRDATASOA) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
 	var err error
-	nLen := 0
+	rdEnd := offset + rdLen
+	if len(buffer) < rdEnd {
+		return -1, fmt.Errorf("method DNSRDATASOA DecodeFromBuffer failed: buffer length %d is less than offset %d + SOA RDATA size %d", len(buffer), offset, rdLen)
+	}
 
-	rdata.MName, nLen, err = DecodeDomainNameFromBuffer(buffer, offset)
-	offset += nLen
+	// DecodeDomainNameFromBuffer 返回的是域名之后的偏移量
+	rdata.MName, offset, err = DecodeDomainNameFromBuffer(buffer, offset)
 	if err != nil {
 		return -1, fmt.Errorf("method DNSRDATASOA DecodeFromBuffer failed: decode MName failed.\n%v", err)
 	}
 
-	rdata.RName, nLen, err = DecodeDomainNameFromBuffer(buffer, offset)
-	offset += nLen
+	rdata.RName, offset, err = DecodeDomainNameFromBuffer(buffer, offset)
 	if err != nil {
 		return -1, fmt.Errorf("method DNSRDATASOA DecodeFromBuffer failed: decode RName failed.\n%v", err)
 	}
 
+	if offset+20 > rdEnd {
+		return -1, fmt.Errorf("method DNSRDATASOA DecodeFromBuffer failed: SOA RDATA size %d is too small for its fixed fields", rdLen)
+	}
+
 	rdata.Serial = binary.BigEndian.Uint32(buffer[offset : offset+4])
 	offset += 4
 	rdata.Refresh = binary.BigEndian.Uint32(buffer[offset : offset+4])
@@ -491,13 +704,34 @@ func (rdata *DNSRDATASOA) DecodeFromBuffer(buffer []byte, offset int, rdLen int)
 // +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 
 // DNSRDATATXT 结构体表示 TXT 类型的 DNS 资源记录的 RDATA 部分。
-//   - 其包含<character-string>，用于存储任意文本信息，文本信息的语义(Semantics)由其区域定义。
+//   - 其包含一个或多个<character-string>，用于存储任意文本信息，文本信息的语义(Semantics)由其区域定义。
+//   - 字符串之间的边界是有意义的，解析器不会将其合并，如 SPF 记录即依赖于此。
+//
+// 长度超过 255 字节的字符串在编码时会被拆分为多个<character-string>，
+// 因此其解码结果与编码前不同；未包含任何字符串时编码为一个空的<character-string>。
 //
 // RFC 1035 3.3.14 节 定义了 TXT 类型的 DNS 资源记录。
 // 其 Type 值为 16。
 type DNSRDATATXT struct {
-	// <character-string>
-	TXT string
+	// <character-string>序列
+	TXT []string
+}
+
+// NewDNSRDATATXT 根据单个字符串创建 TXT RDATA，字符串会被拆分为不超过 255 字节的片段。
+// 其用于兼容 TXT 字段为单个字符串时的用法。
+func NewDNSRDATATXT(txt string) *DNSRDATATXT {
+	rdata := &DNSRDATATXT{TXT: []string{}}
+	for len(txt) > 255 {
+		rdata.TXT = append(rdata.TXT, txt[:255])
+		txt = txt[255:]
+	}
+	rdata.TXT = append(rdata.TXT, txt)
+	return rdata
+}
+
+// Text 返回全部字符串拼接后的结果，与 NewDNSRDATATXT 相对应。
+func (rdata *DNSRDATATXT) Text() string {
+	return strings.Join(rdata.TXT, "")
 }
 
 func (rdata *DNSRDATATXT) Type() DNSType {
@@ -505,13 +739,24 @@ func (rdata *DNSRDATATXT) Type() DNSType {
 }
 
 func (rdata *DNSRDATATXT) Size() int {
-	return GetCharacterStrWireLen(&rdata.TXT)
+	if len(rdata.TXT) == 0 {
+		return 1
+	}
+	size := 0
+	for i := range rdata.TXT {
+		size += GetCharacterStrWireLen(&rdata.TXT[i])
+	}
+	return size
 }
 
 func (rdata *DNSRDATATXT) String() string {
+	quoted := make([]string, len(rdata.TXT))
+	for i, txt := range rdata.TXT {
+		quoted[i] = strconv.Quote(txt)
+	}
 	return fmt.Sprint(
 		"### RDATA Section ###\n",
-		"TXT: ", rdata.TXT,
+		"TXT: ", strings.Join(quoted, " "),
 	)
 }
 
@@ -520,28 +765,60 @@ func (rdata *DNSRDATATXT) Equal(rr DNSRRRDATA) bool {
 	if !ok {
 		return false
 	}
-	return rdata.TXT == rrtxt.TXT
+	if len(rdata.TXT) != len(rrtxt.TXT) {
+		return false
+	}
+	for i := range rdata.TXT {
+		if rdata.TXT[i] != rrtxt.TXT[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (rTXT *DNSRDATATXT) Encode() []byte {
-	return EncodeCharacterStr(&rTXT.TXT)
+	bytesArray := make([]byte, rTXT.Size())
+	_, err := rTXT.EncodeToBuffer(bytesArray)
+	if err != nil {
+		panic(fmt.Sprintf("method DNSRDATATXT Encode failed: encode TXT failed.\n%v", err))
+	}
+	return bytesArray
 }
 
 func (rdata *DNSRDATATXT) EncodeToBuffer(buffer []byte) (int, error) {
-	sz, err := EncodeCharacterStrToBuffer(&rdata.TXT, buffer)
-	if err != nil {
-		return -1, fmt.Errorf("method DNSRDATATXT EncodeToBuffer failed: encode TXT failed.\n%v", err)
+	if len(buffer) < rdata.Size() {
+		return -1, fmt.Errorf("method DNSRDATATXT EncodeToBuffer failed: buffer length %d is less than TXT RDATA size %d", len(buffer), rdata.Size())
 	}
-	return sz, nil
+	if len(rdata.TXT) == 0 {
+		buffer[0] = 0x00
+		return 1, nil
+	}
+	offset := 0
+	for i := range rdata.TXT {
+		sz, err := EncodeCharacterStrToBuffer(&rdata.TXT[i], buffer[offset:])
+		if err != nil {
+			return -1, fmt.Errorf("method DNSRDATATXT EncodeToBuffer failed: encode TXT failed.\n%v", err)
+		}
+		offset += sz
+	}
+	return offset, nil
 }
 
 func (rdata *DNSRDATATXT) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
 	rdEnd := offset + rdLen
 	if len(buffer) < rdEnd {
-		return -1, fmt.Errorf("method DNSRDATATXT DecodeFromBuffer failed: buffer length %d is less than offset %d + TXT RDATA size %d", len(buffer), offset, rdata.Size())
+		return -1, fmt.Errorf("method DNSRDATATXT DecodeFromBuffer failed: buffer length %d is less than offset %d + TXT RDATA size %d", len(buffer), offset, rdLen)
 	}
-	rdata.TXT = DecodeCharacterStr(buffer[offset:rdEnd])
-	return offset + rdata.Size(), nil
+	rdata.TXT = []string{}
+	for offset < rdEnd {
+		strLen := int(buffer[offset])
+		if offset+1+strLen > rdEnd {
+			return -1, fmt.Errorf("method DNSRDATATXT DecodeFromBuffer failed: character-string length %d at offset %d exceeds TXT RDATA end %d", strLen, offset, rdEnd)
+		}
+		rdata.TXT = append(rdata.TXT, string(buffer[offset+1:offset+1+strLen]))
+		offset += 1 + strLen
+	}
+	return rdEnd, nil
 }
 
 // RRSIG RDATA 编码格式
@@ -665,7 +942,7 @@ func (rdata *DNSRDATARRSIG) DecodeFromBuffer(buffer []byte, offset int, rdLen in
 	if rdLen < 18 {
 		return -1, fmt.Errorf("method DNSRDATARRSIG DecodeFromBuffer failed: RRSIG RDATA size %d is less than 18", rdLen)
 	}
-	if len(buffer) < offset+18 {
+	if len(buffer) < offset+rdLen {
 		return -1, fmt.Errorf("method DNSRDATARRSIG DecodeFromBuffer failed: buffer length %d is less than offset %d + RRSIG RDATA size %d", len(buffer), offset, rdata.Size())
 	}
 	var err error
@@ -681,7 +958,7 @@ func (rdata *DNSRDATARRSIG) DecodeFromBuffer(buffer []byte, offset int, rdLen in
 	if err != nil {
 		return -1, fmt.Errorf("method DNSRDATARRSIG DecodeFromBuffer failed: decode RRSIG Signer Name failed.\n%v", err)
 	}
-	copy(rdata.Signature, buffer[offset:rdEnd])
+	rdata.Signature = append([]byte{}, buffer[offset:rdEnd]...)
 	return rdEnd, nil
 }
 
@@ -766,13 +1043,13 @@ func (rdata *DNSRDATADNSKEY) DecodeFromBuffer(buffer []byte, offset int, rdLen i
 	if rdLen < 4 {
 		return -1, fmt.Errorf("method DNSRDATADNSKEY DecodeFromBuffer failed: DNSKEY RDATA size %d is less than 4", rdLen)
 	}
-	if len(buffer) < offset+4 {
+	if len(buffer) < rdEnd {
 		return -1, fmt.Errorf("method DNSRDATADNSKEY DecodeFromBuffer failed: buffer length %d is less than offset %d + DNSKEY RDATA size %d", len(buffer), offset, rdata.Size())
 	}
 	rdata.Flags = DNSKEYFlag(binary.BigEndian.Uint16(buffer[offset:]))
 	rdata.Protocol = DNSKEYProtocol(buffer[offset+2])
 	rdata.Algorithm = DNSSECAlgorithm(buffer[offset+3])
-	copy(rdata.PublicKey, buffer[offset+4:rdEnd])
+	rdata.PublicKey = append([]byte{}, buffer[offset+4:rdEnd]...)
 	return rdEnd, nil
 }
 
@@ -863,7 +1140,7 @@ func (rdata *DNSRDATADS) DecodeFromBuffer(buffer []byte, offset int, rdLen int)
 	rdata.KeyTag = binary.BigEndian.Uint16(buffer[offset:])
 	rdata.Algorithm = DNSSECAlgorithm(buffer[offset+2])
 	rdata.DigestType = DNSSECDigestType(buffer[offset+3])
-	copy(rdata.Digest, buffer[offset+4:rdEnd])
+	rdata.Digest = append([]byte{}, buffer[offset+4:rdEnd]...)
 	return rdEnd, nil
 }
 
@@ -939,7 +1216,8 @@ func EncodeTypeBitMaps(typeList []DNSType) []byte {
 			}
 		}
 		var temp []byte
-		z := int(t) / 8
+		// 窗口内的字节序号
+		z := (t % 256) / 8
 
 		for i := 0; i < z; i++ {
 			temp = append(temp, 0)
@@ -976,11 +1254,10 @@ func (rdata *DNSRDATANSEC) Equal(rr DNSRRRDATA) bool {
 	}
 
 	typeList := make([]int, 0)
-	sort.Ints(typeList)
-
 	for _, t := range rdata.TypeBitMaps {
 		typeList = append(typeList, int(t))
 	}
+	sort.Ints(typeList)
 
 	rrTypeList := make([]int, 0)
 	for _, t := range rrnsec.TypeBitMaps {
@@ -1011,22 +1288,32 @@ func (rdata *DNSRDATANSEC) Encode() []byte {
 }
 
 func (rdata *DNSRDATANSEC) EncodeToBuffer(buffer []byte) (int, error) {
-	nextDomainName := EncodeDomainName(&rdata.NextDomainName)
-	typeBitMaps := EncodeTypeBitMaps(rdata.TypeBitMaps)
-	size := len(nextDomainName) + len(typeBitMaps)
+	size := rdata.Size()
 	if len(buffer) < size {
-		return -1, fmt.Errorf("buffer length %d is less than NSEC RDATA size %d", len(buffer), rdata.Size())
+		return -1, fmt.Errorf("buffer length %d is less than NSEC RDATA size %d", len(buffer), size)
 	}
-	copy(buffer, nextDomainName)
-	copy(buffer[len(nextDomainName):], typeBitMaps)
-	return rdata.Size(), nil
+	offset, err := EncodeDomainNameToBuffer(&rdata.NextDomainName, buffer)
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATANSEC EncodeToBuffer failed: encode NextDomainName failed.\n%v", err)
+	}
+	copy(buffer[offset:], EncodeTypeBitMaps(rdata.TypeBitMaps))
+	return size, nil
 }
 
-func DecodeTypeBitMaps(typeBitMaps []byte) []DNSType {
+// DecodeTypeBitMaps 解码 NSEC / NSEC3 的类型位图（RFC 4034 4.1.2 节）。
+// - 其接收参数为 类型位图的字节切片，
+// - 返回值为 类型列表 和 错误信息，窗口头部或位图超出切片时返回错误。
+func DecodeTypeBitMaps(typeBitMaps []byte) ([]DNSType, error) {
 	var typeList []DNSType
 	for i := 0; i < len(typeBitMaps); {
+		if i+2 > len(typeBitMaps) {
+			return nil, fmt.Errorf("function DecodeTypeBitMaps failed: window header at offset %d exceeds type bit maps length %d", i, len(typeBitMaps))
+		}
 		index := int(typeBitMaps[i])
 		length := int(typeBitMaps[i+1])
+		if i+2+length > len(typeBitMaps) {
+			return nil, fmt.Errorf("function DecodeTypeBitMaps failed: window %d bitmap length %d exceeds type bit maps length %d", index, length, len(typeBitMaps))
+		}
 		for j := 0; j < int(length); j++ {
 			for k := 0; k < 8; k++ {
 				if typeBitMaps[i+2+j]&(0x80>>k) != 0 {
@@ -1036,7 +1323,7 @@ func DecodeTypeBitMaps(typeBitMaps []byte) []DNSType {
 		}
 		i += 2 + int(length)
 	}
-	return typeList
+	return typeList, nil
 }
 
 func (rdata *DNSRDATANSEC) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
@@ -1049,221 +1336,164 @@ func (rdata *DNSRDATANSEC) DecodeFromBuffer(buffer []byte, offset int, rdLen int
 	if err != nil {
 		return -1, fmt.Errorf("method DNSRDATANSEC DecodeFromBuffer failed: decode NSEC Next Domain Name failed.\n%v", err)
 	}
-	rdata.TypeBitMaps = DecodeTypeBitMaps(buffer[offset:rdEnd])
+	if offset > rdEnd {
+		return -1, fmt.Errorf("method DNSRDATANSEC DecodeFromBuffer failed: NSEC Next Domain Name exceeds NSEC RDATA size %d", rdLen)
+	}
+	rdata.TypeBitMaps, err = DecodeTypeBitMaps(buffer[offset:rdEnd])
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATANSEC DecodeFromBuffer failed: decode NSEC Type Bit Maps failed.\n%v", err)
+	}
 	return rdEnd, nil
 }
 
-// // NSEC3 RDATA 编码格式
-// // 1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
-// // 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
-// // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// // |   Hash Alg.  | 	Flags 	| 			Iterations			   |
-// // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// // |  Salt Length | 					Salt 		    	       /
-// // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// // |  Hash Length | 			Next Hashed Owner Name		       /
-// // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-// // / 						Type Bit Maps				 		   /
-// // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
-
-// // DNSRDATANSEC3 结构体表示 NSEC3 类型的 DNS 资源记录的 RDATA 部分。
-// // 其包含以下字段：
-// //   - HashAlgorithm: 8位无符号整数，表示哈希算法。
-// //   - Flags: 8位无符号整数，表示标志。
-// //   - Iterations: 16位无符号整数，表示迭代次数。
-// //   - SaltLength: 8位无符号整数，表示Salt长度。
-// //   - Salt: 字符串，表示Salt。
-// //   - HashLength: 8位无符号整数，表示哈希长度。
-// //   - NextHashedOwnerName: 下一个哈希的所有名称。
-// //   - TypeBitMaps: 类型位图。
-// //
-// // RFC 5155 3.2 节 定义了 NSEC3 类型的 DNS 资源记录的 RDATA 部分的编码格式。
-// // 其 Type 值为 50。
-
-// type DNSRDATANSEC3 struct {
-// 	HashAlgorithm       DNSSECDigestType
-// 	Flags               NSEC3Flags
-// 	Iterations          uint16
-// 	SaltLength          uint8
-// 	Salt                string
-// 	HashLength          uint8
-// 	NextHashedOwnerName string
-// 	TypeBitMaps         []DNSType
-// }
-
-// type NSEC3Flags uint8
-
-// const (
-// 	NSEC3FlagOptOut   NSEC3Flags = 1
-// 	NSEC3FlagReserved NSEC3Flags = 0
-// )
-
-// func (rdata *DNSRDATANSEC3) Type() DNSType {
-// 	return DNSRRTypeNSEC3
-// }
-
-// func (rdata *DNSRDATANSEC3) Size() int {
-// 	saltBytes := []byte(rdata.Salt)
-// 	nextHashOwnerName := rdata.HashOwnerName(rdata.NextHashedOwnerName)
-// 	typeBitMaps := EncodeTypeBitMaps(rdata.TypeBitMaps)
-// 	size := 6 + len(saltBytes) + len(nextHashOwnerName) + len(typeBitMaps)
-// 	return size
-// }
-
-// func (rdata *DNSRDATANSEC3) String() string {
-// 	return fmt.Sprint(
-// 		"### RDATA Section ###\n",
-// 		"Hash Algorithm: ", rdata.HashAlgorithm,
-// 		"\nFlags: ", rdata.Flags,
-// 		"\nIterations: ", rdata.Iterations,
-// 		"\nSalt Length: ", rdata.SaltLength,
-// 		"\nSalt: ", rdata.Salt,
-// 		"\nHash Length: ", rdata.HashLength,
-// 		"\nNext Hashed Owner Name: ", rdata.NextHashedOwnerName,
-// 		"\nType Bit Maps: ", rdata.TypeBitMaps,
-// 	)
-// }
-
-// func (rdata *DNSRDATANSEC3) Equal(rr DNSRRRDATA) bool {
-// 	rrnsec3, ok := rr.(*DNSRDATANSEC3)
-// 	if !ok {
-// 		return false
-// 	}
-
-// 	typeList := make([]int, 0)
-// 	sort.Ints(typeList)
-
-// 	for _, t := range rdata.TypeBitMaps {
-// 		typeList = append(typeList, int(t))
-// 	}
-
-// 	rrTypeList := make([]int, 0)
-// 	for _, t := range rrnsec3.TypeBitMaps {
-// 		rrTypeList = append(rrTypeList, int(t))
-// 	}
-// 	sort.Ints(rrTypeList)
-
-// 	if len(typeList) != len(rrTypeList) {
-// 		return false
-// 	}
-// 	for i := 0; i < len(typeList); i++ {
-// 		if typeList[i] != rrTypeList[i] {
-// 			return false
-// 		}
-// 	}
-
-// 	return rdata.HashAlgorithm == rrnsec3.HashAlgorithm &&
-// 		rdata.Flags == rrnsec3.Flags &&
-// 		rdata.Iterations == rrnsec3.Iterations &&
-// 		rdata.Salt == rrnsec3.Salt &&
-// 		rdata.NextHashedOwnerName == rrnsec3.NextHashedOwnerName
-// }
-
-// func (rdata *DNSRDATANSEC3) HashOwnerName(ownerName string) []byte {
-// 	nextHashOwnerName := EncodeDomainName(&ownerName)
-// 	switch rdata.HashAlgorithm {
-// 	case DNSSECDigestTypeSHA1:
-// 		for i := 0; i <= int(rdata.Iterations); i++ {
-// 			digest := sha1.Sum(append(nextHashOwnerName, []byte(rdata.Salt)...))
-// 			nextHashOwnerName = digest[:]
-// 		}
-// 		return nextHashOwnerName
-// 	case DNSSECDigestTypeSHA256:
-// 		for i := 0; i <= int(rdata.Iterations); i++ {
-// 			digest := sha256.Sum256(append(nextHashOwnerName, []byte(rdata.Salt)...))
-// 			nextHashOwnerName = digest[:]
-// 		}
-// 	case DNSSECDigestTypeSHA384:
-// 		for i := 0; i <= int(rdata.Iterations); i++ {
-// 			digest := sha512.Sum384(append(nextHashOwnerName, []byte(rdata.Salt)...))
-// 			nextHashOwnerName = digest[:]
-// 		}
-// 	case DNSSECDigestTypeSHA512:
-// 		for i := 0; i <= int(rdata.Iterations); i++ {
-// 			digest := sha512.Sum512(append(nextHashOwnerName, []byte(rdata.Salt)...))
-// 			nextHashOwnerName = digest[:]
-// 		}
-// 	}
-// 	return nextHashOwnerName
-// }
-
-// func (rdata *DNSRDATANSEC3) Encode() []byte {
-// 	bytesArray := make([]byte, 0)
-// 	bytesArray = append(bytesArray, uint8(rdata.HashAlgorithm))
-// 	bytesArray = append(bytesArray, uint8(rdata.Flags))
-// 	bytesArray = append(bytesArray, byte(rdata.Iterations>>8), byte(rdata.Iterations))
-// 	if rdata.SaltLength == 0 {
-// 		bytesArray = append(bytesArray, uint8(len([]byte(rdata.Salt))))
-// 	} else {
-// 		bytesArray = append(bytesArray, rdata.SaltLength)
-// 	}
-// 	bytesArray = append(bytesArray, []byte(rdata.Salt)...)
-// 	nextHashOwnerName := rdata.HashOwnerName(rdata.NextHashedOwnerName)
-// 	if rdata.HashLength == 0 {
-// 		bytesArray = append(bytesArray, uint8(len(nextHashOwnerName)))
-// 	} else {
-// 		bytesArray = append(bytesArray, rdata.HashLength)
-// 	}
-// 	bytesArray = append(bytesArray, nextHashOwnerName...)
-// 	typeBitMaps := EncodeTypeBitMaps(rdata.TypeBitMaps)
-// 	bytesArray = append(bytesArray, typeBitMaps...)
-// 	return bytesArray
-// }
-
-// func (rdata *DNSRDATANSEC3) EncodeToBuffer(buffer []byte) (int, error) {
-// 	saltBytes := []byte(rdata.Salt)
-// 	nextHashOwnerName := rdata.HashOwnerName(rdata.NextHashedOwnerName)
-// 	typeBitMaps := EncodeTypeBitMaps(rdata.TypeBitMaps)
-// 	size := 6 + len(saltBytes) + len(nextHashOwnerName) + len(typeBitMaps)
-// 	if len(buffer) < size {
-// 		return -1, fmt.Errorf("buffer length %d is less than NSEC3 RDATA size %d", len(buffer), size)
-// 	}
-// 	buffer[0] = byte(rdata.HashAlgorithm)
-// 	buffer[1] = uint8(rdata.Flags)
-// 	binary.BigEndian.PutUint16(buffer[2:], rdata.Iterations)
-// 	if rdata.SaltLength == 0 {
-// 		buffer[4] = byte(len(saltBytes))
-// 	} else {
-// 		buffer[4] = rdata.SaltLength
-// 	}
-// 	copy(buffer[5:], saltBytes)
-// 	if rdata.HashLength == 0 {
-// 		buffer[5+len(saltBytes)] = byte(len(nextHashOwnerName))
-// 	} else {
-// 		buffer[5+len(saltBytes)] = rdata.HashLength
-// 	}
-// 	buffer[6+len(saltBytes)] = byte(len(nextHashOwnerName))
-// 	copy(buffer[7+len(saltBytes):], nextHashOwnerName)
-// 	copy(buffer[7+len(saltBytes)+len(nextHashOwnerName):], typeBitMaps)
-// 	return size, nil
-// }
-
-// func (rdata *DNSRDATANSEC3) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
-// 	var err error
-// 	var rdEnd = offset + rdLen
-// 	if rdLen < 6 {
-// 		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: NSEC3 RDATA size %d is less than 6", rdLen)
-// 	}
-// 	if len(buffer) < rdEnd {
-// 		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: buffer length %d is less than offset %d + NSEC3 RDATA size %d", len(buffer), offset, rdata.Size())
-// 	}
-// 	rdata.HashAlgorithm = DNSSECDigestType(buffer[offset])
-// 	rdata.Flags = NSEC3Flags(buffer[offset+1])
-// 	rdata.Iterations = binary.BigEndian.Uint16(buffer[offset+2:])
-// 	rdata.SaltLength = buffer[offset+4]
-// 	rdata.Salt = string(buffer[offset+5 : offset+5+int(rdata.SaltLength)])
-// 	if err != nil {
-// 		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: decode NSEC3 Salt failed.\n%v", err)
-// 	}
-// 	offset += 5 + int(rdata.SaltLength)
-// 	rdata.HashLength = buffer[offset]
-// 	rdata.NextHashedOwnerName = base32.StdEncoding.EncodeToString(buffer[offset+1 : offset+1+int(rdata.HashLength)])
-// 	if err != nil {
-// 		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: decode NSEC3 Next Hashed Owner Name failed.\n%v", err)
-// 	}
-// 	rdata.TypeBitMaps = DecodeTypeBitMaps(buffer[offset+1+int(rdata.HashLength) : rdEnd])
-// 	return rdEnd, nil
-// }
+// NSEC3 RDATA 编码格式
+// 1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+// 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |   Hash Alg.   |     Flags     |          Iterations           |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |  Salt Length  |                     Salt                      /
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |  Hash Length  |             Next Hashed Owner Name            /
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// /                         Type Bit Maps                         /
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+// DNSRDATANSEC3 结构体表示 NSEC3 类型的 DNS 资源记录的 RDATA 部分。
+// 其包含以下字段：
+//   - HashAlgorithm: 8位无符号整数，表示哈希算法，目前仅定义了 SHA-1（1）。
+//   - Flags: 8位无符号整数，表示标志。
+//   - Iterations: 16位无符号整数，表示额外迭代次数。
+//   - SaltLength: 8位无符号整数，表示Salt长度，为0时根据Salt的实际长度进行编码。
+//   - Salt: Salt 的原始字节。
+//   - HashLength: 8位无符号整数，表示哈希长度，为0时根据哈希的实际长度进行编码。
+//   - NextHashedOwnerName: 下一个哈希后所有者名称的原始字节（未经 Base32 编码）。
+//   - TypeBitMaps: 类型位图。
+//
+// RFC 5155 3.2 节 定义了 NSEC3 类型的 DNS 资源记录的 RDATA 部分的编码格式。
+// 其 Type 值为 50。
+type DNSRDATANSEC3 struct {
+	HashAlgorithm       DNSSECDigestType
+	Flags               NSEC3Flags
+	Iterations          uint16
+	SaltLength          uint8
+	Salt                []byte
+	HashLength          uint8
+	NextHashedOwnerName []byte
+	TypeBitMaps         []DNSType
+}
+
+// NSEC3Flags 表示 NSEC3 记录的标志
+type NSEC3Flags uint8
+
+const (
+	NSEC3FlagReserved NSEC3Flags = 0
+	NSEC3FlagOptOut   NSEC3Flags = 1
+)
+
+func (rdata *DNSRDATANSEC3) Type() DNSType {
+	return DNSRRTypeNSEC3
+}
+
+func (rdata *DNSRDATANSEC3) Size() int {
+	return 6 + len(rdata.Salt) + len(rdata.NextHashedOwnerName) + len(EncodeTypeBitMaps(rdata.TypeBitMaps))
+}
+
+func (rdata *DNSRDATANSEC3) String() string {
+	salt := "-"
+	if len(rdata.Salt) > 0 {
+		salt = fmt.Sprintf("%X", rdata.Salt)
+	}
+	return fmt.Sprint(
+		"### RDATA Section ###\n",
+		"Hash Algorithm: ", rdata.HashAlgorithm,
+		"\nFlags: ", rdata.Flags,
+		"\nIterations: ", rdata.Iterations,
+		"\nSalt Length: ", rdata.SaltLength,
+		"\nSalt: ", salt,
+		"\nHash Length: ", rdata.HashLength,
+		"\nNext Hashed Owner Name: ", EncodeNSEC3Hash(rdata.NextHashedOwnerName),
+		"\nType Bit Maps: ", rdata.TypeBitMaps,
+	)
+}
+
+func (rdata *DNSRDATANSEC3) Equal(rr DNSRRRDATA) bool {
+	rrnsec3, ok := rr.(*DNSRDATANSEC3)
+	if !ok {
+		return false
+	}
+	return rdata.HashAlgorithm == rrnsec3.HashAlgorithm &&
+		rdata.Flags == rrnsec3.Flags &&
+		rdata.Iterations == rrnsec3.Iterations &&
+		rdata.SaltLength == rrnsec3.SaltLength &&
+		bytes.Equal(rdata.Salt, rrnsec3.Salt) &&
+		rdata.HashLength == rrnsec3.HashLength &&
+		bytes.Equal(rdata.NextHashedOwnerName, rrnsec3.NextHashedOwnerName) &&
+		bytes.Equal(EncodeTypeBitMaps(rdata.TypeBitMaps), EncodeTypeBitMaps(rrnsec3.TypeBitMaps))
+}
+
+func (rdata *DNSRDATANSEC3) Encode() []byte {
+	bytesArray := make([]byte, rdata.Size())
+	rdata.EncodeToBuffer(bytesArray)
+	return bytesArray
+}
+
+func (rdata *DNSRDATANSEC3) EncodeToBuffer(buffer []byte) (int, error) {
+	size := rdata.Size()
+	if len(buffer) < size {
+		return -1, fmt.Errorf("method DNSRDATANSEC3 EncodeToBuffer failed: buffer length %d is less than NSEC3 RDATA size %d", len(buffer), size)
+	}
+	buffer[0] = byte(rdata.HashAlgorithm)
+	buffer[1] = byte(rdata.Flags)
+	binary.BigEndian.PutUint16(buffer[2:], rdata.Iterations)
+	if rdata.SaltLength == 0 {
+		buffer[4] = byte(len(rdata.Salt))
+	} else {
+		buffer[4] = rdata.SaltLength
+	}
+	offset := 5 + copy(buffer[5:], rdata.Salt)
+	if rdata.HashLength == 0 {
+		buffer[offset] = byte(len(rdata.NextHashedOwnerName))
+	} else {
+		buffer[offset] = rdata.HashLength
+	}
+	offset += 1 + copy(buffer[offset+1:], rdata.NextHashedOwnerName)
+	copy(buffer[offset:], EncodeTypeBitMaps(rdata.TypeBitMaps))
+	return size, nil
+}
+
+func (rdata *DNSRDATANSEC3) DecodeFromBuffer(buffer []byte, offset int, rdLen int) (int, error) {
+	rdEnd := offset + rdLen
+	if rdLen < 6 {
+		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: NSEC3 RDATA size %d is less than 6", rdLen)
+	}
+	if len(buffer) < rdEnd {
+		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: buffer length %d is less than offset %d + NSEC3 RDATA size %d", len(buffer), offset, rdLen)
+	}
+	rdata.HashAlgorithm = DNSSECDigestType(buffer[offset])
+	rdata.Flags = NSEC3Flags(buffer[offset+1])
+	rdata.Iterations = binary.BigEndian.Uint16(buffer[offset+2:])
+	rdata.SaltLength = buffer[offset+4]
+	offset += 5
+	if rdEnd < offset+int(rdata.SaltLength)+1 {
+		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: Salt length %d exceeds NSEC3 RDATA size %d", rdata.SaltLength, rdLen)
+	}
+	rdata.Salt = append([]byte{}, buffer[offset:offset+int(rdata.SaltLength)]...)
+	offset += int(rdata.SaltLength)
+	rdata.HashLength = buffer[offset]
+	offset++
+	if rdEnd < offset+int(rdata.HashLength) {
+		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: Hash length %d exceeds NSEC3 RDATA size %d", rdata.HashLength, rdLen)
+	}
+	rdata.NextHashedOwnerName = append([]byte{}, buffer[offset:offset+int(rdata.HashLength)]...)
+	offset += int(rdata.HashLength)
+	types, err := DecodeTypeBitMaps(buffer[offset:rdEnd])
+	if err != nil {
+		return -1, fmt.Errorf("method DNSRDATANSEC3 DecodeFromBuffer failed: decode NSEC3 Type Bit Maps failed.\n%v", err)
+	}
+	rdata.TypeBitMaps = types
+	return rdEnd, nil
+}
 
 // DNSKEY RDATA 编码格式
 // 1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
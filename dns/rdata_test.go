@@ -6,13 +6,13 @@ package dns
 
 import (
 	"bytes"
-	"net"
+	"strings"
 	"testing"
 )
 
 // 待测试的 A 记录 RDATA 对象。
 var testedDNSRDATAA = DNSRDATAA{
-	Address: net.ParseIP("10.10.0.3"),
+	Address: IPv4(10, 10, 0, 3),
 }
 
 // 待测试的 A 记录 RDATA 编码后结果。
@@ -85,6 +85,50 @@ func TestDNSRDATAADecodeFromBuffer(t *testing.T) {
 	}
 }
 
+// 待测试的 AAAA 记录 RDATA 对象。
+var testedDNSRDATAAAAA = DNSRDATAAAAA{
+	Address: IP{0x20, 0x01, 0x0d, 0xb8, 15: 0x03},
+}
+
+// 待测试的 AAAA 记录 RDATA 编码后结果。
+var testedDNSRDATAAAAAEncoded = []byte{
+	0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03,
+}
+
+// 测试 AAAA 记录 RDATA 的 Encode 方法。
+func TestDNSRDATAAAAAEncode(t *testing.T) {
+	encodedDNSRDATAAAAA := testedDNSRDATAAAAA.Encode()
+	if !bytes.Equal(encodedDNSRDATAAAAA, testedDNSRDATAAAAAEncoded) {
+		t.Errorf("function Encode() failed:\ngot:\n%v\nexpected:\n%v",
+			encodedDNSRDATAAAAA, testedDNSRDATAAAAAEncoded)
+	}
+}
+
+// 测试 AAAA 记录 RDATA 的 DecodeFromBuffer 方法。
+func TestDNSRDATAAAAADecodeFromBuffer(t *testing.T) {
+	// 正常情况
+	decodedDNSRDATAAAAA := DNSRDATAAAAA{}
+	offset, err := decodedDNSRDATAAAAA.DecodeFromBuffer(testedDNSRDATAAAAAEncoded, 0, 16)
+	if err != nil {
+		t.Errorf("function DecodeFromBuffer() failed:\n%s", err)
+	}
+	if offset != 16 {
+		t.Errorf("function DecodeFromBuffer() failed:\ngot:%d\nexpected: %d", offset, 16)
+	}
+	if !decodedDNSRDATAAAAA.Equal(&testedDNSRDATAAAAA) {
+		t.Errorf("function DecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
+			decodedDNSRDATAAAAA.Address, testedDNSRDATAAAAA.Address)
+	}
+
+	// 缓冲区长度不足
+	decodedDNSRDATAAAAA = DNSRDATAAAAA{}
+	_, err = decodedDNSRDATAAAAA.DecodeFromBuffer(testedDNSRDATAAAAAEncoded, 1, 16)
+	if err == nil {
+		t.Errorf("function DecodeFromBuffer() failed:\n%s", "expected an error but got nil")
+	}
+}
+
 // 待测试的 NS RDATA 对象。
 var testedDNSRDATANS = DNSRDATANS{
 	NSDNAME: "ns.example.com",
@@ -242,9 +286,156 @@ func TestDNSRDATACNAMEDecodeFromBuffer(t *testing.T) {
 	}
 }
 
+// 待测试PTR记录RDATA对象。
+var testedDNSRDATAPTR = DNSRDATAPTR{
+	PTR: "3.0.10.10.in-addr.arpa",
+}
+
+// 待测试PTR记录RDATA编码后结果。
+var testedDNSRDATAPTREncoded = []byte{
+	0x01, '3', 0x01, '0', 0x02, '1', '0', 0x02, '1', '0',
+	0x07, 'i', 'n', '-', 'a', 'd', 'd', 'r',
+	0x04, 'a', 'r', 'p', 'a',
+	0x00,
+}
+
+// 测试 PTR RDATA 的 Size 方法
+func TestDNSRDATAPTRSize(t *testing.T) {
+	size := testedDNSRDATAPTR.Size()
+	expectedSize := len(testedDNSRDATAPTREncoded)
+	if size != expectedSize {
+		t.Errorf("function DNSRDATAPTRSize() failed:\ngot:%d\nexpected: %d",
+			size, expectedSize)
+	}
+}
+
+// 测试 PTR RDATA 的 String 方法
+func TestDNSRDATAPTRString(t *testing.T) {
+	t.Logf("PTR RDATA String():\n%s", testedDNSRDATAPTR.String())
+}
+
+// 测试 PTR RDATA 的 EncodeToBuffer 方法
+func TestDNSRDATAPTREncodeToBuffer(t *testing.T) {
+	// 正常情况
+	buffer := make([]byte, len(testedDNSRDATAPTREncoded))
+	_, err := testedDNSRDATAPTR.EncodeToBuffer(buffer)
+	if err != nil {
+		t.Errorf("function DNSRDATAPTREncodeToBuffer() failed:\n%s", err)
+	}
+	if !bytes.Equal(buffer, testedDNSRDATAPTREncoded) {
+		t.Errorf("function DNSRDATAPTREncodeToBuffer() failed:\ngot:\n%v\nexpected:\n%v",
+			buffer, testedDNSRDATAPTREncoded)
+	}
+
+	// 缓冲区长度不足
+	buffer = make([]byte, 1)
+	_, err = testedDNSRDATAPTR.EncodeToBuffer(buffer)
+	if err == nil {
+		t.Error("function DNSRDATAPTREncodeToBuffer() failed: expected an error but got nil")
+	}
+}
+
+// 测试 PTR RDATA 的 DecodeFromBuffer 方法
+func TestDNSRDATAPTRDecodeFromBuffer(t *testing.T) {
+	// 正常情况
+	decodedDNSRDATAPTR := DNSRDATAPTR{}
+	offset, err := decodedDNSRDATAPTR.DecodeFromBuffer(testedDNSRDATAPTREncoded, 0, 0)
+	if err != nil {
+		t.Errorf("function DNSRDATAPTRDecodeFromBuffer() failed:\n%s", err)
+	}
+	if offset != len(testedDNSRDATAPTREncoded) {
+		t.Errorf("function DNSRDATAPTRDecodeFromBuffer() failed:\ngot:%d\nexpected: %d",
+			offset, len(testedDNSRDATAPTREncoded))
+	}
+	if decodedDNSRDATAPTR != testedDNSRDATAPTR {
+		t.Errorf("function DNSRDATAPTRDecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
+			decodedDNSRDATAPTR, testedDNSRDATAPTR)
+	}
+
+	// 缓冲区长度不足
+	decodedDNSRDATAPTR = DNSRDATAPTR{}
+	_, err = decodedDNSRDATAPTR.DecodeFromBuffer(testedDNSRDATAPTREncoded, 1, 0)
+	if err == nil {
+		t.Error("function DNSRDATAPTRDecodeFromBuffer() failed: expected an error but got nil")
+	}
+}
+
+// 待测试DNAME记录RDATA对象。
+var testedDNSRDATADNAME = DNSRDATADNAME{
+	DNAME: "example.org",
+}
+
+// 待测试DNAME记录RDATA编码后结果。
+var testedDNSRDATADNAMEEncoded = []byte{
+	0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+	0x03, 'o', 'r', 'g',
+	0x00,
+}
+
+// 测试 DNAME RDATA 的 Size 方法
+func TestDNSRDATADNAMESize(t *testing.T) {
+	size := testedDNSRDATADNAME.Size()
+	expectedSize := len(testedDNSRDATADNAMEEncoded)
+	if size != expectedSize {
+		t.Errorf("function DNSRDATADNAMESize() failed:\ngot:%d\nexpected: %d",
+			size, expectedSize)
+	}
+}
+
+// 测试 DNAME RDATA 的 String 方法
+func TestDNSRDATADNAMEString(t *testing.T) {
+	t.Logf("DNAME RDATA String():\n%s", testedDNSRDATADNAME.String())
+}
+
+// 测试 DNAME RDATA 的 EncodeToBuffer 方法
+func TestDNSRDATADNAMEEncodeToBuffer(t *testing.T) {
+	// 正常情况
+	buffer := make([]byte, len(testedDNSRDATADNAMEEncoded))
+	_, err := testedDNSRDATADNAME.EncodeToBuffer(buffer)
+	if err != nil {
+		t.Errorf("function DNSRDATADNAMEEncodeToBuffer() failed:\n%s", err)
+	}
+	if !bytes.Equal(buffer, testedDNSRDATADNAMEEncoded) {
+		t.Errorf("function DNSRDATADNAMEEncodeToBuffer() failed:\ngot:\n%v\nexpected:\n%v",
+			buffer, testedDNSRDATADNAMEEncoded)
+	}
+
+	// 缓冲区长度不足
+	buffer = make([]byte, 1)
+	_, err = testedDNSRDATADNAME.EncodeToBuffer(buffer)
+	if err == nil {
+		t.Error("function DNSRDATADNAMEEncodeToBuffer() failed: expected an error but got nil")
+	}
+}
+
+// 测试 DNAME RDATA 的 DecodeFromBuffer 方法
+func TestDNSRDATADNAMEDecodeFromBuffer(t *testing.T) {
+	// 正常情况
+	decodedDNSRDATADNAME := DNSRDATADNAME{}
+	offset, err := decodedDNSRDATADNAME.DecodeFromBuffer(testedDNSRDATADNAMEEncoded, 0, 0)
+	if err != nil {
+		t.Errorf("function DNSRDATADNAMEDecodeFromBuffer() failed:\n%s", err)
+	}
+	if offset != len(testedDNSRDATADNAMEEncoded) {
+		t.Errorf("function DNSRDATADNAMEDecodeFromBuffer() failed:\ngot:%d\nexpected: %d",
+			offset, len(testedDNSRDATADNAMEEncoded))
+	}
+	if decodedDNSRDATADNAME != testedDNSRDATADNAME {
+		t.Errorf("function DNSRDATADNAMEDecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
+			decodedDNSRDATADNAME, testedDNSRDATADNAME)
+	}
+
+	// 缓冲区长度不足
+	decodedDNSRDATADNAME = DNSRDATADNAME{}
+	_, err = decodedDNSRDATADNAME.DecodeFromBuffer(testedDNSRDATADNAMEEncoded, 1, 0)
+	if err == nil {
+		t.Error("function DNSRDATADNAMEDecodeFromBuffer() failed: expected an error but got nil")
+	}
+}
+
 // 待测试TXT记录RDATA对象。
 var testedDNSRDATATXT = DNSRDATATXT{
-	TXT: "TXT",
+	TXT: []string{"TXT"},
 }
 var testedDNSRDATATXTEncoded = []byte{
 	0x03, 'T', 'X', 'T',
@@ -295,6 +486,59 @@ func TestDNSRDATATXTEncodeToBuffer(t *testing.T) {
 	}
 }
 
+// 测试 TXT RDATA 的 DecodeFromBuffer 方法
+func TestDNSRDATATXTDecodeFromBuffer(t *testing.T) {
+	// 多个字符串，边界应被保留
+	encoded := []byte{0x03, 'a', 'b', 'c', 0x00, 0x02, 'd', 'e'}
+	decoded := DNSRDATATXT{}
+	offset, err := decoded.DecodeFromBuffer(encoded, 0, len(encoded))
+	if err != nil {
+		t.Fatalf("function DNSRDATATXTDecodeFromBuffer() failed:\n%s", err)
+	}
+	expected := DNSRDATATXT{TXT: []string{"abc", "", "de"}}
+	if offset != len(encoded) || !decoded.Equal(&expected) {
+		t.Errorf("function DNSRDATATXTDecodeFromBuffer() failed:\ngot:%d\n%s\nexpected:%d\n%s",
+			offset, decoded.String(), len(encoded), expected.String())
+	}
+	if !bytes.Equal(expected.Encode(), encoded) {
+		t.Errorf("function DNSRDATATXTEncode() failed:\ngot:\n%v\nexpected:\n%v", expected.Encode(), encoded)
+	}
+
+	// 字符串长度超出 RDATA
+	decoded = DNSRDATATXT{}
+	_, err = decoded.DecodeFromBuffer(encoded, 0, 3)
+	if err == nil {
+		t.Error("function DNSRDATATXTDecodeFromBuffer() failed: expected an error but got nil")
+	}
+}
+
+// 测试 NewDNSRDATATXT 对超过 255 字节的字符串的拆分
+func TestNewDNSRDATATXT(t *testing.T) {
+	long := strings.Repeat("x", 600)
+	rdata := NewDNSRDATATXT(long)
+	if len(rdata.TXT) != 3 || len(rdata.TXT[0]) != 255 || len(rdata.TXT[2]) != 90 {
+		t.Errorf("function NewDNSRDATATXT() failed: got %d segments", len(rdata.TXT))
+	}
+	if rdata.Text() != long {
+		t.Error("function Text() failed: joined text does not match")
+	}
+	if rdata.Size() != 603 || len(rdata.Encode()) != 603 {
+		t.Errorf("function Size() failed:\ngot:%d\nexpected: 603", rdata.Size())
+	}
+
+	// 单个字符串超过 255 字节时，编码时会被拆分
+	single := DNSRDATATXT{TXT: []string{long}}
+	if !bytes.Equal(single.Encode(), rdata.Encode()) {
+		t.Error("function DNSRDATATXTEncode() failed: long string is not split like NewDNSRDATATXT")
+	}
+
+	// 空的 TXT RDATA 编码为一个空字符串
+	empty := DNSRDATATXT{}
+	if !bytes.Equal(empty.Encode(), []byte{0x00}) {
+		t.Errorf("function DNSRDATATXTEncode() failed:\ngot:\n%v\nexpected:\n[0]", empty.Encode())
+	}
+}
+
 // 测试 RRSIG RDATA
 
 // 待测试的 RRSIG 记录 RDATA 对象。
@@ -381,7 +625,7 @@ func TestDNSRDATARRSIGDecodeFromBuffer(t *testing.T) {
 		t.Errorf("function DNSRDATARRSIGDecodeFromBuffer() failed:\ngot:%d\nexpected: %d",
 			offset, len(testedDNSRDATARRSIGEncoded))
 	}
-	if decodedDNSRDATARRSIG.Equal(&testedDNSRDATARRSIG) {
+	if !decodedDNSRDATARRSIG.Equal(&testedDNSRDATARRSIG) {
 		t.Errorf("function DNSRDATARRSIGDecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
 			decodedDNSRDATARRSIG.String(), testedDNSRDATARRSIG.String())
 	}
@@ -469,7 +713,7 @@ func TestDNSRDATADNSKEYDecodeFromBuffer(t *testing.T) {
 		t.Errorf("function DNSRDATADNSKEYDecodeFromBuffer() failed:\ngot:%d\nexpected: %d",
 			offset, len(testedDNSRDATADNSKEYEncoded))
 	}
-	if decodedDNSRDATADNSKEY.Equal(&testedDNSRDATADNSKEY) {
+	if !decodedDNSRDATADNSKEY.Equal(&testedDNSRDATADNSKEY) {
 		t.Errorf("function DNSRDATADNSKEYDecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
 			decodedDNSRDATADNSKEY.String(), testedDNSRDATADNSKEY.String())
 	}
@@ -567,38 +811,109 @@ func TestDNSRDATANSECDecodeFromBuffer(t *testing.T) {
 	}
 }
 
-// // 测试 NSEC3 RDATA
-// var testedDNSRDATANSEC3 = DNSRDATANSEC3{
-// 	HashAlgorithm:       DNSSECDigestTypeSHA1,
-// 	Flags:               NSEC3FlagOptOut,
-// 	Iterations:          12,
-// 	SaltLength:          0,
-// 	Salt:                "aabbccdd",
-// 	NextHashedOwnerName: "example",
-// 	TypeBitMaps:         []DNSType{DNSRRTypeA, DNSRRTypeRRSIG},
-// }
-
-// 1 1
-// 0 12
-// 8
-// 97 97 98 98 99 99 100 100
-// 20
-// 99 82 96 22 213
-// 115 203 233 166 230
-// 231 187 154 234 235
-// 204 161 95 168 4
-// 0 1 64
-// func TestDNSRDATANSEC3(t *testing.T) {
-// 	encodedDNSRDATANSEC3 := testedDNSRDATANSEC3.Encode()
-// 	t.Errorf("%v, %d", encodedDNSRDATANSEC3, len(encodedDNSRDATANSEC3))
-// 	decodedDNSRDATANSEC3 := DNSRDATANSEC3{}
-// 	_, err := decodedDNSRDATANSEC3.DecodeFromBuffer(encodedDNSRDATANSEC3, 0, len(encodedDNSRDATANSEC3))
-// 	if err != nil {
-// 		t.Errorf("function DNSRDATANSEC3DecodeFromBuffer() failed:\n%s", err)
-// 	}
-// 	t.Errorf("%s", decodedDNSRDATANSEC3.String())
-
-// }
+// 测试畸形的类型位图：窗口头部或位图超出 RDATA 时应返回错误而非 panic
+func TestDecodeTypeBitMapsMalformed(t *testing.T) {
+	malformed := [][]byte{
+		{0x00},
+		{0x00, 0x02, 0x40},
+		{0x00, 0x01, 0x40, 0x01},
+		{0x00, 0x01, 0x40, 0x01, 0x03, 0x01},
+	}
+	for _, bitMaps := range malformed {
+		if _, err := DecodeTypeBitMaps(bitMaps); err == nil {
+			t.Errorf("function DecodeTypeBitMaps(%x) failed: expected an error but got nil", bitMaps)
+		}
+	}
+	types, err := DecodeTypeBitMaps([]byte{})
+	if err != nil || len(types) != 0 {
+		t.Errorf("function DecodeTypeBitMaps() failed:\ngot:%v, %v\nexpected: no types", types, err)
+	}
+
+	// NSEC RDATA 为 00 00：根域名之后仅剩一个字节的位图
+	nsec := DNSRDATANSEC{}
+	if _, err := nsec.DecodeFromBuffer([]byte{0x00, 0x00}, 0, 2); err == nil {
+		t.Error("function DNSRDATANSECDecodeFromBuffer() failed: expected an error but got nil")
+	}
+	// NSEC3 的哈希之后为截断的位图
+	nsec3 := DNSRDATANSEC3{}
+	data := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0xaa, 0x00, 0x03}
+	if _, err := nsec3.DecodeFromBuffer(data, 0, len(data)); err == nil {
+		t.Error("function DNSRDATANSEC3DecodeFromBuffer() failed: expected an error but got nil")
+	}
+
+	// 包含畸形 NSEC 记录的消息
+	packet := []byte{
+		0x00, 0x01, 0x81, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x2f, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00,
+	}
+	msg := DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(packet, 0); err == nil {
+		t.Error("function DNSMessageDecodeFromBuffer() failed: expected an error but got nil")
+	}
+}
+
+// 测试 NSEC3 RDATA
+// 待测试的 NSEC3 记录 RDATA 对象。
+var testedDNSRDATANSEC3 = DNSRDATANSEC3{
+	HashAlgorithm:       DNSSECDigestTypeSHA1,
+	Flags:               NSEC3FlagOptOut,
+	Iterations:          12,
+	SaltLength:          4,
+	Salt:                []byte{0xaa, 0xbb, 0xcc, 0xdd},
+	HashLength:          4,
+	NextHashedOwnerName: []byte{0x01, 0x02, 0x03, 0x04},
+	TypeBitMaps:         []DNSType{DNSRRTypeA, DNSRRTypeRRSIG},
+}
+
+// 待测试的 NSEC3 记录 RDATA 编码后结果。
+var testedDNSRDATANSEC3Encoded = []byte{
+	0x01, 0x01, 0x00, 0x0c,
+	0x04, 0xaa, 0xbb, 0xcc, 0xdd,
+	0x04, 0x01, 0x02, 0x03, 0x04,
+	0x00, 0x06, 0x40, 0x00, 0x00, 0x00, 0x00, 0x02,
+}
+
+// 测试 NSEC3 RDATA 的 Encode 方法
+func TestDNSRDATANSEC3Encode(t *testing.T) {
+	encodedDNSRDATANSEC3 := testedDNSRDATANSEC3.Encode()
+	if !bytes.Equal(encodedDNSRDATANSEC3, testedDNSRDATANSEC3Encoded) {
+		t.Errorf("function DNSRDATANSEC3Encode() failed:\ngot:\n%v\nexpected:\n%v",
+			encodedDNSRDATANSEC3, testedDNSRDATANSEC3Encoded)
+	}
+
+	// 缓冲区长度不足
+	buffer := make([]byte, 1)
+	_, err := testedDNSRDATANSEC3.EncodeToBuffer(buffer)
+	if err == nil {
+		t.Error("function DNSRDATANSEC3EncodeToBuffer() failed: expected an error but got nil")
+	}
+}
+
+// 测试 NSEC3 RDATA 的 DecodeFromBuffer 方法
+func TestDNSRDATANSEC3DecodeFromBuffer(t *testing.T) {
+	// 正常情况
+	decodedDNSRDATANSEC3 := DNSRDATANSEC3{}
+	offset, err := decodedDNSRDATANSEC3.DecodeFromBuffer(testedDNSRDATANSEC3Encoded, 0, len(testedDNSRDATANSEC3Encoded))
+	if err != nil {
+		t.Errorf("function DNSRDATANSEC3DecodeFromBuffer() failed:\n%s", err)
+	}
+	if offset != len(testedDNSRDATANSEC3Encoded) {
+		t.Errorf("function DNSRDATANSEC3DecodeFromBuffer() failed:\ngot:%d\nexpected: %d",
+			offset, len(testedDNSRDATANSEC3Encoded))
+	}
+	if !decodedDNSRDATANSEC3.Equal(&testedDNSRDATANSEC3) {
+		t.Errorf("function DNSRDATANSEC3DecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
+			decodedDNSRDATANSEC3.String(), testedDNSRDATANSEC3.String())
+	}
+
+	// 盐长度越界
+	decodedDNSRDATANSEC3 = DNSRDATANSEC3{}
+	_, err = decodedDNSRDATANSEC3.DecodeFromBuffer(testedDNSRDATANSEC3Encoded, 0, 7)
+	if err == nil {
+		t.Error("function DNSRDATANSEC3DecodeFromBuffer() failed: expected an error but got nil")
+	}
+}
 
 // 测试 DS RDATA
 
@@ -675,7 +990,7 @@ func TestDNSRDATADSDecodeFromBuffer(t *testing.T) {
 		t.Errorf("function DNSRDATADSDecodeFromBuffer() failed:\ngot:%d\nexpected: %d",
 			offset, len(testedDNSRDATADSEncoded))
 	}
-	if decodedDNSRDATADS.Equal(&testedDNSRDATADS) {
+	if !decodedDNSRDATADS.Equal(&testedDNSRDATADS) {
 		t.Errorf("function DNSRDATADSDecodeFromBuffer() failed:\ngot:\n%v\nexpected:\n%v",
 			decodedDNSRDATADS.String(), testedDNSRDATADS.String())
 	}
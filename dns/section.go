@@ -0,0 +1,111 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// section.go 文件定义了 DNS 响应部分的筛选方法，
+// 供回复器及中间件组合使用，以代替对记录切片的手工增删。
+// 这些方法均不修改原有的响应部分，而是返回一个新的响应部分。
+
+package dns
+
+import (
+	"bytes"
+	"strings"
+)
+
+// coversType 检查记录的类型是否位于 types 中，
+// 对于 RRSIG 记录，其所覆盖的类型位于 types 中时亦视为位于其中。
+func coversType(rr DNSResourceRecord, types []DNSType) bool {
+	for _, t := range types {
+		if rr.Type == t {
+			return true
+		}
+		if sig, ok := rr.RData.(*DNSRDATARRSIG); ok && sig.TypeCovered == t {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterByType 返回仅包含指定类型 RRset 的响应部分，
+// 覆盖这些类型的 RRSIG 记录也被保留，以使保留的 RRset 仍可被验证。
+//   - 其接受参数为：要保留的记录类型
+//   - 返回值为：筛选后的响应部分，记录保持原有顺序
+func (responseSection DNSResponseSection) FilterByType(types ...DNSType) DNSResponseSection {
+	filtered := DNSResponseSection{}
+	for _, rr := range responseSection {
+		if coversType(rr, types) {
+			filtered = append(filtered, rr)
+		}
+	}
+	return filtered
+}
+
+// RemoveByType 返回删除了指定类型 RRset 的响应部分，
+// 覆盖这些类型的 RRSIG 记录也被一并删除。
+//   - 其接受参数为：要删除的记录类型
+//   - 返回值为：删除后的响应部分，记录保持原有顺序
+func (responseSection DNSResponseSection) RemoveByType(types ...DNSType) DNSResponseSection {
+	filtered := DNSResponseSection{}
+	for _, rr := range responseSection {
+		if !coversType(rr, types) {
+			filtered = append(filtered, rr)
+		}
+	}
+	return filtered
+}
+
+// RemoveRRSIGs 返回删除了全部 RRSIG 记录的响应部分。
+func (responseSection DNSResponseSection) RemoveRRSIGs() DNSResponseSection {
+	filtered := DNSResponseSection{}
+	for _, rr := range responseSection {
+		if rr.Type != DNSRRTypeRRSIG {
+			filtered = append(filtered, rr)
+		}
+	}
+	return filtered
+}
+
+// DeduplicateRRs 返回删除了重复记录的响应部分，每组重复记录只保留第一条。
+// 名称（不区分大小写）、类型、类别及 RDATA 均相同的记录视为重复，不比较 TTL（RFC 2181 第 5 节）。
+func (responseSection DNSResponseSection) DeduplicateRRs() DNSResponseSection {
+	type rrKey struct {
+		name  string
+		typ   DNSType
+		class DNSClass
+	}
+	seen := map[rrKey][][]byte{}
+	filtered := DNSResponseSection{}
+	for _, rr := range responseSection {
+		key := rrKey{strings.ToLower(rr.Name.DomainName), rr.Type, rr.Class}
+		rdata := rr.RData.Encode()
+		duplicated := false
+		for _, other := range seen[key] {
+			if bytes.Equal(rdata, other) {
+				duplicated = true
+				break
+			}
+		}
+		if duplicated {
+			continue
+		}
+		seen[key] = append(seen[key], rdata)
+		filtered = append(filtered, rr)
+	}
+	return filtered
+}
+
+// Limit 返回响应部分中编码大小不超过 n 字节的最长前缀，超出的记录被整条删除。
+// 大小按不压缩的编码计算，故实际编码进消息后的大小不会超过 n。
+//   - 其接受参数为：字节数上限
+//   - 返回值为：截断后的响应部分
+func (responseSection DNSResponseSection) Limit(n int) DNSResponseSection {
+	limited := DNSResponseSection{}
+	size := 0
+	for _, rr := range responseSection {
+		size += rr.Size()
+		if size > n {
+			break
+		}
+		limited = append(limited, rr)
+	}
+	return limited
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// section_test.go 文件用于对 section.go 文件所实现的响应部分筛选方法进行测试。
+
+package dns
+
+import (
+	"testing"
+)
+
+// sectionTestRR 构造测试用的 A 记录
+func sectionTestRR(name string, ttl uint32, ip IP) DNSResourceRecord {
+	return DNSResourceRecord{
+		Name:  *NewDNSName(name),
+		Type:  DNSRRTypeA,
+		Class: DNSClassIN,
+		TTL:   ttl,
+		RData: &DNSRDATAA{Address: ip},
+	}
+}
+
+// sectionTestRRSIG 构造测试用的 RRSIG 记录
+func sectionTestRRSIG(name string, covered DNSType) DNSResourceRecord {
+	return DNSResourceRecord{
+		Name:  *NewDNSName(name),
+		Type:  DNSRRTypeRRSIG,
+		Class: DNSClassIN,
+		TTL:   3600,
+		RData: &DNSRDATARRSIG{
+			TypeCovered: covered,
+			Algorithm:   DNSSECAlgorithmECDSAP256SHA256,
+			Labels:      3,
+			SignerName:  "example.com.",
+			Signature:   []byte{1, 2, 3, 4},
+		},
+	}
+}
+
+// sectionTestSection 返回包含 A、TXT 及其 RRSIG 记录的响应部分
+func sectionTestSection() DNSResponseSection {
+	return DNSResponseSection{
+		sectionTestRR("www.example.com", 3600, IPv4(10, 10, 0, 3)),
+		sectionTestRRSIG("www.example.com", DNSRRTypeA),
+		{
+			Name:  *NewDNSName("www.example.com"),
+			Type:  DNSRRTypeTXT,
+			Class: DNSClassIN,
+			TTL:   3600,
+			RData: &DNSRDATATXT{TXT: []string{"hello"}},
+		},
+		sectionTestRRSIG("www.example.com", DNSRRTypeTXT),
+	}
+}
+
+// 测试 FilterByType 及 RemoveByType 方法
+func TestDNSResponseSectionFilterByType(t *testing.T) {
+	section := sectionTestSection()
+
+	kept := section.FilterByType(DNSRRTypeA)
+	expected := DNSResponseSection{section[0], section[1]}
+	if !kept.Equal(expected) {
+		t.Errorf(" method FilterByType() failed:\ngot:\n%v\nexpected:\n%v", kept, expected)
+	}
+
+	removed := section.RemoveByType(DNSRRTypeA)
+	expected = DNSResponseSection{section[2], section[3]}
+	if !removed.Equal(expected) {
+		t.Errorf(" method RemoveByType() failed:\ngot:\n%v\nexpected:\n%v", removed, expected)
+	}
+
+	// 原有的响应部分不应被修改
+	if len(section) != 4 {
+		t.Errorf(" method FilterByType() failed: original section modified, got %d records", len(section))
+	}
+}
+
+// 测试 RemoveRRSIGs 方法
+func TestDNSResponseSectionRemoveRRSIGs(t *testing.T) {
+	section := sectionTestSection()
+	removed := section.RemoveRRSIGs()
+	expected := DNSResponseSection{section[0], section[2]}
+	if !removed.Equal(expected) {
+		t.Errorf(" method RemoveRRSIGs() failed:\ngot:\n%v\nexpected:\n%v", removed, expected)
+	}
+}
+
+// 测试 DeduplicateRRs 方法
+func TestDNSResponseSectionDeduplicateRRs(t *testing.T) {
+	section := DNSResponseSection{
+		sectionTestRR("www.example.com", 3600, IPv4(10, 10, 0, 3)),
+		sectionTestRR("WWW.example.com", 60, IPv4(10, 10, 0, 3)),
+		sectionTestRR("www.example.com", 3600, IPv4(10, 10, 0, 4)),
+		sectionTestRR("ftp.example.com", 3600, IPv4(10, 10, 0, 3)),
+	}
+	deduplicated := section.DeduplicateRRs()
+	expected := DNSResponseSection{section[0], section[2], section[3]}
+	if !deduplicated.Equal(expected) {
+		t.Errorf(" method DeduplicateRRs() failed:\ngot:\n%v\nexpected:\n%v", deduplicated, expected)
+	}
+}
+
+// 测试 Limit 方法
+func TestDNSResponseSectionLimit(t *testing.T) {
+	section := sectionTestSection()
+	size := section[0].Size() + section[1].Size()
+
+	testCases := []struct {
+		n        int
+		expected int
+	}{
+		{0, 0},
+		{size - 1, 1},
+		{size, 2},
+		{section.Size(), 4},
+		{section.Size() + 100, 4},
+	}
+	for _, tc := range testCases {
+		limited := section.Limit(tc.n)
+		if len(limited) != tc.expected {
+			t.Errorf(" method Limit(%d) failed: got %d records, expected %d", tc.n, len(limited), tc.expected)
+		}
+		if limited.Size() > tc.n {
+			t.Errorf(" method Limit(%d) failed: size %d exceeds limit", tc.n, limited.Size())
+		}
+	}
+}
@@ -7,7 +7,8 @@
 package dns
 
 import (
-	"encoding/binary"
+	"crypto/sha1"
+	"encoding/base32"
 	"fmt"
 	"strings"
 )
@@ -67,7 +68,7 @@ func (dn *DNSName) InitFromBuffer(data []byte, offset int) (int, error) {
 		return -1, fmt.Errorf("InitFromBuffer error: %s", err)
 	}
 	dn.DomainName = name
-	dn.WiredBytes = data[offset:nOffset]
+	dn.WiredBytes = decodedWiredBytes(data[offset:nOffset], name)
 	return nOffset, nil
 }
 
@@ -85,11 +86,23 @@ func NewDNSNameFromBuffer(data []byte, offset int) (DNSName, int, error) {
 	}
 	dn := DNSName{
 		DomainName: name,
-		WiredBytes: data[offset:nOffset],
+		WiredBytes: decodedWiredBytes(data[offset:nOffset], name),
 	}
 	return dn, nOffset, nil
 }
 
+// decodedWiredBytes 返回解码所得名称的线路格式：
+// 名称未被压缩时即为其在缓冲区中的字节，否则重新编码完整的名称，
+// 以免指针在名称被写入其他消息时指向错误的位置。
+func decodedWiredBytes(wire []byte, name string) []byte {
+	for i := 0; i < len(wire) && wire[i] != 0; i += int(wire[i]) + 1 {
+		if wire[i] >= NamePointerFlag {
+			return EncodeDomainName(&name)
+		}
+	}
+	return wire
+}
+
 func NewDNSNameFromWiredBytes(data []byte) *DNSName {
 	name := DecodeDomainName(data)
 	dn := &DNSName{
@@ -135,7 +148,7 @@ func (dn *DNSName) DecodeFromBuffer(data []byte, offset int) (int, error) {
 		return -1, fmt.Errorf("DecodeFromBuffer error: %s", err)
 	}
 	dn.DomainName = name
-	dn.WiredBytes = data[offset:nOffset]
+	dn.WiredBytes = decodedWiredBytes(data[offset:nOffset], name)
 	return nOffset, nil
 }
 
@@ -439,6 +452,171 @@ func CanonicalizeDomainName(name *string) string {
 	return strings.ToLower(*name)
 }
 
+// CanonicalNameKey 返回域名的规范排序键。
+// 键由逆序排列的小写标签组成，每个标签以 0x00 结尾，
+// 对键进行字节序比较的结果即为 RFC 4034 6.1 节所定义的域名规范顺序。
+func CanonicalNameKey(name string) []byte {
+	key := make([]byte, 0, len(name)+1)
+	for label, rest := popDomainNameLabel(name); label != ""; label, rest = popDomainNameLabel(rest) {
+		// 仅转换 ASCII 大写字母，以保持其他字节不变
+		for i := 0; i < len(label); i++ {
+			key = append(key, lowerASCII(label[i]))
+		}
+		key = append(key, 0x00)
+	}
+	return key
+}
+
+// CompareDomainName 按 RFC 4034 6.1 节所定义的规范顺序比较两个域名。
+// 返回值为 -1（a 在前）、0（相等）或 1（b 在前）。
+// 其从最后一个标签起逐个比较，与比较 CanonicalNameKey 的结果一致，但不分配内存。
+func CompareDomainName(a, b string) int {
+	for {
+		var la, lb string
+		la, a = popDomainNameLabel(a)
+		lb, b = popDomainNameLabel(b)
+		switch {
+		case la == "" && lb == "":
+			return 0
+		case la == "":
+			return -1
+		case lb == "":
+			return 1
+		}
+		for i := 0; i < len(la) && i < len(lb); i++ {
+			if ca, cb := lowerASCII(la[i]), lowerASCII(lb[i]); ca != cb {
+				if ca < cb {
+					return -1
+				}
+				return 1
+			}
+		}
+		if len(la) != len(lb) {
+			if len(la) < len(lb) {
+				return -1
+			}
+			return 1
+		}
+	}
+}
+
+// popDomainNameLabel 返回域名的最后一个非空标签及其余部分，没有标签时返回空字符串。
+func popDomainNameLabel(name string) (string, string) {
+	for name != "" {
+		i := strings.LastIndexByte(name, '.')
+		label := name[i+1:]
+		name = name[:max(i, 0)]
+		if label != "" {
+			return label, name
+		}
+	}
+	return "", ""
+}
+
+// lowerASCII 将 ASCII 大写字母转换为小写，其他字节保持不变
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// trimDomainNameDot 去除域名末尾的 '.'，根域名返回空字符串
+func trimDomainNameDot(name string) string {
+	if name != "" && name[len(name)-1] == '.' {
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// EqualDomainName 不区分大小写地检查两个域名是否相同，绝对域名与相对域名视为相同。
+// 仅转换 ASCII 字母，且不分配内存，可用于替代热路径上的 strings.EqualFold 及 strings.ToLower。
+func EqualDomainName(a, b string) bool {
+	a, b = trimDomainNameDot(a), trimDomainNameDot(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if lowerASCII(a[i]) != lowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubDomain 检查域名 name 是否位于区域 zone 之内（包括区域顶点本身），不区分大小写且不分配内存。
+// 区域为空字符串或根域名 "." 时包含全部域名。
+//   - 其接收参数为 域名 及 区域名称，
+//   - 返回值为 是否位于区域之内。
+func IsSubDomain(name, zone string) bool {
+	name, zone = trimDomainNameDot(name), trimDomainNameDot(zone)
+	if zone == "" {
+		return true
+	}
+	if len(name) < len(zone) || !EqualDomainName(name[len(name)-len(zone):], zone) {
+		return false
+	}
+	return len(name) == len(zone) || name[len(name)-len(zone)-1] == '.'
+}
+
+// AppendDomainNameLabels 将域名的各个标签按从左至右的顺序追加至 dst 之后，并返回追加后的切片。
+// 标签均为 name 的子串，复用 dst 时不分配内存，可用于替代热路径上的 strings.Split；
+// 根域名没有标签，末尾的 '.' 不产生空标签。
+func AppendDomainNameLabels(dst []string, name string) []string {
+	name = trimDomainNameDot(name)
+	for name != "" {
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return append(dst, name)
+		}
+		dst = append(dst, name[:i])
+		name = name[i+1:]
+	}
+	return dst
+}
+
+// NSECCovers 检查 NSEC 记录所表示的区间 (owner, next) 是否覆盖指定名称，
+// 即名称按规范顺序严格位于 owner 与 next 之间。
+// 当 next 不大于 owner 时（链中的最后一条记录），区间跨越区域末尾。
+func NSECCovers(owner, next, name string) bool {
+	o2n := CompareDomainName(owner, next)
+	o2x := CompareDomainName(owner, name)
+	x2n := CompareDomainName(name, next)
+	if o2n < 0 {
+		return o2x < 0 && x2n < 0
+	}
+	return o2x < 0 || x2n < 0
+}
+
+// nsec3Base32 为 NSEC3 所使用的 Base32 编码（RFC 4648 "Extended Hex"，无填充）
+var nsec3Base32 = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// NSEC3HashName 按照 RFC 5155 5 节计算域名的 NSEC3 哈希（SHA-1）：
+//
+//	IH(salt, x, 0) = H(x || salt)
+//	IH(salt, x, k) = H(IH(salt, x, k-1) || salt), if k > 0
+//
+// 其中 x 为规范化（小写）域名的线上格式。
+func NSEC3HashName(name string, iterations uint16, salt []byte) []byte {
+	name = CanonicalizeDomainName(&name)
+	x := EncodeDomainName(&name)
+	digest := sha1.Sum(append(x, salt...))
+	for i := 0; i < int(iterations); i++ {
+		digest = sha1.Sum(append(digest[:], salt...))
+	}
+	return digest[:]
+}
+
+// EncodeNSEC3Hash 以 NSEC3 所有者名称中使用的 Base32hex 小写形式表示哈希。
+func EncodeNSEC3Hash(hash []byte) string {
+	return strings.ToLower(nsec3Base32.EncodeToString(hash))
+}
+
+// DecodeNSEC3Hash 解码 Base32hex 形式的 NSEC3 哈希，大小写不敏感。
+func DecodeNSEC3Hash(label string) ([]byte, error) {
+	return nsec3Base32.DecodeString(strings.ToUpper(label))
+}
+
 type ByCanonicalOrder []DNSResourceRecord
 
 func (rrSet ByCanonicalOrder) Len() int {
@@ -460,64 +638,3 @@ func CanonicalSortRRSet(rrSet []DNSResourceRecord) {
 	}
 	rrSet = ByCanonicalOrder(rrSet)
 }
-
-// DNSMessageCompression 对 DNS 消息进行压缩。
-func CompressDNSMessage(msg []byte) ([]byte, error) {
-	cMsg := make([]byte, 0, len(msg))
-	// 从头部字段提取信息
-	nQD := binary.BigEndian.Uint16(msg[4:6])
-	nAN := binary.BigEndian.Uint16(msg[6:8])
-	nNS := binary.BigEndian.Uint16(msg[8:10])
-	nAR := binary.BigEndian.Uint16(msg[10:12])
-
-	cMsg = append(cMsg, msg[:12]...)
-	cOffset, mOffset := 12, 12
-
-	nameMap := make(map[string]int)
-
-	cFunc := func() error {
-		name, nOffset, err := DecodeDomainNameFromBuffer(msg, mOffset)
-		nLen := nOffset - mOffset
-		if err != nil {
-			return fmt.Errorf("DNSMessageCompression error: %s", err)
-		}
-		name = CanonicalizeDomainName(&name)
-		if _, ok := nameMap[name]; !ok {
-			nameMap[name] = cOffset
-			cMsg = append(cMsg, msg[mOffset:mOffset+nLen]...)
-			cOffset += nLen
-			mOffset += nLen
-		} else {
-			ptr := 0xC000 | nameMap[name]
-			cMsg = append(cMsg, byte(ptr>>8), byte(ptr&0xFF))
-			cOffset += 2
-			mOffset += nLen
-		}
-		return nil
-	}
-
-	// 处理查询部分
-	for i := 0; i < int(nQD); i++ {
-		// 压缩域名
-		cFunc()
-		// 处理其他字段
-		cMsg = append(cMsg, msg[mOffset:mOffset+4]...)
-
-		cOffset += 4
-		mOffset += 4
-	}
-	// 处理其他部分
-	for i := 0; i < int(nAN)+int(nNS)+int(nAR); i++ {
-		err := cFunc()
-		if err != nil {
-			return cMsg, err
-		}
-		// 处理其他字段
-		rdlen := binary.BigEndian.Uint16(msg[mOffset+8 : mOffset+10])
-		cMsg = append(cMsg, msg[mOffset:mOffset+10+int(rdlen)]...)
-		cOffset += 10 + int(rdlen)
-		mOffset += 10 + int(rdlen)
-	}
-
-	return cMsg, nil
-}
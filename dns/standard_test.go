@@ -6,7 +6,8 @@ package dns
 
 import (
 	"bytes"
-	"net"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -96,7 +97,7 @@ func TestCanonicalSortRRSet(t *testing.T) {
 			Class: DNSClassIN,
 			TTL:   7200,
 			RData: &DNSRDATAA{
-				Address: net.IPv4(10, 10, 3, 6),
+				Address: IPv4(10, 10, 3, 6),
 			},
 		},
 		{
@@ -105,7 +106,7 @@ func TestCanonicalSortRRSet(t *testing.T) {
 			Class: DNSClassIN,
 			TTL:   7200,
 			RData: &DNSRDATAA{
-				Address: net.IPv4(10, 10, 3, 4),
+				Address: IPv4(10, 10, 3, 4),
 			},
 		},
 		{
@@ -114,7 +115,7 @@ func TestCanonicalSortRRSet(t *testing.T) {
 			Class: DNSClassIN,
 			TTL:   7200,
 			RData: &DNSRDATAA{
-				Address: net.IPv4(10, 10, 3, 5),
+				Address: IPv4(10, 10, 3, 5),
 			},
 		},
 	}
@@ -122,6 +123,107 @@ func TestCanonicalSortRRSet(t *testing.T) {
 	t.Logf("CanonicalSortRRSet: %v", rrSet)
 }
 
+func TestCompareDomainName(t *testing.T) {
+	// RFC 4034 6.1 节中的规范顺序示例，转义标签以实际字节表示
+	ordered := []string{
+		"example",
+		"a.example",
+		"yljkjljk.a.example",
+		"Z.a.example",
+		"zABC.a.EXAMPLE",
+		"z.example",
+		"\x01.z.example",
+		"*.z.example",
+		"\x80.z.example",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		if CompareDomainName(ordered[i], ordered[i+1]) != -1 {
+			t.Errorf("function CompareDomainName() failed:\n%q should be ordered before %q", ordered[i], ordered[i+1])
+		}
+	}
+	if CompareDomainName("Example.COM", "example.com") != 0 {
+		t.Errorf("function CompareDomainName() failed: expected names to be equal")
+	}
+	if CompareDomainName(".", "com") != -1 {
+		t.Errorf("function CompareDomainName() failed: expected root to be ordered first")
+	}
+}
+
+func TestEqualDomainName(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"www.Example.COM", "www.example.com.", true},
+		{".", "", true},
+		{"example.com", "example.org", false},
+		{"example.com", "xexample.com", false},
+	}
+	for _, tt := range tests {
+		if EqualDomainName(tt.a, tt.b) != tt.expected {
+			t.Errorf("function EqualDomainName() failed: (%s, %s)\nexpected: %v", tt.a, tt.b, tt.expected)
+		}
+	}
+}
+
+func TestIsSubDomain(t *testing.T) {
+	tests := []struct {
+		name, zone string
+		expected   bool
+	}{
+		{"www.example.com", "example.com", true},
+		{"WWW.EXAMPLE.COM.", "example.com", true},
+		{"example.com", "Example.Com.", true},
+		{"wwwexample.com", "example.com", false},
+		{"example.com", "www.example.com", false},
+		{"www.example.com", ".", true},
+		{"www.example.com", "", true},
+	}
+	for _, tt := range tests {
+		if IsSubDomain(tt.name, tt.zone) != tt.expected {
+			t.Errorf("function IsSubDomain() failed: (%s, %s)\nexpected: %v", tt.name, tt.zone, tt.expected)
+		}
+	}
+}
+
+func TestAppendDomainNameLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"www.example.com", []string{"www", "example", "com"}},
+		{"www.example.com.", []string{"www", "example", "com"}},
+		{"com", []string{"com"}},
+		{".", nil},
+	}
+	for _, tt := range tests {
+		if labels := AppendDomainNameLabels(nil, tt.name); !reflect.DeepEqual(labels, tt.expected) {
+			t.Errorf("function AppendDomainNameLabels() failed: %s\ngot: %q\nexpected: %q", tt.name, labels, tt.expected)
+		}
+	}
+}
+
+func TestNSECCovers(t *testing.T) {
+	tests := []struct {
+		owner, next, name string
+		expected          bool
+	}{
+		{"a.example", "d.example", "b.example", true},
+		{"a.example", "d.example", "a.example", false},
+		{"a.example", "d.example", "d.example", false},
+		{"a.example", "d.example", "x.b.example", true},
+		// 链中的最后一条记录
+		{"z.example", "example", "zz.example", true},
+		{"z.example", "example", "b.example", false},
+		{"example", "example", "b.example", true},
+	}
+	for _, tt := range tests {
+		if NSECCovers(tt.owner, tt.next, tt.name) != tt.expected {
+			t.Errorf("function NSECCovers() failed: (%s, %s) %s\nexpected: %v", tt.owner, tt.next, tt.name, tt.expected)
+		}
+	}
+}
+
 func TestCompressDNSMessage(t *testing.T) {
 	msg := DNSMessage{
 		Header: DNSHeader{
@@ -152,7 +254,7 @@ func TestCompressDNSMessage(t *testing.T) {
 				Class: DNSClassIN,
 				TTL:   7200,
 				RData: &DNSRDATAA{
-					Address: net.IPv4(10, 10, 3, 6),
+					Address: IPv4(10, 10, 3, 6),
 				},
 			},
 			{
@@ -161,7 +263,7 @@ func TestCompressDNSMessage(t *testing.T) {
 				Class: DNSClassIN,
 				TTL:   7200,
 				RData: &DNSRDATAA{
-					Address: net.IPv4(10, 10, 3, 4),
+					Address: IPv4(10, 10, 3, 4),
 				},
 			},
 			{
@@ -170,7 +272,7 @@ func TestCompressDNSMessage(t *testing.T) {
 				Class: DNSClassIN,
 				TTL:   7200,
 				RData: &DNSRDATAA{
-					Address: net.IPv4(10, 10, 3, 5),
+					Address: IPv4(10, 10, 3, 5),
 				},
 			},
 		},
@@ -189,4 +291,82 @@ func TestCompressDNSMessage(t *testing.T) {
 	rMsg := DNSMessage{}
 	rMsg.DecodeFromBuffer(cMsg, 0)
 	t.Logf("Decoded Compressed DNS Message: %v", rMsg)
+
+	// 问题及 3 条回答共享同一名称，压缩后每条回答的名称仅占 2 字节
+	if len(cMsg) != len(msgBytes)-3*(13-2) {
+		t.Errorf("CompressDNSMessage() failed: got %d bytes, original %d bytes", len(cMsg), len(msgBytes))
+	}
+	for i, rr := range rMsg.Answer {
+		if rr.Name.DomainName != "example.com" || !rr.RData.Equal(msg.Answer[i].RData) {
+			t.Errorf("CompressDNSMessage() failed: answer %d not match:\n%s", i, rr.String())
+		}
+	}
+}
+
+func TestNSEC3HashName(t *testing.T) {
+	// RFC 5155 附录 A 中的示例
+	salt := []byte{0xaa, 0xbb, 0xcc, 0xdd}
+	tests := map[string]string{
+		"example":    "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom",
+		"a.example":  "35mthgpgcu1qg68fab165klnsnk3dpvl",
+		"ai.example": "gjeqe526plbf1g8mklp59enfd789njgi",
+	}
+	for name, expected := range tests {
+		hash := EncodeNSEC3Hash(NSEC3HashName(name, 12, salt))
+		if hash != expected {
+			t.Errorf("function NSEC3HashName() failed: %s\ngot:%s\nexpected: %s", name, hash, expected)
+		}
+		decoded, err := DecodeNSEC3Hash(expected)
+		if err != nil || !bytes.Equal(decoded, NSEC3HashName(name, 12, salt)) {
+			t.Errorf("function DecodeNSEC3Hash() failed: %s\n%v", expected, err)
+		}
+	}
+}
+
+// 以下基准测试对比分配内存的 strings 实现与不分配内存的域名辅助函数
+
+var benchmarkedName = "WWW.Sub.Example.COM."
+
+func BenchmarkCompareDomainName(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CompareDomainName(benchmarkedName, "www.sub.example.org")
+	}
+}
+
+func BenchmarkCompareDomainNameKey(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bytes.Compare(CanonicalNameKey(benchmarkedName), CanonicalNameKey("www.sub.example.org"))
+	}
+}
+
+func BenchmarkIsSubDomain(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		IsSubDomain(benchmarkedName, "example.com")
+	}
+}
+
+func BenchmarkIsSubDomainStrings(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		name := strings.ToLower(strings.TrimSuffix(benchmarkedName, "."))
+		_ = name == "example.com" || strings.HasSuffix(name, ".example.com")
+	}
+}
+
+func BenchmarkAppendDomainNameLabels(b *testing.B) {
+	b.ReportAllocs()
+	labels := make([]string, 0, 8)
+	for i := 0; i < b.N; i++ {
+		labels = AppendDomainNameLabels(labels[:0], benchmarkedName)
+	}
+}
+
+func BenchmarkSplitDomainName(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		strings.Split(benchmarkedName, ".")
+	}
 }
@@ -476,24 +476,80 @@ func (dnsType DNSType) String() string {
 	}
 }
 
-func PubilcKeySizeOf(alg DNSSECAlgorithm) int {
+// DefaultRSABits 是 PublicKeySizeOf 及 SignatureSizeOf 对 RSA 系列算法假定的模数长度（比特）
+const DefaultRSABits = 2048
+
+// DefaultRSAExponent 是 PublicKeySizeOf 对 RSA 系列算法假定的公钥指数
+const DefaultRSAExponent = 65537
+
+// PublicKeySizeOf 返回使用指定算法生成的 DNSKEY 公钥长度（字节），未知算法返回 0。
+// RSA 系列算法返回模数长度为 DefaultRSABits、公钥指数为 DefaultRSAExponent 时的长度，
+// 其他配置下的长度请使用 RSAPublicKeySize。
+func PublicKeySizeOf(alg DNSSECAlgorithm) int {
 	switch alg {
+	case DNSSECAlgorithmRSASHA1, DNSSECAlgorithmRSASHA1NSEC3, DNSSECAlgorithmRSASHA256, DNSSECAlgorithmRSASHA512:
+		return RSAPublicKeySize(DefaultRSABits, DefaultRSAExponent)
+	case DNSSECAlgorithmECCGOST:
+		return 64
 	case DNSSECAlgorithmECDSAP256SHA256:
 		return 64
 	case DNSSECAlgorithmECDSAP384SHA384:
 		return 96
 	case DNSSECAlgorithmED25519:
 		return 32
+	case DNSSECAlgorithmED448:
+		return 57
 	}
 	return 0
 }
 
+// PubilcKeySizeOf 返回使用指定算法生成的 DNSKEY 公钥长度（字节）
+//
+// Deprecated: 该名称存在拼写错误，请使用 PublicKeySizeOf。
+func PubilcKeySizeOf(alg DNSSECAlgorithm) int {
+	return PublicKeySizeOf(alg)
+}
+
+// RSAPublicKeySize 返回 PKIX（SubjectPublicKeyInfo）编码的 RSA 公钥长度（字节），
+// 即 xperi 生成的 RSA DNSKEY 的公钥长度。
+// 其接受参数为：
+//   - bits int，模数长度（比特）
+//   - exponent int，公钥指数
+func RSAPublicKeySize(bits, exponent int) int {
+	// DER 编码的正整数在最高位为 1 时需要额外的前导零字节
+	exponentBits := 0
+	for e := exponent; e > 0; e >>= 1 {
+		exponentBits++
+	}
+	rsaPublicKey := derSize(derSize(bits/8+1) + derSize(exponentBits/8+1))
+	// AlgorithmIdentifier 为 rsaEncryption OID 及 NULL 参数，共 15 字节；
+	// BIT STRING 的内容以一个表示未使用位数的字节开头
+	return derSize(15 + derSize(1+rsaPublicKey))
+}
+
+// derSize 返回内容长度为 length 的 DER TLV 编码长度
+func derSize(length int) int {
+	switch {
+	case length < 0x80:
+		return 2 + length
+	case length < 0x100:
+		return 3 + length
+	case length < 0x10000:
+		return 4 + length
+	default:
+		return 5 + length
+	}
+}
+
+// DigestSizeOf 返回指定摘要类型的 DS 摘要长度（字节），未知类型返回 0
 func DigestSizeOf(alg DNSSECDigestType) int {
 	switch alg {
 	case DNSSECDigestTypeSHA1:
 		return 20
 	case DNSSECDigestTypeSHA256:
 		return 32
+	case DNSSECDigestTypeGOST:
+		return 32
 	case DNSSECDigestTypeSHA384:
 		return 48
 	case DNSSECDigestTypeSHA512:
@@ -503,13 +559,28 @@ func DigestSizeOf(alg DNSSECDigestType) int {
 	}
 }
 
+// SignatureSizeOf 返回使用指定算法生成的 RRSIG 签名长度（字节），未知算法返回 0。
+// RSA 系列算法返回模数长度为 DefaultRSABits 时的长度，其他配置下的长度请使用 RSASignatureSize。
 func SignatureSizeOf(alg DNSSECAlgorithm) int {
 	switch alg {
+	case DNSSECAlgorithmRSASHA1, DNSSECAlgorithmRSASHA1NSEC3, DNSSECAlgorithmRSASHA256, DNSSECAlgorithmRSASHA512:
+		return RSASignatureSize(DefaultRSABits)
+	case DNSSECAlgorithmECCGOST:
+		return 64
 	case DNSSECAlgorithmECDSAP256SHA256:
 		return 64
 	case DNSSECAlgorithmECDSAP384SHA384:
 		return 96
+	case DNSSECAlgorithmED25519:
+		return 64
+	case DNSSECAlgorithmED448:
+		return 114
 	default:
 		return 0
 	}
 }
+
+// RSASignatureSize 返回模数长度为 bits 比特的 RSA 签名长度（字节）
+func RSASignatureSize(bits int) int {
+	return (bits + 7) / 8
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// validate.go 文件实现了对所构造的 DNS 消息的协议合规性检查。
+// dns 包本身不限制消息的格式，以便构造畸形消息，
+// Validate 则用于找出消息中违反协议的部分，从而区分有意的畸形构造与意外的错误；
+// EncodeStrict 在消息存在违规时拒绝编码。
+
+package dns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ViolationKind 表示协议违规的类别
+type ViolationKind string
+
+const (
+	// 头部计数与实际记录数不符
+	ViolationCount ViolationKind = "count"
+	// 同一 RRset 中的记录 TTL 不同，RFC 2181 5.2 节
+	ViolationTTL ViolationKind = "ttl"
+	// RDLen 字段与 RDATA 的实际长度不符
+	ViolationRDLen ViolationKind = "rdlen"
+	// 标签为空或长度超过 63 字节，RFC 1035 2.3.4 节
+	ViolationLabelLength ViolationKind = "label-length"
+	// 域名的线路格式长度超过 255 字节，RFC 1035 2.3.4 节
+	ViolationNameLength ViolationKind = "name-length"
+)
+
+// Violation 表示消息中的一处协议违规
+type Violation struct {
+	Kind ViolationKind
+	// 所在部分，为 "Header"、"Question"、"Answer"、"Authority" 或 "Additional"
+	Section string
+	// 所在记录在该部分中的序号，与具体记录无关时为 -1
+	Index int
+	// 违规详情
+	Detail string
+}
+
+func (v Violation) String() string {
+	if v.Index < 0 {
+		return fmt.Sprintf("%s: [%s] %s", v.Section, v.Kind, v.Detail)
+	}
+	return fmt.Sprintf("%s[%d]: [%s] %s", v.Section, v.Index, v.Kind, v.Detail)
+}
+
+// ValidationError 表示消息未能通过检查，其包含全部违规
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = v.String()
+	}
+	return fmt.Sprintf("message has %d protocol violations:\n%s", len(e.Violations), strings.Join(lines, "\n"))
+}
+
+// Validate 检查 DNS 消息是否违反协议，目前检查的内容为：
+//   - 头部计数与各部分的记录数是否一致；
+//   - 同一部分内同一 RRset 的记录 TTL 是否相同，RRSIG 按其覆盖的类型分组，OPT 记录不参与检查；
+//   - 非零的 RDLen 是否与 RDATA 的实际长度一致；
+//   - 查询名称、记录名称及已知类型 RDATA 中域名的标签长度及域名长度。
+//
+// 其接受参数为：
+//   - msg *DNSMessage，待检查的 DNS 消息
+//
+// 返回值为：
+//   - []Violation，按出现位置排列的违规，消息合规时为空
+func Validate(msg *DNSMessage) []Violation {
+	violations := []Violation{}
+
+	counts := []struct {
+		field  string
+		header uint16
+		actual int
+	}{
+		{"QDCOUNT", msg.Header.QDCount, len(msg.Question)},
+		{"ANCOUNT", msg.Header.ANCount, len(msg.Answer)},
+		{"NSCOUNT", msg.Header.NSCount, len(msg.Authority)},
+		{"ARCOUNT", msg.Header.ARCount, len(msg.Additional)},
+	}
+	for _, c := range counts {
+		if int(c.header) != c.actual {
+			violations = append(violations, Violation{
+				Kind: ViolationCount, Section: "Header", Index: -1,
+				Detail: fmt.Sprintf("%s is %d but the section holds %d records", c.field, c.header, c.actual),
+			})
+		}
+	}
+
+	for i, q := range msg.Question {
+		for _, detail := range validateName(q.Name.DomainName) {
+			detail.Section, detail.Index = "Question", i
+			violations = append(violations, detail)
+		}
+	}
+
+	sections := []struct {
+		name string
+		rrs  DNSResponseSection
+	}{
+		{"Answer", msg.Answer},
+		{"Authority", msg.Authority},
+		{"Additional", msg.Additional},
+	}
+	for _, section := range sections {
+		violations = append(violations, validateSection(section.name, section.rrs)...)
+	}
+	return violations
+}
+
+// EncodeStrict 检查 DNS 消息，仅在消息合规时对其进行编码。
+// 返回值为：
+//   - []byte，编码后的消息
+//   - error，消息存在违规时返回 *ValidationError
+func EncodeStrict(msg *DNSMessage) ([]byte, error) {
+	if violations := Validate(msg); len(violations) > 0 {
+		return nil, &ValidationError{Violations: violations}
+	}
+	return msg.Encode(), nil
+}
+
+// validateSection 检查一个部分中的资源记录
+func validateSection(section string, rrs DNSResponseSection) []Violation {
+	violations := []Violation{}
+	// RRset 首条记录的序号及 TTL
+	type rrsetTTL struct {
+		index int
+		ttl   uint32
+	}
+	rrsets := map[string]rrsetTTL{}
+
+	for i := range rrs {
+		rr := &rrs[i]
+		report := func(kind ViolationKind, format string, args ...interface{}) {
+			violations = append(violations, Violation{
+				Kind: kind, Section: section, Index: i,
+				Detail: fmt.Sprintf(format, args...),
+			})
+		}
+
+		for _, v := range validateName(rr.Name.DomainName) {
+			report(v.Kind, "owner %s", v.Detail)
+		}
+		if rr.RData == nil {
+			continue
+		}
+		for _, name := range rdataNames(rr.RData) {
+			for _, v := range validateName(name) {
+				report(v.Kind, "RDATA %s", v.Detail)
+			}
+		}
+
+		size := rr.RData.Size()
+		if rr.IsStatic {
+			size = len(rr.Static_Rdata)
+		}
+		if rr.RDLen != 0 && int(rr.RDLen) != size {
+			report(ViolationRDLen, "RDLEN is %d but the RDATA is %d bytes", rr.RDLen, size)
+		}
+
+		if rr.Type == DNSRRTypeOPT {
+			continue
+		}
+		key := fmt.Sprintf("%s|%d|%d", strings.ToLower(strings.TrimSuffix(rr.Name.DomainName, ".")), rr.Type, rr.Class)
+		if rrsig, ok := rr.RData.(*DNSRDATARRSIG); ok {
+			key += fmt.Sprintf("|%d", rrsig.TypeCovered)
+		}
+		if first, ok := rrsets[key]; !ok {
+			rrsets[key] = rrsetTTL{index: i, ttl: rr.TTL}
+		} else if first.ttl != rr.TTL {
+			report(ViolationTTL, "TTL %d differs from TTL %d of record %d in the same %s RRset",
+				rr.TTL, first.ttl, first.index, rr.Type)
+		}
+	}
+	return violations
+}
+
+// validateName 检查域名的标签长度及线路格式长度，返回的违规不含位置信息
+func validateName(name string) []Violation {
+	violations := []Violation{}
+	trimmed := strings.TrimSuffix(name, ".")
+	if trimmed == "" {
+		return violations
+	}
+	wireLen := 1
+	for _, label := range strings.Split(trimmed, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			violations = append(violations, Violation{
+				Kind:   ViolationLabelLength,
+				Detail: fmt.Sprintf("name %q has a label of %d bytes", name, len(label)),
+			})
+		}
+		wireLen += 1 + len(label)
+	}
+	if wireLen > 255 {
+		violations = append(violations, Violation{
+			Kind:   ViolationNameLength,
+			Detail: fmt.Sprintf("name %q is %d bytes in wire format", name, wireLen),
+		})
+	}
+	return violations
+}
+
+// rdataNames 返回已知类型 RDATA 中的域名
+func rdataNames(rdata DNSRRRDATA) []string {
+	switch rd := rdata.(type) {
+	case *DNSRDATANS:
+		return []string{rd.NSDNAME}
+	case *DNSRDATACNAME:
+		return []string{rd.CNAME}
+	case *DNSRDATAPTR:
+		return []string{rd.PTR}
+	case *DNSRDATADNAME:
+		return []string{rd.DNAME}
+	case *DNSRDATASOA:
+		return []string{rd.MName, rd.RName}
+	case *DNSRDATARRSIG:
+		return []string{rd.SignerName}
+	case *DNSRDATANSEC:
+		return []string{rd.NextDomainName}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// validate_test.go 文件定义了对 validate.go 的单元测试
+
+package dns
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// validatedA 返回一条 A 记录
+func validatedA(name string, ttl uint32) DNSResourceRecord {
+	return DNSResourceRecord{
+		Name:  *NewDNSName(name),
+		Type:  DNSRRTypeA,
+		Class: DNSClassIN,
+		TTL:   ttl,
+		RDLen: 4,
+		RData: &DNSRDATAA{Address: IPv4(10, 10, 0, 3)},
+	}
+}
+
+// violationKinds 返回违规的类别列表
+func violationKinds(violations []Violation) []ViolationKind {
+	kinds := []ViolationKind{}
+	for _, v := range violations {
+		kinds = append(kinds, v.Kind)
+	}
+	return kinds
+}
+
+// 测试合规的消息
+func TestValidateCompliant(t *testing.T) {
+	msg := DNSMessage{
+		Header:   DNSHeader{QR: true, QDCount: 1, ANCount: 2, ARCount: 1},
+		Question: DNSQuestionSection{{Name: *NewDNSName("www.example.com"), Type: DNSRRTypeA, Class: DNSClassIN}},
+		Answer: DNSResponseSection{
+			validatedA("www.example.com", 300),
+			validatedA("WWW.example.com.", 300),
+		},
+		Additional: DNSResponseSection{(&DNSOPTRecord{UDPPayloadSize: 1232}).ResourceRecord()},
+	}
+	if violations := Validate(&msg); len(violations) != 0 {
+		t.Errorf("function Validate() failed: unexpected violations %v", violations)
+	}
+	if _, err := EncodeStrict(&msg); err != nil {
+		t.Errorf("function EncodeStrict() failed:\n%s", err)
+	}
+}
+
+// 测试各类违规
+func TestValidateViolations(t *testing.T) {
+	longLabel := strings.Repeat("a", 64)
+	longName := strings.TrimSuffix(strings.Repeat(strings.Repeat("b", 60)+".", 5), ".")
+
+	mismatched := validatedA("b.example.com", 300)
+	mismatched.RDLen = 16
+	msg := DNSMessage{
+		Header:   DNSHeader{QDCount: 2, ANCount: 3},
+		Question: DNSQuestionSection{{Name: *NewDNSName(longLabel + ".example.com"), Type: DNSRRTypeA, Class: DNSClassIN}},
+		Answer: DNSResponseSection{
+			validatedA("a.example.com", 300),
+			validatedA("a.example.com", 600),
+			mismatched,
+		},
+		Authority: DNSResponseSection{{
+			Name:  *NewDNSName("example.com"),
+			Type:  DNSRRTypeNS,
+			Class: DNSClassIN,
+			TTL:   300,
+			RData: &DNSRDATANS{NSDNAME: longName},
+		}},
+	}
+
+	violations := Validate(&msg)
+	expected := []Violation{
+		{Kind: ViolationCount, Section: "Header", Index: -1},
+		{Kind: ViolationCount, Section: "Header", Index: -1},
+		{Kind: ViolationLabelLength, Section: "Question", Index: 0},
+		{Kind: ViolationTTL, Section: "Answer", Index: 1},
+		{Kind: ViolationRDLen, Section: "Answer", Index: 2},
+		{Kind: ViolationNameLength, Section: "Authority", Index: 0},
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("function Validate() failed:\ngot:%v\nexpected: %v", violationKinds(violations), violationKinds(expected))
+	}
+	for i, v := range violations {
+		if v.Kind != expected[i].Kind || v.Section != expected[i].Section || v.Index != expected[i].Index {
+			t.Errorf("function Validate() failed:\ngot:%s\nexpected: %s[%d] %s", v, expected[i].Section, expected[i].Index, expected[i].Kind)
+		}
+	}
+
+	_, err := EncodeStrict(&msg)
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) || len(vErr.Violations) != len(expected) {
+		t.Errorf("function EncodeStrict() failed: expected a ValidationError but got %v", err)
+	}
+}
+
+// 测试 RRSIG 按其覆盖的类型分组
+func TestValidateRRSIGGrouping(t *testing.T) {
+	rrsig := func(covered DNSType, ttl uint32) DNSResourceRecord {
+		return DNSResourceRecord{
+			Name:  *NewDNSName("example.com"),
+			Type:  DNSRRTypeRRSIG,
+			Class: DNSClassIN,
+			TTL:   ttl,
+			RData: &DNSRDATARRSIG{TypeCovered: covered, SignerName: "example.com", Signature: []byte{1}},
+		}
+	}
+	msg := DNSMessage{
+		Header: DNSHeader{ANCount: 3},
+		Answer: DNSResponseSection{
+			rrsig(DNSRRTypeA, 300),
+			rrsig(DNSRRTypeNS, 3600),
+			rrsig(DNSRRTypeA, 60),
+		},
+	}
+	violations := Validate(&msg)
+	if len(violations) != 1 || violations[0].Kind != ViolationTTL || violations[0].Index != 2 {
+		t.Errorf("function Validate() failed: unexpected violations %v", violations)
+	}
+}
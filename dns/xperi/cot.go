@@ -0,0 +1,325 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// cot.go 提供了信任链（Chain of Trust）的导出函数，
+// 其按区域层级收集各区域的 DNSKEY、DS 及覆盖它们的 RRSIG 记录，
+// 并标注每条记录是有效、Key Tag 冲突还是随机 Key Tag，
+// 可导出为 Graphviz DOT 或 JSON，以便在部署前检查复杂的 KeyTrap 配置。
+//
+// 标注仅依据 Key Tag 及 DS 摘要，不验证签名：
+//   - DNSKEY：Key Tag 与同区域的其他 DNSKEY 相同时为冲突，否则为有效；
+//   - DS：摘要与子区域的某个 DNSKEY 相符时为有效，Key Tag 相符但摘要不符时为冲突，
+//     无 DNSKEY 具有其 Key Tag 时为随机 Key Tag；
+//   - RRSIG：签名者恰有一个 DNSKEY 具有其 Key Tag 时为有效，多个时为冲突，
+//     没有时为随机 Key Tag；签名者不在区域层级中时为未知。
+
+package xperi
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ChainStatus 表示信任链中记录的标注
+type ChainStatus string
+
+const (
+	ChainStatusValid     ChainStatus = "valid"
+	ChainStatusColliding ChainStatus = "colliding"
+	ChainStatusRandomTag ChainStatus = "random-tag"
+	ChainStatusUnknown   ChainStatus = "unknown"
+)
+
+// ChainQuerier 表示信任链导出时使用的查询函数，如 (*client.Client).Query
+type ChainQuerier func(qName string, qType dns.DNSType) (dns.DNSMessage, error)
+
+// ChainRecord 表示信任链中的一条 DNSKEY、DS 或 RRSIG 记录
+type ChainRecord struct {
+	Type      string              `json:"type"`
+	KeyTag    uint16              `json:"key_tag"`
+	Algorithm dns.DNSSECAlgorithm `json:"algorithm"`
+	// DNSKEY 的标志
+	Flags dns.DNSKEYFlag `json:"flags,omitempty"`
+	// DS 的摘要类型
+	DigestType dns.DNSSECDigestType `json:"digest_type,omitempty"`
+	// RRSIG 覆盖的类型及签名者
+	TypeCovered string `json:"type_covered,omitempty"`
+	SignerName  string `json:"signer_name,omitempty"`
+
+	Status ChainStatus `json:"status"`
+}
+
+// ChainZone 表示信任链中的一个区域
+type ChainZone struct {
+	Name string `json:"name"`
+	// 区域层级中最近的上级区域，不存在时为空
+	Parent string `json:"parent,omitempty"`
+
+	DNSKEY []ChainRecord `json:"dnskey"`
+	DS     []ChainRecord `json:"ds"`
+	// 覆盖 DNSKEY RRset 及 DS RRset 的签名
+	RRSIG []ChainRecord `json:"rrsig"`
+}
+
+// TrustChain 表示按区域层级导出的信任链，区域按层级由上至下排列
+type TrustChain struct {
+	Zones []ChainZone `json:"zones"`
+}
+
+// normalizeChainZone 将区域名转换为小写并去除末尾的点，根区域表示为 "."
+func normalizeChainZone(zone string) string {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	if zone == "" {
+		return "."
+	}
+	return zone
+}
+
+// chainDepth 返回区域名的标签数量，根区域为 0
+func chainDepth(zone string) int {
+	if zone == "." {
+		return 0
+	}
+	return dns.CountDomainNameLabels(&zone)
+}
+
+// chainAncestor 判断 ancestor 是否为 name 的上级区域
+func chainAncestor(ancestor, name string) bool {
+	if ancestor == name {
+		return false
+	}
+	return ancestor == "." || strings.HasSuffix(name, "."+ancestor)
+}
+
+// ExportTrustChain 查询区域层级中各区域的 DNSKEY 及 DS，并标注其中的记录
+// 其接受参数为：
+//   - query ChainQuerier，查询函数，回复中需包含 RRSIG 记录
+//   - zones []string，区域层级中的区域，顺序任意
+//
+// 返回值为：
+//   - *TrustChain，导出的信任链
+//   - error，任一查询失败时返回错误
+func ExportTrustChain(query ChainQuerier, zones []string) (*TrustChain, error) {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, zone := range zones {
+		zone = normalizeChainZone(zone)
+		if !seen[zone] {
+			seen[zone] = true
+			names = append(names, zone)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := chainDepth(names[i]), chainDepth(names[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return names[i] < names[j]
+	})
+
+	chain := &TrustChain{Zones: []ChainZone{}}
+	keys := map[string][]dns.DNSRDATADNSKEY{}
+	// 各区域的 DS 及覆盖 DS 的 RRSIG，在全部 DNSKEY 收集完毕后标注
+	dsSets := map[string][]*dns.DNSRDATADS{}
+	sigSets := map[string][]*dns.DNSRDATARRSIG{}
+
+	for _, name := range names {
+		zone := ChainZone{Name: name, DNSKEY: []ChainRecord{}, DS: []ChainRecord{}, RRSIG: []ChainRecord{}}
+		for _, ancestor := range names {
+			if chainAncestor(ancestor, name) {
+				zone.Parent = ancestor
+			}
+		}
+
+		resp, err := query(name, dns.DNSRRTypeDNSKEY)
+		if err != nil {
+			return nil, fmt.Errorf("function ExportTrustChain failed: query %s DNSKEY failed.\n%v", name, err)
+		}
+		for _, rr := range resp.Answer {
+			switch rdata := rr.RData.(type) {
+			case *dns.DNSRDATADNSKEY:
+				keys[name] = append(keys[name], *rdata)
+			case *dns.DNSRDATARRSIG:
+				if rdata.TypeCovered == dns.DNSRRTypeDNSKEY {
+					sigSets[name] = append(sigSets[name], rdata)
+				}
+			}
+		}
+
+		if name != "." {
+			resp, err = query(name, dns.DNSRRTypeDS)
+			if err != nil {
+				return nil, fmt.Errorf("function ExportTrustChain failed: query %s DS failed.\n%v", name, err)
+			}
+			for _, rr := range resp.Answer {
+				switch rdata := rr.RData.(type) {
+				case *dns.DNSRDATADS:
+					dsSets[name] = append(dsSets[name], rdata)
+				case *dns.DNSRDATARRSIG:
+					if rdata.TypeCovered == dns.DNSRRTypeDS {
+						sigSets[name] = append(sigSets[name], rdata)
+					}
+				}
+			}
+		}
+		chain.Zones = append(chain.Zones, zone)
+	}
+
+	for i := range chain.Zones {
+		zone := &chain.Zones[i]
+		zKeys := keys[zone.Name]
+		tags := make([]uint16, len(zKeys))
+		tagCount := map[uint16]int{}
+		for j, key := range zKeys {
+			tags[j] = CalculateKeyTag(key)
+			tagCount[tags[j]]++
+		}
+
+		for j, key := range zKeys {
+			status := ChainStatusValid
+			if tagCount[tags[j]] > 1 {
+				status = ChainStatusColliding
+			}
+			zone.DNSKEY = append(zone.DNSKEY, ChainRecord{
+				Type:      "DNSKEY",
+				KeyTag:    tags[j],
+				Algorithm: key.Algorithm,
+				Flags:     key.Flags,
+				Status:    status,
+			})
+		}
+
+		for _, ds := range dsSets[zone.Name] {
+			status := ChainStatusRandomTag
+			if tagCount[ds.KeyTag] > 0 {
+				status = ChainStatusColliding
+			}
+			for j, key := range zKeys {
+				if tags[j] == ds.KeyTag && isComputableDigestType(ds.DigestType) &&
+					bytes.Equal(GenerateRDATADS(zone.Name, key, ds.DigestType).Digest, ds.Digest) {
+					status = ChainStatusValid
+					break
+				}
+			}
+			zone.DS = append(zone.DS, ChainRecord{
+				Type:       "DS",
+				KeyTag:     ds.KeyTag,
+				Algorithm:  ds.Algorithm,
+				DigestType: ds.DigestType,
+				Status:     status,
+			})
+		}
+
+		for _, sig := range sigSets[zone.Name] {
+			signer := normalizeChainZone(sig.SignerName)
+			status := ChainStatusUnknown
+			if seen[signer] {
+				matched := 0
+				for _, key := range keys[signer] {
+					if CalculateKeyTag(key) == sig.KeyTag {
+						matched++
+					}
+				}
+				switch {
+				case matched == 0:
+					status = ChainStatusRandomTag
+				case matched == 1:
+					status = ChainStatusValid
+				default:
+					status = ChainStatusColliding
+				}
+			}
+			zone.RRSIG = append(zone.RRSIG, ChainRecord{
+				Type:        "RRSIG",
+				KeyTag:      sig.KeyTag,
+				Algorithm:   sig.Algorithm,
+				TypeCovered: sig.TypeCovered.String(),
+				SignerName:  signer,
+				Status:      status,
+			})
+		}
+	}
+	return chain, nil
+}
+
+// Count 返回信任链中具有指定标注的记录数量
+func (c *TrustChain) Count(status ChainStatus) int {
+	count := 0
+	for _, zone := range c.Zones {
+		for _, records := range [][]ChainRecord{zone.DNSKEY, zone.DS, zone.RRSIG} {
+			for _, record := range records {
+				if record.Status == status {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// chainColors 为各标注在 DOT 中使用的颜色
+var chainColors = map[ChainStatus]string{
+	ChainStatusValid:     "palegreen",
+	ChainStatusColliding: "orange",
+	ChainStatusRandomTag: "tomato",
+	ChainStatusUnknown:   "lightgrey",
+}
+
+// DOT 将信任链导出为 Graphviz DOT 格式。
+// 每个区域为一个子图，DS 指向子区域中具有其 Key Tag 的 DNSKEY，
+// RRSIG 指向签名者中具有其 Key Tag 的 DNSKEY，记录按标注着色。
+func (c *TrustChain) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph TrustChain {\n")
+	sb.WriteString("\trankdir=TB;\n")
+	sb.WriteString("\tnode [shape=box, style=filled];\n")
+
+	// 区域名与其 DNSKEY 节点的映射，以 Key Tag 查找
+	keyNodes := map[string]map[uint16][]string{}
+	for i, zone := range c.Zones {
+		keyNodes[zone.Name] = map[uint16][]string{}
+		for j, key := range zone.DNSKEY {
+			id := fmt.Sprintf("z%d_dnskey%d", i, j)
+			keyNodes[zone.Name][key.KeyTag] = append(keyNodes[zone.Name][key.KeyTag], id)
+		}
+	}
+
+	edges := []string{}
+	for i, zone := range c.Zones {
+		fmt.Fprintf(&sb, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(&sb, "\t\tlabel=%q;\n", zone.Name)
+		for j, key := range zone.DNSKEY {
+			role := "ZSK"
+			if key.Flags&1 == 1 {
+				role = "KSK"
+			}
+			fmt.Fprintf(&sb, "\t\tz%d_dnskey%d [label=\"DNSKEY %s\\ntag %d alg %d\\n%s\", fillcolor=%s];\n",
+				i, j, role, key.KeyTag, key.Algorithm, key.Status, chainColors[key.Status])
+		}
+		for j, ds := range zone.DS {
+			id := fmt.Sprintf("z%d_ds%d", i, j)
+			fmt.Fprintf(&sb, "\t\t%s [label=\"DS\\ntag %d alg %d digest %d\\n%s\", shape=ellipse, fillcolor=%s];\n",
+				id, ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Status, chainColors[ds.Status])
+			for _, target := range keyNodes[zone.Name][ds.KeyTag] {
+				edges = append(edges, fmt.Sprintf("\t%s -> %s;\n", id, target))
+			}
+		}
+		for j, sig := range zone.RRSIG {
+			id := fmt.Sprintf("z%d_rrsig%d", i, j)
+			fmt.Fprintf(&sb, "\t\t%s [label=\"RRSIG %s\\ntag %d signer %s\\n%s\", shape=note, fillcolor=%s];\n",
+				id, sig.TypeCovered, sig.KeyTag, sig.SignerName, sig.Status, chainColors[sig.Status])
+			for _, target := range keyNodes[sig.SignerName][sig.KeyTag] {
+				edges = append(edges, fmt.Sprintf("\t%s -> %s [style=dashed];\n", id, target))
+			}
+		}
+		sb.WriteString("\t}\n")
+	}
+	for _, edge := range edges {
+		sb.WriteString(edge)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
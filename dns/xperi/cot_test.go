@@ -0,0 +1,96 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// cot_test.go 文件定义了对 cot.go 的单元测试
+
+package xperi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// TestExportTrustChain 测试导出并标注信任链
+func TestExportTrustChain(t *testing.T) {
+	rootKSK, _ := GenerateRRDNSKEY(".", dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagSecureEntryPoint)
+	childKSK, _ := GenerateRRDNSKEY("test", dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagSecureEntryPoint)
+	childZSK, _ := GenerateRRDNSKEY("test", dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagZoneKey)
+	rootTag := CalculateKeyTag(*rootKSK.RData.(*dns.DNSRDATADNSKEY))
+	kskRDATA := *childKSK.RData.(*dns.DNSRDATADNSKEY)
+	kskTag := CalculateKeyTag(kskRDATA)
+	zskTag := CalculateKeyTag(*childZSK.RData.(*dns.DNSRDATADNSKEY))
+
+	sig := func(name string, covered dns.DNSType, tag uint16, signer string) dns.DNSResourceRecord {
+		return dns.DNSResourceRecord{
+			Name:  *dns.NewDNSName(name),
+			Type:  dns.DNSRRTypeRRSIG,
+			Class: dns.DNSClassIN,
+			RData: &dns.DNSRDATARRSIG{TypeCovered: covered, KeyTag: tag, SignerName: signer, Signature: []byte{1}},
+		}
+	}
+	validDS := GenerateRRDS("test", kskRDATA, dns.DNSSECDigestTypeSHA256)
+	collidedDS := GenerateRRDS("test", kskRDATA, dns.DNSSECDigestTypeSHA256)
+	collidedDS.RData.(*dns.DNSRDATADS).Digest[0] ^= 0xff
+	randomDS := GenerateRandomRRDS("test", int(kskTag+1), dns.DNSSECAlgorithmED25519, dns.DNSSECDigestTypeSHA256)
+	if zskTag == kskTag+1 {
+		t.Skip("random DS tag collides with the ZSK")
+	}
+
+	answers := map[string][]dns.DNSResourceRecord{
+		"./DNSKEY":    {rootKSK, sig(".", dns.DNSRRTypeDNSKEY, rootTag, ".")},
+		"test/DNSKEY": {childKSK, childZSK, childZSK, sig("test", dns.DNSRRTypeDNSKEY, kskTag, "test")},
+		"test/DS": {validDS, collidedDS, randomDS,
+			sig("test", dns.DNSRRTypeDS, rootTag, "."),
+			sig("test", dns.DNSRRTypeDS, rootTag+1, "."),
+			sig("test", dns.DNSRRTypeDS, 1, "other"),
+		},
+	}
+	query := func(qName string, qType dns.DNSType) (dns.DNSMessage, error) {
+		rrs, ok := answers[qName+"/"+qType.String()]
+		if !ok {
+			return dns.DNSMessage{}, fmt.Errorf("unexpected query %s %s", qName, qType)
+		}
+		return dns.DNSMessage{Answer: rrs}, nil
+	}
+
+	chain, err := ExportTrustChain(query, []string{"TEST.", "."})
+	if err != nil {
+		t.Fatalf("function ExportTrustChain() failed:\n%s", err)
+	}
+	if len(chain.Zones) != 2 || chain.Zones[0].Name != "." || chain.Zones[1].Parent != "." {
+		t.Fatalf("function ExportTrustChain() failed: unexpected zones %+v", chain.Zones)
+	}
+
+	statuses := func(records []ChainRecord) string {
+		s := []string{}
+		for _, r := range records {
+			s = append(s, string(r.Status))
+		}
+		return strings.Join(s, ",")
+	}
+	child := chain.Zones[1]
+	expected := map[string][2]string{
+		"DNSKEY": {statuses(child.DNSKEY), "valid,colliding,colliding"},
+		"DS":     {statuses(child.DS), "valid,colliding,random-tag"},
+		"RRSIG":  {statuses(child.RRSIG), "valid,valid,random-tag,unknown"},
+	}
+	for rrType, e := range expected {
+		if e[0] != e[1] {
+			t.Errorf("function ExportTrustChain() failed: %s statuses\ngot:%s\nexpected: %s", rrType, e[0], e[1])
+		}
+	}
+	if n := chain.Count(ChainStatusValid); n != 6 {
+		t.Errorf("method TrustChain Count() failed: got %d valid records, expected 6", n)
+	}
+
+	dot := chain.DOT()
+	if !strings.HasPrefix(dot, "digraph TrustChain {") || !strings.Contains(dot, "z1_ds0 -> z1_dnskey0;") {
+		t.Errorf("method TrustChain DOT() failed:\n%s", dot)
+	}
+	if _, err := json.Marshal(chain); err != nil {
+		t.Errorf("function json.Marshal() failed:\n%s", err)
+	}
+}
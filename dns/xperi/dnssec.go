@@ -18,7 +18,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math/big"
-	mrand "math/rand"
 
 	"github.com/tochusc/xdns/dns"
 )
@@ -38,17 +37,7 @@ func ParseKeyBase64(keyb64 string) []byte {
 //
 // Key Tag 是 DNSKEY 的一个 16 位无符号整数，用于快速识别 DNSKEY
 func CalculateKeyTag(key dns.DNSRDATADNSKEY) uint16 {
-	rdata := key.Encode()
-	var ac uint32
-	for i := 0; i < len(rdata); i++ {
-		if i&1 == 1 {
-			ac += uint32(rdata[i])
-		} else {
-			ac += uint32(rdata[i]) << 8
-		}
-	}
-	ac += ac >> 16 & 0xFFFF
-	return uint16(ac & 0xFFFF)
+	return foldKeyTag(keyTagSum(key.Encode()))
 }
 
 // GenerateRDATADNSKEY 生成公钥的 DNSKEY RDATA, 并返回私钥字节
@@ -262,83 +251,25 @@ func GenerateRRDS(oName string, kRDATA dns.DNSRDATADNSKEY, dType dns.DNSSECDiges
 	return rr
 }
 
-// GenerateRandomDNSKEYWithTag 生成一个具有指定KeyTag，且能通过检验，但错误的 DNSKEY RDATA
+// GenerateCollidedDNSKEY 生成一个与指定 DNSKEY 的 Key Tag 相同，但公钥不同的 DNSKEY RDATA
 // 传入参数：
-//   - algo: DNSSEC 算法
-//   - flag: DNSKEY Flag
-//   - tag: Key Tag
+//   - rdata: 作为基础的 DNSKEY RDATA
 //
 // 返回值：
 //   - 你想要的 DNSKEY RDATA
 func GenerateCollidedDNSKEY(rdata dns.DNSRDATADNSKEY) dns.DNSRDATADNSKEY {
-
-	keyLen := len(rdata.PublicKey)
-
-	keyByte := make([]byte, keyLen)
-	copy(keyByte, rdata.PublicKey)
-
-	randomIndexPlus := mrand.Intn(keyLen/2) + 1
-	randomIndexMinus := mrand.Intn(keyLen/2) + 1
-
-	for randomIndexPlus == randomIndexMinus {
-		randomIndexMinus = mrand.Intn(keyLen/2) + 1
-	}
-
-	randomOffset := uint8(mrand.Intn(128)) + 1
-
-	keyByte[randomIndexPlus*2-1] = keyByte[randomIndexPlus*2-1] + randomOffset
-	if keyByte[randomIndexPlus*2-1] < randomOffset {
-		keyByte[randomIndexPlus*2-2] = keyByte[randomIndexPlus*2-2] + 1
-	}
-
-	keyByte[randomIndexMinus*2-1] = keyByte[randomIndexMinus*2-1] - randomOffset
-	if keyByte[randomIndexMinus*2-1] > 255-randomOffset {
-		keyByte[randomIndexMinus*2-2] = keyByte[randomIndexMinus*2-2] - 1
-	}
-
-	pKey := dns.DNSRDATADNSKEY{
-		Flags:     rdata.Flags,
-		Protocol:  rdata.Protocol,
-		Algorithm: rdata.Algorithm,
-		PublicKey: keyByte,
-	}
-
-	return pKey
+	return GenerateDNSKEYSetWithTag(rdata, CalculateKeyTag(rdata), 1)[0]
 }
 
-// GenerateDNSKEYWithTag 生成一个具有指定KeyTag的 DNSKEY RDATA
+// GenerateDNSKEYWithTag 生成一个 Key Tag 比指定 DNSKEY 小 i 的 DNSKEY RDATA
 // 传入参数：
-//   - algo: DNSSEC 算法
-//   - flag: DNSKEY Flag
-//   - tag: Key Tag
+//   - rdata: 作为基础的 DNSKEY RDATA
+//   - i: Key Tag 的偏移，按 16 位无符号整数回绕
 //
 // 返回值：
 //   - 你想要的 DNSKEY RDATA
 func GenerateDNSKEYWithTag(rdata dns.DNSRDATADNSKEY, i int) dns.DNSRDATADNSKEY {
-	kbLen := len(rdata.PublicKey)
-	kb := make([]byte, kbLen)
-	copy(kb, rdata.PublicKey)
-	randomIndex := mrand.Intn(kbLen/2) + 1
-
-	lowOff := uint8(i % 256)
-	highOff := uint8(i / 256)
-
-	for kb[randomIndex*2-2] < highOff {
-		randomIndex = mrand.Intn(kbLen/2) + 1
-	}
-	kb[randomIndex*2-2] = kb[randomIndex*2-2] - highOff
-
-	kb[randomIndex*2-1] = kb[randomIndex*2-1] - lowOff
-	if kb[randomIndex*2-1] > 255-lowOff {
-		kb[randomIndex*2-2] = kb[randomIndex*2-2] - 1
-	}
-
-	return dns.DNSRDATADNSKEY{
-		Flags:     rdata.Flags,
-		Protocol:  rdata.Protocol,
-		Algorithm: rdata.Algorithm,
-		PublicKey: kb,
-	}
+	return GenerateDNSKEYSetWithTag(rdata, CalculateKeyTag(rdata)-uint16(i), 1)[0]
 }
 
 // RandomCharSet 随机字符集
@@ -347,7 +278,7 @@ var RandomCharSet = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ
 // GenerateRandomString 生成一个随机字符串
 func GenerateRandomString(length int) string {
 	str := make([]byte, length)
-	_, err := rand.Read(str)
+	_, err := RandomRead(str)
 	if err != nil {
 		panic(fmt.Sprintf("failed to generate random string: %s", err))
 	}
@@ -390,7 +321,7 @@ func GenerateRandomRDATARRSIG(rrSet []dns.DNSResourceRecord, algo dns.DNSSECAlgo
 	}
 
 	sig := make([]byte, sigLen)
-	_, err := rand.Read(sig)
+	_, err := RandomRead(sig)
 	if err != nil {
 		panic(fmt.Sprintf("function GenerateRandomRRSIG() failed:\n%s", err))
 	}
@@ -445,7 +376,7 @@ func GenerateRandomRDATADS(oName string, keytag int, algo dns.DNSSECAlgorithm, d
 	}
 
 	digest := make([]byte, digestLen)
-	_, err := rand.Read(digest)
+	_, err := RandomRead(digest)
 	if err != nil {
 		panic(fmt.Sprintf("function GenerateRandomDS() failed:\n%s", err))
 	}
@@ -481,7 +412,6 @@ type DNSSECAlgorithmer interface {
 }
 
 // DNSSECAlgorithmFactory 生成 DNSSECAlgorithmer
-// ECDSAP系列算法有概率生成失败...具体原因仍不清楚
 func DNSSECAlgorithmerFactory(algo dns.DNSSECAlgorithm) DNSSECAlgorithmer {
 	switch algo {
 	case dns.DNSSECAlgorithmRSASHA1:
@@ -514,7 +444,7 @@ func (RSASHA1) Sign(data, privKey []byte) ([]byte, error) {
 	}
 
 	// 签名
-	signature, err := rsa.SignPKCS1v15(nil, pKey, crypto.SHA256, digest[:])
+	signature, err := rsa.SignPKCS1v15(nil, pKey, crypto.SHA1, digest[:])
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign: %s", err)
 	}
@@ -523,18 +453,7 @@ func (RSASHA1) Sign(data, privKey []byte) ([]byte, error) {
 }
 
 func (RSASHA1) GenerateKey() ([]byte, []byte) {
-	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		panic(fmt.Sprintf("failed to generate RSA key: %s", err))
-	}
-
-	privKeyBytes := x509.MarshalPKCS1PrivateKey(privKey)
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
-	if err != nil {
-		panic(fmt.Sprintf("failed to marshal public key: %s", err))
-	}
-
-	return privKeyBytes, pubKeyBytes
+	return generateRSAKeyPair(KeyParams{})
 }
 
 type RSASHA256 struct{}
@@ -564,18 +483,7 @@ func (RSASHA256) Sign(data, privKey []byte) ([]byte, error) {
 }
 
 func (RSASHA256) GenerateKey() ([]byte, []byte) {
-	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		panic(fmt.Sprintf("failed to generate RSA key: %s", err))
-	}
-
-	privKeyBytes := x509.MarshalPKCS1PrivateKey(privKey)
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
-	if err != nil {
-		panic(fmt.Sprintf("failed to marshal public key: %s", err))
-	}
-
-	return privKeyBytes, pubKeyBytes
+	return generateRSAKeyPair(KeyParams{})
 }
 
 type RSASHA512 struct{}
@@ -600,20 +508,29 @@ func (RSASHA512) Sign(data, privKey []byte) ([]byte, error) {
 }
 
 func (RSASHA512) GenerateKey() ([]byte, []byte) {
-	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		panic(fmt.Sprintf("failed to generate RSA key: %s", err))
-	}
-
-	privKeyBytes := x509.MarshalPKCS1PrivateKey(privKey)
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
-	if err != nil {
-		panic(fmt.Sprintf("failed to marshal public key: %s", err))
-	}
+	return generateRSAKeyPair(KeyParams{})
+}
 
+// ecdsaKeyBytes 返回 ECDSA 私钥及公钥（X | Y）的定长字节编码，
+// 各部分按曲线长度填充前导零，使得公钥长度与 dns.PublicKeySizeOf 一致
+func ecdsaKeyBytes(privKey *ecdsa.PrivateKey) ([]byte, []byte) {
+	size := (privKey.Curve.Params().BitSize + 7) / 8
+	privKeyBytes := privKey.D.FillBytes(make([]byte, size))
+	pubKeyBytes := make([]byte, 2*size)
+	privKey.PublicKey.X.FillBytes(pubKeyBytes[:size])
+	privKey.PublicKey.Y.FillBytes(pubKeyBytes[size:])
 	return privKeyBytes, pubKeyBytes
 }
 
+// ecdsaSignatureBytes 返回 ECDSA 签名（r | s）的定长字节编码，RFC 6605 第 4 节
+func ecdsaSignatureBytes(curve elliptic.Curve, r, s *big.Int) []byte {
+	size := (curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature
+}
+
 type ECDSAP256SHA256 struct{}
 
 func (ECDSAP256SHA256) Sign(data, privKey []byte) ([]byte, error) {
@@ -633,7 +550,7 @@ func (ECDSAP256SHA256) Sign(data, privKey []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to sign: %s", err)
 	}
 
-	signature := append(r.Bytes(), s.Bytes()...)
+	signature := ecdsaSignatureBytes(curve, r, s)
 
 	return signature, nil
 }
@@ -643,9 +560,7 @@ func (ECDSAP256SHA256) GenerateKey() ([]byte, []byte) {
 	if err != nil {
 		panic(fmt.Sprintf("failed to generate ECDSA key: %s", err))
 	}
-	privKeyBytes := privKey.D.Bytes()
-	pubKeyBytes := append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...)
-	return privKeyBytes, pubKeyBytes
+	return ecdsaKeyBytes(privKey)
 }
 
 type ECDSAP384SHA384 struct{}
@@ -687,7 +602,7 @@ func (ECDSAP384SHA384) Sign(data, privKey []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to sign: %s", err)
 	}
 
-	signature := append(r.Bytes(), s.Bytes()...)
+	signature := ecdsaSignatureBytes(pKey.Curve, r, s)
 
 	return signature, nil
 }
@@ -697,20 +612,15 @@ func (ECDSAP384SHA384) GenerateKey() ([]byte, []byte) {
 	if err != nil {
 		panic(fmt.Sprintf("failed to generate ECDSA key: %s", err))
 	}
-	privKeyBytes := privKey.D.Bytes()
-	pubKeyBytes := append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...)
-	return privKeyBytes, pubKeyBytes
+	return ecdsaKeyBytes(privKey)
 }
 
 // ED25519 是 Ed25519 签名算法的实现
 type ED25519 struct{}
 
 func (ED25519) Sign(data, privKey []byte) ([]byte, error) {
-	// 计算明文摘要
-	digest := sha512.Sum512(data)
-
-	// 使用 Ed25519 签名
-	signature := ed25519.Sign(privKey, digest[:])
+	// Ed25519 直接对明文签名，RFC 8080 第 4 节
+	signature := ed25519.Sign(privKey, data)
 
 	return signature, nil
 }
@@ -7,7 +7,6 @@ package xperi
 import (
 	"encoding/base64"
 	"encoding/hex"
-	"net"
 	"testing"
 
 	"github.com/tochusc/xdns/dns"
@@ -79,7 +78,7 @@ func TestGenerateRandomRRSIG(t *testing.T) {
 			Class: dns.DNSClassIN,
 			TTL:   7200,
 			RData: &dns.DNSRDATAA{
-				Address: net.IPv4(10, 10, 3, 3),
+				Address: dns.IPv4(10, 10, 3, 3),
 			},
 		},
 	}
@@ -128,7 +127,7 @@ func TestGenerateRRSIG(t *testing.T) {
 			Class: dns.DNSClassIN,
 			TTL:   7200,
 			RData: &dns.DNSRDATAA{
-				Address: net.ParseIP("10.10.3.3"),
+				Address: dns.IPv4(10, 10, 3, 3),
 			},
 		},
 	}
@@ -10,5 +10,63 @@
 //   - GenerateDS 根据参数生成 DNSKEY 的 DS RDATA。
 //   - GenRandomRRSIG 用于生成一个随机的 RRSIG RDATA。
 //   - GenWrongKeyWithTag 用于生成错误的，但具有指定 KeyTag 的 DNSKEY RDATA。
-//   - GenKeyWithTag [该函数十分耗时] 用于生成一个具有指定 KeyTag 的 DNSKEY。
+//
+// # keytag.go 文件提供了具有指定 Key Tag 的 DNSKEY 的构造函数。
+//   - GenerateDNSKEYWithTargetTag 调整公钥中的两个字节，解析地求得指定 Key Tag 的 DNSKEY。
+//   - GenerateDNSKEYSetWithTag 批量生成互不相同、且 Key Tag 均为指定值的 DNSKEY。
+//   - GenerateCollidedDNSKEYSet 使用多个协程生成与指定 DNSKEY 冲突的 DNSKEY 记录集合，并按区域缓存。
+//
+// # keyparams.go 文件提供了使用自定义密钥参数生成 DNSKEY 的函数。
+//   - KeyParams 指定 RSA 模数长度、RSA 公钥指数及公钥填充长度。
+//   - GenerateRSAKey 生成任意模数长度及公钥指数的 RSA 私钥。
+//   - GenerateRRDNSKEYWithParams 使用指定的密钥参数生成 DNSKEY。
+//
+// # cot.go 文件提供了信任链的导出函数。
+//   - ExportTrustChain 查询区域层级的 DNSKEY、DS 及 RRSIG，并标注有效、冲突或随机 Key Tag。
+//   - TrustChain.DOT 将信任链导出为 Graphviz DOT 格式，其亦可直接编码为 JSON。
+//
+// # downgrade.go 文件提供了算法降级及未知算法相关的实验辅助函数。
+//   - IsSupportedAlgorithm 检查算法是否可用于生成密钥与签名。
+//   - GenerateUnsupportedRRDNSKEY 生成使用未知或保留算法编号的 DNSKEY。
+//   - GenerateUnsupportedRRRRSIG 生成使用未知或保留算法编号的随机 RRSIG。
+//   - GenerateMismatchedRRRRSIG 生成算法字段与实际签名算法不一致的 RRSIG。
+//   - GenerateMismatchedRRDS 生成算法字段与 DNSKEY 不一致的 DS。
+//
+// # dsmatrix.go 文件提供了 DS 摘要类型矩阵的生成函数。
+//   - DefaultDSMatrix 返回覆盖 SHA-1/256/384 正确及篡改摘要的默认矩阵。
+//   - GenerateDSMatrix 为同一个 KSK 生成 DS 矩阵中的全部 DS 记录。
+//
+// # homograph.go 文件提供了同形异义（homograph）域名的生成函数。
+//   - Confusables 记录拉丁字母及与其外形相近的字符。
+//   - GenerateHomographNames 按顺序生成仅替换一个字符的全部变体。
+//   - GenerateRandomHomographName 随机替换多个字符生成一个变体。
+//
+// # labels.go 文件提供了 RRSIG Labels 字段相关的实验辅助函数。
+//   - WildcardOwnerName 按 Labels 字段重建通配符展开前的原始所有者名称。
+//   - GenerateRRRRSIGWithLabels 生成 Labels 字段为任意值的 RRSIG，可选择以重建的所有者名称或实际所有者名称签名。
+//
+// # malform.go 文件提供了对编码后 DNS 消息进行定点篡改的实验辅助函数。
+//   - Corrupt 依次组合应用多个篡改。
+//   - FlipHeaderBits、FlipBits 翻转头部标志位或任意字节中的位。
+//   - SetCount、SetRDLen 覆写头部计数或资源记录的 RDLEN。
+//   - Truncate 在任意偏移处截断消息。
+//   - RewriteCompressionPointers、LoopCompressionPointers 改写压缩指针。
+//
+// # seed.go 文件提供了随机生成所使用的随机源。
+//   - Seed 设置本次运行的种子，使随机签名、随机摘要、随机字符串及冲突密钥的扰动可以复现。
+//   - RandomIntn、RandomInt63n、RandomFloat64、RandomExpFloat64、RandomShuffle、RandomRead 从当前随机源取得随机数，
+//     xdns 包中的随机选择、随机排序、随机延迟及随机 ID 亦使用该随机源。
+//
+// # stub.go 文件提供了验证存根，可设置为 client.Client 的回复验证器。
+//   - StubValidator 如同验证解析器一样验证回复的签名、信任链及 NSEC/NSEC3 否定应答证明。
+//   - ValidationError 记录导致验证失败的记录。
+//
+// # verify.go 文件提供了 DNSSEC 签名及信任链的验证函数。
+//   - VerifySignature、VerifyRRSIG 使用 DNSKEY 验证签名及 RRSIG。
+//   - VerifyDS 检查 DS 是否与 DNSKEY 相符。
+//   - ChainValidator 验证消息中的签名，并沿 DS 向上追溯至信任锚。
+//
+// # walk.go 文件提供了 NSEC / NSEC3 区域遍历实验辅助函数。
+//   - WalkNSEC 沿 NSEC 链枚举区域中的名称。
+//   - WalkNSEC3 收集区域的 NSEC3 链，并使用字典破解其中的哈希。
 package xperi
@@ -0,0 +1,198 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// downgrade.go 提供了算法降级及未知算法相关的实验用函数，
+// 用于生成使用未知或保留算法编号的 DNSKEY、RRSIG 记录，
+// 以及算法字段与实际签名算法不匹配的 RRSIG、DS 记录。
+
+package xperi
+
+import (
+	"fmt"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 未知算法的默认公钥及签名长度
+const defaultUnsupportedKeySize = 64
+
+// IsSupportedAlgorithm 检查 xperi 是否能够使用指定算法生成密钥与签名
+func IsSupportedAlgorithm(algo dns.DNSSECAlgorithm) bool {
+	switch algo {
+	case dns.DNSSECAlgorithmRSASHA1,
+		dns.DNSSECAlgorithmRSASHA256,
+		dns.DNSSECAlgorithmRSASHA512,
+		dns.DNSSECAlgorithmECDSAP256SHA256,
+		dns.DNSSECAlgorithmECDSAP384SHA384,
+		dns.DNSSECAlgorithmED25519:
+		return true
+	default:
+		return false
+	}
+}
+
+// randomBytes 生成指定长度的随机字节，长度小于等于 0 时使用默认长度
+func randomBytes(length int) []byte {
+	if length <= 0 {
+		length = defaultUnsupportedKeySize
+	}
+	b := make([]byte, length)
+	_, err := RandomRead(b)
+	if err != nil {
+		panic(fmt.Sprintf("function randomBytes() failed:\n%s", err))
+	}
+	return b
+}
+
+// GenerateUnsupportedRDATADNSKEY 生成使用任意算法编号（包括未知及保留编号）的 DNSKEY RDATA，
+// 其公钥为随机字节，不存在对应的私钥。
+// 传入参数：
+//   - algo: DNSSEC 算法编号
+//   - flag: DNSKEY Flag
+//   - keyLen: 公钥长度，小于等于 0 时使用默认长度 64
+//
+// 返回值：
+//   - DNSKEY RDATA
+func GenerateUnsupportedRDATADNSKEY(algo dns.DNSSECAlgorithm, flag dns.DNSKEYFlag, keyLen int) dns.DNSRDATADNSKEY {
+	return dns.DNSRDATADNSKEY{
+		Flags:     flag,
+		Protocol:  3,
+		Algorithm: algo,
+		PublicKey: randomBytes(keyLen),
+	}
+}
+
+// GenerateUnsupportedRRDNSKEY 生成使用任意算法编号的 DNSKEY RR
+// 传入参数：
+//   - zName: 区域名称
+//   - algo: DNSSEC 算法编号
+//   - flag: DNSKEY Flag
+//   - keyLen: 公钥长度，小于等于 0 时使用默认长度 64
+//
+// 返回值：
+//   - DNSKEY RR
+func GenerateUnsupportedRRDNSKEY(zName string, algo dns.DNSSECAlgorithm, flag dns.DNSKEYFlag, keyLen int) dns.DNSResourceRecord {
+	rdata := GenerateUnsupportedRDATADNSKEY(algo, flag, keyLen)
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(zName),
+		Type:  dns.DNSRRTypeDNSKEY,
+		Class: dns.DNSClassIN,
+		TTL:   86400,
+		RDLen: uint16(rdata.Size()),
+		RData: &rdata,
+	}
+}
+
+// GenerateUnsupportedRRRRSIG 生成使用任意算法编号的 RRSIG RR，其签名为随机字节。
+// 不同于 GenerateRandomRRRRSIG，该函数不限制算法编号，
+// 并会使用 RR 集合的 TTL 作为原始 TTL。
+// 传入参数：
+//   - rrSet: 要签名的 RR 集合
+//   - algo: DNSSEC 算法编号
+//   - expiration: 签名过期时间
+//   - inception: 签名生效时间
+//   - keyTag: 签名公钥的 Key Tag
+//   - signerName: 签名者名称
+//   - sigLen: 签名长度，小于等于 0 时使用默认长度 64
+//
+// 返回值：
+//   - RRSIG RR
+func GenerateUnsupportedRRRRSIG(rrSet []dns.DNSResourceRecord, algo dns.DNSSECAlgorithm,
+	expiration, inception uint32, keyTag uint16, signerName string, sigLen int) dns.DNSResourceRecord {
+	rdata := dns.DNSRDATARRSIG{
+		TypeCovered: rrSet[0].Type,
+		Algorithm:   algo,
+		Labels:      uint8(dns.CountDomainNameLabels(&rrSet[0].Name.DomainName)),
+		OriginalTTL: rrSet[0].TTL,
+		Expiration:  expiration,
+		Inception:   inception,
+		KeyTag:      keyTag,
+		SignerName:  signerName,
+		Signature:   randomBytes(sigLen),
+	}
+	return dns.DNSResourceRecord{
+		Name:  rrSet[0].Name,
+		Type:  dns.DNSRRTypeRRSIG,
+		Class: dns.DNSClassIN,
+		TTL:   86400,
+		RDLen: uint16(rdata.Size()),
+		RData: &rdata,
+	}
+}
+
+// GenerateMismatchedRRRRSIG 使用 signAlgo 算法进行签名，但在 RRSIG 中声明为 claimedAlgo 算法，
+// 用于测试解析器是否依据 RRSIG 的算法字段选择验证算法。
+// 注意：RRSIG RDATA 的算法字段本身也是签名内容的一部分，签名时使用的是 claimedAlgo。
+// 传入参数：
+//   - rrSet: 要签名的 RR 集合
+//   - signAlgo: 实际使用的签名算法
+//   - claimedAlgo: RRSIG 中声明的算法
+//   - expiration: 签名过期时间
+//   - inception: 签名生效时间
+//   - keyTag: 签名公钥的 Key Tag
+//   - signerName: 签名者名称
+//   - privKey: 签名私钥的 字节编码
+//
+// 返回值：
+//   - RRSIG RR
+func GenerateMismatchedRRRRSIG(rrSet []dns.DNSResourceRecord, signAlgo, claimedAlgo dns.DNSSECAlgorithm,
+	expiration, inception uint32, keyTag uint16, signerName string, privKey []byte) dns.DNSResourceRecord {
+	rdata := dns.DNSRDATARRSIG{
+		TypeCovered: rrSet[0].Type,
+		Algorithm:   claimedAlgo,
+		Labels:      uint8(dns.CountDomainNameLabels(&rrSet[0].Name.DomainName)),
+		OriginalTTL: rrSet[0].TTL,
+		Expiration:  expiration,
+		Inception:   inception,
+		KeyTag:      keyTag,
+		SignerName:  signerName,
+		Signature:   []byte{},
+	}
+
+	plainLen := rdata.Size()
+	for _, rr := range rrSet {
+		plainLen += rr.Size()
+	}
+	plainText := make([]byte, plainLen)
+	offset, err := rdata.EncodeToBuffer(plainText)
+	if err != nil {
+		panic(fmt.Sprintf("function GenerateMismatchedRRRRSIG() failed:\n%s", err))
+	}
+	for _, rr := range rrSet {
+		increment, err := rr.EncodeToBuffer(plainText[offset:])
+		if err != nil {
+			panic(fmt.Sprintf("function GenerateMismatchedRRRRSIG() failed:\n%s", err))
+		}
+		offset += increment
+	}
+
+	rdata.Signature, err = DNSSECAlgorithmerFactory(signAlgo).Sign(plainText, privKey)
+	if err != nil {
+		panic(fmt.Sprintf("function GenerateMismatchedRRRRSIG() failed:\n%s", err))
+	}
+
+	return dns.DNSResourceRecord{
+		Name:  rrSet[0].Name,
+		Type:  dns.DNSRRTypeRRSIG,
+		Class: dns.DNSClassIN,
+		TTL:   86400,
+		RDLen: uint16(rdata.Size()),
+		RData: &rdata,
+	}
+}
+
+// GenerateMismatchedRRDS 生成摘要正确，但算法字段被替换为 claimedAlgo 的 DS RR，
+// 用于测试解析器是否校验 DS 与 DNSKEY 的算法一致性。
+// 传入参数：
+//   - oName: DNSKEY 的所有者名称
+//   - kRDATA: DNSKEY RDATA
+//   - claimedAlgo: DS 中声明的算法
+//   - dType: 所使用的摘要算法类型
+//
+// 返回值：
+//   - DS RR
+func GenerateMismatchedRRDS(oName string, kRDATA dns.DNSRDATADNSKEY,
+	claimedAlgo dns.DNSSECAlgorithm, dType dns.DNSSECDigestType) dns.DNSResourceRecord {
+	rr := GenerateRRDS(oName, kRDATA, dType)
+	rr.RData.(*dns.DNSRDATADS).Algorithm = claimedAlgo
+	return rr
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// downgrade_test.go 文件定义了对 downgrade.go 的单元测试
+
+package xperi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+var downgradeRRSet = []dns.DNSResourceRecord{
+	{
+		Name:  *dns.NewDNSName("www.example.com"),
+		Type:  dns.DNSRRTypeA,
+		Class: dns.DNSClassIN,
+		TTL:   7200,
+		RData: &dns.DNSRDATAA{Address: dns.IPv4(10, 10, 3, 3)},
+	},
+}
+
+// TestGenerateUnsupportedRRDNSKEY 测试生成未知算法的 DNSKEY 记录
+func TestGenerateUnsupportedRRDNSKEY(t *testing.T) {
+	rr := GenerateUnsupportedRRDNSKEY("example.com", 200, dns.DNSKEYFlagSecureEntryPoint, 0)
+	rdata := rr.RData.(*dns.DNSRDATADNSKEY)
+	if rdata.Algorithm != 200 {
+		t.Errorf("Algorithm not match: %d", rdata.Algorithm)
+	}
+	if len(rdata.PublicKey) != defaultUnsupportedKeySize {
+		t.Errorf("Public key length not match: %d", len(rdata.PublicKey))
+	}
+	if IsSupportedAlgorithm(rdata.Algorithm) {
+		t.Errorf("Algorithm 200 should be unsupported")
+	}
+	if !IsSupportedAlgorithm(dns.DNSSECAlgorithmED25519) {
+		t.Errorf("Algorithm ED25519 should be supported")
+	}
+}
+
+// TestGenerateUnsupportedRRRRSIG 测试生成未知算法的 RRSIG 记录
+func TestGenerateUnsupportedRRRRSIG(t *testing.T) {
+	rr := GenerateUnsupportedRRRRSIG(downgradeRRSet, dns.DNSSECAlgorithmPRIVATEOID, 7200, 3600, 12345, "example.com", 32)
+	rdata := rr.RData.(*dns.DNSRDATARRSIG)
+	if rdata.Algorithm != dns.DNSSECAlgorithmPRIVATEOID || rdata.KeyTag != 12345 {
+		t.Errorf("RRSIG fields not match: %s", rdata.String())
+	}
+	if len(rdata.Signature) != 32 {
+		t.Errorf("Signature length not match: %d", len(rdata.Signature))
+	}
+	if rdata.OriginalTTL != 7200 {
+		t.Errorf("Original TTL not match: %d", rdata.OriginalTTL)
+	}
+}
+
+// TestGenerateMismatchedRRRRSIG 测试生成算法字段不匹配的 RRSIG 记录
+func TestGenerateMismatchedRRRRSIG(t *testing.T) {
+	pubKey, privKey := GenerateRDATADNSKEY(dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagZoneKey)
+	rr := GenerateMismatchedRRRRSIG(downgradeRRSet, dns.DNSSECAlgorithmED25519, dns.DNSSECAlgorithmRSASHA256,
+		7200, 3600, CalculateKeyTag(pubKey), "example.com", privKey)
+	rdata := rr.RData.(*dns.DNSRDATARRSIG)
+	if rdata.Algorithm != dns.DNSSECAlgorithmRSASHA256 {
+		t.Errorf("Algorithm not match: %d", rdata.Algorithm)
+	}
+	if len(rdata.Signature) != 64 {
+		t.Errorf("Signature length not match: %d", len(rdata.Signature))
+	}
+}
+
+// TestGenerateMismatchedRRDS 测试生成算法字段不匹配的 DS 记录
+func TestGenerateMismatchedRRDS(t *testing.T) {
+	pubKey, _ := GenerateRDATADNSKEY(dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagSecureEntryPoint)
+	correct := GenerateRDATADS("example.com", pubKey, dns.DNSSECDigestTypeSHA256)
+	rr := GenerateMismatchedRRDS("example.com", pubKey, dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSSECDigestTypeSHA256)
+	rdata := rr.RData.(*dns.DNSRDATADS)
+	if rdata.Algorithm != dns.DNSSECAlgorithmECDSAP256SHA256 {
+		t.Errorf("Algorithm not match: %d", rdata.Algorithm)
+	}
+	if rdata.KeyTag != correct.KeyTag || !bytes.Equal(rdata.Digest, correct.Digest) {
+		t.Errorf("DS digest should be correct: %s != %s", rdata.String(), correct.String())
+	}
+}
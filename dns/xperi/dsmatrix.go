@@ -0,0 +1,92 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// dsmatrix.go 提供了 DS 摘要类型矩阵的生成函数，
+// 用于为同一个 KSK 生成覆盖多种摘要类型、摘要正确或被篡改的 DS 记录，
+// 以测试解析器对 DS 的选择逻辑及 SHA-1 弃用路径。
+
+package xperi
+
+import (
+	"github.com/tochusc/xdns/dns"
+)
+
+// DSMatrixEntry 表示 DS 矩阵中的一项
+type DSMatrixEntry struct {
+	// 摘要类型，可以是未知的摘要类型编号
+	DigestType dns.DNSSECDigestType
+	// 是否篡改摘要
+	Corrupt bool
+}
+
+// DefaultDSMatrix 返回默认的 DS 矩阵：
+// SHA-1、SHA-256、SHA-384 的正确及篡改摘要，以及给定的未知摘要类型。
+func DefaultDSMatrix(unknownTypes ...dns.DNSSECDigestType) []DSMatrixEntry {
+	entries := []DSMatrixEntry{}
+	for _, dType := range []dns.DNSSECDigestType{
+		dns.DNSSECDigestTypeSHA1,
+		dns.DNSSECDigestTypeSHA256,
+		dns.DNSSECDigestTypeSHA384,
+	} {
+		entries = append(entries,
+			DSMatrixEntry{DigestType: dType, Corrupt: false},
+			DSMatrixEntry{DigestType: dType, Corrupt: true},
+		)
+	}
+	for _, dType := range unknownTypes {
+		entries = append(entries, DSMatrixEntry{DigestType: dType, Corrupt: true})
+	}
+	return entries
+}
+
+// isComputableDigestType 检查是否能够计算指定摘要类型的摘要
+func isComputableDigestType(dType dns.DNSSECDigestType) bool {
+	return dType == dns.DNSSECDigestTypeSHA1 ||
+		dType == dns.DNSSECDigestTypeSHA256 ||
+		dType == dns.DNSSECDigestTypeSHA384
+}
+
+// GenerateDSMatrix 为同一个 KSK 生成 DS 矩阵
+// 对于 SHA-1、SHA-256、SHA-384 摘要类型，未篡改的项将得到正确的摘要，
+// 篡改的项会翻转正确摘要的最后一个字节；
+// 对于其他摘要类型，无法计算其摘要，将使用随机摘要，
+// 其长度为 dns.DigestSizeOf 给出的长度，未知类型则为 32 字节。
+// 传入参数：
+//   - oName: DNSKEY 的所有者名称
+//   - kRDATA: KSK 的 DNSKEY RDATA
+//   - entries: DS 矩阵的各项
+//
+// 返回值：
+//   - DS RR 集合，顺序与 entries 一致
+func GenerateDSMatrix(oName string, kRDATA dns.DNSRDATADNSKEY, entries []DSMatrixEntry) []dns.DNSResourceRecord {
+	keyTag := CalculateKeyTag(kRDATA)
+	rrs := make([]dns.DNSResourceRecord, 0, len(entries))
+	for _, entry := range entries {
+		var rdata dns.DNSRDATADS
+		if isComputableDigestType(entry.DigestType) {
+			rdata = GenerateRDATADS(oName, kRDATA, entry.DigestType)
+			if entry.Corrupt {
+				rdata.Digest[len(rdata.Digest)-1] ^= 0xFF
+			}
+		} else {
+			digestLen := dns.DigestSizeOf(entry.DigestType)
+			if digestLen == 0 {
+				digestLen = 32
+			}
+			rdata = dns.DNSRDATADS{
+				KeyTag:     keyTag,
+				Algorithm:  kRDATA.Algorithm,
+				DigestType: entry.DigestType,
+				Digest:     randomBytes(digestLen),
+			}
+		}
+		rrs = append(rrs, dns.DNSResourceRecord{
+			Name:  *dns.NewDNSName(oName),
+			Type:  dns.DNSRRTypeDS,
+			Class: dns.DNSClassIN,
+			TTL:   86400,
+			RDLen: uint16(rdata.Size()),
+			RData: &rdata,
+		})
+	}
+	return rrs
+}
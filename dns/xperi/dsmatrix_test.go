@@ -0,0 +1,41 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// dsmatrix_test.go 文件定义了对 dsmatrix.go 的单元测试
+
+package xperi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// TestGenerateDSMatrix 测试生成 DS 矩阵
+func TestGenerateDSMatrix(t *testing.T) {
+	ksk, _ := GenerateRDATADNSKEY(dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagSecureEntryPoint)
+	entries := DefaultDSMatrix(200)
+	rrs := GenerateDSMatrix("example.com", ksk, entries)
+	if len(rrs) != len(entries) {
+		t.Fatalf("DS count not match: %d != %d", len(rrs), len(entries))
+	}
+
+	keyTag := CalculateKeyTag(ksk)
+	for i, rr := range rrs {
+		entry := entries[i]
+		ds := rr.RData.(*dns.DNSRDATADS)
+		if ds.DigestType != entry.DigestType || ds.KeyTag != keyTag || ds.Algorithm != ksk.Algorithm {
+			t.Errorf("DS#%d fields not match: %s", i, ds.String())
+		}
+		if !isComputableDigestType(entry.DigestType) {
+			if len(ds.Digest) != 32 {
+				t.Errorf("DS#%d digest length not match: %d", i, len(ds.Digest))
+			}
+			continue
+		}
+		correct := GenerateRDATADS("example.com", ksk, entry.DigestType)
+		if bytes.Equal(ds.Digest, correct.Digest) == entry.Corrupt {
+			t.Errorf("DS#%d digest correctness not match, corrupt: %v", i, entry.Corrupt)
+		}
+	}
+}
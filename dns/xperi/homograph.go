@@ -0,0 +1,109 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// homograph.go 提供了同形异义（homograph）域名的生成函数。
+// 将名称中的拉丁字母替换为外形相近的西里尔字母或希腊字母，生成在视觉上难以区分的国际化域名，
+// 用于研究解析器、浏览器及日志工具对此类名称的处理与展示。
+// 生成的名称经由 dns.NewDNSNameFromUnicode 转换为 ASCII 兼容形式，其 Unicode 形式可经由 Unicode 方法取得。
+
+package xperi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// Confusables 记录拉丁小写字母及与其外形相近的字符，可按需增删
+var Confusables = map[rune][]rune{
+	'a': {'а', 'ɑ'}, // U+0430 CYRILLIC SMALL LETTER A, U+0251 LATIN SMALL LETTER ALPHA
+	'c': {'с', 'ϲ'}, // U+0441 CYRILLIC SMALL LETTER ES, U+03F2 GREEK LUNATE SIGMA SYMBOL
+	'd': {'ԁ'},      // U+0501 CYRILLIC SMALL LETTER KOMI DE
+	'e': {'е'},      // U+0435 CYRILLIC SMALL LETTER IE
+	'h': {'һ'},      // U+04BB CYRILLIC SMALL LETTER SHHA
+	'i': {'і', 'ı'}, // U+0456 CYRILLIC SMALL LETTER BYELORUSSIAN-UKRAINIAN I, U+0131 LATIN SMALL LETTER DOTLESS I
+	'j': {'ј'},      // U+0458 CYRILLIC SMALL LETTER JE
+	'k': {'κ'},      // U+03BA GREEK SMALL LETTER KAPPA
+	'l': {'ӏ'},      // U+04CF CYRILLIC SMALL LETTER PALOCHKA
+	'n': {'ո'},      // U+0578 ARMENIAN SMALL LETTER VO
+	'o': {'о', 'ο'}, // U+043E CYRILLIC SMALL LETTER O, U+03BF GREEK SMALL LETTER OMICRON
+	'p': {'р'},      // U+0440 CYRILLIC SMALL LETTER ER
+	'q': {'ԛ'},      // U+051B CYRILLIC SMALL LETTER QA
+	's': {'ѕ'},      // U+0455 CYRILLIC SMALL LETTER DZE
+	'u': {'υ'},      // U+03C5 GREEK SMALL LETTER UPSILON
+	'v': {'ν'},      // U+03BD GREEK SMALL LETTER NU
+	'w': {'ԝ'},      // U+051D CYRILLIC SMALL LETTER WE
+	'x': {'х'},      // U+0445 CYRILLIC SMALL LETTER HA
+	'y': {'у'},      // U+0443 CYRILLIC SMALL LETTER U
+}
+
+// splitFirstLabel 将名称拆分为最左侧标签及其余部分（含前导 '.'）
+func splitFirstLabel(name string) ([]rune, string) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return []rune(name[:i]), name[i:]
+	}
+	return []rune(name), ""
+}
+
+// GenerateHomographNames 生成名称的同形异义变体，每个变体仅替换最左侧标签中的一个字符
+// 传入参数：
+//   - name: 原始名称，如 "paypal.example"
+//   - limit: 变体的最大数量，不大于 0 时返回全部变体
+//
+// 返回值：
+//   - 按替换位置及 Confusables 中的顺序排列的变体，以 ASCII 兼容形式表示
+//   - 错误信息，变体无法编码时返回
+func GenerateHomographNames(name string, limit int) ([]dns.DNSName, error) {
+	label, rest := splitFirstLabel(name)
+	names := []dns.DNSName{}
+	for i, r := range label {
+		for _, c := range Confusables[r] {
+			if limit > 0 && len(names) >= limit {
+				return names, nil
+			}
+			variant := append([]rune{}, label...)
+			variant[i] = c
+			dn, err := dns.NewDNSNameFromUnicode(string(variant) + rest)
+			if err != nil {
+				return nil, fmt.Errorf("function GenerateHomographNames failed:\n%v", err)
+			}
+			names = append(names, *dn)
+		}
+	}
+	return names, nil
+}
+
+// GenerateRandomHomographName 随机生成名称的一个同形异义变体，
+// 最左侧标签中每个可替换的字符均以 1/2 的概率被替换，且至少替换一个字符
+// 传入参数：
+//   - name: 原始名称
+//
+// 返回值：
+//   - 以 ASCII 兼容形式表示的变体
+//   - 错误信息，最左侧标签中不含可替换的字符或变体无法编码时返回
+func GenerateRandomHomographName(name string) (dns.DNSName, error) {
+	label, rest := splitFirstLabel(name)
+	positions := []int{}
+	for i, r := range label {
+		if len(Confusables[r]) > 0 {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) == 0 {
+		return dns.DNSName{}, fmt.Errorf("function GenerateRandomHomographName failed: %s has no confusable characters", name)
+	}
+
+	variant := append([]rune{}, label...)
+	forced := positions[RandomIntn(len(positions))]
+	for _, i := range positions {
+		if i == forced || RandomIntn(2) == 0 {
+			choices := Confusables[label[i]]
+			variant[i] = choices[RandomIntn(len(choices))]
+		}
+	}
+	dn, err := dns.NewDNSNameFromUnicode(string(variant) + rest)
+	if err != nil {
+		return dns.DNSName{}, fmt.Errorf("function GenerateRandomHomographName failed:\n%v", err)
+	}
+	return *dn, nil
+}
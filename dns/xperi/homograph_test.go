@@ -0,0 +1,64 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// homograph_test.go 文件定义了对 homograph.go 的单元测试
+
+package xperi
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGenerateHomographNames 测试生成同形异义变体
+func TestGenerateHomographNames(t *testing.T) {
+	names, err := GenerateHomographNames("paypal.example", 0)
+	if err != nil {
+		t.Fatalf("function GenerateHomographNames() failed:\n%s", err)
+	}
+	// p、a、y、p、a 可替换，l 亦可替换：1+2+1+1+2+1
+	if len(names) != 8 {
+		t.Fatalf("function GenerateHomographNames() failed: got %d variants", len(names))
+	}
+	if names[0].Unicode() != "\u0440aypal.example" || names[0].DomainName != "xn--aypal-uye.example" {
+		t.Errorf("function GenerateHomographNames() failed: got %s", names[0].IDNString())
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !strings.HasPrefix(name.DomainName, "xn--") || !strings.HasSuffix(name.DomainName, ".example") {
+			t.Errorf("function GenerateHomographNames() failed: got %s", name.DomainName)
+		}
+		if seen[name.DomainName] {
+			t.Errorf("function GenerateHomographNames() failed: duplicated %s", name.DomainName)
+		}
+		seen[name.DomainName] = true
+	}
+
+	limited, _ := GenerateHomographNames("paypal.example", 3)
+	if len(limited) != 3 {
+		t.Errorf("function GenerateHomographNames() failed: got %d variants with limit 3", len(limited))
+	}
+	if none, _ := GenerateHomographNames("123.example", 0); len(none) != 0 {
+		t.Errorf("function GenerateHomographNames() failed: got %d variants for 123.example", len(none))
+	}
+}
+
+// TestGenerateRandomHomographName 测试随机生成同形异义变体
+func TestGenerateRandomHomographName(t *testing.T) {
+	defer Unseed()
+	Seed(7)
+	first, err := GenerateRandomHomographName("google.com")
+	if err != nil {
+		t.Fatalf("function GenerateRandomHomographName() failed:\n%s", err)
+	}
+	unicode := first.Unicode()
+	if unicode == "google.com" || !strings.HasSuffix(unicode, ".com") || len([]rune(unicode)) != len("google.com") {
+		t.Errorf("function GenerateRandomHomographName() failed: got %s", first.IDNString())
+	}
+	Seed(7)
+	if again, _ := GenerateRandomHomographName("google.com"); again.DomainName != first.DomainName {
+		t.Errorf("function GenerateRandomHomographName() failed: seeded result %s differs from %s", again.DomainName, first.DomainName)
+	}
+	if _, err := GenerateRandomHomographName("123.example"); err == nil {
+		t.Errorf("function GenerateRandomHomographName() failed: expected an error for 123.example")
+	}
+}
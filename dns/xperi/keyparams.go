@@ -0,0 +1,196 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// keyparams.go 文件提供了使用自定义密钥参数生成 DNSKEY 的函数。
+// 通过 KeyParams 可以指定 RSA 模数长度、RSA 公钥指数，以及追加在公钥末尾的填充长度，
+// 以在不同的公钥大小下研究每字节查询所能得到的放大倍数，而不局限于 ECDSA-P384。
+
+package xperi
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// DefaultRSABits 是未指定时使用的 RSA 模数长度（比特）
+const DefaultRSABits = dns.DefaultRSABits
+
+// DefaultRSAExponent 是未指定时使用的 RSA 公钥指数
+const DefaultRSAExponent = dns.DefaultRSAExponent
+
+// KeyParams 记录生成 DNSKEY 时使用的密钥参数，其零值即默认参数
+type KeyParams struct {
+	// RSA 模数长度（比特），如 1024、2048、4096，0 表示 DefaultRSABits
+	RSABits int `json:"rsa_bits"`
+	// RSA 公钥指数，必须为大于 1 的奇数，0 表示 DefaultRSAExponent
+	RSAExponent int `json:"rsa_exponent"`
+	// 追加在公钥末尾的零字节数量，用于在不改变算法的情况下增大 DNSKEY。
+	// 填充后的公钥无法被解析器用于验证签名。
+	Padding int `json:"padding"`
+}
+
+// rsaParams 返回填充默认值后的 RSA 模数长度及公钥指数
+func (p KeyParams) rsaParams() (int, int) {
+	bits, exponent := p.RSABits, p.RSAExponent
+	if bits <= 0 {
+		bits = DefaultRSABits
+	}
+	if exponent == 0 {
+		exponent = DefaultRSAExponent
+	}
+	return bits, exponent
+}
+
+// isRSA 检查算法是否为 RSA 系列算法
+func isRSA(algo dns.DNSSECAlgorithm) bool {
+	switch algo {
+	case dns.DNSSECAlgorithmRSASHA1, dns.DNSSECAlgorithmRSASHA1NSEC3, dns.DNSSECAlgorithmRSASHA256, dns.DNSSECAlgorithmRSASHA512:
+		return true
+	default:
+		return false
+	}
+}
+
+// PublicKeySize 返回使用该参数及指定算法生成的 DNSKEY 公钥长度（字节），包括填充
+func (p KeyParams) PublicKeySize(algo dns.DNSSECAlgorithm) int {
+	if isRSA(algo) {
+		bits, exponent := p.rsaParams()
+		return dns.RSAPublicKeySize(bits, exponent) + p.Padding
+	}
+	return dns.PublicKeySizeOf(algo) + p.Padding
+}
+
+// SignatureSize 返回使用该参数生成的密钥及指定算法所得的 RRSIG 签名长度（字节）
+func (p KeyParams) SignatureSize(algo dns.DNSSECAlgorithm) int {
+	if isRSA(algo) {
+		bits, _ := p.rsaParams()
+		return dns.RSASignatureSize(bits)
+	}
+	return dns.SignatureSizeOf(algo)
+}
+
+// GenerateRSAKey 生成指定模数长度及公钥指数的 RSA 私钥
+// 传入参数：
+//   - bits: 模数长度（比特）
+//   - exponent: 公钥指数，必须为大于 1 的奇数
+//
+// 返回值：
+//   - RSA 私钥
+//   - 错误信息
+func GenerateRSAKey(bits, exponent int) (*rsa.PrivateKey, error) {
+	if exponent == DefaultRSAExponent {
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+	if exponent < 3 || exponent%2 == 0 {
+		return nil, fmt.Errorf("function GenerateRSAKey failed: invalid exponent %d", exponent)
+	}
+	if bits < 64 {
+		return nil, fmt.Errorf("function GenerateRSAKey failed: modulus length %d is too short", bits)
+	}
+
+	e := big.NewInt(int64(exponent))
+	one := big.NewInt(1)
+	for {
+		p, err := rand.Prime(rand.Reader, bits/2)
+		if err != nil {
+			return nil, fmt.Errorf("function GenerateRSAKey failed: generate prime failed.\n%v", err)
+		}
+		q, err := rand.Prime(rand.Reader, bits-bits/2)
+		if err != nil {
+			return nil, fmt.Errorf("function GenerateRSAKey failed: generate prime failed.\n%v", err)
+		}
+		n := new(big.Int).Mul(p, q)
+		if p.Cmp(q) == 0 || n.BitLen() != bits {
+			continue
+		}
+
+		// 公钥指数须与 (p-1)(q-1) 互素，否则重新选取素数
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: exponent},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err := key.Validate(); err != nil {
+			continue
+		}
+		key.Precompute()
+		return key, nil
+	}
+}
+
+// generateRSAKeyPair 生成 RSA 密钥对，返回 PKCS #1 私钥字节及 PKIX 公钥字节
+func generateRSAKeyPair(params KeyParams) ([]byte, []byte) {
+	bits, exponent := params.rsaParams()
+	privKey, err := GenerateRSAKey(bits, exponent)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate RSA key: %s", err))
+	}
+
+	privKeyBytes := x509.MarshalPKCS1PrivateKey(privKey)
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal public key: %s", err))
+	}
+
+	return privKeyBytes, pubKeyBytes
+}
+
+// GenerateRDATADNSKEYWithParams 使用指定的密钥参数生成公钥的 DNSKEY RDATA, 并返回私钥字节
+// 传入参数：
+//   - algo: DNSSEC 算法
+//   - flag: DNSKEY Flag
+//   - params: 密钥参数，RSA 参数仅对 RSA 系列算法生效
+//
+// 返回值：
+//   - 公钥 DNSKEY RDATA
+//   - 私钥字节
+func GenerateRDATADNSKEYWithParams(algo dns.DNSSECAlgorithm, flag dns.DNSKEYFlag, params KeyParams) (dns.DNSRDATADNSKEY, []byte) {
+	var privKey, pubKey []byte
+	if isRSA(algo) {
+		privKey, pubKey = generateRSAKeyPair(params)
+	} else {
+		privKey, pubKey = DNSSECAlgorithmerFactory(algo).GenerateKey()
+	}
+	if params.Padding > 0 {
+		pubKey = append(pubKey, make([]byte, params.Padding)...)
+	}
+	return dns.DNSRDATADNSKEY{
+		Flags:     flag,
+		Protocol:  3,
+		Algorithm: algo,
+		PublicKey: pubKey,
+	}, privKey
+}
+
+// GenerateRRDNSKEYWithParams 使用指定的密钥参数生成 DNSKEY RR，并返回私钥字节
+// 传入参数：
+//   - zName: 区域名
+//   - algo: DNSSEC 算法
+//   - flag: DNSKEY Flag
+//   - params: 密钥参数
+//
+// 返回值：
+//   - DNSKEY RR
+//   - 私钥字节
+func GenerateRRDNSKEYWithParams(
+	zName string, algo dns.DNSSECAlgorithm, flag dns.DNSKEYFlag, params KeyParams) (dns.DNSResourceRecord, []byte) {
+	rdata, privKey := GenerateRDATADNSKEYWithParams(algo, flag, params)
+	rr := dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(zName),
+		Type:  dns.DNSRRTypeDNSKEY,
+		Class: dns.DNSClassIN,
+		TTL:   86400,
+		RDLen: uint16(rdata.Size()),
+		RData: &rdata,
+	}
+	return rr, privKey
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// keyparams_test.go 文件定义了对 keyparams.go 的单元测试
+
+package xperi
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+func TestGenerateRSAKey(t *testing.T) {
+	key, err := GenerateRSAKey(1024, 3)
+	if err != nil {
+		t.Fatalf("function GenerateRSAKey() failed:\n%s", err)
+	}
+	if key.N.BitLen() != 1024 || key.E != 3 {
+		t.Errorf("function GenerateRSAKey() failed: got %d bits, exponent %d", key.N.BitLen(), key.E)
+	}
+
+	for _, exponent := range []int{-3, 1, 4} {
+		if _, err := GenerateRSAKey(1024, exponent); err == nil {
+			t.Errorf("function GenerateRSAKey() failed: expected an error for exponent %d", exponent)
+		}
+	}
+}
+
+func TestGenerateRDATADNSKEYWithParams(t *testing.T) {
+	params := KeyParams{RSABits: 1024, RSAExponent: 3, Padding: 100}
+	rdata, privKey := GenerateRDATADNSKEYWithParams(dns.DNSSECAlgorithmRSASHA256, dns.DNSKEYFlagZoneKey, params)
+
+	// 去除填充后即为 PKIX 编码的公钥
+	pub, err := x509.ParsePKIXPublicKey(rdata.PublicKey[:len(rdata.PublicKey)-params.Padding])
+	if err != nil {
+		t.Fatalf("function GenerateRDATADNSKEYWithParams() failed: parse public key failed.\n%s", err)
+	}
+	rsaPub := pub.(*rsa.PublicKey)
+	if rsaPub.N.BitLen() != 1024 || rsaPub.E != 3 {
+		t.Errorf("function GenerateRDATADNSKEYWithParams() failed: got %d bits, exponent %d", rsaPub.N.BitLen(), rsaPub.E)
+	}
+
+	// 私钥可用于签名，签名可由公钥验证
+	data := []byte("xdns")
+	sig, err := RSASHA256{}.Sign(data, privKey)
+	if err != nil {
+		t.Fatalf("method RSASHA256 Sign() failed:\n%s", err)
+	}
+	digest := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("function GenerateRDATADNSKEYWithParams() failed: verify signature failed.\n%s", err)
+	}
+
+	edKey, _ := GenerateRDATADNSKEYWithParams(dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagZoneKey, KeyParams{Padding: 32})
+	if len(edKey.PublicKey) != 32+32 {
+		t.Errorf("function GenerateRDATADNSKEYWithParams() failed: got public key length %d", len(edKey.PublicKey))
+	}
+}
+
+func TestKeyParamsSize(t *testing.T) {
+	for _, params := range []KeyParams{
+		{},
+		{RSABits: 1024, RSAExponent: 3},
+		{RSABits: 1000, RSAExponent: 65539, Padding: 7},
+	} {
+		rdata, privKey := GenerateRDATADNSKEYWithParams(dns.DNSSECAlgorithmRSASHA256, dns.DNSKEYFlagZoneKey, params)
+		if len(rdata.PublicKey) != params.PublicKeySize(dns.DNSSECAlgorithmRSASHA256) {
+			t.Errorf("method KeyParams PublicKeySize() failed: %+v, want %d, got %d",
+				params, len(rdata.PublicKey), params.PublicKeySize(dns.DNSSECAlgorithmRSASHA256))
+		}
+		sig, err := RSASHA256{}.Sign([]byte("xdns"), privKey)
+		if err != nil {
+			t.Fatalf("method RSASHA256 Sign() failed:\n%s", err)
+		}
+		if len(sig) != params.SignatureSize(dns.DNSSECAlgorithmRSASHA256) {
+			t.Errorf("method KeyParams SignatureSize() failed: %+v, want %d, got %d",
+				params, len(sig), params.SignatureSize(dns.DNSSECAlgorithmRSASHA256))
+		}
+	}
+
+	// ECDSA 公钥及签名为定长编码
+	for _, algo := range []dns.DNSSECAlgorithm{dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSSECAlgorithmECDSAP384SHA384, dns.DNSSECAlgorithmED25519} {
+		algorithmer := DNSSECAlgorithmerFactory(algo)
+		for i := 0; i < 200; i++ {
+			privKey, pubKey := algorithmer.GenerateKey()
+			sig, err := algorithmer.Sign([]byte{byte(i)}, privKey)
+			if err != nil {
+				t.Fatalf("method Sign() failed:\n%s", err)
+			}
+			if len(pubKey) != dns.PublicKeySizeOf(algo) || len(sig) != dns.SignatureSizeOf(algo) {
+				t.Fatalf("algorithm %d: got public key length %d, signature length %d", algo, len(pubKey), len(sig))
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// keytag.go 文件提供了具有指定 Key Tag 的 DNSKEY 的构造函数。
+// Key Tag 是 DNSKEY RDATA 按 16 位字求和并折叠一次进位的校验和（RFC 4034 附录 B），
+// 因此只需调整公钥中对齐的两个字节，即可解析地求出目标 Key Tag，而无需反复生成密钥并比较。
+// 构造出的公钥并非合法的公钥，仅用于制造 Key Tag 冲突。
+// GenerateCollidedDNSKEYSet 则使用多个协程批量生成冲突的 DNSKEY 记录，并缓存生成结果，
+// 使得每个查询都需要数百个冲突密钥的实验不必在每次回复时重新生成。
+
+package xperi
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// keyTagSum 返回 DNSKEY RDATA 折叠进位前的校验和
+func keyTagSum(wire []byte) uint32 {
+	var ac uint32
+	for i := 0; i < len(wire); i++ {
+		if i&1 == 1 {
+			ac += uint32(wire[i])
+		} else {
+			ac += uint32(wire[i]) << 8
+		}
+	}
+	return ac
+}
+
+// foldKeyTag 折叠校验和的进位，得到 Key Tag
+func foldKeyTag(ac uint32) uint16 {
+	ac += ac >> 16 & 0xFFFF
+	return uint16(ac & 0xFFFF)
+}
+
+// solveKeyTagWord 改写 RDATA 中 pos 处的 16 位字，使 RDATA 的 Key Tag 等于 tag
+// 其接受参数为：
+//   - wire []byte，DNSKEY RDATA 的线格式
+//   - pos int，被改写的字的偏移，必须为偶数
+//   - tag uint16，目标 Key Tag
+//
+// 返回值为：
+//   - bool，是否求解成功。对每个位置，至多有一个 Key Tag 无法求得
+func solveKeyTagWord(wire []byte, pos int, tag uint16) bool {
+	rest := keyTagSum(wire) - (uint32(wire[pos])<<8 | uint32(wire[pos+1]))
+	// 新的校验和 x 位于 [rest, rest+0xFFFF]，其高 16 位至多有两种取值
+	for high := rest >> 16; high <= rest>>16+1; high++ {
+		x := high<<16 | uint32(tag-uint16(high))
+		if x < rest || x-rest > 0xFFFF || foldKeyTag(x) != tag {
+			continue
+		}
+		word := x - rest
+		wire[pos], wire[pos+1] = byte(word>>8), byte(word)
+		return true
+	}
+	return false
+}
+
+// keyWordPositions 返回公钥中对齐的 16 位字在 RDATA 中的偏移
+func keyWordPositions(rdata dns.DNSRDATADNSKEY) []int {
+	positions := []int{}
+	for pos := 4; pos+1 < 4+len(rdata.PublicKey); pos += 2 {
+		positions = append(positions, pos)
+	}
+	return positions
+}
+
+// GenerateDNSKEYWithTargetTag 调整公钥中的两个字节，生成一个 Key Tag 为 tag 的 DNSKEY RDATA
+// 传入参数：
+//   - rdata: 作为基础的 DNSKEY RDATA
+//   - tag: 目标 Key Tag
+//
+// 返回值：
+//   - 你想要的 DNSKEY RDATA，基础 DNSKEY 的 Key Tag 已为 tag 时，可能与其相同
+func GenerateDNSKEYWithTargetTag(rdata dns.DNSRDATADNSKEY, tag uint16) dns.DNSRDATADNSKEY {
+	positions := keyWordPositions(rdata)
+	if len(positions) == 0 {
+		panic(fmt.Sprintf("function GenerateDNSKEYWithTargetTag() failed: public key length %d is less than 2", len(rdata.PublicKey)))
+	}
+
+	wire := rdata.Encode()
+	start := RandomIntn(len(positions))
+	for i := range positions {
+		if solveKeyTagWord(wire, positions[(start+i)%len(positions)], tag) {
+			break
+		}
+	}
+	return dns.DNSRDATADNSKEY{
+		Flags:     rdata.Flags,
+		Protocol:  rdata.Protocol,
+		Algorithm: rdata.Algorithm,
+		PublicKey: wire[4:],
+	}
+}
+
+// GenerateDNSKEYSetWithTag 生成 n 个互不相同、且与基础 DNSKEY 不同的 DNSKEY RDATA，其 Key Tag 均为 tag。
+// 每个 DNSKEY 先随机改写公钥中的一个 16 位字，再改写另一个字以求得目标 Key Tag。
+// 传入参数：
+//   - rdata: 作为基础的 DNSKEY RDATA，公钥长度至少为 4 字节
+//   - tag: 目标 Key Tag
+//   - n: 生成的数量
+//
+// 返回值：
+//   - 你想要的 DNSKEY RDATA 集合
+func GenerateDNSKEYSetWithTag(rdata dns.DNSRDATADNSKEY, tag uint16, n int) []dns.DNSRDATADNSKEY {
+	positions := keyWordPositions(rdata)
+	if len(positions) < 2 {
+		panic(fmt.Sprintf("function GenerateDNSKEYSetWithTag() failed: public key length %d is less than 4", len(rdata.PublicKey)))
+	}
+
+	keys := make([]dns.DNSRDATADNSKEY, 0, n)
+	seen := map[string]bool{string(rdata.PublicKey): true}
+	base := rdata.Encode()
+	for len(keys) < n {
+		wire := make([]byte, len(base))
+		copy(wire, base)
+
+		// 随机改写一个字，再在另一位置求解目标 Key Tag
+		random := RandomIntn(len(positions))
+		word := RandomIntn(0x10000)
+		wire[positions[random]], wire[positions[random]+1] = byte(word>>8), byte(word)
+		solve := (random + 1 + RandomIntn(len(positions)-1)) % len(positions)
+		if !solveKeyTagWord(wire, positions[solve], tag) || seen[string(wire[4:])] {
+			continue
+		}
+		seen[string(wire[4:])] = true
+		keys = append(keys, dns.DNSRDATADNSKEY{
+			Flags:     rdata.Flags,
+			Protocol:  rdata.Protocol,
+			Algorithm: rdata.Algorithm,
+			PublicKey: wire[4:],
+		})
+	}
+	return keys
+}
+
+// maxCollidedSets 是冲突 DNSKEY 集合缓存的条目数量上限，超出时清空，以免内存无限增长
+const maxCollidedSets = 1024
+
+var (
+	collidedMu sync.Mutex
+	// 区域、Key Tag 及数量与冲突 DNSKEY 集合的映射
+	collidedSets = map[string][]dns.DNSResourceRecord{}
+)
+
+// GenerateCollidedDNSKEYSet 生成 n 个与 base 的 Key Tag 相同、公钥互不相同的 DNSKEY RR，
+// 其名称、类型及 TTL 与 base 相同。
+// 结果按 (区域, Key Tag, n) 缓存，相同参数的调用返回同一组 DNSKEY，调用者不应修改返回记录的 RDATA。
+// 设置种子时串行生成，以保证生成结果可以复现。
+// 传入参数：
+//   - base: 作为基础的 DNSKEY RR
+//   - n: 生成的数量
+//
+// 返回值：
+//   - 你想要的 DNSKEY RR 集合
+func GenerateCollidedDNSKEYSet(base dns.DNSResourceRecord, n int) []dns.DNSResourceRecord {
+	if n <= 0 {
+		return []dns.DNSResourceRecord{}
+	}
+	rdata, ok := base.RData.(*dns.DNSRDATADNSKEY)
+	if !ok {
+		panic(fmt.Sprintf("function GenerateCollidedDNSKEYSet() failed: base record type %s is not DNSKEY", base.Type))
+	}
+	tag := CalculateKeyTag(*rdata)
+	key := fmt.Sprintf("%s|%d|%d|%d|%d", strings.ToLower(base.Name.DomainName), tag, n, rdata.Algorithm, rdata.Flags)
+
+	collidedMu.Lock()
+	set, ok := collidedSets[key]
+	collidedMu.Unlock()
+	if ok {
+		return append([]dns.DNSResourceRecord{}, set...)
+	}
+
+	keys := generateCollidedKeys(*rdata, tag, n)
+	set = make([]dns.DNSResourceRecord, n)
+	for i := range keys {
+		set[i] = dns.DNSResourceRecord{
+			Name:  base.Name,
+			Type:  dns.DNSRRTypeDNSKEY,
+			Class: base.Class,
+			TTL:   base.TTL,
+			RDLen: uint16(keys[i].Size()),
+			RData: &keys[i],
+		}
+	}
+
+	collidedMu.Lock()
+	if len(collidedSets) >= maxCollidedSets {
+		collidedSets = map[string][]dns.DNSResourceRecord{}
+	}
+	collidedSets[key] = set
+	collidedMu.Unlock()
+	return append([]dns.DNSResourceRecord{}, set...)
+}
+
+// ResetCollidedDNSKEYSets 清空 GenerateCollidedDNSKEYSet 的缓存，之后的调用将重新生成冲突 DNSKEY
+func ResetCollidedDNSKEYSets() {
+	collidedMu.Lock()
+	defer collidedMu.Unlock()
+	collidedSets = map[string][]dns.DNSResourceRecord{}
+}
+
+// generateCollidedKeys 将生成任务分配给多个协程，生成 n 个 Key Tag 为 tag 的 DNSKEY RDATA
+func generateCollidedKeys(rdata dns.DNSRDATADNSKEY, tag uint16, n int) []dns.DNSRDATADNSKEY {
+	workers := runtime.NumCPU()
+	if _, seeded := Seeded(); seeded {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		return GenerateDNSKEYSetWithTag(rdata, tag, n)
+	}
+
+	parts := make([][]dns.DNSRDATADNSKEY, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		share := n / workers
+		if w < n%workers {
+			share++
+		}
+		wg.Add(1)
+		go func(w, share int) {
+			defer wg.Done()
+			parts[w] = GenerateDNSKEYSetWithTag(rdata, tag, share)
+		}(w, share)
+	}
+	wg.Wait()
+
+	// 合并各协程的结果，去除协程之间偶然重复的公钥后补足数量
+	keys := make([]dns.DNSRDATADNSKEY, 0, n)
+	seen := map[string]bool{}
+	for len(keys) < n {
+		for _, part := range parts {
+			for _, key := range part {
+				if !seen[string(key.PublicKey)] && len(keys) < n {
+					seen[string(key.PublicKey)] = true
+					keys = append(keys, key)
+				}
+			}
+		}
+		parts = [][]dns.DNSRDATADNSKEY{GenerateDNSKEYSetWithTag(rdata, tag, n-len(keys))}
+	}
+	return keys
+}
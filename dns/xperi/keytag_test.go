@@ -0,0 +1,91 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// keytag_test.go 文件定义了对 keytag.go 的单元测试
+
+package xperi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+func TestGenerateDNSKEYWithTargetTag(t *testing.T) {
+	key, _ := GenerateRDATADNSKEY(dns.DNSSECAlgorithmECDSAP384SHA384, dns.DNSKEYFlagSecureEntryPoint)
+	for tag := 0; tag <= 0xFFFF; tag++ {
+		wKey := GenerateDNSKEYWithTargetTag(key, uint16(tag))
+		if CalculateKeyTag(wKey) != uint16(tag) {
+			t.Fatalf("function GenerateDNSKEYWithTargetTag() failed: want tag %d, got %d", tag, CalculateKeyTag(wKey))
+		}
+		if len(wKey.PublicKey) != len(key.PublicKey) || wKey.Flags != key.Flags || wKey.Algorithm != key.Algorithm {
+			t.Fatalf("function GenerateDNSKEYWithTargetTag() failed: got %v", wKey)
+		}
+	}
+}
+
+func TestGenerateDNSKEYSetWithTag(t *testing.T) {
+	// 奇数长度的公钥，最后一个字节不参与求解
+	key := dns.DNSRDATADNSKEY{
+		Flags:     dns.DNSKEYFlagZoneKey,
+		Protocol:  dns.DNSKEYProtocolValue,
+		Algorithm: dns.DNSSECAlgorithmRSASHA256,
+		PublicKey: []byte{0xff, 0xff, 0xff, 0xff, 0x01},
+	}
+	keys := GenerateDNSKEYSetWithTag(key, 12345, 256)
+	if len(keys) != 256 {
+		t.Fatalf("function GenerateDNSKEYSetWithTag() failed: got %d keys", len(keys))
+	}
+	seen := map[string]bool{}
+	for _, wKey := range keys {
+		if CalculateKeyTag(wKey) != 12345 {
+			t.Errorf("function GenerateDNSKEYSetWithTag() failed: got tag %d", CalculateKeyTag(wKey))
+		}
+		if bytes.Equal(wKey.PublicKey, key.PublicKey) || seen[string(wKey.PublicKey)] {
+			t.Errorf("function GenerateDNSKEYSetWithTag() failed: duplicated key %x", wKey.PublicKey)
+		}
+		seen[string(wKey.PublicKey)] = true
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("function GenerateDNSKEYSetWithTag() failed: expected a panic for a short public key")
+		}
+	}()
+	GenerateDNSKEYSetWithTag(dns.DNSRDATADNSKEY{PublicKey: []byte{1, 2, 3}}, 1, 1)
+}
+
+func TestGenerateCollidedDNSKEYSet(t *testing.T) {
+	defer ResetCollidedDNSKEYSets()
+
+	base, _ := GenerateRRDNSKEY("test", dns.DNSSECAlgorithmECDSAP384SHA384, dns.DNSKEYFlagSecureEntryPoint)
+	tag := CalculateKeyTag(*base.RData.(*dns.DNSRDATADNSKEY))
+	set := GenerateCollidedDNSKEYSet(base, 500)
+	if len(set) != 500 {
+		t.Fatalf("function GenerateCollidedDNSKEYSet() failed: got %d keys", len(set))
+	}
+	seen := map[string]bool{}
+	for _, rr := range set {
+		key := rr.RData.(*dns.DNSRDATADNSKEY)
+		if rr.Name.DomainName != "test" || rr.Type != dns.DNSRRTypeDNSKEY || CalculateKeyTag(*key) != tag {
+			t.Fatalf("function GenerateCollidedDNSKEYSet() failed: got %s", rr.String())
+		}
+		if seen[string(key.PublicKey)] {
+			t.Fatalf("function GenerateCollidedDNSKEYSet() failed: duplicated key %x", key.PublicKey)
+		}
+		seen[string(key.PublicKey)] = true
+	}
+
+	// 相同参数的调用返回缓存的集合
+	cached := GenerateCollidedDNSKEYSet(base, 500)
+	if cached[0].RData != set[0].RData {
+		t.Error("function GenerateCollidedDNSKEYSet() failed: expected the cached set")
+	}
+	ResetCollidedDNSKEYSets()
+	if fresh := GenerateCollidedDNSKEYSet(base, 500); fresh[0].RData == set[0].RData {
+		t.Error("function ResetCollidedDNSKEYSets() failed: expected a new set")
+	}
+	if len(GenerateCollidedDNSKEYSet(base, 0)) != 0 {
+		t.Error("function GenerateCollidedDNSKEYSet() failed: expected an empty set")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// labels.go 提供了 RRSIG Labels 字段相关的实验用函数。
+// 验证者依据 Labels 字段判断回答是否由通配符展开而来（RFC 4035 5.3.2 节）：
+// Labels 小于所有者名称的标签数时，以 "*." 加上所有者名称最右侧 Labels 个标签重建原始所有者名称后再验证签名；
+// Labels 大于所有者名称的标签数时，RRSIG 应被视为无效。
+// 通过修改 Labels 字段，可以测试解析器对通配符展开声明的处理及原始所有者名称的重建。
+
+package xperi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// OwnerLabelCount 返回所有者名称计入 RRSIG Labels 字段的标签数，根域名为 0
+func OwnerLabelCount(owner string) int {
+	if owner == "" || owner == "." {
+		return 0
+	}
+	return dns.CountDomainNameLabels(&owner)
+}
+
+// WildcardOwnerName 按 RRSIG 的 Labels 字段重建签名时的原始所有者名称（RFC 4035 5.3.2 节）
+// 传入参数：
+//   - owner: RRset 的所有者名称
+//   - labels: RRSIG 的 Labels 字段
+//
+// 返回值：
+//   - Labels 小于所有者名称的标签数时，返回 "*." 加上最右侧 labels 个标签，否则返回 owner
+func WildcardOwnerName(owner string, labels uint8) string {
+	count := OwnerLabelCount(owner)
+	if int(labels) >= count {
+		return owner
+	}
+	parts := strings.Split(strings.TrimSuffix(owner, "."), ".")
+	if labels == 0 {
+		return "*"
+	}
+	return "*." + strings.Join(parts[count-int(labels):], ".")
+}
+
+// GenerateRDATARRSIGWithLabels 生成 Labels 字段为指定值的 RRSIG RDATA
+// 传入参数：
+//   - rrSet: 要签名的 RR 集合
+//   - algo: 签名算法
+//   - expiration: 签名过期时间
+//   - inception: 签名生效时间
+//   - keyTag: 签名公钥的 Key Tag
+//   - signerName: 签名者名称
+//   - privKey: 签名私钥的 字节编码
+//   - labels: RRSIG 中的 Labels 字段
+//   - reconstruct: 为 true 时以 WildcardOwnerName 重建的所有者名称签名，
+//     即声明一个签名有效的通配符展开；为 false 时以实际所有者名称签名，
+//     只有不重建所有者名称的验证者才会接受该签名
+//
+// 返回值：
+//   - RRSIG RDATA
+func GenerateRDATARRSIGWithLabels(rrSet []dns.DNSResourceRecord, algo dns.DNSSECAlgorithm,
+	expiration, inception uint32, keyTag uint16, signerName string, privKey []byte,
+	labels uint8, reconstruct bool) dns.DNSRDATARRSIG {
+	rrsig := dns.DNSRDATARRSIG{
+		TypeCovered: rrSet[0].Type,
+		Algorithm:   algo,
+		Labels:      labels,
+		OriginalTTL: rrSet[0].TTL,
+		Expiration:  expiration,
+		Inception:   inception,
+		KeyTag:      keyTag,
+		SignerName:  signerName,
+		Signature:   []byte{},
+	}
+
+	signed := rrSet
+	if reconstruct {
+		signed = make([]dns.DNSResourceRecord, len(rrSet))
+		for i, rr := range rrSet {
+			rr.Name = *dns.NewDNSName(WildcardOwnerName(rr.Name.DomainName, labels))
+			signed[i] = rr
+		}
+	}
+
+	plainText := rrsig.Encode()
+	for _, rr := range signed {
+		plainText = append(plainText, rr.Encode()...)
+	}
+	signature, err := DNSSECAlgorithmerFactory(algo).Sign(plainText, privKey)
+	if err != nil {
+		panic(fmt.Sprintf("function GenerateRDATARRSIGWithLabels() failed:\n%s", err))
+	}
+	rrsig.Signature = signature
+	return rrsig
+}
+
+// GenerateRRRRSIGWithLabels 生成 Labels 字段为指定值的 RRSIG RR，参数同 GenerateRDATARRSIGWithLabels
+func GenerateRRRRSIGWithLabels(rrSet []dns.DNSResourceRecord, algo dns.DNSSECAlgorithm,
+	expiration, inception uint32, keyTag uint16, signerName string, privKey []byte,
+	labels uint8, reconstruct bool) dns.DNSResourceRecord {
+	rdata := GenerateRDATARRSIGWithLabels(rrSet, algo, expiration, inception, keyTag, signerName, privKey, labels, reconstruct)
+	return dns.DNSResourceRecord{
+		Name:  rrSet[0].Name,
+		Type:  dns.DNSRRTypeRRSIG,
+		Class: dns.DNSClassIN,
+		TTL:   86400,
+		RDLen: uint16(rdata.Size()),
+		RData: &rdata,
+	}
+}
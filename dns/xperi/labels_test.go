@@ -0,0 +1,60 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// labels_test.go 文件定义了对 labels.go 的单元测试
+
+package xperi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// TestWildcardOwnerName 测试按 Labels 字段重建原始所有者名称
+func TestWildcardOwnerName(t *testing.T) {
+	cases := []struct {
+		owner  string
+		labels uint8
+		want   string
+	}{
+		{"www.example.com", 3, "www.example.com"},
+		{"www.example.com", 4, "www.example.com"},
+		{"www.example.com", 2, "*.example.com"},
+		{"a.b.example.com", 2, "*.example.com"},
+		{"www.example.com", 0, "*"},
+		{".", 0, "."},
+	}
+	for _, c := range cases {
+		if got := WildcardOwnerName(c.owner, c.labels); got != c.want {
+			t.Errorf("WildcardOwnerName(%q, %d) = %q, want %q", c.owner, c.labels, got, c.want)
+		}
+	}
+}
+
+// TestGenerateRRRRSIGWithLabels 测试生成修改了 Labels 字段的 RRSIG，
+// 以重建的所有者名称签名时验证通过，以实际所有者名称签名时验证失败
+func TestGenerateRRRRSIGWithLabels(t *testing.T) {
+	pubKey, privKey := GenerateRDATADNSKEY(dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSKEYFlagZoneKey)
+	now := time.Now()
+	expiration, inception := uint32(now.Add(time.Hour).Unix()), uint32(now.Add(-time.Hour).Unix())
+
+	for _, reconstruct := range []bool{true, false} {
+		rr := GenerateRRRRSIGWithLabels(downgradeRRSet, dns.DNSSECAlgorithmECDSAP256SHA256,
+			expiration, inception, CalculateKeyTag(pubKey), "example.com", privKey, 2, reconstruct)
+		rrsig := *rr.RData.(*dns.DNSRDATARRSIG)
+		if rrsig.Labels != 2 {
+			t.Errorf("Labels not match: %d", rrsig.Labels)
+		}
+		if rr.Name.DomainName != "www.example.com" {
+			t.Errorf("RRSIG owner should stay the expanded name: %s", rr.Name.DomainName)
+		}
+		err := VerifyRRSIG(downgradeRRSet, rrsig, pubKey, now)
+		if reconstruct && err != nil {
+			t.Errorf("wildcard signature should verify:\n%v", err)
+		}
+		if !reconstruct && err == nil {
+			t.Errorf("signature over the expanded name should not verify after reconstruction")
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// malform.go 提供了对编码后的 DNS 消息进行定点篡改的实验用函数，
+// 与 dns.Validate 相对应，用于有意构造畸形消息，以对解析器进行否定测试。
+// 每种篡改均为一个 Corruption，可通过 Corrupt 依次组合应用，例如：
+//
+//	wire, err := xperi.Corrupt(resp.Encode(),
+//		xperi.SetCount(xperi.SectionAnswer, 0xffff),
+//		xperi.SetRDLen(xperi.SectionAnswer, 0, 0x1000),
+//		xperi.Truncate(300),
+//	)
+//
+// 定位记录的篡改（SetRDLen、RewriteCompressionPointers）会按头部计数解析消息，
+// 因此应先于修改计数或截断消息的篡改应用。
+
+package xperi
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MessageSection 表示 DNS 消息中的部分
+type MessageSection int
+
+const (
+	SectionQuestion MessageSection = iota
+	SectionAnswer
+	SectionAuthority
+	SectionAdditional
+)
+
+func (s MessageSection) String() string {
+	switch s {
+	case SectionQuestion:
+		return "Question"
+	case SectionAnswer:
+		return "Answer"
+	case SectionAuthority:
+		return "Authority"
+	case SectionAdditional:
+		return "Additional"
+	}
+	return fmt.Sprintf("MessageSection(%d)", int(s))
+}
+
+// Corruption 表示对编码后 DNS 消息的一次篡改，其可以原地修改消息，并返回篡改后的消息
+type Corruption func(msg []byte) ([]byte, error)
+
+// Corrupt 依次对消息的副本应用篡改，原消息不会被修改
+// 其接受参数为：
+//   - msg []byte，编码后的 DNS 消息
+//   - corruptions ...Corruption，依次应用的篡改
+//
+// 返回值为：
+//   - []byte，篡改后的消息
+//   - error，任一篡改失败时返回错误
+func Corrupt(msg []byte, corruptions ...Corruption) ([]byte, error) {
+	out := append([]byte{}, msg...)
+	for i, c := range corruptions {
+		var err error
+		out, err = c(out)
+		if err != nil {
+			return nil, fmt.Errorf("function Corrupt failed: corruption %d failed.\n%v", i, err)
+		}
+	}
+	return out, nil
+}
+
+// FlipHeaderBits 翻转头部第 3、4 字节（QR 至 RCODE 的标志位）中由 mask 指定的位，
+// 如 0x8000 翻转 QR，0x0200 翻转 TC，0x000f 翻转 RCODE。
+func FlipHeaderBits(mask uint16) Corruption {
+	return func(msg []byte) ([]byte, error) {
+		if len(msg) < 4 {
+			return nil, fmt.Errorf("function FlipHeaderBits failed: message length %d is less than 4", len(msg))
+		}
+		flags := binary.BigEndian.Uint16(msg[2:]) ^ mask
+		binary.BigEndian.PutUint16(msg[2:], flags)
+		return msg, nil
+	}
+}
+
+// FlipBits 翻转指定偏移处字节中由 mask 指定的位
+func FlipBits(offset int, mask byte) Corruption {
+	return func(msg []byte) ([]byte, error) {
+		if offset < 0 || offset >= len(msg) {
+			return nil, fmt.Errorf("function FlipBits failed: offset %d is out of message length %d", offset, len(msg))
+		}
+		msg[offset] ^= mask
+		return msg, nil
+	}
+}
+
+// SetCount 将头部中指定部分的计数覆写为 count，而不修改部分本身
+func SetCount(section MessageSection, count uint16) Corruption {
+	return func(msg []byte) ([]byte, error) {
+		if section < SectionQuestion || section > SectionAdditional {
+			return nil, fmt.Errorf("function SetCount failed: unknown section %s", section)
+		}
+		if len(msg) < 12 {
+			return nil, fmt.Errorf("function SetCount failed: message length %d is less than header size 12", len(msg))
+		}
+		binary.BigEndian.PutUint16(msg[4+2*int(section):], count)
+		return msg, nil
+	}
+}
+
+// Truncate 将消息截断为 length 字节，length 为负数时表示去除末尾的 -length 字节
+func Truncate(length int) Corruption {
+	return func(msg []byte) ([]byte, error) {
+		if length < 0 {
+			length += len(msg)
+		}
+		if length < 0 || length > len(msg) {
+			return nil, fmt.Errorf("function Truncate failed: length %d is out of message length %d", length, len(msg))
+		}
+		return msg[:length], nil
+	}
+}
+
+// SetRDLen 将指定部分中第 index 条资源记录的 RDLEN 覆写为 rdLen，而不修改 RDATA 本身
+func SetRDLen(section MessageSection, index int, rdLen uint16) Corruption {
+	return func(msg []byte) ([]byte, error) {
+		layout, err := parseLayout(msg)
+		if err != nil {
+			return nil, fmt.Errorf("function SetRDLen failed: %v", err)
+		}
+		if section == SectionQuestion {
+			return nil, fmt.Errorf("function SetRDLen failed: questions have no RDLEN")
+		}
+		rrs := layout.records[section]
+		if index < 0 || index >= len(rrs) {
+			return nil, fmt.Errorf("function SetRDLen failed: %s has no record %d", section, index)
+		}
+		binary.BigEndian.PutUint16(msg[rrs[index].rdLenAt:], rdLen)
+		return msg, nil
+	}
+}
+
+// RewriteCompressionPointers 改写查询名称及记录名称中的压缩指针。
+// rewrite 接受指针所在偏移及其原目标偏移，返回新的目标偏移（仅低 14 位有效）。
+// RDATA 中的域名不会被改写。
+func RewriteCompressionPointers(rewrite func(at int, target uint16) uint16) Corruption {
+	return func(msg []byte) ([]byte, error) {
+		layout, err := parseLayout(msg)
+		if err != nil {
+			return nil, fmt.Errorf("function RewriteCompressionPointers failed: %v", err)
+		}
+		for _, at := range layout.pointers {
+			target := binary.BigEndian.Uint16(msg[at:]) & 0x3fff
+			binary.BigEndian.PutUint16(msg[at:], 0xc000|rewrite(at, target)&0x3fff)
+		}
+		return msg, nil
+	}
+}
+
+// LoopCompressionPointers 令每个压缩指针指向其自身，构成指针环
+func LoopCompressionPointers() Corruption {
+	return RewriteCompressionPointers(func(at int, _ uint16) uint16 {
+		return uint16(at)
+	})
+}
+
+// recordLayout 记录资源记录在消息中的位置
+type recordLayout struct {
+	// 记录起始偏移
+	start int
+	// RDLEN 字段的偏移
+	rdLenAt int
+}
+
+// messageLayout 记录消息的结构
+type messageLayout struct {
+	// 各部分的记录，问题部分的 rdLenAt 为 -1
+	records [4][]recordLayout
+	// 查询名称及记录名称中压缩指针的偏移
+	pointers []int
+}
+
+// parseLayout 按头部计数解析消息的结构
+func parseLayout(msg []byte) (*messageLayout, error) {
+	if len(msg) < 12 {
+		return nil, fmt.Errorf("message length %d is less than header size 12", len(msg))
+	}
+	layout := &messageLayout{}
+	offset := 12
+	for section := SectionQuestion; section <= SectionAdditional; section++ {
+		count := int(binary.BigEndian.Uint16(msg[4+2*int(section):]))
+		for i := 0; i < count; i++ {
+			start := offset
+			var err error
+			offset, err = layout.skipName(msg, offset)
+			if err != nil {
+				return nil, fmt.Errorf("%s record %d: %v", section, i, err)
+			}
+			if section == SectionQuestion {
+				offset += 4
+				if offset > len(msg) {
+					return nil, fmt.Errorf("%s record %d is truncated", section, i)
+				}
+				layout.records[section] = append(layout.records[section], recordLayout{start: start, rdLenAt: -1})
+				continue
+			}
+			if offset+10 > len(msg) {
+				return nil, fmt.Errorf("%s record %d is truncated", section, i)
+			}
+			rdLenAt := offset + 8
+			offset += 10 + int(binary.BigEndian.Uint16(msg[rdLenAt:]))
+			if offset > len(msg) {
+				return nil, fmt.Errorf("%s record %d RDATA is truncated", section, i)
+			}
+			layout.records[section] = append(layout.records[section], recordLayout{start: start, rdLenAt: rdLenAt})
+		}
+	}
+	return layout, nil
+}
+
+// skipName 跳过位于 offset 处的域名，记录其中的压缩指针，返回域名之后的偏移
+func (l *messageLayout) skipName(msg []byte, offset int) (int, error) {
+	for {
+		if offset >= len(msg) {
+			return -1, fmt.Errorf("name at offset %d is truncated", offset)
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			if offset+2 > len(msg) {
+				return -1, fmt.Errorf("compression pointer at offset %d is truncated", offset)
+			}
+			l.pointers = append(l.pointers, offset)
+			return offset + 2, nil
+		case length&0xc0 != 0:
+			return -1, fmt.Errorf("unknown label type 0x%02x at offset %d", length, offset)
+		}
+		offset += 1 + length
+	}
+}
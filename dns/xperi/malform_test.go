@@ -0,0 +1,92 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// malform_test.go 文件定义了对 malform.go 的单元测试
+
+package xperi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// malformedBase 为一个问题及一条 A 记录的回复，回答的名称为指向问题名称的压缩指针
+var malformedBase = []byte{
+	0x12, 0x34, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+	0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03, 'c', 'o', 'm', 0x00,
+	0x00, 0x01, 0x00, 0x01,
+	0xc0, 0x0c, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10,
+	0x00, 0x04, 10, 10, 0, 3,
+}
+
+func TestCorruptHeader(t *testing.T) {
+	wire, err := Corrupt(malformedBase,
+		FlipHeaderBits(0x8200),
+		SetCount(SectionAdditional, 7),
+	)
+	if err != nil {
+		t.Fatalf("function Corrupt() failed:\n%s", err)
+	}
+	if binary.BigEndian.Uint16(wire[2:]) != 0x0380 {
+		t.Errorf("function FlipHeaderBits() failed: got flags 0x%04x", binary.BigEndian.Uint16(wire[2:]))
+	}
+	if binary.BigEndian.Uint16(wire[10:]) != 7 {
+		t.Errorf("function SetCount() failed: got ARCOUNT %d", binary.BigEndian.Uint16(wire[10:]))
+	}
+	// 原消息不应被修改
+	if malformedBase[2] != 0x81 || malformedBase[11] != 0 {
+		t.Error("function Corrupt() failed: original message was modified")
+	}
+
+	msg := dns.DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(wire, 0); err == nil {
+		t.Error("function Corrupt() failed: expected the corrupted message to fail decoding")
+	}
+}
+
+func TestCorruptRecords(t *testing.T) {
+	wire, err := Corrupt(malformedBase, SetRDLen(SectionAnswer, 0, 0x0100))
+	if err != nil {
+		t.Fatalf("function Corrupt() failed:\n%s", err)
+	}
+	if binary.BigEndian.Uint16(wire[39:]) != 0x0100 {
+		t.Errorf("function SetRDLen() failed: got RDLEN %d", binary.BigEndian.Uint16(wire[39:]))
+	}
+
+	wire, err = Corrupt(malformedBase, LoopCompressionPointers())
+	if err != nil {
+		t.Fatalf("function Corrupt() failed:\n%s", err)
+	}
+	if !bytes.Equal(wire[29:31], []byte{0xc0, 29}) {
+		t.Errorf("function LoopCompressionPointers() failed: got pointer %x", wire[29:31])
+	}
+
+	for _, c := range []Corruption{
+		SetRDLen(SectionAnswer, 1, 0),
+		SetRDLen(SectionQuestion, 0, 0),
+		SetCount(MessageSection(4), 0),
+		Truncate(len(malformedBase) + 1),
+		FlipBits(len(malformedBase), 0x01),
+	} {
+		if _, err := Corrupt(malformedBase, c); err == nil {
+			t.Error("function Corrupt() failed: expected an error but got nil")
+		}
+	}
+}
+
+func TestCorruptTruncate(t *testing.T) {
+	wire, err := Corrupt(malformedBase, Truncate(-4), FlipBits(0, 0xff))
+	if err != nil {
+		t.Fatalf("function Corrupt() failed:\n%s", err)
+	}
+	if len(wire) != len(malformedBase)-4 || wire[0] != 0xed {
+		t.Errorf("function Truncate() failed: got %x", wire)
+	}
+
+	// 截断后按头部计数已无法定位记录
+	if _, err := Corrupt(malformedBase, Truncate(20), SetRDLen(SectionAnswer, 0, 0)); err == nil {
+		t.Error("function SetRDLen() failed: expected an error for a truncated message")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// seed.go 文件定义了 xperi 包中随机生成所使用的随机源。
+// 默认使用不可预测的随机源；调用 Seed 设置本次运行的种子后，
+// 随机 RRSIG 签名、随机 DS 摘要、随机字符串、冲突密钥的扰动，
+// 以及 xdns 包中的随机地址选择、记录的随机排序、幻影域的延迟等均由种子确定，
+// 使得实验可以复现，载荷亦可在离线分析时重新生成。
+// 随机源由全部协程共享，并发生成时各调用取得的随机数取决于调度顺序，
+// 需要逐字节复现载荷时，应按相同顺序串行生成。
+// 密钥对的生成及 ECDSA 签名始终使用 crypto/rand，不受种子影响。
+
+package xperi
+
+import (
+	"crypto/rand"
+	mrand "math/rand"
+	"sync"
+)
+
+var (
+	randMu sync.Mutex
+	// 设置种子后使用的确定性随机源，为 nil 时使用不可预测的随机源
+	seededRand *mrand.Rand
+	seedValue  int64
+)
+
+// Seed 设置随机源的种子，之后的随机生成均由该种子确定
+func Seed(seed int64) {
+	randMu.Lock()
+	defer randMu.Unlock()
+	seededRand = mrand.New(mrand.NewSource(seed))
+	seedValue = seed
+}
+
+// Unseed 恢复使用不可预测的随机源
+func Unseed() {
+	randMu.Lock()
+	defer randMu.Unlock()
+	seededRand = nil
+	seedValue = 0
+}
+
+// Seeded 返回当前使用的种子，未设置种子时第二个返回值为 false
+func Seeded() (int64, bool) {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return seedValue, seededRand != nil
+}
+
+// RandomIntn 返回 [0, n) 中的一个随机整数，n 小于等于 0 时 panic
+func RandomIntn(n int) int {
+	randMu.Lock()
+	if seededRand == nil {
+		randMu.Unlock()
+		return mrand.Intn(n)
+	}
+	defer randMu.Unlock()
+	return seededRand.Intn(n)
+}
+
+// RandomRead 以随机字节填充 b，其返回值与 crypto/rand.Read 相同
+func RandomRead(b []byte) (int, error) {
+	randMu.Lock()
+	if seededRand == nil {
+		randMu.Unlock()
+		return rand.Read(b)
+	}
+	defer randMu.Unlock()
+	return seededRand.Read(b)
+}
+
+// RandomInt63n 返回 [0, n) 中的一个随机整数，n 小于等于 0 时 panic
+func RandomInt63n(n int64) int64 {
+	randMu.Lock()
+	if seededRand == nil {
+		randMu.Unlock()
+		return mrand.Int63n(n)
+	}
+	defer randMu.Unlock()
+	return seededRand.Int63n(n)
+}
+
+// RandomFloat64 返回 [0, 1) 中的一个随机浮点数
+func RandomFloat64() float64 {
+	randMu.Lock()
+	if seededRand == nil {
+		randMu.Unlock()
+		return mrand.Float64()
+	}
+	defer randMu.Unlock()
+	return seededRand.Float64()
+}
+
+// RandomExpFloat64 返回服从均值为 1 的指数分布的随机浮点数
+func RandomExpFloat64() float64 {
+	randMu.Lock()
+	if seededRand == nil {
+		randMu.Unlock()
+		return mrand.ExpFloat64()
+	}
+	defer randMu.Unlock()
+	return seededRand.ExpFloat64()
+}
+
+// RandomShuffle 随机打乱 n 个元素的顺序，swap 交换下标为 i 与 j 的元素
+func RandomShuffle(n int, swap func(i, j int)) {
+	randMu.Lock()
+	if seededRand == nil {
+		randMu.Unlock()
+		mrand.Shuffle(n, swap)
+		return
+	}
+	defer randMu.Unlock()
+	seededRand.Shuffle(n, swap)
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// seed_test.go 文件定义了对 seed.go 的单元测试
+
+package xperi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// seededPayload 使用指定种子生成一组随机载荷
+func seededPayload(seed int64) ([]byte, string, dns.DNSRDATADNSKEY) {
+	Seed(seed)
+	rrset := []dns.DNSResourceRecord{{
+		Name:  *dns.NewDNSName("www.example.com"),
+		Type:  dns.DNSRRTypeA,
+		Class: dns.DNSClassIN,
+		TTL:   3600,
+		RData: &dns.DNSRDATAA{Address: []byte{10, 10, 0, 3}},
+	}}
+	sig := GenerateRandomRDATARRSIG(rrset, dns.DNSSECAlgorithmECDSAP256SHA256, 0, 0, 1, "example.com")
+	ds := GenerateRandomRDATADS("example.com", 1, dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSSECDigestTypeSHA256)
+	key := GenerateCollidedDNSKEY(dns.DNSRDATADNSKEY{
+		Flags:     dns.DNSKEYFlagZoneKey,
+		Protocol:  dns.DNSKEYProtocolValue,
+		Algorithm: dns.DNSSECAlgorithmECDSAP256SHA256,
+		PublicKey: bytes.Repeat([]byte{0x80}, 64),
+	})
+	return append(sig.Signature, ds.Digest...), GenerateRandomString(32), key
+}
+
+func TestSeed(t *testing.T) {
+	defer Unseed()
+
+	payload, str, key := seededPayload(42)
+	if seed, ok := Seeded(); !ok || seed != 42 {
+		t.Errorf("function Seeded() failed: got %d, %v", seed, ok)
+	}
+	payload2, str2, key2 := seededPayload(42)
+	if !bytes.Equal(payload, payload2) || str != str2 || !bytes.Equal(key.PublicKey, key2.PublicKey) {
+		t.Error("function Seed() failed: the same seed generated different payloads")
+	}
+	payload3, str3, _ := seededPayload(43)
+	if bytes.Equal(payload, payload3) || str == str3 {
+		t.Error("function Seed() failed: different seeds generated the same payload")
+	}
+
+	Unseed()
+	if _, ok := Seeded(); ok {
+		t.Error("function Unseed() failed: still seeded")
+	}
+}
+
+// seededSequence 使用指定种子，依次从各随机函数取得随机数
+func seededSequence(seed int64) []float64 {
+	Seed(seed)
+	perm := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	RandomShuffle(len(perm), func(i, j int) {
+		perm[i], perm[j] = perm[j], perm[i]
+	})
+	seq := []float64{float64(RandomIntn(1000)), float64(RandomInt63n(1 << 40)), RandomFloat64(), RandomExpFloat64()}
+	for _, p := range perm {
+		seq = append(seq, float64(p))
+	}
+	return seq
+}
+
+func TestSeedRandomFunctions(t *testing.T) {
+	defer Unseed()
+
+	seq, seq2, seq3 := seededSequence(42), seededSequence(42), seededSequence(43)
+	same := func(a, b []float64) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if !same(seq, seq2) {
+		t.Errorf("function Seed() failed: the same seed generated different sequences:\n%v\n%v", seq, seq2)
+	}
+	if same(seq, seq3) {
+		t.Errorf("function Seed() failed: different seeds generated the same sequence:\n%v", seq)
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// stub.go 文件定义了验证存根 StubValidator：如同验证解析器一样验证权威服务器的回复，
+// 包括沿 DS 追溯信任链直至信任锚、验证回复中的全部签名，以及检查 NSEC/NSEC3 否定应答证明。
+// 其实现了 client.Validator 接口，设置为客户端的 Validator 后，可以验证解析器的视角测量 xdns 自身，
+// 验证失败时返回的 ValidationError 记录了导致失败的记录。
+//
+// 验证存根不支持不安全委派及 NSEC3 opt-out：未签名的记录及无法追溯至信任锚的签名均视为验证失败。
+
+package xperi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+)
+
+var _ client.Validator = (*StubValidator)(nil)
+
+// ErrNotSigned 表示 RRset 没有使用受支持算法的 RRSIG
+var ErrNotSigned = errors.New("RRset has no RRSIG with a supported algorithm")
+
+// ErrNoDenialProof 表示否定应答或通配符展开缺少相应的 NSEC/NSEC3 证明
+var ErrNoDenialProof = errors.New("no NSEC or NSEC3 proof")
+
+// ValidationError 记录导致验证失败的记录
+type ValidationError struct {
+	// 记录所在的区域，"answer" 或 "authority"
+	Section string
+	// 记录的名称及类型，缺少否定应答证明时为查询的名称及类型
+	Name string
+	Type dns.DNSType
+	// 失败原因
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s in %s section is bogus: %v", e.Name, e.Type, e.Section, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// StubValidator 验证存根，可并发使用
+type StubValidator struct {
+	// 信任锚记录，即 DS 或 DNSKEY 记录，通常为根区域的 DS
+	TrustAnchors []dns.DNSResourceRecord
+	// 验证时间，零值表示当前时间
+	Now time.Time
+}
+
+// NewStubValidator 创建一个以 anchors 为信任锚的验证存根
+func NewStubValidator(anchors ...dns.DNSResourceRecord) *StubValidator {
+	return &StubValidator{TrustAnchors: anchors}
+}
+
+// Validate 验证回复：
+//   - Answer 及 Authority 部分中的每个 RRset 均须有一个能够追溯至信任锚的有效签名，未签名的委派 NS RRset 除外
+//   - NXDOMAIN 及 NODATA 回复须有 NSEC 或 NSEC3 否定应答证明
+//   - 由通配符展开的回答须有查询名称不存在的证明
+//
+// 传入参数：
+//   - query: 查询函数，用于查询签名者的 DNSKEY 及 DS
+//   - qry: 查询消息
+//   - resp: 回复消息
+//
+// 返回值：
+//   - 验证失败时的错误信息，为 *ValidationError
+func (s *StubValidator) Validate(query func(qName string, qType dns.DNSType) (dns.DNSMessage, error), qry, resp dns.DNSMessage) error {
+	if len(qry.Question) == 0 {
+		return fmt.Errorf("method StubValidator Validate failed: query has no question")
+	}
+	question := qry.Question[0]
+	v := &ChainValidator{Query: query, AnchorRecords: s.TrustAnchors, Now: s.Now}
+
+	expanded, err := s.validateSection(v, "answer", resp.Answer)
+	if err != nil {
+		return err
+	}
+	if _, err := s.validateSection(v, "authority", resp.Authority); err != nil {
+		return err
+	}
+
+	proof := newDenialProof(resp.Authority)
+	fail := func(err error) error {
+		return &ValidationError{Section: "authority", Name: question.Name.DomainName, Type: question.Type, Err: err}
+	}
+	for _, e := range expanded {
+		if err := proof.nonExistence(e.owner, e.labels); err != nil {
+			return fail(fmt.Errorf("wildcard expansion of %s: %w", e.owner, err))
+		}
+	}
+
+	qName := normalizeChainZone(question.Name.DomainName)
+	switch {
+	case resp.Header.RCode == dns.DNSResponseCodeNXDomain:
+		if err := proof.nxdomain(qName); err != nil {
+			return fail(err)
+		}
+	case resp.Header.RCode == dns.DNSResponseCodeNoErr && isNoData(resp):
+		if err := proof.nodata(qName, question.Type); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// isNoData 判断回复是否为 NODATA：Answer 部分为空且 Authority 部分包含 SOA
+func isNoData(resp dns.DNSMessage) bool {
+	for _, rr := range resp.Answer {
+		if rr.Type != dns.DNSRRTypeRRSIG {
+			return false
+		}
+	}
+	for _, rr := range resp.Authority {
+		if rr.Type == dns.DNSRRTypeSOA {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardExpansion 记录由通配符展开而来的 RRset 的所有者名称及其签名的 Labels 字段
+type wildcardExpansion struct {
+	owner  string
+	labels uint8
+}
+
+// validateSection 验证区域中的每个 RRset，RRset 只需有一个有效的签名。
+// 返回由通配符展开而来的 RRset，按其在区域中出现的顺序排列。
+func (s *StubValidator) validateSection(v *ChainValidator, section string, rrs dns.DNSResponseSection) ([]wildcardExpansion, error) {
+	order := []string{}
+	rrSets := map[string][]dns.DNSResourceRecord{}
+	sigs := map[string][]dns.DNSResourceRecord{}
+	for _, rr := range rrs {
+		if rr.Type == dns.DNSRRTypeOPT {
+			continue
+		}
+		if rrsig, ok := rr.RData.(*dns.DNSRDATARRSIG); ok {
+			key := rrSetKey(rr.Name.DomainName, rrsig.TypeCovered)
+			sigs[key] = append(sigs[key], rr)
+			continue
+		}
+		key := rrSetKey(rr.Name.DomainName, rr.Type)
+		if _, ok := rrSets[key]; !ok {
+			order = append(order, key)
+		}
+		rrSets[key] = append(rrSets[key], rr)
+	}
+
+	expanded := []wildcardExpansion{}
+	for _, key := range order {
+		rrSet := rrSets[key]
+		fail := func(err error) error {
+			return &ValidationError{Section: section, Name: rrSet[0].Name.DomainName, Type: rrSet[0].Type, Err: err}
+		}
+		var lastErr error
+		for _, sig := range sigs[key] {
+			rrsig := sig.RData.(*dns.DNSRDATARRSIG)
+			if !IsSupportedAlgorithm(rrsig.Algorithm) {
+				continue
+			}
+			if _, lastErr = v.ValidateSection(append(append(dns.DNSResponseSection{}, rrSet...), sig)); lastErr != nil {
+				continue
+			}
+			if owner := normalizeChainZone(rrSet[0].Name.DomainName); int(rrsig.Labels) < OwnerLabelCount(owner) {
+				expanded = append(expanded, wildcardExpansion{owner, rrsig.Labels})
+			}
+			break
+		}
+		switch {
+		case lastErr != nil:
+			return nil, fail(lastErr)
+		case !hasSupportedRRSIG(sigs[key]):
+			// 委派的 NS RRset 由子区域签名，父区域的回复中不带签名
+			if section == "authority" && rrSet[0].Type == dns.DNSRRTypeNS {
+				continue
+			}
+			return nil, fail(ErrNotSigned)
+		}
+	}
+	return expanded, nil
+}
+
+// hasSupportedRRSIG 判断记录中是否有使用受支持算法的 RRSIG
+func hasSupportedRRSIG(sigs []dns.DNSResourceRecord) bool {
+	for _, sig := range sigs {
+		if IsSupportedAlgorithm(sig.RData.(*dns.DNSRDATARRSIG).Algorithm) {
+			return true
+		}
+	}
+	return false
+}
+
+// denialNSEC 记录 Authority 部分中的一条 NSEC 记录
+type denialNSEC struct {
+	owner, next string
+	types       []dns.DNSType
+}
+
+// denialNSEC3 记录 Authority 部分中的一条 NSEC3 记录
+type denialNSEC3 struct {
+	hash, next []byte
+	types      []dns.DNSType
+}
+
+// denialProof 记录 Authority 部分中的否定应答证明，其中的记录已由 validateSection 验证
+type denialProof struct {
+	nsecs  []denialNSEC
+	nsec3s []denialNSEC3
+	// NSEC3 的哈希参数，取自第一条 NSEC3 记录
+	iterations uint16
+	salt       []byte
+}
+
+// newDenialProof 收集 Authority 部分中的 NSEC 及 NSEC3 记录
+func newDenialProof(authority dns.DNSResponseSection) *denialProof {
+	p := &denialProof{}
+	for _, rr := range authority {
+		switch rdata := rr.RData.(type) {
+		case *dns.DNSRDATANSEC:
+			p.nsecs = append(p.nsecs, denialNSEC{
+				owner: normalizeChainZone(rr.Name.DomainName),
+				next:  normalizeChainZone(rdata.NextDomainName),
+				types: rdata.TypeBitMaps,
+			})
+		case *dns.DNSRDATANSEC3:
+			label, _, _ := strings.Cut(rr.Name.DomainName, ".")
+			hash, err := dns.DecodeNSEC3Hash(label)
+			if err != nil {
+				continue
+			}
+			if len(p.nsec3s) == 0 {
+				p.iterations, p.salt = rdata.Iterations, rdata.Salt
+			}
+			p.nsec3s = append(p.nsec3s, denialNSEC3{hash: hash, next: rdata.NextHashedOwnerName, types: rdata.TypeBitMaps})
+		}
+	}
+	return p
+}
+
+// hasType 判断类型位图中是否包含指定类型
+func hasType(types []dns.DNSType, rrType dns.DNSType) bool {
+	for _, t := range types {
+		if t == rrType {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestorName 返回名称最右侧 labels 个标签组成的名称，labels 为 0 时为根区域
+func ancestorName(name string, labels int) string {
+	if labels <= 0 {
+		return "."
+	}
+	parts := strings.Split(name, ".")
+	return strings.Join(parts[len(parts)-labels:], ".")
+}
+
+// wildcardName 返回区域下的通配符名称
+func wildcardName(zone string) string {
+	if zone == "." {
+		return "*"
+	}
+	return "*." + zone
+}
+
+// nsecCovers 判断是否有 NSEC 记录覆盖名称，并返回该记录
+func (p *denialProof) nsecCovers(name string) (denialNSEC, bool) {
+	for _, n := range p.nsecs {
+		if dns.NSECCovers(n.owner, n.next, name) {
+			return n, true
+		}
+	}
+	return denialNSEC{}, false
+}
+
+// nsec3Hash 计算名称的 NSEC3 哈希
+func (p *denialProof) nsec3Hash(name string) []byte {
+	return dns.NSEC3HashName(name, p.iterations, p.salt)
+}
+
+// nsec3Match 返回哈希与名称相同的 NSEC3 记录
+func (p *denialProof) nsec3Match(name string) (denialNSEC3, bool) {
+	hash := p.nsec3Hash(name)
+	for _, n := range p.nsec3s {
+		if bytes.Equal(n.hash, hash) {
+			return n, true
+		}
+	}
+	return denialNSEC3{}, false
+}
+
+// nsec3Covers 判断是否有 NSEC3 记录的哈希区间严格覆盖名称的哈希
+func (p *denialProof) nsec3Covers(name string) bool {
+	hash := p.nsec3Hash(name)
+	for _, n := range p.nsec3s {
+		o2h, h2n := bytes.Compare(n.hash, hash), bytes.Compare(hash, n.next)
+		if bytes.Compare(n.hash, n.next) < 0 {
+			if o2h < 0 && h2n < 0 {
+				return true
+			}
+		} else if o2h < 0 || h2n < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nodata 检查名称存在但不含指定类型的证明
+func (p *denialProof) nodata(qName string, qType dns.DNSType) error {
+	for _, n := range p.nsecs {
+		if n.owner == qName {
+			if hasType(n.types, qType) || hasType(n.types, dns.DNSRRTypeCNAME) {
+				return fmt.Errorf("NSEC of %s asserts that type %s exists", qName, qType)
+			}
+			return nil
+		}
+	}
+	if n, ok := p.nsec3Match(qName); ok {
+		if hasType(n.types, qType) || hasType(n.types, dns.DNSRRTypeCNAME) {
+			return fmt.Errorf("NSEC3 of %s asserts that type %s exists", qName, qType)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w of NODATA for %s %s", ErrNoDenialProof, qName, qType)
+}
+
+// nxdomain 检查名称不存在的证明：名称本身及最近祖先下的通配符均不存在
+func (p *denialProof) nxdomain(qName string) error {
+	if n, ok := p.nsecCovers(qName); ok {
+		// 最近祖先为被覆盖区间两端中与查询名称共同的最长上级
+		encloser := OwnerLabelCount(qName) - 1
+		for ; encloser > 0; encloser-- {
+			ce := ancestorName(qName, encloser)
+			if dns.IsSubDomain(n.owner, ce) || dns.IsSubDomain(n.next, ce) {
+				break
+			}
+		}
+		wildcard := wildcardName(ancestorName(qName, encloser))
+		if _, ok := p.nsecCovers(wildcard); !ok {
+			return fmt.Errorf("%w that wildcard %s does not exist", ErrNoDenialProof, wildcard)
+		}
+		return nil
+	}
+	if len(p.nsec3s) == 0 {
+		return fmt.Errorf("%w of NXDOMAIN for %s", ErrNoDenialProof, qName)
+	}
+	if _, ok := p.nsec3Match(qName); ok {
+		return fmt.Errorf("NSEC3 asserts that %s exists", qName)
+	}
+
+	// 最近祖先证明：最近祖先存在，下一个更近的名称及最近祖先下的通配符不存在（RFC 5155 8.4 节）
+	for encloser := OwnerLabelCount(qName) - 1; encloser >= 0; encloser-- {
+		ce := ancestorName(qName, encloser)
+		if _, ok := p.nsec3Match(ce); !ok {
+			continue
+		}
+		if err := p.nonExistence(qName, uint8(encloser)); err != nil {
+			return err
+		}
+		if wildcard := wildcardName(ce); !p.nsec3Covers(wildcard) {
+			return fmt.Errorf("%w that wildcard %s does not exist", ErrNoDenialProof, wildcard)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w of the closest encloser of %s", ErrNoDenialProof, qName)
+}
+
+// nonExistence 检查名称本身不存在的证明，labels 为最近祖先的标签数，
+// 用于 NXDOMAIN 及通配符展开（RFC 4035 5.3.4 节、RFC 5155 8.8 节）
+func (p *denialProof) nonExistence(name string, labels uint8) error {
+	if _, ok := p.nsecCovers(name); ok {
+		return nil
+	}
+	if int(labels) < OwnerLabelCount(name) {
+		if nextCloser := ancestorName(name, int(labels)+1); p.nsec3Covers(nextCloser) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w that %s does not exist", ErrNoDenialProof, name)
+}
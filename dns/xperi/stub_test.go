@@ -0,0 +1,245 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// stub_test.go 文件定义了对 stub.go 的单元测试
+
+package xperi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// stubZone 是验证存根测试所用的区域层级：根区域及其下的 test 区域
+type stubZone struct {
+	now        time.Time
+	rootKey    dns.DNSResourceRecord
+	rootPriv   []byte
+	zsk        dns.DNSResourceRecord
+	zskPriv    []byte
+	anchor     dns.DNSResourceRecord
+	answers    map[string][]dns.DNSResourceRecord
+	inception  uint32
+	expiration uint32
+}
+
+// newStubZone 生成根区域及 test 区域的密钥，并以根区域 KSK 的 DS 作为信任锚
+func newStubZone() *stubZone {
+	now := time.Now()
+	z := &stubZone{now: now, inception: uint32(now.Unix() - 3600), expiration: uint32(now.Unix() + 3600)}
+	algo := dns.DNSSECAlgorithmECDSAP256SHA256
+	z.rootKey, z.rootPriv = GenerateRRDNSKEY(".", algo, dns.DNSKEYFlagSecureEntryPoint)
+	ksk, kskPriv := GenerateRRDNSKEY("test", algo, dns.DNSKEYFlagSecureEntryPoint)
+	z.zsk, z.zskPriv = GenerateRRDNSKEY("test", algo, dns.DNSKEYFlagZoneKey)
+	z.anchor = GenerateRRDS(".", *z.rootKey.RData.(*dns.DNSRDATADNSKEY), dns.DNSSECDigestTypeSHA256)
+
+	ds := GenerateRRDS("test", *ksk.RData.(*dns.DNSRDATADNSKEY), dns.DNSSECDigestTypeSHA256)
+	z.answers = map[string][]dns.DNSResourceRecord{
+		"./DNSKEY":    z.sign([]dns.DNSResourceRecord{z.rootKey}, z.rootKey, ".", z.rootPriv),
+		"test/DNSKEY": z.sign([]dns.DNSResourceRecord{z.zsk, ksk}, ksk, "test", kskPriv),
+		"test/DS":     z.sign([]dns.DNSResourceRecord{ds}, z.rootKey, ".", z.rootPriv),
+	}
+	return z
+}
+
+// sign 返回 RRset 及其签名
+func (z *stubZone) sign(rrSet []dns.DNSResourceRecord, key dns.DNSResourceRecord, signer string, privKey []byte) []dns.DNSResourceRecord {
+	rrSet = append([]dns.DNSResourceRecord{}, rrSet...)
+	sort.Sort(dns.ByCanonicalOrder(rrSet))
+	tag := CalculateKeyTag(*key.RData.(*dns.DNSRDATADNSKEY))
+	sig := GenerateRRRRSIG(rrSet, key.RData.(*dns.DNSRDATADNSKEY).Algorithm, z.expiration, z.inception, tag, signer, privKey)
+	return append(rrSet, sig)
+}
+
+// signZone 以 test 区域的 ZSK 签名记录
+func (z *stubZone) signZone(rrs ...dns.DNSResourceRecord) []dns.DNSResourceRecord {
+	return z.sign(rrs, z.zsk, "test", z.zskPriv)
+}
+
+func (z *stubZone) query(qName string, qType dns.DNSType) (dns.DNSMessage, error) {
+	rrs, ok := z.answers[qName+"/"+qType.String()]
+	if !ok {
+		return dns.DNSMessage{}, fmt.Errorf("unexpected query %s %s", qName, qType)
+	}
+	return dns.DNSMessage{Answer: rrs}, nil
+}
+
+// validate 以 test 区域中的查询验证回复
+func (z *stubZone) validate(v *StubValidator, qName string, qType dns.DNSType, resp dns.DNSMessage) error {
+	qry := dns.DNSMessage{Question: dns.DNSQuestionSection{{Name: *dns.NewDNSName(qName), Type: qType, Class: dns.DNSClassIN}}}
+	return v.Validate(z.query, qry, resp)
+}
+
+func stubRR(name string, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{Name: *dns.NewDNSName(name), Type: rdata.Type(), Class: dns.DNSClassIN, TTL: 3600, RData: rdata}
+}
+
+func stubSOA() dns.DNSResourceRecord {
+	return stubRR("test", &dns.DNSRDATASOA{MName: "ns.test", RName: "admin.test", Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400, Minimum: 300})
+}
+
+// TestStubValidatorAnswer 测试肯定回答的签名验证及信任链追溯
+func TestStubValidatorAnswer(t *testing.T) {
+	z := newStubZone()
+	v := NewStubValidator(z.anchor)
+	v.Now = z.now
+	resp := dns.DNSMessage{Answer: z.signZone(testRRSet("www.test")...)}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeA, resp); err != nil {
+		t.Fatalf("method StubValidator Validate() failed:\n%v", err)
+	}
+
+	// 同一 RRset 有多个签名时，只需一个签名有效
+	bad := z.signZone(testRRSet("www.test")...)
+	bad[len(bad)-1].RData.(*dns.DNSRDATARRSIG).Signature[8] ^= 0xff
+	resp.Answer = append(bad, resp.Answer[len(resp.Answer)-1])
+	if err := z.validate(v, "www.test", dns.DNSRRTypeA, resp); err != nil {
+		t.Errorf("method StubValidator Validate() failed with one valid signature:\n%v", err)
+	}
+
+	var vErr *ValidationError
+	tampered := dns.DNSMessage{Answer: append(z.signZone(stubSOA()), z.signZone(testRRSet("www.test")...)...)}
+	tampered.Answer[2].RData = &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 9)}
+	err := z.validate(v, "www.test", dns.DNSRRTypeA, tampered)
+	if !errors.As(err, &vErr) || vErr.Section != "answer" || vErr.Name != "www.test" || vErr.Type != dns.DNSRRTypeA {
+		t.Errorf("method StubValidator Validate() failed: tampered RRset not reported, got %v", err)
+	}
+
+	unsigned := dns.DNSMessage{Answer: testRRSet("www.test")}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeA, unsigned); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("method StubValidator Validate() failed: expected ErrNotSigned, got %v", err)
+	}
+
+	// 未签名的委派 NS RRset 不影响验证
+	referral := dns.DNSMessage{Authority: dns.DNSResponseSection{stubRR("sub.test", &dns.DNSRDATANS{NSDNAME: "ns.sub.test"})}}
+	if err := z.validate(v, "www.sub.test", dns.DNSRRTypeA, referral); err != nil {
+		t.Errorf("method StubValidator Validate() failed on a referral:\n%v", err)
+	}
+
+	// 信任锚与根区域的 KSK 不符时，信任链断裂
+	other, _ := GenerateRRDNSKEY(".", dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSKEYFlagSecureEntryPoint)
+	wrong := NewStubValidator(GenerateRRDS(".", *other.RData.(*dns.DNSRDATADNSKEY), dns.DNSSECDigestTypeSHA256))
+	wrong.Now = z.now
+	if err := z.validate(wrong, "www.test", dns.DNSRRTypeA, resp); err == nil {
+		t.Errorf("method StubValidator Validate() failed: mismatched trust anchor accepted")
+	}
+	keyAnchor := NewStubValidator(z.rootKey)
+	keyAnchor.Now = z.now
+	if err := z.validate(keyAnchor, "www.test", dns.DNSRRTypeA, resp); err != nil {
+		t.Errorf("method StubValidator Validate() failed with a DNSKEY trust anchor:\n%v", err)
+	}
+}
+
+// TestStubValidatorNSEC 测试 NSEC 否定应答及通配符展开的证明
+func TestStubValidatorNSEC(t *testing.T) {
+	z := newStubZone()
+	v := NewStubValidator(z.anchor)
+	v.Now = z.now
+
+	// 区域中的名称：test、*.test、www.test
+	apexNSEC := stubRR("test", &dns.DNSRDATANSEC{NextDomainName: "*.test", TypeBitMaps: []dns.DNSType{dns.DNSRRTypeSOA, dns.DNSRRTypeNSEC}})
+	wildNSEC := stubRR("*.test", &dns.DNSRDATANSEC{NextDomainName: "www.test", TypeBitMaps: []dns.DNSType{dns.DNSRRTypeA, dns.DNSRRTypeNSEC}})
+	wwwNSEC := stubRR("www.test", &dns.DNSRDATANSEC{NextDomainName: "test", TypeBitMaps: []dns.DNSType{dns.DNSRRTypeA, dns.DNSRRTypeNSEC}})
+	authority := func(rrs ...dns.DNSResourceRecord) dns.DNSResponseSection {
+		section := dns.DNSResponseSection(z.signZone(stubSOA()))
+		for _, rr := range rrs {
+			section = append(section, z.signZone(rr)...)
+		}
+		return section
+	}
+
+	// abc.test 不存在，但 *.test 存在，NXDOMAIN 不成立
+	nx := dns.DNSMessage{Header: dns.DNSHeader{RCode: dns.DNSResponseCodeNXDomain}, Authority: authority(wildNSEC, apexNSEC)}
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, nx); !errors.Is(err, ErrNoDenialProof) {
+		t.Errorf("method StubValidator Validate() failed: NXDOMAIN below an existing wildcard accepted, got %v", err)
+	}
+	// 不含 *.test 的区域中，覆盖 abc.test 的 NSEC 同时覆盖 *.test
+	nx.Authority = authority(stubRR("test", &dns.DNSRDATANSEC{NextDomainName: "www.test", TypeBitMaps: []dns.DNSType{dns.DNSRRTypeSOA}}))
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, nx); err != nil {
+		t.Errorf("method StubValidator Validate() failed on NXDOMAIN:\n%v", err)
+	}
+	nx.Authority = authority(wwwNSEC)
+	var vErr *ValidationError
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, nx); !errors.Is(err, ErrNoDenialProof) || !errors.As(err, &vErr) || vErr.Name != "abc.test" {
+		t.Errorf("method StubValidator Validate() failed: expected ErrNoDenialProof, got %v", err)
+	}
+
+	nodata := dns.DNSMessage{Authority: authority(wwwNSEC)}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeAAAA, nodata); err != nil {
+		t.Errorf("method StubValidator Validate() failed on NODATA:\n%v", err)
+	}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeA, nodata); err == nil {
+		t.Errorf("method StubValidator Validate() failed: NODATA for an existing type accepted")
+	}
+
+	// abc.test 由 *.test 展开，须证明 abc.test 本身不存在
+	expanded := testRRSet("abc.test")
+	sort.Sort(dns.ByCanonicalOrder(expanded))
+	rrsig := GenerateRDATARRSIGWithLabels(expanded, dns.DNSSECAlgorithmECDSAP256SHA256, z.expiration, z.inception,
+		CalculateKeyTag(*z.zsk.RData.(*dns.DNSRDATADNSKEY)), "test", z.zskPriv, 1, true)
+	wildcard := dns.DNSMessage{Answer: append(expanded, stubRR("abc.test", &rrsig)), Authority: authority(wildNSEC)}
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, wildcard); err != nil {
+		t.Errorf("method StubValidator Validate() failed on a wildcard expansion:\n%v", err)
+	}
+	wildcard.Authority = dns.DNSResponseSection{}
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, wildcard); !errors.Is(err, ErrNoDenialProof) {
+		t.Errorf("method StubValidator Validate() failed: unproven wildcard expansion accepted, got %v", err)
+	}
+}
+
+// TestStubValidatorNSEC3 测试 NSEC3 否定应答的证明
+func TestStubValidatorNSEC3(t *testing.T) {
+	z := newStubZone()
+	v := NewStubValidator(z.anchor)
+	v.Now = z.now
+
+	salt := []byte{0xab, 0xcd}
+	names := []string{"test", "www.test"}
+	hashes := [][]byte{}
+	for _, name := range names {
+		hashes = append(hashes, dns.NSEC3HashName(name, 1, salt))
+	}
+	nsec3 := func(i int, types ...dns.DNSType) dns.DNSResourceRecord {
+		return stubRR(dns.EncodeNSEC3Hash(hashes[i])+".test", &dns.DNSRDATANSEC3{
+			HashAlgorithm:       dns.DNSSECDigestTypeSHA1,
+			Iterations:          1,
+			SaltLength:          uint8(len(salt)),
+			Salt:                salt,
+			HashLength:          uint8(len(hashes[1-i])),
+			NextHashedOwnerName: hashes[1-i],
+			TypeBitMaps:         types,
+		})
+	}
+	apex, www := nsec3(0, dns.DNSRRTypeSOA), nsec3(1, dns.DNSRRTypeA)
+	authority := func(rrs ...dns.DNSResourceRecord) dns.DNSResponseSection {
+		section := dns.DNSResponseSection(z.signZone(stubSOA()))
+		for _, rr := range rrs {
+			section = append(section, z.signZone(rr)...)
+		}
+		return section
+	}
+
+	// 两条 NSEC3 记录构成完整的链，覆盖 test 及 www.test 以外的全部哈希
+	nx := dns.DNSMessage{Header: dns.DNSHeader{RCode: dns.DNSResponseCodeNXDomain}, Authority: authority(apex, www)}
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, nx); err != nil {
+		t.Errorf("method StubValidator Validate() failed on NXDOMAIN:\n%v", err)
+	}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeA, nx); err == nil {
+		t.Errorf("method StubValidator Validate() failed: NXDOMAIN for an existing name accepted")
+	}
+	nx.Authority = authority(www)
+	if err := z.validate(v, "abc.test", dns.DNSRRTypeA, nx); !errors.Is(err, ErrNoDenialProof) {
+		t.Errorf("method StubValidator Validate() failed: missing closest encloser accepted, got %v", err)
+	}
+
+	nodata := dns.DNSMessage{Authority: authority(www)}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeTXT, nodata); err != nil {
+		t.Errorf("method StubValidator Validate() failed on NODATA:\n%v", err)
+	}
+	if err := z.validate(v, "www.test", dns.DNSRRTypeA, nodata); err == nil {
+		t.Errorf("method StubValidator Validate() failed: NODATA for an existing type accepted")
+	}
+}
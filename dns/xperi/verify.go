@@ -0,0 +1,477 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// verify.go 提供了 DNSSEC 签名及信任链的验证函数，
+// 用于检查服务器生成的、本应有效的签名能否真正通过解析器的验证。
+//
+// RSA 公钥同时接受 xperi 生成的 PKIX 编码及 RFC 3110 编码，
+// ECDSA 公钥为 X | Y（RFC 6605），Ed25519 公钥为原始公钥（RFC 8080）。
+// 不受支持的算法无法验证，其签名由调用者决定是否忽略。
+
+package xperi
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ErrNoDNSKEY 表示无法取得签名者的 DNSKEY，签名因此无法验证
+var ErrNoDNSKEY = errors.New("no DNSKEY for signer")
+
+// parseRSAPublicKey 解析 DNSKEY 中的 RSA 公钥，先尝试 PKIX 编码，再尝试 RFC 3110 编码
+func parseRSAPublicKey(pubKey []byte) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(pubKey); err == nil {
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+	}
+
+	// RFC 3110 第 2 节：指数长度 | 指数 | 模数
+	if len(pubKey) < 3 {
+		return nil, fmt.Errorf("RSA public key is too short")
+	}
+	expLen, offset := int(pubKey[0]), 1
+	if expLen == 0 {
+		expLen, offset = int(pubKey[1])<<8|int(pubKey[2]), 3
+	}
+	if expLen == 0 || expLen > 4 || offset+expLen >= len(pubKey) {
+		return nil, fmt.Errorf("invalid RSA public key exponent length %d", expLen)
+	}
+	exponent := 0
+	for _, b := range pubKey[offset : offset+expLen] {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(pubKey[offset+expLen:]),
+		E: exponent,
+	}, nil
+}
+
+// verifyECDSA 使用 X | Y 编码的公钥验证 r | s 编码的签名
+func verifyECDSA(curve elliptic.Curve, digest, signature, pubKey []byte) error {
+	size := (curve.Params().BitSize + 7) / 8
+	if len(pubKey) != 2*size {
+		return fmt.Errorf("invalid ECDSA public key length %d", len(pubKey))
+	}
+	if len(signature) != 2*size {
+		return fmt.Errorf("invalid ECDSA signature length %d", len(signature))
+	}
+	key := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(pubKey[:size]),
+		Y:     new(big.Int).SetBytes(pubKey[size:]),
+	}
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(key, digest, r, s) {
+		return fmt.Errorf("ECDSA verification failed")
+	}
+	return nil
+}
+
+// VerifySignature 使用 DNSKEY 公钥验证签名
+// 传入参数：
+//   - algo: DNSSEC 算法
+//   - data: 被签名的明文
+//   - signature: 签名
+//   - pubKey: DNSKEY 中的公钥
+//
+// 返回值：
+//   - 验证失败时的错误信息
+func VerifySignature(algo dns.DNSSECAlgorithm, data, signature, pubKey []byte) error {
+	switch algo {
+	case dns.DNSSECAlgorithmRSASHA1, dns.DNSSECAlgorithmRSASHA1NSEC3,
+		dns.DNSSECAlgorithmRSASHA256, dns.DNSSECAlgorithmRSASHA512:
+		key, err := parseRSAPublicKey(pubKey)
+		if err != nil {
+			return fmt.Errorf("function VerifySignature failed: parse public key failed.\n%v", err)
+		}
+		var hash crypto.Hash
+		var digest []byte
+		switch algo {
+		case dns.DNSSECAlgorithmRSASHA256:
+			sum := sha256.Sum256(data)
+			hash, digest = crypto.SHA256, sum[:]
+		case dns.DNSSECAlgorithmRSASHA512:
+			sum := sha512.Sum512(data)
+			hash, digest = crypto.SHA512, sum[:]
+		default:
+			sum := sha1.Sum(data)
+			hash, digest = crypto.SHA1, sum[:]
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return fmt.Errorf("function VerifySignature failed: %v", err)
+		}
+	case dns.DNSSECAlgorithmECDSAP256SHA256:
+		digest := sha256.Sum256(data)
+		if err := verifyECDSA(elliptic.P256(), digest[:], signature, pubKey); err != nil {
+			return fmt.Errorf("function VerifySignature failed: %v", err)
+		}
+	case dns.DNSSECAlgorithmECDSAP384SHA384:
+		digest := sha512.Sum384(data)
+		if err := verifyECDSA(elliptic.P384(), digest[:], signature, pubKey); err != nil {
+			return fmt.Errorf("function VerifySignature failed: %v", err)
+		}
+	case dns.DNSSECAlgorithmED25519:
+		if len(pubKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("function VerifySignature failed: invalid Ed25519 public key length %d", len(pubKey))
+		}
+		if !ed25519.Verify(pubKey, data, signature) {
+			return fmt.Errorf("function VerifySignature failed: Ed25519 verification failed")
+		}
+	default:
+		return fmt.Errorf("function VerifySignature failed: unsupported algorithm %d", algo)
+	}
+	return nil
+}
+
+// RRSIGSignedData 重建 RRSIG 所签名的明文：RRSIG_RDATA（不含签名）| RR(1) | RR(2) | ...
+// Labels 字段小于所有者名称的标签数时，所有者名称按 WildcardOwnerName 重建。
+// 传入参数：
+//   - rrSet: 被签名的 RR 集合，无需预先排序
+//   - rrsig: RRSIG RDATA
+//
+// 返回值：
+//   - 被签名的明文
+func RRSIGSignedData(rrSet []dns.DNSResourceRecord, rrsig dns.DNSRDATARRSIG) []byte {
+	rrsig.Signature = []byte{}
+	sorted := make([]dns.DNSResourceRecord, len(rrSet))
+	copy(sorted, rrSet)
+	sort.Sort(dns.ByCanonicalOrder(sorted))
+
+	data := rrsig.Encode()
+	for _, rr := range sorted {
+		rr.TTL = rrsig.OriginalTTL
+		if owner := WildcardOwnerName(rr.Name.DomainName, rrsig.Labels); owner != rr.Name.DomainName {
+			rr.Name = *dns.NewDNSName(owner)
+		}
+		data = append(data, rr.Encode()...)
+	}
+	return data
+}
+
+// VerifyRRSIG 验证 RRSIG 对 RR 集合的签名，并检查其有效期
+// 传入参数：
+//   - rrSet: 被签名的 RR 集合
+//   - rrsig: RRSIG RDATA
+//   - key: 签名者的 DNSKEY RDATA
+//   - now: 验证时间
+//
+// 返回值：
+//   - 验证失败时的错误信息
+func VerifyRRSIG(rrSet []dns.DNSResourceRecord, rrsig dns.DNSRDATARRSIG, key dns.DNSRDATADNSKEY, now time.Time) error {
+	if len(rrSet) == 0 {
+		return fmt.Errorf("function VerifyRRSIG failed: empty RRset")
+	}
+	if rrsig.TypeCovered != rrSet[0].Type {
+		return fmt.Errorf("function VerifyRRSIG failed: RRSIG covers %s, RRset type is %s", rrsig.TypeCovered, rrSet[0].Type)
+	}
+	if rrsig.Algorithm != key.Algorithm || rrsig.KeyTag != CalculateKeyTag(key) {
+		return fmt.Errorf("function VerifyRRSIG failed: RRSIG algorithm %d tag %d does not match DNSKEY algorithm %d tag %d",
+			rrsig.Algorithm, rrsig.KeyTag, key.Algorithm, CalculateKeyTag(key))
+	}
+
+	// 有效期使用序列号算术比较，RFC 4034 第 3.1.5 节
+	t := uint32(now.Unix())
+	if int32(t-rrsig.Inception) < 0 {
+		return fmt.Errorf("function VerifyRRSIG failed: signature is not yet valid, inception %d, now %d", rrsig.Inception, t)
+	}
+	if int32(rrsig.Expiration-t) < 0 {
+		return fmt.Errorf("function VerifyRRSIG failed: signature has expired, expiration %d, now %d", rrsig.Expiration, t)
+	}
+
+	if err := VerifySignature(rrsig.Algorithm, RRSIGSignedData(rrSet, rrsig), rrsig.Signature, key.PublicKey); err != nil {
+		return fmt.Errorf("function VerifyRRSIG failed: %s %s signed by %s tag %d.\n%v",
+			rrSet[0].Name.DomainName, rrSet[0].Type, rrsig.SignerName, rrsig.KeyTag, err)
+	}
+	return nil
+}
+
+// VerifyDS 检查 DS 记录是否与 DNSKEY 相符
+// 传入参数：
+//   - oName: DNSKEY 的所有者名称
+//   - ds: DS RDATA
+//   - key: DNSKEY RDATA
+//
+// 返回值：
+//   - 不相符时的错误信息
+func VerifyDS(oName string, ds dns.DNSRDATADS, key dns.DNSRDATADNSKEY) error {
+	switch ds.DigestType {
+	case dns.DNSSECDigestTypeSHA1, dns.DNSSECDigestTypeSHA256, dns.DNSSECDigestTypeSHA384:
+	default:
+		return fmt.Errorf("function VerifyDS failed: unsupported digest type %d", ds.DigestType)
+	}
+	expected := GenerateRDATADS(strings.ToLower(oName), key, ds.DigestType)
+	if ds.KeyTag != expected.KeyTag || ds.Algorithm != expected.Algorithm || !bytes.Equal(ds.Digest, expected.Digest) {
+		return fmt.Errorf("function VerifyDS failed: DS tag %d does not match DNSKEY tag %d of %s", ds.KeyTag, expected.KeyTag, oName)
+	}
+	return nil
+}
+
+// ChainValidator 信任链验证器：验证消息中的签名，并沿 DS 向上追溯签名者的 DNSKEY，直至信任锚。
+// 不受支持的算法的签名被忽略，其余签名必须有效。
+type ChainValidator struct {
+	// 查询函数
+	Query ChainQuerier
+	// 信任锚区域，其 DNSKEY RRset 只需由自身的密钥签名，不再追溯 DS
+	Anchors []string
+	// 信任锚记录，即 DS 或 DNSKEY 记录，其所有者区域同样视为信任锚区域，
+	// 但签名了该区域 DNSKEY RRset 的密钥中须有与某条信任锚记录相符者
+	AnchorRecords []dns.DNSResourceRecord
+	// 验证时间，零值表示当前时间
+	Now time.Time
+
+	// 区域与已验证的 DNSKEY 的映射
+	keys map[string][]dns.DNSRDATADNSKEY
+	// 正在验证的区域，用于检测循环
+	pending map[string]bool
+}
+
+// now 返回验证时间
+func (v *ChainValidator) now() time.Time {
+	if v.Now.IsZero() {
+		return time.Now()
+	}
+	return v.Now
+}
+
+// isAnchor 检查区域是否为信任锚
+func (v *ChainValidator) isAnchor(zone string) bool {
+	for _, anchor := range v.Anchors {
+		if normalizeChainZone(anchor) == zone {
+			return true
+		}
+	}
+	for _, rr := range v.AnchorRecords {
+		if normalizeChainZone(rr.Name.DomainName) == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnchorRecords 检查签名了 DNSKEY RRset 的密钥中是否有与区域的信任锚记录相符者，
+// 区域没有信任锚记录时不作检查
+func (v *ChainValidator) matchAnchorRecords(zone string, entries []dns.DNSRDATADNSKEY) error {
+	found := false
+	for _, rr := range v.AnchorRecords {
+		if normalizeChainZone(rr.Name.DomainName) != zone {
+			continue
+		}
+		found = true
+		for _, key := range entries {
+			switch anchor := rr.RData.(type) {
+			case *dns.DNSRDATADS:
+				if VerifyDS(zone, *anchor, key) == nil {
+					return nil
+				}
+			case *dns.DNSRDATADNSKEY:
+				if anchor.Equal(&key) {
+					return nil
+				}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return fmt.Errorf("method ChainValidator matchAnchorRecords failed: no DNSKEY of %s matches its trust anchor", zone)
+}
+
+// rrSetKey 返回记录所属 RR 集合的键
+func rrSetKey(name string, rrType dns.DNSType) string {
+	return fmt.Sprintf("%s|%d", normalizeChainZone(name), rrType)
+}
+
+// ValidateSection 验证区域（Answer、Authority、Additional）中的全部签名
+// 传入参数：
+//   - section: 回复中的一个区域
+//
+// 返回值：
+//   - 验证的签名数量
+//   - 第一个验证失败的签名的错误信息，签名者的 DNSKEY 无法取得时为 ErrNoDNSKEY
+func (v *ChainValidator) ValidateSection(section dns.DNSResponseSection) (int, error) {
+	rrSets := map[string][]dns.DNSResourceRecord{}
+	for _, rr := range section {
+		if rr.Type != dns.DNSRRTypeRRSIG && rr.Type != dns.DNSRRTypeOPT {
+			key := rrSetKey(rr.Name.DomainName, rr.Type)
+			rrSets[key] = append(rrSets[key], rr)
+		}
+	}
+
+	verified := 0
+	for _, rr := range section {
+		rrsig, ok := rr.RData.(*dns.DNSRDATARRSIG)
+		if !ok || !IsSupportedAlgorithm(rrsig.Algorithm) {
+			continue
+		}
+		rrSet := rrSets[rrSetKey(rr.Name.DomainName, rrsig.TypeCovered)]
+		if len(rrSet) == 0 {
+			return verified, fmt.Errorf("method ChainValidator ValidateSection failed: RRSIG of %s %s covers no RRset",
+				rr.Name.DomainName, rrsig.TypeCovered)
+		}
+		if err := v.verifyRRSet(rrSet, *rrsig); err != nil {
+			return verified, err
+		}
+		verified++
+	}
+	return verified, nil
+}
+
+// ValidateMessage 验证消息中全部区域的签名
+// 返回值与 ValidateSection 相同
+func (v *ChainValidator) ValidateMessage(msg dns.DNSMessage) (int, error) {
+	verified := 0
+	for _, section := range []dns.DNSResponseSection{msg.Answer, msg.Authority, msg.Additional} {
+		n, err := v.ValidateSection(section)
+		verified += n
+		if err != nil {
+			return verified, err
+		}
+	}
+	return verified, nil
+}
+
+// verifyRRSet 使用签名者已验证的 DNSKEY 验证 RRSIG
+func (v *ChainValidator) verifyRRSet(rrSet []dns.DNSResourceRecord, rrsig dns.DNSRDATARRSIG) error {
+	keys, err := v.ZoneKeys(rrsig.SignerName)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, key := range keys {
+		if key.Algorithm != rrsig.Algorithm || CalculateKeyTag(key) != rrsig.KeyTag {
+			continue
+		}
+		if lastErr = VerifyRRSIG(rrSet, rrsig, key, v.now()); lastErr == nil {
+			return nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no DNSKEY of %s has algorithm %d tag %d", rrsig.SignerName, rrsig.Algorithm, rrsig.KeyTag)
+	}
+	return fmt.Errorf("method ChainValidator verifyRRSet failed: %s %s.\n%v", rrSet[0].Name.DomainName, rrSet[0].Type, lastErr)
+}
+
+// ZoneKeys 返回区域经过验证的 DNSKEY：
+// DNSKEY RRset 须由其中某个密钥签名，非信任锚的区域还须有与该密钥相符、且签名有效的 DS。
+// 传入参数：
+//   - zone: 区域名
+//
+// 返回值：
+//   - 区域的 DNSKEY RDATA
+//   - 错误信息，区域没有 DNSKEY 时为 ErrNoDNSKEY
+func (v *ChainValidator) ZoneKeys(zone string) ([]dns.DNSRDATADNSKEY, error) {
+	zone = normalizeChainZone(zone)
+	if keys, ok := v.keys[zone]; ok {
+		return keys, nil
+	}
+	if v.keys == nil {
+		v.keys = map[string][]dns.DNSRDATADNSKEY{}
+		v.pending = map[string]bool{}
+	}
+	if v.pending[zone] {
+		return nil, fmt.Errorf("method ChainValidator ZoneKeys failed: chain of trust of %s loops", zone)
+	}
+	v.pending[zone] = true
+	defer delete(v.pending, zone)
+
+	resp, err := v.Query(zone, dns.DNSRRTypeDNSKEY)
+	if err != nil {
+		return nil, fmt.Errorf("method ChainValidator ZoneKeys failed: query DNSKEY of %s failed.\n%v", zone, err)
+	}
+	keySet := []dns.DNSResourceRecord{}
+	keys := []dns.DNSRDATADNSKEY{}
+	for _, rr := range resp.Answer {
+		if key, ok := rr.RData.(*dns.DNSRDATADNSKEY); ok && normalizeChainZone(rr.Name.DomainName) == zone {
+			keySet = append(keySet, rr)
+			keys = append(keys, *key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrNoDNSKEY, zone)
+	}
+
+	// 找出签名了 DNSKEY RRset 的密钥，即区域的安全入口
+	entries := []dns.DNSRDATADNSKEY{}
+	for _, rr := range resp.Answer {
+		rrsig, ok := rr.RData.(*dns.DNSRDATARRSIG)
+		if !ok || rrsig.TypeCovered != dns.DNSRRTypeDNSKEY || !IsSupportedAlgorithm(rrsig.Algorithm) ||
+			normalizeChainZone(rrsig.SignerName) != zone {
+			continue
+		}
+		for _, key := range keys {
+			if key.Algorithm == rrsig.Algorithm && CalculateKeyTag(key) == rrsig.KeyTag &&
+				VerifyRRSIG(keySet, *rrsig, key, v.now()) == nil {
+				entries = append(entries, key)
+				break
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("method ChainValidator ZoneKeys failed: DNSKEY RRset of %s is not signed by any of its keys", zone)
+	}
+
+	if v.isAnchor(zone) {
+		if err := v.matchAnchorRecords(zone, entries); err != nil {
+			return nil, err
+		}
+	} else if err := v.validateDS(zone, entries); err != nil {
+		return nil, err
+	}
+	v.keys[zone] = keys
+	return keys, nil
+}
+
+// validateDS 查询区域的 DS，验证其签名，并检查是否有 DS 与签名了 DNSKEY RRset 的密钥相符
+func (v *ChainValidator) validateDS(zone string, entries []dns.DNSRDATADNSKEY) error {
+	resp, err := v.Query(zone, dns.DNSRRTypeDS)
+	if err != nil {
+		return fmt.Errorf("method ChainValidator validateDS failed: query DS of %s failed.\n%v", zone, err)
+	}
+	dsSet := dns.DNSResponseSection{}
+	for _, rr := range resp.Answer {
+		if normalizeChainZone(rr.Name.DomainName) != zone {
+			continue
+		}
+		if _, ok := rr.RData.(*dns.DNSRDATADS); ok {
+			dsSet = append(dsSet, rr)
+		} else if rrsig, ok := rr.RData.(*dns.DNSRDATARRSIG); ok && rrsig.TypeCovered == dns.DNSRRTypeDS {
+			dsSet = append(dsSet, rr)
+		}
+	}
+	verified, err := v.ValidateSection(dsSet)
+	if err != nil {
+		return err
+	}
+	if verified == 0 {
+		return fmt.Errorf("method ChainValidator validateDS failed: DS RRset of %s is not signed", zone)
+	}
+	for _, rr := range dsSet {
+		ds, ok := rr.RData.(*dns.DNSRDATADS)
+		if !ok {
+			continue
+		}
+		for _, key := range entries {
+			if VerifyDS(zone, *ds, key) == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("method ChainValidator validateDS failed: no DS of %s matches its DNSKEY", zone)
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// verify_test.go 文件定义了对 verify.go 的单元测试
+
+package xperi
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// testRRSet 返回用于签名测试的 A 记录集合
+func testRRSet(name string) []dns.DNSResourceRecord {
+	rrSet := []dns.DNSResourceRecord{}
+	for _, ip := range []dns.IP{dns.IPv4(10, 0, 0, 2), dns.IPv4(10, 0, 0, 1)} {
+		rdata := &dns.DNSRDATAA{Address: ip}
+		rrSet = append(rrSet, dns.DNSResourceRecord{
+			Name:  *dns.NewDNSName(name),
+			Type:  dns.DNSRRTypeA,
+			Class: dns.DNSClassIN,
+			TTL:   3600,
+			RDLen: uint16(rdata.Size()),
+			RData: rdata,
+		})
+	}
+	return rrSet
+}
+
+// TestVerifyRRSIG 测试使用全部受支持的算法签名后验证 RRSIG
+func TestVerifyRRSIG(t *testing.T) {
+	now := time.Now()
+	inception, expiration := uint32(now.Unix()-3600), uint32(now.Unix()+3600)
+	for _, algo := range []dns.DNSSECAlgorithm{
+		dns.DNSSECAlgorithmRSASHA1, dns.DNSSECAlgorithmRSASHA256, dns.DNSSECAlgorithmRSASHA512,
+		dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSSECAlgorithmECDSAP384SHA384, dns.DNSSECAlgorithmED25519,
+	} {
+		key, privKey := GenerateRDATADNSKEY(algo, dns.DNSKEYFlagZoneKey)
+		rrSet := testRRSet("www.test")
+		sort.Sort(dns.ByCanonicalOrder(rrSet))
+		rrsig := GenerateRDATARRSIG(rrSet, algo, expiration, inception, CalculateKeyTag(key), "test", privKey)
+
+		// 验证时重新排序，与记录的顺序无关
+		rrSet[0], rrSet[1] = rrSet[1], rrSet[0]
+		if err := VerifyRRSIG(rrSet, rrsig, key, now); err != nil {
+			t.Errorf("function VerifyRRSIG() failed: algorithm %d:\n%s", algo, err)
+		}
+
+		tampered := rrsig
+		tampered.Signature = append([]byte{}, rrsig.Signature...)
+		tampered.Signature[len(tampered.Signature)/2] ^= 0x01
+		if VerifyRRSIG(rrSet, tampered, key, now) == nil {
+			t.Errorf("function VerifyRRSIG() failed: algorithm %d: tampered signature verified", algo)
+		}
+		if VerifyRRSIG(rrSet, rrsig, key, now.Add(2*time.Hour)) == nil {
+			t.Errorf("function VerifyRRSIG() failed: algorithm %d: expired signature verified", algo)
+		}
+	}
+}
+
+// TestVerifySignatureRFC3110 测试使用 RFC 3110 编码的 RSA 公钥验证签名
+func TestVerifySignatureRFC3110(t *testing.T) {
+	_, privKey := GenerateRDATADNSKEY(dns.DNSSECAlgorithmRSASHA256, dns.DNSKEYFlagZoneKey)
+	key, err := x509.ParsePKCS1PrivateKey(privKey)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	exponent := big.NewInt(int64(key.E)).Bytes()
+	pubKey := append([]byte{byte(len(exponent))}, exponent...)
+	pubKey = append(pubKey, key.N.Bytes()...)
+
+	signature, err := RSASHA256{}.Sign([]byte("xdns"), privKey)
+	if err != nil {
+		t.Fatalf("method RSASHA256 Sign() failed:\n%s", err)
+	}
+	if err := VerifySignature(dns.DNSSECAlgorithmRSASHA256, []byte("xdns"), signature, pubKey); err != nil {
+		t.Errorf("function VerifySignature() failed:\n%s", err)
+	}
+	parsed, _ := parseRSAPublicKey(pubKey)
+	if parsed == nil || !parsed.Equal(&rsa.PublicKey{N: key.N, E: key.E}) {
+		t.Errorf("function parseRSAPublicKey() failed: got %v", parsed)
+	}
+}
+
+// TestVerifyDS 测试检查 DS 与 DNSKEY 是否相符
+func TestVerifyDS(t *testing.T) {
+	key, _ := GenerateRDATADNSKEY(dns.DNSSECAlgorithmED25519, dns.DNSKEYFlagSecureEntryPoint)
+	ds := GenerateRDATADS("test", key, dns.DNSSECDigestTypeSHA256)
+	if err := VerifyDS("TEST", ds, key); err != nil {
+		t.Errorf("function VerifyDS() failed:\n%s", err)
+	}
+	ds.Digest[0] ^= 0xff
+	if VerifyDS("test", ds, key) == nil {
+		t.Errorf("function VerifyDS() failed: mismatched digest verified")
+	}
+}
+
+// TestChainValidator 测试沿 DS 追溯信任链
+func TestChainValidator(t *testing.T) {
+	now := time.Now()
+	inception, expiration := uint32(now.Unix()-3600), uint32(now.Unix()+3600)
+	algo := dns.DNSSECAlgorithmECDSAP256SHA256
+
+	rootKey, rootPriv := GenerateRRDNSKEY(".", algo, dns.DNSKEYFlagSecureEntryPoint)
+	kskRR, kskPriv := GenerateRRDNSKEY("test", algo, dns.DNSKEYFlagSecureEntryPoint)
+	zskRR, zskPriv := GenerateRRDNSKEY("test", algo, dns.DNSKEYFlagZoneKey)
+	tag := func(rr dns.DNSResourceRecord) uint16 {
+		return CalculateKeyTag(*rr.RData.(*dns.DNSRDATADNSKEY))
+	}
+	sign := func(rrSet []dns.DNSResourceRecord, key dns.DNSResourceRecord, signer string, privKey []byte) []dns.DNSResourceRecord {
+		sort.Sort(dns.ByCanonicalOrder(rrSet))
+		sig := GenerateRRRRSIG(rrSet, algo, expiration, inception, tag(key), signer, privKey)
+		return append(append([]dns.DNSResourceRecord{}, rrSet...), sig)
+	}
+
+	ds := GenerateRRDS("test", *kskRR.RData.(*dns.DNSRDATADNSKEY), dns.DNSSECDigestTypeSHA256)
+	answers := map[string][]dns.DNSResourceRecord{
+		"./DNSKEY":     sign([]dns.DNSResourceRecord{rootKey}, rootKey, ".", rootPriv),
+		"test/DNSKEY":  sign([]dns.DNSResourceRecord{zskRR, kskRR}, kskRR, "test", kskPriv),
+		"test/DS":      sign([]dns.DNSResourceRecord{ds}, rootKey, ".", rootPriv),
+		"other/DNSKEY": {},
+	}
+	query := func(qName string, qType dns.DNSType) (dns.DNSMessage, error) {
+		rrs, ok := answers[qName+"/"+qType.String()]
+		if !ok {
+			return dns.DNSMessage{}, fmt.Errorf("unexpected query %s %s", qName, qType)
+		}
+		return dns.DNSMessage{Answer: rrs}, nil
+	}
+
+	msg := dns.DNSMessage{Answer: sign(testRRSet("www.test"), zskRR, "test", zskPriv)}
+	validator := &ChainValidator{Query: query, Anchors: []string{"."}, Now: now}
+	if n, err := validator.ValidateMessage(msg); err != nil || n != 1 {
+		t.Fatalf("method ChainValidator ValidateMessage() failed: verified %d:\n%v", n, err)
+	}
+
+	// DS 与 KSK 不符时，信任链断裂
+	answers["test/DS"][0].RData.(*dns.DNSRDATADS).Digest[0] ^= 0xff
+	answers["test/DS"] = sign(answers["test/DS"][:1], rootKey, ".", rootPriv)
+	validator = &ChainValidator{Query: query, Anchors: []string{"."}, Now: now}
+	if _, err := validator.ValidateMessage(msg); err == nil {
+		t.Errorf("method ChainValidator ValidateMessage() failed: mismatched DS accepted")
+	}
+
+	// 以 test 为信任锚时不再追溯 DS；签名者没有 DNSKEY 时返回 ErrNoDNSKEY
+	validator = &ChainValidator{Query: query, Anchors: []string{"test"}, Now: now}
+	if _, err := validator.ValidateMessage(msg); err != nil {
+		t.Errorf("method ChainValidator ValidateMessage() failed:\n%s", err)
+	}
+	orphan := dns.DNSMessage{Answer: sign(testRRSet("www.other"), zskRR, "other", zskPriv)}
+	if _, err := validator.ValidateMessage(orphan); !errors.Is(err, ErrNoDNSKEY) {
+		t.Errorf("method ChainValidator ValidateMessage() failed: expected ErrNoDNSKEY, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// walk.go 提供了 NSEC / NSEC3 区域遍历（Zone Walking）实验用函数，
+// 既可用于检验 xdns 自身生成的否定应答链，也可用于研究其他服务器。
+
+package xperi
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+)
+
+// WalkNSEC 沿 NSEC 链遍历区域，返回按链顺序枚举出的名称
+// 其接受参数为：
+//   - c *client.Client，用于查询的客户端，其应设置 DNSSECOK
+//   - zone string，区域名称
+//   - maxQueries int，最大查询次数
+//
+// 返回值为：
+//   - []string，枚举出的名称（包含区域顶点）
+//   - error，错误信息，达到最大查询次数或链断开时返回错误
+func WalkNSEC(c *client.Client, zone string, maxQueries int) ([]string, error) {
+	zone = dns.CanonicalizeDomainName(&zone)
+	names := []string{}
+	visited := make(map[string]bool)
+
+	current := zone
+	for queries := 0; queries < maxQueries; queries++ {
+		visited[current] = true
+		names = append(names, current)
+
+		resp, err := c.Query(current, dns.DNSRRTypeNSEC)
+		if err != nil {
+			return names, fmt.Errorf("function WalkNSEC failed: query %s failed.\n%v", current, err)
+		}
+
+		next := ""
+		for _, rr := range append(resp.Answer, resp.Authority...) {
+			nsec, ok := rr.RData.(*dns.DNSRDATANSEC)
+			if !ok || dns.CompareDomainName(rr.Name.DomainName, current) != 0 {
+				continue
+			}
+			next = dns.CanonicalizeDomainName(&nsec.NextDomainName)
+			break
+		}
+		if next == "" {
+			return names, fmt.Errorf("function WalkNSEC failed: no NSEC record found for %s", current)
+		}
+		if visited[next] {
+			// 回到区域顶点（或已访问的名称），链遍历完毕
+			return names, nil
+		}
+		current = next
+	}
+	return names, fmt.Errorf("function WalkNSEC failed: exceeded max queries %d", maxQueries)
+}
+
+// NSEC3WalkResult 记录 NSEC3 区域遍历的结果
+type NSEC3WalkResult struct {
+	// NSEC3 参数
+	Iterations uint16
+	Salt       []byte
+	// 枚举出的哈希（Base32hex 形式），按哈希顺序排列
+	Hashes []string
+	// 已破解的哈希，键为 Base32hex 形式的哈希，值为对应名称
+	Cracked map[string]string
+	// 是否遍历了完整的 NSEC3 链
+	Complete bool
+	// 实际发送的查询次数
+	Queries int
+}
+
+// nsec3Chain 记录已收集到的 NSEC3 链，键为所有者哈希，值为下一个哈希
+type nsec3Chain map[string][]byte
+
+// covers 检查哈希是否已被已收集的 NSEC3 区间覆盖（或与某个所有者哈希相等）
+func (chain nsec3Chain) covers(hash []byte) bool {
+	for owner, next := range chain {
+		o := []byte(owner)
+		if bytes.Equal(o, hash) {
+			return true
+		}
+		if bytes.Compare(o, next) < 0 {
+			if bytes.Compare(o, hash) < 0 && bytes.Compare(hash, next) < 0 {
+				return true
+			}
+		} else if bytes.Compare(hash, o) > 0 || bytes.Compare(hash, next) < 0 {
+			// 链的最后一个区间，跨越哈希空间的末尾
+			return true
+		}
+	}
+	return false
+}
+
+// complete 检查已收集的 NSEC3 链是否闭合
+func (chain nsec3Chain) complete() bool {
+	if len(chain) == 0 {
+		return false
+	}
+	for _, next := range chain {
+		if _, ok := chain[string(next)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// WalkNSEC3 通过查询不存在的名称收集区域的 NSEC3 链，并使用字典尝试破解其中的哈希
+// 其接受参数为：
+//   - c *client.Client，用于查询的客户端，其应设置 DNSSECOK
+//   - zone string，区域名称
+//   - maxQueries int，最大查询次数
+//   - dictionary []string，用于破解的候选标签，如 "www"、"mail"
+//
+// 返回值为：
+//   - NSEC3WalkResult，遍历结果
+//   - error，错误信息
+//
+// 函数会在本地计算候选名称的哈希，仅对落在未覆盖区间内的名称发送查询，以减少查询次数。
+func WalkNSEC3(c *client.Client, zone string, maxQueries int, dictionary []string) (NSEC3WalkResult, error) {
+	zone = dns.CanonicalizeDomainName(&zone)
+	result := NSEC3WalkResult{Cracked: make(map[string]string)}
+	chain := nsec3Chain{}
+	paramsKnown := false
+
+	// 候选名称生成器：先尝试字典中的名称，再使用随机标签
+	candidates := make([]string, 0, len(dictionary))
+	for _, word := range dictionary {
+		candidates = append(candidates, strings.ToLower(word)+"."+zone)
+	}
+
+	for attempts := 0; result.Queries < maxQueries && !chain.complete(); attempts++ {
+		var qName string
+		if attempts < len(candidates) {
+			qName = candidates[attempts]
+		} else {
+			qName = strings.ToLower(GenerateRandomString(12)) + "." + zone
+		}
+		// 参数已知后，跳过已被覆盖的名称；为避免死循环，限制本地尝试次数
+		if paramsKnown && chain.covers(dns.NSEC3HashName(qName, result.Iterations, result.Salt)) {
+			if attempts > maxQueries*1000 {
+				break
+			}
+			continue
+		}
+
+		resp, err := c.Query(qName, dns.DNSRRTypeA)
+		result.Queries++
+		if err != nil {
+			return result, fmt.Errorf("function WalkNSEC3 failed: query %s failed.\n%v", qName, err)
+		}
+		for _, rr := range resp.Authority {
+			nsec3, ok := rr.RData.(*dns.DNSRDATANSEC3)
+			if !ok {
+				continue
+			}
+			label := strings.SplitN(rr.Name.DomainName, ".", 2)[0]
+			owner, err := dns.DecodeNSEC3Hash(label)
+			if err != nil {
+				continue
+			}
+			chain[string(owner)] = nsec3.NextHashedOwnerName
+			result.Iterations = nsec3.Iterations
+			result.Salt = nsec3.Salt
+			paramsKnown = true
+		}
+	}
+	result.Complete = chain.complete()
+
+	for owner := range chain {
+		result.Hashes = append(result.Hashes, dns.EncodeNSEC3Hash([]byte(owner)))
+	}
+	sort.Strings(result.Hashes)
+
+	// 字典破解，包含区域顶点本身
+	words := append([]string{""}, dictionary...)
+	for _, word := range words {
+		name := zone
+		if word != "" {
+			name = strings.ToLower(word) + "." + zone
+		}
+		hash := dns.NSEC3HashName(name, result.Iterations, result.Salt)
+		if _, ok := chain[string(hash)]; ok {
+			result.Cracked[dns.EncodeNSEC3Hash(hash)] = name
+		}
+	}
+
+	if !result.Complete {
+		return result, fmt.Errorf("function WalkNSEC3 failed: NSEC3 chain incomplete after %d queries", result.Queries)
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// walk_test.go 文件定义了对 walk.go 的单元测试
+
+package xperi
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+)
+
+// serveNSECChain 启动一个仅回复 NSEC 查询的 UDP 服务器，返回其地址
+func serveNSECChain(t *testing.T, chain map[string]string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			qry := dns.DNSMessage{}
+			if _, err := qry.DecodeFromBuffer(buf[:n], 0); err != nil {
+				continue
+			}
+			qName := strings.ToLower(qry.Question[0].Name.DomainName)
+			resp := dns.DNSMessage{
+				Header:   qry.Header,
+				Question: qry.Question,
+			}
+			resp.Header.QR = true
+			resp.Header.ARCount = 0
+			resp.Additional = nil
+			if next, ok := chain[qName]; ok {
+				resp.Answer = dns.DNSResponseSection{{
+					Name:  *dns.NewDNSName(qName),
+					Type:  dns.DNSRRTypeNSEC,
+					Class: dns.DNSClassIN,
+					TTL:   3600,
+					RData: &dns.DNSRDATANSEC{NextDomainName: next, TypeBitMaps: []dns.DNSType{dns.DNSRRTypeA}},
+				}}
+				resp.Header.ANCount = 1
+			}
+			conn.WriteTo(resp.Encode(), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestWalkNSEC(t *testing.T) {
+	chain := map[string]string{
+		"test":      "a.test",
+		"a.test":    "mail.test",
+		"mail.test": "www.test",
+		"www.test":  "test",
+	}
+	c := client.NewClient(client.ClientConfig{Server: serveNSECChain(t, chain)})
+
+	names, err := WalkNSEC(c, "test", 10)
+	if err != nil {
+		t.Fatalf("function WalkNSEC() failed:\n%s", err)
+	}
+	expected := []string{"test", "a.test", "mail.test", "www.test"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("function WalkNSEC() failed:\ngot:%v\nexpected: %v", names, expected)
+	}
+
+	// 查询次数不足
+	if _, err := WalkNSEC(c, "test", 2); err == nil {
+		t.Errorf("function WalkNSEC() failed: expected an error but got nil")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// dnstap.go 文件实现了 dnstap 消息的最小编码器，
+// 包括 dnstap.Dnstap 的 Protocol Buffers 编码，以及 Frame Streams 的帧封装，
+// 以免为此引入 protobuf 依赖。
+
+package xdns
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// DnstapMessageType 表示 dnstap Message 的类型
+type DnstapMessageType uint64
+
+const (
+	DnstapAuthQuery    DnstapMessageType = 1
+	DnstapAuthResponse DnstapMessageType = 2
+)
+
+// dnstap Frame Streams 内容类型
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// DnstapMessage 记录一条 dnstap Message 的内容
+type DnstapMessage struct {
+	Type            DnstapMessageType
+	Protocol        Protocol
+	QueryAddress    net.IP
+	QueryPort       int
+	ResponseAddress net.IP
+	ResponsePort    int
+	QueryTime       time.Time
+	QueryMessage    []byte
+	ResponseTime    time.Time
+	ResponseMessage []byte
+}
+
+// appendVarint 追加 Protocol Buffers varint 编码
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// appendVarintField 追加 varint 类型的字段
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = appendVarint(buf, uint64(field)<<3)
+	return appendVarint(buf, v)
+}
+
+// appendBytesField 追加长度限定类型的字段
+func appendBytesField(buf []byte, field int, v []byte) []byte {
+	buf = appendVarint(buf, uint64(field)<<3|2)
+	buf = appendVarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+// appendFixed32Field 追加 fixed32 类型的字段
+func appendFixed32Field(buf []byte, field int, v uint32) []byte {
+	buf = appendVarint(buf, uint64(field)<<3|5)
+	return binary.LittleEndian.AppendUint32(buf, v)
+}
+
+// Encode 将 dnstap Message 封装为 dnstap.Dnstap 并进行 Protocol Buffers 编码
+// 其接受参数为：
+//   - identity string，服务器标识，为空时不编码
+//
+// 返回值为：
+//   - []byte，编码结果
+func (m *DnstapMessage) Encode(identity string) []byte {
+	msg := []byte{}
+	msg = appendVarintField(msg, 1, uint64(m.Type))
+
+	family, queryAddr := uint64(1), m.QueryAddress.To4()
+	if queryAddr == nil {
+		family, queryAddr = 2, m.QueryAddress.To16()
+	}
+	msg = appendVarintField(msg, 2, family)
+	if m.Protocol == ProtocolTCP {
+		msg = appendVarintField(msg, 3, 2)
+	} else {
+		msg = appendVarintField(msg, 3, 1)
+	}
+	if queryAddr != nil {
+		msg = appendBytesField(msg, 4, queryAddr)
+	}
+	if m.ResponseAddress != nil {
+		respAddr := m.ResponseAddress.To4()
+		if respAddr == nil {
+			respAddr = m.ResponseAddress.To16()
+		}
+		msg = appendBytesField(msg, 5, respAddr)
+	}
+	msg = appendVarintField(msg, 6, uint64(m.QueryPort))
+	if m.ResponsePort != 0 {
+		msg = appendVarintField(msg, 7, uint64(m.ResponsePort))
+	}
+	if !m.QueryTime.IsZero() {
+		msg = appendVarintField(msg, 8, uint64(m.QueryTime.Unix()))
+		msg = appendFixed32Field(msg, 9, uint32(m.QueryTime.Nanosecond()))
+	}
+	if m.QueryMessage != nil {
+		msg = appendBytesField(msg, 10, m.QueryMessage)
+	}
+	if !m.ResponseTime.IsZero() {
+		msg = appendVarintField(msg, 12, uint64(m.ResponseTime.Unix()))
+		msg = appendFixed32Field(msg, 13, uint32(m.ResponseTime.Nanosecond()))
+	}
+	if m.ResponseMessage != nil {
+		msg = appendBytesField(msg, 14, m.ResponseMessage)
+	}
+
+	frame := []byte{}
+	if identity != "" {
+		frame = appendBytesField(frame, 1, []byte(identity))
+	}
+	frame = appendBytesField(frame, 14, msg)
+	// Type: MESSAGE
+	frame = appendVarintField(frame, 15, 1)
+	return frame
+}
+
+// FrameStreamsStart 返回单向 Frame Streams 的 START 控制帧
+func FrameStreamsStart() []byte {
+	// 控制帧内容：START，CONTENT_TYPE 字段
+	control := binary.BigEndian.AppendUint32(nil, 0x02)
+	control = binary.BigEndian.AppendUint32(control, 0x01)
+	control = binary.BigEndian.AppendUint32(control, uint32(len(dnstapContentType)))
+	control = append(control, dnstapContentType...)
+
+	frame := binary.BigEndian.AppendUint32(nil, 0)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(control)))
+	return append(frame, control...)
+}
+
+// FrameStreamsData 将数据封装为 Frame Streams 数据帧
+func FrameStreamsData(data []byte) []byte {
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	return append(frame, data...)
+}
@@ -21,18 +21,13 @@
 //
 //	通过下述几行代码，可以一键启动一个基础的 xdns 服务器：
 //
-//	server := xdns.xdnsServer{
-//		ServerConfig: sConf,
-//		Netter: xdns.Netter{
-//			Config: xdns.NetterConfig{
-//			Port: sConf.Port,
-//				MTU:  sConf.MTU,
-//			},
-//		},
-//		Responer: &DullResponser{
-//			ServerConf: sConf,
-//		},
+//	sConf := xdns.ServerConfig{
+//		IP:   net.IPv4(127, 0, 0, 1),
+//		Port: 53,
 //	}
+//	server := xdns.NewXdnsServer(sConf, &xdns.DullResponser{
+//		ServerConf: sConf,
+//	})
 //	server.Start()
 //
 // # 构造、生成 DNS 回复
@@ -114,7 +109,7 @@
 //
 //   - GenWrongKeyWithTag 用于生成错误的，但具有指定 KeyTag 的 DNSKEY RDATA。
 //
-//   - GenKeyWithTag [该函数十分耗时] 用于生成一个具有指定 KeyTag 的 DNSKEY。
+//   - GenerateDNSKEYWithTargetTag 调整公钥中的两个字节，生成一个具有指定 KeyTag 的 DNSKEY。
 //
 // # English
 //
@@ -137,18 +132,13 @@
 //
 // You can quickly start a basic xdns server with the following lines of code:
 //
-//	server := xdns.xdnsServer{
-//		ServerConfig: sConf,
-//		Netter: xdns.Netter{
-//			Config: xdns.NetterConfig{
-//				Port: sConf.Port,
-//				MTU:  sConf.MTU,
-//			},
-//		},
-//		Responser: &DullResponser{
-//			ServerConf: sConf,
-//		},
+//	sConf := xdns.ServerConfig{
+//		IP:   net.IPv4(127, 0, 0, 1),
+//		Port: 53,
 //	}
+//	server := xdns.NewXdnsServer(sConf, &xdns.DullResponser{
+//		ServerConf: sConf,
+//	})
 //	server.Start()
 //
 // # Constructing and Generating DNS Responses
@@ -222,5 +212,5 @@
 //
 //   - GenWrongKeyWithTag: Generates an incorrect DNSKEY with a specified KeyTag.
 //
-//   - GenKeyWithTag [This function is resource-intensive]: Generates a DNSKEY with a specified KeyTag.
+//   - GenerateDNSKEYWithTargetTag: Generates a DNSKEY with a specified KeyTag by adjusting two bytes of its public key.
 package xdns
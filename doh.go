@@ -0,0 +1,324 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// doh.go 文件定义了 DNS over HTTPS 处理器。
+// 其将 HTTP 请求转换为查询交由回复器处理，除 RFC 8484 的线格式外，
+// 还支持 Google / Cloudflare 风格的 application/dns-json 接口，
+// 使浏览器中的测量页面可以直接向实验服务器发起查询。
+//
+// HTTP 端点如下：
+//   - GET /dns-query?dns=<base64url>：RFC 8484 线格式查询
+//   - POST /dns-query：RFC 8484 线格式查询，请求体为 application/dns-message
+//   - GET /resolve?name=example.com&type=A&do=1&cd=0：JSON 格式查询，
+//     请求 /dns-query 时携带 name 参数或 Accept 为 application/dns-json 亦可
+//
+// 回复均允许跨域访问。处理器不经过 XdnsServer，因此不使用其缓存，
+// TLS 可由 http.Server 的 ServeTLS 或前置的反向代理终结。
+
+package xdns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+const (
+	// DoHMessageType 为 RFC 8484 线格式的媒体类型
+	DoHMessageType = "application/dns-message"
+	// DoHJSONType 为 JSON 格式的媒体类型
+	DoHJSONType = "application/dns-json"
+)
+
+// 头部 Z 字段中 AD 及 CD 标志的位置，见 RFC 4035 3.2 节
+const (
+	dohFlagAD uint8 = 0x02
+	dohFlagCD uint8 = 0x01
+)
+
+// DoHJSONQuestion 表示 JSON 格式回复中的一个问题
+type DoHJSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+// DoHJSONRecord 表示 JSON 格式回复中的一条资源记录，Data 为记录数据的文本表示
+type DoHJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// DoHJSONResponse 表示 JSON 格式的回复，字段与 Google / Cloudflare 的接口一致
+type DoHJSONResponse struct {
+	Status     int               `json:"Status"`
+	TC         bool              `json:"TC"`
+	RD         bool              `json:"RD"`
+	RA         bool              `json:"RA"`
+	AD         bool              `json:"AD"`
+	CD         bool              `json:"CD"`
+	Question   []DoHJSONQuestion `json:"Question"`
+	Answer     []DoHJSONRecord   `json:"Answer,omitempty"`
+	Authority  []DoHJSONRecord   `json:"Authority,omitempty"`
+	Additional []DoHJSONRecord   `json:"Additional,omitempty"`
+}
+
+// NewDoHJSONResponse 将回复消息转换为 JSON 格式的回复，OPT 记录将被省略
+func NewDoHJSONResponse(msg dns.DNSMessage) DoHJSONResponse {
+	resp := DoHJSONResponse{
+		Status:   int(msg.Header.RCode),
+		TC:       msg.Header.TC,
+		RD:       msg.Header.RD,
+		RA:       msg.Header.RA,
+		AD:       msg.Header.Z&dohFlagAD != 0,
+		CD:       msg.Header.Z&dohFlagCD != 0,
+		Question: []DoHJSONQuestion{},
+	}
+	for _, q := range msg.Question {
+		resp.Question = append(resp.Question, DoHJSONQuestion{Name: fqdn(q.Name.DomainName), Type: uint16(q.Type)})
+	}
+	records := func(section dns.DNSResponseSection) []DoHJSONRecord {
+		rrs := []DoHJSONRecord{}
+		for _, rr := range section {
+			if rr.Type == dns.DNSRRTypeOPT {
+				continue
+			}
+			rrs = append(rrs, DoHJSONRecord{
+				Name: fqdn(rr.Name.DomainName),
+				Type: uint16(rr.Type),
+				TTL:  rr.TTL,
+				Data: PresentRDATA(rr.RData),
+			})
+		}
+		return rrs
+	}
+	resp.Answer = records(msg.Answer)
+	resp.Authority = records(msg.Authority)
+	resp.Additional = records(msg.Additional)
+	return resp
+}
+
+// fqdn 返回以 "." 结尾的完全限定域名
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// PresentRDATA 返回 RDATA 的主文件（Presentation）格式文本，
+// 未知的类型使用 RFC 3597 的通用格式。
+func PresentRDATA(rdata dns.DNSRRRDATA) string {
+	switch rd := rdata.(type) {
+	case *dns.DNSRDATAA:
+		return rd.Address.String()
+	case *dns.DNSRDATAAAAA:
+		return rd.Address.String()
+	case *dns.DNSRDATANS:
+		return fqdn(rd.NSDNAME)
+	case *dns.DNSRDATACNAME:
+		return fqdn(rd.CNAME)
+	case *dns.DNSRDATADNAME:
+		return fqdn(rd.DNAME)
+	case *dns.DNSRDATAPTR:
+		return fqdn(rd.PTR)
+	case *dns.DNSRDATATXT:
+		quoted := make([]string, len(rd.TXT))
+		for i, txt := range rd.TXT {
+			quoted[i] = strconv.Quote(txt)
+		}
+		return strings.Join(quoted, " ")
+	case *dns.DNSRDATASOA:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", fqdn(rd.MName), fqdn(rd.RName),
+			rd.Serial, rd.Refresh, rd.Retry, rd.Expire, rd.Minimum)
+	case *dns.DNSRDATADS:
+		return fmt.Sprintf("%d %d %d %s", rd.KeyTag, rd.Algorithm, rd.DigestType, strings.ToUpper(hex.EncodeToString(rd.Digest)))
+	case *dns.DNSRDATADNSKEY:
+		return fmt.Sprintf("%d %d %d %s", rd.Flags, rd.Protocol, rd.Algorithm, base64.StdEncoding.EncodeToString(rd.PublicKey))
+	case *dns.DNSRDATARRSIG:
+		return fmt.Sprintf("%s %d %d %d %s %s %d %s %s", dns.FormatDNSType(rd.TypeCovered), rd.Algorithm, rd.Labels, rd.OriginalTTL,
+			sigTime(rd.Expiration), sigTime(rd.Inception), rd.KeyTag, fqdn(rd.SignerName),
+			base64.StdEncoding.EncodeToString(rd.Signature))
+	case *dns.DNSRDATANSEC:
+		types := []string{fqdn(rd.NextDomainName)}
+		for _, t := range rd.TypeBitMaps {
+			types = append(types, dns.FormatDNSType(t))
+		}
+		return strings.Join(types, " ")
+	}
+	return dns.FormatRDATAGeneric(rdata)
+}
+
+// sigTime 返回 RRSIG 时间字段的 YYYYMMDDHHmmSS 格式文本
+func sigTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+// NewDoHHandler 创建 DNS over HTTPS 的 HTTP 处理器，端点详见文件注释
+func NewDoHHandler(r Responser) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dns-query", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("name") != "" || strings.Contains(req.Header.Get("Accept"), DoHJSONType) {
+			serveDoHJSON(r, w, req)
+			return
+		}
+		serveDoHWire(r, w, req)
+	})
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, req *http.Request) {
+		serveDoHJSON(r, w, req)
+	})
+	return mux
+}
+
+// serveDoHWire 处理 RFC 8484 线格式的查询
+func serveDoHWire(r Responser, w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	var packet []byte
+	switch req.Method {
+	case http.MethodGet:
+		data, err := base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil || len(data) == 0 {
+			http.Error(w, "invalid dns parameter", http.StatusBadRequest)
+			return
+		}
+		packet = data
+	case http.MethodPost:
+		if req.Header.Get("Content-Type") != DoHMessageType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(req.Body, 65536))
+		if err != nil || len(data) == 0 || len(data) > 65535 {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		packet = data
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, status := respondDoH(req.Context(), r, req, packet)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err == nil {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minTTL(resp)))
+	}
+	w.Header().Set("Content-Type", DoHMessageType)
+	w.Write(data)
+}
+
+// serveDoHJSON 处理 JSON 格式的查询
+func serveDoHJSON(r Responser, w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	params := req.URL.Query()
+	name := params.Get("name")
+	if name == "" {
+		http.Error(w, "missing name parameter", http.StatusBadRequest)
+		return
+	}
+	qType := dns.DNSRRTypeA
+	if s := params.Get("type"); s != "" {
+		if n, err := strconv.ParseUint(s, 10, 16); err == nil {
+			qType = dns.DNSType(n)
+		} else if t, err := dns.ParseDNSType(strings.ToUpper(s)); err == nil {
+			qType = t
+		} else {
+			http.Error(w, "invalid type parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	qry := dns.DNSMessage{
+		Header: dns.DNSHeader{
+			ID:      0,
+			OpCode:  dns.DNSOpCodeQuery,
+			RD:      true,
+			QDCount: 1,
+		},
+		Question: dns.DNSQuestionSection{
+			{Name: *dns.NewDNSName(strings.TrimSuffix(name, ".")), Type: qType, Class: dns.DNSClassIN},
+		},
+	}
+	if dohFlag(params.Get("cd")) {
+		qry.Header.Z |= dohFlagCD
+	}
+	if dohFlag(params.Get("do")) {
+		qry.Additional = append(qry.Additional, (&dns.DNSOPTRecord{UDPPayloadSize: 65535, DO: true}).ResourceRecord())
+		qry.Header.ARCount = 1
+	}
+
+	data, status := respondDoH(req.Context(), r, req, qry.Encode())
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		http.Error(w, "undecodable response", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", minTTL(resp)))
+	w.Header().Set("Content-Type", DoHJSONType)
+	json.NewEncoder(w).Encode(NewDoHJSONResponse(resp))
+}
+
+// dohFlag 解析 JSON 接口中的布尔参数
+func dohFlag(s string) bool {
+	return s == "1" || strings.EqualFold(s, "true")
+}
+
+// respondDoH 将查询交由回复器处理，并返回回复及 HTTP 状态码
+func respondDoH(ctx context.Context, r Responser, req *http.Request, packet []byte) ([]byte, int) {
+	serverVars.Add("doh_queries", 1)
+	var addr net.Addr
+	if host, port, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		p, _ := strconv.Atoi(port)
+		addr = &net.TCPAddr{IP: net.ParseIP(host), Port: p}
+	}
+	data, err := Respond(ctx, r, ConnectionInfo{
+		Protocol:      ProtocolHTTPS,
+		Address:       addr,
+		Packet:        packet,
+		ReceiveTime:   time.Now(),
+		AllowOversize: true,
+	})
+	switch {
+	case errors.Is(err, ErrDropResponse):
+		// 回复器有意不作回复，以网关超时表示
+		return nil, http.StatusGatewayTimeout
+	case err != nil:
+		return nil, http.StatusInternalServerError
+	}
+	return data, http.StatusOK
+}
+
+// minTTL 返回回复中各记录 TTL 的最小值，用作 HTTP 缓存时间，没有记录时返回 0
+func minTTL(msg dns.DNSMessage) uint32 {
+	ttl, found := uint32(0), false
+	for _, section := range []dns.DNSResponseSection{msg.Answer, msg.Authority, msg.Additional} {
+		for _, rr := range section {
+			if rr.Type == dns.DNSRRTypeOPT {
+				continue
+			}
+			if !found || rr.TTL < ttl {
+				ttl, found = rr.TTL, true
+			}
+		}
+	}
+	return ttl
+}
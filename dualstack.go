@@ -0,0 +1,274 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// dualstack.go 文件定义了 DualStackResponser 双栈回复器，
+// 用于研究解析器及客户端的双栈回退（Happy Eyeballs，RFC 8305）行为：
+// 对同一名称的 A 与 AAAA 查询分别施加独立的延迟及正确性（如 AAAA 指向不可达地址而 A 正常），
+// 并按地址族统计查询数量、同一客户端对同一名称先查询哪一地址族、两者的间隔，
+// 以及窗口内只查询了一个地址族的次数。
+// 统计经由 Stats 取得，同时以 "dual_stack.<a|aaaa>.<queries|first|unpaired>" 计数器导出至 /debug/vars。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// FamilyBehavior 表示对一个地址族查询的回复方式
+type FamilyBehavior int
+
+const (
+	// FamilyWorking 原样返回被包装回复器的回复
+	FamilyWorking FamilyBehavior = iota
+	// FamilyUnreachable 将回答中的地址替换为不可达的地址
+	FamilyUnreachable
+	// FamilyNoData 删除回答中该地址族的记录及其签名，回复 NOERROR 而无回答
+	FamilyNoData
+	// FamilyServFail 回复 SERVFAIL
+	FamilyServFail
+	// FamilyDrop 不作回复，使客户端超时
+	FamilyDrop
+)
+
+// String 返回回复方式的名称
+func (b FamilyBehavior) String() string {
+	switch b {
+	case FamilyWorking:
+		return "working"
+	case FamilyUnreachable:
+		return "unreachable"
+	case FamilyNoData:
+		return "nodata"
+	case FamilyServFail:
+		return "servfail"
+	case FamilyDrop:
+		return "drop"
+	}
+	return fmt.Sprintf("behavior-%d", int(b))
+}
+
+// 不可达地址的默认值，取自文档保留地址（RFC 5737、RFC 3849），通常不会被路由
+var (
+	DefaultUnreachableIPv4 = net.IPv4(192, 0, 2, 1)
+	DefaultUnreachableIPv6 = net.ParseIP("2001:db8::1")
+)
+
+// DefaultPairWindow 为默认的配对窗口，同一客户端对同一名称的 A 与 AAAA 查询在该时长内视为一对
+const DefaultPairWindow = 5 * time.Second
+
+// FamilyPolicy 记录对一个地址族查询的处理方式
+type FamilyPolicy struct {
+	// 回复前的延迟
+	Latency time.Duration
+	// 回复方式
+	Behavior FamilyBehavior
+	// FamilyUnreachable 使用的地址，为 nil 时使用 DefaultUnreachableIPv4 / DefaultUnreachableIPv6
+	Address net.IP
+}
+
+// DualStackStat 记录一个地址族的统计
+type DualStackStat struct {
+	Family string `json:"family"`
+	// 查询数量
+	Queries uint64 `json:"queries"`
+	// 配对中该地址族先被查询的次数
+	First uint64 `json:"first"`
+	// 窗口内只查询了该地址族的次数
+	Unpaired uint64 `json:"unpaired"`
+	// 该地址族先被查询时，到另一地址族查询的平均间隔
+	MeanGap time.Duration `json:"mean_gap_ns"`
+}
+
+// dualStackPair 记录同一客户端对同一名称两个地址族的首次查询时间
+type dualStackPair struct {
+	a, aaaa time.Time
+}
+
+// DualStackResponser 双栈回复器：包装一个回复器，对 A 与 AAAA 查询分别施加独立的延迟及回复方式。
+// 其零值即可使用，此时两个地址族均正常回复，仅进行统计。
+type DualStackResponser struct {
+	Responser Responser
+	// 生效的区域，为空时对全部名称生效
+	Zones []string
+	// 对 A 及 AAAA 查询的处理方式
+	A, AAAA FamilyPolicy
+	// 配对窗口，0 表示 DefaultPairWindow
+	PairWindow time.Duration
+
+	mu    sync.Mutex
+	pairs map[string]*dualStackPair
+	stats [2]DualStackStat
+	gaps  [2]time.Duration
+}
+
+// Response 按地址族的处理方式生成被包装回复器的回复。
+func (d *DualStackResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return d.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (d *DualStackResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil || len(qry.Question) == 0 {
+		return Respond(ctx, d.Responser, connInfo)
+	}
+	q := qry.Question[0]
+	if (q.Type != dns.DNSRRTypeA && q.Type != dns.DNSRRTypeAAAA) || !zonesCover(d.Zones, q.Name.DomainName) {
+		return Respond(ctx, d.Responser, connInfo)
+	}
+	policy := d.A
+	if q.Type == dns.DNSRRTypeAAAA {
+		policy = d.AAAA
+	}
+	d.observe(connInfo.ClientIP().String(), strings.ToLower(q.Name.DomainName), q.Type, time.Now())
+	SpanFromContext(ctx).SetAttribute("xdns.dual_stack", policy.Behavior.String())
+
+	if policy.Latency > 0 {
+		select {
+		case <-time.After(policy.Latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	switch policy.Behavior {
+	case FamilyDrop:
+		return nil, ErrDropResponse
+	case FamilyServFail:
+		return InitServFailResponse(connInfo.Packet), nil
+	}
+
+	data, err := Respond(ctx, d.Responser, connInfo)
+	if err != nil || policy.Behavior == FamilyWorking {
+		return data, err
+	}
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return data, nil
+	}
+	if policy.Behavior == FamilyNoData {
+		resp.Answer = resp.Answer.RemoveByType(q.Type)
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+	for i, rr := range resp.Answer {
+		switch rr.RData.(type) {
+		case *dns.DNSRDATAA:
+			resp.Answer[i].RData = &dns.DNSRDATAA{Address: unreachableAddress(policy.Address, net.IPv4len)}
+		case *dns.DNSRDATAAAAA:
+			resp.Answer[i].RData = &dns.DNSRDATAAAAA{Address: unreachableAddress(policy.Address, net.IPv6len)}
+		}
+	}
+	return resp.Encode(), nil
+}
+
+// unreachableAddress 返回 FamilyUnreachable 使用的地址，size 为地址族的字节长度
+func unreachableAddress(addr net.IP, size int) net.IP {
+	if size == net.IPv4len {
+		if addr != nil && addr.To4() != nil {
+			return addr.To4()
+		}
+		return DefaultUnreachableIPv4.To4()
+	}
+	if addr != nil && addr.To4() == nil {
+		return addr
+	}
+	return DefaultUnreachableIPv6
+}
+
+// familyIndex 返回地址族在统计中的下标，0 为 A，1 为 AAAA
+func familyIndex(rrType dns.DNSType) int {
+	if rrType == dns.DNSRRTypeAAAA {
+		return 1
+	}
+	return 0
+}
+
+// familyName 返回统计中地址族的名称
+func familyName(i int) string {
+	if i == 1 {
+		return "aaaa"
+	}
+	return "a"
+}
+
+// observe 记录一次查询，并与同一客户端对同一名称另一地址族的查询配对
+func (d *DualStackResponser) observe(client, name string, rrType dns.DNSType, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(now)
+	if d.pairs == nil {
+		d.pairs = make(map[string]*dualStackPair)
+	}
+	i := familyIndex(rrType)
+	d.stats[i].Queries++
+	serverVars.Add("dual_stack."+familyName(i)+".queries", 1)
+
+	key := client + "|" + name
+	p, ok := d.pairs[key]
+	if !ok {
+		p = &dualStackPair{}
+		d.pairs[key] = p
+	}
+	mine, other := &p.a, &p.aaaa
+	if i == 1 {
+		mine, other = &p.aaaa, &p.a
+	}
+	if !mine.IsZero() {
+		// 重复的查询，仍以首次查询为准
+		return
+	}
+	*mine = now
+	if other.IsZero() {
+		return
+	}
+	// 配对完成，另一地址族先被查询
+	first := 1 - i
+	d.stats[first].First++
+	d.gaps[first] += now.Sub(*other)
+	serverVars.Add("dual_stack."+familyName(first)+".first", 1)
+}
+
+// expire 结束配对窗口已过的查询，将其中未配对的计为未配对，调用者需持有锁
+func (d *DualStackResponser) expire(now time.Time) {
+	window := d.PairWindow
+	if window <= 0 {
+		window = DefaultPairWindow
+	}
+	for key, p := range d.pairs {
+		i, t := 0, p.a
+		if t.IsZero() || (!p.aaaa.IsZero() && p.aaaa.Before(t)) {
+			i, t = 1, p.aaaa
+		}
+		if now.Sub(t) < window {
+			continue
+		}
+		// 配对完成的查询保留至窗口结束，以免窗口内重复的查询被计为新的未配对查询
+		if p.a.IsZero() || p.aaaa.IsZero() {
+			d.stats[i].Unpaired++
+			serverVars.Add("dual_stack."+familyName(i)+".unpaired", 1)
+		}
+		delete(d.pairs, key)
+	}
+}
+
+// Stats 返回 A 及 AAAA 两个地址族的统计
+func (d *DualStackResponser) Stats() []DualStackStat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(time.Now())
+	stats := make([]DualStackStat, 2)
+	for i := range stats {
+		stats[i] = d.stats[i]
+		stats[i].Family = strings.ToUpper(familyName(i))
+		if stats[i].First > 0 {
+			stats[i].MeanGap = d.gaps[i] / time.Duration(stats[i].First)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// duplicate.go 文件定义了 DuplicateResponser 重复回复器，
+// 其对经由 UDP 的查询，在回复之前（或之后）快速连续地发送若干份回复的副本，
+// 各副本可以原样复制，也可以带有受控的变化（不同的回答、不同的事务 ID、被篡改的签名），
+// 以研究解析器在同一查询收到多份回复时接受并缓存哪一份。
+//
+// 副本直接写入查询所在的 UDP 链接，不经过 Netter 的载荷大小检查；
+// 经由 TCP 等流式链接的查询只有一份回复，不发送副本。
+
+package xdns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// DuplicateVariation 表示副本相对于原回复的变化
+type DuplicateVariation int
+
+const (
+	// DuplicateIdentical 原样复制
+	DuplicateIdentical DuplicateVariation = iota
+	// DuplicateConflicting 将回答部分中的 A / AAAA 记录替换为冲突的地址，
+	// 回复中没有 A / AAAA 记录时不发送该副本
+	DuplicateConflicting
+	// DuplicateWrongID 使用与查询不同的事务 ID
+	DuplicateWrongID
+	// DuplicateBogusSignature 翻转回答部分中 RRSIG 记录的签名，使其验证失败，
+	// 与原回复组成 "一份伪造、一份有效" 的组合，回复中没有 RRSIG 记录时不发送该副本
+	DuplicateBogusSignature
+)
+
+// String 返回变化的名称
+func (v DuplicateVariation) String() string {
+	switch v {
+	case DuplicateIdentical:
+		return "identical"
+	case DuplicateConflicting:
+		return "conflicting"
+	case DuplicateWrongID:
+		return "wrong-id"
+	case DuplicateBogusSignature:
+		return "bogus-signature"
+	}
+	return fmt.Sprintf("variation-%d", int(v))
+}
+
+// DuplicateResponser 重复回复器：包装一个回复器，对经由 UDP 的查询额外发送其回复的副本。
+// 零值的 Copies 为空，此时直接返回被包装回复器的回复。
+type DuplicateResponser struct {
+	Responser Responser
+	// 依次发送的副本的变化方式
+	Copies []DuplicateVariation
+	// 相邻两份回复之间的间隔，0 表示连续发送
+	Interval time.Duration
+	// 为 false 时副本先于原回复发送，为 true 时副本在原回复之后发送
+	After bool
+	// DuplicateConflicting 使用的冲突地址，为 nil 时使用随机地址
+	ConflictIP net.IP
+}
+
+// Response 生成被包装回复器的回复，并发送其副本。
+func (d *DuplicateResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return d.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (d *DuplicateResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	data, err := Respond(ctx, d.Responser, connInfo)
+	if err != nil || len(d.Copies) == 0 || connInfo.Protocol != ProtocolUDP || connInfo.PacketConn == nil || len(data) < 12 {
+		return data, err
+	}
+
+	copies := make([][]byte, 0, len(d.Copies))
+	variations := make([]DuplicateVariation, 0, len(d.Copies))
+	for _, v := range d.Copies {
+		if dup, ok := DuplicateResponse(data, v, d.ConflictIP); ok {
+			copies = append(copies, dup)
+			variations = append(variations, v)
+		}
+	}
+	SpanFromContext(ctx).SetAttribute("xdns.duplicates", len(copies))
+
+	if d.After {
+		// 在原回复由 Netter 发出之后发送副本
+		go func() {
+			for i, dup := range copies {
+				time.Sleep(d.Interval)
+				d.send(connInfo, dup, variations[i])
+			}
+		}()
+		return data, nil
+	}
+	// 副本之间及最后一个副本与原回复之间均间隔 Interval
+	for i, dup := range copies {
+		d.send(connInfo, dup, variations[i])
+		if d.Interval > 0 {
+			select {
+			case <-time.After(d.Interval):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return data, nil
+}
+
+// send 将一份副本写入查询所在的 UDP 链接
+func (d *DuplicateResponser) send(connInfo ConnectionInfo, data []byte, v DuplicateVariation) {
+	if _, err := writePacket(connInfo, data); err != nil {
+		serverVars.Add("duplicate.errors", 1)
+		return
+	}
+	serverVars.Add("duplicate."+v.String()+".sent", 1)
+}
+
+// DuplicateResponse 生成回复的一份副本
+// 其接受参数为：
+//   - data []byte，编码后的回复
+//   - v DuplicateVariation，副本的变化方式
+//   - conflictIP net.IP，DuplicateConflicting 使用的冲突地址，为 nil 时使用随机地址
+//
+// 返回值为：
+//   - []byte，副本
+//   - bool，回复无法解析或变化不适用于该回复时为 false
+func DuplicateResponse(data []byte, v DuplicateVariation, conflictIP net.IP) ([]byte, bool) {
+	if len(data) < 12 {
+		return nil, false
+	}
+	switch v {
+	case DuplicateIdentical:
+		return append([]byte{}, data...), true
+	case DuplicateWrongID:
+		dup := append([]byte{}, data...)
+		id := binary.BigEndian.Uint16(dup)
+		binary.BigEndian.PutUint16(dup, id^uint16(1+xperi.RandomIntn(0xffff)))
+		return dup, true
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return nil, false
+	}
+	changed := false
+	for i, rr := range resp.Answer {
+		switch rdata := rr.RData.(type) {
+		case *dns.DNSRDATAA:
+			if v == DuplicateConflicting {
+				resp.Answer[i].RData = &dns.DNSRDATAA{Address: conflictAddress(conflictIP, rdata.Address, net.IPv4len)}
+				changed = true
+			}
+		case *dns.DNSRDATAAAAA:
+			if v == DuplicateConflicting {
+				resp.Answer[i].RData = &dns.DNSRDATAAAAA{Address: conflictAddress(conflictIP, rdata.Address, net.IPv6len)}
+				changed = true
+			}
+		case *dns.DNSRDATARRSIG:
+			if v == DuplicateBogusSignature && len(rdata.Signature) > 0 {
+				bogus := *rdata
+				bogus.Signature = append([]byte{}, rdata.Signature...)
+				bogus.Signature[len(bogus.Signature)-1] ^= 0xff
+				resp.Answer[i].RData = &bogus
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	return resp.Encode(), true
+}
+
+// conflictAddress 返回与原地址冲突的地址，size 为地址族的字节长度
+func conflictAddress(conflictIP, original net.IP, size int) net.IP {
+	if conflictIP != nil {
+		if size == net.IPv4len {
+			if ip4 := conflictIP.To4(); ip4 != nil {
+				return ip4
+			}
+		} else if conflictIP.To4() == nil {
+			return conflictIP
+		}
+	}
+	for {
+		ip := make(net.IP, size)
+		xperi.RandomRead(ip)
+		if !ip.Equal(original) {
+			return ip
+		}
+	}
+}
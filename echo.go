@@ -0,0 +1,301 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// echo.go 文件定义了 QuestionEchoResponser 问题回显变异回复器。
+// 其改写回复中回显的问题部分（大小写翻转、末尾标签内的 "."、注入的标签、标签中嵌入的空字节），
+// 以探测解析器匹配回复与查询时的严格程度（包括对 0x20 大小写随机化编码的检查）。
+//
+// 解析器是否接受变异后的回复由其后续行为推断：
+// 若客户端在重试窗口内再次发送相同的问题，视为其拒绝了该回复并进行了重试；
+// 若窗口内没有重试，则视为接受。各变异的统计经由 Stats 取得，
+// 同时以 "question_echo.<变异>.<sent|retried|accepted>" 计数器导出至 /debug/vars。
+//
+// 设置了 TC 位的回复不会被变异，以免客户端经由 TCP 的正常重试被误计为拒绝。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// QuestionMutation 表示对回显问题名称的一种变异
+type QuestionMutation int
+
+const (
+	// QuestionMutationNone 不变异，用作对照组
+	QuestionMutationNone QuestionMutation = iota
+	// QuestionMutationCase 翻转问题名称中全部字母的大小写
+	QuestionMutationCase
+	// QuestionMutationTrailingDot 在最后一个标签末尾追加字面量 "."，即 "com" 变为 "com\."
+	QuestionMutationTrailingDot
+	// QuestionMutationInjectLabel 在问题名称之前注入一个标签
+	QuestionMutationInjectLabel
+	// QuestionMutationEmbeddedNull 在第一个标签末尾嵌入空字节，即 "www" 变为 "www\000"
+	QuestionMutationEmbeddedNull
+)
+
+// String 返回变异的名称
+func (m QuestionMutation) String() string {
+	switch m {
+	case QuestionMutationNone:
+		return "none"
+	case QuestionMutationCase:
+		return "case"
+	case QuestionMutationTrailingDot:
+		return "trailing-dot"
+	case QuestionMutationInjectLabel:
+		return "inject-label"
+	case QuestionMutationEmbeddedNull:
+		return "embedded-null"
+	}
+	return fmt.Sprintf("mutation-%d", int(m))
+}
+
+// DefaultRetryWindow 为默认的重试窗口
+const DefaultRetryWindow = 5 * time.Second
+
+// DefaultInjectedLabel 为 QuestionMutationInjectLabel 默认注入的标签
+const DefaultInjectedLabel = "xdns"
+
+// QuestionEchoStat 记录一种变异的接受情况
+type QuestionEchoStat struct {
+	Mutation string `json:"mutation"`
+	// 发送的变异回复数量
+	Sent uint64 `json:"sent"`
+	// 客户端在重试窗口内重试的数量，即被拒绝的数量
+	Retried uint64 `json:"retried"`
+	// 重试窗口内未重试的数量，即被接受的数量
+	Accepted uint64 `json:"accepted"`
+	// 仍处于重试窗口中的数量
+	Pending uint64 `json:"pending"`
+	// 接受率：Accepted / (Accepted + Retried)，尚无结果时为 0
+	AcceptanceRate float64 `json:"acceptance_rate"`
+}
+
+// echoPending 表示一个等待客户端后续行为的变异回复
+type echoPending struct {
+	key      string
+	seq      uint64
+	mutation QuestionMutation
+	deadline time.Time
+}
+
+// QuestionEchoResponser 问题回显变异回复器：包装一个回复器，随机变异其回复中回显的问题名称，
+// 并按客户端的后续行为统计各变异的接受情况。零值的 Mutations 为空，此时不进行变异。
+type QuestionEchoResponser struct {
+	Responser Responser
+	// 可选的变异，每个回复从中随机选择一个，为空时不变异，可包含 QuestionMutationNone 作为对照组
+	Mutations []QuestionMutation
+	// 重试窗口，0 表示 DefaultRetryWindow
+	RetryWindow time.Duration
+	// QuestionMutationInjectLabel 注入的标签，为空时为 DefaultInjectedLabel
+	Label string
+
+	mu sync.Mutex
+	// 客户端及问题与其等待中的变异回复的映射
+	pending map[string]echoPending
+	// 按截止时间排序的等待队列，其中的项可能已被重试取代
+	queue []echoPending
+	seq   uint64
+	stats map[QuestionMutation]*QuestionEchoStat
+}
+
+// Response 生成被包装回复器的回复，并变异其中回显的问题名称。
+func (r *QuestionEchoResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (r *QuestionEchoResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	now := time.Now()
+	key := ""
+	if qry, err := ParseQuery(connInfo); err == nil && len(qry.Question) > 0 {
+		q := qry.Question[0]
+		key = fmt.Sprintf("%s|%s|%d", connInfo.ClientIP(), strings.ToLower(q.Name.DomainName), q.Type)
+		r.observe(key, now)
+	}
+
+	data, err := Respond(ctx, r.Responser, connInfo)
+	if err != nil || len(r.Mutations) == 0 || key == "" || len(data) < 12 || data[2]&0x02 != 0 {
+		return data, err
+	}
+	m := r.Mutations[xperi.RandomIntn(len(r.Mutations))]
+	label := r.Label
+	if label == "" {
+		label = DefaultInjectedLabel
+	}
+	mutated, ok := MutateQuestion(data, m, label)
+	if !ok {
+		return data, nil
+	}
+	SpanFromContext(ctx).SetAttribute("xdns.question_mutation", m.String())
+	r.record(key, m, now)
+	return mutated, nil
+}
+
+// observe 结算到期的等待项，并将客户端对相同问题的再次查询计为对先前变异回复的重试
+func (r *QuestionEchoResponser) observe(key string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now)
+	if p, ok := r.pending[key]; ok {
+		delete(r.pending, key)
+		r.stat(p.mutation).Retried++
+		serverVars.Add("question_echo."+p.mutation.String()+".retried", 1)
+	}
+}
+
+// record 记录一个已发送的变异回复
+func (r *QuestionEchoResponser) record(key string, m QuestionMutation, now time.Time) {
+	window := r.RetryWindow
+	if window <= 0 {
+		window = DefaultRetryWindow
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[string]echoPending)
+	}
+	r.seq++
+	p := echoPending{key: key, seq: r.seq, mutation: m, deadline: now.Add(window)}
+	r.pending[key] = p
+	r.queue = append(r.queue, p)
+	r.stat(m).Sent++
+	serverVars.Add("question_echo."+m.String()+".sent", 1)
+}
+
+// expire 将截止时间已过且未被重试的等待项计为接受，调用者需持有锁
+func (r *QuestionEchoResponser) expire(now time.Time) {
+	i := 0
+	for ; i < len(r.queue) && !r.queue[i].deadline.After(now); i++ {
+		p := r.queue[i]
+		if cur, ok := r.pending[p.key]; ok && cur.seq == p.seq {
+			delete(r.pending, p.key)
+			r.stat(p.mutation).Accepted++
+			serverVars.Add("question_echo."+p.mutation.String()+".accepted", 1)
+		}
+	}
+	r.queue = r.queue[i:]
+}
+
+// stat 返回变异的统计，调用者需持有锁
+func (r *QuestionEchoResponser) stat(m QuestionMutation) *QuestionEchoStat {
+	if r.stats == nil {
+		r.stats = make(map[QuestionMutation]*QuestionEchoStat)
+	}
+	s, ok := r.stats[m]
+	if !ok {
+		s = &QuestionEchoStat{Mutation: m.String()}
+		r.stats[m] = s
+	}
+	return s
+}
+
+// Stats 返回各变异的接受情况，按变异排序
+func (r *QuestionEchoResponser) Stats() []QuestionEchoStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(time.Now())
+	mutations := make([]QuestionMutation, 0, len(r.stats))
+	for m := range r.stats {
+		mutations = append(mutations, m)
+	}
+	sort.Slice(mutations, func(i, j int) bool { return mutations[i] < mutations[j] })
+	stats := make([]QuestionEchoStat, 0, len(mutations))
+	for _, m := range mutations {
+		s := *r.stats[m]
+		s.Pending = s.Sent - s.Retried - s.Accepted
+		if settled := s.Accepted + s.Retried; settled > 0 {
+			s.AcceptanceRate = float64(s.Accepted) / float64(settled)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// MutateQuestion 变异回复中回显的问题名称
+// 其接受参数为：
+//   - data []byte，编码后的回复
+//   - m QuestionMutation，变异方式
+//   - label string，QuestionMutationInjectLabel 注入的标签
+//
+// 返回值为：
+//   - []byte，变异后的回复
+//   - bool，回复无法解析或变异不适用于该名称（如根域名、标签长度已达上限）时为 false
+func MutateQuestion(data []byte, m QuestionMutation, label string) ([]byte, bool) {
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil || len(resp.Question) == 0 {
+		return nil, false
+	}
+	wire := mutateName(dns.EncodeDomainName(&resp.Question[0].Name.DomainName), m, label)
+	if wire == nil {
+		return nil, false
+	}
+	resp.Question[0].Name = *dns.NewDNSNameFromWiredBytes(wire)
+	// 重新编码其余记录的所有者名称，以免其中指向问题名称的压缩指针随问题名称的长度变化而失效
+	for _, section := range []dns.DNSResponseSection{resp.Answer, resp.Authority, resp.Additional} {
+		for i := range section {
+			section[i].Name = *dns.NewDNSName(section[i].Name.DomainName)
+		}
+	}
+	return resp.Encode(), true
+}
+
+// mutateName 变异名称的线路格式，变异不适用时返回 nil
+func mutateName(wire []byte, m QuestionMutation, label string) []byte {
+	if len(wire) <= 1 && m != QuestionMutationNone && m != QuestionMutationInjectLabel {
+		return nil
+	}
+	switch m {
+	case QuestionMutationNone:
+		return wire
+	case QuestionMutationCase:
+		mutated := append([]byte{}, wire...)
+		changed := false
+		for i := 0; i < len(mutated) && mutated[i] != 0; i += int(mutated[i]) + 1 {
+			for j := i + 1; j <= i+int(mutated[i]); j++ {
+				if c := mutated[j] | 0x20; c >= 'a' && c <= 'z' {
+					mutated[j] ^= 0x20
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return mutated
+	case QuestionMutationTrailingDot:
+		last := 0
+		for i := 0; wire[i] != 0; i += int(wire[i]) + 1 {
+			last = i
+		}
+		if wire[last] >= 63 || len(wire) >= 255 {
+			return nil
+		}
+		mutated := append([]byte{}, wire[:last]...)
+		mutated = append(mutated, wire[last]+1)
+		mutated = append(mutated, wire[last+1:len(wire)-1]...)
+		return append(mutated, '.', 0)
+	case QuestionMutationInjectLabel:
+		if label == "" || len(label) > 63 || len(wire)+len(label)+1 > 255 {
+			return nil
+		}
+		mutated := append([]byte{byte(len(label))}, label...)
+		return append(mutated, wire...)
+	case QuestionMutationEmbeddedNull:
+		if wire[0] >= 63 || len(wire) >= 255 {
+			return nil
+		}
+		mutated := append([]byte{wire[0] + 1}, wire[1:1+wire[0]]...)
+		mutated = append(mutated, 0)
+		return append(mutated, wire[1+wire[0]:]...)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// echo_test.go 文件用于对问题回显变异回复器进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 测试 mutateName 函数
+func TestMutateName(t *testing.T) {
+	wire := []byte("\x03www\x07Example\x03com\x00")
+	tests := []struct {
+		m        QuestionMutation
+		expected []byte
+	}{
+		{QuestionMutationNone, wire},
+		{QuestionMutationCase, []byte("\x03WWW\x07eXAMPLE\x03COM\x00")},
+		{QuestionMutationTrailingDot, []byte("\x03www\x07Example\x04com.\x00")},
+		{QuestionMutationInjectLabel, []byte("\x04xdns\x03www\x07Example\x03com\x00")},
+		{QuestionMutationEmbeddedNull, []byte("\x04www\x00\x07Example\x03com\x00")},
+	}
+	for _, tt := range tests {
+		if got := mutateName(wire, tt.m, "xdns"); !bytes.Equal(got, tt.expected) {
+			t.Errorf("function mutateName(%s) failed:\ngot: %q\nexpected: %q", tt.m, got, tt.expected)
+		}
+	}
+	if !bytes.Equal(wire, []byte("\x03www\x07Example\x03com\x00")) {
+		t.Errorf("function mutateName() failed: input modified to %q", wire)
+	}
+
+	// 变异不适用的名称
+	long := append([]byte{63}, append(bytes.Repeat([]byte{'a'}, 63), 0)...)
+	inapplicable := []struct {
+		m     QuestionMutation
+		wire  []byte
+		label string
+	}{
+		{QuestionMutationCase, []byte{0}, ""},
+		{QuestionMutationCase, []byte("\x03123\x00"), ""},
+		{QuestionMutationTrailingDot, []byte{0}, ""},
+		{QuestionMutationTrailingDot, long, ""},
+		{QuestionMutationEmbeddedNull, long, ""},
+		{QuestionMutationInjectLabel, wire, ""},
+		{QuestionMutationInjectLabel, wire, strings.Repeat("a", 64)},
+		{QuestionMutation(99), wire, ""},
+	}
+	for _, tt := range inapplicable {
+		if got := mutateName(tt.wire, tt.m, tt.label); got != nil {
+			t.Errorf("function mutateName(%s, %q) failed:\ngot: %q\nexpected: nil", tt.m, tt.wire, got)
+		}
+	}
+}
+
+// 测试 MutateQuestion 函数
+func TestMutateQuestion(t *testing.T) {
+	resp, err := (&DullResponser{}).Response(newTestQuery("www.example.com", dns.DNSRRTypeA, 0))
+	if err != nil {
+		t.Fatalf("method DullResponser Response() failed:\n%v", err)
+	}
+	mutated, ok := MutateQuestion(resp, QuestionMutationInjectLabel, "xdns")
+	if !ok {
+		t.Fatalf("function MutateQuestion() failed: mutation not applied")
+	}
+	msg := dns.DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(mutated, 0); err != nil {
+		t.Fatalf("function MutateQuestion() failed: mutated response cannot be decoded.\n%v", err)
+	}
+	if msg.Question[0].Name.DomainName != "xdns.www.example.com" {
+		t.Errorf("function MutateQuestion() failed:\ngot: %s\nexpected: xdns.www.example.com", msg.Question[0].Name.DomainName)
+	}
+	// 其余记录的所有者名称不受影响
+	if len(msg.Answer) == 0 || msg.Answer[0].Name.DomainName != "www.example.com" {
+		t.Errorf("function MutateQuestion() failed: answer changed:\n%s", msg.String())
+	}
+
+	if _, ok := MutateQuestion([]byte{0x12, 0x34}, QuestionMutationCase, ""); ok {
+		t.Errorf("function MutateQuestion() failed: malformed response mutated")
+	}
+}
+
+// 测试 QuestionEchoResponser 的回复
+func TestQuestionEchoResponser(t *testing.T) {
+	r := &QuestionEchoResponser{Responser: &DullResponser{}, Mutations: []QuestionMutation{QuestionMutationCase}}
+	resp, err := r.Response(newTestQuery("www.example.com", dns.DNSRRTypeA, 0))
+	if err != nil {
+		t.Fatalf("method QuestionEchoResponser Response() failed:\n%v", err)
+	}
+	msg := dns.DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(resp, 0); err != nil || msg.Question[0].Name.DomainName != "WWW.EXAMPLE.COM" {
+		t.Errorf("method QuestionEchoResponser Response() failed:\ngot: %s\nexpected: WWW.EXAMPLE.COM", msg.Question[0].Name.DomainName)
+	}
+	if stats := r.Stats(); len(stats) != 1 || stats[0].Mutation != "case" || stats[0].Sent != 1 || stats[0].Pending != 1 {
+		t.Errorf("method QuestionEchoResponser Stats() failed:\ngot: %+v", stats)
+	}
+
+	// 未配置变异时不改写回复
+	plain, _ := (&DullResponser{}).Response(newTestQuery("www.example.com", dns.DNSRRTypeA, 0))
+	resp, err = (&QuestionEchoResponser{Responser: &DullResponser{}}).Response(newTestQuery("www.example.com", dns.DNSRRTypeA, 0))
+	if err != nil || !bytes.Equal(resp, plain) {
+		t.Errorf("method QuestionEchoResponser Response() failed: response mutated without mutations")
+	}
+}
+
+// 测试 QuestionEchoResponser 按客户端的后续行为统计接受情况
+func TestQuestionEchoResponserStats(t *testing.T) {
+	r := &QuestionEchoResponser{RetryWindow: time.Minute}
+	start := time.Now().Add(-time.Hour)
+
+	// 窗口内重试，计为拒绝
+	r.observe("a", start)
+	r.record("a", QuestionMutationCase, start)
+	r.observe("a", start.Add(time.Second))
+	// 窗口内未重试，计为接受
+	r.record("b", QuestionMutationCase, start)
+	r.record("c", QuestionMutationNone, start)
+	r.observe("c", start.Add(2*time.Minute))
+	// 尚在窗口内
+	r.record("d", QuestionMutationTrailingDot, time.Now())
+
+	expected := []QuestionEchoStat{
+		{Mutation: "none", Sent: 1, Accepted: 1, AcceptanceRate: 1},
+		{Mutation: "case", Sent: 2, Retried: 1, Accepted: 1, AcceptanceRate: 0.5},
+		{Mutation: "trailing-dot", Sent: 1, Pending: 1},
+	}
+	stats := r.Stats()
+	if len(stats) != len(expected) {
+		t.Fatalf("method QuestionEchoResponser Stats() failed:\ngot: %+v\nexpected: %+v", stats, expected)
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			t.Errorf("method QuestionEchoResponser Stats() failed:\ngot: %+v\nexpected: %+v", stats[i], expected[i])
+		}
+	}
+}
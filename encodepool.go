@@ -0,0 +1,79 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// encodepool.go 文件实现了回复的池化编码。
+// 服务器为每个查询在请求上下文中登记一个编码缓冲区表，回复器以 EncodeResponse 编码回复时，
+// 缓冲区借自 dns 包的编码缓冲池（按消息的 Size 选取）并登记于表中，
+// 服务器在回复经 Netter.Send 写出、并写入缓存之后将其全部归还。
+// 数十 KB 的攻击回复因此不再为每个查询分配新的缓冲区。
+//
+// 经由 EncodeResponse 得到的回复只在当前查询的处理期间有效：
+// 回复器返回之后仍引用回复的包装回复器须保留其副本，
+// 如 TeeResponser 的异步镜像、CoalescingResponser 共享给其他查询的结果。
+// 回复器返回错误（包括超时及 ErrDropResponse）时，服务器不归还缓冲区，
+// 以免仍在运行的协程（如 LateResponser 的延迟发送）使用已被复用的缓冲区，这些缓冲区交由垃圾回收器回收。
+// 请求上下文之外（如 DoH 处理器、直接调用 Response）EncodeResponse 等同于 Encode。
+
+package xdns
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// encodeBuffers 为当前查询借自编码缓冲池的缓冲区表
+type encodeBuffers struct {
+	mu      sync.Mutex
+	buffers [][]byte
+	closed  bool
+}
+
+// withEncodeBuffers 返回登记有编码缓冲区表的上下文，及结束登记的函数 release。
+// 调用 release 后 EncodeResponse 不再登记缓冲区；reuse 为 true 时已登记的缓冲区被归还编码缓冲池，
+// 调用者须保证此时已没有对其中任何回复的引用。
+func withEncodeBuffers(ctx context.Context) (context.Context, func(reuse bool)) {
+	b := &encodeBuffers{}
+	release := func(reuse bool) {
+		b.mu.Lock()
+		buffers := b.buffers
+		b.buffers, b.closed = nil, true
+		b.mu.Unlock()
+		if len(buffers) == 0 {
+			return
+		}
+		if !reuse {
+			serverVars.Add("encode_buffers.abandoned", int64(len(buffers)))
+			return
+		}
+		serverVars.Add("encode_buffers.reused", int64(len(buffers)))
+		for _, buffer := range buffers {
+			dns.ReleaseEncodeBuffer(buffer)
+		}
+	}
+	return context.WithValue(ctx, encodeBuffersKey, b), release
+}
+
+// EncodeResponse 编码回复，回复器可以用其代替 msg.Encode()。
+// 上下文由服务器创建时，结果写入借自编码缓冲池的缓冲区，并在回复发送之后被归还，
+// 此后调用者不应再引用结果；否则等同于 msg.Encode()。
+// 其接受参数为：
+//   - ctx context.Context，请求上下文
+//   - msg *dns.DNSMessage，待编码的回复
+//
+// 返回值为：
+//   - []byte，编码后的回复
+func EncodeResponse(ctx context.Context, msg *dns.DNSMessage) []byte {
+	b, ok := ctx.Value(encodeBuffersKey).(*encodeBuffers)
+	if !ok {
+		return msg.Encode()
+	}
+	data := msg.EncodePooled()
+	b.mu.Lock()
+	// 登记结束后编码的缓冲区不再登记，交由垃圾回收器回收
+	if !b.closed {
+		b.buffers = append(b.buffers, data)
+	}
+	b.mu.Unlock()
+	return data
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// encodepool_test.go 文件用于对回复的池化编码及服务器对编码缓冲区的归还进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// pooledResponser 以 EncodeResponse 编码 NXDOMAIN 回复，并返回设定的错误
+type pooledResponser struct {
+	err  error
+	data []byte
+}
+
+func (r *pooledResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+func (r *pooledResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return nil, err
+	}
+	resp := InitNXDOMAIN(qry)
+	FixCount(&resp)
+	r.data = EncodeResponse(ctx, &resp)
+	return r.data, r.err
+}
+
+// serverVar 返回服务器计数 name 的当前值
+func serverVar(name string) int64 {
+	if v, ok := serverVars.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// 测试 EncodeResponse 函数对编码缓冲区的登记
+func TestEncodeResponse(t *testing.T) {
+	qry, _ := ParseQuery(newTestQuery("www.test", dns.DNSRRTypeA, 0))
+	resp := InitNXDOMAIN(qry)
+	FixCount(&resp)
+	expected := resp.Encode()
+
+	// 上下文之外等同于 Encode
+	if got := EncodeResponse(context.Background(), &resp); !bytes.Equal(got, expected) {
+		t.Errorf("function EncodeResponse() failed:\ngot: %v\nexpected: %v", got, expected)
+	}
+
+	ctx, release := withEncodeBuffers(context.Background())
+	buffers := ctx.Value(encodeBuffersKey).(*encodeBuffers)
+	for i := 0; i < 2; i++ {
+		if got := EncodeResponse(ctx, &resp); !bytes.Equal(got, expected) {
+			t.Errorf("function EncodeResponse() failed:\ngot: %v\nexpected: %v", got, expected)
+		}
+	}
+	if len(buffers.buffers) != 2 {
+		t.Errorf("function EncodeResponse() failed: %d buffers registered, expected 2", len(buffers.buffers))
+	}
+
+	reused := serverVar("encode_buffers.reused")
+	release(true)
+	if got := serverVar("encode_buffers.reused") - reused; got != 2 {
+		t.Errorf("function withEncodeBuffers() failed: %d buffers reused, expected 2", got)
+	}
+	// 登记结束后编码的缓冲区不再登记
+	EncodeResponse(ctx, &resp)
+	if len(buffers.buffers) != 0 {
+		t.Errorf("function EncodeResponse() failed: buffer registered after release")
+	}
+}
+
+// 测试服务器仅在回复发送之后、且回复器未返回错误时归还编码缓冲区
+func TestHandleConnectionEncodeBuffers(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("function net.ListenPacket() failed:\n%v", err)
+	}
+	defer serverConn.Close()
+	clientConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("function net.ListenPacket() failed:\n%v", err)
+	}
+	defer clientConn.Close()
+
+	discard := log.New(io.Discard, "", 0)
+	tests := []struct {
+		name      string
+		err       error
+		reused    int64
+		abandoned int64
+	}{
+		{"answered", nil, 1, 0},
+		{"dropped", ErrDropResponse, 0, 1},
+		{"failed", io.ErrUnexpectedEOF, 0, 1},
+	}
+	for _, tt := range tests {
+		r := &pooledResponser{err: tt.err}
+		s := &XdnsServer{Logger: discard, Netter: Netter{NetterLogger: discard}, Responer: r, ctx: context.Background()}
+		connInfo := newTestQuery("www.test", dns.DNSRRTypeA, 0)
+		connInfo.PacketConn, connInfo.Address = serverConn, clientConn.LocalAddr()
+
+		reused, abandoned := serverVar("encode_buffers.reused"), serverVar("encode_buffers.abandoned")
+		s.HandleConnection(connInfo)
+		if got := serverVar("encode_buffers.reused") - reused; got != tt.reused {
+			t.Errorf("method XdnsServer HandleConnection() failed: %s: %d buffers reused, expected %d", tt.name, got, tt.reused)
+		}
+		if got := serverVar("encode_buffers.abandoned") - abandoned; got != tt.abandoned {
+			t.Errorf("method XdnsServer HandleConnection() failed: %s: %d buffers abandoned, expected %d", tt.name, got, tt.abandoned)
+		}
+		if tt.err != nil {
+			continue
+		}
+
+		// 归还之前已写出的回复完整送达
+		buf := make([]byte, 512)
+		clientConn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := clientConn.ReadFrom(buf)
+		resp := dns.DNSMessage{}
+		if err != nil {
+			t.Errorf("method XdnsServer HandleConnection() failed: %s: no response:\n%v", tt.name, err)
+		} else if _, err := resp.DecodeFromBuffer(buf[:n], 0); err != nil || resp.Header.ID != 0x1234 || resp.Header.RCode != dns.DNSResponseCodeNXDomain {
+			t.Errorf("method XdnsServer HandleConnection() failed: %s: unexpected response %x", tt.name, buf[:n])
+		}
+	}
+}
+
+// 测试 TeeResponser 镜像的是回复的副本，而不是借自编码缓冲池的缓冲区
+func TestTeeResponserCopiesResponse(t *testing.T) {
+	r := &pooledResponser{}
+	tee := &TeeResponser{
+		Config: TeeResponserConfig{Responser: r, IncludeResponse: true},
+		queue:  make(chan teeItem, 1),
+	}
+	ctx, release := withEncodeBuffers(context.Background())
+	data, err := tee.ResponseContext(ctx, newTestQuery("www.test", dns.DNSRRTypeA, 0))
+	if err != nil {
+		t.Fatalf("method TeeResponser ResponseContext() failed:\n%v", err)
+	}
+	item := <-tee.queue
+	if !bytes.Equal(item.response, data) {
+		t.Fatalf("method TeeResponser ResponseContext() failed:\ngot: %v\nexpected: %v", item.response, data)
+	}
+	expected := append([]byte{}, data...)
+	release(true)
+	// 归还后缓冲区被其他回复覆盖，镜像的回复不受影响
+	data[0], data[1] = 0xff, 0xff
+	if &item.response[0] == &data[0] || !bytes.Equal(item.response, expected) {
+		t.Errorf("method TeeResponser ResponseContext() failed: mirrored response shares the pooled buffer")
+	}
+}
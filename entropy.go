@@ -0,0 +1,311 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// entropy.go 文件定义了 EntropyAnalyzer 源端口及事务 ID 熵分析器，
+// 其按客户端记录每个 UDP 查询的源端口及事务 ID，并计算二者分布的熵估计，
+// 用于量化被测解析器抵御缓存投毒（Kaminsky 式伪造回复）的能力：
+// 攻击者需要猜中的空间约为 2^(源端口熵 + 事务 ID 熵)。
+//
+// 熵估计均基于经验分布，不超过 log2(样本数)，样本不足时会低估真实的熵，
+// 因此报告同时给出样本数所能体现的上限 SampleBits。
+// 相邻查询差值的熵可以识别递增分配的源端口或事务 ID，其分布虽广却易于预测。
+//
+// HTTP 端点如下：
+//   - GET /entropy?client=10.0.0.1&window=1m：返回熵报告，
+//     client 为空时返回全部客户端，window 为时间窗口长度，为空时不按时间窗口统计
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SpoofSample 表示一次 UDP 查询的源端口及事务 ID
+type SpoofSample struct {
+	// 收到查询的时间
+	Time time.Time `json:"time"`
+	// 源端口
+	Port uint16 `json:"port"`
+	// 事务 ID
+	ID uint16 `json:"id"`
+}
+
+// FieldEntropy 表示一个 16 位字段（源端口或事务 ID）的分布统计及熵估计，单位为比特
+type FieldEntropy struct {
+	// 不同取值的数量
+	Unique int `json:"unique"`
+	// 最小及最大取值
+	Min uint16 `json:"min"`
+	Max uint16 `json:"max"`
+	// 经验分布的香农熵
+	Shannon float64 `json:"shannon_bits"`
+	// 经 Miller-Madow 偏差修正的香农熵，以 16 比特为上限
+	MillerMadow float64 `json:"miller_madow_bits"`
+	// 最小熵：-log2(出现最多的取值的频率)，即攻击者单次猜测成功率的度量
+	MinEntropy float64 `json:"min_entropy_bits"`
+	// 相邻查询差值的香农熵，递增分配时接近 0
+	Delta float64 `json:"delta_bits"`
+}
+
+// EntropyWindow 表示一个时间窗口内的熵估计
+type EntropyWindow struct {
+	Start   time.Time    `json:"start"`
+	Samples int          `json:"samples"`
+	Port    FieldEntropy `json:"port"`
+	ID      FieldEntropy `json:"id"`
+}
+
+// EntropyReport 表示一个客户端的熵报告
+type EntropyReport struct {
+	Client  string       `json:"client"`
+	Samples int          `json:"samples"`
+	First   time.Time    `json:"first"`
+	Last    time.Time    `json:"last"`
+	Port    FieldEntropy `json:"port"`
+	ID      FieldEntropy `json:"id"`
+	// 样本数量所能体现的熵的上限，即 log2(Samples)
+	SampleBits float64 `json:"sample_bits"`
+	// 伪造回复需要猜测的比特数估计：源端口与事务 ID 各自的 Miller-Madow 估计与差值熵中较小者之和，
+	// 递增分配的字段可由上一次的取值推测，因此按其差值熵计
+	SpoofBits float64 `json:"spoof_bits"`
+	// 按时间窗口统计的熵估计，未指定窗口时为空
+	Windows []EntropyWindow `json:"windows,omitempty"`
+}
+
+// EntropyAnalyzer 熵分析器：按客户端记录 UDP 查询的源端口及事务 ID。
+type EntropyAnalyzer struct {
+	// 每个客户端保留的最大样本数量，0 表示不限制
+	Limit int
+
+	samples map[string][]SpoofSample
+	mu      sync.RWMutex
+}
+
+// NewEntropyAnalyzer 创建一个新的熵分析器
+func NewEntropyAnalyzer(limit int) *EntropyAnalyzer {
+	return &EntropyAnalyzer{
+		Limit:   limit,
+		samples: make(map[string][]SpoofSample),
+	}
+}
+
+// Observe 记录一次查询的源端口及事务 ID，非 UDP 查询及不完整的数据包将被忽略
+func (a *EntropyAnalyzer) Observe(connInfo ConnectionInfo) {
+	addr, ok := connInfo.Address.(*net.UDPAddr)
+	if !ok || connInfo.Protocol != ProtocolUDP || len(connInfo.Packet) < 2 {
+		return
+	}
+	receiveTime := connInfo.ReceiveTime
+	if receiveTime.IsZero() {
+		receiveTime = time.Now()
+	}
+	key := addr.IP.String()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	samples := append(a.samples[key], SpoofSample{
+		Time: receiveTime,
+		Port: uint16(addr.Port),
+		ID:   uint16(connInfo.Packet[0])<<8 | uint16(connInfo.Packet[1]),
+	})
+	if a.Limit > 0 && len(samples) > a.Limit {
+		samples = samples[len(samples)-a.Limit:]
+	}
+	a.samples[key] = samples
+}
+
+// Clients 返回全部已记录的客户端
+func (a *EntropyAnalyzer) Clients() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	clients := make([]string, 0, len(a.samples))
+	for client := range a.samples {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+// Samples 返回指定客户端的样本，按收到查询的时间排序
+func (a *EntropyAnalyzer) Samples(client string) []SpoofSample {
+	a.mu.RLock()
+	samples := append([]SpoofSample{}, a.samples[client]...)
+	a.mu.RUnlock()
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+	return samples
+}
+
+// Report 计算指定客户端的熵报告
+// 其接受参数为：
+//   - client string，客户端 IP 地址
+//   - window time.Duration，时间窗口长度，小于等于 0 时不按时间窗口统计
+//
+// 返回值为：
+//   - EntropyReport，熵报告，客户端没有样本时其 Samples 为 0
+func (a *EntropyAnalyzer) Report(client string, window time.Duration) EntropyReport {
+	samples := a.Samples(client)
+	report := EntropyReport{
+		Client:  client,
+		Samples: len(samples),
+	}
+	if len(samples) == 0 {
+		return report
+	}
+	report.First = samples[0].Time
+	report.Last = samples[len(samples)-1].Time
+	report.Port, report.ID = sampleEntropy(samples)
+	report.SampleBits = math.Log2(float64(len(samples)))
+	report.SpoofBits = report.Port.guessBits() + report.ID.guessBits()
+
+	if window > 0 {
+		start := 0
+		for i := 1; i <= len(samples); i++ {
+			if i < len(samples) && samples[i].Time.Sub(samples[start].Time) < window {
+				continue
+			}
+			port, id := sampleEntropy(samples[start:i])
+			report.Windows = append(report.Windows, EntropyWindow{
+				Start:   samples[start].Time,
+				Samples: i - start,
+				Port:    port,
+				ID:      id,
+			})
+			start = i
+		}
+	}
+	return report
+}
+
+// Reports 计算全部客户端的熵报告，参数与 Report 相同
+func (a *EntropyAnalyzer) Reports(window time.Duration) []EntropyReport {
+	reports := []EntropyReport{}
+	for _, client := range a.Clients() {
+		reports = append(reports, a.Report(client, window))
+	}
+	return reports
+}
+
+// Reset 清空全部样本
+func (a *EntropyAnalyzer) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.samples = make(map[string][]SpoofSample)
+}
+
+// sampleEntropy 计算样本中源端口及事务 ID 的熵估计
+func sampleEntropy(samples []SpoofSample) (FieldEntropy, FieldEntropy) {
+	ports := make([]uint16, len(samples))
+	ids := make([]uint16, len(samples))
+	for i, sample := range samples {
+		ports[i], ids[i] = sample.Port, sample.ID
+	}
+	return fieldEntropy(ports), fieldEntropy(ids)
+}
+
+// fieldEntropy 计算 16 位字段取值序列的分布统计及熵估计
+func fieldEntropy(values []uint16) FieldEntropy {
+	if len(values) == 0 {
+		return FieldEntropy{}
+	}
+	counts := map[uint16]int{}
+	deltas := map[uint16]int{}
+	e := FieldEntropy{Min: values[0], Max: values[0]}
+	for i, v := range values {
+		counts[v]++
+		if v < e.Min {
+			e.Min = v
+		}
+		if v > e.Max {
+			e.Max = v
+		}
+		if i > 0 {
+			deltas[v-values[i-1]]++
+		}
+	}
+	e.Unique = len(counts)
+	e.Shannon = shannonEntropy(counts, len(values))
+	e.Delta = shannonEntropy(deltas, len(values)-1)
+
+	// Miller-Madow 修正：H + (K - 1) / (2N ln 2)
+	e.MillerMadow = e.Shannon + float64(e.Unique-1)/(2*float64(len(values))*math.Ln2)
+	if e.MillerMadow > 16 {
+		e.MillerMadow = 16
+	}
+	most := 0
+	for _, c := range counts {
+		if c > most {
+			most = c
+		}
+	}
+	e.MinEntropy = -math.Log2(float64(most) / float64(len(values)))
+	return e
+}
+
+// guessBits 返回猜测该字段下一个取值所需的比特数估计
+func (e FieldEntropy) guessBits() float64 {
+	return math.Min(e.MillerMadow, e.Delta)
+}
+
+// shannonEntropy 返回计数所表示的经验分布的香农熵，单位为比特
+func shannonEntropy(counts map[uint16]int, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// EntropyResponser 熵分析回复器：包装一个回复器，并记录经过的每个 UDP 查询的源端口及事务 ID。
+type EntropyResponser struct {
+	Responser Responser
+	Analyzer  *EntropyAnalyzer
+}
+
+// Response 记录查询后生成被包装回复器的回复。
+func (r *EntropyResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (r *EntropyResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	r.Analyzer.Observe(connInfo)
+	return Respond(ctx, r.Responser, connInfo)
+}
+
+// NewEntropyHandler 创建熵分析器的 HTTP 处理器，端点详见文件注释
+func NewEntropyHandler(a *EntropyAnalyzer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/entropy", func(w http.ResponseWriter, r *http.Request) {
+		var window time.Duration
+		if s := r.URL.Query().Get("window"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if client := r.URL.Query().Get("client"); client != "" {
+			encoder.Encode(a.Report(client, window))
+			return
+		}
+		encoder.Encode(a.Reports(window))
+	})
+	return mux
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// entropy_test.go 文件用于对源端口及事务 ID 熵分析器进行测试。
+
+package xdns
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// entropyTestStart 为测试样本的起始时间
+var entropyTestStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// observeSample 记录一次来自 client 的查询，i 决定其收到的时间
+func observeSample(a *EntropyAnalyzer, client string, i int, port int, id uint16) {
+	a.Observe(ConnectionInfo{
+		Protocol:    ProtocolUDP,
+		Address:     &net.UDPAddr{IP: net.ParseIP(client), Port: port},
+		Packet:      []byte{byte(id >> 8), byte(id), 0x01, 0x00},
+		ReceiveTime: entropyTestStart.Add(time.Duration(i) * time.Second),
+	})
+}
+
+// almostEqual 判断两个熵估计是否近似相等
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// 测试 fieldEntropy 函数
+func TestFieldEntropy(t *testing.T) {
+	// 固定取值
+	e := fieldEntropy([]uint16{53, 53, 53, 53})
+	if e.Unique != 1 || e.Shannon != 0 || e.MillerMadow != 0 || e.MinEntropy != 0 || e.Delta != 0 {
+		t.Errorf("function fieldEntropy() failed: constant values:\ngot: %+v", e)
+	}
+
+	// 递增分配：分布广但差值恒定
+	e = fieldEntropy([]uint16{65534, 65535, 0, 1, 2, 3, 4, 5})
+	if e.Unique != 8 || !almostEqual(e.Shannon, 3) || e.Delta != 0 || e.guessBits() != 0 || e.Min != 0 || e.Max != 65535 {
+		t.Errorf("function fieldEntropy() failed: sequential values:\ngot: %+v", e)
+	}
+	if expected := 3 + 7/(16*math.Ln2); !almostEqual(e.MillerMadow, expected) {
+		t.Errorf("function fieldEntropy() failed: Miller-Madow:\ngot: %v\nexpected: %v", e.MillerMadow, expected)
+	}
+
+	// 最小熵由出现最多的取值决定
+	e = fieldEntropy([]uint16{1, 1, 1, 2})
+	if !almostEqual(e.MinEntropy, -math.Log2(0.75)) {
+		t.Errorf("function fieldEntropy() failed: min-entropy:\ngot: %v\nexpected: %v", e.MinEntropy, -math.Log2(0.75))
+	}
+
+	if e := fieldEntropy(nil); e != (FieldEntropy{}) {
+		t.Errorf("function fieldEntropy() failed: empty values:\ngot: %+v", e)
+	}
+}
+
+// 测试 EntropyAnalyzer 的 Observe 方法
+func TestEntropyAnalyzerObserve(t *testing.T) {
+	a := NewEntropyAnalyzer(3)
+	for i := 0; i < 5; i++ {
+		observeSample(a, "192.0.2.1", i, 10000+i, uint16(i))
+	}
+	// 非 UDP 查询及不完整的数据包被忽略
+	a.Observe(ConnectionInfo{Protocol: ProtocolTCP, Address: &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 1}, Packet: []byte{0, 1}})
+	a.Observe(ConnectionInfo{Protocol: ProtocolUDP, Address: &net.UDPAddr{IP: net.ParseIP("192.0.2.3"), Port: 1}, Packet: []byte{0}})
+
+	if clients := a.Clients(); len(clients) != 1 || clients[0] != "192.0.2.1" {
+		t.Errorf("method EntropyAnalyzer Clients() failed:\ngot: %v\nexpected: [192.0.2.1]", clients)
+	}
+	// 仅保留最近 Limit 个样本
+	samples := a.Samples("192.0.2.1")
+	if len(samples) != 3 || samples[0].Port != 10002 || samples[0].ID != 2 || samples[2].ID != 4 {
+		t.Errorf("method EntropyAnalyzer Samples() failed:\ngot: %+v", samples)
+	}
+
+	a.Reset()
+	if len(a.Clients()) != 0 {
+		t.Errorf("method EntropyAnalyzer Reset() failed: clients remain")
+	}
+}
+
+// 测试 EntropyAnalyzer 的 Report 方法
+func TestEntropyAnalyzerReport(t *testing.T) {
+	a := NewEntropyAnalyzer(0)
+	// 端口固定、事务 ID 两两不同且无规律
+	ids := []uint16{0x9a41, 0x13f7, 0xc2e0, 0x5b19, 0x0e88, 0xf3a2, 0x7c5d, 0x2b06}
+	for i, id := range ids {
+		observeSample(a, "192.0.2.1", i, 53000, id)
+	}
+
+	report := a.Report("192.0.2.1", 0)
+	if report.Samples != 8 || !report.First.Equal(entropyTestStart) || !report.Last.Equal(entropyTestStart.Add(7*time.Second)) {
+		t.Errorf("method EntropyAnalyzer Report() failed:\ngot: %+v", report)
+	}
+	if report.Port.Shannon != 0 || !almostEqual(report.ID.Shannon, 3) || !almostEqual(report.SampleBits, 3) {
+		t.Errorf("method EntropyAnalyzer Report() failed: port %+v, id %+v, sample bits %v", report.Port, report.ID, report.SampleBits)
+	}
+	// 端口无需猜测，伪造所需比特数仅来自事务 ID
+	if !almostEqual(report.SpoofBits, report.ID.guessBits()) || report.SpoofBits <= 0 {
+		t.Errorf("method EntropyAnalyzer Report() failed: spoof bits %v, expected %v", report.SpoofBits, report.ID.guessBits())
+	}
+	if len(report.Windows) != 0 {
+		t.Errorf("method EntropyAnalyzer Report() failed: unexpected windows %+v", report.Windows)
+	}
+
+	// 按 3 秒的窗口统计：[0, 3)、[3, 6)、[6, 8)
+	report = a.Report("192.0.2.1", 3*time.Second)
+	if len(report.Windows) != 3 || report.Windows[0].Samples != 3 || report.Windows[1].Samples != 3 || report.Windows[2].Samples != 2 ||
+		!report.Windows[1].Start.Equal(entropyTestStart.Add(3*time.Second)) {
+		t.Errorf("method EntropyAnalyzer Report() failed: windows:\ngot: %+v", report.Windows)
+	}
+
+	if report := a.Report("192.0.2.9", 0); report.Samples != 0 {
+		t.Errorf("method EntropyAnalyzer Report() failed: unknown client has %d samples", report.Samples)
+	}
+}
+
+// 测试熵分析器的 HTTP 处理器
+func TestEntropyHandler(t *testing.T) {
+	a := NewEntropyAnalyzer(0)
+	observeSample(a, "192.0.2.1", 0, 53000, 1)
+	observeSample(a, "192.0.2.2", 0, 53000, 1)
+	handler := NewEntropyHandler(a)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/entropy", nil))
+	reports := []EntropyReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &reports); err != nil || len(reports) != 2 {
+		t.Errorf("function NewEntropyHandler() failed: GET /entropy:\ngot: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/entropy?client=192.0.2.2&window=1m", nil))
+	report := EntropyReport{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || report.Client != "192.0.2.2" || len(report.Windows) != 1 {
+		t.Errorf("function NewEntropyHandler() failed: GET /entropy?client=192.0.2.2:\ngot: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/entropy?window=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("function NewEntropyHandler() failed: invalid window:\ngot: %d\nexpected: %d", rec.Code, http.StatusBadRequest)
+	}
+}
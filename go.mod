@@ -1,5 +1,16 @@
 module github.com/tochusc/xdns
 
-go 1.23.2
+go 1.25.0
 
-require golang.org/x/exp v0.0.0-20250218142911-aa4b98e5adaa // indirect
+// xperi 有意生成小于 1024 比特的 RSA 密钥
+godebug rsa1024min=0
+
+require (
+	go.etcd.io/bbolt v1.3.11
+	go.starlark.net v0.0.0-20260908191801-89a6a09411d5
+)
+
+require (
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.42.0 // indirect
+)
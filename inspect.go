@@ -0,0 +1,383 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// inspect.go 文件定义了运行中服务器状态的只读检视 API，供监控实验的仪表盘使用，
+// 其提供以下端点，均仅接受 GET 请求并返回 JSON：
+//   - /inspect：以下全部内容的汇总，查询样本至多 20 条
+//   - /inspect/zones：已载入的区域，包括 RRset 数量、各类型的 RRset 数量及 SOA 序列号
+//   - /inspect/dnssec：DNSSEC 材料的元数据，包括各区域密钥的标签、算法及标志，
+//     以及当前签名的有效期与缓存签名中最早的过期时间，不包含任何私钥
+//   - /inspect/vectors：当前启用的攻击向量及实验模块
+//   - /inspect/queries：最近的查询样本，按时间倒序排列，可以 ?limit=N 限制数量
+//
+// 检视 API 不进行任何认证，但也不提供任何修改状态的途径，应仅监听于本地或受信任的网络。
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/store"
+)
+
+// inspectSummaryQueries 为 /inspect 汇总中包含的查询样本数量
+const inspectSummaryQueries = 20
+
+// ZoneSummary 记录一个已载入区域的概况
+type ZoneSummary struct {
+	Name string `json:"name"`
+	// RRset 及资源记录数量
+	RRSets  int `json:"rrsets"`
+	Records int `json:"records"`
+	// 各类型的 RRset 数量
+	Types map[string]int `json:"types"`
+	// 区域顶点 SOA 记录的序列号，区域不含 SOA 时为 0
+	Serial uint32 `json:"serial"`
+	// 读取存储时的错误
+	Error string `json:"error,omitempty"`
+}
+
+// KeySummary 记录一个 DNSKEY 的元数据
+type KeySummary struct {
+	Zone string `json:"zone"`
+	// "KSK" 或 "ZSK"
+	Role      string `json:"role"`
+	KeyTag    uint16 `json:"key_tag"`
+	Algorithm uint8  `json:"algorithm"`
+	Flags     uint16 `json:"flags"`
+	// 公钥的字节长度
+	PublicKeyLength int `json:"public_key_length"`
+	// 是否持有私钥，不受支持的算法生成的随机公钥没有私钥
+	CanSign bool `json:"can_sign"`
+}
+
+// DNSSECSummary 记录 DNSSEC 材料的元数据
+type DNSSECSummary struct {
+	Algorithm  uint8 `json:"algorithm"`
+	DigestType uint8 `json:"digest_type"`
+	// 已生成材料的全部密钥，按区域名及角色排序
+	Keys []KeySummary `json:"keys"`
+	// 此刻签名所使用的生效及过期时间
+	Inception  time.Time `json:"inception"`
+	Expiration time.Time `json:"expiration"`
+	// 缓存的签名数量及其中最早的过期时间，未启用签名缓存时为空
+	CachedSignatures  int        `json:"cached_signatures"`
+	EarliestCachedExp *time.Time `json:"earliest_cached_expiration,omitempty"`
+}
+
+// AttackVector 记录一个启用的攻击向量或实验模块
+type AttackVector struct {
+	// 名称，如模块类型 "nxns" 或回复器 "outage"
+	Name string `json:"name"`
+	// 生效的区域，对全部区域生效时为空
+	Zone string `json:"zone,omitempty"`
+	// 配置参数
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// QuerySample 记录一条查询样本
+type QuerySample struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Protocol Protocol  `json:"protocol"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	// 回复的 RCODE 及字节数，未回复时为空
+	RCode string `json:"rcode,omitempty"`
+	Size  int    `json:"size"`
+	// 回复是否被刻意丢弃
+	Dropped bool `json:"dropped,omitempty"`
+	// 生成回复所用的时间
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// 生成回复时的错误
+	Error string `json:"error,omitempty"`
+}
+
+// QuerySampler 查询采样器：以环形缓冲区保留最近的查询样本。
+type QuerySampler struct {
+	// 保留的样本数量
+	Limit int
+
+	mu      sync.Mutex
+	samples []QuerySample
+	next    int
+}
+
+// NewQuerySampler 创建一个保留最近 limit 条样本的查询采样器
+func NewQuerySampler(limit int) *QuerySampler {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &QuerySampler{Limit: limit}
+}
+
+// Record 记录一条样本，超出数量时覆盖最早的样本
+func (s *QuerySampler) Record(sample QuerySample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) < s.Limit {
+		s.samples = append(s.samples, sample)
+		return
+	}
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % len(s.samples)
+}
+
+// Recent 返回最近的 n 条样本，按时间倒序排列，n 不大于 0 时返回全部样本
+func (s *QuerySampler) Recent(n int) []QuerySample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n <= 0 || n > len(s.samples) {
+		n = len(s.samples)
+	}
+	recent := make([]QuerySample, 0, n)
+	for i := 1; i <= n; i++ {
+		// 缓冲区未满时 next 为 0，最新的样本位于末尾
+		recent = append(recent, s.samples[(s.next-i+len(s.samples))%len(s.samples)])
+	}
+	return recent
+}
+
+// SamplingResponser 采样回复器：包装一个回复器，并将经过的每个查询及其回复记录为样本。
+type SamplingResponser struct {
+	Responser Responser
+	Sampler   *QuerySampler
+	// 流量计，非 nil 时每个查询同时计入仪表盘的流量统计
+	Meter *TrafficMeter
+}
+
+// Response 生成被包装回复器的回复，并记录样本。
+func (r *SamplingResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (r *SamplingResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	start := time.Now()
+	data, err := Respond(ctx, r.Responser, connInfo)
+
+	sample := QuerySample{
+		Time:     connInfo.ReceiveTime,
+		Client:   connInfo.ClientIP().String(),
+		Protocol: connInfo.Protocol,
+		Elapsed:  time.Since(start),
+		Size:     len(data),
+	}
+	if sample.Time.IsZero() {
+		sample.Time = start
+	}
+	if qry, qErr := ParseQuery(connInfo); qErr == nil && len(qry.Question) > 0 {
+		sample.Name = qry.Question[0].Name.DomainName
+		sample.Type = qry.Question[0].Type.String()
+	}
+	switch {
+	case errors.Is(err, ErrDropResponse):
+		sample.Dropped = true
+	case err != nil:
+		sample.Error = err.Error()
+	case len(data) >= 12:
+		sample.RCode = dns.DNSResponseCode(data[3] & 0x0F).String()
+	}
+	if r.Sampler != nil {
+		r.Sampler.Record(sample)
+	}
+	if r.Meter != nil {
+		r.Meter.Observe(sample.Time, sample.RCode, sample.Size, sample.Dropped)
+	}
+	return data, err
+}
+
+// inspectedZone 记录一个受检视的区域
+type inspectedZone struct {
+	name  string
+	store store.ZoneStore
+}
+
+// Inspector 服务器状态检视器：汇总区域、DNSSEC 材料、攻击向量及查询样本，
+// 各字段均可为空，相应端点此时返回空结果。
+type Inspector struct {
+	// 区域名与 DNSSEC 材料的映射，与 EnableDNSSEC 使用的映射相同
+	Materials *sync.Map
+	// DNSSEC 配置，为 nil 时 /inspect/dnssec 返回 null
+	DNSSEC *DNSSECConfig
+	// 启用的攻击向量
+	Vectors []AttackVector
+	// 查询采样器
+	Sampler *QuerySampler
+
+	mu    sync.Mutex
+	zones []inspectedZone
+}
+
+// AddZone 添加一个受检视的区域，其概况在每次请求时从存储中读取
+func (i *Inspector) AddZone(name string, zs store.ZoneStore) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.zones = append(i.zones, inspectedZone{name: name, store: zs})
+}
+
+// Zones 返回全部受检视区域的概况
+func (i *Inspector) Zones() []ZoneSummary {
+	i.mu.Lock()
+	zones := append([]inspectedZone{}, i.zones...)
+	i.mu.Unlock()
+
+	summaries := []ZoneSummary{}
+	for _, z := range zones {
+		summary := ZoneSummary{Name: z.name, Types: map[string]int{}}
+		err := z.store.Iterate(func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool {
+			summary.RRSets++
+			summary.Records += len(rrSet)
+			summary.Types[rrType.String()]++
+			if rrType == dns.DNSRRTypeSOA && dns.EqualDomainName(name, z.name) && len(rrSet) > 0 {
+				if soa, ok := rrSet[0].RData.(*dns.DNSRDATASOA); ok {
+					summary.Serial = soa.Serial
+				}
+			}
+			return true
+		})
+		if err != nil {
+			summary.Error = err.Error()
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// DNSSECSummary 返回 DNSSEC 材料的元数据，未配置 DNSSEC 时返回 nil
+func (i *Inspector) DNSSECSummary() *DNSSECSummary {
+	if i.DNSSEC == nil {
+		return nil
+	}
+	expiration, inception := i.DNSSEC.Validity.Window(*i.DNSSEC, time.Now())
+	summary := &DNSSECSummary{
+		Algorithm:  uint8(i.DNSSEC.Algo),
+		DigestType: uint8(i.DNSSEC.Type),
+		Keys:       []KeySummary{},
+		Inception:  time.Unix(int64(inception), 0).UTC(),
+		Expiration: time.Unix(int64(expiration), 0).UTC(),
+	}
+	if i.Materials != nil {
+		i.Materials.Range(func(key, value interface{}) bool {
+			dMat, ok := value.(DNSSECMaterial)
+			if !ok {
+				return true
+			}
+			// 额外签名者的键形如 "<区域名>#<算法>"
+			zone := key.(string)
+			for j := len(zone) - 1; j >= 0; j-- {
+				if zone[j] == '#' {
+					zone = zone[:j]
+					break
+				}
+			}
+			summary.Keys = append(summary.Keys,
+				keySummary(zone, "KSK", dMat.KSKTag, dMat.KSKRecord, dMat.KSKPriv),
+				keySummary(zone, "ZSK", dMat.ZSKTag, dMat.ZSKRecord, dMat.ZSKPriv))
+			return true
+		})
+	}
+	sort.Slice(summary.Keys, func(a, b int) bool {
+		ka, kb := summary.Keys[a], summary.Keys[b]
+		if ka.Zone != kb.Zone {
+			return dns.CompareDomainName(ka.Zone, kb.Zone) < 0
+		}
+		if ka.Role != kb.Role {
+			return ka.Role < kb.Role
+		}
+		return ka.Algorithm < kb.Algorithm
+	})
+	if i.DNSSEC.Signatures != nil {
+		summary.CachedSignatures = i.DNSSEC.Signatures.Len()
+		if earliest, ok := i.DNSSEC.Signatures.EarliestExpiration(); ok {
+			summary.EarliestCachedExp = &earliest
+		}
+	}
+	return summary
+}
+
+// keySummary 返回 DNSKEY 记录的元数据
+func keySummary(zone, role string, tag int, rr dns.DNSResourceRecord, priv []byte) KeySummary {
+	summary := KeySummary{Zone: zone, Role: role, KeyTag: uint16(tag), CanSign: len(priv) > 0}
+	if key, ok := rr.RData.(*dns.DNSRDATADNSKEY); ok {
+		summary.Algorithm = uint8(key.Algorithm)
+		summary.Flags = uint16(key.Flags)
+		summary.PublicKeyLength = len(key.PublicKey)
+	}
+	return summary
+}
+
+// QuerySamples 返回最近的 n 条查询样本，未配置采样器时返回空切片
+func (i *Inspector) QuerySamples(n int) []QuerySample {
+	if i.Sampler == nil {
+		return []QuerySample{}
+	}
+	return i.Sampler.Recent(n)
+}
+
+// NewInspectionHandler 创建检视 API 的 HTTP 处理器，端点详见文件注释
+// 其接受参数为：
+//   - i *Inspector，服务器状态检视器
+//
+// 返回值为：
+//   - http.Handler，检视 API 的 HTTP 处理器
+func NewInspectionHandler(i *Inspector) http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, body func(r *http.Request) (interface{}, error)) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			v, err := body(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(v)
+		})
+	}
+	vectors := func() []AttackVector {
+		return append([]AttackVector{}, i.Vectors...)
+	}
+
+	handle("/inspect", func(r *http.Request) (interface{}, error) {
+		return map[string]interface{}{
+			"zones":   i.Zones(),
+			"dnssec":  i.DNSSECSummary(),
+			"vectors": vectors(),
+			"queries": i.QuerySamples(inspectSummaryQueries),
+		}, nil
+	})
+	handle("/inspect/zones", func(r *http.Request) (interface{}, error) {
+		return i.Zones(), nil
+	})
+	handle("/inspect/dnssec", func(r *http.Request) (interface{}, error) {
+		return i.DNSSECSummary(), nil
+	})
+	handle("/inspect/vectors", func(r *http.Request) (interface{}, error) {
+		return vectors(), nil
+	})
+	handle("/inspect/queries", func(r *http.Request) (interface{}, error) {
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid limit " + strconv.Quote(s))
+			}
+			limit = n
+		}
+		return i.QuerySamples(limit), nil
+	})
+	return mux
+}
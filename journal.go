@@ -0,0 +1,390 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// journal.go 文件定义了 DynamicZone 动态区域，
+// 其在已载入的区域数据之上提供修改 API（AddRR、DeleteRRset、BumpSerial），
+// 并将每次序列号变更之间的增删记录为日志，用于回复 IXFR（RFC 1995），
+// 同时在序列号变更后向次级服务器发送 NOTIFY（RFC 1996），
+// 从而支持快速重签名、委派反复变更等动态区域实验。
+//
+// 修改会立即写入存储，对查询立即可见；日志则以 BumpSerial 为界划分版本。
+// ZoneTransferResponser 可包装任意回复器，为动态区域提供 AXFR 及 IXFR 服务。
+
+package xdns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+	"github.com/tochusc/xdns/store"
+)
+
+// JournalEntry 表示日志中的一次序列号变更，
+// Deleted 以旧 SOA 开头，Added 以新 SOA 开头，与 IXFR 回复中的顺序一致
+type JournalEntry struct {
+	FromSerial uint32
+	ToSerial   uint32
+	Deleted    []dns.DNSResourceRecord
+	Added      []dns.DNSResourceRecord
+}
+
+// DynamicZoneConfig 记录动态区域的配置
+type DynamicZoneConfig struct {
+	// 区域名称
+	Name string
+	// 区域数据的存储，其中需已包含区域顶点的 SOA 记录
+	Store store.ZoneStore
+	// 日志中保留的最大变更数，0 表示不限制
+	JournalLimit int
+	// 序列号变更后发送 NOTIFY 的次级服务器地址，形如 "10.0.0.2:53"
+	NotifyTargets []string
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// DynamicZone 动态区域：修改区域数据并记录用于 IXFR 的日志。
+type DynamicZone struct {
+	Name          string
+	Store         store.ZoneStore
+	JournalLimit  int
+	NotifyTargets []string
+	ZoneLogger    *log.Logger
+
+	// 当前序列号之后尚未划入日志的增删
+	deleted []dns.DNSResourceRecord
+	added   []dns.DNSResourceRecord
+	journal []JournalEntry
+	mu      sync.Mutex
+}
+
+// NewDynamicZone 根据配置创建一个新的动态区域
+// 其接受参数为：
+//   - conf DynamicZoneConfig，动态区域配置
+//
+// 返回值为：
+//   - *DynamicZone，创建的动态区域
+//   - error，存储中不存在区域顶点的 SOA 记录时返回错误
+func NewDynamicZone(conf DynamicZoneConfig) (*DynamicZone, error) {
+	zone := &DynamicZone{
+		Name:          strings.TrimSuffix(strings.ToLower(conf.Name), "."),
+		Store:         conf.Store,
+		JournalLimit:  conf.JournalLimit,
+		NotifyTargets: conf.NotifyTargets,
+		ZoneLogger:    log.New(conf.LogWriter, "DynamicZone: ", log.LstdFlags),
+	}
+	if _, err := zone.soa(); err != nil {
+		return nil, fmt.Errorf("function NewDynamicZone failed: %v", err)
+	}
+	return zone, nil
+}
+
+// soa 返回区域当前的 SOA 记录
+func (z *DynamicZone) soa() (dns.DNSResourceRecord, error) {
+	rrSet, err := z.Store.GetRRSet(z.Name, dns.DNSRRTypeSOA)
+	if err != nil {
+		return dns.DNSResourceRecord{}, err
+	}
+	if len(rrSet) == 0 {
+		return dns.DNSResourceRecord{}, fmt.Errorf("zone %s has no SOA record", z.Name)
+	}
+	if _, ok := rrSet[0].RData.(*dns.DNSRDATASOA); !ok {
+		return dns.DNSResourceRecord{}, fmt.Errorf("zone %s has a malformed SOA record", z.Name)
+	}
+	return rrSet[0], nil
+}
+
+// Serial 返回区域当前的 SOA 序列号
+func (z *DynamicZone) Serial() (uint32, error) {
+	soa, err := z.soa()
+	if err != nil {
+		return 0, fmt.Errorf("method DynamicZone Serial failed: %v", err)
+	}
+	return soa.RData.(*dns.DNSRDATASOA).Serial, nil
+}
+
+// sameRR 判断两条记录是否相同，不比较 TTL
+func sameRR(a, b dns.DNSResourceRecord) bool {
+	return dns.CompareDomainName(a.Name.DomainName, b.Name.DomainName) == 0 &&
+		a.Type == b.Type && a.Class == b.Class &&
+		bytes.Equal(a.RData.Encode(), b.RData.Encode())
+}
+
+// AddRR 向区域添加一条记录，相同的记录已存在时不做任何改动。
+// 不能用于修改 SOA 记录，序列号请使用 BumpSerial 修改。
+func (z *DynamicZone) AddRR(rr dns.DNSResourceRecord) error {
+	if rr.Type == dns.DNSRRTypeSOA {
+		return fmt.Errorf("method DynamicZone AddRR failed: SOA records are managed by BumpSerial")
+	}
+	name := rr.Name.DomainName
+	if !inBailiwick(name, z.Name) {
+		return fmt.Errorf("method DynamicZone AddRR failed: %s is not in zone %s", name, z.Name)
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	rrSet, err := z.Store.GetRRSet(name, rr.Type)
+	if err != nil {
+		return fmt.Errorf("method DynamicZone AddRR failed: %v", err)
+	}
+	for _, existing := range rrSet {
+		if sameRR(existing, rr) {
+			return nil
+		}
+	}
+	if err := z.Store.PutRRSet(name, rr.Type, append(rrSet, rr)); err != nil {
+		return fmt.Errorf("method DynamicZone AddRR failed: %v", err)
+	}
+	z.added = append(z.added, rr)
+	return nil
+}
+
+// DeleteRRset 删除区域中的一个 RRset，不存在时不做任何改动。
+// 不能用于删除 SOA 记录。
+func (z *DynamicZone) DeleteRRset(name string, rrType dns.DNSType) error {
+	if rrType == dns.DNSRRTypeSOA {
+		return fmt.Errorf("method DynamicZone DeleteRRset failed: SOA records are managed by BumpSerial")
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	rrSet, err := z.Store.GetRRSet(name, rrType)
+	if err != nil {
+		return fmt.Errorf("method DynamicZone DeleteRRset failed: %v", err)
+	}
+	if len(rrSet) == 0 {
+		return nil
+	}
+	if err := z.Store.DeleteRRSet(name, rrType); err != nil {
+		return fmt.Errorf("method DynamicZone DeleteRRset failed: %v", err)
+	}
+
+	// 删除本版本中新增的记录时，直接撤销该新增，而不是记录为删除
+	for _, rr := range rrSet {
+		undone := false
+		for i, added := range z.added {
+			if sameRR(added, rr) {
+				z.added = append(z.added[:i], z.added[i+1:]...)
+				undone = true
+				break
+			}
+		}
+		if !undone {
+			z.deleted = append(z.deleted, rr)
+		}
+	}
+	return nil
+}
+
+// BumpSerial 递增 SOA 序列号，将此前的增删划为日志中的一次变更，
+// 并在后台向 NotifyTargets 发送 NOTIFY。没有任何增删时同样递增序列号。
+// 返回值为：
+//   - uint32，新的序列号
+//   - error，读写存储失败时返回错误
+func (z *DynamicZone) BumpSerial() (uint32, error) {
+	z.mu.Lock()
+	oldSOA, err := z.soa()
+	if err != nil {
+		z.mu.Unlock()
+		return 0, fmt.Errorf("method DynamicZone BumpSerial failed: %v", err)
+	}
+	oldRData := oldSOA.RData.(*dns.DNSRDATASOA)
+	newRData := *oldRData
+	// 序列号按 RFC 1982 的序列号算术递增，溢出时回绕
+	newRData.Serial++
+	newSOA := oldSOA
+	newSOA.RData = &newRData
+	if err := z.Store.PutRRSet(z.Name, dns.DNSRRTypeSOA, []dns.DNSResourceRecord{newSOA}); err != nil {
+		z.mu.Unlock()
+		return 0, fmt.Errorf("method DynamicZone BumpSerial failed: %v", err)
+	}
+
+	z.journal = append(z.journal, JournalEntry{
+		FromSerial: oldRData.Serial,
+		ToSerial:   newRData.Serial,
+		Deleted:    append([]dns.DNSResourceRecord{oldSOA}, z.deleted...),
+		Added:      append([]dns.DNSResourceRecord{newSOA}, z.added...),
+	})
+	if z.JournalLimit > 0 && len(z.journal) > z.JournalLimit {
+		z.journal = append([]JournalEntry{}, z.journal[len(z.journal)-z.JournalLimit:]...)
+	}
+	z.deleted, z.added = nil, nil
+	z.mu.Unlock()
+
+	if len(z.NotifyTargets) > 0 {
+		go func() {
+			if err := z.Notify(); err != nil {
+				z.ZoneLogger.Printf("Error notifying secondaries: %v", err)
+			}
+		}()
+	}
+	return newRData.Serial, nil
+}
+
+// Journal 返回日志中的全部变更，按序列号由旧至新排列
+func (z *DynamicZone) Journal() []JournalEntry {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return append([]JournalEntry{}, z.journal...)
+}
+
+// IXFR 返回自指定序列号起的增量区域传送记录，格式为 RFC 1995 4 节所定义的：
+// 新 SOA，之后每次变更依次为旧 SOA、删除的记录、新 SOA、新增的记录，最后为新 SOA。
+// 序列号已是最新时仅返回新 SOA。
+// 返回值为：
+//   - []dns.DNSResourceRecord，增量区域传送的记录
+//   - bool，日志中不包含该序列号起的全部变更时返回 false，此时应改用 AXFR
+func (z *DynamicZone) IXFR(serial uint32) ([]dns.DNSResourceRecord, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	current, err := z.soa()
+	if err != nil {
+		return nil, false
+	}
+	if current.RData.(*dns.DNSRDATASOA).Serial == serial {
+		return []dns.DNSResourceRecord{current}, true
+	}
+
+	start := -1
+	for i, entry := range z.journal {
+		if entry.FromSerial == serial {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, false
+	}
+	rrs := []dns.DNSResourceRecord{current}
+	for _, entry := range z.journal[start:] {
+		rrs = append(rrs, entry.Deleted...)
+		rrs = append(rrs, entry.Added...)
+	}
+	return append(rrs, current), true
+}
+
+// AXFR 返回完整区域传送的记录：SOA，按规范顺序排列的其余记录，最后为 SOA。
+func (z *DynamicZone) AXFR() ([]dns.DNSResourceRecord, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	soa, err := z.soa()
+	if err != nil {
+		return nil, fmt.Errorf("method DynamicZone AXFR failed: %v", err)
+	}
+	rrs := []dns.DNSResourceRecord{soa}
+	err = z.Store.Iterate(func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool {
+		if rrType != dns.DNSRRTypeSOA && inBailiwick(name, z.Name) {
+			rrs = append(rrs, rrSet...)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("method DynamicZone AXFR failed: %v", err)
+	}
+	return append(rrs, soa), nil
+}
+
+// NotifyMessage 返回区域当前序列号的 NOTIFY 消息，其回答部分携带当前的 SOA 记录
+func (z *DynamicZone) NotifyMessage() (dns.DNSMessage, error) {
+	soa, err := z.soa()
+	if err != nil {
+		return dns.DNSMessage{}, fmt.Errorf("method DynamicZone NotifyMessage failed: %v", err)
+	}
+	msg := dns.DNSMessage{
+		Header: dns.DNSHeader{
+			ID:     uint16(xperi.RandomIntn(0x10000)),
+			OpCode: dns.DNSOpCodeNotify,
+			AA:     true,
+		},
+		Question: dns.DNSQuestionSection{
+			{Name: *dns.NewDNSName(z.Name), Type: dns.DNSRRTypeSOA, Class: dns.DNSClassIN},
+		},
+		Answer:     dns.DNSResponseSection{soa},
+		Authority:  dns.DNSResponseSection{},
+		Additional: dns.DNSResponseSection{},
+	}
+	msg.Header.QDCount = 1
+	FixCount(&msg)
+	return msg, nil
+}
+
+// Notify 向全部 NotifyTargets 发送 NOTIFY 并等待其确认
+// 返回值为：
+//   - error，任一次级服务器未确认时返回错误，其余次级服务器仍会收到 NOTIFY
+func (z *DynamicZone) Notify() error {
+	msg, err := z.NotifyMessage()
+	if err != nil {
+		return err
+	}
+	failed := []string{}
+	for _, target := range z.NotifyTargets {
+		c := client.NewClient(client.ClientConfig{Server: target, Timeout: 2 * time.Second})
+		resp, err := c.ExchangeUDP(msg)
+		if err == nil && resp.Header.RCode != dns.DNSResponseCodeNoErr {
+			err = fmt.Errorf("rcode %s", resp.Header.RCode)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", target, err))
+			continue
+		}
+		z.ZoneLogger.Printf("Notified %s of zone %s serial %d.", target, z.Name, msg.Answer[0].RData.(*dns.DNSRDATASOA).Serial)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("method DynamicZone Notify failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// ZoneTransferResponser 区域传送回复器：为动态区域回复经由 TCP 的 AXFR 及 IXFR 查询，
+// 其余查询交由被包装的回复器处理。
+// IXFR 查询的权威部分需携带客户端当前的 SOA 记录，日志无法覆盖时回复完整区域。
+type ZoneTransferResponser struct {
+	Responser Responser
+	Zone      *DynamicZone
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *ZoneTransferResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil || len(qry.Question) == 0 {
+		return r.Responser.Response(connInfo)
+	}
+	qType := qry.Question[0].Type
+	qName := strings.TrimSuffix(strings.ToLower(qry.Question[0].Name.DomainName), ".")
+	if (qType != dns.DNSQTypeAXFR && qType != dns.DNSRRTypeIXFR) || qName != r.Zone.Name {
+		return r.Responser.Response(connInfo)
+	}
+
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	if connInfo.Protocol != ProtocolTCP {
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	rrs, ok := []dns.DNSResourceRecord(nil), false
+	if qType == dns.DNSRRTypeIXFR {
+		for _, rr := range qry.Authority {
+			if soa, isSOA := rr.RData.(*dns.DNSRDATASOA); isSOA {
+				rrs, ok = r.Zone.IXFR(soa.Serial)
+				break
+			}
+		}
+	}
+	if !ok {
+		rrs, err = r.Zone.AXFR()
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+	resp.Answer = rrs
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
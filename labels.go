@@ -0,0 +1,85 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// labels.go 文件定义了 RRSIG Labels 字段的篡改方式。
+// 通过 DNSSECConfig.Labels，可以使 RRSIG 的 Labels 字段小于所有者名称的标签数（声明回答由通配符展开而来），
+// 或大于所有者名称的标签数（RFC 4035 要求将其视为无效），
+// 以测试解析器在验证时是否正确重建原始所有者名称，以及是否要求通配符展开的否定证明。
+//
+// 启用后签名缓存不再生效，以免缓存中未经篡改的签名被复用。
+
+package xdns
+
+import (
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// RRSIGLabels 记录 RRSIG Labels 字段的篡改配置
+type RRSIGLabels struct {
+	// Labels 字段相对于所有者名称标签数的偏移，结果被限制在 [0, 255] 中：
+	// 负数声明通配符展开，正数生成大于标签数的非法值，0 表示不篡改
+	Offset int
+	// 为 true 时以 Labels 字段重建的通配符所有者名称签名，声明一个签名有效的通配符展开；
+	// 为 false 时仍以实际所有者名称签名，只有不重建所有者名称的验证者才会接受该签名
+	Reconstruct bool
+	// 仅篡改这些类型 RRset 的 RRSIG，为空时篡改除 DNSKEY 外的全部类型，以保持信任链完整
+	Types []dns.DNSType
+}
+
+// applies 检查是否应篡改指定类型 RRset 的 RRSIG
+func (l RRSIGLabels) applies(rrType dns.DNSType) bool {
+	if l.Offset == 0 {
+		return false
+	}
+	if len(l.Types) == 0 {
+		return rrType != dns.DNSRRTypeDNSKEY
+	}
+	for _, t := range l.Types {
+		if t == rrType {
+			return true
+		}
+	}
+	return false
+}
+
+// Value 返回所有者名称的 RRSIG 中应使用的 Labels 字段
+func (l RRSIGLabels) Value(owner string) uint8 {
+	labels := xperi.OwnerLabelCount(owner) + l.Offset
+	switch {
+	case labels < 0:
+		return 0
+	case labels > 255:
+		return 255
+	}
+	return uint8(labels)
+}
+
+// signSetWithLabels 使用篡改后的 Labels 字段为 RR 集合签名，
+// 不受支持的算法无法签名，此时仅修改随机签名的 Labels 字段
+func signSetWithLabels(rrset []dns.DNSResourceRecord, crypto CryptoMaterial) dns.DNSResourceRecord {
+	labels := crypto.Labels.Value(rrset[0].Name.DomainName)
+	if !xperi.IsSupportedAlgorithm(crypto.Algorithm) {
+		sig := xperi.GenerateUnsupportedRRRRSIG(
+			rrset,
+			crypto.Algorithm,
+			crypto.Expiration,
+			crypto.Inception,
+			crypto.KeyTag,
+			crypto.SignerName,
+			0,
+		)
+		sig.RData.(*dns.DNSRDATARRSIG).Labels = labels
+		return sig
+	}
+	return xperi.GenerateRRRRSIGWithLabels(
+		rrset,
+		crypto.Algorithm,
+		crypto.Expiration,
+		crypto.Inception,
+		crypto.KeyTag,
+		crypto.SignerName,
+		crypto.PrivateKey,
+		labels,
+		crypto.Labels.Reconstruct,
+	)
+}
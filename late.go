@@ -0,0 +1,235 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// late.go 文件定义了 LateResponser 迟到回复器，
+// 其有意在超过常见解析器超时（即解析器已放弃并回复 SERVFAIL）的延迟之后才发送真正的回复，
+// 并按客户端记录延迟期间到达的重试查询，以及迟到回复发出之后是否仍有相同的查询到达，
+// 以刻画不同解析器实现的重试及抑制（hold-down）行为。
+//
+// 经由 UDP 的查询由回复器返回 ErrDropResponse 使服务器不作回复，并在延迟结束后直接将回复写入查询所在的链接；
+// 经由 TCP 等流式链接的查询则在回复器中等待延迟后返回回复。
+// 统计经由 Stats 取得，同时以 "late.<queries|retries|after_answer>" 计数器导出至 /debug/vars。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLateDelay 为默认的回复延迟，超过常见解析器的单次查询超时及总超时
+const DefaultLateDelay = 12 * time.Second
+
+// DefaultHoldWindow 为默认的观察窗口，迟到回复发出后的该时长内仍记录相同的查询
+const DefaultHoldWindow = 30 * time.Second
+
+// LateStat 记录一个客户端的重试及抑制行为
+type LateStat struct {
+	Client string `json:"client"`
+	// 客户端指纹，用于区分解析器实现
+	Fingerprint string `json:"fingerprint"`
+	// 被延迟回复的不同问题的数量
+	Questions uint64 `json:"questions"`
+	// 延迟期间到达的相同问题的重试查询数量
+	Retries uint64 `json:"retries"`
+	// 延迟期间至少被重试一次的问题数量
+	RetriedQuestions uint64 `json:"retried_questions"`
+	// 首个重试相对于首个查询的平均时间间隔，无重试时为 0
+	MeanFirstRetry time.Duration `json:"mean_first_retry_ns"`
+	// 迟到回复发出之后、观察窗口结束之前到达的相同问题的查询数量，
+	// 大于 0 说明客户端没有接受或缓存迟到的回复
+	AfterAnswer uint64 `json:"after_answer"`
+	// 迟到回复发出后没有再次查询的问题数量
+	Quiet uint64 `json:"quiet"`
+}
+
+// lateQuestion 记录一个客户端对一个问题的查询经过
+type lateQuestion struct {
+	client string
+	first  time.Time
+	// 迟到回复发出的时间，尚未发出时为零值
+	answered time.Time
+	retries  int
+	after    int
+}
+
+// LateResponser 迟到回复器：包装一个回复器，在 Delay 之后才发送其回复，并记录客户端的重试行为。
+// 其零值即可使用，此时对全部查询延迟 DefaultLateDelay。
+type LateResponser struct {
+	Responser Responser
+	// 延迟回复的区域，为空时延迟全部查询，"" 或 "." 表示全部区域
+	Zones []string
+	// 回复延迟，0 表示 DefaultLateDelay
+	Delay time.Duration
+	// 观察窗口，0 表示 DefaultHoldWindow
+	HoldWindow time.Duration
+
+	mu        sync.Mutex
+	questions map[string]*lateQuestion
+	stats     map[string]*LateStat
+	// 各客户端首个重试间隔的总和，用于计算平均值
+	firstRetry map[string]time.Duration
+}
+
+// Response 在延迟之后生成被包装回复器的回复。
+func (l *LateResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return l.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+// 对经由 UDP 的查询返回 ErrDropResponse，回复将在延迟之后由回复器自行发送。
+func (l *LateResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil || len(qry.Question) == 0 || !l.Delays(qry.Question[0].Name.DomainName) {
+		return Respond(ctx, l.Responser, connInfo)
+	}
+	q := qry.Question[0]
+	client := connInfo.ClientIP().String()
+	key := fmt.Sprintf("%s|%s|%d", client, strings.ToLower(q.Name.DomainName), q.Type)
+	fingerprint, _ := ClientFingerprintFromContext(ctx)
+	l.observe(key, client, fingerprint, time.Now())
+
+	data, err := Respond(ctx, l.Responser, connInfo)
+	if err != nil {
+		return data, err
+	}
+	delay := l.delay()
+	SpanFromContext(ctx).SetAttribute("xdns.late_delay", delay.String())
+
+	if connInfo.Protocol == ProtocolUDP && connInfo.PacketConn != nil {
+		// 回复可能借自编码缓冲池，延迟发送的是其副本
+		data = append([]byte{}, data...)
+		time.AfterFunc(delay, func() {
+			if _, err := writePacket(connInfo, data); err != nil {
+				serverVars.Add("late.errors", 1)
+				return
+			}
+			l.answered(key, time.Now())
+		})
+		return nil, ErrDropResponse
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	l.answered(key, time.Now())
+	return data, nil
+}
+
+// Delays 判断指定名称的回复是否被延迟
+func (l *LateResponser) Delays(name string) bool {
+	return zonesCover(l.Zones, name)
+}
+
+// delay 返回回复延迟
+func (l *LateResponser) delay() time.Duration {
+	if l.Delay <= 0 {
+		return DefaultLateDelay
+	}
+	return l.Delay
+}
+
+// holdWindow 返回观察窗口
+func (l *LateResponser) holdWindow() time.Duration {
+	if l.HoldWindow <= 0 {
+		return DefaultHoldWindow
+	}
+	return l.HoldWindow
+}
+
+// observe 记录一次查询：首次查询开始一个新的经过，延迟期间的查询计为重试，迟到回复发出后的查询计为抑制失败
+func (l *LateResponser) observe(key, client, fingerprint string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(now)
+	if l.questions == nil {
+		l.questions = make(map[string]*lateQuestion)
+	}
+	s := l.stat(client)
+	if fingerprint != "" {
+		s.Fingerprint = fingerprint
+	}
+
+	q, ok := l.questions[key]
+	switch {
+	case !ok:
+		l.questions[key] = &lateQuestion{client: client, first: now}
+		s.Questions++
+		serverVars.Add("late.queries", 1)
+	case q.answered.IsZero():
+		if q.retries == 0 {
+			l.firstRetry[client] += now.Sub(q.first)
+			s.RetriedQuestions++
+		}
+		q.retries++
+		s.Retries++
+		serverVars.Add("late.retries", 1)
+	default:
+		q.after++
+		s.AfterAnswer++
+		serverVars.Add("late.after_answer", 1)
+	}
+}
+
+// answered 记录迟到回复发出的时间，同一问题的多个查询以首个发出的回复为准
+func (l *LateResponser) answered(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if q, ok := l.questions[key]; ok && q.answered.IsZero() {
+		q.answered = now
+	}
+}
+
+// expire 结束观察窗口已过的经过，调用者需持有锁
+func (l *LateResponser) expire(now time.Time) {
+	window := l.holdWindow()
+	for key, q := range l.questions {
+		if q.answered.IsZero() || now.Sub(q.answered) < window {
+			continue
+		}
+		if q.after == 0 {
+			l.stat(q.client).Quiet++
+		}
+		delete(l.questions, key)
+	}
+}
+
+// stat 返回客户端的统计，调用者需持有锁
+func (l *LateResponser) stat(client string) *LateStat {
+	if l.stats == nil {
+		l.stats = make(map[string]*LateStat)
+		l.firstRetry = make(map[string]time.Duration)
+	}
+	s, ok := l.stats[client]
+	if !ok {
+		s = &LateStat{Client: client}
+		l.stats[client] = s
+	}
+	return s
+}
+
+// Stats 返回各客户端的重试及抑制行为，按客户端排序
+func (l *LateResponser) Stats() []LateStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expire(time.Now())
+	clients := make([]string, 0, len(l.stats))
+	for client := range l.stats {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	stats := make([]LateStat, 0, len(clients))
+	for _, client := range clients {
+		s := *l.stats[client]
+		if s.RetriedQuestions > 0 {
+			s.MeanFirstRetry = l.firstRetry[client] / time.Duration(s.RetriedQuestions)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
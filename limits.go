@@ -0,0 +1,101 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// limits.go 文件定义了回复大小的硬上限。
+// 扫描攻击向量参数时，配置错误的参数可能生成数 MB 的 TCP 回复，
+// 设置 ServerConfig.ResponseLimits 后，服务器在回复器生成回复之后检查各部分的记录数及回复总长度，
+// 超出任一上限时以 SERVFAIL 代替并记录日志。
+//
+// 需要有意生成超大回复的实验，可在回复器中对请求上下文调用 AllowOverrun，
+// 或以 OverrunResponser 包装回复器，使其回复不受上限限制。
+
+package xdns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+)
+
+// ResponseLimits 记录回复大小的上限，各字段为 0 时不限制
+type ResponseLimits struct {
+	// 回答部分的最大记录数
+	MaxAnswerRRs int
+	// 权威部分的最大记录数
+	MaxAuthorityRRs int
+	// 附加部分的最大记录数，含 OPT 记录
+	MaxAdditionalRRs int
+	// 回复的最大字节数
+	MaxResponseBytes int
+}
+
+// Enabled 判断是否设置了任一上限
+func (l ResponseLimits) Enabled() bool {
+	return l.MaxAnswerRRs > 0 || l.MaxAuthorityRRs > 0 || l.MaxAdditionalRRs > 0 || l.MaxResponseBytes > 0
+}
+
+// Check 检查回复是否超出上限，记录数取自回复头部的计数字段
+// 其接受参数为：
+//   - resp []byte，回复数据包
+//
+// 返回值为：
+//   - error，超出任一上限时返回描述该上限的错误
+func (l ResponseLimits) Check(resp []byte) error {
+	if l.MaxResponseBytes > 0 && len(resp) > l.MaxResponseBytes {
+		return fmt.Errorf("method ResponseLimits Check failed: response is %d bytes, exceeding %d", len(resp), l.MaxResponseBytes)
+	}
+	if len(resp) < 12 {
+		return nil
+	}
+	for _, section := range []struct {
+		name   string
+		offset int
+		limit  int
+	}{
+		{"answer", 6, l.MaxAnswerRRs},
+		{"authority", 8, l.MaxAuthorityRRs},
+		{"additional", 10, l.MaxAdditionalRRs},
+	} {
+		count := int(binary.BigEndian.Uint16(resp[section.offset:]))
+		if section.limit > 0 && count > section.limit {
+			return fmt.Errorf("method ResponseLimits Check failed: %s section has %d records, exceeding %d", section.name, count, section.limit)
+		}
+	}
+	return nil
+}
+
+// WithOverrunOverride 返回可由 AllowOverrun 标记的上下文，
+// 服务器在处理每个查询时均会调用该函数，回复器无需自行调用。
+func WithOverrunOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overrunKey, new(atomic.Bool))
+}
+
+// AllowOverrun 标记当前回复不受 ResponseLimits 限制，
+// 上下文不是由 WithOverrunOverride 派生时不起作用。
+func AllowOverrun(ctx context.Context) {
+	if flag, ok := ctx.Value(overrunKey).(*atomic.Bool); ok {
+		flag.Store(true)
+	}
+}
+
+// OverrunAllowed 返回当前回复是否已被 AllowOverrun 标记
+func OverrunAllowed(ctx context.Context) bool {
+	flag, ok := ctx.Value(overrunKey).(*atomic.Bool)
+	return ok && flag.Load()
+}
+
+// OverrunResponser 包装一个回复器，使其全部回复均不受 ResponseLimits 限制
+type OverrunResponser struct {
+	Responser Responser
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *OverrunResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.Responser.Response(connInfo)
+}
+
+// ResponseContext 标记当前回复不受上限限制，并将上下文传递给被包装的回复器
+func (r *OverrunResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	AllowOverrun(ctx)
+	return Respond(ctx, r.Responser, connInfo)
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// limits_test.go 文件用于对回复大小上限进行测试。
+
+package xdns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// countedResponse 构造头部计数字段为指定值、总长度为 size 的回复
+func countedResponse(an, ns, ar uint16, size int) []byte {
+	resp := make([]byte, size)
+	resp[6], resp[7] = byte(an>>8), byte(an)
+	resp[8], resp[9] = byte(ns>>8), byte(ns)
+	resp[10], resp[11] = byte(ar>>8), byte(ar)
+	return resp
+}
+
+// 测试 ResponseLimits 的 Check 方法
+func TestResponseLimitsCheck(t *testing.T) {
+	limits := ResponseLimits{MaxAnswerRRs: 10, MaxAuthorityRRs: 5, MaxAdditionalRRs: 3, MaxResponseBytes: 512}
+	tests := []struct {
+		name    string
+		limits  ResponseLimits
+		resp    []byte
+		errPart string
+	}{
+		{"within limits", limits, countedResponse(10, 5, 3, 512), ""},
+		{"answer", limits, countedResponse(11, 0, 0, 12), "answer section has 11 records"},
+		{"authority", limits, countedResponse(0, 6, 0, 12), "authority section has 6 records"},
+		{"additional", limits, countedResponse(0, 0, 4, 12), "additional section has 4 records"},
+		{"bytes", limits, countedResponse(0, 0, 0, 513), "513 bytes"},
+		{"short response", limits, []byte{0, 1, 2}, ""},
+		{"no limits", ResponseLimits{}, countedResponse(65535, 65535, 65535, 65535), ""},
+		// 未设置的上限不限制对应部分
+		{"answer only", ResponseLimits{MaxAnswerRRs: 1}, countedResponse(1, 100, 100, 4096), ""},
+	}
+	for _, tt := range tests {
+		err := tt.limits.Check(tt.resp)
+		if tt.errPart == "" && err != nil {
+			t.Errorf("method ResponseLimits Check() failed: %s:\n%v", tt.name, err)
+		}
+		if tt.errPart != "" && (err == nil || !strings.Contains(err.Error(), tt.errPart)) {
+			t.Errorf("method ResponseLimits Check() failed: %s:\ngot: %v\nexpected an error containing: %s", tt.name, err, tt.errPart)
+		}
+	}
+}
+
+// 测试 ResponseLimits 的 Enabled 方法
+func TestResponseLimitsEnabled(t *testing.T) {
+	if (ResponseLimits{}).Enabled() {
+		t.Errorf("method ResponseLimits Enabled() failed: zero value is enabled")
+	}
+	for _, l := range []ResponseLimits{{MaxAnswerRRs: 1}, {MaxAuthorityRRs: 1}, {MaxAdditionalRRs: 1}, {MaxResponseBytes: 1}} {
+		if !l.Enabled() {
+			t.Errorf("method ResponseLimits Enabled() failed: %+v is not enabled", l)
+		}
+	}
+}
+
+// 测试 AllowOverrun 及 OverrunAllowed 函数
+func TestAllowOverrun(t *testing.T) {
+	// 未由 WithOverrunOverride 派生的上下文不可被标记
+	ctx := context.Background()
+	AllowOverrun(ctx)
+	if OverrunAllowed(ctx) {
+		t.Errorf("function OverrunAllowed() failed: plain context allowed overrun")
+	}
+
+	ctx = WithOverrunOverride(context.Background())
+	if OverrunAllowed(ctx) {
+		t.Errorf("function OverrunAllowed() failed: overrun allowed before AllowOverrun")
+	}
+	// 标记对派生的上下文同样可见
+	AllowOverrun(context.WithValue(ctx, traceIDKey, "child"))
+	if !OverrunAllowed(ctx) {
+		t.Errorf("function OverrunAllowed() failed: overrun not allowed after AllowOverrun")
+	}
+}
+
+// 测试 OverrunResponser 的回复
+func TestOverrunResponser(t *testing.T) {
+	r := &OverrunResponser{Responser: &DullResponser{}}
+	ctx := WithOverrunOverride(context.Background())
+	if _, err := r.ResponseContext(ctx, newTestQuery("www.test", dns.DNSRRTypeA, 0)); err != nil {
+		t.Fatalf("method OverrunResponser ResponseContext() failed:\n%v", err)
+	}
+	if !OverrunAllowed(ctx) {
+		t.Errorf("method OverrunResponser ResponseContext() failed: overrun not allowed")
+	}
+}
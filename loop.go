@@ -0,0 +1,188 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// loop.go 文件定义了 ReferralLoopGenerator 转介环路生成器。
+// 其生成若干个跳转区域，每个区域均被委派给位于下一个跳转区域中的权威服务器名称，
+// 最后一个区域的权威服务器名称又位于第一个区域中，从而形成长度可配置的转介环路：
+// 解析器为查找权威服务器的地址需要不断追随新的转介，直至达到其转介追随上限。
+//
+// 与 CNAME 链不同，环路中的每一跳均为转介而非别名；与 NS 扇出不同，每个委派仅包含一个权威服务器名称，
+// 因此解析器的工作量只随其追随转介的深度增长。生成器只回复转介，从不回复权威数据（Delegation-Only）。
+
+package xdns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ReferralLoopConfig 记录转介环路生成器的配置
+type ReferralLoopConfig struct {
+	// 跳转区域所在的区域，至少包含一个区域，第 i 跳位于 Zones[i % len(Zones)]，
+	// 配置多个区域即可使环路跨越区域
+	Zones []string
+	// 环路长度，即环路中跳转区域的数量
+	Length int
+	// 权威服务器的地址，不为空时转介回复包含指向 Addresses[(i+1) % len(Addresses)] 的粘合记录，
+	// 这些粘合记录位于区外，仅被接受区外粘合记录的解析器使用，使得环路同时跨越不同的地址
+	Addresses []net.IP
+	// 记录的 TTL
+	TTL uint32
+}
+
+// ReferralLoopGenerator 转介环路生成器：根据配置生成环路中的转介回复。
+type ReferralLoopGenerator struct {
+	Config ReferralLoopConfig
+
+	// 跳转区域名称与其序号的映射
+	hops map[string]int
+
+	mu        sync.Mutex
+	referrals map[string]uint64
+}
+
+// NewReferralLoopGenerator 根据配置创建一个新的转介环路生成器
+func NewReferralLoopGenerator(conf ReferralLoopConfig) *ReferralLoopGenerator {
+	if conf.Length < 1 {
+		conf.Length = 1
+	}
+	zones := make([]string, 0, len(conf.Zones))
+	for _, zone := range conf.Zones {
+		zones = append(zones, dns.CanonicalizeDomainName(&zone))
+	}
+	conf.Zones = zones
+
+	g := &ReferralLoopGenerator{
+		Config:    conf,
+		hops:      make(map[string]int),
+		referrals: make(map[string]uint64),
+	}
+	for i := 0; i < conf.Length; i++ {
+		g.hops[g.HopZone(i)] = i
+	}
+	return g
+}
+
+// HopZone 返回第 i 跳的区域名称
+func (g *ReferralLoopGenerator) HopZone(i int) string {
+	zone := g.Config.Zones[i%len(g.Config.Zones)]
+	return fmt.Sprintf("h%d.%s", i, zone)
+}
+
+// nameServer 返回第 i 跳区域的权威服务器名称，其位于下一跳的区域中
+func (g *ReferralLoopGenerator) nameServer(i int) string {
+	return "ns." + g.HopZone((i+1)%g.Config.Length)
+}
+
+// Start 返回环路的起始名称
+func (g *ReferralLoopGenerator) Start() string {
+	return "www." + g.HopZone(0)
+}
+
+// Find 返回被查询名称所在跳转区域的序号，名称不在任何跳转区域中时返回 -1
+func (g *ReferralLoopGenerator) Find(qName string) int {
+	name := strings.ToLower(qName)
+	for {
+		if i, ok := g.hops[name]; ok {
+			return i
+		}
+		upper := dns.GetUpperDomainName(&name)
+		if upper == name {
+			return -1
+		}
+		name = upper
+	}
+}
+
+// Build 为查询构建第 i 跳区域的转介回复
+// 其接受参数为：
+//   - qry dns.DNSMessage，查询信息
+//   - i int，跳转区域的序号
+//
+// 返回值为：
+//   - dns.DNSMessage，转介回复，其权威部分包含指向下一跳区域中权威服务器名称的 NS 记录
+func (g *ReferralLoopGenerator) Build(qry dns.DNSMessage, i int) dns.DNSMessage {
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	// 转介回复不是权威回复
+	resp.Header.AA = false
+
+	ns := g.nameServer(i)
+	resp.Authority = append(resp.Authority, g.newRR(g.HopZone(i), &dns.DNSRDATANS{NSDNAME: ns}))
+	if len(g.Config.Addresses) > 0 {
+		addr := g.Config.Addresses[(i+1)%len(g.Config.Addresses)]
+		if addr.To4() != nil {
+			resp.Additional = append(resp.Additional, g.newRR(ns, &dns.DNSRDATAA{Address: addr}))
+		} else {
+			resp.Additional = append(resp.Additional, g.newRR(ns, &dns.DNSRDATAAAAA{Address: addr}))
+		}
+	}
+	FixCount(&resp)
+	return resp
+}
+
+// record 记录向客户端发送的一次转介
+func (g *ReferralLoopGenerator) record(client string) {
+	g.mu.Lock()
+	g.referrals[client]++
+	g.mu.Unlock()
+	serverVars.Add("loop_referrals", 1)
+}
+
+// Referrals 返回向各客户端发送的转介数量，
+// 每次解析仅触发一轮环路时，其即为解析器的转介追随上限
+func (g *ReferralLoopGenerator) Referrals() map[string]uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	referrals := make(map[string]uint64, len(g.referrals))
+	for client, n := range g.referrals {
+		referrals[client] = n
+	}
+	return referrals
+}
+
+// Reset 清空转介计数，通常在每轮测量开始前调用
+func (g *ReferralLoopGenerator) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.referrals = make(map[string]uint64)
+}
+
+// newRR 生成转介回复中的资源记录
+func (g *ReferralLoopGenerator) newRR(owner string, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(owner),
+		Type:  rdata.Type(),
+		Class: dns.DNSClassIN,
+		TTL:   g.Config.TTL,
+		RDLen: 0,
+		RData: rdata,
+	}
+}
+
+// ReferralLoopResponser 是一个使用 ReferralLoopGenerator 回复转介环路的回复器实现。
+// 环路以外的名称将得到 NXDOMAIN 回复。
+type ReferralLoopResponser struct {
+	Generator *ReferralLoopGenerator
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *ReferralLoopResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	i := r.Generator.Find(qry.Question[0].Name.DomainName)
+	if i < 0 {
+		resp := InitNXDOMAIN(qry)
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+	r.Generator.record(connInfo.ClientIP().String())
+	resp := r.Generator.Build(qry, i)
+	return resp.Encode(), nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// mdns.go 文件定义了 MDNSServer 多播 DNS 服务器（RFC 6762），
+// 其在 224.0.0.251:5353 上监听，以配置的记录集回复 .local 名称的查询，
+// 用于将实验范围扩展至本地网络中解析器及终端的链路本地解析行为。
+//
+// 服务器支持：
+//   - 缓存刷新位：独有（Unique）记录的 CLASS 最高位被置位，告知对端刷新其缓存
+//   - 已知回答抑制：查询的回答部分中已包含且剩余 TTL 不少于一半的记录不再回复
+//   - QU 位：问题 CLASS 最高位被置位时以单播回复
+//   - 传统单播查询：源端口不为 5353 的查询按 RFC 6762 6.7 节以单播回复，
+//     回复携带问题部分及原事务 ID，TTL 不超过 10 秒且不设置缓存刷新位
+//
+// mDNS 不发送否定回复，没有匹配记录的查询将被忽略。
+
+package xdns
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+const (
+	// MDNSPort 为 mDNS 使用的端口
+	MDNSPort = 5353
+	// MDNSDomain 为 mDNS 负责的链路本地域名
+	MDNSDomain = "local"
+	// mdnsClassFlag 为 CLASS 字段的最高位，在问题中表示 QU，在记录中表示缓存刷新
+	mdnsClassFlag dns.DNSClass = 0x8000
+	// mdnsLegacyTTL 为传统单播回复中记录的 TTL 上限
+	mdnsLegacyTTL = 10
+)
+
+// MDNSGroup 为 mDNS 使用的 IPv4 多播地址
+var MDNSGroup = net.IPv4(224, 0, 0, 251)
+
+// MDNSRecord 表示 mDNS 服务器负责回复的一条记录
+type MDNSRecord struct {
+	RR dns.DNSResourceRecord
+	// 是否为共享（Shared）记录，如服务发现中的 PTR 记录；
+	// 否则为独有记录，回复时设置缓存刷新位
+	Shared bool
+}
+
+// MDNSConfig 记录 mDNS 服务器的配置
+type MDNSConfig struct {
+	// 加入多播组所使用的网络接口，为 nil 时由系统选择
+	Interface *net.Interface
+	// 负责回复的记录集，名称应位于 .local 之下
+	Records []MDNSRecord
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// MDNSStats 记录 mDNS 服务器的统计信息
+type MDNSStats struct {
+	// 收到的查询数量
+	Queries uint64
+	// 发送的回复数量
+	Responses uint64
+	// 因已知回答抑制而省略的记录数量
+	Suppressed uint64
+}
+
+// MDNSServer 多播 DNS 服务器
+type MDNSServer struct {
+	Config     MDNSConfig
+	MDNSLogger *log.Logger
+
+	mu    sync.Mutex
+	conn  *net.UDPConn
+	stats MDNSStats
+}
+
+// NewMDNSServer 根据配置创建一个新的 mDNS 服务器
+func NewMDNSServer(conf MDNSConfig) *MDNSServer {
+	mdnsLogger := log.New(conf.LogWriter, "MDNS: ", log.LstdFlags)
+	return &MDNSServer{
+		Config:     conf,
+		MDNSLogger: mdnsLogger,
+	}
+}
+
+// Start 加入多播组并开始回复查询，查询在后台协程中处理
+func (m *MDNSServer) Start() error {
+	group := &net.UDPAddr{IP: MDNSGroup, Port: MDNSPort}
+	conn, err := net.ListenMulticastUDP("udp4", m.Config.Interface, group)
+	if err != nil {
+		return fmt.Errorf("method MDNSServer Start failed: join %v failed.\n%v", group, err)
+	}
+	m.mu.Lock()
+	m.conn = conn
+	m.mu.Unlock()
+
+	m.MDNSLogger.Printf("Listening on %v with %d records.", group, len(m.Config.Records))
+	go m.serve(conn)
+	return nil
+}
+
+// Close 离开多播组并停止回复查询
+func (m *MDNSServer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn == nil {
+		return nil
+	}
+	err := m.conn.Close()
+	m.conn = nil
+	return err
+}
+
+// serve 循环接收并回复查询，直至连接被关闭
+func (m *MDNSServer) serve(conn *net.UDPConn) {
+	group := &net.UDPAddr{IP: MDNSGroup, Port: MDNSPort}
+	buffer := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		qry := dns.DNSMessage{}
+		if _, err := qry.DecodeFromBuffer(buffer[:n], 0); err != nil {
+			m.MDNSLogger.Printf("Error decoding query from %v: %v", src, err)
+			continue
+		}
+
+		resp, unicast, ok := m.Answer(qry, src.Port != MDNSPort)
+		if !ok {
+			continue
+		}
+		dst := group
+		if unicast {
+			dst = src
+		}
+		if _, err := conn.WriteToUDP(resp.Encode(), dst); err != nil {
+			m.MDNSLogger.Printf("Error sending response to %v: %v", dst, err)
+			continue
+		}
+		m.mu.Lock()
+		m.stats.Responses++
+		m.mu.Unlock()
+	}
+}
+
+// Answer 根据记录集生成查询的回复
+// 其接受参数为：
+//   - qry dns.DNSMessage，查询消息
+//   - legacy bool，是否为传统单播查询，即源端口不为 5353
+//
+// 返回值为：
+//   - dns.DNSMessage，回复消息
+//   - bool，是否应以单播回复
+//   - bool，是否需要回复，没有匹配记录时为 false
+func (m *MDNSServer) Answer(qry dns.DNSMessage, legacy bool) (dns.DNSMessage, bool, bool) {
+	if qry.Header.QR || qry.Header.OpCode != dns.DNSOpCodeQuery {
+		return dns.DNSMessage{}, false, false
+	}
+	m.mu.Lock()
+	m.stats.Queries++
+	m.mu.Unlock()
+
+	resp := dns.DNSMessage{
+		Header: dns.DNSHeader{QR: true, AA: true},
+	}
+	unicast := legacy
+	if legacy {
+		resp.Header.ID = qry.Header.ID
+		resp.Question = qry.Question
+	}
+	answered := make(map[int]bool)
+	for _, q := range qry.Question {
+		if !dns.IsSubDomain(q.Name.DomainName, MDNSDomain) {
+			continue
+		}
+		class := q.Class &^ mdnsClassFlag
+		if class != dns.DNSClassIN && class != dns.DNSClassANY {
+			continue
+		}
+		unicast = unicast || q.Class&mdnsClassFlag != 0
+
+		for i, rec := range m.Config.Records {
+			if answered[i] || !m.matches(rec.RR, q) {
+				continue
+			}
+			answered[i] = true
+			if m.known(rec.RR, qry.Answer) {
+				m.mu.Lock()
+				m.stats.Suppressed++
+				m.mu.Unlock()
+				continue
+			}
+			rr := rec.RR
+			if legacy {
+				if rr.TTL > mdnsLegacyTTL {
+					rr.TTL = mdnsLegacyTTL
+				}
+			} else if !rec.Shared {
+				rr.Class |= mdnsClassFlag
+			}
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+	if len(resp.Answer) == 0 {
+		return dns.DNSMessage{}, false, false
+	}
+	FixCount(&resp)
+	return resp, unicast, true
+}
+
+// matches 判断记录是否回答了问题
+func (m *MDNSServer) matches(rr dns.DNSResourceRecord, q dns.DNSQuestion) bool {
+	if !dns.EqualDomainName(rr.Name.DomainName, q.Name.DomainName) {
+		return false
+	}
+	return q.Type == dns.DNSQTypeANY || q.Type == rr.Type
+}
+
+// known 判断记录是否已出现在查询的已知回答中，且其剩余 TTL 不少于一半，见 RFC 6762 7.1 节
+func (m *MDNSServer) known(rr dns.DNSResourceRecord, knownAnswers []dns.DNSResourceRecord) bool {
+	for _, ka := range knownAnswers {
+		if ka.Type != rr.Type || ka.Class&^mdnsClassFlag != rr.Class&^mdnsClassFlag ||
+			!dns.EqualDomainName(ka.Name.DomainName, rr.Name.DomainName) {
+			continue
+		}
+		if ka.RData.Equal(rr.RData) && ka.TTL >= rr.TTL/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats 返回 mDNS 服务器的统计信息
+func (m *MDNSServer) Stats() MDNSStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
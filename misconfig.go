@@ -0,0 +1,414 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// misconfig.go 文件定义了 MisconfigResponser 错误配置回复器。
+// 其负责一个父区域及其下的若干子区域委派，并可按委派刻意产生经典的错误配置：
+// 不完整委派（Lame Delegation）、缺失粘合记录、NS 指向 CNAME、父子 NS 不一致及过期的 DS，
+// 用于系统地调查解析器对错误配置的健壮性。
+//
+// 启用 DNSSEC 时还可以构造信任孤岛：子区域已签名，但父区域不发布 DS（不安全委派），
+// 或发布与子区域 KSK 不相符的 DS（伪造的孤岛）。TrustAnchors 返回孤岛的正确 DS，
+// 可配置为解析器的信任锚，伪造的孤岛则可用于研究负信任锚（NTA）的运维流程。
+//
+// 父区域回复转介，子区域回复权威数据，二者由 MisconfigConfig.Role 决定：
+// 同一台主机上通常运行两个实例，分别监听父区域服务器及子区域权威服务器（委派的 Address）的地址；
+// MisconfigRoleAuto 则按收到查询的本地地址自动选择，仅在监听具体地址（如 TCP 或套接字激活）时可用。
+
+package xdns
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// MisconfigRole 表示错误配置回复器的回复身份
+type MisconfigRole int
+
+const (
+	// MisconfigRoleParent 以父区域服务器的身份回复，子区域中的名称均得到转介
+	MisconfigRoleParent MisconfigRole = iota
+	// MisconfigRoleChild 以子区域权威服务器的身份回复
+	MisconfigRoleChild
+	// MisconfigRoleAuto 查询到达委派的 Address 时以子区域的身份回复，否则以父区域的身份回复
+	MisconfigRoleAuto
+)
+
+// MisconfigDelegation 表示一个可刻意配置错误的子区域委派
+type MisconfigDelegation struct {
+	// 子区域名称
+	Child string
+	// 子区域的权威服务器名称，为空时为 "ns1.<子区域>"
+	NameServers []string
+	// 子区域权威服务器的地址，用于粘合记录及子区域中名称的 A/AAAA 记录
+	Address net.IP
+
+	// 不完整委派：子区域的权威服务器不为子区域提供服务，回复 REFUSED
+	Lame bool
+	// 缺失粘合记录：转介回复中不包含区内权威服务器名称的粘合记录
+	MissingGlue bool
+	// NS 指向 CNAME：权威服务器名称为别名，其地址查询得到指向 "host.<权威服务器名称>" 的 CNAME
+	NSCNAME bool
+	// 父子 NS 不一致：子区域顶点的 NS 记录为 "mismatch-ns1.<子区域>"，与父区域的委派不同
+	NSMismatch bool
+	// 过期的 DS：父区域回复的 DS 记录的签名已过期，仅在启用 DNSSEC 时生效
+	ExpiredDS bool
+	// 不安全委派：父区域不发布 DS 记录，并以 NSEC 记录证明其不存在，已签名的子区域因此成为信任孤岛，
+	// 仅在启用 DNSSEC 时生效
+	MissingDS bool
+	// 伪造的孤岛：父区域发布的 DS 记录的摘要被篡改，与子区域的 KSK 不相符，子区域将被验证为 bogus，
+	// 仅在启用 DNSSEC 时生效
+	MismatchedDS bool
+}
+
+// MisconfigConfig 记录错误配置回复器的配置
+type MisconfigConfig struct {
+	// 父区域名称
+	Zone string
+	// 子区域委派
+	Delegations []MisconfigDelegation
+	// 回复身份
+	Role MisconfigRole
+	// 记录的 TTL
+	TTL uint32
+	// DNSSEC 配置，为 nil 时不进行签名
+	DNSSEC *DNSSECConfig
+}
+
+// MisconfigResponser 错误配置回复器：为父区域回复转介，为子区域回复权威数据，并按委派产生错误配置。
+// 不属于任何委派的名称将得到 NXDOMAIN 回复。
+type MisconfigResponser struct {
+	Config MisconfigConfig
+
+	// 子区域名称与其委派的映射
+	delegations map[string]*MisconfigDelegation
+	// 区域名与其相应 DNSSEC 材料的映射
+	materialMap sync.Map
+}
+
+// NewMisconfigResponser 根据配置创建一个新的错误配置回复器
+func NewMisconfigResponser(conf MisconfigConfig) *MisconfigResponser {
+	conf.Zone = dns.CanonicalizeDomainName(&conf.Zone)
+	r := &MisconfigResponser{
+		Config:      conf,
+		delegations: make(map[string]*MisconfigDelegation),
+	}
+	for i := range conf.Delegations {
+		d := &conf.Delegations[i]
+		d.Child = dns.CanonicalizeDomainName(&d.Child)
+		if len(d.NameServers) == 0 {
+			d.NameServers = []string{"ns1." + d.Child}
+		}
+		r.delegations[d.Child] = d
+	}
+	return r
+}
+
+// Find 查找被查询名称所属的委派，未找到时返回 nil
+// 若存在嵌套委派，返回最接近被查询名称的委派。
+func (r *MisconfigResponser) Find(qName string) *MisconfigDelegation {
+	name := strings.ToLower(qName)
+	for {
+		if d, ok := r.delegations[name]; ok {
+			return d
+		}
+		if name == r.Config.Zone {
+			return nil
+		}
+		upper := dns.GetUpperDomainName(&name)
+		if upper == name {
+			return nil
+		}
+		name = upper
+	}
+}
+
+// childSide 判断是否应以子区域的身份回复查询
+func (r *MisconfigResponser) childSide(connInfo ConnectionInfo, d *MisconfigDelegation) bool {
+	switch r.Config.Role {
+	case MisconfigRoleChild:
+		return true
+	case MisconfigRoleAuto:
+		local := localAddr(connInfo)
+		if local == nil || d.Address == nil {
+			return false
+		}
+		host, _, err := net.SplitHostPort(local.String())
+		return err == nil && d.Address.Equal(net.ParseIP(host))
+	}
+	return false
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *MisconfigResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+
+	d := r.Find(qName)
+	var resp dns.DNSMessage
+	switch {
+	case d == nil:
+		resp = InitNXDOMAIN(qry)
+		switch {
+		case qName == r.Config.Zone && qType == dns.DNSRRTypeSOA:
+			resp.Header.RCode = dns.DNSResponseCodeNoErr
+			resp.Answer = append(resp.Answer, r.soa(r.Config.Zone))
+		case qName == r.Config.Zone:
+			resp.Header.RCode = dns.DNSResponseCodeNoErr
+			fallthrough
+		default:
+			resp.Authority = append(resp.Authority, r.soa(r.Config.Zone))
+		}
+		r.sign(qry, &resp, r.Config.DNSSEC)
+	case r.childSide(connInfo, d):
+		resp = r.child(qry, qName, qType, d)
+	case qName == d.Child && qType == dns.DNSRRTypeDS:
+		// DS 记录由父区域负责
+		resp = InitNXDOMAIN(qry)
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+		if r.Config.DNSSEC == nil {
+			resp.Authority = append(resp.Authority, r.soa(r.Config.Zone))
+			break
+		}
+		dConf := r.dsConfig(d)
+		if d.MissingDS {
+			resp.Authority = r.signParent(d, dns.DNSResponseSection{r.soa(r.Config.Zone), r.noDS(d)}, dConf)
+			break
+		}
+		resp.Answer = r.signParent(d, r.dsSet(d, dConf), dConf)
+	default:
+		resp = r.referral(qry, d)
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
+
+// sign 在 dConf 不为 nil 时签名回复
+func (r *MisconfigResponser) sign(qry dns.DNSMessage, resp *dns.DNSMessage, dConf *DNSSECConfig) {
+	if dConf != nil {
+		EnableDNSSEC(qry, resp, *dConf, &r.materialMap)
+	}
+}
+
+// dsConfig 返回签名委派的 DS 记录时使用的 DNSSEC 配置，ExpiredDS 时其签名已过期
+func (r *MisconfigResponser) dsConfig(d *MisconfigDelegation) DNSSECConfig {
+	dConf := *r.Config.DNSSEC
+	if d.ExpiredDS {
+		dConf.Validity.Mode = ValidityExpired
+	}
+	return dConf
+}
+
+// referral 以父区域的身份构建委派的转介回复
+func (r *MisconfigResponser) referral(qry dns.DNSMessage, d *MisconfigDelegation) dns.DNSMessage {
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	resp.Header.AA = false
+
+	for _, ns := range d.NameServers {
+		resp.Authority = append(resp.Authority, r.newRR(d.Child, &dns.DNSRDATANS{NSDNAME: ns}))
+	}
+	if !d.MissingGlue {
+		for _, ns := range d.NameServers {
+			if inBailiwick(ns, d.Child) {
+				resp.Additional = append(resp.Additional, r.address(ns, d.Address)...)
+			}
+		}
+	}
+
+	// 签名的转介回复携带子区域的 DS 记录，不安全委派则携带证明 DS 不存在的 NSEC 记录，均由父区域的 ZSK 签名
+	if r.Config.DNSSEC != nil {
+		dConf := r.dsConfig(d)
+		proof := r.dsSet(d, dConf)
+		if d.MissingDS {
+			proof = dns.DNSResponseSection{r.noDS(d)}
+		}
+		resp.Authority = append(resp.Authority, r.signParent(d, proof, dConf)...)
+	}
+	return resp
+}
+
+// dsSet 返回父区域为委派发布的 DS 记录，MismatchedDS 时其摘要被篡改
+func (r *MisconfigResponser) dsSet(d *MisconfigDelegation, dConf DNSSECConfig) dns.DNSResponseSection {
+	dsSet := dns.DNSResponseSection{}
+	for _, dMat := range GetSignerMaterials(d.Child, &r.materialMap, dConf) {
+		kskRData := dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY)
+		if !dsAlgoEnabled(dConf, kskRData.Algorithm) {
+			continue
+		}
+		ds := xperi.GenerateRRDS(d.Child, *kskRData, dConf.Type)
+		if d.MismatchedDS {
+			digest := ds.RData.(*dns.DNSRDATADS).Digest
+			digest[len(digest)-1] ^= 0xFF
+		}
+		dsSet = append(dsSet, ds)
+	}
+	return dsSet
+}
+
+// noDS 返回证明委派不存在 DS 记录的 NSEC 记录，
+// 其下一名称为父区域中按规范顺序紧随其后的委派，不存在时为区域顶点
+func (r *MisconfigResponser) noDS(d *MisconfigDelegation) dns.DNSResourceRecord {
+	key := dns.CanonicalNameKey(d.Child)
+	next, nextKey := r.Config.Zone, []byte(nil)
+	for child := range r.delegations {
+		k := dns.CanonicalNameKey(child)
+		if bytes.Compare(k, key) <= 0 || dns.IsSubDomain(child, d.Child) {
+			continue
+		}
+		if nextKey == nil || bytes.Compare(k, nextKey) < 0 {
+			next, nextKey = child, k
+		}
+	}
+	return r.newRR(d.Child, &dns.DNSRDATANSEC{
+		NextDomainName: next,
+		TypeBitMaps:    []dns.DNSType{dns.DNSRRTypeNS, dns.DNSRRTypeRRSIG, dns.DNSRRTypeNSEC},
+	})
+}
+
+// signParent 使用委派上级区域全部签名者的 ZSK 签名记录
+func (r *MisconfigResponser) signParent(d *MisconfigDelegation, section dns.DNSResponseSection, dConf DNSSECConfig) dns.DNSResponseSection {
+	upName := dns.GetUpperDomainName(&d.Child)
+	cMats := []CryptoMaterial{}
+	for _, dMat := range GetSignerMaterials(upName, &r.materialMap, dConf) {
+		cMats = append(cMats, ZSKCryptoMaterial(upName, dMat, dConf))
+	}
+	return SignSectionMulti(section, cMats)
+}
+
+// TrustAnchors 返回信任孤岛（MissingDS 或 MismatchedDS 的委派）子区域的正确 DS 记录，
+// 解析器可将其配置为信任锚，未启用 DNSSEC 时返回空切片。
+// 注意 DNSSEC 密钥在每次启动时重新生成，信任锚仅对当前实例有效。
+func (r *MisconfigResponser) TrustAnchors() []dns.DNSResourceRecord {
+	anchors := []dns.DNSResourceRecord{}
+	if r.Config.DNSSEC == nil {
+		return anchors
+	}
+	for i := range r.Config.Delegations {
+		d := &r.Config.Delegations[i]
+		if !d.MissingDS && !d.MismatchedDS {
+			continue
+		}
+		for _, dMat := range GetSignerMaterials(d.Child, &r.materialMap, *r.Config.DNSSEC) {
+			kskRData := dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY)
+			if dsAlgoEnabled(*r.Config.DNSSEC, kskRData.Algorithm) {
+				anchors = append(anchors, xperi.GenerateRRDS(d.Child, *kskRData, r.Config.DNSSEC.Type))
+			}
+		}
+	}
+	return anchors
+}
+
+// WriteTrustAnchors 以主文件格式写入 TrustAnchors 返回的信任锚，可直接用作 unbound 的 trust-anchor-file，
+// 伪造的孤岛之后附有以负信任锚代替信任锚时所使用的命令
+func (r *MisconfigResponser) WriteTrustAnchors(w io.Writer) error {
+	sb := strings.Builder{}
+	sb.WriteString("; trust anchors for islands of trust\n")
+	for _, ds := range r.TrustAnchors() {
+		fmt.Fprintf(&sb, "%s %d IN DS %s\n", fqdn(ds.Name.DomainName), r.Config.TTL, PresentRDATA(ds.RData))
+	}
+	for _, d := range r.Config.Delegations {
+		if d.MismatchedDS && r.Config.DNSSEC != nil {
+			fmt.Fprintf(&sb, "; %s is a bogus island, to skip validation instead:\n", fqdn(d.Child))
+			fmt.Fprintf(&sb, ";   unbound-control insecure_add %s\n;   rndc nta %s\n", fqdn(d.Child), fqdn(d.Child))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// child 以子区域权威服务器的身份构建回复
+func (r *MisconfigResponser) child(qry dns.DNSMessage, qName string, qType dns.DNSType, d *MisconfigDelegation) dns.DNSMessage {
+	resp := InitNXDOMAIN(qry)
+	if d.Lame {
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		resp.Header.AA = false
+		return resp
+	}
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+
+	nameServers := d.NameServers
+	if d.NSMismatch {
+		nameServers = []string{"mismatch-ns1." + d.Child}
+	}
+	isNS := false
+	for _, ns := range append(nameServers, d.NameServers...) {
+		isNS = isNS || dns.EqualDomainName(qName, ns)
+	}
+
+	switch {
+	case qName == d.Child && qType == dns.DNSRRTypeNS:
+		for _, ns := range nameServers {
+			resp.Answer = append(resp.Answer, r.newRR(d.Child, &dns.DNSRDATANS{NSDNAME: ns}))
+		}
+	case qName == d.Child && qType == dns.DNSRRTypeSOA:
+		resp.Answer = append(resp.Answer, r.soa(d.Child))
+	case isNS && d.NSCNAME && (qType == dns.DNSRRTypeA || qType == dns.DNSRRTypeAAAA || qType == dns.DNSRRTypeCNAME):
+		target := "host." + qName
+		resp.Answer = append(resp.Answer, r.newRR(qName, &dns.DNSRDATACNAME{CNAME: target}))
+		if qType != dns.DNSRRTypeCNAME {
+			resp.Answer = append(resp.Answer, r.addressOfType(target, d.Address, qType)...)
+		}
+	case qType == dns.DNSRRTypeA || qType == dns.DNSRRTypeAAAA:
+		resp.Answer = append(resp.Answer, r.addressOfType(qName, d.Address, qType)...)
+	}
+	if len(resp.Answer) == 0 && qType != dns.DNSRRTypeDNSKEY {
+		resp.Authority = append(resp.Authority, r.soa(d.Child))
+	}
+	r.sign(qry, &resp, r.Config.DNSSEC)
+	return resp
+}
+
+// address 返回名称的 A 或 AAAA 记录，地址为 nil 时返回空切片
+func (r *MisconfigResponser) address(name string, addr net.IP) []dns.DNSResourceRecord {
+	if addr == nil {
+		return nil
+	}
+	if addr.To4() != nil {
+		return []dns.DNSResourceRecord{r.newRR(name, &dns.DNSRDATAA{Address: addr})}
+	}
+	return []dns.DNSResourceRecord{r.newRR(name, &dns.DNSRDATAAAAA{Address: addr})}
+}
+
+// addressOfType 返回名称类型与查询类型相符的地址记录
+func (r *MisconfigResponser) addressOfType(name string, addr net.IP, qType dns.DNSType) []dns.DNSResourceRecord {
+	rrs := r.address(name, addr)
+	if len(rrs) == 0 || rrs[0].Type != qType {
+		return nil
+	}
+	return rrs
+}
+
+// soa 返回区域的 SOA 记录
+func (r *MisconfigResponser) soa(zone string) dns.DNSResourceRecord {
+	return r.newRR(zone, &dns.DNSRDATASOA{
+		MName:   "ns1." + zone,
+		RName:   "hostmaster." + zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minimum: r.Config.TTL,
+	})
+}
+
+// newRR 生成回复中的资源记录
+func (r *MisconfigResponser) newRR(owner string, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(owner),
+		Type:  rdata.Type(),
+		Class: dns.DNSClassIN,
+		TTL:   r.Config.TTL,
+		RDLen: 0,
+		RData: rdata,
+	}
+}
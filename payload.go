@@ -0,0 +1,121 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// payload.go 文件实现了对 EDNS UDP 载荷大小的协商执行。
+// 启用 NetterConfig.EnforcePayloadSize 后，Netter 在经由 UDP 发送回复时，
+// 会将回复长度与客户端在查询 OPT 记录中通告的 UDP 载荷大小比较，
+// 超出时以截断回复（TC=1）代替，并按客户端记录截断次数。
+// 查询未携带 OPT 记录时，通告大小视为 512 字节（RFC 6891 6.2.5 节）。
+//
+// 需要有意发送超长 UDP 回复的实验，可在回复器中对请求上下文调用 AllowOversize，
+// 或在直接调用 Netter.Send 时设置 ConnectionInfo.AllowOversize。
+
+package xdns
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// MinUDPPayloadSize 是 DNS 协议规定的最小 UDP 载荷大小，RFC 1035 4.2.1 节
+const MinUDPPayloadSize = 512
+
+// AdvertisedPayloadSize 返回查询中客户端通告的 UDP 载荷大小，
+// 查询无法解析、未携带 OPT 记录或通告值小于 512 时返回 512。
+func AdvertisedPayloadSize(connInfo ConnectionInfo) int {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return MinUDPPayloadSize
+	}
+	opt, ok := qry.OPT()
+	if !ok || int(opt.UDPPayloadSize) < MinUDPPayloadSize {
+		return MinUDPPayloadSize
+	}
+	return int(opt.UDPPayloadSize)
+}
+
+// TruncationCounter 按客户端记录回复因超出通告载荷大小而被截断的次数，可并发使用
+type TruncationCounter struct {
+	counts map[string]uint64
+	mu     sync.Mutex
+}
+
+// NewTruncationCounter 创建一个新的截断计数器
+func NewTruncationCounter() *TruncationCounter {
+	return &TruncationCounter{
+		counts: make(map[string]uint64),
+	}
+}
+
+// Record 记录一次对指定客户端的截断
+func (c *TruncationCounter) Record(clientIP string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[clientIP]++
+}
+
+// Count 返回指定客户端被截断的次数
+func (c *TruncationCounter) Count(clientIP string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[clientIP]
+}
+
+// Total 返回全部客户端被截断的总次数
+func (c *TruncationCounter) Total() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := uint64(0)
+	for _, count := range c.counts {
+		total += count
+	}
+	return total
+}
+
+// Snapshot 返回各客户端截断次数的副本
+func (c *TruncationCounter) Snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := make(map[string]uint64, len(c.counts))
+	for client, count := range c.counts {
+		snapshot[client] = count
+	}
+	return snapshot
+}
+
+// Clients 返回被截断过的客户端，按截断次数降序排列，次数相同时按地址排列
+func (c *TruncationCounter) Clients() []string {
+	snapshot := c.Snapshot()
+	clients := make([]string, 0, len(snapshot))
+	for client := range snapshot {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if snapshot[clients[i]] != snapshot[clients[j]] {
+			return snapshot[clients[i]] > snapshot[clients[j]]
+		}
+		return clients[i] < clients[j]
+	})
+	return clients
+}
+
+// WithOversizeOverride 返回可由 AllowOversize 标记的上下文，
+// 服务器在处理每个查询时均会调用该函数，回复器无需自行调用。
+func WithOversizeOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oversizeKey, new(atomic.Bool))
+}
+
+// AllowOversize 标记当前回复不受通告载荷大小的限制，
+// 上下文不是由 WithOversizeOverride 派生时不起作用。
+func AllowOversize(ctx context.Context) {
+	if flag, ok := ctx.Value(oversizeKey).(*atomic.Bool); ok {
+		flag.Store(true)
+	}
+}
+
+// OversizeAllowed 返回当前回复是否已被 AllowOversize 标记
+func OversizeAllowed(ctx context.Context) bool {
+	flag, ok := ctx.Value(oversizeKey).(*atomic.Bool)
+	return ok && flag.Load()
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// payload_test.go 文件用于对 EDNS UDP 载荷大小的协商执行进行测试。
+
+package xdns
+
+import (
+	"context"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 测试 AdvertisedPayloadSize 函数
+func TestAdvertisedPayloadSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		connInfo ConnectionInfo
+		expected int
+	}{
+		{"no OPT", newTestQuery("www.test", dns.DNSRRTypeA, 0), 512},
+		{"OPT 1232", newTestQuery("www.test", dns.DNSRRTypeA, 1232), 1232},
+		{"OPT 4096", newTestQuery("www.test", dns.DNSRRTypeA, 4096), 4096},
+		{"OPT below minimum", newTestQuery("www.test", dns.DNSRRTypeA, 100), 512},
+		{"malformed query", ConnectionInfo{Packet: []byte{0x12}}, 512},
+	}
+	for _, tt := range tests {
+		if got := AdvertisedPayloadSize(tt.connInfo); got != tt.expected {
+			t.Errorf("function AdvertisedPayloadSize() failed: %s:\ngot: %d\nexpected: %d", tt.name, got, tt.expected)
+		}
+	}
+}
+
+// 测试 TruncationCounter 的计数方法
+func TestTruncationCounter(t *testing.T) {
+	c := NewTruncationCounter()
+	if c.Total() != 0 || len(c.Clients()) != 0 {
+		t.Fatalf("function NewTruncationCounter() failed: counter is not empty")
+	}
+	for _, client := range []string{"192.0.2.2", "192.0.2.1", "192.0.2.3", "192.0.2.1", "192.0.2.3", "192.0.2.1"} {
+		c.Record(client)
+	}
+
+	if got := c.Count("192.0.2.1"); got != 3 {
+		t.Errorf("method TruncationCounter Count() failed:\ngot: %d\nexpected: 3", got)
+	}
+	if got := c.Count("192.0.2.9"); got != 0 {
+		t.Errorf("method TruncationCounter Count() failed:\ngot: %d\nexpected: 0", got)
+	}
+	if got := c.Total(); got != 6 {
+		t.Errorf("method TruncationCounter Total() failed:\ngot: %d\nexpected: 6", got)
+	}
+	// 按次数降序，次数相同时按地址排列
+	expected := []string{"192.0.2.1", "192.0.2.3", "192.0.2.2"}
+	if got := c.Clients(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("method TruncationCounter Clients() failed:\ngot: %v\nexpected: %v", got, expected)
+	}
+
+	// 快照不随之后的记录变化
+	snapshot := c.Snapshot()
+	c.Record("192.0.2.2")
+	if snapshot["192.0.2.2"] != 1 || c.Count("192.0.2.2") != 2 {
+		t.Errorf("method TruncationCounter Snapshot() failed: snapshot %v changed with the counter", snapshot)
+	}
+}
+
+// 测试 Netter 按通告载荷大小截断回复
+func TestNetterEnforcePayloadSize(t *testing.T) {
+	n := &Netter{
+		NetterLogger:       log.New(io.Discard, "", 0),
+		EnforcePayloadSize: true,
+		Truncations:        NewTruncationCounter(),
+	}
+	small := make([]byte, 512)
+	large := make([]byte, 1500)
+
+	connInfo := newTestQuery("www.test", dns.DNSRRTypeA, 1232)
+	if got := n.enforcePayloadSize(connInfo, small); len(got) != len(small) {
+		t.Errorf("method Netter enforcePayloadSize() failed: response within the limit changed to %d bytes", len(got))
+	}
+	got := n.enforcePayloadSize(connInfo, large)
+	msg := dns.DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(got, 0); err != nil || !msg.Header.TC || msg.Header.ID != 0x1234 {
+		t.Errorf("method Netter enforcePayloadSize() failed: expected a truncated response for query 0x1234, got %d bytes, %v", len(got), err)
+	}
+	if c := n.Truncations.Count("192.0.2.1"); c != 1 {
+		t.Errorf("method Netter enforcePayloadSize() failed: truncation count %d, expected 1", c)
+	}
+
+	// 链接允许超长回复或未启用时不截断
+	connInfo.AllowOversize = true
+	if got := n.enforcePayloadSize(connInfo, large); len(got) != len(large) {
+		t.Errorf("method Netter enforcePayloadSize() failed: AllowOversize response truncated to %d bytes", len(got))
+	}
+	n.EnforcePayloadSize = false
+	if got := n.enforcePayloadSize(newTestQuery("www.test", dns.DNSRRTypeA, 0), large); len(got) != len(large) {
+		t.Errorf("method Netter enforcePayloadSize() failed: disabled enforcement truncated to %d bytes", len(got))
+	}
+}
+
+// 测试 AllowOversize 及 OversizeAllowed 函数
+func TestAllowOversize(t *testing.T) {
+	ctx := context.Background()
+	AllowOversize(ctx)
+	if OversizeAllowed(ctx) {
+		t.Errorf("function OversizeAllowed() failed: plain context allowed oversize")
+	}
+
+	ctx = WithOversizeOverride(context.Background())
+	if OversizeAllowed(ctx) {
+		t.Errorf("function OversizeAllowed() failed: oversize allowed before AllowOversize")
+	}
+	AllowOversize(ctx)
+	if !OversizeAllowed(ctx) {
+		t.Errorf("function OversizeAllowed() failed: oversize not allowed after AllowOversize")
+	}
+}
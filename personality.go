@@ -0,0 +1,186 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// personality.go 文件定义了 PersonalityResponser 人格回复器。
+// 其为每个客户端 IP 分配一种回复“人格”（正常、缓慢、DNSSEC 签名错误、总是截断），
+// 分配可以按前缀静态指定，也可以按客户端哈希分配并随时间轮换，
+// 使得比较不同解析器群体的盲测实验可以由单个服务器实例完成。
+//
+// 分配是确定性的：给定客户端 IP 及时刻，Assign 总是返回相同的人格，
+// 因此实验结束后可以据此还原每个客户端在各时刻的分组，而无需在实验期间记录。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// Personality 表示一种回复人格
+type Personality int
+
+const (
+	// PersonalityNormal 原样返回被包装回复器的回复
+	PersonalityNormal Personality = iota
+	// PersonalitySlow 延迟 SlowDelay 后回复
+	PersonalitySlow
+	// PersonalityBogusDNSSEC 翻转回复中全部 RRSIG 签名的一个比特，使其无法通过验证
+	PersonalityBogusDNSSEC
+	// PersonalityTruncateAlways 经由 UDP 的查询总是得到截断的回复，经由 TCP 的查询正常回复
+	PersonalityTruncateAlways
+)
+
+// String 返回人格的名称
+func (p Personality) String() string {
+	switch p {
+	case PersonalityNormal:
+		return "normal"
+	case PersonalitySlow:
+		return "slow"
+	case PersonalityBogusDNSSEC:
+		return "bogus-dnssec"
+	case PersonalityTruncateAlways:
+		return "truncate-always"
+	}
+	return fmt.Sprintf("personality-%d", int(p))
+}
+
+// DefaultSlowDelay 为 PersonalitySlow 默认的回复延迟
+const DefaultSlowDelay = 2 * time.Second
+
+// PersonalityAssignment 表示一条静态分配：Prefix 内的客户端使用 Personality
+type PersonalityAssignment struct {
+	Prefix      *net.IPNet
+	Personality Personality
+}
+
+// PersonalityResponser 人格回复器：包装一个回复器，并按客户端的人格改写其回复。
+type PersonalityResponser struct {
+	Responser Responser
+	// 静态分配，按顺序使用首个包含客户端 IP 的分配
+	Static []PersonalityAssignment
+	// 未被静态分配的客户端按 IP 的哈希在其中选择，为空时为 PersonalityNormal
+	Rotation []Personality
+	// 轮换周期，不为 0 时客户端每经过一个周期改用 Rotation 中的下一个人格
+	Period time.Duration
+	// 轮换的起始时刻，零值表示 Unix 纪元
+	Epoch time.Time
+	// PersonalitySlow 的回复延迟，0 表示 DefaultSlowDelay
+	SlowDelay time.Duration
+
+	mu     sync.Mutex
+	served map[Personality]uint64
+}
+
+// Assign 返回客户端在指定时刻的人格
+// 其接受参数为：
+//   - ip net.IP，客户端 IP
+//   - now time.Time，查询时刻
+//
+// 返回值为：
+//   - Personality，首个包含客户端的静态分配的人格，
+//     均不包含时为按客户端哈希及所处轮换周期选择的人格
+func (r *PersonalityResponser) Assign(ip net.IP, now time.Time) Personality {
+	for _, a := range r.Static {
+		if a.Prefix != nil && a.Prefix.Contains(ip) {
+			return a.Personality
+		}
+	}
+	if len(r.Rotation) == 0 {
+		return PersonalityNormal
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	h := fnv.New32a()
+	h.Write(ip)
+	idx := uint64(h.Sum32())
+	if r.Period > 0 {
+		epoch := r.Epoch
+		if epoch.IsZero() {
+			epoch = time.Unix(0, 0)
+		}
+		if elapsed := now.Sub(epoch); elapsed > 0 {
+			idx += uint64(elapsed / r.Period)
+		}
+	}
+	return r.Rotation[idx%uint64(len(r.Rotation))]
+}
+
+// Response 以客户端的人格生成被包装回复器的回复。
+func (r *PersonalityResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+// 缓慢人格等待延迟时，若上下文先行结束，则返回上下文的错误。
+func (r *PersonalityResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	p := r.Assign(connInfo.ClientIP(), time.Now())
+	SpanFromContext(ctx).SetAttribute("xdns.personality", p.String())
+	r.mu.Lock()
+	if r.served == nil {
+		r.served = make(map[Personality]uint64)
+	}
+	r.served[p]++
+	r.mu.Unlock()
+
+	switch p {
+	case PersonalitySlow:
+		delay := r.SlowDelay
+		if delay <= 0 {
+			delay = DefaultSlowDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	case PersonalityTruncateAlways:
+		if connInfo.Protocol == ProtocolUDP && len(connInfo.Packet) >= 12 {
+			return InitTruncatedResponse(connInfo.Packet), nil
+		}
+	}
+
+	data, err := Respond(ctx, r.Responser, connInfo)
+	if err != nil || p != PersonalityBogusDNSSEC {
+		return data, err
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return data, fmt.Errorf("method PersonalityResponser ResponseContext failed: decode response failed.\n%v", err)
+	}
+	bogus := false
+	for _, section := range []dns.DNSResponseSection{resp.Answer, resp.Authority, resp.Additional} {
+		for i := range section {
+			if sig, ok := section[i].RData.(*dns.DNSRDATARRSIG); ok && len(sig.Signature) > 0 {
+				// 复制签名，以免修改签名缓存中的记录
+				sig.Signature = append([]byte{}, sig.Signature...)
+				sig.Signature[len(sig.Signature)/2] ^= 0x01
+				bogus = true
+			}
+		}
+	}
+	if !bogus {
+		return data, nil
+	}
+	return resp.Encode(), nil
+}
+
+// Served 返回各人格已回复的查询数量，键为人格名称
+func (r *PersonalityResponser) Served() map[string]uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	served := make(map[string]uint64, len(r.served))
+	for p, n := range r.served {
+		served[p.String()] = n
+	}
+	return served
+}
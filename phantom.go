@@ -0,0 +1,134 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// phantom.go 文件定义了 PhantomResponser 幻影域回复器。
+// 其模拟幻影域攻击（Phantom Domain Attack）中的恶意权威服务器：
+// 对幻影域中的查询，仅以一定比例在极长的延迟后回复，其余查询则不作任何回复，
+// 使解析器的未完成查询长期占用，用于测量解析器未完成查询数量上限及其超时策略。
+//
+// 延迟期间回复器持有查询，服务器的 ResponseTimeout 应大于最大延迟，否则延迟的回复将被替换为 SERVFAIL。
+
+package xdns
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// PhantomDistribution 表示幻影域回复延迟的分布
+type PhantomDistribution int
+
+const (
+	// PhantomDistributionConstant 延迟固定为 MaxDelay
+	PhantomDistributionConstant PhantomDistribution = iota
+	// PhantomDistributionUniform 延迟均匀分布于 [MinDelay, MaxDelay)
+	PhantomDistributionUniform
+	// PhantomDistributionExponential 延迟为 MinDelay 加上均值为 MeanDelay 的指数分布，且不超过 MaxDelay
+	PhantomDistributionExponential
+)
+
+// PhantomStats 记录幻影域回复器的统计信息
+type PhantomStats struct {
+	// 延迟后回复的查询数量
+	Delayed uint64 `json:"delayed"`
+	// 不作回复的查询数量
+	Dropped uint64 `json:"dropped"`
+	// 正在延迟中的查询数量
+	Pending int64 `json:"pending"`
+}
+
+// PhantomResponser 幻影域回复器：包装一个回复器，仅以一定比例在长延迟后回复幻影域中的查询。
+// 其零值即可使用，此时全部查询均不作回复。
+type PhantomResponser struct {
+	Responser Responser
+	// 幻影域，为空时全部区域均为幻影域
+	Zones []string
+	// 回复的比例，位于 [0, 1] 之间，其余查询不作回复
+	AnswerRatio float64
+	// 延迟分布及其参数
+	Distribution PhantomDistribution
+	MinDelay     time.Duration
+	MaxDelay     time.Duration
+	MeanDelay    time.Duration
+
+	stats PhantomStats
+}
+
+// IsPhantom 检查名称是否位于幻影域之内
+func (r *PhantomResponser) IsPhantom(qName string) bool {
+	if len(r.Zones) == 0 {
+		return true
+	}
+	for _, zone := range r.Zones {
+		if dns.IsSubDomain(qName, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// sample 决定是否回复查询，并按分布抽取回复前的延迟
+func (r *PhantomResponser) sample() (bool, time.Duration) {
+	if xperi.RandomFloat64() >= r.AnswerRatio {
+		return false, 0
+	}
+
+	delay := r.MaxDelay
+	switch r.Distribution {
+	case PhantomDistributionUniform:
+		if r.MaxDelay > r.MinDelay {
+			delay = r.MinDelay + time.Duration(xperi.RandomInt63n(int64(r.MaxDelay-r.MinDelay)))
+		}
+	case PhantomDistributionExponential:
+		delay = r.MinDelay + time.Duration(xperi.RandomExpFloat64()*float64(r.MeanDelay))
+		if r.MaxDelay > 0 && delay > r.MaxDelay {
+			delay = r.MaxDelay
+		}
+	}
+	return true, delay
+}
+
+// Response 生成被包装回复器的回复，幻影域中未被选中回复的查询返回 ErrDropResponse。
+func (r *PhantomResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+// 延迟期间若上下文先行结束，则返回上下文的错误。
+func (r *PhantomResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil || len(qry.Question) == 0 || !r.IsPhantom(qry.Question[0].Name.DomainName) {
+		return Respond(ctx, r.Responser, connInfo)
+	}
+
+	answer, delay := r.sample()
+	if !answer {
+		atomic.AddUint64(&r.stats.Dropped, 1)
+		return nil, ErrDropResponse
+	}
+	SpanFromContext(ctx).SetAttribute("xdns.phantom.delay", delay.String())
+	atomic.AddInt64(&r.stats.Pending, 1)
+	timer := time.NewTimer(delay)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+		atomic.AddInt64(&r.stats.Pending, -1)
+		return nil, ctx.Err()
+	}
+	atomic.AddInt64(&r.stats.Pending, -1)
+	atomic.AddUint64(&r.stats.Delayed, 1)
+	return Respond(ctx, r.Responser, connInfo)
+}
+
+// Stats 返回幻影域回复器的统计信息
+func (r *PhantomResponser) Stats() PhantomStats {
+	return PhantomStats{
+		Delayed: atomic.LoadUint64(&r.stats.Delayed),
+		Dropped: atomic.LoadUint64(&r.stats.Dropped),
+		Pending: atomic.LoadInt64(&r.stats.Pending),
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// planner.go 文件定义了 SizePlanner 回复大小规划器。
+// 给定回复的字节预算（如保持在 1232 字节以内，或经由 TCP 恰好超过 65535 字节），
+// 其会计算出可容纳多少条填充记录，并据此构建回复部分，
+// 以替代示例中重复出现的 "62000 / (qNameSize + ...)" 手工计算。
+
+package xdns
+
+import (
+	"context"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 常用的回复大小预算
+const (
+	// BudgetUDPLegacy 不支持 EDNS 时的 UDP 消息大小上限
+	BudgetUDPLegacy = 512
+	// BudgetUDPSafe DNS Flag Day 2020 建议的 EDNS UDP 消息大小
+	BudgetUDPSafe = 1232
+	// BudgetTCPMax TCP 消息的大小上限
+	BudgetTCPMax = 65535
+)
+
+// RecordSize 计算未压缩的资源记录大小
+// 其接受参数为：
+//   - name string，记录的所有者名称
+//   - rdataSize int，RDATA 的大小
+//
+// 返回值为：
+//   - int，资源记录的大小，即 名称 + 10（Type、Class、TTL、RDLength）+ RDATA
+func RecordSize(name string, rdataSize int) int {
+	return dns.GetDomainNameWireLen(&name) + 10 + rdataSize
+}
+
+// SizePlanner 回复大小规划器：根据字节预算计算并生成填充记录。
+type SizePlanner struct {
+	// 字节预算
+	Budget int
+	// 为 true 时，规划的目标为恰好超过预算，而不是保持在预算以内
+	Exceed bool
+
+	// 已占用的字节数
+	used int
+}
+
+// NewSizePlanner 创建一个新的回复大小规划器
+// 其接受参数为：
+//   - budget int，字节预算
+//   - base *dns.DNSMessage，基础回复，其大小计入已占用的字节数，可以为 nil
+//
+// 返回值为：
+//   - *SizePlanner，创建的回复大小规划器
+func NewSizePlanner(budget int, base *dns.DNSMessage) *SizePlanner {
+	planner := &SizePlanner{
+		Budget: budget,
+	}
+	if base != nil {
+		planner.used = base.Size()
+	}
+	return planner
+}
+
+// Used 返回已占用的字节数
+func (p *SizePlanner) Used() int {
+	return p.used
+}
+
+// Remaining 返回预算中剩余的字节数，超出预算时为负数
+func (p *SizePlanner) Remaining() int {
+	return p.Budget - p.used
+}
+
+// Reserve 预留指定字节数，如之后将添加的签名或 OPT 记录
+func (p *SizePlanner) Reserve(size int) {
+	p.used += size
+}
+
+// Fit 计算指定大小的记录所需的数量
+// 保持在预算以内时，返回不超出预算的最大数量；
+// 要求超过预算时，返回使总大小超过预算的最小数量。
+// 其接受参数为：
+//   - rrSize int，单条记录的大小
+//
+// 返回值为：
+//   - int，记录数量
+func (p *SizePlanner) Fit(rrSize int) int {
+	if rrSize <= 0 {
+		return 0
+	}
+	remaining := p.Remaining()
+	if remaining < 0 {
+		return 0
+	}
+	if p.Exceed {
+		return remaining/rrSize + 1
+	}
+	return remaining / rrSize
+}
+
+// Fill 使用生成函数依次生成填充记录，直到达到预算
+// 每条记录的大小按其实际大小计算，因此记录大小可以不同。
+// 其接受参数为：
+//   - gen func(i int) dns.DNSResourceRecord，生成第 i 条填充记录的函数
+//
+// 返回值为：
+//   - []dns.DNSResourceRecord，生成的填充记录，其大小已计入已占用的字节数
+func (p *SizePlanner) Fill(gen func(i int) dns.DNSResourceRecord) []dns.DNSResourceRecord {
+	rrs := []dns.DNSResourceRecord{}
+	for i := 0; ; i++ {
+		if p.Exceed && p.used > p.Budget {
+			break
+		}
+		rr := gen(i)
+		size := rr.Size()
+		if size <= 0 {
+			break
+		}
+		if !p.Exceed && p.used+size > p.Budget {
+			break
+		}
+		rrs = append(rrs, rr)
+		p.used += size
+	}
+	return rrs
+}
+
+// FillContext 与 Fill 相同，并将每条记录计入上下文中的内存预算，
+// 超出内存预算时中止生成。
+// 返回值为：
+//   - []dns.DNSResourceRecord，生成的填充记录
+//   - error，超出内存预算时返回包装了 ErrMemoryBudgetExceeded 的错误
+func (p *SizePlanner) FillContext(ctx context.Context, gen func(i int) dns.DNSResourceRecord) ([]dns.DNSResourceRecord, error) {
+	rrs := []dns.DNSResourceRecord{}
+	for i := 0; ; i++ {
+		if p.Exceed && p.used > p.Budget {
+			break
+		}
+		rr := gen(i)
+		size := rr.Size()
+		if size <= 0 {
+			break
+		}
+		if !p.Exceed && p.used+size > p.Budget {
+			break
+		}
+		if err := ChargeMemory(ctx, size); err != nil {
+			return rrs, err
+		}
+		rrs = append(rrs, rr)
+		p.used += size
+	}
+	return rrs, nil
+}
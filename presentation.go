@@ -0,0 +1,136 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// presentation.go 文件定义了记录数据文本表示的解析，是 PresentRDATA 的逆操作，
+// 供配置文件及外部脚本以文本描述资源记录。
+
+package xdns
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ParseRDATA 将记录数据的文本表示解析为 RDATA
+// 目前支持的类型为 A、AAAA、NS、CNAME、DNAME、PTR、TXT、SOA、DS 及 DNSKEY：
+//   - SOA 的数据格式为 "MNAME RNAME SERIAL REFRESH RETRY EXPIRE MINIMUM"
+//   - DS 的数据格式为 "KEYTAG ALGORITHM DIGESTTYPE 十六进制摘要"
+//   - DNSKEY 的数据格式为 "FLAGS PROTOCOL ALGORITHM Base64公钥"
+//   - TXT 的数据整体作为一个字符串，超过 255 字节时被拆分
+//
+// 记录数据中的域名将被转换为小写并去除末尾的 "."。
+// 任意类型的数据均可使用 RFC 3597 的通用格式，如 "\# 4 0A0A0A0A"。
+// 其接受参数为：
+//   - rrType dns.DNSType，记录类型
+//   - s string，记录数据的文本表示
+//
+// 返回值为：
+//   - dns.DNSRRRDATA，解析得到的 RDATA
+//   - error，错误信息
+func ParseRDATA(rrType dns.DNSType, s string) (dns.DNSRRRDATA, error) {
+	if dns.IsRDATAGeneric(s) {
+		generic, err := dns.ParseRDATAGeneric(rrType, s)
+		if err != nil {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid generic data %q.\n%v", s, err)
+		}
+		return generic, nil
+	}
+
+	fields := strings.Fields(s)
+	switch rrType {
+	case dns.DNSRRTypeA, dns.DNSRRTypeAAAA:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid address %q", s)
+		}
+		if rrType == dns.DNSRRTypeA {
+			return &dns.DNSRDATAA{Address: ip}, nil
+		}
+		return &dns.DNSRDATAAAAA{Address: ip}, nil
+	case dns.DNSRRTypeNS:
+		return &dns.DNSRDATANS{NSDNAME: rdataName(s)}, nil
+	case dns.DNSRRTypeCNAME:
+		return &dns.DNSRDATACNAME{CNAME: rdataName(s)}, nil
+	case dns.DNSRRTypeDNAME:
+		return &dns.DNSRDATADNAME{DNAME: rdataName(s)}, nil
+	case dns.DNSRRTypePTR:
+		return &dns.DNSRDATAPTR{PTR: rdataName(s)}, nil
+	case dns.DNSRRTypeTXT:
+		return dns.NewDNSRDATATXT(s), nil
+	case dns.DNSRRTypeSOA:
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid SOA data %q", s)
+		}
+		values, ok := rdataUints(fields[2:], 32)
+		if !ok {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid SOA data %q", s)
+		}
+		return &dns.DNSRDATASOA{
+			MName:   rdataName(fields[0]),
+			RName:   rdataName(fields[1]),
+			Serial:  uint32(values[0]),
+			Refresh: uint32(values[1]),
+			Retry:   uint32(values[2]),
+			Expire:  uint32(values[3]),
+			Minimum: uint32(values[4]),
+		}, nil
+	case dns.DNSRRTypeDS:
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid DS data %q", s)
+		}
+		values, ok := rdataUints(fields[:3], 16)
+		digest, err := hex.DecodeString(strings.Join(fields[3:], ""))
+		if !ok || err != nil || values[1] > 255 || values[2] > 255 {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid DS data %q", s)
+		}
+		return &dns.DNSRDATADS{
+			KeyTag:     uint16(values[0]),
+			Algorithm:  dns.DNSSECAlgorithm(values[1]),
+			DigestType: dns.DNSSECDigestType(values[2]),
+			Digest:     digest,
+		}, nil
+	case dns.DNSRRTypeDNSKEY:
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid DNSKEY data %q", s)
+		}
+		values, ok := rdataUints(fields[:3], 16)
+		key, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+		if !ok || err != nil || values[1] > 255 || values[2] > 255 {
+			return nil, fmt.Errorf("function ParseRDATA failed: invalid DNSKEY data %q", s)
+		}
+		return &dns.DNSRDATADNSKEY{
+			Flags:     dns.DNSKEYFlag(values[0]),
+			Protocol:  dns.DNSKEYProtocol(values[1]),
+			Algorithm: dns.DNSSECAlgorithm(values[2]),
+			PublicKey: key,
+		}, nil
+	}
+	return nil, fmt.Errorf("function ParseRDATA failed: unsupported record type %s, use the generic \\# form", dns.FormatDNSType(rrType))
+}
+
+// rdataName 返回记录数据中规范化的域名
+func rdataName(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// rdataUints 将数据字段解析为无符号整数
+func rdataUints(fields []string, bitSize int) ([]uint64, bool) {
+	values := make([]uint64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 10, bitSize)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// presentation_test.go 文件用于对记录数据文本表示的解析进行测试。
+
+package xdns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 测试 ParseRDATA 函数
+func TestParseRDATA(t *testing.T) {
+	tests := []struct {
+		rrType   dns.DNSType
+		data     string
+		expected dns.DNSRRRDATA
+	}{
+		{dns.DNSRRTypeA, "10.0.0.1", &dns.DNSRDATAA{Address: net.IPv4(10, 0, 0, 1)}},
+		{dns.DNSRRTypeAAAA, "2001:db8::1", &dns.DNSRDATAAAAA{Address: net.ParseIP("2001:db8::1")}},
+		{dns.DNSRRTypeNS, "NS.Test.", &dns.DNSRDATANS{NSDNAME: "ns.test"}},
+		{dns.DNSRRTypeCNAME, "www.test", &dns.DNSRDATACNAME{CNAME: "www.test"}},
+		{dns.DNSRRTypeDNAME, ".", &dns.DNSRDATADNAME{DNAME: "."}},
+		{dns.DNSRRTypePTR, "host.test.", &dns.DNSRDATAPTR{PTR: "host.test"}},
+		{dns.DNSRRTypeTXT, "hello world", &dns.DNSRDATATXT{TXT: []string{"hello world"}}},
+		{dns.DNSRRTypeTXT, strings.Repeat("x", 300), &dns.DNSRDATATXT{TXT: []string{strings.Repeat("x", 255), strings.Repeat("x", 45)}}},
+		{dns.DNSRRTypeSOA, "ns.test. hostmaster.test. 1 3600 1800 604800 60", &dns.DNSRDATASOA{
+			MName: "ns.test", RName: "hostmaster.test", Serial: 1, Refresh: 3600, Retry: 1800, Expire: 604800, Minimum: 60,
+		}},
+		{dns.DNSRRTypeDS, "12345 13 2 AABB CCDD", &dns.DNSRDATADS{
+			KeyTag: 12345, Algorithm: dns.DNSSECAlgorithmECDSAP256SHA256, DigestType: dns.DNSSECDigestTypeSHA256, Digest: []byte{0xaa, 0xbb, 0xcc, 0xdd},
+		}},
+		{dns.DNSRRTypeDNSKEY, "257 3 13 AQID BA==", &dns.DNSRDATADNSKEY{
+			Flags: 257, Protocol: 3, Algorithm: dns.DNSSECAlgorithmECDSAP256SHA256, PublicKey: []byte{1, 2, 3, 4},
+		}},
+		// RFC 3597 的通用格式
+		{dns.DNSRRTypeA, `\# 4 0A0A0A0A`, &dns.DNSRDATAA{Address: net.IPv4(10, 10, 10, 10)}},
+	}
+	for _, tt := range tests {
+		rdata, err := ParseRDATA(tt.rrType, tt.data)
+		if err != nil {
+			t.Errorf("function ParseRDATA(%s, %q) failed:\n%v", tt.rrType, tt.data, err)
+			continue
+		}
+		if string(rdata.Encode()) != string(tt.expected.Encode()) {
+			t.Errorf("function ParseRDATA(%s, %q) failed:\ngot:\n%v\nexpected:\n%v", tt.rrType, tt.data, rdata.String(), tt.expected.String())
+		}
+	}
+}
+
+// 测试 ParseRDATA 函数对非法数据的处理
+func TestParseRDATAInvalid(t *testing.T) {
+	tests := []struct {
+		rrType dns.DNSType
+		data   string
+	}{
+		{dns.DNSRRTypeA, "10.0.0"},
+		{dns.DNSRRTypeAAAA, "not-an-address"},
+		{dns.DNSRRTypeSOA, "ns.test. hostmaster.test. 1 3600 1800 604800"},
+		{dns.DNSRRTypeSOA, "ns.test. hostmaster.test. 1 3600 1800 604800 -1"},
+		{dns.DNSRRTypeSOA, "ns.test. hostmaster.test. 4294967296 3600 1800 604800 60"},
+		{dns.DNSRRTypeDS, "12345 13 2"},
+		{dns.DNSRRTypeDS, "12345 256 2 AABB"},
+		{dns.DNSRRTypeDS, "12345 13 2 XYZ"},
+		{dns.DNSRRTypeDS, "65536 13 2 AABB"},
+		{dns.DNSRRTypeDNSKEY, "257 3 13"},
+		{dns.DNSRRTypeDNSKEY, "257 3 13 !!!"},
+		{dns.DNSRRTypeDNSKEY, "257 300 13 AQID"},
+		{dns.DNSRRTypeA, `\# 4 0A0A`},
+		{dns.DNSRRTypeMX, "10 mail.test"},
+	}
+	for _, tt := range tests {
+		if rdata, err := ParseRDATA(tt.rrType, tt.data); err == nil {
+			t.Errorf("function ParseRDATA(%s, %q) failed: expected an error but got %v", tt.rrType, tt.data, rdata.String())
+		}
+	}
+}
+
+// 测试 ParseRDATA 与 PresentRDATA 互为逆操作
+func TestParseRDATAPresentRoundTrip(t *testing.T) {
+	tests := []struct {
+		rrType dns.DNSType
+		data   string
+	}{
+		{dns.DNSRRTypeA, "10.0.0.1"},
+		{dns.DNSRRTypeNS, "ns.test."},
+		{dns.DNSRRTypeSOA, "ns.test. hostmaster.test. 1 3600 1800 604800 60"},
+		{dns.DNSRRTypeDS, "12345 13 2 AABBCCDD"},
+		{dns.DNSRRTypeDNSKEY, "257 3 13 AQIDBA=="},
+	}
+	for _, tt := range tests {
+		rdata, err := ParseRDATA(tt.rrType, tt.data)
+		if err != nil {
+			t.Fatalf("function ParseRDATA(%s, %q) failed:\n%v", tt.rrType, tt.data, err)
+		}
+		if got := PresentRDATA(rdata); got != tt.data {
+			t.Errorf("function PresentRDATA() failed:\ngot: %q\nexpected: %q", got, tt.data)
+		}
+	}
+}
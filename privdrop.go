@@ -0,0 +1,46 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// privdrop.go 文件定义了绑定端口后降低进程权限的辅助函数。
+// 以 root 身份启动的 xdns 可在 Netter 绑定 53 端口后切换至指定的用户及用户组，
+// 平台相关的实现位于 privdrop_unix.go 及 privdrop_other.go。
+
+package xdns
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// lookupIDs 根据用户名及用户组名查找对应的 UID 及 GID
+// 用户名及用户组名也可以直接为数字 ID；若用户组为空，则使用该用户的主用户组。
+func lookupIDs(userName, groupName string) (int, int, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		u, err = user.LookupId(userName)
+		if err != nil {
+			return -1, -1, fmt.Errorf("function lookupIDs failed: unknown user %s.\n%v", userName, err)
+		}
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, -1, fmt.Errorf("function lookupIDs failed: invalid uid %s.\n%v", u.Uid, err)
+	}
+
+	gidStr := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+			if err != nil {
+				return -1, -1, fmt.Errorf("function lookupIDs failed: unknown group %s.\n%v", groupName, err)
+			}
+		}
+		gidStr = g.Gid
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return -1, -1, fmt.Errorf("function lookupIDs failed: invalid gid %s.\n%v", gidStr, err)
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,15 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build !unix
+
+package xdns
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// DropPrivileges 在非 Unix 平台上不受支持，总是返回错误
+func DropPrivileges(userName, groupName string) error {
+	return fmt.Errorf("function DropPrivileges failed: not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build unix
+
+package xdns
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// DropPrivileges 将进程切换至指定的用户及用户组，并清空附加用户组
+// 应在绑定特权端口后调用；切换后无法再恢复 root 权限。
+// 其接受参数为：
+//   - userName string，用户名或 UID
+//   - groupName string，用户组名或 GID，为空时使用该用户的主用户组
+//
+// 返回值为：
+//   - error，错误信息
+func DropPrivileges(userName, groupName string) error {
+	uid, gid, err := lookupIDs(userName, groupName)
+	if err != nil {
+		return fmt.Errorf("function DropPrivileges failed: %v", err)
+	}
+	// 先切换用户组，切换用户后将无权再修改用户组
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return fmt.Errorf("function DropPrivileges failed: setgroups failed.\n%v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("function DropPrivileges failed: setgid %d failed.\n%v", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("function DropPrivileges failed: setuid %d failed.\n%v", uid, err)
+	}
+	return nil
+}
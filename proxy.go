@@ -0,0 +1,170 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// proxy.go 文件定义了 ProxyResponser 变换代理回复器。
+// 其将每个查询原样转发至上游服务器，再按规则对真实的回复进行变换后返回给客户端：
+// 删除 RRSIG、压低 TTL、替换 A/AAAA 记录的地址、在附加部分注入额外的记录，
+// 使得中间人式的实验可以直接使用真实的区域数据，而无需在本地重建区域。
+//
+// 查询经由与客户端相同的传输协议转发，上游的截断回复同样原样返回，由解析器自行改用 TCP 重新查询。
+// 没有规则匹配查询时，上游回复的字节不经解码直接返回。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+)
+
+// ProxyRule 表示一条回复变换规则
+type ProxyRule struct {
+	// 规则生效的区域，查询名称位于其中时应用规则，为空时对全部查询生效
+	Zone string
+	// 是否删除全部 RRSIG 记录
+	StripRRSIG bool
+	// TTL 上限，大于该值的 TTL 将被压低，0 表示不修改
+	MaxTTL uint32
+	// 回答部分 A 记录的替换地址，为 nil 时不替换
+	ReplaceA net.IP
+	// 回答部分 AAAA 记录的替换地址，为 nil 时不替换
+	ReplaceAAAA net.IP
+	// 注入附加部分的记录
+	InjectAdditional []dns.DNSResourceRecord
+}
+
+// matches 检查规则是否对查询名称生效
+func (rule ProxyRule) matches(qName string) bool {
+	return dns.IsSubDomain(qName, rule.Zone)
+}
+
+// apply 对回复应用变换规则
+func (rule ProxyRule) apply(resp *dns.DNSMessage) {
+	sections := []*dns.DNSResponseSection{&resp.Answer, &resp.Authority, &resp.Additional}
+	for _, section := range sections {
+		if rule.StripRRSIG {
+			*section = section.RemoveRRSIGs()
+		}
+		// OPT 记录的 TTL 字段为扩展标志，不作修改
+		for i, rr := range *section {
+			if rule.MaxTTL > 0 && rr.TTL > rule.MaxTTL && rr.Type != dns.DNSRRTypeOPT {
+				(*section)[i].TTL = rule.MaxTTL
+			}
+		}
+	}
+
+	for i, rr := range resp.Answer {
+		switch {
+		case rr.Type == dns.DNSRRTypeA && rule.ReplaceA != nil:
+			rdata := &dns.DNSRDATAA{Address: rule.ReplaceA}
+			resp.Answer[i].RData, resp.Answer[i].RDLen = rdata, uint16(rdata.Size())
+		case rr.Type == dns.DNSRRTypeAAAA && rule.ReplaceAAAA != nil:
+			rdata := &dns.DNSRDATAAAAA{Address: rule.ReplaceAAAA}
+			resp.Answer[i].RData, resp.Answer[i].RDLen = rdata, uint16(rdata.Size())
+		}
+	}
+	resp.Additional = append(resp.Additional, rule.InjectAdditional...)
+}
+
+// ProxyConfig 记录变换代理回复器的配置
+type ProxyConfig struct {
+	// 上游服务器地址，形如 "8.8.8.8:53"
+	Upstream string
+	// 单次转发的超时时间，0 表示 5 秒
+	Timeout time.Duration
+	// 出站查询引擎，为 nil 时每次转发新建套接字，可与其他转发者共享
+	Engine *client.Engine
+	// 变换规则，按顺序应用全部匹配查询的规则
+	Rules []ProxyRule
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// ProxyResponser 变换代理回复器：转发查询至上游，并按规则变换上游的回复。
+type ProxyResponser struct {
+	Config      ProxyConfig
+	ProxyLogger *log.Logger
+
+	client    *client.Client
+	forwarded uint64
+	mutated   uint64
+}
+
+// NewProxyResponser 根据配置创建一个新的变换代理回复器
+func NewProxyResponser(conf ProxyConfig) *ProxyResponser {
+	proxyLogger := log.New(conf.LogWriter, "Proxy: ", log.LstdFlags)
+	return &ProxyResponser{
+		Config:      conf,
+		ProxyLogger: proxyLogger,
+		client: client.NewClient(client.ClientConfig{
+			Server:  conf.Upstream,
+			Timeout: conf.Timeout,
+			Engine:  conf.Engine,
+		}),
+	}
+}
+
+// Response 转发查询，并返回变换后的上游回复。
+func (p *ProxyResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return p.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并在追踪时记录 "forward" span。
+func (p *ProxyResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	network := "udp"
+	if connInfo.Protocol == ProtocolTCP {
+		network = "tcp"
+	}
+	_, span := StartSpan(ctx, "forward", SpanKindClient)
+	span.SetAttribute("server.address", p.Config.Upstream)
+	data, err := p.client.ExchangeRaw(connInfo.Packet, network)
+	span.Finish()
+	if err != nil {
+		return []byte{}, fmt.Errorf("method ProxyResponser ResponseContext failed: forward to %s failed.\n%v", p.Config.Upstream, err)
+	}
+	atomic.AddUint64(&p.forwarded, 1)
+
+	rules := []ProxyRule{}
+	for _, rule := range p.Config.Rules {
+		if len(qry.Question) > 0 && rule.matches(qry.Question[0].Name.DomainName) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return data, nil
+	}
+
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		p.ProxyLogger.Printf("Relaying undecodable upstream response to %s unchanged: %v", qry.Question[0].Name.DomainName, err)
+		return data, nil
+	}
+	for _, rule := range rules {
+		rule.apply(&resp)
+	}
+	FixCount(&resp)
+	atomic.AddUint64(&p.mutated, 1)
+	serverVars.Add("proxy_mutated", 1)
+	return resp.Encode(), nil
+}
+
+// Forwarded 返回已转发的查询数量
+func (p *ProxyResponser) Forwarded() uint64 {
+	return atomic.LoadUint64(&p.forwarded)
+}
+
+// Mutated 返回经过变换的回复数量
+func (p *ProxyResponser) Mutated() uint64 {
+	return atomic.LoadUint64(&p.mutated)
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// proxyproto.go 文件实现了 HAProxy PROXY 协议（v1 / v2）的解析。
+// 当 xdns 部署于负载均衡器之后时，TCP 链接的对端地址为负载均衡器的地址，
+// 启用 PROXY 协议后，Netter 会从链接头部中解析出真实的客户端地址，
+// 并将其记录在 ConnectionInfo 中，以便针对特定客户端进行实验。
+//
+// 协议规范请参阅：https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+
+package xdns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PROXY 协议 v2 签名
+var proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// PROXY 协议 v1 头部最大长度（含 CRLF）
+const proxyV1MaxLength = 107
+
+// ProxyHeader 表示 PROXY 协议头部所携带的信息
+type ProxyHeader struct {
+	// 协议版本，1 或 2
+	Version int
+	// 是否为 LOCAL 命令（健康检查等），此时不携带客户端地址
+	Local bool
+	// 原始客户端地址
+	SourceAddr net.Addr
+	// 原始目的地址
+	DestinationAddr net.Addr
+}
+
+// ReadProxyHeader 从流中读取并解析 PROXY 协议头部
+// 其接受参数为：
+//   - r io.Reader，流式链接
+//
+// 返回值为：
+//   - ProxyHeader，解析后的 PROXY 协议头部
+//   - error，错误信息
+//
+// 该函数只会读取 PROXY 协议头部所占用的字节，之后的数据仍保留在流中。
+func ReadProxyHeader(r io.Reader) (ProxyHeader, error) {
+	// v1 头部最短为 "PROXY UNKNOWN\r\n"，共 15 字节，
+	// 故先读取 v2 签名长度的字节，用以区分协议版本。
+	prefix := make([]byte, len(proxyV2Signature))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return ProxyHeader{}, fmt.Errorf("function ReadProxyHeader failed: read prefix failed.\n%v", err)
+	}
+
+	if bytes.Equal(prefix, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return readProxyV1(r, prefix)
+	}
+	return ProxyHeader{}, fmt.Errorf("function ReadProxyHeader failed: invalid PROXY protocol signature %v", prefix)
+}
+
+// readProxyV2 解析 PROXY 协议 v2 签名之后的部分
+//
+//	+--------+--------+--------+--------+
+//	| ver|cmd|  fam   |       len       |
+//	+--------+--------+--------+--------+
+//	|          addresses / TLVs         |
+//	+--------+--------+--------+--------+
+func readProxyV2(r io.Reader) (ProxyHeader, error) {
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV2 failed: read header failed.\n%v", err)
+	}
+	if hdr[0]>>4 != 2 {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV2 failed: unsupported version %d", hdr[0]>>4)
+	}
+	cmd := hdr[0] & 0x0F
+	fam := hdr[1] >> 4
+	proto := hdr[1] & 0x0F
+	pLen := int(binary.BigEndian.Uint16(hdr[2:]))
+
+	payload := make([]byte, pLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV2 failed: read addresses failed.\n%v", err)
+	}
+
+	header := ProxyHeader{Version: 2}
+	switch cmd {
+	case 0x0:
+		// LOCAL 命令，使用链接的真实对端地址
+		header.Local = true
+		return header, nil
+	case 0x1:
+		// PROXY 命令
+	default:
+		return ProxyHeader{}, fmt.Errorf("function readProxyV2 failed: unsupported command %d", cmd)
+	}
+
+	var ipLen int
+	switch fam {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC 及 AF_UNIX，不携带可用的 IP 地址
+		header.Local = true
+		return header, nil
+	}
+	if pLen < 2*ipLen+4 {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV2 failed: address block length %d is less than %d", pLen, 2*ipLen+4)
+	}
+
+	srcIP := net.IP(append([]byte{}, payload[:ipLen]...))
+	dstIP := net.IP(append([]byte{}, payload[ipLen:2*ipLen]...))
+	srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+
+	if proto == 0x2 {
+		// DGRAM
+		header.SourceAddr = &net.UDPAddr{IP: srcIP, Port: srcPort}
+		header.DestinationAddr = &net.UDPAddr{IP: dstIP, Port: dstPort}
+	} else {
+		header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+		header.DestinationAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	}
+	return header, nil
+}
+
+// readProxyV1 解析 PROXY 协议 v1 的文本头部，形如：
+//
+//	PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readProxyV1(r io.Reader, prefix []byte) (ProxyHeader, error) {
+	line := append([]byte{}, prefix...)
+	one := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return ProxyHeader{}, fmt.Errorf("function readProxyV1 failed: header exceeds %d bytes", proxyV1MaxLength)
+		}
+		if _, err := io.ReadFull(r, one); err != nil {
+			return ProxyHeader{}, fmt.Errorf("function readProxyV1 failed: read header failed.\n%v", err)
+		}
+		line = append(line, one[0])
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	header := ProxyHeader{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		header.Local = true
+		return header, nil
+	}
+	if len(fields) != 6 {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV1 failed: malformed header %q", line)
+	}
+
+	if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV1 failed: unsupported protocol %q", fields[1])
+	}
+	srcIP := net.ParseIP(fields[2])
+	dstIP := net.ParseIP(fields[3])
+	srcPort, sErr := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, dErr := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || sErr != nil || dErr != nil {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV1 failed: malformed address in header %q", line)
+	}
+	// 地址族须与协议一致
+	isV4 := fields[1] == "TCP4"
+	if (srcIP.To4() != nil) != isV4 || (dstIP.To4() != nil) != isV4 {
+		return ProxyHeader{}, fmt.Errorf("function readProxyV1 failed: address family mismatch in header %q", line)
+	}
+	header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	header.DestinationAddr = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+	return header, nil
+}
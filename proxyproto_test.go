@@ -0,0 +1,133 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// proxyproto_test.go 文件用于对 PROXY 协议头部的解析进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2Header 构造 PROXY 协议 v2 头部
+func proxyV2Header(verCmd, famProto byte, addrs []byte) []byte {
+	hdr := append([]byte{}, proxyV2Signature...)
+	hdr = append(hdr, verCmd, famProto)
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(addrs)))
+	return append(hdr, addrs...)
+}
+
+// proxyV2Addrs 构造 PROXY 协议 v2 的地址块
+func proxyV2Addrs(src, dst net.IP, srcPort, dstPort uint16, tlvs ...byte) []byte {
+	addrs := append(append([]byte{}, src...), dst...)
+	addrs = binary.BigEndian.AppendUint16(addrs, srcPort)
+	addrs = binary.BigEndian.AppendUint16(addrs, dstPort)
+	return append(addrs, tlvs...)
+}
+
+// 测试 ReadProxyHeader 函数
+func TestReadProxyHeader(t *testing.T) {
+	v4Addrs := proxyV2Addrs(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(198, 51, 100, 1).To4(), 56324, 53)
+	v6Addrs := proxyV2Addrs(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::53"), 40000, 853)
+
+	tests := []struct {
+		name     string
+		header   []byte
+		expected ProxyHeader
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 53\r\n"), ProxyHeader{
+			Version:         1,
+			SourceAddr:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+			DestinationAddr: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 53},
+		}},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::53 40000 853\r\n"), ProxyHeader{
+			Version:         1,
+			SourceAddr:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000},
+			DestinationAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::53"), Port: 853},
+		}},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), ProxyHeader{Version: 1, Local: true}},
+		{"v1 UNKNOWN with addresses", []byte("PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n"), ProxyHeader{Version: 1, Local: true}},
+		{"v2 PROXY TCP4", proxyV2Header(0x21, 0x11, v4Addrs), ProxyHeader{
+			Version:         2,
+			SourceAddr:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+			DestinationAddr: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 53},
+		}},
+		{"v2 PROXY UDP6", proxyV2Header(0x21, 0x22, v6Addrs), ProxyHeader{
+			Version:         2,
+			SourceAddr:      &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000},
+			DestinationAddr: &net.UDPAddr{IP: net.ParseIP("2001:db8::53"), Port: 853},
+		}},
+		{"v2 PROXY with TLVs", proxyV2Header(0x21, 0x11, append(v4Addrs, 0x04, 0x00, 0x01, 0x00)), ProxyHeader{
+			Version:         2,
+			SourceAddr:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+			DestinationAddr: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 53},
+		}},
+		{"v2 LOCAL", proxyV2Header(0x20, 0x00, nil), ProxyHeader{Version: 2, Local: true}},
+		{"v2 LOCAL with addresses", proxyV2Header(0x20, 0x11, v4Addrs), ProxyHeader{Version: 2, Local: true}},
+		{"v2 PROXY AF_UNSPEC", proxyV2Header(0x21, 0x00, nil), ProxyHeader{Version: 2, Local: true}},
+	}
+	for _, tt := range tests {
+		// 头部之后的数据须保留在流中
+		r := bytes.NewReader(append(append([]byte{}, tt.header...), "payload"...))
+		header, err := ReadProxyHeader(r)
+		if err != nil {
+			t.Errorf("function ReadProxyHeader() failed: %s:\n%v", tt.name, err)
+			continue
+		}
+		if header.Version != tt.expected.Version || header.Local != tt.expected.Local ||
+			addrString(header.SourceAddr) != addrString(tt.expected.SourceAddr) ||
+			addrString(header.DestinationAddr) != addrString(tt.expected.DestinationAddr) {
+			t.Errorf("function ReadProxyHeader() failed: %s:\ngot:\n%+v\nexpected:\n%+v", tt.name, header, tt.expected)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != "payload" {
+			t.Errorf("function ReadProxyHeader() failed: %s: consumed data after the header, %q left", tt.name, rest)
+		}
+	}
+}
+
+// addrString 返回地址的类型及文本形式，nil 时返回空字符串
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.Network() + " " + addr.String()
+}
+
+// 测试 ReadProxyHeader 函数对非法头部的处理
+func TestReadProxyHeaderInvalid(t *testing.T) {
+	v4Addrs := proxyV2Addrs(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(198, 51, 100, 1).To4(), 56324, 53)
+	v4Header := proxyV2Header(0x21, 0x11, v4Addrs)
+
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"empty", nil},
+		{"short prefix", []byte("PROXY ")},
+		{"bad signature", []byte("GET / HTTP/1.1\r\n\r\n")},
+		{"bad v2 signature", append([]byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0B}, v4Header[12:]...)},
+		{"v1 without CRLF", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 53")},
+		{"v1 oversized line", []byte("PROXY TCP4 " + strings.Repeat("1", proxyV1MaxLength) + "\r\n")},
+		{"v1 missing fields", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n")},
+		{"v1 bad address", []byte("PROXY TCP4 192.0.2 198.51.100.1 56324 53\r\n")},
+		{"v1 bad port", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 port\r\n")},
+		{"v1 port out of range", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 65536 53\r\n")},
+		{"v1 bad protocol", []byte("PROXY UDP4 192.0.2.1 198.51.100.1 56324 53\r\n")},
+		{"v1 family mismatch", []byte("PROXY TCP4 2001:db8::1 198.51.100.1 56324 53\r\n")},
+		{"v2 truncated header", v4Header[:14]},
+		{"v2 truncated addresses", v4Header[:len(v4Header)-1]},
+		{"v2 short address block", proxyV2Header(0x21, 0x11, v4Addrs[:8])},
+		{"v2 short IPv6 address block", proxyV2Header(0x21, 0x21, v4Addrs)},
+		{"v2 bad version", proxyV2Header(0x11, 0x11, v4Addrs)},
+		{"v2 bad command", proxyV2Header(0x22, 0x11, v4Addrs)},
+	}
+	for _, tt := range tests {
+		if header, err := ReadProxyHeader(bytes.NewReader(tt.header)); err == nil {
+			t.Errorf("function ReadProxyHeader() failed: %s: expected an error but got %+v", tt.name, header)
+		}
+	}
+}
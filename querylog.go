@@ -0,0 +1,243 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// querylog.go 文件定义了与 BIND querylog 行格式一致的查询日志格式化器，
+// 使得运维人员现有的 BIND 日志分析工具可以直接处理 xdns 的查询日志。
+// 其行格式为：
+//
+//	15-Oct-2024 10:11:12.123 queries: info: client @0x7f0012345678 192.0.2.1#53012 (example.com): query: example.com IN A +E(0)DK (192.0.2.53)
+//
+// 其中时间戳、类别及严重级别前缀分别对应 BIND 的 print-time、print-category 及 print-severity 选项。
+
+package xdns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// BINDTimeLayout BIND 日志时间戳格式
+const BINDTimeLayout = "02-Jan-2006 15:04:05.000"
+
+// QueryLogEntry 记录一条查询日志的内容
+type QueryLogEntry struct {
+	// 收到查询的时间
+	Time time.Time
+	// 客户端地址及端口
+	Client     net.IP
+	ClientPort int
+	// 服务器地址
+	Server net.IP
+	// 查询名称、类别及类型
+	QName  string
+	QClass dns.DNSClass
+	QType  dns.DNSType
+	// 查询是否设置了 RD 标志
+	RD bool
+	// 查询是否携带 TSIG 或 SIG(0) 签名
+	Signed bool
+	// 查询是否携带 OPT 记录，及其 EDNS 版本
+	EDNS        bool
+	EDNSVersion uint8
+	// 查询是否经由 TCP 到达
+	TCP bool
+	// 查询是否设置了 DO 标志
+	DO bool
+	// 查询是否设置了 CD 标志
+	CD bool
+	// 查询是否携带 COOKIE 选项
+	Cookie bool
+}
+
+// NewQueryLogEntry 根据链接信息及查询创建一条查询日志
+// 其接受参数为：
+//   - connInfo ConnectionInfo，链接信息
+//   - qry dns.DNSMessage，解析后的查询，其问题部分不应为空
+//
+// 返回值为：
+//   - QueryLogEntry，查询日志
+func NewQueryLogEntry(connInfo ConnectionInfo, qry dns.DNSMessage) QueryLogEntry {
+	entry := QueryLogEntry{
+		Time:       connInfo.ReceiveTime,
+		Client:     connInfo.ClientIP(),
+		ClientPort: portOf(connInfo.Address),
+		Server:     ipOf(localAddrOf(connInfo)),
+		RD:         qry.Header.RD,
+		TCP:        connInfo.Protocol == ProtocolTCP,
+		// Z 字段的最低位为 CD 标志
+		CD: qry.Header.Z&0x01 != 0,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if len(qry.Question) > 0 {
+		entry.QName = qry.Question[0].Name.DomainName
+		entry.QClass = qry.Question[0].Class
+		entry.QType = qry.Question[0].Type
+	}
+	for _, rr := range qry.Additional {
+		switch rr.Type {
+		case dns.DNSRRTypeTSIG, dns.DNSRRTypeSIG:
+			entry.Signed = true
+		}
+	}
+	if opt, ok := qry.OPT(); ok {
+		entry.EDNS = true
+		entry.EDNSVersion = opt.Version
+		entry.DO = opt.DO
+		if opt.RData != nil {
+			entry.Cookie = hasEDNSOption(opt.RData.Encode(), dns.EDNSOptionCodeCookie)
+		}
+	}
+	return entry
+}
+
+// hasEDNSOption 判断 OPT 记录 RDATA 中是否存在指定的选项
+func hasEDNSOption(rdata []byte, code uint16) bool {
+	for len(rdata) >= 4 {
+		if binary.BigEndian.Uint16(rdata) == code {
+			return true
+		}
+		optLen := int(binary.BigEndian.Uint16(rdata[2:]))
+		if len(rdata) < 4+optLen {
+			return false
+		}
+		rdata = rdata[4+optLen:]
+	}
+	return false
+}
+
+// Flags 返回 BIND 格式的查询标志，依次为：
+// "+"（RD）或 "-"，"S"（签名），"E(版本)"（EDNS），"T"（TCP），"D"（DO），"C"（CD），"K"（COOKIE）
+func (e QueryLogEntry) Flags() string {
+	flags := strings.Builder{}
+	if e.RD {
+		flags.WriteByte('+')
+	} else {
+		flags.WriteByte('-')
+	}
+	if e.Signed {
+		flags.WriteByte('S')
+	}
+	if e.EDNS {
+		fmt.Fprintf(&flags, "E(%d)", e.EDNSVersion)
+	}
+	if e.TCP {
+		flags.WriteByte('T')
+	}
+	if e.DO {
+		flags.WriteByte('D')
+	}
+	if e.CD {
+		flags.WriteByte('C')
+	}
+	if e.Cookie {
+		flags.WriteByte('K')
+	}
+	return flags.String()
+}
+
+// clientPointer 返回 BIND 日志中的客户端对象地址。
+// xdns 没有对应的对象，因此根据客户端地址及端口生成一个稳定的伪地址。
+func (e QueryLogEntry) clientPointer() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s#%d", e.Client, e.ClientPort)
+	return fmt.Sprintf("@0x%012x", 0x7f0000000000|h.Sum64()&0xffffffffff)
+}
+
+// bindClassString 返回 BIND 格式的类别助记符，未知类别表示为 CLASSn
+func bindClassString(class dns.DNSClass) string {
+	s := class.String()
+	if strings.HasPrefix(s, "Unknown") {
+		return fmt.Sprintf("CLASS%d", class)
+	}
+	return s
+}
+
+// bindTypeString 返回 BIND 格式的类型助记符，未知类型表示为 TYPEn
+func bindTypeString(rrType dns.DNSType) string {
+	s := rrType.String()
+	if strings.HasPrefix(s, "Unknown") {
+		return fmt.Sprintf("TYPE%d", rrType)
+	}
+	return s
+}
+
+// QueryLogConfig 记录查询日志格式的配置，与 BIND logging channel 的同名选项对应
+type QueryLogConfig struct {
+	// 是否输出时间戳
+	PrintTime bool
+	// 是否输出类别 "queries: "
+	PrintCategory bool
+	// 是否输出严重级别 "info: "
+	PrintSeverity bool
+}
+
+// FormatBINDQueryLog 将查询日志格式化为 BIND querylog 格式的一行，不含换行符
+// 其接受参数为：
+//   - entry QueryLogEntry，查询日志
+//   - conf QueryLogConfig，格式配置
+//
+// 返回值为：
+//   - string，格式化后的日志行
+func FormatBINDQueryLog(entry QueryLogEntry, conf QueryLogConfig) string {
+	line := strings.Builder{}
+	if conf.PrintTime {
+		line.WriteString(entry.Time.Format(BINDTimeLayout))
+		line.WriteByte(' ')
+	}
+	if conf.PrintCategory {
+		line.WriteString("queries: ")
+	}
+	if conf.PrintSeverity {
+		line.WriteString("info: ")
+	}
+
+	qName := entry.QName
+	if qName == "" {
+		qName = "."
+	}
+	fmt.Fprintf(&line, "client %s %s#%d (%s): query: %s %s %s %s",
+		entry.clientPointer(), entry.Client, entry.ClientPort, qName,
+		qName, bindClassString(entry.QClass), bindTypeString(entry.QType), entry.Flags())
+	if entry.Server != nil {
+		fmt.Fprintf(&line, " (%s)", entry.Server)
+	}
+	return line.String()
+}
+
+// QueryLogResponser 查询日志回复器：包装一个回复器，并以 BIND querylog 格式记录经过的每个查询。
+type QueryLogResponser struct {
+	Responser Responser
+	// 日志输出
+	Writer io.Writer
+	// 日志格式配置
+	Config QueryLogConfig
+
+	mu sync.Mutex
+}
+
+// Response 记录查询日志，并返回被包装回复器的回复。
+func (r *QueryLogResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (r *QueryLogResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err == nil {
+		line := FormatBINDQueryLog(NewQueryLogEntry(connInfo, qry), r.Config)
+		r.mu.Lock()
+		fmt.Fprintln(r.Writer, line)
+		r.mu.Unlock()
+	}
+	return Respond(ctx, r.Responser, connInfo)
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// referral.go 文件定义了 ReferralBuilder 转介回复构建器。
+// 其会为被委派的子区域构建转介（Referral）回复，
+// 并可以按委派刻意加入区外（Out-of-Bailiwick）粘合记录或任意附加记录，
+// 这些记录可以带有或不带有 RRSIG，用于研究解析器的 Bailiwick 过滤逻辑。
+
+package xdns
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// InjectedRecord 表示一条注入至转介回复附加部分的记录
+type InjectedRecord struct {
+	RR dns.DNSResourceRecord
+	// 是否使用父区域的 ZSK 为其生成 RRSIG，仅在启用 DNSSEC 时生效
+	Signed bool
+}
+
+// Delegation 表示一个子区域委派
+type Delegation struct {
+	// 子区域名称
+	Child string
+	// 子区域的权威服务器名称
+	NameServers []string
+	// 权威服务器名称与其地址的映射，用于生成粘合记录
+	Glue map[string][]net.IP
+	// 是否加入区外粘合记录。
+	// 默认只为位于子区域之内的权威服务器名称生成粘合记录，
+	// 为 true 时也会为子区域之外的权威服务器名称生成粘合记录。
+	OutOfBailiwickGlue bool
+	// 注入至附加部分的额外记录
+	Inject []InjectedRecord
+}
+
+// ReferralBuilderConfig 记录转介回复构建器的配置
+type ReferralBuilderConfig struct {
+	// 父区域名称
+	Zone string
+	// 子区域委派
+	Delegations []Delegation
+	// 记录的 TTL
+	TTL uint32
+	// DNSSEC 配置，为 nil 时不进行签名
+	DNSSEC *DNSSECConfig
+}
+
+// ReferralBuilder 转介回复构建器：为子区域委派构建转介回复。
+type ReferralBuilder struct {
+	Config ReferralBuilderConfig
+
+	// 子区域名称与其委派的映射
+	delegations map[string]*Delegation
+	// 区域名与其相应 DNSSEC 材料的映射
+	materialMap sync.Map
+}
+
+// NewReferralBuilder 根据配置创建一个新的转介回复构建器
+func NewReferralBuilder(conf ReferralBuilderConfig) *ReferralBuilder {
+	conf.Zone = dns.CanonicalizeDomainName(&conf.Zone)
+	builder := &ReferralBuilder{
+		Config:      conf,
+		delegations: make(map[string]*Delegation),
+	}
+	for i := range conf.Delegations {
+		d := &conf.Delegations[i]
+		d.Child = dns.CanonicalizeDomainName(&d.Child)
+		builder.delegations[d.Child] = d
+	}
+	return builder
+}
+
+// Find 查找被查询名称所属的委派，未找到时返回 nil
+// 若存在嵌套委派，返回最接近被查询名称的委派。
+func (b *ReferralBuilder) Find(qName string) *Delegation {
+	name := strings.ToLower(qName)
+	for {
+		if d, ok := b.delegations[name]; ok {
+			return d
+		}
+		if name == b.Config.Zone {
+			return nil
+		}
+		upper := dns.GetUpperDomainName(&name)
+		if upper == name {
+			return nil
+		}
+		name = upper
+	}
+}
+
+// inBailiwick 检查名称是否位于指定区域之内
+func inBailiwick(name, zone string) bool {
+	return dns.IsSubDomain(name, zone)
+}
+
+// Build 为查询构建指定委派的转介回复
+// 其接受参数为：
+//   - qry dns.DNSMessage，查询信息
+//   - d *Delegation，委派
+//
+// 返回值为：
+//   - dns.DNSMessage，转介回复，其权威部分包含 NS 记录，附加部分包含粘合记录及注入的记录
+func (b *ReferralBuilder) Build(qry dns.DNSMessage, d *Delegation) dns.DNSMessage {
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	// 转介回复不是权威回复
+	resp.Header.AA = false
+
+	for _, ns := range d.NameServers {
+		resp.Authority = append(resp.Authority, b.newRR(d.Child, &dns.DNSRDATANS{NSDNAME: ns}))
+	}
+
+	for _, ns := range d.NameServers {
+		if !d.OutOfBailiwickGlue && !inBailiwick(ns, d.Child) {
+			continue
+		}
+		for _, addr := range d.Glue[ns] {
+			if addr.To4() != nil {
+				resp.Additional = append(resp.Additional, b.newRR(ns, &dns.DNSRDATAA{Address: addr}))
+			} else {
+				resp.Additional = append(resp.Additional, b.newRR(ns, &dns.DNSRDATAAAAA{Address: addr}))
+			}
+		}
+	}
+
+	signed := dns.DNSResponseSection{}
+	for _, inject := range d.Inject {
+		if inject.Signed && b.Config.DNSSEC != nil {
+			signed = append(signed, inject.RR)
+		} else {
+			resp.Additional = append(resp.Additional, inject.RR)
+		}
+	}
+
+	if b.Config.DNSSEC != nil {
+		cMats := []CryptoMaterial{}
+		for _, dMat := range GetSignerMaterials(b.Config.Zone, &b.materialMap, *b.Config.DNSSEC) {
+			cMats = append(cMats, ZSKCryptoMaterial(b.Config.Zone, dMat, *b.Config.DNSSEC))
+		}
+		resp.Additional = append(resp.Additional, SignSectionMulti(signed, cMats)...)
+	}
+
+	FixCount(&resp)
+	return resp
+}
+
+// newRR 生成转介回复中的资源记录
+func (b *ReferralBuilder) newRR(owner string, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(owner),
+		Type:  rdata.Type(),
+		Class: dns.DNSClassIN,
+		TTL:   b.Config.TTL,
+		RDLen: 0,
+		RData: rdata,
+	}
+}
+
+// ReferralResponser 是一个使用 ReferralBuilder 回复转介的回复器实现。
+// 不属于任何委派的名称将得到 NXDOMAIN 回复。
+type ReferralResponser struct {
+	Builder *ReferralBuilder
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *ReferralResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	d := r.Builder.Find(qry.Question[0].Name.DomainName)
+	if d == nil {
+		resp := InitNXDOMAIN(qry)
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+	resp := r.Builder.Build(qry, d)
+	return resp.Encode(), nil
+}
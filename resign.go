@@ -0,0 +1,280 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// resign.go 文件定义了签名缓存 SignatureCache 及自动重新签名调度器 Resigner。
+// 为 DNSSECConfig.Signatures 设置签名缓存后，相同 RRset 的签名将被缓存复用，
+// 而不是在每次回复时重新计算，这与真实的权威服务器一致。
+// 缓存的签名终将过期，尤其是 ValidityAbsolute 模式下的固定有效期，
+// Resigner 会在后台周期性地检查缓存，在签名临近过期时为其重新签名，
+// 使长时间运行的实验服务器不会在有效期结束后回复过期的 RRSIG。
+//
+// 仅 ValidityAbsolute 与 ValidityRelative 模式下的签名会被缓存，
+// 刻意生成的过期、尚未生效或起止颠倒的签名不受影响。
+
+package xdns
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// maxCachedSignatures 是签名缓存的条目数量上限，超出时清空，以免内存无限增长
+const maxCachedSignatures = 65536
+
+// signedRRSet 表示签名缓存中的一个条目
+type signedRRSet struct {
+	rrset  []dns.DNSResourceRecord
+	crypto CryptoMaterial
+	sig    dns.DNSResourceRecord
+	// 签名时间
+	signedAt time.Time
+	// 最近一次被使用的时间
+	lastUsed time.Time
+	// 刷新时间的随机提前量，为负时尚未确定
+	jitter time.Duration
+}
+
+// expiration 返回缓存签名的过期时间
+func (e *signedRRSet) expiration() time.Time {
+	return time.Unix(int64(e.sig.RData.(*dns.DNSRDATARRSIG).Expiration), 0)
+}
+
+// SignatureCache 签名缓存：按 RRset 内容及签名密钥缓存 RRSIG 记录，可并发使用
+type SignatureCache struct {
+	mu      sync.Mutex
+	entries map[string]*signedRRSet
+}
+
+// NewSignatureCache 创建一个新的签名缓存
+func NewSignatureCache() *SignatureCache {
+	return &SignatureCache{
+		entries: make(map[string]*signedRRSet),
+	}
+}
+
+// Sign 返回 RRset 的缓存签名，缓存中不存在或签名已过期时重新签名并缓存
+// 其接受参数为：
+//   - rrset []dns.DNSResourceRecord，已按规范化排序的 RR 集合
+//   - crypto CryptoMaterial，签名材料，仅在重新签名时使用其中的有效期
+//
+// 返回值为：
+//   - dns.DNSResourceRecord，RRSIG 记录
+func (c *SignatureCache) Sign(rrset []dns.DNSResourceRecord, crypto CryptoMaterial) dns.DNSResourceRecord {
+	crypto.Cache = nil
+	key := signatureKey(rrset, crypto)
+	now := time.Now()
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expiration()) {
+		e.lastUsed = now
+		c.mu.Unlock()
+		return e.sig
+	}
+	c.mu.Unlock()
+
+	sig := SignSet(rrset, crypto)
+	// 重新签名不属于任何查询，不计入其开销
+	crypto.Meter = nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedSignatures {
+		c.entries = make(map[string]*signedRRSet)
+	}
+	c.entries[key] = &signedRRSet{
+		rrset:    append([]dns.DNSResourceRecord{}, rrset...),
+		crypto:   crypto,
+		sig:      sig,
+		signedAt: now,
+		lastUsed: now,
+		jitter:   -1,
+	}
+	return sig
+}
+
+// Len 返回缓存的签名数量
+func (c *SignatureCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// EarliestExpiration 返回缓存的签名中最早的过期时间，缓存为空时第二个返回值为 false
+func (c *SignatureCache) EarliestExpiration() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var earliest time.Time
+	for _, e := range c.entries {
+		if exp := e.expiration(); earliest.IsZero() || exp.Before(earliest) {
+			earliest = exp
+		}
+	}
+	return earliest.UTC(), !earliest.IsZero()
+}
+
+// signatureKey 根据签名者、算法、密钥标签及 RRset 的线格式生成缓存键
+func signatureKey(rrset []dns.DNSResourceRecord, crypto CryptoMaterial) string {
+	hash := sha256.New()
+	for _, rr := range rrset {
+		hash.Write(rr.Encode())
+	}
+	return fmt.Sprintf("%s|%d|%d|%s", crypto.SignerName, crypto.Algorithm, crypto.KeyTag, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// cacheable 判断当前有效期模式下生成的签名是否可以被缓存，设置抖动时不缓存
+func (v SignatureValidity) cacheable() bool {
+	return (v.Mode == ValidityAbsolute || v.Mode == ValidityRelative) && v.Jitter <= 0
+}
+
+// ResignerConfig 记录重新签名调度器的配置
+type ResignerConfig struct {
+	// 签名缓存
+	Cache *SignatureCache
+	// 刷新窗口：签名距过期不足该时长时重新签名，0 表示 6 小时
+	RefreshWindow time.Duration
+	// 抖动：每个签名的刷新时间再随机提前 [0, Jitter)，以免大量签名在同一时刻刷新
+	Jitter time.Duration
+	// 检查间隔，0 表示 1 分钟
+	Interval time.Duration
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// Resigner 重新签名调度器：周期性地为签名缓存中临近过期的签名重新签名。
+// 自上次签名以来未被使用过的签名不会被刷新，而是被移出缓存。
+type Resigner struct {
+	Config       ResignerConfig
+	ResignLogger *log.Logger
+
+	refreshed atomic.Uint64
+	evicted   atomic.Uint64
+	stop      chan struct{}
+}
+
+// NewResigner 根据配置创建一个新的重新签名调度器
+func NewResigner(conf ResignerConfig) *Resigner {
+	resignLogger := log.New(conf.LogWriter, "Resigner: ", log.LstdFlags)
+	if conf.RefreshWindow <= 0 {
+		conf.RefreshWindow = 6 * time.Hour
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = time.Minute
+	}
+	return &Resigner{
+		Config:       conf,
+		ResignLogger: resignLogger,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start 启动重新签名协程
+func (r *Resigner) Start() {
+	go func() {
+		ticker := time.NewTicker(r.Config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if n := r.Refresh(now); n > 0 {
+					r.ResignLogger.Printf("Refreshed %d signatures", n)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止重新签名协程
+func (r *Resigner) Stop() {
+	close(r.stop)
+}
+
+// Refresh 立即检查一次签名缓存，为临近过期的签名重新签名。
+// 新签名保持原签名的有效期长度及生效时间相对签名时间的偏移。
+// 其接受参数为：
+//   - now time.Time，检查时间
+//
+// 返回值为：
+//   - int，重新签名的数量
+func (r *Resigner) Refresh(now time.Time) int {
+	cache := r.Config.Cache
+	due := map[string]*signedRRSet{}
+
+	cache.mu.Lock()
+	for key, e := range cache.entries {
+		if e.jitter < 0 {
+			e.jitter = 0
+			if r.Config.Jitter > 0 {
+				e.jitter = time.Duration(xperi.RandomInt63n(int64(r.Config.Jitter)))
+			}
+		}
+		if now.Add(r.Config.RefreshWindow + e.jitter).Before(e.expiration()) {
+			continue
+		}
+		if !e.lastUsed.After(e.signedAt) {
+			delete(cache.entries, key)
+			r.evicted.Add(1)
+			continue
+		}
+		due[key] = e
+	}
+	cache.mu.Unlock()
+
+	// 在锁外签名，以免阻塞回复
+	keys := make([]string, 0, len(due))
+	for key := range due {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	refreshed := 0
+	for _, key := range keys {
+		e := due[key]
+		rrsig := e.sig.RData.(*dns.DNSRDATARRSIG)
+		period := int64(rrsig.Expiration) - int64(rrsig.Inception)
+		if period <= 0 {
+			continue
+		}
+		crypto := e.crypto
+		inception := now.Unix() + int64(rrsig.Inception) - e.signedAt.Unix()
+		crypto.Inception = uint32(inception)
+		crypto.Expiration = uint32(inception + period)
+		sig := SignSet(append([]dns.DNSResourceRecord{}, e.rrset...), crypto)
+
+		cache.mu.Lock()
+		if cache.entries[key] == e {
+			cache.entries[key] = &signedRRSet{
+				rrset:    e.rrset,
+				crypto:   crypto,
+				sig:      sig,
+				signedAt: now,
+				lastUsed: e.lastUsed,
+				jitter:   -1,
+			}
+			refreshed++
+		}
+		cache.mu.Unlock()
+	}
+
+	r.refreshed.Add(uint64(refreshed))
+	serverVars.Add("signatures_refreshed", int64(refreshed))
+	return refreshed
+}
+
+// Refreshed 返回自启动以来重新签名的总数
+func (r *Resigner) Refreshed() uint64 {
+	return r.refreshed.Load()
+}
+
+// Evicted 返回自启动以来因未被使用而移出缓存的签名总数
+func (r *Resigner) Evicted() uint64 {
+	return r.evicted.Load()
+}
@@ -6,10 +6,12 @@
 package xdns
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tochusc/xdns/dns"
 	"github.com/tochusc/xdns/dns/xperi"
@@ -233,10 +235,39 @@ type DNSSECConfig struct {
 	// DNSSEC 摘要算法
 	Type dns.DNSSECDigestType
 
+	// 多签名者（RFC 8901）：除 Algo 外，额外使用的签名算法。
+	// 每个算法对应一组独立的 KSK/ZSK，区域内的 RRset 将同时被所有密钥组签名，
+	// DNSKEY RRset 包含全部密钥组的公钥，DS 则为每个 KSK 分别生成。
+	// 可以包含 xperi 不支持的未知或保留算法编号，此时将使用随机公钥及随机签名，
+	// 用于在同一信任链中混合受支持与不受支持的算法，探测解析器的算法降级逻辑。
+	MultiSignerAlgos []dns.DNSSECAlgorithm
+	// 仅为使用这些算法的签名者生成 DS 记录，为空时为全部签名者生成。
+	// 例如只为不受支持的算法生成 DS，可测试解析器是否将区域视为不安全。
+	DSAlgos []dns.DNSSECAlgorithm
+
 	// 签名过期时间
 	Expiration uint32
 	// 签名生效时间
 	Inception uint32
+	// 签名有效期的生成方式，默认使用上述 Expiration 与 Inception
+	Validity SignatureValidity
+	// 生成 DNSKEY 时使用的密钥参数（RSA 模数长度、公钥指数及公钥填充），零值表示默认参数
+	KeyParams xperi.KeyParams
+	// 签名缓存，非 nil 时复用相同 RRset 的签名，可配合 Resigner 在签名临近过期时重新签名
+	Signatures *SignatureCache
+	// RRSIG Labels 字段的篡改方式，零值表示不篡改
+	Labels RRSIGLabels
+
+	// 区域切割数据库，非 nil 时显式区分父区域与子区域：回复由包含查询名称的最近区域签名，
+	// DNSKEY 仅在区域顶点由子区域回复，DS 仅在区域切割处由父区域回复并签名（RFC 4035 3.1.4.1 节）；
+	// 为 nil 时视每个被查询的名称为区域顶点，其回复及 DS 均由父域签名
+	ZoneCuts *ZoneCuts
+	// 故意违反父区域与子区域的划分：在区域顶点由子区域回复 DS，并以子区域自身签名，
+	// 用于错误配置实验，仅在设置 ZoneCuts 时生效
+	ChildSideDS bool
+
+	// 开销计量，非 nil 时计入签名及 DS 摘要的次数，通常由 WithMeter 为单个查询设置，详见 cost.go
+	Meter *CostMeter
 }
 
 // DNSSECMaterial 表示签名一个区域所需的 DNSSEC 材料
@@ -268,6 +299,12 @@ type CryptoMaterial struct {
 	SignerName string
 	// 私钥字节
 	PrivateKey []byte
+	// 签名缓存，非 nil 时 SignSet 优先使用缓存中的签名
+	Cache *SignatureCache
+	// RRSIG Labels 字段的篡改方式
+	Labels RRSIGLabels
+	// 开销计量，非 nil 时计入实际生成的签名，命中签名缓存时不计入
+	Meter *CostMeter
 }
 
 // EnableDNSSEC 检查 DNS 回复信息，并对其进行 DNSSEC 签名，
@@ -281,52 +318,191 @@ type CryptoMaterial struct {
 // 否则会导致签名失败。
 func EnableDNSSEC(qry dns.DNSMessage, resp *dns.DNSMessage, dConf DNSSECConfig, dMap *sync.Map) {
 	qName := strings.ToLower(qry.Question[0].Name.DomainName)
-	upperName := dns.GetUpperDomainName(&qName)
-	// 获取 DNSSEC 材料
-	dMat := GetDNSSECMaterial(upperName, dMap, dConf)
-	// 获取 ZSK 的相关信息
-	zTag := dMat.ZSKTag
-	zPriv := dMat.ZSKPriv
-	zAlgo := dMat.ZSKRecord.RData.(*dns.DNSRDATADNSKEY).Algorithm
-
-	cMat := CryptoMaterial{
-		Algorithm:  zAlgo,
-		Expiration: dConf.Expiration,
-		Inception:  dConf.Inception,
-		KeyTag:     uint16(zTag),
-		SignerName: upperName,
-		PrivateKey: zPriv,
+	upperName := signerZone(qName, dConf)
+
+	// 获取全部签名者的 ZSK 签名材料
+	cMats := []CryptoMaterial{}
+	for _, dMat := range GetSignerMaterials(upperName, dMap, dConf) {
+		cMats = append(cMats, ZSKCryptoMaterial(upperName, dMat, dConf))
 	}
 
 	// 签名回答部分
-	resp.Answer = SignSection(resp.Answer, cMat)
+	resp.Answer = SignSectionMulti(resp.Answer, cMats)
 	// 签名权威部分
-	resp.Authority = SignSection(resp.Authority, cMat)
+	resp.Authority = SignSectionMulti(resp.Authority, cMats)
 	// 签名附加部分
-	resp.Additional = SignSection(resp.Additional, cMat)
+	resp.Additional = SignSectionMulti(resp.Additional, cMats)
 
 	// 建立信任链
 	EstablishCoT(qry, resp, dConf, dMap)
 }
 
+// EnableDNSSECContext 与 EnableDNSSEC 相同，供支持上下文的回复器使用：
+// 签名在 "sign" span 中进行，签名及 DS 摘要计入上下文中的开销计量。
+// span 记录签名算法及回复中 RRSIG 记录的数量。
+func EnableDNSSECContext(ctx context.Context, qry dns.DNSMessage, resp *dns.DNSMessage, dConf DNSSECConfig, dMap *sync.Map) {
+	_, span := StartSpan(ctx, "sign", SpanKindInternal)
+	defer span.Finish()
+	EnableDNSSEC(qry, resp, dConf.WithMeter(ctx), dMap)
+	if span != nil {
+		span.SetAttribute("dns.dnssec.algorithm", int(dConf.Algo))
+		span.SetAttribute("dns.dnssec.rrsigs", countRRSIGs(resp))
+	}
+}
+
+// countRRSIGs 返回消息中 RRSIG 记录的数量
+func countRRSIGs(msg *dns.DNSMessage) int {
+	count := 0
+	for _, section := range []dns.DNSResponseSection{msg.Answer, msg.Authority, msg.Additional} {
+		for _, rr := range section {
+			if rr.Type == dns.DNSRRTypeRRSIG {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// signerZone 返回签名查询名称的回复所使用的区域：
+// 设置区域切割数据库时为包含查询名称的最近区域，否则为查询名称的父域
+func signerZone(qName string, dConf DNSSECConfig) string {
+	if dConf.ZoneCuts != nil {
+		if zone, ok := dConf.ZoneCuts.Zone(qName); ok {
+			return zone
+		}
+	}
+	return dns.GetUpperDomainName(&qName)
+}
+
+// dsSigner 返回名称的 DS RRset 的签名区域，以及是否应回复 DS。
+// 未设置区域切割数据库时，DS 由名称的父域签名；
+// 设置后仅在区域切割处回复 DS 并由父区域签名，非区域顶点或父区域未知时不回复，
+// 启用 ChildSideDS 时则由子区域自身签名。
+func dsSigner(qName string, dConf DNSSECConfig) (string, bool) {
+	if dConf.ZoneCuts == nil {
+		return dns.GetUpperDomainName(&qName), true
+	}
+	if !dConf.ZoneCuts.IsApex(qName) {
+		return "", false
+	}
+	if dConf.ChildSideDS {
+		return dConf.ZoneCuts.Zone(qName)
+	}
+	parent, ok := dConf.ZoneCuts.Signer(qName, dns.DNSRRTypeDS)
+	if !ok || dns.EqualDomainName(parent, qName) {
+		return "", false
+	}
+	return parent, true
+}
+
+// ZSKCryptoMaterial 根据区域的 DNSSEC 材料生成使用 ZSK 签名所需的签名材料
+func ZSKCryptoMaterial(zName string, dMat DNSSECMaterial, dConf DNSSECConfig) CryptoMaterial {
+	expiration, inception := dConf.Validity.Window(dConf, time.Now())
+	return CryptoMaterial{
+		Algorithm:  dMat.ZSKRecord.RData.(*dns.DNSRDATADNSKEY).Algorithm,
+		Expiration: expiration,
+		Inception:  inception,
+		KeyTag:     uint16(dMat.ZSKTag),
+		SignerName: zName,
+		PrivateKey: dMat.ZSKPriv,
+		Cache:      signatureCache(dConf),
+		Labels:     dConf.Labels,
+		Meter:      dConf.Meter,
+	}
+}
+
+// KSKCryptoMaterial 根据区域的 DNSSEC 材料生成使用 KSK 签名所需的签名材料
+func KSKCryptoMaterial(zName string, dMat DNSSECMaterial, dConf DNSSECConfig) CryptoMaterial {
+	expiration, inception := dConf.Validity.Window(dConf, time.Now())
+	return CryptoMaterial{
+		Algorithm:  dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY).Algorithm,
+		Expiration: expiration,
+		Inception:  inception,
+		KeyTag:     uint16(dMat.KSKTag),
+		SignerName: zName,
+		PrivateKey: dMat.KSKPriv,
+		Cache:      signatureCache(dConf),
+		Labels:     dConf.Labels,
+		Meter:      dConf.Meter,
+	}
+}
+
+// signatureCache 返回签名时应使用的签名缓存，刻意生成异常有效期或篡改 Labels 字段时不使用缓存
+func signatureCache(dConf DNSSECConfig) *SignatureCache {
+	if !dConf.Validity.cacheable() || dConf.Labels.Offset != 0 {
+		return nil
+	}
+	return dConf.Signatures
+}
+
 // SignSection 为指定的DNS回复消息中的区域(Answer, Authority, Addition)进行签名
 // 其接受参数为：
 //   - section []dns.DNSResourceRecord，待签名的区域(Answer, Authority, Addition)信息
 //
 // 返回值为：
-//   - []dns.DNSResourceRecord，签名后的区域(Answer, Authority, Addition)信息
+//   - []dns.DNSResourceRecord，签名后的区域(Answer, Authority, Addition)信息，
+//     RRSIG 记录按 GroupRRSets 的顺序追加在区域末尾
 func SignSection(section dns.DNSResponseSection, crypto CryptoMaterial) []dns.DNSResourceRecord {
-	rMap := make(map[string][]dns.DNSResourceRecord)
+	for _, rrset := range GroupRRSets(section) {
+		sig := SignSet(rrset, crypto)
+		section = append(section, sig)
+	}
+	return section
+}
+
+// GroupRRSets 将区域中除 RRSIG 外的记录按名称、类型及类别分组为 RRset。
+// RRset 依次按名称的规范顺序（RFC 4034 6.1 节）、类型及类别排序，
+// 而不是按映射的遍历顺序，使相同的区域在多次运行间得到逐字节相同的签名结果。
+// 名称的比较区分大小写，仅大小写不同的名称分属不同的 RRset。
+// 其接受参数为：
+//   - section dns.DNSResponseSection，区域(Answer, Authority, Addition)信息
+//
+// 返回值为：
+//   - [][]dns.DNSResourceRecord，RRset 列表，RRset 内的记录保持其在区域中的顺序
+func GroupRRSets(section dns.DNSResponseSection) [][]dns.DNSResourceRecord {
+	type rrSetKey struct {
+		name  string
+		typ   dns.DNSType
+		class dns.DNSClass
+	}
+	index := map[rrSetKey]int{}
+	rrsets := [][]dns.DNSResourceRecord{}
 	for _, rr := range section {
 		if rr.Type == dns.DNSRRTypeRRSIG {
 			continue
 		}
-		rid := rr.Name.DomainName + rr.Type.String() + rr.Class.String()
-		rMap[rid] = append(rMap[rid], rr)
+		key := rrSetKey{rr.Name.DomainName, rr.Type, rr.Class}
+		i, ok := index[key]
+		if !ok {
+			i = len(rrsets)
+			index[key] = i
+			rrsets = append(rrsets, nil)
+		}
+		rrsets[i] = append(rrsets[i], rr)
 	}
-	for _, rrset := range rMap {
-		sig := SignSet(rrset, crypto)
-		section = append(section, sig)
+	sort.SliceStable(rrsets, func(i, j int) bool {
+		a, b := rrsets[i][0], rrsets[j][0]
+		if c := dns.CompareDomainName(a.Name.DomainName, b.Name.DomainName); c != 0 {
+			return c < 0
+		}
+		if a.Name.DomainName != b.Name.DomainName {
+			return a.Name.DomainName < b.Name.DomainName
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Class < b.Class
+	})
+	return rrsets
+}
+
+// SignSectionMulti 使用多组签名材料为指定区域进行签名，
+// 每个 RRset 都会得到每组签名材料各自的 RRSIG 记录。
+func SignSectionMulti(section dns.DNSResponseSection, cryptos []CryptoMaterial) []dns.DNSResourceRecord {
+	signed := section.RemoveRRSIGs()
+	for _, crypto := range cryptos {
+		sigs := SignSection(signed, crypto)[len(signed):]
+		section = append(section, sigs...)
 	}
 	return section
 }
@@ -337,6 +513,29 @@ func SignSection(section dns.DNSResponseSection, crypto CryptoMaterial) []dns.DN
 func SignSet(rrset []dns.DNSResourceRecord, crypto CryptoMaterial) dns.DNSResourceRecord {
 	sort.Sort(dns.ByCanonicalOrder(rrset))
 
+	if crypto.Labels.applies(rrset[0].Type) {
+		crypto.Meter.AddSignatures(1)
+		return signSetWithLabels(rrset, crypto)
+	}
+
+	if crypto.Cache != nil {
+		return crypto.Cache.Sign(rrset, crypto)
+	}
+	crypto.Meter.AddSignatures(1)
+
+	// 不受支持的算法无法签名，使用随机签名代替
+	if !xperi.IsSupportedAlgorithm(crypto.Algorithm) {
+		return xperi.GenerateUnsupportedRRRRSIG(
+			rrset,
+			crypto.Algorithm,
+			crypto.Expiration,
+			crypto.Inception,
+			crypto.KeyTag,
+			crypto.SignerName,
+			0,
+		)
+	}
+
 	sig := xperi.GenerateRRRRSIG(
 		rrset,
 		crypto.Algorithm,
@@ -349,6 +548,26 @@ func SignSet(rrset []dns.DNSResourceRecord, crypto CryptoMaterial) dns.DNSResour
 	return sig
 }
 
+// GetSignerMaterials 获取指定区域全部签名者的 DNSSEC 材料
+// 第一个元素为使用 dConf.Algo 的主签名者，之后依次为 dConf.MultiSignerAlgos 中的各签名者。
+// 额外签名者的材料以 "<区域名>#<算法>" 为键存储在映射中。
+func GetSignerMaterials(zName string, dMap *sync.Map, dConf DNSSECConfig) []DNSSECMaterial {
+	dMats := []DNSSECMaterial{GetDNSSECMaterial(zName, dMap, dConf)}
+	for _, algo := range dConf.MultiSignerAlgos {
+		sConf := dConf
+		sConf.Algo = algo
+		key := fmt.Sprintf("%s#%d", zName, algo)
+		if dMat, ok := dMap.Load(key); ok {
+			dMats = append(dMats, dMat.(DNSSECMaterial))
+			continue
+		}
+		dMat := CreateDNSSECMaterial(sConf, zName)
+		dMap.Store(key, dMat)
+		dMats = append(dMats, dMat)
+	}
+	return dMats
+}
+
 // CreateDNSSECMaterial 根据 DNSSEC 配置生成指定区域的 DNSSEC 材料
 // 其接受参数为：
 //   - dConf DNSSECConfig，DNSSEC 配置
@@ -358,9 +577,17 @@ func SignSet(rrset []dns.DNSResourceRecord, crypto CryptoMaterial) dns.DNSResour
 //   - DNSSECMaterial，生成的 DNSSEC 材料
 //
 // 该函数会为指定区域生成一个 KSK 和一个 ZSK，并生成一个 DNSKEY 记录和一个 RRSIG 记录。
+// 若签名算法不受支持，则生成随机公钥，其私钥为空。
 func CreateDNSSECMaterial(dConf DNSSECConfig, zName string) DNSSECMaterial {
-	kskRR, kskPriv := xperi.GenerateRRDNSKEY(zName, dConf.Algo, dns.DNSKEYFlagSecureEntryPoint)
-	zskRR, zskPriv := xperi.GenerateRRDNSKEY(zName, dConf.Algo, dns.DNSKEYFlagZoneKey)
+	var kskRR, zskRR dns.DNSResourceRecord
+	var kskPriv, zskPriv []byte
+	if xperi.IsSupportedAlgorithm(dConf.Algo) {
+		kskRR, kskPriv = xperi.GenerateRRDNSKEYWithParams(zName, dConf.Algo, dns.DNSKEYFlagSecureEntryPoint, dConf.KeyParams)
+		zskRR, zskPriv = xperi.GenerateRRDNSKEYWithParams(zName, dConf.Algo, dns.DNSKEYFlagZoneKey, dConf.KeyParams)
+	} else {
+		kskRR = xperi.GenerateUnsupportedRRDNSKEY(zName, dConf.Algo, dns.DNSKEYFlagSecureEntryPoint, 0)
+		zskRR = xperi.GenerateUnsupportedRRDNSKEY(zName, dConf.Algo, dns.DNSKEYFlagZoneKey, 0)
+	}
 	kSKTag := xperi.CalculateKeyTag(*kskRR.RData.(*dns.DNSRDATADNSKEY))
 	zSKTag := xperi.CalculateKeyTag(*zskRR.RData.(*dns.DNSRDATADNSKEY))
 
@@ -376,6 +603,19 @@ func CreateDNSSECMaterial(dConf DNSSECConfig, zName string) DNSSECMaterial {
 	}
 }
 
+// dsAlgoEnabled 检查是否应为使用指定算法的签名者生成 DS 记录
+func dsAlgoEnabled(dConf DNSSECConfig, algo dns.DNSSECAlgorithm) bool {
+	if len(dConf.DSAlgos) == 0 {
+		return true
+	}
+	for _, dsAlgo := range dConf.DSAlgos {
+		if dsAlgo == algo {
+			return true
+		}
+	}
+	return false
+}
+
 // GetDNSSECMaterial 获取指定区域的 DNSSEC 材料
 // 如果该区域的 DNSSEC 材料不存在，则会根据 DNSSEC 配置生成一个
 func GetDNSSECMaterial(zName string, dMap *sync.Map, dConf DNSSECConfig) DNSSECMaterial {
@@ -392,6 +632,7 @@ func GetDNSSECMaterial(zName string, dMap *sync.Map, dConf DNSSECConfig) DNSSECM
 
 // EstablishCoT 根据查询自动添加 DNSKEY，DS，RRSIG 记录
 // 自动完成信任链（Trust of Chain）的建立。
+// 设置 dConf.ZoneCuts 时，DNSKEY 仅在区域顶点回复，DS 仅在区域切割的父区域一侧回复。
 // 其接受参数为：
 //   - qry dns.DNSMessage，查询信息
 //   - dConf DNSSECConfig，DNSSEC 配置
@@ -404,37 +645,69 @@ func EstablishCoT(qry dns.DNSMessage, resp *dns.DNSMessage, dConf DNSSECConfig,
 	rrset := []dns.DNSResourceRecord{}
 
 	if qType == dns.DNSRRTypeDNSKEY {
-		// 如果查询类型为 DNSKEY，
-		dMat := GetDNSSECMaterial(qName, dMap, dConf)
-		rrset = append(rrset, dMat.ZSKRecord, dMat.KSKRecord)
-		resp.Answer = append(resp.Answer, dMat.ZSKRecord, dMat.KSKRecord)
+		// 设置区域切割数据库时，DNSKEY 仅在区域顶点由子区域回复
+		if dConf.ZoneCuts != nil && !dConf.ZoneCuts.IsApex(qName) {
+			FixCount(resp)
+			return nil
+		}
+		// 如果查询类型为 DNSKEY，则回复全部签名者的公钥
+		dMats := GetSignerMaterials(qName, dMap, dConf)
+		for _, dMat := range dMats {
+			rrset = append(rrset, dMat.ZSKRecord, dMat.KSKRecord)
+		}
+		resp.Answer = append(resp.Answer, rrset...)
 
-		// 生成密钥集签名
-		sig := SignSet(rrset, CryptoMaterial{})
+		// 使用每个签名者的 KSK 生成密钥集签名
+		for _, dMat := range dMats {
+			sig := SignSet(rrset, KSKCryptoMaterial(qName, dMat, dConf))
+			resp.Answer = append(resp.Answer, sig)
+		}
 
-		rrset = append(rrset, sig)
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+	} else if qType == dns.DNSRRTypeDS {
+		upName, ok := dsSigner(qName, dConf)
+		if !ok {
+			FixCount(resp)
+			return nil
+		}
+		// 如果查询类型为 DS，则为每个签名者的 KSK 生成 DS 记录
+		for _, dMat := range GetSignerMaterials(qName, dMap, dConf) {
+			kskRData, _ := dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY)
+			if !dsAlgoEnabled(dConf, kskRData.Algorithm) {
+				continue
+			}
+			ds := xperi.GenerateRRDS(qName, *kskRData, dConf.Type)
+			dConf.Meter.AddHashes(1)
+			rrset = append(rrset, ds)
+		}
 		resp.Answer = append(resp.Answer, rrset...)
 
+		// 使用父区域（或启用 ChildSideDS 时子区域自身）全部签名者的 ZSK 签名
+		for _, dMat := range GetSignerMaterials(upName, dMap, dConf) {
+			if len(rrset) == 0 {
+				break
+			}
+			sig := SignSet(rrset, ZSKCryptoMaterial(upName, dMat, dConf))
+			resp.Answer = append(resp.Answer, sig)
+		}
+
 		resp.Header.RCode = dns.DNSResponseCodeNoErr
-	} else if qType == dns.DNSRRTypeDS {
-		// 如果查询类型为 DS，则生成 DS 记录
-		dMat := GetDNSSECMaterial(qName, dMap, dConf)
-		// 生成正确DS记录
-		kskRData, _ := dMat.KSKRecord.RData.(*dns.DNSRDATADNSKEY)
-		ds := xperi.GenerateRRDS(qName, *kskRData, dConf.Type)
-		rrset = append(rrset, ds)
-
-		upName := dns.GetUpperDomainName(&qName)
-		dMat = GetDNSSECMaterial(upName, dMap, dConf)
-		// 签名
-		sig := SignSet(rrset, CryptoMaterial{})
-		rrset = append(rrset, sig)
-		resp.Answer = append(resp.Answer, sig)
 	}
 	FixCount(resp)
 	return nil
 }
 
+// InitServFailResponse 根据原始查询生成 SERVFAIL 回复，用于无法正常生成回复的情形
+func InitServFailResponse(qry []byte) []byte {
+	resp := make([]byte, len(qry))
+	copy(resp, qry)
+	if len(resp) >= 4 {
+		resp[2] |= 0x80                                                 // 设置QR位为1
+		resp[3] = resp[3]&0xF0 | byte(dns.DNSResponseCodeServFail&0x0F) // 设置RCODE为SERVFAIL
+	}
+	return resp
+}
+
 func InitTruncatedResponse(qry []byte) []byte {
 	resp := make([]byte, len(qry))
 	copy(resp, qry)
@@ -0,0 +1,130 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// responser_test.go 文件用于对回复器的签名辅助函数进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// signedTestRR 构造测试用的资源记录
+func signedTestRR(name string, rrType dns.DNSType, rdata dns.DNSRRRDATA) dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(name),
+		Type:  rrType,
+		Class: dns.DNSClassIN,
+		TTL:   3600,
+		RDLen: uint16(rdata.Size()),
+		RData: rdata,
+	}
+}
+
+// deterministicCryptoMaterial 返回签名结果确定的签名材料：ED25519 签名是确定性的，且有效期固定
+func deterministicCryptoMaterial(t *testing.T, keyTag uint16) CryptoMaterial {
+	privKey, _ := xperi.DNSSECAlgorithmerFactory(dns.DNSSECAlgorithmED25519).GenerateKey()
+	if len(privKey) == 0 {
+		t.Fatalf("method ED25519 GenerateKey() failed: empty private key")
+	}
+	return CryptoMaterial{
+		Algorithm:  dns.DNSSECAlgorithmED25519,
+		Expiration: 1800000000,
+		Inception:  1700000000,
+		KeyTag:     keyTag,
+		SignerName: "test",
+		PrivateKey: privKey,
+	}
+}
+
+// 测试 GroupRRSets 的分组及排序
+func TestGroupRRSets(t *testing.T) {
+	section := dns.DNSResponseSection{
+		signedTestRR("www.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 2)}),
+		signedTestRR("b.test", dns.DNSRRTypeTXT, &dns.DNSRDATATXT{TXT: []string{"b"}}),
+		signedTestRR("WWW.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 3)}),
+		signedTestRR("www.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 1)}),
+		signedTestRR("test", dns.DNSRRTypeNS, &dns.DNSRDATANS{NSDNAME: "ns.test"}),
+		signedTestRR("b.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 4)}),
+	}
+	expected := []struct {
+		name  string
+		typ   dns.DNSType
+		count int
+	}{
+		{"test", dns.DNSRRTypeNS, 1},
+		{"b.test", dns.DNSRRTypeA, 1},
+		{"b.test", dns.DNSRRTypeTXT, 1},
+		// 仅大小写不同的名称分属不同的 RRset，以名称的字节序区分先后
+		{"WWW.test", dns.DNSRRTypeA, 1},
+		{"www.test", dns.DNSRRTypeA, 2},
+	}
+
+	rrsets := GroupRRSets(section)
+	if len(rrsets) != len(expected) {
+		t.Fatalf("function GroupRRSets() failed: got %d RRsets, expected %d", len(rrsets), len(expected))
+	}
+	for i, e := range expected {
+		if rrsets[i][0].Name.DomainName != e.name || rrsets[i][0].Type != e.typ || len(rrsets[i]) != e.count {
+			t.Errorf("function GroupRRSets() failed: RRset %d:\ngot: %s %s x%d\nexpected: %s %s x%d",
+				i, rrsets[i][0].Name.DomainName, rrsets[i][0].Type, len(rrsets[i]), e.name, e.typ, e.count)
+		}
+	}
+	// RRset 内的记录保持其在区域中的顺序
+	if a := rrsets[4][0].RData.(*dns.DNSRDATAA); !a.Address.Equal(dns.IPv4(10, 0, 0, 2)) {
+		t.Errorf("function GroupRRSets() failed: RRset order changed, first record is %s", a.Address)
+	}
+}
+
+// 测试 SignSection 及 SignSectionMulti 的结果可逐字节复现，且与区域中 RRset 的先后无关
+func TestSignSectionReproducible(t *testing.T) {
+	records := []dns.DNSResourceRecord{
+		signedTestRR("www.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 1)}),
+		signedTestRR("www.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 2)}),
+		signedTestRR("WWW.test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 3)}),
+		signedTestRR("Www.Test", dns.DNSRRTypeA, &dns.DNSRDATAA{Address: dns.IPv4(10, 0, 0, 4)}),
+		signedTestRR("b.test", dns.DNSRRTypeTXT, &dns.DNSRDATATXT{TXT: []string{"b"}}),
+		signedTestRR("test", dns.DNSRRTypeNS, &dns.DNSRDATANS{NSDNAME: "ns.test"}),
+	}
+	// 相同的记录以不同的 RRset 先后组成两个区域
+	forward := dns.DNSResponseSection{records[0], records[1], records[2], records[3], records[4], records[5]}
+	backward := dns.DNSResponseSection{records[5], records[4], records[3], records[2], records[0], records[1]}
+
+	zsk, ksk := deterministicCryptoMaterial(t, 1), deterministicCryptoMaterial(t, 2)
+	sigBytes := func(section []dns.DNSResourceRecord) ([]byte, int) {
+		encoded, count := []byte{}, 0
+		for _, rr := range section {
+			if rr.Type == dns.DNSRRTypeRRSIG {
+				encoded = append(encoded, rr.Encode()...)
+				count++
+			}
+		}
+		return encoded, count
+	}
+
+	first, n := sigBytes(SignSection(append(dns.DNSResponseSection{}, forward...), zsk))
+	// 仅大小写不同的 3 个名称各自得到一个 RRSIG
+	if n != 5 {
+		t.Errorf("function SignSection() failed: got %d RRSIGs, expected 5", n)
+	}
+	for i, section := range []dns.DNSResponseSection{forward, backward} {
+		got, _ := sigBytes(SignSection(append(dns.DNSResponseSection{}, section...), zsk))
+		if !bytes.Equal(got, first) {
+			t.Errorf("function SignSection() failed: run %d produced different RRSIGs:\ngot: %x\nexpected: %x", i, got, first)
+		}
+	}
+
+	multi, n := sigBytes(SignSectionMulti(append(dns.DNSResponseSection{}, forward...), []CryptoMaterial{zsk, ksk}))
+	if n != 10 {
+		t.Errorf("function SignSectionMulti() failed: got %d RRSIGs, expected 10", n)
+	}
+	if again, _ := sigBytes(SignSectionMulti(append(dns.DNSResponseSection{}, backward...), []CryptoMaterial{zsk, ksk})); !bytes.Equal(again, multi) {
+		t.Errorf("function SignSectionMulti() failed: RRSIGs differ between runs")
+	}
+	if !bytes.HasPrefix(multi, first) {
+		t.Errorf("function SignSectionMulti() failed: RRSIGs of the first material differ from SignSection")
+	}
+}
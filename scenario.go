@@ -0,0 +1,203 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// scenario.go 文件定义了实验场景脚本及其执行器。
+// 场景脚本以 JSON 格式描述随时间推移的若干阶段，每个阶段可固定设置参数，
+// 也可令参数在阶段内线性变化，执行器据此在实验过程中自动调整攻击参数，例如：
+//
+//	{
+//	  "name": "hashtrap-ramp",
+//	  "step": "1s",
+//	  "phases": [
+//	    {"name": "benign", "duration": "60s"},
+//	    {"name": "hashtrap", "duration": "5m",
+//	     "ramp": {"CollidedDSNum": {"from": 10, "to": 1000}}}
+//	  ]
+//	}
+//
+// 参数的含义由应用参数的回调函数决定，各阶段的参数均相对于实验的初始配置，不会在阶段之间累积。
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"time"
+)
+
+// ScenarioRamp 表示参数在阶段内自 From 至 To 的线性变化，取值会被舍入为整数
+type ScenarioRamp struct {
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+// ScenarioPhase 表示场景中的一个阶段
+type ScenarioPhase struct {
+	Name string `json:"name"`
+	// 阶段时长，形如 "60s"、"5m"
+	Duration string `json:"duration"`
+	// 阶段内固定设置的参数
+	Set map[string]interface{} `json:"set"`
+	// 阶段内线性变化的参数
+	Ramp map[string]ScenarioRamp `json:"ramp"`
+
+	duration time.Duration
+}
+
+// Scenario 表示一个实验场景
+type Scenario struct {
+	Name string `json:"name"`
+	// 线性变化参数的更新间隔，为空时为 "1s"
+	Step string `json:"step"`
+	// 全部阶段结束后是否从头重复
+	Repeat bool            `json:"repeat"`
+	Phases []ScenarioPhase `json:"phases"`
+
+	step time.Duration
+}
+
+// ParseScenario 解析 JSON 格式的场景脚本
+// 其接受参数为：
+//   - data []byte，场景脚本
+//
+// 返回值为：
+//   - *Scenario，解析后的场景
+//   - error，错误信息
+func ParseScenario(data []byte) (*Scenario, error) {
+	s := &Scenario{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("function ParseScenario failed: unmarshal scenario failed.\n%v", err)
+	}
+	if len(s.Phases) == 0 {
+		return nil, fmt.Errorf("function ParseScenario failed: scenario %s has no phase", s.Name)
+	}
+	s.step = time.Second
+	if s.Step != "" {
+		step, err := time.ParseDuration(s.Step)
+		if err != nil || step <= 0 {
+			return nil, fmt.Errorf("function ParseScenario failed: invalid step %q", s.Step)
+		}
+		s.step = step
+	}
+	for i := range s.Phases {
+		d, err := time.ParseDuration(s.Phases[i].Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("function ParseScenario failed: invalid duration %q of phase %s", s.Phases[i].Duration, s.Phases[i].Name)
+		}
+		s.Phases[i].duration = d
+	}
+	return s, nil
+}
+
+// LoadScenario 读取并解析场景脚本文件
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("function LoadScenario failed: read %s failed.\n%v", path, err)
+	}
+	return ParseScenario(data)
+}
+
+// Duration 返回场景一轮的总时长
+func (s *Scenario) Duration() time.Duration {
+	total := time.Duration(0)
+	for _, p := range s.Phases {
+		total += p.duration
+	}
+	return total
+}
+
+// At 返回场景开始后指定时刻所处的阶段及其参数
+// 其接受参数为：
+//   - elapsed time.Duration，自场景开始经过的时长
+//
+// 返回值为：
+//   - string，阶段名称
+//   - map[string]interface{}，阶段参数，线性变化的参数为 int64
+//   - bool，场景是否仍在进行，不重复的场景结束后为 false
+func (s *Scenario) At(elapsed time.Duration) (string, map[string]interface{}, bool) {
+	if s.Repeat {
+		elapsed %= s.Duration()
+	}
+	for _, p := range s.Phases {
+		if elapsed >= p.duration {
+			elapsed -= p.duration
+			continue
+		}
+		params := make(map[string]interface{}, len(p.Set)+len(p.Ramp))
+		for k, v := range p.Set {
+			params[k] = v
+		}
+		frac := float64(elapsed) / float64(p.duration)
+		for k, ramp := range p.Ramp {
+			params[k] = int64(math.Round(ramp.From + (ramp.To-ramp.From)*frac))
+		}
+		return p.Name, params, true
+	}
+	return "", nil, false
+}
+
+// ScenarioRunnerConfig 记录场景执行器的配置
+type ScenarioRunnerConfig struct {
+	// 场景
+	Scenario *Scenario
+	// 应用参数的回调函数，仅在参数发生变化时调用
+	Apply func(phase string, params map[string]interface{}) error
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// ScenarioRunner 场景执行器：按照场景脚本周期性地应用参数。
+type ScenarioRunner struct {
+	Config         ScenarioRunnerConfig
+	ScenarioLogger *log.Logger
+}
+
+// NewScenarioRunner 根据配置创建一个新的场景执行器
+func NewScenarioRunner(conf ScenarioRunnerConfig) *ScenarioRunner {
+	scenarioLogger := log.New(conf.LogWriter, "Scenario: ", log.LstdFlags)
+	return &ScenarioRunner{
+		Config:         conf,
+		ScenarioLogger: scenarioLogger,
+	}
+}
+
+// Run 执行场景，直至场景结束或上下文结束
+// 返回值为：
+//   - error，应用参数失败时返回该错误，上下文结束时返回上下文的错误
+func (r *ScenarioRunner) Run(ctx context.Context) error {
+	s := r.Config.Scenario
+	start := time.Now()
+	ticker := time.NewTicker(s.step)
+	defer ticker.Stop()
+
+	lastPhase := ""
+	var lastParams map[string]interface{}
+	for {
+		phase, params, ok := s.At(time.Since(start))
+		if !ok {
+			r.ScenarioLogger.Printf("Scenario %s finished after %v.", s.Name, time.Since(start).Round(time.Second))
+			return nil
+		}
+		if phase != lastPhase {
+			r.ScenarioLogger.Printf("Scenario %s entering phase %s.", s.Name, phase)
+		}
+		if phase != lastPhase || !reflect.DeepEqual(params, lastParams) {
+			if err := r.Config.Apply(phase, params); err != nil {
+				return fmt.Errorf("method ScenarioRunner Run failed: apply phase %s failed.\n%v", phase, err)
+			}
+			lastPhase, lastParams = phase, params
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// script.go 文件定义了 ScriptResponser 脚本回复器，
+// 其将每个查询交由内嵌的 Starlark（https://github.com/bazelbuild/starlark ，Python 的一个方言）脚本处理，
+// 使不熟悉 Go 的实验者无需重新编译即可逐查询地定制回复。
+//
+// 脚本在回复器创建时被执行一次，其全局变量随后被冻结，须定义函数 respond(query)。
+// 每个查询在独立的 Starlark 线程中调用 respond，因此查询可被并发处理；脚本的 print 输出将被写入日志。
+// 脚本中可使用预先声明的 json 模块（json.encode、json.decode）。
+//
+// query 为如下的字典：
+//
+//	{"client": "192.0.2.1", "port": 53000, "protocol": "udp",
+//	 "name": "www.test", "type": "A", "class": "IN", "rd": True, "edns": True, "do": True, "udp_payload": 1232}
+//
+// respond 返回如下的字典，省略的键取默认值：
+//
+//	{"rcode": 0, "aa": True, "tc": False, "drop": False,
+//	 "answer": [{"name": "www.test", "type": "A", "ttl": 60, "data": "10.0.0.1"}],
+//	 "authority": [], "additional": []}
+//
+// 记录数据的格式详见 ParseRDATA。配置了 DNSSEC 且查询设置了 DO 标志时，
+// 脚本返回的记录将由 xdns 签名；drop 为 True 或 respond 返回 None 时不作回复。
+// 一个最小的脚本如下：
+//
+//	def respond(query):
+//	    if query["type"] != "A":
+//	        return {"rcode": 3}
+//	    return {"answer": [{"name": query["name"], "type": "A", "ttl": 60, "data": "10.0.0.1"}]}
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// DefaultScriptTimeout 为单次调用 respond 的默认超时时长
+const DefaultScriptTimeout = 2 * time.Second
+
+// ScriptConfig 记录脚本回复器的配置
+type ScriptConfig struct {
+	// 脚本文件路径，如 "hook.star"
+	Path string
+	// 脚本源码，非空时使用该源码而不读取 Path，Path 仅用于错误信息
+	Source string
+	// 单次调用 respond 的超时时长，超时的调用将被中止，0 表示 DefaultScriptTimeout
+	Timeout time.Duration
+	// DNSSEC 配置，不为 nil 时对脚本返回的记录签名
+	DNSSEC *DNSSECConfig
+	// 日志输出，脚本的 print 输出亦写入其中
+	LogWriter io.Writer
+}
+
+// ScriptQuery 表示传递给脚本的查询
+type ScriptQuery struct {
+	Client   string
+	Port     int
+	Protocol string
+	Name     string
+	Type     string
+	Class    string
+	RD       bool
+	EDNS     bool
+	DO       bool
+	// 客户端通告的 UDP 载荷大小，未携带 OPT 记录时为 0
+	UDPPayload uint16
+}
+
+// Dict 返回查询的 Starlark 字典表示，键详见文件注释
+func (sq ScriptQuery) Dict() *starlark.Dict {
+	d := starlark.NewDict(10)
+	d.SetKey(starlark.String("client"), starlark.String(sq.Client))
+	d.SetKey(starlark.String("port"), starlark.MakeInt(sq.Port))
+	d.SetKey(starlark.String("protocol"), starlark.String(sq.Protocol))
+	d.SetKey(starlark.String("name"), starlark.String(sq.Name))
+	d.SetKey(starlark.String("type"), starlark.String(sq.Type))
+	d.SetKey(starlark.String("class"), starlark.String(sq.Class))
+	d.SetKey(starlark.String("rd"), starlark.Bool(sq.RD))
+	d.SetKey(starlark.String("edns"), starlark.Bool(sq.EDNS))
+	d.SetKey(starlark.String("do"), starlark.Bool(sq.DO))
+	d.SetKey(starlark.String("udp_payload"), starlark.MakeInt(int(sq.UDPPayload)))
+	return d
+}
+
+// ScriptRecord 表示脚本返回的一条资源记录，Data 为记录数据的文本表示
+type ScriptRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	TTL  uint32 `json:"ttl"`
+	Data string `json:"data"`
+}
+
+// ScriptReply 表示脚本返回的回复
+type ScriptReply struct {
+	RCode int `json:"rcode"`
+	// 是否设置 AA 标志，省略时为 true
+	AA   *bool `json:"aa"`
+	TC   bool  `json:"tc"`
+	Drop bool  `json:"drop"`
+
+	Answer     []ScriptRecord `json:"answer"`
+	Authority  []ScriptRecord `json:"authority"`
+	Additional []ScriptRecord `json:"additional"`
+}
+
+// ScriptResponser 是一个将查询交由内嵌 Starlark 脚本处理的回复器实现。
+type ScriptResponser struct {
+	Config       ScriptConfig
+	ScriptLogger *log.Logger
+
+	// 脚本定义的 respond 函数，其所属的全局变量已被冻结，可被并发调用
+	respond starlark.Callable
+
+	materialMap sync.Map
+}
+
+// scriptPredeclared 为脚本中预先声明的名称
+var scriptPredeclared = starlark.StringDict{
+	"json": starlarkjson.Module,
+}
+
+// NewScriptResponser 根据配置创建一个新的脚本回复器，并执行脚本
+// 其接受参数为：
+//   - conf ScriptConfig，脚本回复器配置
+//
+// 返回值为：
+//   - *ScriptResponser，脚本回复器
+//   - error，脚本无法读取、执行出错或未定义 respond 函数时返回错误
+func NewScriptResponser(conf ScriptConfig) (*ScriptResponser, error) {
+	if conf.Path == "" && conf.Source == "" {
+		return nil, fmt.Errorf("function NewScriptResponser failed: no script path or source")
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultScriptTimeout
+	}
+	r := &ScriptResponser{
+		Config:       conf,
+		ScriptLogger: log.New(conf.LogWriter, "Script: ", log.LstdFlags),
+	}
+
+	var src any
+	if conf.Source != "" {
+		src = conf.Source
+	}
+	thread := r.newThread("load")
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, conf.Path, src, scriptPredeclared)
+	if err != nil {
+		return nil, fmt.Errorf("function NewScriptResponser failed: execute script %s failed.\n%v", conf.Path, err)
+	}
+	respond, ok := globals["respond"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("function NewScriptResponser failed: script %s does not define function respond", conf.Path)
+	}
+	r.respond = respond
+	return r, nil
+}
+
+// newThread 创建执行脚本的 Starlark 线程，其 print 输出写入日志
+func (r *ScriptResponser) newThread(name string) *starlark.Thread {
+	return &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			r.ScriptLogger.Print(msg)
+		},
+	}
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *ScriptResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，上下文结束时中止脚本的执行。
+// 脚本超时或出错时返回错误，脚本要求不作回复时返回 ErrDropResponse，查询不含问题部分时回复 FORMERR。
+func (r *ScriptResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+	if len(qry.Question) == 0 {
+		resp := InitNXDOMAIN(qry)
+		resp.Header.RCode = dns.DNSResponseCodeFormErr
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	reply, err := r.call(ctx, r.newQuery(qry, connInfo))
+	if err != nil {
+		return []byte{}, fmt.Errorf("method ScriptResponser ResponseContext failed: %w", err)
+	}
+	if reply.Drop {
+		return nil, ErrDropResponse
+	}
+
+	resp, err := r.build(ctx, qry, reply)
+	if err != nil {
+		return []byte{}, fmt.Errorf("method ScriptResponser ResponseContext failed: invalid script reply.\n%v", err)
+	}
+	return resp.Encode(), nil
+}
+
+// newQuery 生成传递给脚本的查询，qry 须包含问题部分
+func (r *ScriptResponser) newQuery(qry dns.DNSMessage, connInfo ConnectionInfo) ScriptQuery {
+	sq := ScriptQuery{
+		Client:   connInfo.ClientIP().String(),
+		Protocol: string(connInfo.Protocol),
+		Name:     qry.Question[0].Name.DomainName,
+		Type:     dns.FormatDNSType(qry.Question[0].Type),
+		Class:    qry.Question[0].Class.String(),
+		RD:       qry.Header.RD,
+	}
+	switch addr := connInfo.Address.(type) {
+	case *net.UDPAddr:
+		sq.Port = addr.Port
+	case *net.TCPAddr:
+		sq.Port = addr.Port
+	}
+	if opt, ok := qry.OPT(); ok {
+		sq.EDNS = true
+		sq.DO = opt.DO
+		sq.UDPPayload = opt.UDPPayloadSize
+	}
+	return sq
+}
+
+// call 调用脚本的 respond 函数，超时或上下文结束时中止其执行
+func (r *ScriptResponser) call(ctx context.Context, sq ScriptQuery) (ScriptReply, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Config.Timeout)
+	defer cancel()
+	thread := r.newThread("respond")
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel(ctx.Err().Error())
+	})
+	defer stop()
+
+	v, err := starlark.Call(thread, r.respond, starlark.Tuple{sq.Dict()}, nil)
+	if ctx.Err() != nil {
+		return ScriptReply{}, fmt.Errorf("script respond for %s aborted: %w", sq.Name, ctx.Err())
+	}
+	if err != nil {
+		return ScriptReply{}, fmt.Errorf("script respond for %s failed.\n%v", sq.Name, err)
+	}
+	if v == starlark.None {
+		return ScriptReply{Drop: true}, nil
+	}
+	if _, ok := v.(*starlark.Dict); !ok {
+		return ScriptReply{}, fmt.Errorf("script respond for %s returned %s, expected dict", sq.Name, v.Type())
+	}
+
+	// 经由 json 模块将回复字典转换为 ScriptReply，以复用其字段的名称及默认值
+	encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+	if err != nil {
+		return ScriptReply{}, fmt.Errorf("script respond for %s returned an invalid reply.\n%v", sq.Name, err)
+	}
+	reply := ScriptReply{}
+	if err := json.Unmarshal([]byte(encoded.(starlark.String)), &reply); err != nil {
+		return ScriptReply{}, fmt.Errorf("script respond for %s returned an invalid reply.\n%v", sq.Name, err)
+	}
+	return reply, nil
+}
+
+// build 根据脚本的回复构造 DNS 回复
+func (r *ScriptResponser) build(ctx context.Context, qry dns.DNSMessage, reply ScriptReply) (dns.DNSMessage, error) {
+	resp := InitNXDOMAIN(qry)
+	resp.Header.RCode = dns.DNSResponseCode(reply.RCode)
+	resp.Header.AA = reply.AA == nil || *reply.AA
+	resp.Header.TC = reply.TC
+
+	sections := []struct {
+		records []ScriptRecord
+		section *dns.DNSResponseSection
+	}{
+		{reply.Answer, &resp.Answer},
+		{reply.Authority, &resp.Authority},
+		{reply.Additional, &resp.Additional},
+	}
+	for _, s := range sections {
+		for _, rec := range s.records {
+			rr, err := r.record(rec)
+			if err != nil {
+				return dns.DNSMessage{}, err
+			}
+			*s.section = append(*s.section, rr)
+		}
+	}
+
+	if opt, ok := qry.OPT(); ok && opt.DO && r.Config.DNSSEC != nil {
+		EnableDNSSECContext(ctx, qry, &resp, *r.Config.DNSSEC, &r.materialMap)
+	}
+	FixCount(&resp)
+	return resp, nil
+}
+
+// record 将脚本返回的记录解析为资源记录
+func (r *ScriptResponser) record(rec ScriptRecord) (dns.DNSResourceRecord, error) {
+	rrType, err := dns.ParseDNSType(rec.Type)
+	if err != nil {
+		return dns.DNSResourceRecord{}, err
+	}
+	rdata, err := ParseRDATA(rrType, rec.Data)
+	if err != nil {
+		return dns.DNSResourceRecord{}, err
+	}
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(rdataName(rec.Name)),
+		Type:  rrType,
+		Class: dns.DNSClassIN,
+		TTL:   rec.TTL,
+		RDLen: uint16(rdata.Size()),
+		RData: rdata,
+	}, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// script_test.go 文件用于对脚本回复器进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// testedScript 为测试所使用的脚本，按查询名称的首个标签选择行为
+const testedScript = `
+def respond(query):
+    label = query["name"].split(".")[0]
+    if label == "nx":
+        return {"rcode": 3}
+    if label == "drop":
+        return {"drop": True}
+    if label == "none":
+        return None
+    if label == "echo":
+        print("echo", query["client"], query["protocol"], query["do"])
+        return {"aa": False, "answer": [
+            {"name": query["name"], "type": "TXT", "ttl": 30, "data": json.encode([query["type"], query["port"], query["udp_payload"]])},
+        ]}
+    if label == "bad":
+        return {"answer": [{"name": query["name"], "type": "A", "ttl": 60, "data": "not-an-address"}]}
+    if label == "list":
+        return ["not", "a", "dict"]
+    if label == "fail":
+        fail("failed on purpose")
+    if label == "loop":
+        for i in range(1000000000):
+            pass
+    return {"answer": [{"name": query["name"], "type": "A", "ttl": 60, "data": "10.0.0.1"}]}
+`
+
+// newTestQuery 返回来自 192.0.2.1:53000 的 UDP 查询 ConnectionInfo，udpSize 不为 0 时携带设置了 DO 标志的 OPT 记录
+func newTestQuery(qName string, qType dns.DNSType, udpSize uint16) ConnectionInfo {
+	qry := dns.DNSMessage{
+		Header: dns.DNSHeader{ID: 0x1234, RD: true, QDCount: 1},
+		Question: dns.DNSQuestionSection{
+			{Name: *dns.NewDNSName(qName), Type: qType, Class: dns.DNSClassIN},
+		},
+	}
+	if udpSize != 0 {
+		qry.Additional = dns.DNSResponseSection{(&dns.DNSOPTRecord{UDPPayloadSize: udpSize, DO: true}).ResourceRecord()}
+	}
+	FixCount(&qry)
+	return ConnectionInfo{
+		Protocol: ProtocolUDP,
+		Address:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53000},
+		Packet:   qry.Encode(),
+	}
+}
+
+// newTestedScriptResponser 创建使用 testedScript 的脚本回复器，日志写入 log
+func newTestedScriptResponser(t *testing.T, log *bytes.Buffer) *ScriptResponser {
+	r, err := NewScriptResponser(ScriptConfig{
+		Path:      "tested.star",
+		Source:    testedScript,
+		Timeout:   200 * time.Millisecond,
+		LogWriter: log,
+	})
+	if err != nil {
+		t.Fatalf("function NewScriptResponser() failed:\n%v", err)
+	}
+	return r
+}
+
+// decodeScriptResponse 解析回复器的回复
+func decodeScriptResponse(t *testing.T, resp []byte) dns.DNSMessage {
+	msg := dns.DNSMessage{}
+	if _, err := msg.DecodeFromBuffer(resp, 0); err != nil {
+		t.Fatalf("method DNSMessage DecodeFromBuffer() failed:\n%v", err)
+	}
+	return msg
+}
+
+// 测试脚本回复器的回复
+func TestScriptResponser(t *testing.T) {
+	log := &bytes.Buffer{}
+	r := newTestedScriptResponser(t, log)
+
+	resp, err := r.Response(newTestQuery("www.test", dns.DNSRRTypeA, 0))
+	if err != nil {
+		t.Fatalf("method ScriptResponser Response() failed:\n%v", err)
+	}
+	msg := decodeScriptResponse(t, resp)
+	if msg.Header.ID != 0x1234 || !msg.Header.AA || msg.Header.RCode != dns.DNSResponseCodeNoErr || len(msg.Answer) != 1 {
+		t.Fatalf("method ScriptResponser Response() failed:\ngot:\n%s\nexpected: one A record", msg.String())
+	}
+	if a, ok := msg.Answer[0].RData.(*dns.DNSRDATAA); !ok || !a.Address.Equal(net.IPv4(10, 0, 0, 1)) || msg.Answer[0].TTL != 60 {
+		t.Errorf("method ScriptResponser Response() failed:\ngot:\n%s\nexpected: www.test A 10.0.0.1", msg.Answer[0].String())
+	}
+
+	resp, err = r.Response(newTestQuery("nx.test", dns.DNSRRTypeA, 0))
+	if err != nil {
+		t.Fatalf("method ScriptResponser Response() failed:\n%v", err)
+	}
+	if msg := decodeScriptResponse(t, resp); msg.Header.RCode != dns.DNSResponseCodeNXDomain || len(msg.Answer) != 0 {
+		t.Errorf("method ScriptResponser Response() failed:\ngot:\n%s\nexpected: NXDOMAIN", msg.String())
+	}
+
+	// 查询的各字段均被传递给脚本
+	resp, err = r.Response(newTestQuery("echo.test", dns.DNSRRTypeAAAA, 1232))
+	if err != nil {
+		t.Fatalf("method ScriptResponser Response() failed:\n%v", err)
+	}
+	msg = decodeScriptResponse(t, resp)
+	if msg.Header.AA || len(msg.Answer) != 1 {
+		t.Fatalf("method ScriptResponser Response() failed:\ngot:\n%s\nexpected: one TXT record without AA", msg.String())
+	}
+	if txt := msg.Answer[0].RData.(*dns.DNSRDATATXT); strings.Join(txt.TXT, "") != `["AAAA",53000,1232]` {
+		t.Errorf("method ScriptResponser Response() failed:\ngot: %q\nexpected: %q", txt.TXT, `["AAAA",53000,1232]`)
+	}
+	if !strings.Contains(log.String(), "echo 192.0.2.1 udp True") {
+		t.Errorf("method ScriptResponser Response() failed: script print not logged:\n%s", log.String())
+	}
+}
+
+// 测试脚本要求不作回复
+func TestScriptResponserDrop(t *testing.T) {
+	r := newTestedScriptResponser(t, &bytes.Buffer{})
+	for _, qName := range []string{"drop.test", "none.test"} {
+		if _, err := r.Response(newTestQuery(qName, dns.DNSRRTypeA, 0)); !errors.Is(err, ErrDropResponse) {
+			t.Errorf("method ScriptResponser Response(%s) failed:\ngot: %v\nexpected: %v", qName, err, ErrDropResponse)
+		}
+	}
+}
+
+// 测试不含问题部分的查询
+func TestScriptResponserNoQuestion(t *testing.T) {
+	r := newTestedScriptResponser(t, &bytes.Buffer{})
+	qry := dns.DNSMessage{Header: dns.DNSHeader{ID: 0x1234}}
+	resp, err := r.Response(ConnectionInfo{
+		Protocol: ProtocolUDP,
+		Address:  &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53000},
+		Packet:   qry.Encode(),
+	})
+	if err != nil {
+		t.Fatalf("method ScriptResponser Response() failed:\n%v", err)
+	}
+	if msg := decodeScriptResponse(t, resp); msg.Header.RCode != dns.DNSResponseCodeFormErr {
+		t.Errorf("method ScriptResponser Response() failed:\ngot: %s\nexpected: %s", msg.Header.RCode, dns.DNSResponseCodeFormErr)
+	}
+}
+
+// 测试脚本出错、返回非法回复及超时
+func TestScriptResponserErrors(t *testing.T) {
+	r := newTestedScriptResponser(t, &bytes.Buffer{})
+	for _, qName := range []string{"bad.test", "list.test", "fail.test"} {
+		if _, err := r.Response(newTestQuery(qName, dns.DNSRRTypeA, 0)); err == nil {
+			t.Errorf("method ScriptResponser Response(%s) failed: expected an error but got nil", qName)
+		}
+	}
+
+	start := time.Now()
+	_, err := r.Response(newTestQuery("loop.test", dns.DNSRRTypeA, 0))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("method ScriptResponser Response() failed:\ngot: %v\nexpected: %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("method ScriptResponser Response() failed: script was not aborted after %v", elapsed)
+	}
+
+	// 上下文结束时中止脚本
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.ResponseContext(ctx, newTestQuery("loop.test", dns.DNSRRTypeA, 0)); !errors.Is(err, context.Canceled) {
+		t.Errorf("method ScriptResponser ResponseContext() failed:\ngot: %v\nexpected: %v", err, context.Canceled)
+	}
+}
+
+// 测试脚本无法加载的情况
+func TestNewScriptResponserInvalid(t *testing.T) {
+	tests := []ScriptConfig{
+		{},
+		{Path: "missing.star"},
+		{Path: "syntax.star", Source: "def respond(query) return None"},
+		{Path: "norespond.star", Source: "x = 1"},
+		{Path: "notfunc.star", Source: "respond = 1"},
+	}
+	for _, conf := range tests {
+		conf.LogWriter = &bytes.Buffer{}
+		if _, err := NewScriptResponser(conf); err == nil {
+			t.Errorf("function NewScriptResponser(%q) failed: expected an error but got nil", conf.Path)
+		}
+	}
+}
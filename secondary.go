@@ -0,0 +1,454 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// secondary.go 文件定义了 SecondaryZone 次级区域，
+// 其如同次级服务器一样从配置的主服务器取得区域数据：
+// 定期以 SOA 查询检查序列号（间隔默认取自 SOA 的 REFRESH 及 RETRY 字段），
+// 或在收到主服务器的 NOTIFY（RFC 1996）后立即检查，序列号更新时以 IXFR 或 AXFR 传送区域，
+// 再按变异规则修改区域数据后写入存储并回复查询。
+//
+// 借助变异规则，xdns 可作为一个可插入的次级服务器，
+// 在真实的主服务器与解析器之间篡改区域数据，用于研究篡改的次级服务器对解析器的影响。
+
+package xdns
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/store"
+)
+
+// SecondaryRule 表示对传送所得区域数据的一条变异规则
+type SecondaryRule struct {
+	// 规则生效的名称，其自身及其下的全部名称均受影响，为空时对整个区域生效
+	Name string
+	// 是否删除全部 RRSIG 记录
+	StripRRSIG bool
+	// 删除的记录类型，覆盖这些类型的 RRSIG 记录也一并删除
+	RemoveTypes []dns.DNSType
+	// TTL 上限，大于该值的 TTL 将被压低，0 表示不修改
+	MaxTTL uint32
+	// A 记录的替换地址，为 nil 时不替换
+	ReplaceA net.IP
+	// AAAA 记录的替换地址，为 nil 时不替换
+	ReplaceAAAA net.IP
+	// 添加至区域的记录
+	Add []dns.DNSResourceRecord
+}
+
+// apply 对区域数据应用变异规则
+func (rule SecondaryRule) apply(rrs dns.DNSResponseSection) dns.DNSResponseSection {
+	matched, others := dns.DNSResponseSection{}, dns.DNSResponseSection{}
+	for _, rr := range rrs {
+		if dns.IsSubDomain(rr.Name.DomainName, rule.Name) {
+			matched = append(matched, rr)
+		} else {
+			others = append(others, rr)
+		}
+	}
+	if rule.StripRRSIG {
+		matched = matched.RemoveRRSIGs()
+	}
+	if len(rule.RemoveTypes) > 0 {
+		matched = matched.RemoveByType(rule.RemoveTypes...)
+	}
+	for i, rr := range matched {
+		if rule.MaxTTL > 0 && rr.TTL > rule.MaxTTL {
+			matched[i].TTL = rule.MaxTTL
+		}
+		switch {
+		case rr.Type == dns.DNSRRTypeA && rule.ReplaceA != nil:
+			rdata := &dns.DNSRDATAA{Address: rule.ReplaceA}
+			matched[i].RData, matched[i].RDLen = rdata, uint16(rdata.Size())
+		case rr.Type == dns.DNSRRTypeAAAA && rule.ReplaceAAAA != nil:
+			rdata := &dns.DNSRDATAAAAA{Address: rule.ReplaceAAAA}
+			matched[i].RData, matched[i].RDLen = rdata, uint16(rdata.Size())
+		}
+	}
+	return append(append(others, matched...), rule.Add...)
+}
+
+// SecondaryConfig 记录次级区域的配置
+type SecondaryConfig struct {
+	// 区域名称
+	Zone string
+	// 主服务器地址，形如 "10.0.0.1:53"
+	Primary string
+	// 区域数据的存储，为 nil 时使用 store.MemoryStore，每次传送后其内容被整体替换
+	Store store.ZoneStore
+	// 变异规则，按顺序应用于每次传送所得的区域数据
+	Rules []SecondaryRule
+	// SOA 查询的间隔，0 表示使用 SOA 的 REFRESH 字段
+	Refresh time.Duration
+	// 查询或传送失败后的重试间隔，0 表示使用 SOA 的 RETRY 字段，尚未取得区域时为 10 秒
+	Retry time.Duration
+	// 是否总是使用 AXFR，不尝试 IXFR
+	DisableIXFR bool
+	// 单次查询的超时时间，0 表示 5 秒
+	Timeout time.Duration
+	// 出站查询引擎，用于 SOA 查询，为 nil 时每次查询新建套接字；区域传送总是经由 TCP
+	Engine *client.Engine
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// SecondaryZone 次级区域：从主服务器传送区域数据，按变异规则修改后回复查询。
+// 其本身是一个回复器，回复区域内的查询及主服务器的 NOTIFY；
+// 如同 cmd/xdnsd 的区域回复器，其不处理委派及通配符。
+type SecondaryZone struct {
+	Config          SecondaryConfig
+	Name            string
+	Store           store.ZoneStore
+	SecondaryLogger *log.Logger
+
+	client *client.Client
+	// 序列化 SOA 查询及区域传送
+	xfrMu sync.Mutex
+
+	// 未经变异的 SOA 记录及其余记录，用于应用 IXFR，尚未取得区域时 soa 为 nil
+	mu      sync.RWMutex
+	soa     *dns.DNSResourceRecord
+	records []dns.DNSResourceRecord
+	// 区域中存在的名称，用于区分 NXDOMAIN 与 NODATA
+	names map[string]bool
+
+	notify   chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSecondaryZone 根据配置创建一个新的次级区域，需调用 Start 开始从主服务器取得区域数据
+func NewSecondaryZone(conf SecondaryConfig) *SecondaryZone {
+	if conf.Store == nil {
+		conf.Store = store.NewMemoryStore()
+	}
+	return &SecondaryZone{
+		Config:          conf,
+		Name:            strings.TrimSuffix(strings.ToLower(conf.Zone), "."),
+		Store:           conf.Store,
+		SecondaryLogger: log.New(conf.LogWriter, "Secondary: ", log.LstdFlags),
+		client: client.NewClient(client.ClientConfig{
+			Server:  conf.Primary,
+			Timeout: conf.Timeout,
+			Engine:  conf.Engine,
+		}),
+		names:  map[string]bool{},
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Serial 返回当前区域数据的序列号
+// 返回值为：
+//   - uint32，序列号
+//   - bool，尚未取得区域数据时返回 false
+func (z *SecondaryZone) Serial() (uint32, bool) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.soa == nil {
+		return 0, false
+	}
+	return z.soa.RData.(*dns.DNSRDATASOA).Serial, true
+}
+
+// serialNewer 按 RFC 1982 的序列号算术检查序列号 a 是否比 b 新
+func serialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// Refresh 立即向主服务器查询 SOA 记录，序列号更新或尚未取得区域数据时传送区域
+// 返回值为：
+//   - bool，区域数据是否被更新
+//   - error，查询或传送失败时返回错误
+func (z *SecondaryZone) Refresh() (bool, error) {
+	z.xfrMu.Lock()
+	defer z.xfrMu.Unlock()
+
+	current, loaded := z.Serial()
+	if loaded {
+		resp, err := z.client.Query(z.Name, dns.DNSRRTypeSOA)
+		if err != nil {
+			return false, fmt.Errorf("method SecondaryZone Refresh failed: %v", err)
+		}
+		var soa *dns.DNSRDATASOA
+		for _, rr := range resp.Answer {
+			if rdata, ok := rr.RData.(*dns.DNSRDATASOA); ok {
+				soa = rdata
+				break
+			}
+		}
+		if soa == nil {
+			return false, fmt.Errorf("method SecondaryZone Refresh failed: primary returned no SOA, rcode %s", resp.Header.RCode)
+		}
+		if !serialNewer(soa.Serial, current) {
+			return false, nil
+		}
+	}
+	if err := z.transfer(); err != nil {
+		return false, fmt.Errorf("method SecondaryZone Refresh failed: %v", err)
+	}
+	serial, _ := z.Serial()
+	z.SecondaryLogger.Printf("Transferred zone %s serial %d from %s.", z.Name, serial, z.Config.Primary)
+	return true, nil
+}
+
+// transfer 从主服务器传送区域，已有区域数据时优先使用 IXFR
+func (z *SecondaryZone) transfer() error {
+	z.mu.RLock()
+	soa, records := z.soa, z.records
+	z.mu.RUnlock()
+
+	var rrs []dns.DNSResourceRecord
+	var err error
+	incremental := soa != nil && !z.Config.DisableIXFR
+	if incremental {
+		// 主服务器不支持 IXFR 时改用 AXFR
+		if rrs, err = z.client.IXFR(z.Name, *soa); err != nil {
+			z.SecondaryLogger.Printf("IXFR of zone %s failed, falling back to AXFR: %v", z.Name, err)
+			incremental = false
+		}
+	}
+	if !incremental {
+		if rrs, err = z.client.AXFR(z.Name); err != nil {
+			return err
+		}
+	}
+
+	newSOA := rrs[0]
+	switch {
+	case len(rrs) == 1:
+		// 区域已是最新
+		return nil
+	case incremental && rrs[1].Type == dns.DNSRRTypeSOA && len(rrs) > 2:
+		records, err = applyIXFR(records, rrs)
+		if err != nil {
+			return err
+		}
+	default:
+		records = append([]dns.DNSResourceRecord{}, rrs[1:len(rrs)-1]...)
+	}
+	return z.load(newSOA, records)
+}
+
+// applyIXFR 将增量区域传送中的各次变更依次应用于区域数据（不含 SOA 记录）
+func applyIXFR(records, rrs []dns.DNSResourceRecord) ([]dns.DNSResourceRecord, error) {
+	body := rrs[1 : len(rrs)-1]
+	if len(body) == 0 || body[0].Type != dns.DNSRRTypeSOA {
+		return nil, fmt.Errorf("malformed IXFR response")
+	}
+	records = append([]dns.DNSResourceRecord{}, records...)
+	// 每次变更以旧 SOA 开始删除部分，以新 SOA 开始新增部分
+	deleting := false
+	for _, rr := range body {
+		if rr.Type == dns.DNSRRTypeSOA {
+			deleting = !deleting
+			continue
+		}
+		found := -1
+		for i, existing := range records {
+			if sameRR(existing, rr) {
+				found = i
+				break
+			}
+		}
+		switch {
+		case deleting && found >= 0:
+			records = append(records[:found], records[found+1:]...)
+		case !deleting && found < 0:
+			records = append(records, rr)
+		}
+	}
+	if deleting {
+		return nil, fmt.Errorf("malformed IXFR response")
+	}
+	return records, nil
+}
+
+// load 对区域数据应用变异规则，并以其替换存储中的全部数据
+func (z *SecondaryZone) load(soa dns.DNSResourceRecord, records []dns.DNSResourceRecord) error {
+	section := append(dns.DNSResponseSection{soa}, records...)
+	for _, rule := range z.Config.Rules {
+		section = rule.apply(section)
+	}
+
+	type rrSetKey struct {
+		name   string
+		rrType dns.DNSType
+	}
+	order := []rrSetKey{}
+	rrSets := map[rrSetKey][]dns.DNSResourceRecord{}
+	names := map[string]bool{}
+	for _, rr := range section {
+		k := rrSetKey{strings.TrimSuffix(strings.ToLower(rr.Name.DomainName), "."), rr.Type}
+		if _, ok := rrSets[k]; !ok {
+			order = append(order, k)
+		}
+		rrSets[k] = append(rrSets[k], rr)
+		names[k.name] = true
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	stale := []rrSetKey{}
+	err := z.Store.Iterate(func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool {
+		stale = append(stale, rrSetKey{name, rrType})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := z.Store.DeleteRRSet(k.name, k.rrType); err != nil {
+			return err
+		}
+	}
+	for _, k := range order {
+		if err := z.Store.PutRRSet(k.name, k.rrType, rrSets[k]); err != nil {
+			return err
+		}
+	}
+	z.soa, z.records, z.names = &soa, records, names
+	return nil
+}
+
+// Start 启动刷新协程：立即取得区域数据，之后按 SOA 的刷新间隔或收到 NOTIFY 时检查序列号
+func (z *SecondaryZone) Start() {
+	go func() {
+		for {
+			wait := z.Config.Refresh
+			if _, err := z.Refresh(); err != nil {
+				z.SecondaryLogger.Printf("Error refreshing zone %s: %v", z.Name, err)
+				wait = z.Config.Retry
+				if wait == 0 {
+					wait = z.soaInterval(func(soa *dns.DNSRDATASOA) uint32 { return soa.Retry })
+				}
+			} else if wait == 0 {
+				wait = z.soaInterval(func(soa *dns.DNSRDATASOA) uint32 { return soa.Refresh })
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-z.notify:
+				timer.Stop()
+			case <-z.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// soaInterval 返回当前 SOA 记录中的时间间隔字段，尚未取得区域数据或字段为 0 时返回 10 秒
+func (z *SecondaryZone) soaInterval(field func(soa *dns.DNSRDATASOA) uint32) time.Duration {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.soa != nil {
+		if seconds := field(z.soa.RData.(*dns.DNSRDATASOA)); seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return 10 * time.Second
+}
+
+// Stop 停止刷新协程
+func (z *SecondaryZone) Stop() {
+	z.stopOnce.Do(func() { close(z.stop) })
+}
+
+// Close 停止刷新协程并关闭存储
+func (z *SecondaryZone) Close() error {
+	z.Stop()
+	return z.Store.Close()
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+// 对于区域的 NOTIFY，回复确认并立即检查序列号；尚未取得区域数据时回复 SERVFAIL。
+func (z *SecondaryZone) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+	resp := InitNXDOMAIN(qry)
+	if len(qry.Question) == 0 {
+		resp.Header.RCode = dns.DNSResponseCodeFormErr
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+	qName := strings.TrimSuffix(strings.ToLower(qry.Question[0].Name.DomainName), ".")
+	qType := qry.Question[0].Type
+
+	if qry.Header.OpCode == dns.DNSOpCodeNotify {
+		resp.Header.OpCode = dns.DNSOpCodeNotify
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		if qName == z.Name {
+			resp.Header.RCode = dns.DNSResponseCodeNoErr
+			z.SecondaryLogger.Printf("Received NOTIFY for zone %s from %v.", z.Name, connInfo.Address)
+			select {
+			case z.notify <- struct{}{}:
+			default:
+			}
+		}
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if z.soa == nil {
+		resp.Header.RCode = dns.DNSResponseCodeServFail
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	dnssec := false
+	if opt, ok := qry.OPT(); ok {
+		dnssec = opt.DO
+	}
+	// withSigs 在查询设置了 DO 标志时为 RRset 附加覆盖其类型的 RRSIG 记录
+	withSigs := func(name string, rrSet []dns.DNSResourceRecord) ([]dns.DNSResourceRecord, error) {
+		if !dnssec || len(rrSet) == 0 {
+			return rrSet, nil
+		}
+		sigs, err := z.Store.GetRRSet(name, dns.DNSRRTypeRRSIG)
+		if err != nil {
+			return nil, err
+		}
+		return append(rrSet, dns.DNSResponseSection(sigs).FilterByType(rrSet[0].Type)...), nil
+	}
+
+	if z.names[qName] {
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+		rrSet, err := z.Store.GetRRSet(qName, qType)
+		if err != nil {
+			return []byte{}, err
+		}
+		if len(rrSet) == 0 && qType != dns.DNSRRTypeCNAME {
+			rrSet, err = z.Store.GetRRSet(qName, dns.DNSRRTypeCNAME)
+			if err != nil {
+				return []byte{}, err
+			}
+		}
+		if resp.Answer, err = withSigs(qName, rrSet); err != nil {
+			return []byte{}, err
+		}
+	}
+	if len(resp.Answer) == 0 {
+		soa, err := z.Store.GetRRSet(z.Name, dns.DNSRRTypeSOA)
+		if err != nil {
+			return []byte{}, err
+		}
+		if resp.Authority, err = withSigs(z.Name, soa); err != nil {
+			return []byte{}, err
+		}
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// selector.go 文件定义了 AnswerSelector 回答选择器，
+// 其会根据客户端所在子网、轮询或加权策略，从预先配置的地址集合中挑选 A/AAAA 回答，
+// 用以模拟 CDN 式的权威服务器行为，研究解析器对不同回答的缓存方式。
+
+package xdns
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// SelectPolicy 表示回答选择策略
+type SelectPolicy int
+
+const (
+	// SelectPolicyAll 返回全部地址
+	SelectPolicyAll SelectPolicy = iota
+	// SelectPolicyRoundRobin 在查询之间轮询地址
+	SelectPolicyRoundRobin
+	// SelectPolicyWeighted 根据权重随机挑选地址
+	SelectPolicyWeighted
+	// SelectPolicySubnet 根据客户端所在子网挑选地址，未匹配时回退至加权策略
+	SelectPolicySubnet
+)
+
+// WeightedAddress 表示一个带权重的回答地址
+type WeightedAddress struct {
+	Address net.IP
+	// 权重，小于等于 0 时视为 1
+	Weight int
+}
+
+// SubnetAnswer 表示客户端子网与回答地址的映射
+type SubnetAnswer struct {
+	Subnet    *net.IPNet
+	Addresses []net.IP
+}
+
+// AnswerSelectorConfig 记录回答选择器的配置
+type AnswerSelectorConfig struct {
+	// 选择策略
+	Policy SelectPolicy
+	// 地址池，A 及 AAAA 地址可混合配置，选择时会根据查询类型进行过滤
+	Addresses []WeightedAddress
+	// 客户端子网映射，仅在 SelectPolicySubnet 策略下生效，按顺序匹配
+	SubnetMap []SubnetAnswer
+	// 每次回答的地址数量，0 表示一个
+	AnswerNum int
+	// 回答记录的 TTL
+	TTL uint32
+}
+
+// AnswerSelector 回答选择器：根据策略为查询挑选 A/AAAA 回答。
+type AnswerSelector struct {
+	Config AnswerSelectorConfig
+
+	// 轮询计数器
+	counter uint64
+}
+
+// NewAnswerSelector 根据配置创建一个新的回答选择器
+func NewAnswerSelector(conf AnswerSelectorConfig) *AnswerSelector {
+	if conf.AnswerNum <= 0 {
+		conf.AnswerNum = 1
+	}
+	return &AnswerSelector{
+		Config: conf,
+	}
+}
+
+// filterFamily 从地址池中筛选出与查询类型对应地址族的地址
+func filterFamily(pool []WeightedAddress, qType dns.DNSType) []WeightedAddress {
+	filtered := []WeightedAddress{}
+	for _, wAddr := range pool {
+		isV4 := wAddr.Address.To4() != nil
+		if (qType == dns.DNSRRTypeA && isV4) || (qType == dns.DNSRRTypeAAAA && !isV4) {
+			filtered = append(filtered, wAddr)
+		}
+	}
+	return filtered
+}
+
+// Select 根据链接信息及查询类型挑选回答地址
+// 其接受参数为：
+//   - connInfo ConnectionInfo，链接信息
+//   - qType dns.DNSType，查询类型（A 或 AAAA）
+//
+// 返回值为：
+//   - []net.IP，挑选出的地址，无可用地址时返回空切片
+func (s *AnswerSelector) Select(connInfo ConnectionInfo, qType dns.DNSType) []net.IP {
+	pool := s.Config.Addresses
+
+	if s.Config.Policy == SelectPolicySubnet {
+		clientIP := connInfo.ClientIP()
+		for _, sa := range s.Config.SubnetMap {
+			if clientIP != nil && sa.Subnet.Contains(clientIP) {
+				pool = make([]WeightedAddress, 0, len(sa.Addresses))
+				for _, addr := range sa.Addresses {
+					pool = append(pool, WeightedAddress{Address: addr, Weight: 1})
+				}
+				break
+			}
+		}
+	}
+
+	pool = filterFamily(pool, qType)
+	if len(pool) == 0 {
+		return []net.IP{}
+	}
+
+	num := s.Config.AnswerNum
+	if num > len(pool) {
+		num = len(pool)
+	}
+
+	result := make([]net.IP, 0, num)
+	switch s.Config.Policy {
+	case SelectPolicyAll:
+		for _, wAddr := range pool {
+			result = append(result, wAddr.Address)
+		}
+	case SelectPolicyRoundRobin:
+		start := int(atomic.AddUint64(&s.counter, 1)-1) % len(pool)
+		for i := 0; i < num; i++ {
+			result = append(result, pool[(start+i)%len(pool)].Address)
+		}
+	default:
+		// 加权随机，不放回地挑选 num 个地址
+		remain := append([]WeightedAddress{}, pool...)
+		for i := 0; i < num; i++ {
+			total := 0
+			for _, wAddr := range remain {
+				total += weightOf(wAddr)
+			}
+			pick := xperi.RandomIntn(total)
+			for j, wAddr := range remain {
+				pick -= weightOf(wAddr)
+				if pick < 0 {
+					result = append(result, wAddr.Address)
+					remain = append(remain[:j], remain[j+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+func weightOf(wAddr WeightedAddress) int {
+	if wAddr.Weight <= 0 {
+		return 1
+	}
+	return wAddr.Weight
+}
+
+// Records 根据链接信息为指定名称生成 A/AAAA 回答记录
+// 其接受参数为：
+//   - connInfo ConnectionInfo，链接信息
+//   - qName string，查询名称
+//   - qType dns.DNSType，查询类型（A 或 AAAA）
+//
+// 返回值为：
+//   - []dns.DNSResourceRecord，回答记录
+func (s *AnswerSelector) Records(connInfo ConnectionInfo, qName string, qType dns.DNSType) []dns.DNSResourceRecord {
+	rrs := []dns.DNSResourceRecord{}
+	for _, addr := range s.Select(connInfo, qType) {
+		var rdata dns.DNSRRRDATA
+		if qType == dns.DNSRRTypeA {
+			rdata = &dns.DNSRDATAA{Address: addr}
+		} else {
+			rdata = &dns.DNSRDATAAAAA{Address: addr}
+		}
+		rrs = append(rrs, dns.DNSResourceRecord{
+			Name:  *dns.NewDNSName(qName),
+			Type:  qType,
+			Class: dns.DNSClassIN,
+			TTL:   s.Config.TTL,
+			RDLen: 0,
+			RData: rdata,
+		})
+	}
+	return rrs
+}
+
+// SelectorResponser 是一个使用 AnswerSelector 生成 A/AAAA 回答的回复器实现。
+// 任意名称均被视为存在，其他类型的查询将得到回答部分为空的 NOERROR（NODATA）回复。
+type SelectorResponser struct {
+	Selector *AnswerSelector
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *SelectorResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	resp := InitNXDOMAIN(qry)
+
+	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+
+	resp.Header.RCode = dns.DNSResponseCodeNoErr
+	if qType == dns.DNSRRTypeA || qType == dns.DNSRRTypeAAAA {
+		resp.Answer = r.Selector.Records(connInfo, qName, qType)
+	}
+
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// selector_test.go 文件用于对回答选择器进行测试。
+
+package xdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 测试 SelectorResponser 的回复
+func TestSelectorResponser(t *testing.T) {
+	r := &SelectorResponser{Selector: NewAnswerSelector(AnswerSelectorConfig{
+		Addresses: []WeightedAddress{{Address: net.IPv4(10, 0, 0, 1)}, {Address: net.ParseIP("2001:db8::1")}},
+		TTL:       60,
+	})}
+	tests := []struct {
+		qType   dns.DNSType
+		answers int
+	}{
+		{dns.DNSRRTypeA, 1},
+		{dns.DNSRRTypeAAAA, 1},
+		// 名称存在，其他类型为 NODATA
+		{dns.DNSRRTypeMX, 0},
+		{dns.DNSRRTypeTXT, 0},
+	}
+	for _, tt := range tests {
+		resp, err := r.Response(newTestQuery("www.test", tt.qType, 0))
+		if err != nil {
+			t.Fatalf("method SelectorResponser Response() failed:\n%v", err)
+		}
+		msg := dns.DNSMessage{}
+		if _, err := msg.DecodeFromBuffer(resp, 0); err != nil {
+			t.Fatalf("method DNSMessage DecodeFromBuffer() failed:\n%v", err)
+		}
+		if msg.Header.RCode != dns.DNSResponseCodeNoErr || len(msg.Answer) != tt.answers {
+			t.Errorf("method SelectorResponser Response(%s) failed:\ngot: %s with %d answers\nexpected: %s with %d answers",
+				tt.qType, msg.Header.RCode, len(msg.Answer), dns.DNSResponseCodeNoErr, tt.answers)
+		}
+		for _, rr := range msg.Answer {
+			if rr.Type != tt.qType {
+				t.Errorf("method SelectorResponser Response(%s) failed: got %s answer", tt.qType, rr.Type)
+			}
+		}
+	}
+}
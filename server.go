@@ -8,9 +8,17 @@
 package xdns
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
 )
 
 // XdnsServer 表示 xdns 服务器
@@ -26,18 +34,39 @@ type XdnsServer struct {
 	Netter   Netter
 	Cacher   Cacher
 	Responer Responser
+
+	// 服务器的根上下文，Stop 时被取消，每个查询的上下文均派生自它
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 诊断服务，未启用时为 nil
+	diagnostics *http.Server
 }
 
 // NewXdnsServer 创建一个新的 xdns 服务器实例
 // 该函数接受一个 ServerConfig 和一个 Responser 实例作为参数，
 // 并返回一个新的 XdnsServer 实例。
-// 该函数会初始化一个新的日志记录器、数据包嗅探器和缓存器。
+// 该函数会校验配置并填充默认值，配置不合法时将 panic，
+// 之后初始化一个新的日志记录器、数据包嗅探器和缓存器。
 func NewXdnsServer(serverConf ServerConfig, responser Responser) *XdnsServer {
+	if err := serverConf.Validate(); err != nil {
+		log.Panicf("xdns: %v", err)
+	}
 	Logger := log.New(serverConf.LogWriter, "xdns: ", log.LstdFlags)
 
 	netter := NewNetter(NetterConfig{
 		Port:      serverConf.Port,
 		LogWriter: serverConf.LogWriter,
+
+		EnableProxyProtocol: serverConf.EnableProxyProtocol,
+		Timing:              serverConf.Timing,
+
+		EnforcePayloadSize: serverConf.EnforcePayloadSize,
+		StreamFraming:      serverConf.StreamFraming,
+		ReceiveAncillary:   serverConf.ReceiveAncillary,
+
+		SocketActivation: serverConf.SocketActivation,
+		User:             serverConf.User,
+		Group:            serverConf.Group,
 	})
 
 	cacher := NewCacher(CacherConfig{
@@ -45,6 +74,7 @@ func NewXdnsServer(serverConf ServerConfig, responser Responser) *XdnsServer {
 		LogWriter:     serverConf.LogWriter,
 	})
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &XdnsServer{
 		Config: serverConf,
 		Logger: Logger,
@@ -52,37 +82,128 @@ func NewXdnsServer(serverConf ServerConfig, responser Responser) *XdnsServer {
 		Netter:   *netter,
 		Cacher:   *cacher,
 		Responer: responser,
+
+		ctx:    ctx,
+		cancel: cancel,
 	}
 }
 
 // HandleConnection 处理连接信息
 // 该函数接受一个 ConnectionInfo 实例作为参数，
 // 并根据该连接的信息回复 DNS 响应。
+// 回复器将收到携带追踪 ID 及客户端指纹的请求上下文，
+// 若设置了 ResponseTimeout，则回复超时时回复 SERVFAIL。
 func (s *XdnsServer) HandleConnection(connInfo ConnectionInfo) {
+	serverVars.Add("queries", 1)
+	ctx := WithOverrunOverride(WithOversizeOverride(NewConnectionContext(s.ctx, connInfo)))
+	if s.Config.Tracer != nil {
+		ctx = WithTracer(ctx, s.Config.Tracer)
+	}
+	ctx, span := StartSpan(ctx, "xdns.query", SpanKindServer)
+	defer span.Finish()
+	if span != nil {
+		// 根 span 自收到查询时开始
+		if !connInfo.ReceiveTime.IsZero() {
+			span.Start = connInfo.ReceiveTime
+		}
+		span.SetAttribute("network.transport", string(connInfo.Protocol))
+		span.SetAttribute("client.address", connInfo.ClientIP().String())
+		if fingerprint, ok := ClientFingerprintFromContext(ctx); ok {
+			span.SetAttribute("dns.client.fingerprint", fingerprint)
+		}
+		s.traceDecode(ctx, span, connInfo)
+	}
+
 	// 从缓存中查找响应
 	if s.Config.EnableCache {
 		cache, err := s.Cacher.FetchCache(connInfo)
 		if err == nil {
-			s.Netter.Send(connInfo, cache)
+			span.SetAttribute("dns.cache.hit", true)
+			s.send(ctx, connInfo, cache)
 			return
 		}
 	}
 
-	// 如果缓存未命中，则生成响应
-	resp, err := s.Responer.Response(connInfo)
+	// 如果缓存未命中，则生成响应。
+	// 回复器经 EncodeResponse 借用的缓冲区在回复发送并写入缓存后归还，
+	// 回复器返回错误时，其仍可能被未结束的协程引用，不予归还，见 encodepool.go
+	ctx, releaseBuffers := withEncodeBuffers(ctx)
+	reuseBuffers := false
+	defer func() { releaseBuffers(reuseBuffers) }()
+	if s.Config.ResponseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Config.ResponseTimeout)
+		defer cancel()
+	}
+	if s.Config.ResponseMemoryLimit > 0 {
+		ctx = WithMemoryBudget(ctx, NewMemoryBudget(s.Config.ResponseMemoryLimit))
+	}
+	rCtx, rSpan := StartSpan(ctx, "respond", SpanKindInternal)
+	var resp []byte
+	var err error
+	var cost ResponseCost
+	if s.Config.CostAccounting {
+		resp, cost, err = respondMetered(rCtx, s.Responer, connInfo)
+		rSpan.SetAttribute("xdns.cost.signatures", cost.Signatures)
+		rSpan.SetAttribute("xdns.cost.hash_ops", cost.Hashes)
+		rSpan.SetAttribute("xdns.cost.cpu_us", cost.CPU.Microseconds())
+	} else {
+		resp, err = Respond(rCtx, s.Responer, connInfo)
+	}
+	rSpan.SetError(err)
+	rSpan.Finish()
+	reuseBuffers = err == nil
+	if errors.Is(err, ErrDropResponse) {
+		// 回复器有意不作回复，如 OutageResponser 模拟的停服
+		span.SetAttribute("dns.dropped", true)
+		serverVars.Add("dropped", 1)
+		return
+	}
 	if err != nil {
-		s.Logger.Printf("Error generating response: %v", err)
+		span.SetError(err)
+		traceID, _ := TraceIDFromContext(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			serverVars.Add("timeouts", 1)
+			s.Logger.Printf("Response to %s timed out (trace %s), replying SERVFAIL.", connInfo.Address, traceID)
+			s.send(ctx, connInfo, InitServFailResponse(connInfo.Packet))
+			return
+		}
+		if errors.Is(err, ErrMemoryBudgetExceeded) {
+			serverVars.Add("budget_exceeded", 1)
+			s.Logger.Printf("Response to %s aborted (trace %s): %v, replying SERVFAIL.", connInfo.Address, traceID, err)
+			s.send(ctx, connInfo, InitServFailResponse(connInfo.Packet))
+			return
+		}
+		serverVars.Add("errors", 1)
+		s.Logger.Printf("Error generating response (trace %s): %v", traceID, err)
 		return
 	}
 
+	// 检查回复大小的上限，有意超出上限的回复除外
+	if s.Config.ResponseLimits.Enabled() && !OverrunAllowed(ctx) {
+		if err := s.Config.ResponseLimits.Check(resp); err != nil {
+			span.SetError(err)
+			traceID, _ := TraceIDFromContext(ctx)
+			serverVars.Add("limit_exceeded", 1)
+			s.Logger.Printf("Response to %s discarded (trace %s): %v, replying SERVFAIL.", connInfo.Address, traceID, err)
+			s.send(ctx, connInfo, InitServFailResponse(connInfo.Packet))
+			return
+		}
+	}
+	if s.Config.CostDebugTXT {
+		resp = appendCostRecord(resp, cost)
+	}
+
 	// 如果启用 TCP 且响应长度超过阈值，则截断响应
 	if s.Config.EnableTCP && len(resp) > s.Config.TCPThreshold && connInfo.Protocol != "tcp" {
 		resp = InitTruncatedResponse(connInfo.Packet)
+		span.SetAttribute("dns.truncated", true)
+		serverVars.Add("truncated", 1)
 		s.Logger.Printf("Truncated response to: %s, length: %d.", connInfo.Address, len(resp))
 	}
 
 	// 发送响应
-	s.Netter.Send(connInfo, resp)
+	s.send(ctx, connInfo, resp)
 
 	// 如果启用缓存，则将响应存储到缓存中
 	if s.Config.EnableCache {
@@ -90,33 +211,210 @@ func (s *XdnsServer) HandleConnection(connInfo ConnectionInfo) {
 	}
 }
 
+// traceDecode 在 "decode" span 中解析查询，并将查询名称及类型记录至根 span
+func (s *XdnsServer) traceDecode(ctx context.Context, span *Span, connInfo ConnectionInfo) {
+	_, dSpan := StartSpan(ctx, "decode", SpanKindInternal)
+	defer dSpan.Finish()
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		dSpan.SetError(err)
+		return
+	}
+	if len(qry.Question) > 0 {
+		span.SetAttribute("dns.qname", qry.Question[0].Name.DomainName)
+		span.SetAttribute("dns.qtype", qry.Question[0].Type.String())
+	}
+}
+
+// send 在 "send" span 中发送回复，并将回复码及回复大小记录至根 span
+func (s *XdnsServer) send(ctx context.Context, connInfo ConnectionInfo, resp []byte) {
+	if span := SpanFromContext(ctx); span != nil {
+		if len(resp) >= 4 {
+			span.SetAttribute("dns.rcode", dns.DNSResponseCode(resp[3]&0x0F).String())
+		}
+		span.SetAttribute("dns.response.size", len(resp))
+	}
+	connInfo.AllowOversize = connInfo.AllowOversize || OversizeAllowed(ctx)
+	_, sSpan := StartSpan(ctx, "send", SpanKindInternal)
+	s.Netter.Send(connInfo, resp)
+	sSpan.Finish()
+}
+
 // Start 启动 xdns 服务器
 func (s *XdnsServer) Start() {
 	// xdns 启动！
 
 	s.Logger.Printf("xdns Starts!")
 
+	if s.Config.DiagnosticsAddr != "" {
+		s.startDiagnostics()
+	}
+
 	connChan := s.Netter.Sniff()
-	for connInfo := range connChan {
-		go s.HandleConnection(connInfo)
+	for {
+		select {
+		case connInfo := <-connChan:
+			go s.HandleConnection(connInfo)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop 停止 xdns 服务器
+// Start 将返回，正在生成的回复的上下文将被取消，诊断服务将被关闭。
+func (s *XdnsServer) Stop() {
+	s.cancel()
+	if s.diagnostics != nil {
+		s.diagnostics.Close()
 	}
 }
 
 // ServerConfig 记录 DNS 服务器的相关配置。
+// 零值字段将在 Validate 中被填充为默认值，因此只需设置关心的字段。
 type ServerConfig struct {
-	// DNS 服务器的 IP 地址
+	// DNS 服务器的 IP 地址，部分回复器使用其作为 A 记录的地址
 	IP net.IP
-	// DNS 服务器的端口
+	// DNS 服务器的端口，默认为 53
 	Port int
 
-	// 日志输出
+	// 日志输出，默认为标准输出
 	LogWriter io.Writer
 
-	// 缓存功能
+	// 缓存功能：启用后相同的查询将直接使用缓存的回复，
+	// 缓存文件位于 CacheLocation，默认为 "./cache"
 	EnableCache   bool
 	CacheLocation string
 
-	// TCP 传输
+	// TCP 传输：启用后长度超过 TCPThreshold 的 UDP 回复将被截断（TC=1），
+	// 使客户端经由 TCP 重试，TCPThreshold 默认为 1232
 	EnableTCP    bool
 	TCPThreshold int
+
+	// 载荷大小协商：启用后长度超过客户端通告的 EDNS UDP 载荷大小（无 OPT 时为 512）的
+	// UDP 回复将被截断，回复器可通过 AllowOversize 豁免单个回复，
+	// 各客户端的截断次数记录于 Netter.Truncations，详见 payload.go
+	EnforcePayloadSize bool
+
+	// 流式分帧篡改：不为 nil 时，TCP 回复将被拆分为小分段并按间隔发送，
+	// 或在长度前缀前后插入垃圾字节，详见 stream.go
+	StreamFraming *StreamFraming
+
+	// 辅助信息：启用后记录查询的接收接口、目的地址及 TTL 于 ConnectionInfo.Ancillary，
+	// UDP 回复以查询的目的地址作为源地址发出，详见 ancillary.go
+	ReceiveAncillary bool
+
+	// PROXY 协议：部署于负载均衡器之后时，
+	// 从 TCP 链接头部中解析真实的客户端地址
+	EnableProxyProtocol bool
+
+	// 回复超时：不为 0 时，回复器需在该时长内生成回复，否则回复 SERVFAIL
+	ResponseTimeout time.Duration
+
+	// 内存预算：不为 0 时，单个回复的构造过程至多计入该字节数，超出时回复 SERVFAIL，
+	// 预算是协作式的，仅对调用 ChargeMemory / ChargeRecords 的回复器生效，详见 budget.go
+	ResponseMemoryLimit int64
+
+	// 回复上限：设置后回复器生成的回复中各部分的记录数或回复长度超出上限时回复 SERVFAIL，
+	// 回复器可通过 AllowOverrun 豁免单个回复，详见 limits.go
+	ResponseLimits ResponseLimits
+
+	// 开销计量：启用后测量每个回复消耗的 CPU 时间及签名、摘要操作的次数，
+	// 累计于 /debug/vars 的 "xdns" 变量，计量是协作式的，详见 cost.go
+	CostAccounting bool
+	// 启用开销计量时，将每个回复的开销以所有者名称为 "debug" 的 TXT 记录附加于其附加部分
+	CostDebugTXT bool
+
+	// 时间测量：不为 nil 时记录每次查询的纳秒级收发时间戳
+	Timing *TimingRecorder
+
+	// 追踪：不为 nil 时为每个查询记录追踪 span 并导出至 OTLP 收集器
+	Tracer *Tracer
+
+	// 诊断服务：不为空时在该地址上提供 pprof、expvar、协程调用栈及健康检查端点，
+	// 如 "127.0.0.1:6060"，详见 diagnostics.go
+	DiagnosticsAddr string
+
+	// systemd 套接字激活：使用 systemd 传入的已绑定套接字
+	SocketActivation bool
+	// 降低权限：绑定端口后切换至指定的用户及用户组
+	User  string
+	Group string
+
+	// Deprecated: 拼写错误的旧字段，请使用 EnableCache，将在下一版本中移除。
+	EnebleCache bool
+	// Deprecated: 旧字段，请使用 TCPThreshold，将在下一版本中移除。
+	PoolCapcity int
+	// Deprecated: Netter 不再使用 MTU，该字段不起作用，将在下一版本中移除。
+	MTU int
+}
+
+// DNSServerConfig 是 ServerConfig 的旧名称。
+//
+// Deprecated: 请使用 ServerConfig，将在下一版本中移除。
+type DNSServerConfig = ServerConfig
+
+// 服务器配置的默认值
+const (
+	DefaultServerPort    = 53
+	DefaultCacheLocation = "./cache"
+	DefaultTCPThreshold  = 1232
+)
+
+// Validate 检查服务器配置的合法性，将已弃用字段迁移至对应的新字段，
+// 并为未设置的字段填充默认值。NewXdnsServer 会自动调用该方法。
+// 返回值为：
+//   - error，配置不合法时返回错误信息
+func (c *ServerConfig) Validate() error {
+	// 迁移已弃用字段
+	if c.EnebleCache {
+		c.EnableCache = true
+	}
+	if c.TCPThreshold == 0 && c.PoolCapcity > 0 {
+		c.TCPThreshold = c.PoolCapcity
+	}
+
+	// 填充默认值
+	if c.Port == 0 {
+		c.Port = DefaultServerPort
+	}
+	if c.LogWriter == nil {
+		c.LogWriter = os.Stdout
+	}
+	if c.EnableCache && c.CacheLocation == "" {
+		c.CacheLocation = DefaultCacheLocation
+	}
+	if c.TCPThreshold == 0 {
+		c.TCPThreshold = DefaultTCPThreshold
+	}
+
+	// 检查合法性
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("method ServerConfig Validate failed: invalid port %d", c.Port)
+	}
+	// 回复至少包含 12 字节的头部
+	if c.TCPThreshold < 12 || c.TCPThreshold > 65535 {
+		return fmt.Errorf("method ServerConfig Validate failed: invalid TCPThreshold %d", c.TCPThreshold)
+	}
+	if c.ResponseTimeout < 0 {
+		return fmt.Errorf("method ServerConfig Validate failed: invalid ResponseTimeout %v", c.ResponseTimeout)
+	}
+	if c.ResponseMemoryLimit < 0 {
+		return fmt.Errorf("method ServerConfig Validate failed: invalid ResponseMemoryLimit %d", c.ResponseMemoryLimit)
+	}
+	if l := c.ResponseLimits; l.MaxAnswerRRs < 0 || l.MaxAuthorityRRs < 0 || l.MaxAdditionalRRs < 0 || l.MaxResponseBytes < 0 {
+		return fmt.Errorf("method ServerConfig Validate failed: invalid ResponseLimits %+v", l)
+	}
+	if c.CostDebugTXT && !c.CostAccounting {
+		return fmt.Errorf("method ServerConfig Validate failed: CostDebugTXT requires CostAccounting")
+	}
+	if c.StreamFraming != nil {
+		if err := c.StreamFraming.Validate(); err != nil {
+			return fmt.Errorf("method ServerConfig Validate failed: invalid StreamFraming.\n%v", err)
+		}
+	}
+	if c.Group != "" && c.User == "" {
+		return fmt.Errorf("method ServerConfig Validate failed: Group %s is set without User", c.Group)
+	}
+	return nil
 }
@@ -0,0 +1,68 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// shadow.go 文件定义了 ShadowResponser 影子回复器。
+// 其会将每个查询同时交由主回复器与影子回复器处理，比较两者的编码结果，
+// 记录差异后仅返回主回复器的回复。
+// 在将示例中的回复逻辑迁移至库中时，可用其保证新旧实现的回复逐字节一致。
+
+package xdns
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ShadowResponserConfig 记录影子回复器的配置
+type ShadowResponserConfig struct {
+	// 主回复器，其回复将被返回给客户端
+	Primary Responser
+	// 影子回复器，其回复仅用于比较
+	Shadow Responser
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// ShadowResponser 影子回复器：比较两个回复器对同一查询的回复，并返回主回复器的回复。
+type ShadowResponser struct {
+	Primary      Responser
+	Shadow       Responser
+	ShadowLogger *log.Logger
+}
+
+// NewShadowResponser 根据配置创建一个新的影子回复器
+func NewShadowResponser(conf ShadowResponserConfig) *ShadowResponser {
+	shadowLogger := log.New(conf.LogWriter, "Shadow: ", log.LstdFlags)
+	return &ShadowResponser{
+		Primary:      conf.Primary,
+		Shadow:       conf.Shadow,
+		ShadowLogger: shadowLogger,
+	}
+}
+
+// Response 将查询交由两个回复器处理，记录差异，并返回主回复器的回复。
+func (s *ShadowResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return s.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给两个回复器。
+func (s *ShadowResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	primary, pErr := Respond(ctx, s.Primary, connInfo)
+	shadow, sErr := Respond(ctx, s.Shadow, connInfo)
+
+	if (pErr == nil) != (sErr == nil) {
+		s.ShadowLogger.Printf("Error mismatch for query from %s: primary %v, shadow %v", connInfo.Address, pErr, sErr)
+		return primary, pErr
+	}
+	if pErr != nil {
+		return primary, pErr
+	}
+
+	if diffs := dns.DiffBytes(primary, shadow); len(diffs) != 0 {
+		s.ShadowLogger.Printf("Response mismatch for query from %s:\n%s", connInfo.Address, strings.Join(diffs, "\n"))
+	}
+	return primary, pErr
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// sockopt.go 文件定义了 Netter 对 UDP 套接字选项的调整。
+// 不同平台对套接字选项的支持不同，平台相关的部分位于：
+//   - sockopt_windows.go：关闭 SIO_UDP_CONNRESET，避免 ICMP 端口不可达报文中断 UDP 读取；
+//   - sockopt_darwin.go：macOS 的 kern.ipc.maxsockbuf 较小，使用较小的缓冲区上限；
+//   - sockopt_other.go：Linux 等其他平台。
+
+package xdns
+
+import (
+	"net"
+)
+
+// 套接字缓冲区大小的下限，设置失败时缓冲区大小将逐次减半直至该值
+const minSocketBuffer = 65536
+
+// tuneUDPConn 调整 UDP 链接的套接字选项
+// 其接受参数为：
+//   - conn *net.UDPConn，UDP 链接
+//
+// 返回值为：
+//   - int，实际设置的收发缓冲区大小，0 表示保持系统默认值
+//   - error，平台相关选项的设置错误
+func tuneUDPConn(conn *net.UDPConn) (int, error) {
+	size := setSocketBuffers(conn, maxSocketBuffer)
+	return size, tuneUDPConnPlatform(conn)
+}
+
+// setSocketBuffers 设置 UDP 链接的收发缓冲区大小
+// 部分平台（如 macOS）在超出系统上限时会返回错误而非自动截断，
+// 因此设置失败时将缓冲区大小逐次减半后重试。
+func setSocketBuffers(conn *net.UDPConn, size int) int {
+	for ; size >= minSocketBuffer; size /= 2 {
+		if conn.SetReadBuffer(size) == nil && conn.SetWriteBuffer(size) == nil {
+			return size
+		}
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build darwin
+
+package xdns
+
+import (
+	"net"
+)
+
+// 套接字缓冲区大小的上限，macOS 默认的 kern.ipc.maxsockbuf 为 8 MiB，
+// 且其中包含内核的额外开销，超出时 setsockopt 返回 ENOBUFS
+const maxSocketBuffer = 4194304
+
+// tuneUDPConnPlatform 调整平台相关的 UDP 套接字选项
+func tuneUDPConnPlatform(conn *net.UDPConn) error {
+	return nil
+}
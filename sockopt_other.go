@@ -0,0 +1,17 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build !windows && !darwin
+
+package xdns
+
+import (
+	"net"
+)
+
+// 套接字缓冲区大小的上限，Linux 会将其截断至 net.core.rmem_max / wmem_max
+const maxSocketBuffer = 104857600
+
+// tuneUDPConnPlatform 调整平台相关的 UDP 套接字选项
+func tuneUDPConnPlatform(conn *net.UDPConn) error {
+	return nil
+}
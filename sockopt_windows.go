@@ -0,0 +1,43 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+//go:build windows
+
+package xdns
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// 套接字缓冲区大小的上限
+const maxSocketBuffer = 104857600
+
+// SIO_UDP_CONNRESET = _WSAIOW(IOC_VENDOR, 12)
+const sioUDPConnReset = syscall.IOC_IN | syscall.IOC_VENDOR | 12
+
+// tuneUDPConnPlatform 调整平台相关的 UDP 套接字选项
+// Windows 上，向已关闭的客户端端口发送回复后收到的 ICMP 端口不可达报文，
+// 会使之后的 ReadFrom 返回 WSAECONNRESET，因此需关闭 SIO_UDP_CONNRESET。
+func tuneUDPConnPlatform(conn *net.UDPConn) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("function tuneUDPConnPlatform failed: %v", err)
+	}
+	var ioctlErr error
+	err = rawConn.Control(func(fd uintptr) {
+		enable := uint32(0)
+		ret := uint32(0)
+		ioctlErr = syscall.WSAIoctl(syscall.Handle(fd), sioUDPConnReset,
+			(*byte)(unsafe.Pointer(&enable)), uint32(unsafe.Sizeof(enable)),
+			nil, 0, &ret, nil, 0)
+	})
+	if err == nil {
+		err = ioctlErr
+	}
+	if err != nil {
+		return fmt.Errorf("function tuneUDPConnPlatform failed: disable SIO_UDP_CONNRESET failed.\n%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// stats.go 文件定义了服务器统计信息的收集与持久化。
+// StatsResponser 会统计经过的每个查询（查询类型、客户端、查询名称、回复码），
+// StatsSnapshotter 则周期性地将统计快照以 JSON 格式写入磁盘并进行轮转，
+// 使得无人值守的长时间测量即使进程被终止也能保留数据。
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// Statistics 服务器统计信息
+type Statistics struct {
+	since   time.Time
+	total   uint64
+	qTypes  map[string]uint64
+	rCodes  map[string]uint64
+	clients map[string]struct{}
+	qNames  map[string]uint64
+	mu      sync.Mutex
+}
+
+// NewStatistics 创建一个新的统计信息
+func NewStatistics() *Statistics {
+	return &Statistics{
+		since:   time.Now(),
+		qTypes:  make(map[string]uint64),
+		rCodes:  make(map[string]uint64),
+		clients: make(map[string]struct{}),
+		qNames:  make(map[string]uint64),
+	}
+}
+
+// Record 记录一次查询及其回复码
+func (s *Statistics) Record(clientIP string, qName string, qType dns.DNSType, rCode dns.DNSResponseCode) {
+	qName = dns.CanonicalizeDomainName(&qName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	s.qTypes[qType.String()]++
+	s.rCodes[rCode.String()]++
+	s.clients[clientIP] = struct{}{}
+	s.qNames[qName]++
+}
+
+// QNameCount 表示查询名称及其查询次数
+type QNameCount struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// StatsSnapshot 表示统计信息在某一时刻的快照
+type StatsSnapshot struct {
+	Time          time.Time         `json:"time"`
+	Since         time.Time         `json:"since"`
+	Total         uint64            `json:"total"`
+	QTypes        map[string]uint64 `json:"qtypes"`
+	RCodes        map[string]uint64 `json:"rcodes"`
+	UniqueClients int               `json:"unique_clients"`
+	TopQNames     []QNameCount      `json:"top_qnames"`
+}
+
+// Snapshot 返回统计信息的快照
+// 其接受参数为：
+//   - topN int，快照中保留的查询次数最多的查询名称数量
+//
+// 返回值为：
+//   - StatsSnapshot，统计信息快照
+func (s *Statistics) Snapshot(topN int) StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		Time:          time.Now(),
+		Since:         s.since,
+		Total:         s.total,
+		QTypes:        make(map[string]uint64, len(s.qTypes)),
+		RCodes:        make(map[string]uint64, len(s.rCodes)),
+		UniqueClients: len(s.clients),
+		TopQNames:     make([]QNameCount, 0, len(s.qNames)),
+	}
+	for k, v := range s.qTypes {
+		snapshot.QTypes[k] = v
+	}
+	for k, v := range s.rCodes {
+		snapshot.RCodes[k] = v
+	}
+	for name, count := range s.qNames {
+		snapshot.TopQNames = append(snapshot.TopQNames, QNameCount{Name: name, Count: count})
+	}
+	sort.Slice(snapshot.TopQNames, func(i, j int) bool {
+		if snapshot.TopQNames[i].Count != snapshot.TopQNames[j].Count {
+			return snapshot.TopQNames[i].Count > snapshot.TopQNames[j].Count
+		}
+		return snapshot.TopQNames[i].Name < snapshot.TopQNames[j].Name
+	})
+	if topN >= 0 && len(snapshot.TopQNames) > topN {
+		snapshot.TopQNames = snapshot.TopQNames[:topN]
+	}
+	return snapshot
+}
+
+// StatsResponser 统计回复器：包装一个回复器，并统计经过的每个查询。
+type StatsResponser struct {
+	Responser Responser
+	Stats     *Statistics
+}
+
+// Response 生成被包装回复器的回复，并记录查询及回复码。
+func (r *StatsResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return r.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (r *StatsResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	resp, err := Respond(ctx, r.Responser, connInfo)
+
+	qry, qErr := ParseQuery(connInfo)
+	if qErr != nil {
+		return resp, err
+	}
+	rCode := dns.DNSResponseCodeServFail
+	if err == nil && len(resp) >= 4 {
+		rCode = dns.DNSResponseCode(resp[3] & 0x0F)
+	}
+	r.Stats.Record(connInfo.ClientIP().String(), qry.Question[0].Name.DomainName, qry.Question[0].Type, rCode)
+	return resp, err
+}
+
+// StatsSnapshotterConfig 记录统计快照器的配置
+type StatsSnapshotterConfig struct {
+	// 统计信息
+	Stats *Statistics
+	// 快照文件的存储目录
+	Directory string
+	// 快照间隔，0 表示 1 分钟
+	Interval time.Duration
+	// 保留的快照文件数量，0 表示不删除旧快照
+	Keep int
+	// 快照中保留的查询名称数量，0 表示 100
+	TopN int
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// StatsSnapshotter 统计快照器：周期性地将统计快照写入磁盘。
+type StatsSnapshotter struct {
+	Config         StatsSnapshotterConfig
+	SnapshotLogger *log.Logger
+
+	stop chan struct{}
+}
+
+// NewStatsSnapshotter 根据配置创建一个新的统计快照器
+func NewStatsSnapshotter(conf StatsSnapshotterConfig) *StatsSnapshotter {
+	snapshotLogger := log.New(conf.LogWriter, "Snapshotter: ", log.LstdFlags)
+	if conf.Interval <= 0 {
+		conf.Interval = time.Minute
+	}
+	if conf.TopN <= 0 {
+		conf.TopN = 100
+	}
+	return &StatsSnapshotter{
+		Config:         conf,
+		SnapshotLogger: snapshotLogger,
+		stop:           make(chan struct{}),
+	}
+}
+
+// Start 启动快照协程
+func (s *StatsSnapshotter) Start() {
+	go func() {
+		ticker := time.NewTicker(s.Config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.WriteSnapshot(); err != nil {
+					s.SnapshotLogger.Printf("Error writing snapshot: %v", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止快照协程，并写入最后一份快照
+func (s *StatsSnapshotter) Stop() error {
+	close(s.stop)
+	_, err := s.WriteSnapshot()
+	return err
+}
+
+// WriteSnapshot 立即写入一份快照，并删除超出保留数量的旧快照
+// 快照先写入临时文件再重命名，因此进程在写入过程中被终止也不会留下残缺的快照。
+// 返回值为：
+//   - string，快照文件路径
+//   - error，错误信息
+func (s *StatsSnapshotter) WriteSnapshot() (string, error) {
+	if err := os.MkdirAll(s.Config.Directory, 0755); err != nil {
+		return "", fmt.Errorf("method StatsSnapshotter WriteSnapshot failed: create directory failed.\n%v", err)
+	}
+
+	snapshot := s.Config.Stats.Snapshot(s.Config.TopN)
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("method StatsSnapshotter WriteSnapshot failed: marshal snapshot failed.\n%v", err)
+	}
+
+	name := fmt.Sprintf("stats-%s.json", snapshot.Time.UTC().Format("20060102T150405.000000000"))
+	path := filepath.Join(s.Config.Directory, name)
+	tmp, err := os.CreateTemp(s.Config.Directory, ".stats-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("method StatsSnapshotter WriteSnapshot failed: create temporary file failed.\n%v", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("method StatsSnapshotter WriteSnapshot failed: write snapshot failed.\n%v", err)
+	}
+
+	s.rotate()
+	return path, nil
+}
+
+// rotate 删除超出保留数量的旧快照
+func (s *StatsSnapshotter) rotate() {
+	if s.Config.Keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(s.Config.Directory)
+	if err != nil {
+		s.SnapshotLogger.Printf("Error reading snapshot directory: %v", err)
+		return
+	}
+	snapshots := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "stats-") && strings.HasSuffix(entry.Name(), ".json") {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+	// 文件名中的时间戳保证了字典序即时间顺序
+	sort.Strings(snapshots)
+	for len(snapshots) > s.Config.Keep {
+		if err := os.Remove(filepath.Join(s.Config.Directory, snapshots[0])); err != nil {
+			s.SnapshotLogger.Printf("Error removing snapshot %s: %v", snapshots[0], err)
+		}
+		snapshots = snapshots[1:]
+	}
+}
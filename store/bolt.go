@@ -0,0 +1,104 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// bolt.go 文件实现了基于 bbolt 的区域数据存储 BoltStore。
+
+package store
+
+import (
+	"fmt"
+
+	"github.com/tochusc/xdns/dns"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket 为存储 RRset 所使用的 bucket 名称
+var boltBucket = []byte("rrsets")
+
+// BoltStore 是基于 bbolt 的区域数据存储。
+// bbolt 按键的字节序存储数据，故遍历天然满足规范顺序。
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore 打开（或创建）位于 path 的 bbolt 数据库，并创建对应的存储
+// 其接受参数为：
+//   - path string，数据库文件路径
+//
+// 返回值为：
+//   - *BoltStore，创建的存储
+//   - error，错误信息
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("function NewBoltStore failed: open database failed.\n%v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("function NewBoltStore failed: create bucket failed.\n%v", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// PutRRSet 写入 RRset，覆盖同名同类型的已有 RRset。
+func (s *BoltStore) PutRRSet(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) error {
+	key := RRSetKey(canonicalName(name), rrType)
+	data := EncodeRRSet(rrSet)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(key, data)
+	})
+}
+
+// GetRRSet 读取 RRset，若不存在则返回空切片。
+func (s *BoltStore) GetRRSet(name string, rrType dns.DNSType) ([]dns.DNSResourceRecord, error) {
+	key := RRSetKey(canonicalName(name), rrType)
+	rrSet := []dns.DNSResourceRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		var err error
+		rrSet, err = DecodeRRSet(data)
+		return err
+	})
+	return rrSet, err
+}
+
+// DeleteRRSet 删除 RRset，若不存在则不做任何改动。
+func (s *BoltStore) DeleteRRSet(name string, rrType dns.DNSType) error {
+	key := RRSetKey(canonicalName(name), rrType)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete(key)
+	})
+}
+
+// Iterate 按规范顺序遍历所有 RRset。
+// 遍历在同一个只读事务中进行，回调函数中不应写入存储。
+func (s *BoltStore) Iterate(fn func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		for key, data := c.First(); key != nil; key, data = c.Next() {
+			name, rrType, err := ParseRRSetKey(key)
+			if err != nil {
+				return err
+			}
+			rrSet, err := DecodeRRSet(data)
+			if err != nil {
+				return err
+			}
+			if !fn(name, rrType, rrSet) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// Close 关闭底层数据库。
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
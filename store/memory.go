@@ -0,0 +1,92 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// memory.go 文件实现了基于内存的区域数据存储 MemoryStore。
+
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// memoryEntry 表示 MemoryStore 中的一个 RRset
+type memoryEntry struct {
+	name   string
+	rrType dns.DNSType
+	rrSet  []dns.DNSResourceRecord
+}
+
+// MemoryStore 是基于内存的区域数据存储，适用于中小规模的区域。
+type MemoryStore struct {
+	entries map[string]memoryEntry
+	mu      sync.RWMutex
+}
+
+// NewMemoryStore 创建一个新的内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+	}
+}
+
+// PutRRSet 写入 RRset，覆盖同名同类型的已有 RRset。
+func (s *MemoryStore) PutRRSet(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) error {
+	name = canonicalName(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[string(RRSetKey(name, rrType))] = memoryEntry{
+		name:   name,
+		rrType: rrType,
+		rrSet:  append([]dns.DNSResourceRecord{}, rrSet...),
+	}
+	return nil
+}
+
+// GetRRSet 读取 RRset，若不存在则返回空切片。
+func (s *MemoryStore) GetRRSet(name string, rrType dns.DNSType) ([]dns.DNSResourceRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[string(RRSetKey(canonicalName(name), rrType))]
+	if !ok {
+		return []dns.DNSResourceRecord{}, nil
+	}
+	return append([]dns.DNSResourceRecord{}, entry.rrSet...), nil
+}
+
+// DeleteRRSet 删除 RRset，若不存在则不做任何改动。
+func (s *MemoryStore) DeleteRRSet(name string, rrType dns.DNSType) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, string(RRSetKey(canonicalName(name), rrType)))
+	return nil
+}
+
+// Iterate 按规范顺序遍历所有 RRset。
+// 遍历开始时会对键进行排序，遍历期间对存储的修改不会影响本次遍历。
+func (s *MemoryStore) Iterate(fn func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool) error {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	entries := make([]memoryEntry, 0, len(keys))
+	sort.Strings(keys)
+	for _, key := range keys {
+		entries = append(entries, s.entries[key])
+	}
+	s.mu.RUnlock()
+
+	for _, entry := range entries {
+		if !fn(entry.name, entry.rrType, append([]dns.DNSResourceRecord{}, entry.rrSet...)) {
+			break
+		}
+	}
+	return nil
+}
+
+// Close 关闭存储，MemoryStore 无需释放资源。
+func (s *MemoryStore) Close() error {
+	return nil
+}
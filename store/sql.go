@@ -0,0 +1,101 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// sql.go 文件实现了基于 database/sql 的区域数据存储 SQLStore。
+// 其面向 SQLite 编写，为避免引入 cgo 等依赖，数据库驱动由使用者自行引入，例如：
+//
+//	import _ "modernc.org/sqlite"
+//	db, _ := sql.Open("sqlite", "zone.db")
+//	s, _ := store.NewSQLStore(db)
+
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// SQLStore 是基于 database/sql 的区域数据存储。
+// RRset 的键以 BLOB 形式存储，按键排序即可得到规范顺序。
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore 使用已打开的数据库创建存储，并在需要时创建数据表
+// 其接受参数为：
+//   - db *sql.DB，已打开的数据库
+//
+// 返回值为：
+//   - *SQLStore，创建的存储
+//   - error，错误信息
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS rrsets (
+		key  BLOB PRIMARY KEY,
+		data BLOB NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("function NewSQLStore failed: create table failed.\n%v", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// PutRRSet 写入 RRset，覆盖同名同类型的已有 RRset。
+func (s *SQLStore) PutRRSet(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) error {
+	key := RRSetKey(canonicalName(name), rrType)
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO rrsets (key, data) VALUES (?, ?)`, key, EncodeRRSet(rrSet))
+	return err
+}
+
+// GetRRSet 读取 RRset，若不存在则返回空切片。
+func (s *SQLStore) GetRRSet(name string, rrType dns.DNSType) ([]dns.DNSResourceRecord, error) {
+	key := RRSetKey(canonicalName(name), rrType)
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM rrsets WHERE key = ?`, key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return []dns.DNSResourceRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRRSet(data)
+}
+
+// DeleteRRSet 删除 RRset，若不存在则不做任何改动。
+func (s *SQLStore) DeleteRRSet(name string, rrType dns.DNSType) error {
+	key := RRSetKey(canonicalName(name), rrType)
+	_, err := s.db.Exec(`DELETE FROM rrsets WHERE key = ?`, key)
+	return err
+}
+
+// Iterate 按规范顺序遍历所有 RRset。
+func (s *SQLStore) Iterate(fn func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool) error {
+	rows, err := s.db.Query(`SELECT key, data FROM rrsets ORDER BY key`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return err
+		}
+		name, rrType, err := ParseRRSetKey(key)
+		if err != nil {
+			return err
+		}
+		rrSet, err := DecodeRRSet(data)
+		if err != nil {
+			return err
+		}
+		if !fn(name, rrType, rrSet) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// Close 关闭底层数据库。
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
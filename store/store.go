@@ -0,0 +1,113 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// Package store 定义了区域数据（RRset）的存储接口 ZoneStore 及其若干实现。
+// 对于包含数百万条记录的区域（如 NSEC 遍历、缓存填充等实验），
+// 区域数据可能无法完全放入 Go map 中，此时可使用基于磁盘的存储后端。
+//
+// 目前提供的存储后端有：
+//   - MemoryStore，基于内存的存储
+//   - BoltStore，基于 bbolt 的存储
+//   - SQLStore，基于 database/sql 的存储（面向 SQLite，驱动由使用者引入）
+//
+// 所有存储后端均按照 RFC 4034 6.1 节所定义的规范顺序遍历 RRset。
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ZoneStore 是区域数据的存储接口，其以 RRset 为单位存取资源记录。
+type ZoneStore interface {
+	// PutRRSet 写入 RRset，覆盖同名同类型的已有 RRset。
+	PutRRSet(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) error
+
+	// GetRRSet 读取 RRset，若不存在则返回空切片。
+	GetRRSet(name string, rrType dns.DNSType) ([]dns.DNSResourceRecord, error)
+
+	// DeleteRRSet 删除 RRset，若不存在则不做任何改动。
+	DeleteRRSet(name string, rrType dns.DNSType) error
+
+	// Iterate 按规范顺序遍历所有 RRset，同名 RRset 按类型值升序遍历。
+	// 回调函数返回 false 时停止遍历。
+	Iterate(fn func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool) error
+
+	// Close 关闭存储。
+	Close() error
+}
+
+// RRSetKey 返回 RRset 在存储中的键。
+// 键由域名的规范排序键、0x00 分隔符及 2 字节的类型值组成，
+// 对键进行字节序比较即可得到规范顺序。
+func RRSetKey(name string, rrType dns.DNSType) []byte {
+	nKey := dns.CanonicalNameKey(name)
+	key := make([]byte, len(nKey)+3)
+	copy(key, nKey)
+	binary.BigEndian.PutUint16(key[len(nKey)+1:], uint16(rrType))
+	return key
+}
+
+// ParseRRSetKey 从 RRset 的键中解析出域名（小写形式）及类型。
+func ParseRRSetKey(key []byte) (string, dns.DNSType, error) {
+	if len(key) < 3 || key[len(key)-3] != 0x00 {
+		return "", 0, fmt.Errorf("function ParseRRSetKey failed: malformed key %v", key)
+	}
+	rrType := dns.DNSType(binary.BigEndian.Uint16(key[len(key)-2:]))
+	nKey := key[:len(key)-3]
+	if len(nKey) == 0 {
+		return ".", rrType, nil
+	}
+	labels := strings.Split(string(nKey[:len(nKey)-1]), "\x00")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, "."), rrType, nil
+}
+
+// EncodeRRSet 将 RRset 编码为字节切片，
+// 每条资源记录以 2 字节长度前缀加上其线上格式表示。
+func EncodeRRSet(rrSet []dns.DNSResourceRecord) []byte {
+	data := []byte{}
+	for _, rr := range rrSet {
+		rrBytes := rr.Encode()
+		data = binary.BigEndian.AppendUint16(data, uint16(len(rrBytes)))
+		data = append(data, rrBytes...)
+	}
+	return data
+}
+
+// DecodeRRSet 从 EncodeRRSet 的编码结果中解码 RRset。
+func DecodeRRSet(data []byte) ([]dns.DNSResourceRecord, error) {
+	rrSet := []dns.DNSResourceRecord{}
+	offset := 0
+	for offset < len(data) {
+		if len(data) < offset+2 {
+			return nil, fmt.Errorf("function DecodeRRSet failed: truncated length prefix at offset %d", offset)
+		}
+		rrLen := int(binary.BigEndian.Uint16(data[offset:]))
+		offset += 2
+		if len(data) < offset+rrLen {
+			return nil, fmt.Errorf("function DecodeRRSet failed: data length %d is less than offset %d + record size %d", len(data), offset, rrLen)
+		}
+		// 每条记录使用独立的切片进行解码，避免未知类型的 RDATA 越界读取
+		rrBytes := append([]byte{}, data[offset:offset+rrLen]...)
+		rr := dns.DNSResourceRecord{}
+		if _, err := rr.DecodeFromBuffer(rrBytes, 0); err != nil {
+			return nil, fmt.Errorf("function DecodeRRSet failed: decode record failed.\n%v", err)
+		}
+		rrSet = append(rrSet, rr)
+		offset += rrLen
+	}
+	return rrSet, nil
+}
+
+// canonicalName 返回用于存储的规范化域名
+func canonicalName(name string) string {
+	if name == "" || name == "." {
+		return "."
+	}
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// store_test.go 文件用于对各存储后端进行测试。
+
+package store
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 待写入的 RRset，按写入顺序而非规范顺序排列
+var testedRRSets = []struct {
+	name   string
+	rrType dns.DNSType
+}{
+	{"z.example", dns.DNSRRTypeA},
+	{"example", dns.DNSRRTypeNS},
+	{"a.example", dns.DNSRRTypeA},
+	{"example", dns.DNSRRTypeA},
+	{"Z.a.example", dns.DNSRRTypeA},
+}
+
+// 期望的规范遍历顺序
+var expectedOrder = []string{"example", "example", "a.example", "z.a.example", "z.example"}
+
+func newTestedRRSet(name string, rrType dns.DNSType) []dns.DNSResourceRecord {
+	rr := dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(name),
+		Type:  rrType,
+		Class: dns.DNSClassIN,
+		TTL:   3600,
+	}
+	if rrType == dns.DNSRRTypeNS {
+		rr.RData = &dns.DNSRDATANS{NSDNAME: "ns.example"}
+	} else {
+		rr.RData = &dns.DNSRDATAA{Address: net.IPv4(10, 10, 0, 3)}
+	}
+	return []dns.DNSResourceRecord{rr}
+}
+
+// testZoneStore 对存储后端进行通用测试
+func testZoneStore(t *testing.T, s ZoneStore) {
+	for _, rs := range testedRRSets {
+		if err := s.PutRRSet(rs.name, rs.rrType, newTestedRRSet(rs.name, rs.rrType)); err != nil {
+			t.Fatalf("method PutRRSet() failed:\n%s", err)
+		}
+	}
+
+	rrSet, err := s.GetRRSet("A.EXAMPLE", dns.DNSRRTypeA)
+	if err != nil || len(rrSet) != 1 {
+		t.Errorf("method GetRRSet() failed:\ngot:%v, %v\nexpected: 1 record", rrSet, err)
+	}
+
+	names := []string{}
+	err = s.Iterate(func(name string, rrType dns.DNSType, rrSet []dns.DNSResourceRecord) bool {
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
+		t.Errorf("method Iterate() failed:\n%s", err)
+	}
+	if len(names) != len(expectedOrder) {
+		t.Fatalf("method Iterate() failed:\ngot:%v\nexpected: %v", names, expectedOrder)
+	}
+	for i := range names {
+		if names[i] != expectedOrder[i] {
+			t.Errorf("method Iterate() failed:\ngot:%v\nexpected: %v", names, expectedOrder)
+			break
+		}
+	}
+
+	if err := s.DeleteRRSet("a.example", dns.DNSRRTypeA); err != nil {
+		t.Errorf("method DeleteRRSet() failed:\n%s", err)
+	}
+	rrSet, err = s.GetRRSet("a.example", dns.DNSRRTypeA)
+	if err != nil || len(rrSet) != 0 {
+		t.Errorf("method DeleteRRSet() failed:\ngot:%v, %v\nexpected: no record", rrSet, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	defer s.Close()
+	testZoneStore(t, s)
+}
+
+func TestBoltStore(t *testing.T) {
+	s, err := NewBoltStore(filepath.Join(t.TempDir(), "zone.db"))
+	if err != nil {
+		t.Fatalf("function NewBoltStore() failed:\n%s", err)
+	}
+	defer s.Close()
+	testZoneStore(t, s)
+}
+
+func TestParseRRSetKey(t *testing.T) {
+	name, rrType, err := ParseRRSetKey(RRSetKey("www.example.com", dns.DNSRRTypeAAAA))
+	if err != nil || name != "www.example.com" || rrType != dns.DNSRRTypeAAAA {
+		t.Errorf("function ParseRRSetKey() failed:\ngot:%s, %s, %v", name, rrType, err)
+	}
+	name, _, _ = ParseRRSetKey(RRSetKey(".", dns.DNSRRTypeNS))
+	if name != "." {
+		t.Errorf("function ParseRRSetKey() failed:\ngot:%s\nexpected: .", name)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// stream.go 文件定义了 StreamFraming 流式分帧篡改，
+// 用以测试解析器对 TCP 字节流的解析是否健壮。
+// 设置 ServerConfig.StreamFraming 后，Netter 经由流式链接发送回复时，
+// 可以将回复（含长度前缀）拆分为许多小分段，并在分段之间等待，
+// 使客户端必须跨多次读取重组消息；也可以在长度前缀之前或之后插入垃圾字节，
+// 使客户端读到的长度前缀与随后的消息不一致。
+//
+// Go 的 TCP 链接默认禁用 Nagle 算法，因此每个分段通常以单独的 TCP 报文段发出。
+
+package xdns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// GarbagePosition 表示垃圾字节插入的位置
+type GarbagePosition int
+
+const (
+	// GarbageBeforeLength 在长度前缀之前插入垃圾字节，客户端会将垃圾字节的前两个字节解析为长度前缀
+	GarbageBeforeLength GarbagePosition = iota
+	// GarbageAfterLength 在长度前缀与消息之间插入垃圾字节，长度前缀不计入垃圾字节，消息的末尾将被视为下一条消息
+	GarbageAfterLength
+)
+
+// String 返回垃圾字节位置的名称
+func (p GarbagePosition) String() string {
+	switch p {
+	case GarbageBeforeLength:
+		return "before-length"
+	case GarbageAfterLength:
+		return "after-length"
+	}
+	return fmt.Sprintf("position-%d", int(p))
+}
+
+// StreamFraming 记录流式链接上回复的分帧篡改方式，其零值不进行篡改
+type StreamFraming struct {
+	// 每个分段的字节数，0 表示不分段，1 表示逐字节发送
+	SegmentSize int
+	// 相邻分段之间的延迟，仅在分段时生效
+	SegmentDelay time.Duration
+	// 插入的垃圾字节，为空时插入 GarbageLength 个随机字节
+	Garbage []byte
+	// Garbage 为空时插入的随机字节数，0 表示不插入
+	GarbageLength int
+	// 垃圾字节插入的位置
+	GarbagePosition GarbagePosition
+}
+
+// Validate 检查分帧篡改配置的合法性
+// 返回值为：
+//   - error，配置不合法时返回错误信息
+func (f *StreamFraming) Validate() error {
+	if f.SegmentSize < 0 {
+		return fmt.Errorf("method StreamFraming Validate failed: invalid SegmentSize %d", f.SegmentSize)
+	}
+	if f.SegmentDelay < 0 {
+		return fmt.Errorf("method StreamFraming Validate failed: invalid SegmentDelay %v", f.SegmentDelay)
+	}
+	if f.GarbageLength < 0 {
+		return fmt.Errorf("method StreamFraming Validate failed: invalid GarbageLength %d", f.GarbageLength)
+	}
+	if f.GarbagePosition != GarbageBeforeLength && f.GarbagePosition != GarbageAfterLength {
+		return fmt.Errorf("method StreamFraming Validate failed: invalid GarbagePosition %d", int(f.GarbagePosition))
+	}
+	return nil
+}
+
+// garbage 返回本次插入的垃圾字节
+func (f *StreamFraming) garbage() []byte {
+	if len(f.Garbage) > 0 {
+		return f.Garbage
+	}
+	if f.GarbageLength <= 0 {
+		return nil
+	}
+	garbage := make([]byte, f.GarbageLength)
+	xperi.RandomRead(garbage)
+	return garbage
+}
+
+// Frame 返回在流式链接上发送的字节，即长度前缀、消息及插入的垃圾字节
+// 其接受参数为：
+//   - data []byte，回复消息，超过 0xffff 字节的部分将被截去
+//
+// 返回值为：
+//   - []byte，待发送的字节
+func (f *StreamFraming) Frame(data []byte) []byte {
+	if len(data) > 0xffff {
+		data = data[:0xffff]
+	}
+	garbage := f.garbage()
+	stream := make([]byte, 0, 2+len(garbage)+len(data))
+	if f.GarbagePosition == GarbageBeforeLength {
+		stream = append(stream, garbage...)
+	}
+	stream = binary.BigEndian.AppendUint16(stream, uint16(len(data)))
+	if f.GarbagePosition == GarbageAfterLength {
+		stream = append(stream, garbage...)
+	}
+	return append(stream, data...)
+}
+
+// WriteTo 将回复按分帧篡改方式写入流式链接
+// 其接受参数为：
+//   - conn net.Conn，流式链接
+//   - data []byte，回复消息
+//
+// 返回值为：
+//   - int，写入的字节数
+//   - error，写入失败时返回错误信息
+func (f *StreamFraming) WriteTo(conn net.Conn, data []byte) (int, error) {
+	stream := f.Frame(data)
+	if f.SegmentSize <= 0 {
+		return conn.Write(stream)
+	}
+	written := 0
+	for written < len(stream) {
+		if written > 0 && f.SegmentDelay > 0 {
+			time.Sleep(f.SegmentDelay)
+		}
+		end := written + f.SegmentSize
+		if end > len(stream) {
+			end = len(stream)
+		}
+		n, err := conn.Write(stream[written:end])
+		written += n
+		if err != nil {
+			return written, fmt.Errorf("method StreamFraming WriteTo failed: segment at offset %d.\n%v", written, err)
+		}
+		serverVars.Add("stream_segments", 1)
+	}
+	return written, nil
+}
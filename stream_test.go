@@ -0,0 +1,116 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// stream_test.go 文件用于对流式分帧篡改进行测试。
+
+package xdns
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+// segmentConn 记录每次写入的分段，写入 failAfter 个分段后返回错误，failAfter 为 0 时不返回错误
+type segmentConn struct {
+	net.Conn
+	segments  [][]byte
+	failAfter int
+}
+
+func (c *segmentConn) Write(b []byte) (int, error) {
+	if c.failAfter > 0 && len(c.segments) == c.failAfter {
+		return 0, errors.New("connection closed")
+	}
+	c.segments = append(c.segments, append([]byte{}, b...))
+	return len(b), nil
+}
+
+// 测试 StreamFraming 的 Validate 方法
+func TestStreamFramingValidate(t *testing.T) {
+	valid := []StreamFraming{
+		{},
+		{SegmentSize: 1, SegmentDelay: 1, GarbageLength: 3, GarbagePosition: GarbageAfterLength},
+	}
+	for _, f := range valid {
+		if err := f.Validate(); err != nil {
+			t.Errorf("method StreamFraming Validate() failed: %+v:\n%v", f, err)
+		}
+	}
+	invalid := []StreamFraming{
+		{SegmentSize: -1},
+		{SegmentDelay: -1},
+		{GarbageLength: -1},
+		{GarbagePosition: 2},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("method StreamFraming Validate() failed: %+v: expected an error but got nil", f)
+		}
+	}
+}
+
+// 测试 StreamFraming 的 Frame 方法
+func TestStreamFramingFrame(t *testing.T) {
+	msg := []byte{0xaa, 0xbb, 0xcc}
+	tests := []struct {
+		name     string
+		framing  StreamFraming
+		expected []byte
+	}{
+		{"plain", StreamFraming{}, []byte{0x00, 0x03, 0xaa, 0xbb, 0xcc}},
+		{"garbage before length", StreamFraming{Garbage: []byte{0x01, 0x02}, GarbagePosition: GarbageBeforeLength},
+			[]byte{0x01, 0x02, 0x00, 0x03, 0xaa, 0xbb, 0xcc}},
+		{"garbage after length", StreamFraming{Garbage: []byte{0x01, 0x02}, GarbagePosition: GarbageAfterLength},
+			[]byte{0x00, 0x03, 0x01, 0x02, 0xaa, 0xbb, 0xcc}},
+	}
+	for _, tt := range tests {
+		if got := tt.framing.Frame(msg); !bytes.Equal(got, tt.expected) {
+			t.Errorf("method StreamFraming Frame() failed: %s:\ngot: %x\nexpected: %x", tt.name, got, tt.expected)
+		}
+	}
+
+	// 随机垃圾字节
+	f := StreamFraming{GarbageLength: 5, GarbagePosition: GarbageAfterLength}
+	if got := f.Frame(msg); len(got) != 2+5+3 || !bytes.Equal(got[:2], []byte{0x00, 0x03}) || !bytes.Equal(got[7:], msg) {
+		t.Errorf("method StreamFraming Frame() failed: random garbage:\ngot: %x", got)
+	}
+
+	// 超过 0xffff 字节的部分被截去
+	long := make([]byte, 0x10005)
+	if got := (&StreamFraming{}).Frame(long); len(got) != 2+0xffff || got[0] != 0xff || got[1] != 0xff {
+		t.Errorf("method StreamFraming Frame() failed: oversized message framed into %d bytes with prefix %x", len(got), got[:2])
+	}
+}
+
+// 测试 StreamFraming 的 WriteTo 方法
+func TestStreamFramingWriteTo(t *testing.T) {
+	msg := []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	tests := []struct {
+		name     string
+		framing  StreamFraming
+		segments int
+	}{
+		{"unsegmented", StreamFraming{}, 1},
+		{"byte by byte", StreamFraming{SegmentSize: 1, SegmentDelay: 1}, 7},
+		{"uneven segments", StreamFraming{SegmentSize: 3}, 3},
+		{"segment larger than stream", StreamFraming{SegmentSize: 100}, 1},
+	}
+	for _, tt := range tests {
+		conn := &segmentConn{}
+		n, err := tt.framing.WriteTo(conn, msg)
+		if err != nil || n != 7 {
+			t.Errorf("method StreamFraming WriteTo() failed: %s: wrote %d bytes, %v", tt.name, n, err)
+			continue
+		}
+		if len(conn.segments) != tt.segments || !bytes.Equal(bytes.Join(conn.segments, nil), tt.framing.Frame(msg)) {
+			t.Errorf("method StreamFraming WriteTo() failed: %s:\ngot: %x\nexpected %d segments", tt.name, conn.segments, tt.segments)
+		}
+	}
+
+	// 写入失败时返回已写入的字节数
+	conn := &segmentConn{failAfter: 2}
+	if n, err := (&StreamFraming{SegmentSize: 2}).WriteTo(conn, msg); err == nil || n != 4 {
+		t.Errorf("method StreamFraming WriteTo() failed: wrote %d bytes, %v, expected 4 bytes and an error", n, err)
+	}
+}
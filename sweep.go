@@ -0,0 +1,342 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// sweep.go 文件定义了 RRSIG 有效期扫描实验。
+// ValiditySweepResponser 为区域下的每个步骤名称（"<步骤>.<区域>"）回复签名有效期各不相同的 A 记录：
+// 生效时间位于未来 1 秒、1 分钟、1 小时，过期时间位于过去，
+// 以及在 RFC 1982 序列号算术下相距约 68 年、刚好回绕或刚好不回绕的有效期。
+// RunValiditySweep 经由待测解析器依次查询每个步骤的名称，
+// 根据解析器是否回复 A 记录判断其是否接受该步骤的签名，
+// 与 RFC 4035 5.3.1 节的预期相比较，得到解析器对时钟偏差的容忍画像。
+//
+// 步骤名称之前可附加任意标签（如 "r1.inception-future-1m.<区域>"），
+// 以便重复扫描时绕过解析器的缓存。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tochusc/xdns/client"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// ValiditySweepStep 表示有效期扫描中的一个步骤
+type ValiditySweepStep struct {
+	// 步骤名称，作为查询名称中区域之下的标签
+	Name string `json:"name"`
+	// 签名生效时间相对于查询时间的偏移（秒）
+	InceptionOffset int64 `json:"inception_offset"`
+	// 签名过期时间相对于查询时间的偏移（秒）
+	ExpirationOffset int64 `json:"expiration_offset"`
+}
+
+// Expected 返回严格遵循 RFC 4035 5.3.1 节的验证解析器是否应接受该步骤的签名，
+// 即按 RFC 1982 序列号算术比较，查询时间是否位于生效时间与过期时间之间。
+func (s ValiditySweepStep) Expected() bool {
+	inception, expiration := uint32(s.InceptionOffset), uint32(s.ExpirationOffset)
+	return !serialNewer(inception, 0) && !serialNewer(0, expiration)
+}
+
+// Validity 返回该步骤的签名有效期配置
+func (s ValiditySweepStep) Validity() SignatureValidity {
+	return SignatureValidity{
+		Mode:             ValidityRelative,
+		InceptionOffset:  s.InceptionOffset,
+		ExpirationOffset: s.ExpirationOffset,
+	}
+}
+
+// serialHalf 为 RFC 1982 序列号算术中 32 位序列号空间的一半，约 68 年
+const serialHalf = 1 << 31
+
+// DefaultValiditySweepSteps 返回默认的扫描步骤：
+// 对照组、生效时间位于未来、过期时间位于过去、起止颠倒，以及序列号算术的回绕边界。
+func DefaultValiditySweepSteps() []ValiditySweepStep {
+	const day = 86400
+	return []ValiditySweepStep{
+		{"control", -3600, day},
+		{"inception-future-1s", 1, day},
+		{"inception-future-1m", 60, day},
+		{"inception-future-1h", 3600, day},
+		{"inception-future-1d", day, 2 * day},
+		{"expiration-past-1s", -day, -1},
+		{"expiration-past-1m", -day, -60},
+		{"expiration-past-1h", -day, -3600},
+		{"expiration-past-1d", -2 * day, -day},
+		{"inverted", day, -day},
+		// 过期时间约 68 年之后：不回绕时仍在未来，回绕后即位于过去
+		{"expiration-wrap-valid", -3600, serialHalf - 1},
+		{"expiration-wrap-expired", -3600, serialHalf + 1},
+		// 生效时间约 68 年之前：不回绕时仍在过去，回绕后即位于未来
+		{"inception-wrap-valid", -(serialHalf - 1), day},
+		{"inception-wrap-future", -(serialHalf + 1), day},
+	}
+}
+
+// ValiditySweepConfig 记录有效期扫描回复器的配置
+type ValiditySweepConfig struct {
+	// 区域名称
+	Zone string
+	// 扫描步骤，为空时使用 DefaultValiditySweepSteps
+	Steps []ValiditySweepStep
+	// 回复 A 记录所使用的地址
+	ServerIP net.IP
+	// 记录的 TTL，同时用作 SOA MINIMUM
+	TTL uint32
+	// DNSSEC 配置，区域顶点的记录及否定回复按其有效期签名
+	DNSSEC DNSSECConfig
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// ValiditySweepResponser 有效期扫描回复器：按查询名称中的步骤标签，
+// 以该步骤的有效期签名回复的 A 记录，并记录每个步骤被查询的情况。
+type ValiditySweepResponser struct {
+	Config      ValiditySweepConfig
+	SweepLogger *log.Logger
+
+	steps map[string]ValiditySweepStep
+	// 区域名与其相应 DNSSEC 材料的映射
+	materialMap sync.Map
+}
+
+// NewValiditySweepResponser 根据配置创建一个新的有效期扫描回复器
+func NewValiditySweepResponser(conf ValiditySweepConfig) *ValiditySweepResponser {
+	conf.Zone = dns.CanonicalizeDomainName(&conf.Zone)
+	if len(conf.Steps) == 0 {
+		conf.Steps = DefaultValiditySweepSteps()
+	}
+	steps := map[string]ValiditySweepStep{}
+	for _, step := range conf.Steps {
+		steps[strings.ToLower(step.Name)] = step
+	}
+	return &ValiditySweepResponser{
+		Config:      conf,
+		SweepLogger: log.New(conf.LogWriter, "ValiditySweep: ", log.LstdFlags),
+		steps:       steps,
+	}
+}
+
+// stepOf 返回查询名称所对应的步骤，即区域之下的第一个标签
+func (r *ValiditySweepResponser) stepOf(qName string) (ValiditySweepStep, bool) {
+	if !dns.IsSubDomain(qName, r.Config.Zone) || dns.EqualDomainName(qName, r.Config.Zone) {
+		return ValiditySweepStep{}, false
+	}
+	labels := strings.Split(strings.TrimSuffix(qName, "."), ".")
+	zoneLabels := strings.Count(strings.TrimSuffix(r.Config.Zone, "."), ".") + 1
+	if r.Config.Zone == "." {
+		zoneLabels = 0
+	}
+	step, ok := r.steps[strings.ToLower(labels[len(labels)-zoneLabels-1])]
+	return step, ok
+}
+
+// newSOA 生成区域的 SOA 记录
+func (r *ValiditySweepResponser) newSOA() dns.DNSResourceRecord {
+	return dns.DNSResourceRecord{
+		Name:  *dns.NewDNSName(r.Config.Zone),
+		Type:  dns.DNSRRTypeSOA,
+		Class: dns.DNSClassIN,
+		TTL:   r.Config.TTL,
+		RDLen: 0,
+		RData: &dns.DNSRDATASOA{
+			MName:   "ns." + r.Config.Zone,
+			RName:   "hostmaster." + r.Config.Zone,
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			Minimum: r.Config.TTL,
+		},
+	}
+}
+
+// Response 根据 DNS 查询信息生成 DNS 回复信息。
+func (r *ValiditySweepResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	qName := strings.ToLower(qry.Question[0].Name.DomainName)
+	qType := qry.Question[0].Type
+
+	resp := InitNXDOMAIN(qry)
+	if !dns.IsSubDomain(qName, r.Config.Zone) {
+		resp.Header.RCode = dns.DNSResponseCodeRefused
+		FixCount(&resp)
+		return resp.Encode(), nil
+	}
+
+	dMats := GetSignerMaterials(r.Config.Zone, &r.materialMap, r.Config.DNSSEC)
+	zsks := []CryptoMaterial{}
+	for _, dMat := range dMats {
+		zsks = append(zsks, ZSKCryptoMaterial(r.Config.Zone, dMat, r.Config.DNSSEC))
+	}
+
+	apex := dns.EqualDomainName(qName, r.Config.Zone)
+	step, isStep := r.stepOf(qName)
+	if apex || isStep {
+		resp.Header.RCode = dns.DNSResponseCodeNoErr
+	}
+	switch {
+	case apex && qType == dns.DNSRRTypeDNSKEY:
+		keys := []dns.DNSResourceRecord{}
+		for _, dMat := range dMats {
+			keys = append(keys, dMat.ZSKRecord, dMat.KSKRecord)
+		}
+		resp.Answer = append(resp.Answer, keys...)
+		for _, dMat := range dMats {
+			resp.Answer = append(resp.Answer, SignSet(keys, KSKCryptoMaterial(r.Config.Zone, dMat, r.Config.DNSSEC)))
+		}
+	case apex && qType == dns.DNSRRTypeSOA:
+		resp.Answer = SignSectionMulti(dns.DNSResponseSection{r.newSOA()}, zsks)
+	case isStep && qType == dns.DNSRRTypeA:
+		// 仅回答的签名使用该步骤的有效期，且不使用签名缓存
+		stepConf := r.Config.DNSSEC
+		stepConf.Validity = step.Validity()
+		stepConf.Signatures = nil
+		stepZSKs := []CryptoMaterial{}
+		for _, dMat := range dMats {
+			stepZSKs = append(stepZSKs, ZSKCryptoMaterial(r.Config.Zone, dMat, stepConf))
+		}
+		resp.Answer = SignSectionMulti(dns.DNSResponseSection{{
+			Name:  *dns.NewDNSName(qName),
+			Type:  dns.DNSRRTypeA,
+			Class: dns.DNSClassIN,
+			TTL:   r.Config.TTL,
+			RDLen: 0,
+			RData: &dns.DNSRDATAA{Address: r.Config.ServerIP},
+		}}, stepZSKs)
+		r.SweepLogger.Printf("Served step %s (inception %+ds, expiration %+ds) for %s to %v.",
+			step.Name, step.InceptionOffset, step.ExpirationOffset, qName, connInfo.Address)
+	default:
+		// NODATA 或 NXDOMAIN，不附带否定存在证明
+		resp.Authority = SignSectionMulti(dns.DNSResponseSection{r.newSOA()}, zsks)
+	}
+	FixCount(&resp)
+	return resp.Encode(), nil
+}
+
+// ValiditySweepResult 记录解析器对一个扫描步骤的回复
+type ValiditySweepResult struct {
+	ValiditySweepStep
+	// 严格遵循 RFC 4035 的验证解析器是否应接受该步骤的签名
+	Expected bool `json:"expected"`
+	// 解析器是否接受了该步骤的签名，即是否回复了 A 记录
+	Accepted bool `json:"accepted"`
+	// 解析器回复的 RCODE 及 AD 标志
+	RCode dns.DNSResponseCode `json:"rcode"`
+	AD    bool                `json:"ad"`
+	// 未收到回复时的错误信息
+	Error string `json:"error,omitempty"`
+}
+
+// SkewProfile 解析器的时钟偏差容忍画像
+type SkewProfile struct {
+	// 待测解析器的地址
+	Resolver string                `json:"resolver"`
+	Results  []ValiditySweepResult `json:"results"`
+	// 被接受的签名中，生效时间位于未来的最大偏差
+	InceptionTolerance time.Duration `json:"inception_tolerance"`
+	// 被接受的签名中，过期时间位于过去的最大偏差
+	ExpirationTolerance time.Duration `json:"expiration_tolerance"`
+}
+
+// Deviations 返回解析器的接受情况与 RFC 4035 的预期不符的步骤
+func (p *SkewProfile) Deviations() []ValiditySweepResult {
+	deviations := []ValiditySweepResult{}
+	for _, result := range p.Results {
+		if result.Error == "" && result.Accepted != result.Expected {
+			deviations = append(deviations, result)
+		}
+	}
+	return deviations
+}
+
+// ValiditySweepRunConfig 记录有效期扫描的配置
+type ValiditySweepRunConfig struct {
+	// 有效期扫描回复器所负责的区域
+	Zone string
+	// 扫描步骤，应与回复器的步骤一致，为空时使用 DefaultValiditySweepSteps
+	Steps []ValiditySweepStep
+	// 待测解析器及查询参数，查询总是设置 RD 及 DO 标志
+	Client client.ClientConfig
+	// 附加在步骤名称之前的标签，用于绕过解析器的缓存，为空时随机生成
+	Nonce string
+	// 日志输出，每个步骤的结果均被记录
+	LogWriter io.Writer
+}
+
+// RunValiditySweep 经由待测解析器依次查询每个步骤的名称，生成其时钟偏差容忍画像
+// 其接受参数为：
+//   - ctx context.Context，上下文，结束时不再查询后续的步骤
+//   - conf ValiditySweepRunConfig，有效期扫描配置
+//
+// 返回值为：
+//   - *SkewProfile，时钟偏差容忍画像，上下文结束时仅包含已完成的步骤
+//   - error，上下文结束时返回错误
+func RunValiditySweep(ctx context.Context, conf ValiditySweepRunConfig) (*SkewProfile, error) {
+	if len(conf.Steps) == 0 {
+		conf.Steps = DefaultValiditySweepSteps()
+	}
+	if conf.Nonce == "" {
+		conf.Nonce = fmt.Sprintf("r%08x", xperi.RandomInt63n(1<<32))
+	}
+	if conf.Client.UDPSize == 0 {
+		conf.Client.UDPSize = client.DefaultValidatingUDPSize
+	}
+	conf.Client.DNSSECOK = true
+	c := client.NewClient(conf.Client)
+	sweepLogger := log.New(conf.LogWriter, "ValiditySweep: ", log.LstdFlags)
+	zone := strings.TrimSuffix(conf.Zone, ".")
+
+	profile := &SkewProfile{Resolver: conf.Client.Server, Results: []ValiditySweepResult{}}
+	for _, step := range conf.Steps {
+		if err := ctx.Err(); err != nil {
+			return profile, fmt.Errorf("function RunValiditySweep failed: %v", err)
+		}
+		result := ValiditySweepResult{ValiditySweepStep: step, Expected: step.Expected()}
+		qry := c.NewQuery(conf.Nonce+"."+step.Name+"."+zone, dns.DNSRRTypeA)
+		qry.Header.RD = true
+		resp, err := c.Exchange(qry)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.RCode = resp.Header.RCode
+			result.AD = resp.Header.Z&0x02 != 0
+			for _, rr := range resp.Answer {
+				if rr.Type == dns.DNSRRTypeA {
+					result.Accepted = true
+				}
+			}
+		}
+		profile.Results = append(profile.Results, result)
+		sweepLogger.Printf("Step %s: expected %v, accepted %v, rcode %s, ad %v.",
+			step.Name, result.Expected, result.Accepted, result.RCode, result.AD)
+
+		if !result.Accepted {
+			continue
+		}
+		// 回绕及起止颠倒的步骤不计入偏差
+		switch {
+		case step.InceptionOffset > 0 && step.ExpirationOffset > step.InceptionOffset:
+			if d := time.Duration(step.InceptionOffset) * time.Second; d > profile.InceptionTolerance {
+				profile.InceptionTolerance = d
+			}
+		case step.ExpirationOffset < 0 && step.InceptionOffset < step.ExpirationOffset:
+			if d := time.Duration(-step.ExpirationOffset) * time.Second; d > profile.ExpirationTolerance {
+				profile.ExpirationTolerance = d
+			}
+		}
+	}
+	return profile, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// systemd.go 文件实现了 systemd 套接字激活（socket activation）的支持。
+// 启用后，Netter 直接使用 systemd 传入的已绑定套接字，而无需自行绑定 53 端口，
+// 从而可以以普通用户身份运行 xdns。相应的 systemd unit 示例：
+//
+//	# xdns.socket
+//	[Socket]
+//	ListenDatagram=53
+//	ListenStream=53
+//
+//	# xdns.service
+//	[Service]
+//	User=xdns
+//	ExecStart=/usr/local/bin/xdnsd
+//
+// 若不使用套接字激活，也可以通过 AmbientCapabilities=CAP_NET_BIND_SERVICE
+// 以普通用户身份绑定 53 端口，或以 root 身份启动并在绑定后降低权限，详见 privdrop.go。
+
+package xdns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// systemd 传入的首个文件描述符，详见 sd_listen_fds(3)
+const sdListenFDsStart = 3
+
+// SystemdListeners 返回 systemd 套接字激活传入的数据包链接及流式监听器
+// 读取后会清除 LISTEN_PID、LISTEN_FDS 及 LISTEN_FDNAMES 环境变量，以免被子进程继承。
+// 返回值为：
+//   - []net.PacketConn，数据包链接（如 UDP），
+//   - []net.Listener，流式监听器（如 TCP），
+//   - error，错误信息，若进程并非由 systemd 套接字激活启动，则两个切片均为空且不返回错误
+func SystemdListeners() ([]net.PacketConn, []net.Listener, error) {
+	pktConns := []net.PacketConn{}
+	listeners := []net.Listener{}
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return pktConns, listeners, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return pktConns, listeners, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for fd := sdListenFDsStart; fd < sdListenFDsStart+nfds; fd++ {
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		// net.FileListener 及 net.FilePacketConn 均会复制文件描述符，原文件可直接关闭
+		if lstr, err := net.FileListener(file); err == nil {
+			listeners = append(listeners, lstr)
+		} else if pktConn, err := net.FilePacketConn(file); err == nil {
+			pktConns = append(pktConns, pktConn)
+		} else {
+			file.Close()
+			return pktConns, listeners, fmt.Errorf("function SystemdListeners failed: unsupported socket on fd %d.\n%v", fd, err)
+		}
+		file.Close()
+	}
+	return pktConns, listeners, nil
+}
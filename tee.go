@@ -0,0 +1,229 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// tee.go 文件定义了 TeeResponser 镜像回复器。
+// 其会将收到的每个查询（以及可选的回复）异步复制一份，
+// 以 dnstap 或原始报文格式经由 UDP/TCP 发送至外部收集器，
+// 发送在独立的协程中进行，队列已满时直接丢弃，不影响回复路径的时延。
+
+package xdns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// TeeFormat 表示镜像数据的格式
+type TeeFormat int
+
+const (
+	// TeeFormatRaw 原始 DNS 报文，经由 TCP 发送时带有 2 字节长度前缀
+	TeeFormatRaw TeeFormat = iota
+	// TeeFormatDnstap dnstap 格式，经由 TCP 发送时使用单向 Frame Streams
+	TeeFormatDnstap
+)
+
+// TeeResponserConfig 记录镜像回复器的配置
+type TeeResponserConfig struct {
+	// 被包装的回复器
+	Responser Responser
+	// 收集器的网络类型，"udp" 或 "tcp"
+	Network string
+	// 收集器地址，形如 "127.0.0.1:6000"
+	Collector string
+	// 镜像数据的格式
+	Format TeeFormat
+	// 是否同时镜像回复
+	IncludeResponse bool
+	// dnstap 服务器标识
+	Identity string
+	// 发送队列长度，0 表示 1024
+	QueueSize int
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// teeItem 表示一条待发送的镜像数据
+type teeItem struct {
+	connInfo ConnectionInfo
+	query    []byte
+	response []byte
+	respTime time.Time
+}
+
+// TeeResponser 镜像回复器：将查询及回复异步镜像至外部收集器，并返回被包装回复器的回复。
+type TeeResponser struct {
+	Config    TeeResponserConfig
+	TeeLogger *log.Logger
+
+	queue   chan teeItem
+	dropped uint64
+}
+
+// NewTeeResponser 根据配置创建一个新的镜像回复器，并启动发送协程
+func NewTeeResponser(conf TeeResponserConfig) *TeeResponser {
+	teeLogger := log.New(conf.LogWriter, "Tee: ", log.LstdFlags)
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 1024
+	}
+	if conf.Network == "" {
+		conf.Network = "udp"
+	}
+	t := &TeeResponser{
+		Config:    conf,
+		TeeLogger: teeLogger,
+		queue:     make(chan teeItem, conf.QueueSize),
+	}
+	go t.run()
+	return t
+}
+
+// Response 生成被包装回复器的回复，并将查询及回复放入发送队列。
+func (t *TeeResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return t.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (t *TeeResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	resp, err := Respond(ctx, t.Config.Responser, connInfo)
+
+	item := teeItem{
+		connInfo: connInfo,
+		query:    connInfo.Packet,
+	}
+	if t.Config.IncludeResponse && err == nil {
+		// 回复可能写入借自编码缓冲池的缓冲区，发送前即被归还，因此镜像其副本
+		item.response = append([]byte{}, resp...)
+		item.respTime = time.Now()
+	}
+	select {
+	case t.queue <- item:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+	return resp, err
+}
+
+// Dropped 返回因队列已满而被丢弃的镜像数据数量
+func (t *TeeResponser) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close 停止发送协程，此后不应再调用 Response
+func (t *TeeResponser) Close() {
+	close(t.queue)
+}
+
+// run 从队列中取出镜像数据并发送至收集器，链接失败时在下一条数据到来时重连
+func (t *TeeResponser) run() {
+	var conn net.Conn
+	for item := range t.queue {
+		if conn == nil {
+			var err error
+			conn, err = t.dial()
+			if err != nil {
+				t.TeeLogger.Printf("Error connecting to collector %s: %v", t.Config.Collector, err)
+				continue
+			}
+		}
+		for _, payload := range t.encode(item) {
+			if _, err := conn.Write(payload); err != nil {
+				t.TeeLogger.Printf("Error sending to collector %s: %v", t.Config.Collector, err)
+				conn.Close()
+				conn = nil
+				break
+			}
+		}
+	}
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// dial 链接收集器，对于 TCP 上的 dnstap 格式，发送 Frame Streams START 控制帧
+func (t *TeeResponser) dial() (net.Conn, error) {
+	conn, err := net.Dial(t.Config.Network, t.Config.Collector)
+	if err != nil {
+		return nil, err
+	}
+	if t.Config.Network == "tcp" && t.Config.Format == TeeFormatDnstap {
+		if _, err := conn.Write(FrameStreamsStart()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// encode 将镜像数据编码为待发送的载荷
+func (t *TeeResponser) encode(item teeItem) [][]byte {
+	payloads := [][]byte{}
+	if t.Config.Format == TeeFormatDnstap {
+		msg := DnstapMessage{
+			Type:         DnstapAuthQuery,
+			Protocol:     item.connInfo.Protocol,
+			QueryAddress: item.connInfo.ClientIP(),
+			QueryPort:    portOf(item.connInfo.Address),
+			QueryTime:    item.connInfo.ReceiveTime,
+			QueryMessage: item.query,
+		}
+		local := localAddrOf(item.connInfo)
+		msg.ResponseAddress, msg.ResponsePort = ipOf(local), portOf(local)
+		payloads = append(payloads, msg.Encode(t.Config.Identity))
+		if item.response != nil {
+			msg.Type = DnstapAuthResponse
+			msg.ResponseTime = item.respTime
+			msg.ResponseMessage = item.response
+			payloads = append(payloads, msg.Encode(t.Config.Identity))
+		}
+	} else {
+		payloads = append(payloads, item.query)
+		if item.response != nil {
+			payloads = append(payloads, item.response)
+		}
+	}
+
+	if t.Config.Network != "tcp" {
+		return payloads
+	}
+	for i, payload := range payloads {
+		if t.Config.Format == TeeFormatDnstap {
+			payloads[i] = FrameStreamsData(payload)
+		} else {
+			payloads[i] = append(binary.BigEndian.AppendUint16(nil, uint16(len(payload))), payload...)
+		}
+	}
+	return payloads
+}
+
+// localAddrOf 返回链接的本地地址
+func localAddrOf(connInfo ConnectionInfo) net.Addr {
+	if connInfo.StreamConn != nil {
+		return connInfo.StreamConn.LocalAddr()
+	}
+	if connInfo.PacketConn != nil {
+		return connInfo.PacketConn.LocalAddr()
+	}
+	return nil
+}
+
+// ipOf 返回地址中的 IP 地址，无法识别时返回 nil
+func ipOf(addr net.Addr) net.IP {
+	connInfo := ConnectionInfo{Address: addr}
+	return connInfo.ClientIP()
+}
+
+// portOf 返回地址中的端口，无法识别时返回 0
+func portOf(addr net.Addr) int {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.Port
+	case *net.TCPAddr:
+		return addr.Port
+	}
+	return 0
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// telemetry.go 文件定义了解析器遥测数据的收集及其与查询记录的关联。
+// 部署于解析器主机上的代理周期性地推送 CPU 及内存采样，
+// TelemetryCollector 将其按时间戳与 TimingRecorder 记录的查询进行关联，
+// 得到每个采样区间内 xdns 收到的查询数量及回复时延，并按实验轮次导出为 CSV 或 JSON 报告。
+//
+// HTTP 端点如下：
+//   - POST /telemetry：推送采样，请求体为单个 TelemetrySample 或其数组的 JSON 表示，如
+//     {"time": "2024-10-15T10:11:12Z", "host": "resolver-1", "cpu": 87.5, "memory": 536870912}
+//   - GET /telemetry/report?format=csv：导出当前实验轮次的关联报告，format 为 csv 或 json（默认）
+//   - POST /telemetry/run?name=run-2：开始新的实验轮次，清空已有的采样及查询记录
+
+package xdns
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TelemetrySample 表示解析器主机的一次资源采样
+type TelemetrySample struct {
+	// 采样时间
+	Time time.Time `json:"time"`
+	// 主机标识
+	Host string `json:"host"`
+	// CPU 使用率，单位为百分比
+	CPU float64 `json:"cpu"`
+	// 内存使用量，单位为字节
+	Memory uint64 `json:"memory"`
+}
+
+// CorrelatedSample 表示关联了查询记录的一次资源采样
+type CorrelatedSample struct {
+	TelemetrySample
+	// 自该主机上一次采样起 xdns 收到的查询数量，首次采样统计此前的全部查询
+	Queries int `json:"queries"`
+	// 上述查询的平均回复时延
+	MeanLatency time.Duration `json:"mean_latency_ns"`
+}
+
+// TelemetryReport 表示一个实验轮次的关联报告
+type TelemetryReport struct {
+	Run     string             `json:"run"`
+	Samples []CorrelatedSample `json:"samples"`
+}
+
+// TelemetryCollector 遥测收集器：收集解析器的资源采样，并与查询记录进行关联。
+type TelemetryCollector struct {
+	// 实验轮次名称
+	Run string
+	// 查询记录，通常即 ServerConfig.Timing
+	Timing *TimingRecorder
+
+	samples []TelemetrySample
+	mu      sync.Mutex
+}
+
+// NewTelemetryCollector 创建一个新的遥测收集器
+// 其接受参数为：
+//   - run string，实验轮次名称
+//   - timing *TimingRecorder，查询记录，不应为 nil
+//
+// 返回值为：
+//   - *TelemetryCollector，遥测收集器
+func NewTelemetryCollector(run string, timing *TimingRecorder) *TelemetryCollector {
+	return &TelemetryCollector{
+		Run:    run,
+		Timing: timing,
+	}
+}
+
+// Add 添加采样，时间为零值的采样以当前时间代替
+func (c *TelemetryCollector) Add(samples ...TelemetrySample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sample := range samples {
+		if sample.Time.IsZero() {
+			sample.Time = time.Now()
+		}
+		c.samples = append(c.samples, sample)
+	}
+}
+
+// NewRun 开始新的实验轮次，清空已有的采样及查询记录
+func (c *TelemetryCollector) NewRun(run string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Run = run
+	c.samples = nil
+	c.Timing.Reset()
+}
+
+// Report 将当前实验轮次的采样与查询记录进行关联
+func (c *TelemetryCollector) Report() TelemetryReport {
+	c.mu.Lock()
+	report := TelemetryReport{
+		Run:     c.Run,
+		Samples: make([]CorrelatedSample, 0, len(c.samples)),
+	}
+	samples := append([]TelemetrySample{}, c.samples...)
+	c.mu.Unlock()
+
+	queries := []TimingSample{}
+	for _, client := range c.Timing.Clients() {
+		queries = append(queries, c.Timing.Samples(client)...)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Receive.Before(queries[j].Receive)
+	})
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+
+	// 各主机上一次采样的时间
+	last := map[string]time.Time{}
+	for _, sample := range samples {
+		from := last[sample.Host]
+		last[sample.Host] = sample.Time
+
+		// 统计 (from, sample.Time] 区间内收到的查询
+		lo := sort.Search(len(queries), func(i int) bool {
+			return queries[i].Receive.After(from)
+		})
+		hi := sort.Search(len(queries), func(i int) bool {
+			return queries[i].Receive.After(sample.Time)
+		})
+		correlated := CorrelatedSample{TelemetrySample: sample, Queries: hi - lo}
+		if hi > lo {
+			total := time.Duration(0)
+			for _, q := range queries[lo:hi] {
+				total += q.Latency()
+			}
+			correlated.MeanLatency = total / time.Duration(hi-lo)
+		}
+		report.Samples = append(report.Samples, correlated)
+	}
+	return report
+}
+
+// WriteCSV 将报告以 CSV 格式写入
+// 其列依次为：run, time_ns, host, cpu, memory, queries, mean_latency_ns
+func (r TelemetryReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"run", "time_ns", "host", "cpu", "memory", "queries", "mean_latency_ns"}); err != nil {
+		return fmt.Errorf("method TelemetryReport WriteCSV failed: write header failed.\n%v", err)
+	}
+	for _, sample := range r.Samples {
+		record := []string{
+			r.Run,
+			strconv.FormatInt(sample.Time.UnixNano(), 10),
+			sample.Host,
+			strconv.FormatFloat(sample.CPU, 'f', -1, 64),
+			strconv.FormatUint(sample.Memory, 10),
+			strconv.Itoa(sample.Queries),
+			strconv.FormatInt(int64(sample.MeanLatency), 10),
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("method TelemetryReport WriteCSV failed: write record failed.\n%v", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// NewTelemetryHandler 创建遥测收集器的 HTTP 处理器，端点详见文件注释
+func NewTelemetryHandler(c *TelemetryCollector) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/telemetry", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		samples := []TelemetrySample{}
+		if err := json.Unmarshal(body, &samples); err != nil {
+			sample := TelemetrySample{}
+			if err := json.Unmarshal(body, &sample); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			samples = append(samples, sample)
+		}
+		c.Add(samples...)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("/telemetry/report", func(w http.ResponseWriter, r *http.Request) {
+		report := c.Report()
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			report.WriteCSV(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	mux.HandleFunc("/telemetry/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		c.NewRun(r.URL.Query().Get("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// timing.go 文件定义了 TimingRecorder 时间测量记录器，
+// 其记录 Netter 收到查询及发出回复的纳秒级时间戳，
+// 并据此计算各客户端的查询间隔及回复处理时延分布，可导出为 CSV，
+// 以支持基于时间侧信道的解析器推断研究。
+
+package xdns
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TimingSample 表示一次查询的时间测量结果
+type TimingSample struct {
+	// 客户端 IP 地址
+	Client string
+	// 收到查询的时间
+	Receive time.Time
+	// 发出回复的时间
+	Send time.Time
+}
+
+// Latency 返回回复处理时延
+func (s TimingSample) Latency() time.Duration {
+	return s.Send.Sub(s.Receive)
+}
+
+// HistogramBucket 表示直方图中的一个区间
+type HistogramBucket struct {
+	// 区间下界（含）
+	Lower time.Duration
+	// 区间上界（不含）
+	Upper time.Duration
+	// 落入该区间的样本数量
+	Count int
+}
+
+// TimingRecorder 时间测量记录器：按客户端记录查询的时间测量结果。
+type TimingRecorder struct {
+	// 每个客户端保留的最大样本数量，0 表示不限制
+	Limit int
+
+	samples map[string][]TimingSample
+	mu      sync.RWMutex
+}
+
+// NewTimingRecorder 创建一个新的时间测量记录器
+func NewTimingRecorder(limit int) *TimingRecorder {
+	return &TimingRecorder{
+		Limit:   limit,
+		samples: make(map[string][]TimingSample),
+	}
+}
+
+// Observe 记录一次查询的时间测量结果，由 Netter 在发出回复后调用
+// 其接受参数为：
+//   - connInfo ConnectionInfo，链接信息，其 ReceiveTime 为收到查询的时间
+//   - sendTime time.Time，发出回复的时间
+func (t *TimingRecorder) Observe(connInfo ConnectionInfo, sendTime time.Time) {
+	key := connInfo.ClientIP().String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	samples := append(t.samples[key], TimingSample{
+		Client:  key,
+		Receive: connInfo.ReceiveTime,
+		Send:    sendTime,
+	})
+	if t.Limit > 0 && len(samples) > t.Limit {
+		samples = samples[len(samples)-t.Limit:]
+	}
+	t.samples[key] = samples
+}
+
+// Clients 返回全部已记录的客户端
+func (t *TimingRecorder) Clients() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	clients := make([]string, 0, len(t.samples))
+	for client := range t.samples {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	return clients
+}
+
+// Samples 返回指定客户端的样本，按收到查询的时间排序
+func (t *TimingRecorder) Samples(client string) []TimingSample {
+	t.mu.RLock()
+	samples := append([]TimingSample{}, t.samples[client]...)
+	t.mu.RUnlock()
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Receive.Before(samples[j].Receive)
+	})
+	return samples
+}
+
+// InterQueryGaps 返回指定客户端相邻两次查询之间的间隔
+func (t *TimingRecorder) InterQueryGaps(client string) []time.Duration {
+	samples := t.Samples(client)
+	gaps := []time.Duration{}
+	for i := 1; i < len(samples); i++ {
+		gaps = append(gaps, samples[i].Receive.Sub(samples[i-1].Receive))
+	}
+	return gaps
+}
+
+// Latencies 返回指定客户端每次查询的回复处理时延
+func (t *TimingRecorder) Latencies(client string) []time.Duration {
+	samples := t.Samples(client)
+	latencies := make([]time.Duration, 0, len(samples))
+	for _, sample := range samples {
+		latencies = append(latencies, sample.Latency())
+	}
+	return latencies
+}
+
+// Histogram 将时长按固定宽度的区间进行统计
+// 其接受参数为：
+//   - durations []time.Duration，时长样本
+//   - width time.Duration，区间宽度
+//
+// 返回值为：
+//   - []HistogramBucket，自 0 起连续的区间，负数时长计入首个区间
+func Histogram(durations []time.Duration, width time.Duration) []HistogramBucket {
+	if width <= 0 || len(durations) == 0 {
+		return []HistogramBucket{}
+	}
+	counts := map[int]int{}
+	maxIndex := 0
+	for _, d := range durations {
+		index := 0
+		if d > 0 {
+			index = int(d / width)
+		}
+		counts[index]++
+		if index > maxIndex {
+			maxIndex = index
+		}
+	}
+	buckets := make([]HistogramBucket, 0, maxIndex+1)
+	for i := 0; i <= maxIndex; i++ {
+		buckets = append(buckets, HistogramBucket{
+			Lower: time.Duration(i) * width,
+			Upper: time.Duration(i+1) * width,
+			Count: counts[i],
+		})
+	}
+	return buckets
+}
+
+// WriteCSV 将全部样本以 CSV 格式写入
+// 其列依次为：client, receive_ns, send_ns, latency_ns, gap_ns，
+// 其中 gap_ns 为与该客户端上一次查询的间隔，首次查询为空。
+func (t *TimingRecorder) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"client", "receive_ns", "send_ns", "latency_ns", "gap_ns"}); err != nil {
+		return fmt.Errorf("method TimingRecorder WriteCSV failed: write header failed.\n%v", err)
+	}
+	for _, client := range t.Clients() {
+		samples := t.Samples(client)
+		for i, sample := range samples {
+			gap := ""
+			if i > 0 {
+				gap = strconv.FormatInt(int64(sample.Receive.Sub(samples[i-1].Receive)), 10)
+			}
+			record := []string{
+				client,
+				strconv.FormatInt(sample.Receive.UnixNano(), 10),
+				strconv.FormatInt(sample.Send.UnixNano(), 10),
+				strconv.FormatInt(int64(sample.Latency()), 10),
+				gap,
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("method TimingRecorder WriteCSV failed: write record failed.\n%v", err)
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Reset 清空全部样本
+func (t *TimingRecorder) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = make(map[string][]TimingSample)
+}
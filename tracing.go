@@ -0,0 +1,347 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// tracing.go 文件实现了查询处理路径上的追踪 span，
+// 及向 OpenTelemetry 收集器导出 span 的最小 OTLP/HTTP（JSON 编码）导出器，
+// 以免为此引入 OpenTelemetry SDK 及 gRPC 依赖。
+//
+// 服务器会为每个查询创建根 span "xdns.query"，并在其下创建
+// "decode"、"respond"、"send" 子 span；EnableDNSSECContext 在 "sign" 子 span 中签名，
+// 支持上下文的回复器亦可通过 StartSpan 创建更细粒度的子 span（如 "encode"），
+// 并通过 SetAttribute 记录攻击向量参数（见 example/retrap）。
+// span 的追踪 ID 即请求上下文中的追踪 ID，见 context.go。
+
+package xdns
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanKind 表示 span 的类型，取值与 OTLP 相同
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span 表示一次操作的追踪记录
+// 所有方法对 nil 均安全，未启用追踪时 StartSpan 返回 nil。
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	// 错误信息，不为空时 span 状态为 ERROR
+	Error string
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// SetAttribute 设置 span 的属性，值应为 string、bool、整数或浮点数
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetError 将 span 标记为错误
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// Finish 结束 span 并交由追踪器导出，重复调用无效
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	s.tracer.export(s)
+}
+
+// TracerConfig 记录追踪器的配置
+type TracerConfig struct {
+	// OTLP/HTTP 收集器地址，形如 "http://127.0.0.1:4318/v1/traces"
+	Endpoint string
+	// 服务名称，即 OTLP 资源属性 service.name，默认为 "xdns"
+	ServiceName string
+	// 每批导出的 span 数量上限，0 表示 512
+	BatchSize int
+	// 导出间隔，0 表示 5 秒
+	FlushInterval time.Duration
+	// 待导出队列长度，0 表示 8192，队列已满时丢弃 span
+	QueueSize int
+	// 日志输出
+	LogWriter io.Writer
+}
+
+// Tracer 追踪器：创建 span，并将结束的 span 批量导出至 OTLP 收集器。
+type Tracer struct {
+	Config       TracerConfig
+	TracerLogger *log.Logger
+
+	client  *http.Client
+	queue   chan *Span
+	dropped uint64
+	done    chan struct{}
+}
+
+// NewTracer 根据配置创建一个新的追踪器，并启动导出协程
+func NewTracer(conf TracerConfig) *Tracer {
+	tracerLogger := log.New(conf.LogWriter, "Tracer: ", log.LstdFlags)
+	if conf.ServiceName == "" {
+		conf.ServiceName = "xdns"
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 512
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 5 * time.Second
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 8192
+	}
+	t := &Tracer{
+		Config:       conf,
+		TracerLogger: tracerLogger,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		queue:        make(chan *Span, conf.QueueSize),
+		done:         make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Dropped 返回因队列已满而被丢弃的 span 数量
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close 导出剩余的 span 并停止导出协程，此后不应再结束 span
+func (t *Tracer) Close() {
+	close(t.queue)
+	<-t.done
+}
+
+// export 将结束的 span 放入待导出队列
+func (t *Tracer) export(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// run 批量导出 span，批次已满或到达导出间隔时导出
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.Config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := []*Span{}
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				t.flush(batch)
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= t.Config.BatchSize {
+				t.flush(batch)
+				batch = []*Span{}
+			}
+		case <-ticker.C:
+			t.flush(batch)
+			batch = []*Span{}
+		}
+	}
+}
+
+// flush 将一批 span 发送至收集器
+func (t *Tracer) flush(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(EncodeOTLPSpans(t.Config.ServiceName, batch))
+	if err != nil {
+		t.TracerLogger.Printf("Error encoding spans: %v", err)
+		return
+	}
+	resp, err := t.client.Post(t.Config.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.TracerLogger.Printf("Error exporting %d spans to %s: %v", len(batch), t.Config.Endpoint, err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		t.TracerLogger.Printf("Error exporting %d spans to %s: %s", len(batch), t.Config.Endpoint, resp.Status)
+	}
+}
+
+// otlpAttribute 表示 OTLP JSON 编码中的一个属性
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpAttributes 将属性转换为 OTLP JSON 编码，整数按 OTLP 要求编码为字符串
+func otlpAttributes(attrs map[string]interface{}) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case uint16:
+			value = map[string]interface{}{"intValue": strconv.FormatUint(uint64(v), 10)}
+		case uint32:
+			value = map[string]interface{}{"intValue": strconv.FormatUint(uint64(v), 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, otlpAttribute{Key: k, Value: value})
+	}
+	return result
+}
+
+// EncodeOTLPSpans 将 span 编码为 OTLP ExportTraceServiceRequest 的 JSON 结构
+// 其接受参数为：
+//   - serviceName string，服务名称
+//   - spans []*Span，已结束的 span
+//
+// 返回值为：
+//   - map[string]interface{}，可直接进行 JSON 编码的请求体
+func EncodeOTLPSpans(serviceName string, spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := map[string]interface{}{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"name":              s.Name,
+			"kind":              int(s.Kind),
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+		}
+		if s.ParentSpanID != "" {
+			span["parentSpanId"] = s.ParentSpanID
+		}
+		if s.Error != "" {
+			// STATUS_CODE_ERROR
+			span["status"] = map[string]interface{}{"code": 2, "message": s.Error}
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/tochusc/xdns"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// WithTracer 返回携带追踪器的上下文，此后可通过 StartSpan 创建 span
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey, tracer)
+}
+
+// SpanFromContext 返回上下文中当前的 span，不存在时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// newSpanID 生成一个随机的 64 位 span ID
+func newSpanID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// StartSpan 在上下文中创建一个 span，其父 span 为上下文中当前的 span
+// 若上下文未携带追踪器，则返回原上下文及 nil，nil span 的方法均可安全调用。
+// 其接受参数为：
+//   - ctx context.Context，请求上下文
+//   - name string，span 名称
+//   - kind SpanKind，span 类型
+//
+// 返回值为：
+//   - context.Context，以新 span 为当前 span 的上下文
+//   - *Span，新 span，需调用 Finish 结束
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	tracer, ok := ctx.Value(tracerKey).(*Tracer)
+	if !ok || tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		SpanID:     newSpanID(),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+		tracer:     tracer,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else if traceID, ok := TraceIDFromContext(ctx); ok {
+		span.TraceID = traceID
+	} else {
+		span.TraceID = NewTraceID()
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// tracing_test.go 文件用于对追踪 span 及 OTLP 导出进行测试。
+
+package xdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// otlpRequest 为 OTLP ExportTraceServiceRequest 的 JSON 结构
+type otlpRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+// otlpSpan 为 OTLP JSON 编码中的一个 span
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      *string         `json:"parentSpanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// attribute 返回 span 中指定属性的值，不存在时返回 nil
+func (s otlpSpan) attribute(key string) map[string]interface{} {
+	for _, attr := range s.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+// decodeOTLP 将 EncodeOTLPSpans 的结果经 JSON 编码后解析
+func decodeOTLP(t *testing.T, body []byte) otlpRequest {
+	req := otlpRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("function EncodeOTLPSpans() failed: invalid JSON %s:\n%v", body, err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("function EncodeOTLPSpans() failed: unexpected structure:\n%s", body)
+	}
+	return req
+}
+
+// 测试 EncodeOTLPSpans 函数编码的 JSON 结构
+func TestEncodeOTLPSpans(t *testing.T) {
+	start := time.Unix(1700000000, 123)
+	root := &Span{
+		TraceID: "0123456789abcdef0123456789abcdef", SpanID: "0123456789abcdef", Name: "xdns.query", Kind: SpanKindServer,
+		Start: start, End: start.Add(time.Millisecond),
+		Attributes: map[string]interface{}{
+			"dns.qname":         "www.test",
+			"dns.truncated":     true,
+			"dns.response.size": 512,
+			"xdns.cost.cpu_us":  int64(-1),
+			"dns.qtype.code":    uint16(28),
+			"dns.ttl":           uint32(3600),
+			"xdns.ratio":        0.5,
+			"dns.client":        []byte{1},
+		},
+	}
+	child := &Span{
+		TraceID: root.TraceID, SpanID: "fedcba9876543210", ParentSpanID: root.SpanID, Name: "sign", Kind: SpanKindInternal,
+		Start: start, End: start, Attributes: map[string]interface{}{}, Error: "signing failed",
+	}
+	body, err := json.Marshal(EncodeOTLPSpans("xdns-test", []*Span{root, child}))
+	if err != nil {
+		t.Fatalf("function EncodeOTLPSpans() failed:\n%v", err)
+	}
+	req := decodeOTLP(t, body)
+
+	resource := req.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || resource[0].Value["stringValue"] != "xdns-test" {
+		t.Errorf("function EncodeOTLPSpans() failed: resource attributes:\ngot: %+v", resource)
+	}
+	scope := req.ResourceSpans[0].ScopeSpans[0]
+	if scope.Scope.Name != "github.com/tochusc/xdns" || len(scope.Spans) != 2 {
+		t.Fatalf("function EncodeOTLPSpans() failed: scope %q with %d spans", scope.Scope.Name, len(scope.Spans))
+	}
+
+	got := scope.Spans[0]
+	if got.TraceID != root.TraceID || got.SpanID != root.SpanID || got.Name != "xdns.query" || got.Kind != 2 ||
+		got.StartTimeUnixNano != "1700000000000000123" || got.EndTimeUnixNano != "1700000000001000123" {
+		t.Errorf("function EncodeOTLPSpans() failed: root span:\ngot: %+v", got)
+	}
+	// 根 span 不携带 parentSpanId 及 status
+	if got.ParentSpanID != nil || got.Status != nil {
+		t.Errorf("function EncodeOTLPSpans() failed: root span has parent %v and status %v", got.ParentSpanID, got.Status)
+	}
+	// 整数按 OTLP 要求编码为字符串
+	attributes := []struct {
+		key      string
+		expected map[string]interface{}
+	}{
+		{"dns.qname", map[string]interface{}{"stringValue": "www.test"}},
+		{"dns.truncated", map[string]interface{}{"boolValue": true}},
+		{"dns.response.size", map[string]interface{}{"intValue": "512"}},
+		{"xdns.cost.cpu_us", map[string]interface{}{"intValue": "-1"}},
+		{"dns.qtype.code", map[string]interface{}{"intValue": "28"}},
+		{"dns.ttl", map[string]interface{}{"intValue": "3600"}},
+		{"xdns.ratio", map[string]interface{}{"doubleValue": 0.5}},
+		{"dns.client", map[string]interface{}{"stringValue": "[1]"}},
+	}
+	if len(got.Attributes) != len(attributes) {
+		t.Errorf("function EncodeOTLPSpans() failed: got %d attributes, expected %d", len(got.Attributes), len(attributes))
+	}
+	for _, a := range attributes {
+		value := got.attribute(a.key)
+		if len(value) != 1 {
+			t.Errorf("function EncodeOTLPSpans() failed: attribute %s:\ngot: %v\nexpected: %v", a.key, value, a.expected)
+			continue
+		}
+		for k, v := range a.expected {
+			if value[k] != v {
+				t.Errorf("function EncodeOTLPSpans() failed: attribute %s:\ngot: %v\nexpected: %v", a.key, value, a.expected)
+			}
+		}
+	}
+
+	got = scope.Spans[1]
+	if got.ParentSpanID == nil || *got.ParentSpanID != root.SpanID || got.Kind != 1 {
+		t.Errorf("function EncodeOTLPSpans() failed: child span:\ngot: %+v", got)
+	}
+	if got.Status == nil || got.Status.Code != 2 || got.Status.Message != "signing failed" {
+		t.Errorf("function EncodeOTLPSpans() failed: child span status:\ngot: %+v\nexpected: code 2, signing failed", got.Status)
+	}
+	// 空属性编码为空数组而非 null
+	if got.Attributes == nil {
+		t.Errorf("function EncodeOTLPSpans() failed: empty attributes encoded as null")
+	}
+}
+
+// 测试 StartSpan 函数
+func TestStartSpan(t *testing.T) {
+	// 未启用追踪时返回 nil，nil span 的方法均可安全调用
+	ctx, span := StartSpan(context.Background(), "xdns.query", SpanKindServer)
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Fatalf("function StartSpan() failed: span created without a tracer")
+	}
+	span.SetAttribute("dns.qname", "www.test")
+	span.SetError(errors.New("failed"))
+	span.Finish()
+
+	tracer := &Tracer{queue: make(chan *Span, 2)}
+	ctx = WithTraceID(WithTracer(context.Background(), tracer), "0123456789abcdef0123456789abcdef")
+	ctx, root := StartSpan(ctx, "xdns.query", SpanKindServer)
+	_, child := StartSpan(ctx, "decode", SpanKindInternal)
+	if root.TraceID != "0123456789abcdef0123456789abcdef" || root.ParentSpanID != "" {
+		t.Errorf("function StartSpan() failed: root span:\ngot: trace %s, parent %q", root.TraceID, root.ParentSpanID)
+	}
+	if child.TraceID != root.TraceID || child.ParentSpanID != root.SpanID || len(child.SpanID) != 16 {
+		t.Errorf("function StartSpan() failed: child span:\ngot: trace %s, parent %s, id %s", child.TraceID, child.ParentSpanID, child.SpanID)
+	}
+
+	// 重复结束的 span 仅导出一次
+	child.Finish()
+	child.Finish()
+	if len(tracer.queue) != 1 {
+		t.Errorf("method Span Finish() failed: %d spans exported, expected 1", len(tracer.queue))
+	}
+}
+
+// 测试 EnableDNSSECContext 在 "sign" span 中签名，并经由追踪器导出
+func TestEnableDNSSECContextSpan(t *testing.T) {
+	mu := sync.Mutex{}
+	spans := []otlpSpan{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := otlpRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+			t.Errorf("method Tracer flush() failed: invalid OTLP request, %v", err)
+			return
+		}
+		mu.Lock()
+		spans = append(spans, req.ResourceSpans[0].ScopeSpans[0].Spans...)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+	tracer := NewTracer(TracerConfig{Endpoint: collector.URL, LogWriter: io.Discard})
+
+	connInfo := newTestQuery("www.test", dns.DNSRRTypeA, 1232)
+	qry, _ := ParseQuery(connInfo)
+	resp, err := (&DullResponser{}).Response(connInfo)
+	if err != nil {
+		t.Fatalf("method DullResponser Response() failed:\n%v", err)
+	}
+	msg := dns.DNSMessage{}
+	msg.DecodeFromBuffer(resp, 0)
+
+	ctx, root := StartSpan(WithTracer(context.Background(), tracer), "xdns.query", SpanKindServer)
+	dConf := DNSSECConfig{Algo: dns.DNSSECAlgorithmED25519, Type: dns.DNSSECDigestTypeSHA256}
+	EnableDNSSECContext(ctx, qry, &msg, dConf, &sync.Map{})
+	root.Finish()
+	tracer.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var sign *otlpSpan
+	for i := range spans {
+		if spans[i].Name == "sign" {
+			sign = &spans[i]
+		}
+	}
+	if len(spans) != 2 || sign == nil {
+		t.Fatalf("function EnableDNSSECContext() failed: got %d spans, expected xdns.query and sign", len(spans))
+	}
+	if sign.ParentSpanID == nil || *sign.ParentSpanID != root.SpanID || sign.TraceID != root.TraceID {
+		t.Errorf("function EnableDNSSECContext() failed: sign span is not a child of the root span:\ngot: %+v", *sign)
+	}
+	if v := sign.attribute("dns.dnssec.algorithm"); v == nil || v["intValue"] != "15" {
+		t.Errorf("function EnableDNSSECContext() failed: algorithm attribute:\ngot: %v\nexpected: 15", v)
+	}
+	if v := sign.attribute("dns.dnssec.rrsigs"); v == nil || v["intValue"] == "0" {
+		t.Errorf("function EnableDNSSECContext() failed: rrsigs attribute:\ngot: %v", v)
+	}
+	if countRRSIGs(&msg) == 0 {
+		t.Errorf("function EnableDNSSECContext() failed: response not signed:\n%s", msg.String())
+	}
+}
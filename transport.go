@@ -0,0 +1,146 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// transport.go 文件定义了 TransportSplitResponser 传输差异回复器，
+// 用以研究解析器在收到截断回复后经由 TCP 重新查询的行为：
+// 对启用差异回复的区域，经由 UDP 的查询仅得到一个良性的小回复并被设置 TC 位，
+// 而经由 TCP 的重新查询才得到真正的（通常是巨大的攻击）回复。
+// 回复器同时记录被截断的查询中有多少随后经由 TCP 重新查询。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// maxPendingRetries 是等待 TCP 重新查询的截断查询数量上限，超出时清空，以免内存无限增长
+const maxPendingRetries = 65536
+
+// TransportSplitStatus 表示传输差异回复器的当前状态
+type TransportSplitStatus struct {
+	// 启用差异回复的区域
+	Zones []string `json:"zones"`
+	// 经由 UDP 返回截断回复的次数
+	Truncated uint64 `json:"truncated"`
+	// 经由 TCP 返回完整回复的次数
+	Full uint64 `json:"full"`
+	// 截断后同一客户端经由 TCP 重新查询同一问题的次数
+	Retried uint64 `json:"retried"`
+}
+
+// TransportSplitResponser 传输差异回复器：包装一个回复器，
+// 对启用差异回复的区域，仅在经由 TCP 时返回其回复，经由 UDP 时返回截断的良性回复。
+// 其零值即可使用，未启用任何区域时直接返回被包装回复器的回复。
+type TransportSplitResponser struct {
+	// 经由 TCP 时，及对未启用差异回复的区域使用的回复器
+	Responser Responser
+	// 经由 UDP 时对启用差异回复的区域使用的良性回复器，其回复将被设置 TC 位；
+	// 为 nil 时回复仅包含问题部分
+	Benign Responser
+
+	mu        sync.Mutex
+	zones     map[string]bool
+	pending   map[string]bool
+	truncated uint64
+	full      uint64
+	retried   uint64
+}
+
+// Response 根据查询的传输协议及所属区域生成回复
+func (t *TransportSplitResponser) Response(connInfo ConnectionInfo) ([]byte, error) {
+	return t.ResponseContext(context.Background(), connInfo)
+}
+
+// ResponseContext 与 Response 相同，并将上下文传递给被包装的回复器。
+func (t *TransportSplitResponser) ResponseContext(ctx context.Context, connInfo ConnectionInfo) ([]byte, error) {
+	qry, err := ParseQuery(connInfo)
+	if err != nil || len(qry.Question) == 0 || !t.Splits(qry.Question[0].Name.DomainName) {
+		return Respond(ctx, t.Responser, connInfo)
+	}
+	question := qry.Question[0]
+	key := fmt.Sprintf("%s|%s|%d", connInfo.ClientIP(), normalizeZone(question.Name.DomainName), question.Type)
+
+	if connInfo.Protocol == ProtocolTCP {
+		t.mu.Lock()
+		t.full++
+		if t.pending[key] {
+			delete(t.pending, key)
+			t.retried++
+		}
+		t.mu.Unlock()
+		return Respond(ctx, t.Responser, connInfo)
+	}
+
+	var resp []byte
+	if t.Benign != nil {
+		resp, err = Respond(ctx, t.Benign, connInfo)
+		if err != nil {
+			return resp, err
+		}
+		if len(resp) < 12 {
+			return resp, fmt.Errorf("method TransportSplitResponser ResponseContext failed: benign response length %d is less than header size 12", len(resp))
+		}
+		// 复制回复，以免修改被良性回复器复用的缓冲区
+		resp = append([]byte{}, resp...)
+		resp[2] |= 0x02 // 设置TC位为1
+	} else {
+		resp = InitTruncatedResponse(connInfo.Packet)
+	}
+
+	t.mu.Lock()
+	t.truncated++
+	if t.pending == nil || len(t.pending) >= maxPendingRetries {
+		t.pending = make(map[string]bool)
+	}
+	t.pending[key] = true
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// Splits 判断指定名称是否位于启用差异回复的区域之内
+func (t *TransportSplitResponser) Splits(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for zone := range t.zones {
+		if outageCovers(zone, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enable 对指定区域启用差异回复，"" 或 "." 表示全部区域
+func (t *TransportSplitResponser) Enable(zone string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.zones == nil {
+		t.zones = make(map[string]bool)
+	}
+	t.zones[normalizeZone(zone)] = true
+}
+
+// Disable 对指定区域停用差异回复
+func (t *TransportSplitResponser) Disable(zone string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.zones, normalizeZone(zone))
+}
+
+// Status 返回传输差异回复器的当前状态
+func (t *TransportSplitResponser) Status() TransportSplitStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := TransportSplitStatus{
+		Zones:     []string{},
+		Truncated: t.truncated,
+		Full:      t.full,
+		Retried:   t.retried,
+	}
+	for zone := range t.zones {
+		status.Zones = append(status.Zones, zone)
+	}
+	sort.Strings(status.Zones)
+	return status
+}
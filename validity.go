@@ -0,0 +1,114 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// validity.go 文件定义了 RRSIG 签名有效期的生成方式。
+// 通过 DNSSECConfig.Validity，可以使用绝对时间、相对查询时间的有效期，
+// 或刻意生成已过期、尚未生效、起止颠倒的签名，
+// 以系统地研究解析器对时钟偏差及过期签名的处理。
+//
+// 设置 Jitter 后，每次计算有效期时生效及过期时间均会随机偏移，
+// 使每个回复中的 RRSIG 互不相同，验证解析器无法复用先前的验证结果，
+// 从而在 KeyTrap 类实验中持续消耗其 CPU。此时签名缓存不再生效，
+// 缓存中复用的随机签名（如不受支持算法的签名）也将逐次重新生成。
+
+package xdns
+
+import (
+	"time"
+
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// ValidityMode 表示签名有效期的生成方式
+type ValidityMode int
+
+const (
+	// ValidityAbsolute 使用 DNSSECConfig 中的 Expiration 与 Inception 绝对时间
+	ValidityAbsolute ValidityMode = iota
+	// ValidityRelative 相对于查询时间生成有效期：
+	// [now+InceptionOffset, now+ExpirationOffset]
+	ValidityRelative
+	// ValidityExpired 生成已过期的有效期：[now-2*W, now-W]，W 为有效期长度
+	ValidityExpired
+	// ValidityNotYetValid 生成尚未生效的有效期：[now+W, now+2*W]
+	ValidityNotYetValid
+	// ValidityInverted 生成起止颠倒的有效期，即 Inception 晚于 Expiration
+	ValidityInverted
+)
+
+// DefaultValidityPeriod 为未指定偏移时使用的有效期长度（秒）
+const DefaultValidityPeriod = 86400
+
+// SignatureValidity 记录签名有效期的配置
+type SignatureValidity struct {
+	// 有效期生成方式
+	Mode ValidityMode
+	// 签名生效时间相对于查询时间的偏移（秒）
+	InceptionOffset int64
+	// 签名过期时间相对于查询时间的偏移（秒）
+	// InceptionOffset 与 ExpirationOffset 均为 0 时，使用 [0, DefaultValidityPeriod]
+	ExpirationOffset int64
+	// 抖动（秒）：生效及过期时间各自随机偏移 [-Jitter, Jitter]，0 表示不偏移
+	Jitter int64
+}
+
+// Window 根据查询时间计算签名的有效期
+// 其接受参数为：
+//   - dConf DNSSECConfig，DNSSEC 配置，ValidityAbsolute 模式下使用其中的绝对时间
+//   - now time.Time，查询时间
+//
+// 返回值为：
+//   - expiration uint32，签名过期时间
+//   - inception uint32，签名生效时间
+func (v SignatureValidity) Window(dConf DNSSECConfig, now time.Time) (expiration uint32, inception uint32) {
+	expiration, inception = v.window(dConf, now)
+	if v.Jitter > 0 {
+		expiration += uint32(v.jitter())
+		inception += uint32(v.jitter())
+	}
+	return expiration, inception
+}
+
+// jitter 返回 [-Jitter, Jitter] 中的一个随机偏移
+func (v SignatureValidity) jitter() int64 {
+	return int64(xperi.RandomIntn(int(2*v.Jitter+1))) - v.Jitter
+}
+
+// window 计算未经抖动的有效期
+func (v SignatureValidity) window(dConf DNSSECConfig, now time.Time) (expiration uint32, inception uint32) {
+	if v.Mode == ValidityAbsolute {
+		return dConf.Expiration, dConf.Inception
+	}
+
+	incOffset, expOffset := v.InceptionOffset, v.ExpirationOffset
+	if incOffset == 0 && expOffset == 0 {
+		expOffset = DefaultValidityPeriod
+	}
+	period := expOffset - incOffset
+	if period < 0 {
+		period = -period
+	}
+	unix := now.UTC().Unix()
+
+	switch v.Mode {
+	case ValidityExpired:
+		return uint32(unix - period), uint32(unix - 2*period)
+	case ValidityNotYetValid:
+		return uint32(unix + 2*period), uint32(unix + period)
+	case ValidityInverted:
+		return uint32(unix + incOffset), uint32(unix + expOffset)
+	default:
+		return uint32(unix + expOffset), uint32(unix + incOffset)
+	}
+}
+
+// SignatureExpiration 返回指定查询时间下签名的过期时间
+func (dConf DNSSECConfig) SignatureExpiration(now time.Time) uint32 {
+	expiration, _ := dConf.Validity.Window(dConf, now)
+	return expiration
+}
+
+// SignatureInception 返回指定查询时间下签名的生效时间
+func (dConf DNSSECConfig) SignatureInception(now time.Time) uint32 {
+	_, inception := dConf.Validity.Window(dConf, now)
+	return inception
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// assert.go 文件定义了对回复消息的断言函数。
+// 断言失败时以 t.Errorf 报告并返回 false，测试继续执行；
+// 需要在断言失败时立即结束测试的调用者可检查返回值并调用 t.FailNow。
+
+package xdnstest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// canonicalName 返回名称的规范形式：小写且不含末尾的点，根域名为空字符串
+func canonicalName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// AssertRCode 断言回复的 RCODE
+func AssertRCode(t testing.TB, resp dns.DNSMessage, rCode dns.DNSResponseCode) bool {
+	t.Helper()
+	if resp.Header.RCode != rCode {
+		t.Errorf("RCODE is %s, want %s", resp.Header.RCode, rCode)
+		return false
+	}
+	return true
+}
+
+// FindRecords 返回 section 中名称及类型相符的记录，名称比较不区分大小写，
+// rrType 为 dns.DNSQTypeANY 时匹配任意类型。
+func FindRecords(section dns.DNSResponseSection, name string, rrType dns.DNSType) []dns.DNSResourceRecord {
+	rrs := []dns.DNSResourceRecord{}
+	for _, rr := range section {
+		if canonicalName(rr.Name.DomainName) != canonicalName(name) {
+			continue
+		}
+		if rrType != dns.DNSQTypeANY && rr.Type != rrType {
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+// AssertAnswerContains 断言回复的 Answer 部分包含指定记录
+// 其接受参数为：
+//   - t testing.TB，测试
+//   - resp dns.DNSMessage，回复
+//   - name string，记录名称
+//   - rrType dns.DNSType，记录类型
+//   - rdata string，记录数据的文本表示，格式同 xdns.ParseRDATA，为空时不比较记录数据
+//
+// 返回值为：
+//   - bool，断言是否成立
+func AssertAnswerContains(t testing.TB, resp dns.DNSMessage, name string, rrType dns.DNSType, rdata string) bool {
+	t.Helper()
+	rrs := FindRecords(resp.Answer, name, rrType)
+	if rdata == "" {
+		if len(rrs) == 0 {
+			t.Errorf("answer has no %s %s record, got:\n%s", name, rrType, describeSection(resp.Answer))
+			return false
+		}
+		return true
+	}
+
+	want, err := xdns.ParseRDATA(rrType, rdata)
+	if err != nil {
+		t.Errorf("invalid %s RDATA %q: %v", rrType, rdata, err)
+		return false
+	}
+	for _, rr := range rrs {
+		if rr.RData.Equal(want) {
+			return true
+		}
+	}
+	t.Errorf("answer has no %s %s %s record, got:\n%s", name, rrType, rdata, describeSection(resp.Answer))
+	return false
+}
+
+// AssertSignedBy 断言回复的 Answer 部分中除 RRSIG 外的每个 RRset 都有一个由 signer 签名的 RRSIG。
+// 若传入了 keys，该 RRSIG 还须由其中一个密钥签名，且其签名在当前时间能够通过验证。
+// 其接受参数为：
+//   - t testing.TB，测试
+//   - resp dns.DNSMessage，回复
+//   - signer string，签名者名称
+//   - keys ...dns.DNSRDATADNSKEY，签名者的 DNSKEY，为空时仅检查签名者名称
+//
+// 返回值为：
+//   - bool，断言是否成立
+func AssertSignedBy(t testing.TB, resp dns.DNSMessage, signer string, keys ...dns.DNSRDATADNSKEY) bool {
+	t.Helper()
+	if len(resp.Answer) == 0 {
+		t.Errorf("answer is empty, want records signed by %s", signer)
+		return false
+	}
+
+	// 按名称及类型将 Answer 部分分组为 RRset，保持出现顺序
+	type rrSetKey struct {
+		name   string
+		rrType dns.DNSType
+	}
+	order := []rrSetKey{}
+	rrSets := map[rrSetKey][]dns.DNSResourceRecord{}
+	sigs := map[rrSetKey][]dns.DNSRDATARRSIG{}
+	for _, rr := range resp.Answer {
+		if rr.Type == dns.DNSRRTypeRRSIG {
+			if rrsig, ok := rr.RData.(*dns.DNSRDATARRSIG); ok {
+				k := rrSetKey{canonicalName(rr.Name.DomainName), rrsig.TypeCovered}
+				sigs[k] = append(sigs[k], *rrsig)
+			}
+			continue
+		}
+		k := rrSetKey{canonicalName(rr.Name.DomainName), rr.Type}
+		if _, ok := rrSets[k]; !ok {
+			order = append(order, k)
+		}
+		rrSets[k] = append(rrSets[k], rr)
+	}
+	if len(order) == 0 {
+		t.Errorf("answer has only RRSIG records, want records signed by %s", signer)
+		return false
+	}
+
+	ok := true
+	for _, k := range order {
+		if err := verifySignedBy(rrSets[k], sigs[k], signer, keys); err != nil {
+			t.Errorf("%s %s RRset is not signed by %s: %v", k.name, k.rrType, signer, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// verifySignedBy 检查 RRset 的 RRSIG 中是否有一个由 signer 的某个密钥签名且验证通过
+func verifySignedBy(rrSet []dns.DNSResourceRecord, sigs []dns.DNSRDATARRSIG, signer string, keys []dns.DNSRDATADNSKEY) error {
+	if len(sigs) == 0 {
+		return fmt.Errorf("no RRSIG")
+	}
+	var lastErr error
+	for _, rrsig := range sigs {
+		if canonicalName(rrsig.SignerName) != canonicalName(signer) {
+			lastErr = fmt.Errorf("RRSIG signer is %s", rrsig.SignerName)
+			continue
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		for _, key := range keys {
+			if rrsig.KeyTag != xperi.CalculateKeyTag(key) || rrsig.Algorithm != key.Algorithm {
+				lastErr = fmt.Errorf("RRSIG key tag %d does not match any key", rrsig.KeyTag)
+				continue
+			}
+			if lastErr = xperi.VerifyRRSIG(rrSet, rrsig, key, time.Now()); lastErr == nil {
+				return nil
+			}
+		}
+	}
+	return lastErr
+}
+
+// describeSection 返回记录部分的简要描述，用于断言失败时的输出
+func describeSection(section dns.DNSResponseSection) string {
+	if len(section) == 0 {
+		return "  <empty>"
+	}
+	lines := make([]string, 0, len(section))
+	for _, rr := range section {
+		data := ""
+		if rr.RData != nil {
+			data = strings.ReplaceAll(rr.RData.String(), "\n", " ")
+		}
+		lines = append(lines, fmt.Sprintf("  %s %d %s %s", rr.Name.DomainName, rr.TTL, rr.Type, data))
+	}
+	return strings.Join(lines, "\n")
+}
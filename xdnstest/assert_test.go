@@ -0,0 +1,141 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// assert_test.go 文件定义了对 assert.go 的单元测试
+
+package xdnstest
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// recordingT 记录断言失败信息而不使测试失败，用于测试断言函数本身
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, format)
+}
+
+// signedResponse 返回一个包含 www.example.com A 记录及其 RRSIG 的回复，以及签名所用的 DNSKEY
+func signedResponse(t *testing.T, signer string) (dns.DNSMessage, dns.DNSRDATADNSKEY) {
+	t.Helper()
+	key, priv := xperi.GenerateRDATADNSKEY(dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSKEYFlagZoneKey)
+	rrSet := []dns.DNSResourceRecord{}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.1"} {
+		rrSet = append(rrSet, dns.DNSResourceRecord{
+			Name:  *dns.NewDNSName("www.example.com"),
+			Type:  dns.DNSRRTypeA,
+			Class: dns.DNSClassIN,
+			TTL:   3600,
+			RData: &dns.DNSRDATAA{Address: net.ParseIP(ip)},
+		})
+	}
+	now := uint32(time.Now().Unix())
+	signed := append([]dns.DNSResourceRecord{}, rrSet...)
+	sort.Sort(dns.ByCanonicalOrder(signed))
+	sig := xperi.GenerateRRRRSIG(signed, dns.DNSSECAlgorithmECDSAP256SHA256,
+		now+3600, now-3600, xperi.CalculateKeyTag(key), signer, priv)
+
+	resp := NewQuery("www.example.com", dns.DNSRRTypeA)
+	resp.Header.QR = true
+	resp.Answer = append(rrSet, sig)
+	resp.Header.ANCount = uint16(len(resp.Answer))
+	return resp, key
+}
+
+func TestAssertRCode(t *testing.T) {
+	resp := NewQuery("example.com", dns.DNSRRTypeA)
+	resp.Header.RCode = dns.DNSResponseCodeNXDomain
+	if !AssertRCode(t, resp, dns.DNSResponseCodeNXDomain) {
+		t.Errorf("AssertRCode() failed on a matching RCODE")
+	}
+	rt := &recordingT{TB: t}
+	if AssertRCode(rt, resp, dns.DNSResponseCodeNoErr) || len(rt.failures) != 1 {
+		t.Errorf("AssertRCode() passed on a mismatching RCODE")
+	}
+}
+
+func TestAssertAnswerContains(t *testing.T) {
+	resp, _ := signedResponse(t, "example.com")
+	for _, rdata := range []string{"", "10.0.0.1", "10.0.0.2"} {
+		if !AssertAnswerContains(t, resp, "WWW.example.com.", dns.DNSRRTypeA, rdata) {
+			t.Errorf("AssertAnswerContains(%q) failed", rdata)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		rrType dns.DNSType
+		rdata  string
+	}{
+		{"www.example.com", dns.DNSRRTypeA, "10.0.0.3"},
+		{"www.example.com", dns.DNSRRTypeAAAA, ""},
+		{"example.com", dns.DNSRRTypeA, ""},
+		{"www.example.com", dns.DNSRRTypeA, "not an address"},
+	} {
+		rt := &recordingT{TB: t}
+		if AssertAnswerContains(rt, resp, tc.name, tc.rrType, tc.rdata) || len(rt.failures) != 1 {
+			t.Errorf("AssertAnswerContains(%s %s %q) passed", tc.name, tc.rrType, tc.rdata)
+		}
+	}
+}
+
+func TestAssertSignedBy(t *testing.T) {
+	resp, key := signedResponse(t, "example.com.")
+	if !AssertSignedBy(t, resp, "example.com") {
+		t.Errorf("AssertSignedBy() failed without keys")
+	}
+	if !AssertSignedBy(t, resp, "Example.com.", key) {
+		t.Errorf("AssertSignedBy() failed with the signing key")
+	}
+	// 验证不应改变回复中的记录顺序
+	if resp.Answer[0].RData.(*dns.DNSRDATAA).Address.String() != "10.0.0.2" {
+		t.Errorf("AssertSignedBy() reordered the answer section")
+	}
+
+	other, _ := xperi.GenerateRDATADNSKEY(dns.DNSSECAlgorithmECDSAP256SHA256, dns.DNSKEYFlagZoneKey)
+	tampered, _ := signedResponse(t, "example.com")
+	tampered.Answer[0].RData = &dns.DNSRDATAA{Address: net.ParseIP("10.0.0.9")}
+	unsigned := NewQuery("www.example.com", dns.DNSRRTypeA)
+	unsigned.Answer = resp.Answer[:2]
+
+	for _, tc := range []struct {
+		desc   string
+		resp   dns.DNSMessage
+		signer string
+		keys   []dns.DNSRDATADNSKEY
+	}{
+		{"wrong signer", resp, "example.net", nil},
+		{"wrong key", resp, "example.com", []dns.DNSRDATADNSKEY{other}},
+		{"tampered", tampered, "example.com", []dns.DNSRDATADNSKEY{key}},
+		{"unsigned", unsigned, "example.com", nil},
+		{"empty", NewQuery("www.example.com", dns.DNSRRTypeA), "example.com", nil},
+	} {
+		rt := &recordingT{TB: t}
+		if AssertSignedBy(rt, tc.resp, tc.signer, tc.keys...) || len(rt.failures) == 0 {
+			t.Errorf("%s: AssertSignedBy() passed", tc.desc)
+		}
+	}
+}
+
+func TestDescribeSection(t *testing.T) {
+	resp, _ := signedResponse(t, "example.com")
+	desc := describeSection(resp.Answer)
+	if strings.Count(desc, "\n") != 2 || !strings.Contains(desc, "www.example.com 3600 A") {
+		t.Errorf("describeSection() = %q", desc)
+	}
+	if describeSection(dns.DNSResponseSection{}) != "  <empty>" {
+		t.Errorf("describeSection() of an empty section = %q", describeSection(nil))
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// Package xdnstest 提供了测试 Responser 实现的辅助工具，
+// 使自定义回复器的单元测试无需打开任何套接字。
+//
+// 其包括：
+//   - FakeConnection：构造链接信息的生成器，其 UDP 及 TCP 链接为内存实现，会记录回复器直接写入的数据包
+//   - NewQuery、NewDNSSECQuery：构造查询消息
+//   - Exchange、ExchangeRaw：以链接信息调用回复器并解析回复
+//   - AssertAnswerContains、AssertSignedBy、AssertRCode 等断言函数
+//
+// 一个典型的测试如下：
+//
+//	conn := xdnstest.NewFakeConnection().WithQuery(xdnstest.NewDNSSECQuery("www.example.com", dns.DNSRRTypeA))
+//	resp := xdnstest.Exchange(t, responser, conn)
+//	xdnstest.AssertRCode(t, resp, dns.DNSResponseCodeNoErr)
+//	xdnstest.AssertAnswerContains(t, resp, "www.example.com", dns.DNSRRTypeA, "10.10.3.3")
+//	xdnstest.AssertSignedBy(t, resp, "example.com")
+package xdnstest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+	"github.com/tochusc/xdns/dns/xperi"
+)
+
+// 默认的客户端及服务器地址，位于文档用地址段内
+const (
+	DefaultClientAddress = "192.0.2.1:53000"
+	DefaultServerAddress = "192.0.2.53:53"
+)
+
+// DefaultUDPPayloadSize 为 NewDNSSECQuery 在 OPT 记录中声明的 UDP 载荷大小
+const DefaultUDPPayloadSize = 1232
+
+// FakeConnection 链接信息生成器：以链式调用设置协议、地址、接收时间及查询，
+// 再由 ConnectionInfo 方法生成传给回复器的链接信息。
+// 生成的链接信息中的 UDP 及 TCP 链接均为内存实现，读取时返回 io.EOF，
+// 写入的数据包被记录下来，可由 Written 方法取得，用于测试直接写入链接的回复器，如 DuplicateResponser。
+type FakeConnection struct {
+	Protocol    xdns.Protocol
+	Local       net.Addr
+	Remote      net.Addr
+	ReceiveTime time.Time
+	Packet      []byte
+
+	mu      sync.Mutex
+	written [][]byte
+}
+
+// NewFakeConnection 创建一个使用 UDP、以默认地址收发的链接信息生成器，
+// 其接收时间为创建时的时间，查询为空。
+func NewFakeConnection() *FakeConnection {
+	c := &FakeConnection{
+		Protocol:    xdns.ProtocolUDP,
+		ReceiveTime: time.Now(),
+	}
+	return c.From(DefaultClientAddress).To(DefaultServerAddress)
+}
+
+// WithUDP 将协议设置为 UDP
+func (c *FakeConnection) WithUDP() *FakeConnection {
+	c.Protocol = xdns.ProtocolUDP
+	c.Local, c.Remote = udpAddr(c.Local), udpAddr(c.Remote)
+	return c
+}
+
+// WithTCP 将协议设置为 TCP
+func (c *FakeConnection) WithTCP() *FakeConnection {
+	c.Protocol = xdns.ProtocolTCP
+	c.Local, c.Remote = tcpAddr(c.Local), tcpAddr(c.Remote)
+	return c
+}
+
+// From 设置客户端地址，形如 "192.0.2.1:53000" 或 "[2001:db8::1]:53000"，地址不合法时 panic
+func (c *FakeConnection) From(addr string) *FakeConnection {
+	c.Remote = c.parseAddr(addr)
+	return c
+}
+
+// To 设置服务器地址，格式同 From
+func (c *FakeConnection) To(addr string) *FakeConnection {
+	c.Local = c.parseAddr(addr)
+	return c
+}
+
+// At 设置收到查询的时间
+func (c *FakeConnection) At(t time.Time) *FakeConnection {
+	c.ReceiveTime = t
+	return c
+}
+
+// WithQuery 将查询消息编码后设置为收到的数据包
+func (c *FakeConnection) WithQuery(qry dns.DNSMessage) *FakeConnection {
+	c.Packet = qry.Encode()
+	return c
+}
+
+// WithPacket 设置收到的数据包，可用于测试回复器对畸形查询的处理
+func (c *FakeConnection) WithPacket(packet []byte) *FakeConnection {
+	c.Packet = append([]byte{}, packet...)
+	return c
+}
+
+// parseAddr 按当前协议解析地址
+func (c *FakeConnection) parseAddr(addr string) net.Addr {
+	ap, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil || ap.IP == nil {
+		panic("xdnstest: invalid address " + addr)
+	}
+	if c.Protocol == xdns.ProtocolTCP {
+		return tcpAddr(ap)
+	}
+	return ap
+}
+
+// ConnectionInfo 生成链接信息，每次调用均使用同一组内存链接
+func (c *FakeConnection) ConnectionInfo() xdns.ConnectionInfo {
+	connInfo := xdns.ConnectionInfo{
+		Protocol:    c.Protocol,
+		Address:     c.Remote,
+		Packet:      append([]byte{}, c.Packet...),
+		ReceiveTime: c.ReceiveTime,
+	}
+	if c.Protocol == xdns.ProtocolTCP {
+		connInfo.StreamConn = &fakeStreamConn{c}
+	} else {
+		connInfo.PacketConn = &fakePacketConn{c}
+	}
+	return connInfo
+}
+
+// Written 返回回复器直接写入链接的数据包，按写入顺序排列
+func (c *FakeConnection) Written() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte{}, c.written...)
+}
+
+// write 记录写入链接的数据包
+func (c *FakeConnection) write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, append([]byte{}, p...))
+	return len(p), nil
+}
+
+// udpAddr 将地址转换为 UDP 地址
+func udpAddr(addr net.Addr) net.Addr {
+	if a, ok := addr.(*net.TCPAddr); ok {
+		return &net.UDPAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}
+	}
+	return addr
+}
+
+// tcpAddr 将地址转换为 TCP 地址
+func tcpAddr(addr net.Addr) net.Addr {
+	if a, ok := addr.(*net.UDPAddr); ok {
+		return &net.TCPAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}
+	}
+	return addr
+}
+
+// fakePacketConn 是内存中的 UDP 链接
+type fakePacketConn struct {
+	c *FakeConnection
+}
+
+func (p *fakePacketConn) ReadFrom([]byte) (int, net.Addr, error) { return 0, nil, io.EOF }
+func (p *fakePacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return p.c.write(b)
+}
+func (p *fakePacketConn) Close() error                     { return nil }
+func (p *fakePacketConn) LocalAddr() net.Addr              { return p.c.Local }
+func (p *fakePacketConn) SetDeadline(time.Time) error      { return nil }
+func (p *fakePacketConn) SetReadDeadline(time.Time) error  { return nil }
+func (p *fakePacketConn) SetWriteDeadline(time.Time) error { return nil }
+
+// fakeStreamConn 是内存中的 TCP 链接
+type fakeStreamConn struct {
+	c *FakeConnection
+}
+
+func (s *fakeStreamConn) Read([]byte) (int, error)         { return 0, io.EOF }
+func (s *fakeStreamConn) Write(b []byte) (int, error)      { return s.c.write(b) }
+func (s *fakeStreamConn) Close() error                     { return nil }
+func (s *fakeStreamConn) LocalAddr() net.Addr              { return s.c.Local }
+func (s *fakeStreamConn) RemoteAddr() net.Addr             { return s.c.Remote }
+func (s *fakeStreamConn) SetDeadline(time.Time) error      { return nil }
+func (s *fakeStreamConn) SetReadDeadline(time.Time) error  { return nil }
+func (s *fakeStreamConn) SetWriteDeadline(time.Time) error { return nil }
+
+// NewQuery 构造一个不带 OPT 记录的查询消息，其 ID 随机生成
+// 其接受参数为：
+//   - qName string，查询名称
+//   - qType dns.DNSType，查询类型
+//
+// 返回值为：
+//   - dns.DNSMessage，构造的查询消息
+func NewQuery(qName string, qType dns.DNSType) dns.DNSMessage {
+	return dns.DNSMessage{
+		Header: dns.DNSHeader{
+			ID:      uint16(xperi.RandomIntn(0x10000)),
+			OpCode:  dns.DNSOpCodeQuery,
+			QDCount: 1,
+		},
+		Question: dns.DNSQuestionSection{
+			{
+				Name:  *dns.NewDNSName(qName),
+				Type:  qType,
+				Class: dns.DNSClassIN,
+			},
+		},
+		Answer:     dns.DNSResponseSection{},
+		Authority:  dns.DNSResponseSection{},
+		Additional: dns.DNSResponseSection{},
+	}
+}
+
+// NewDNSSECQuery 构造一个设置了 DO 标志的查询消息，
+// 其 OPT 记录声明的 UDP 载荷大小为 DefaultUDPPayloadSize。
+func NewDNSSECQuery(qName string, qType dns.DNSType) dns.DNSMessage {
+	qry := NewQuery(qName, qType)
+	opt := dns.DNSOPTRecord{
+		UDPPayloadSize: DefaultUDPPayloadSize,
+		DO:             true,
+	}
+	qry.Additional = append(qry.Additional, opt.ResourceRecord())
+	qry.Header.ARCount = uint16(len(qry.Additional))
+	return qry
+}
+
+// ExchangeRaw 以 conn 生成的链接信息调用回复器，返回其原始回复及错误
+func ExchangeRaw(r xdns.Responser, conn *FakeConnection) ([]byte, error) {
+	return xdns.Respond(context.Background(), r, conn.ConnectionInfo())
+}
+
+// Exchange 以 conn 生成的链接信息调用回复器并解析其回复，
+// 回复器返回错误（包括 xdns.ErrDropResponse）或回复无法解析时，测试立即失败。
+// 其接受参数为：
+//   - t testing.TB，测试
+//   - r xdns.Responser，被测试的回复器
+//   - conn *FakeConnection，链接信息生成器
+//
+// 返回值为：
+//   - dns.DNSMessage，解析后的回复
+func Exchange(t testing.TB, r xdns.Responser, conn *FakeConnection) dns.DNSMessage {
+	t.Helper()
+	data, err := ExchangeRaw(r, conn)
+	if errors.Is(err, xdns.ErrDropResponse) {
+		t.Fatalf("responser dropped the query")
+	}
+	if err != nil {
+		t.Fatalf("responser failed: %v", err)
+	}
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+// Query 构造查询并以默认的 UDP 链接信息调用回复器，返回解析后的回复，错误处理同 Exchange
+func Query(t testing.TB, r xdns.Responser, qName string, qType dns.DNSType) dns.DNSMessage {
+	t.Helper()
+	return Exchange(t, r, NewFakeConnection().WithQuery(NewQuery(qName, qType)))
+}
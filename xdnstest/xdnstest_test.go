@@ -0,0 +1,115 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// xdnstest_test.go 文件定义了对 xdnstest.go 的单元测试
+
+package xdnstest
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tochusc/xdns"
+	"github.com/tochusc/xdns/dns"
+)
+
+// writingResponser 将回复直接写入链接两次，再以 xdns.ErrDropResponse 通知服务器不再回复
+type writingResponser struct{}
+
+func (writingResponser) Response(connInfo xdns.ConnectionInfo) ([]byte, error) {
+	for _, p := range [][]byte{{1}, {2, 3}} {
+		var err error
+		if connInfo.Protocol == xdns.ProtocolTCP {
+			_, err = connInfo.StreamConn.Write(p)
+		} else {
+			_, err = connInfo.PacketConn.WriteTo(p, connInfo.Address)
+		}
+		if err != nil {
+			return []byte{}, err
+		}
+	}
+	return []byte{}, xdns.ErrDropResponse
+}
+
+func TestFakeConnection(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	qry := NewQuery("www.example.com", dns.DNSRRTypeA)
+	conn := NewFakeConnection().From("[2001:db8::1]:5300").To("127.0.0.1:5353").At(now).WithQuery(qry)
+
+	connInfo := conn.ConnectionInfo()
+	if connInfo.Protocol != xdns.ProtocolUDP || connInfo.PacketConn == nil || connInfo.StreamConn != nil {
+		t.Fatalf("default connection is not UDP: %+v", connInfo)
+	}
+	if addr, ok := connInfo.Address.(*net.UDPAddr); !ok || addr.String() != "[2001:db8::1]:5300" {
+		t.Errorf("client address is %v", connInfo.Address)
+	}
+	if connInfo.PacketConn.LocalAddr().String() != "127.0.0.1:5353" {
+		t.Errorf("server address is %v", connInfo.PacketConn.LocalAddr())
+	}
+	if !connInfo.ReceiveTime.Equal(now) {
+		t.Errorf("receive time is %v, want %v", connInfo.ReceiveTime, now)
+	}
+	parsed, err := xdns.ParseQuery(connInfo)
+	if err != nil {
+		t.Fatalf("ParseQuery() failed: %v", err)
+	}
+	if !parsed.Equal(&qry) {
+		t.Errorf("parsed query differs:\n%s\nwant:\n%s", parsed.String(), qry.String())
+	}
+
+	connInfo = conn.WithTCP().ConnectionInfo()
+	if connInfo.Protocol != xdns.ProtocolTCP || connInfo.StreamConn == nil || connInfo.PacketConn != nil {
+		t.Fatalf("connection is not TCP: %+v", connInfo)
+	}
+	if _, ok := connInfo.Address.(*net.TCPAddr); !ok {
+		t.Errorf("client address %T is not a TCP address", connInfo.Address)
+	}
+	if connInfo.StreamConn.RemoteAddr().String() != "[2001:db8::1]:5300" {
+		t.Errorf("remote address is %v", connInfo.StreamConn.RemoteAddr())
+	}
+}
+
+func TestFakeConnectionInvalidAddress(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("From() with an invalid address did not panic")
+		}
+	}()
+	NewFakeConnection().From("not an address")
+}
+
+func TestFakeConnectionWritten(t *testing.T) {
+	for _, conn := range []*FakeConnection{NewFakeConnection(), NewFakeConnection().WithTCP()} {
+		_, err := ExchangeRaw(writingResponser{}, conn.WithQuery(NewQuery("example.com", dns.DNSRRTypeA)))
+		if !errors.Is(err, xdns.ErrDropResponse) {
+			t.Errorf("%s: ExchangeRaw() error is %v, want ErrDropResponse", conn.Protocol, err)
+		}
+		written := conn.Written()
+		if len(written) != 2 || !bytes.Equal(written[0], []byte{1}) || !bytes.Equal(written[1], []byte{2, 3}) {
+			t.Errorf("%s: Written() = %v", conn.Protocol, written)
+		}
+	}
+}
+
+func TestNewDNSSECQuery(t *testing.T) {
+	qry := NewDNSSECQuery("example.com", dns.DNSRRTypeDNSKEY)
+	if qry.Header.QDCount != 1 || qry.Header.ARCount != 1 {
+		t.Fatalf("counts are QD %d AR %d", qry.Header.QDCount, qry.Header.ARCount)
+	}
+	opt, ok := qry.OPT()
+	if !ok || !opt.DO || opt.UDPPayloadSize != DefaultUDPPayloadSize {
+		t.Errorf("OPT is %+v", opt)
+	}
+	if plain := NewQuery("example.com", dns.DNSRRTypeA); len(plain.Additional) != 0 {
+		t.Errorf("NewQuery() added %d additional records", len(plain.Additional))
+	}
+}
+
+func TestQuery(t *testing.T) {
+	r := &xdns.DullResponser{ServerConf: xdns.ServerConfig{IP: net.ParseIP("10.10.3.3")}}
+	resp := Query(t, r, "www.example.com", dns.DNSRRTypeA)
+	AssertRCode(t, resp, dns.DNSResponseCodeNoErr)
+	AssertAnswerContains(t, resp, "www.example.com", dns.DNSRRTypeA, "10.10.3.3")
+}
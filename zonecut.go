@@ -0,0 +1,110 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// zonecut.go 文件定义了区域切割数据库 ZoneCuts。
+// 其记录服务器所知的全部区域顶点，为 RRset 选择签名区域（RRSIG 的 Signer Name）：
+// RRset 由包含其所有者名称的最近区域签名，
+// 唯有位于区域切割处的 DS RRset 属于父区域，由父区域签名（RFC 4035 2.4 节）。
+// 相比按标签数推断签名区域，其对任意深度的委派均能给出正确的签名区域。
+// 设置于 DNSSECConfig.ZoneCuts 时，EstablishCoT 亦据此区分父区域与子区域一侧的 DS 及 DNSKEY。
+
+package xdns
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ZoneCuts 区域切割数据库，可被并发使用
+type ZoneCuts struct {
+	mu sync.RWMutex
+	// 小写且去除末尾点的区域顶点集合，根区域为空字符串
+	apexes map[string]struct{}
+}
+
+// NewZoneCuts 创建一个新的区域切割数据库，并添加指定的区域顶点
+func NewZoneCuts(apexes ...string) *ZoneCuts {
+	z := &ZoneCuts{apexes: map[string]struct{}{}}
+	for _, apex := range apexes {
+		z.Add(apex)
+	}
+	return z
+}
+
+// zoneCutKey 返回名称在数据库中的键：小写且去除末尾的点
+func zoneCutKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Add 添加一个区域顶点，即在该名称处添加一个区域切割
+func (z *ZoneCuts) Add(apex string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.apexes[zoneCutKey(apex)] = struct{}{}
+}
+
+// Remove 移除一个区域顶点
+func (z *ZoneCuts) Remove(apex string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	delete(z.apexes, zoneCutKey(apex))
+}
+
+// IsApex 检查名称是否为已知的区域顶点
+func (z *ZoneCuts) IsApex(name string) bool {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	_, ok := z.apexes[zoneCutKey(name)]
+	return ok
+}
+
+// Zone 返回包含名称的最近区域，即名称自身或其最近的、为区域顶点的祖先
+// 其接受参数为：
+//   - name string，域名
+//
+// 返回值为：
+//   - string，区域名称，小写且不含末尾的点，根区域为 "."
+//   - bool，是否存在包含该名称的区域
+func (z *ZoneCuts) Zone(name string) (string, bool) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	for key := zoneCutKey(name); ; {
+		if _, ok := z.apexes[key]; ok {
+			if key == "" {
+				return ".", true
+			}
+			return key, true
+		}
+		if key == "" {
+			return "", false
+		}
+		i := strings.IndexByte(key, '.')
+		if i < 0 {
+			key = ""
+		} else {
+			key = key[i+1:]
+		}
+	}
+}
+
+// Signer 返回所有者名称及类型所确定的 RRset 的签名区域。
+// 区域切割处的 DS RRset 由父区域签名，其余 RRset 由包含其所有者名称的最近区域签名。
+// 其接受参数为：
+//   - owner string，RRset 的所有者名称
+//   - rrType dns.DNSType，RRset 的类型
+//
+// 返回值为：
+//   - string，签名区域的名称，小写且不含末尾的点，根区域为 "."
+//   - bool，是否存在负责该 RRset 的区域
+func (z *ZoneCuts) Signer(owner string, rrType dns.DNSType) (string, bool) {
+	zone, ok := z.Zone(owner)
+	if !ok || rrType != dns.DNSRRTypeDS || !dns.EqualDomainName(zone, owner) || zone == "." {
+		return zone, ok
+	}
+	parent := dns.GetUpperDomainName(&zone)
+	if parent == zone {
+		parent = "."
+	}
+	return z.Zone(parent)
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// zonecut_test.go 文件用于对区域切割数据库进行测试。
+
+package xdns
+
+import (
+	"testing"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// 测试 ZoneCuts 的 IsApex 方法
+func TestZoneCutsIsApex(t *testing.T) {
+	z := NewZoneCuts("test", "Sub.Test.", "deep.a.sub.test")
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"test", true},
+		{"test.", true},
+		{"sub.test", true},
+		{"SUB.TEST", true},
+		{"deep.a.sub.test", true},
+		{"a.sub.test", false},
+		{"www.test", false},
+		{".", false},
+		{"example", false},
+	}
+	for _, tt := range tests {
+		if got := z.IsApex(tt.name); got != tt.expected {
+			t.Errorf("method ZoneCuts IsApex(%q) failed:\ngot: %v\nexpected: %v", tt.name, got, tt.expected)
+		}
+	}
+
+	z.Remove("sub.test")
+	if z.IsApex("sub.test") {
+		t.Errorf("method ZoneCuts Remove(%q) failed: name is still an apex", "sub.test")
+	}
+}
+
+// 测试 ZoneCuts 的 Zone 方法
+func TestZoneCutsZone(t *testing.T) {
+	tests := []struct {
+		apexes   []string
+		name     string
+		expected string
+		ok       bool
+	}{
+		// 区域顶点及嵌套的区域切割
+		{[]string{"test", "sub.test"}, "test", "test", true},
+		{[]string{"test", "sub.test"}, "www.test", "test", true},
+		{[]string{"test", "sub.test"}, "sub.test", "sub.test", true},
+		{[]string{"test", "sub.test"}, "a.b.sub.test", "sub.test", true},
+		{[]string{"test", "sub.test", "c.b.sub.test"}, "x.c.b.sub.test", "c.b.sub.test", true},
+		{[]string{"test", "sub.test", "c.b.sub.test"}, "b.sub.test", "sub.test", true},
+		{[]string{"test"}, "WWW.Test.", "test", true},
+		// 根区域
+		{[]string{"."}, ".", ".", true},
+		{[]string{"."}, "example", ".", true},
+		{[]string{".", "test"}, "www.test", "test", true},
+		// 不位于任何区域之内
+		{[]string{"test"}, "example", "", false},
+		{[]string{"test"}, "atest", "", false},
+		{[]string{"sub.test"}, "test", "", false},
+		{[]string{"test"}, ".", "", false},
+		{nil, "test", "", false},
+	}
+	for _, tt := range tests {
+		zone, ok := NewZoneCuts(tt.apexes...).Zone(tt.name)
+		if zone != tt.expected || ok != tt.ok {
+			t.Errorf("method ZoneCuts Zone(%q) with apexes %v failed:\ngot: %q, %v\nexpected: %q, %v",
+				tt.name, tt.apexes, zone, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+// 测试 ZoneCuts 的 Signer 方法
+func TestZoneCutsSigner(t *testing.T) {
+	z := NewZoneCuts(".", "test", "sub.test", "c.b.sub.test")
+	tests := []struct {
+		owner    string
+		rrType   dns.DNSType
+		expected string
+		ok       bool
+	}{
+		// 区域顶点的记录由区域自身签名，DS 由父区域签名
+		{"test", dns.DNSRRTypeDNSKEY, "test", true},
+		{"test", dns.DNSRRTypeDS, ".", true},
+		{"sub.test", dns.DNSRRTypeSOA, "sub.test", true},
+		{"sub.test", dns.DNSRRTypeDS, "test", true},
+		{"SUB.TEST.", dns.DNSRRTypeDS, "test", true},
+		// 嵌套的区域切割：DS 由最近的上级区域签名，而非直接父域
+		{"c.b.sub.test", dns.DNSRRTypeDS, "sub.test", true},
+		{"c.b.sub.test", dns.DNSRRTypeA, "c.b.sub.test", true},
+		{"x.c.b.sub.test", dns.DNSRRTypeA, "c.b.sub.test", true},
+		// 非区域切割处的 DS 由包含其所有者名称的区域签名
+		{"b.sub.test", dns.DNSRRTypeDS, "sub.test", true},
+		{"www.test", dns.DNSRRTypeA, "test", true},
+		// 根区域
+		{".", dns.DNSRRTypeDNSKEY, ".", true},
+		{".", dns.DNSRRTypeDS, ".", true},
+		{"example", dns.DNSRRTypeA, ".", true},
+	}
+	for _, tt := range tests {
+		signer, ok := z.Signer(tt.owner, tt.rrType)
+		if signer != tt.expected || ok != tt.ok {
+			t.Errorf("method ZoneCuts Signer(%q, %s) failed:\ngot: %q, %v\nexpected: %q, %v",
+				tt.owner, tt.rrType, signer, ok, tt.expected, tt.ok)
+		}
+	}
+
+	// 不位于任何区域之内
+	outside := NewZoneCuts("test")
+	for _, tt := range []struct {
+		owner  string
+		rrType dns.DNSType
+	}{
+		{"example", dns.DNSRRTypeA},
+		{"test", dns.DNSRRTypeDS},
+	} {
+		if signer, ok := outside.Signer(tt.owner, tt.rrType); ok {
+			t.Errorf("method ZoneCuts Signer(%q, %s) failed:\ngot: %q, %v\nexpected: no zone", tt.owner, tt.rrType, signer, ok)
+		}
+	}
+}
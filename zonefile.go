@@ -0,0 +1,225 @@
+// Copyright 2024 TochusC AOSP Lab. All rights reserved.
+
+// zonefile.go 文件定义了签名区域的导出器 ZoneExporter。
+// 其不读取回复器的内部数据，而是向回复器查询区域中的各 名称/类型（设置 DO 位），
+// 并将回复中属于该区域的记录（含 RRSIG、DNSKEY 及回复器配置的攻击记录，如多签名者的随机密钥、
+// 篡改的 RRSIG Labels 等）按规范顺序写入标准主文件（RFC 1035 5 节），
+// 使同一份数据可被载入 BIND / NSD，以对比真实权威服务器与 xdns 的行为。
+//
+// 导出的签名与回复中的签名相同，回复器每次重新签名时（如未启用签名缓存），
+// 每个 RRset 仅保留首次查询得到的签名。位于区域顶点的 DS 属于父区域，不被导出。
+
+package xdns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/tochusc/xdns/dns"
+)
+
+// ZoneExportQuery 表示导出时向回复器发出的一个查询
+type ZoneExportQuery struct {
+	Name string
+	Type dns.DNSType
+}
+
+// ZoneExportConfig 记录签名区域导出器的配置
+type ZoneExportConfig struct {
+	// 区域名称
+	Zone string
+	// 向回复器查询的 名称/类型，区域顶点的 SOA、NS 及 DNSKEY 总会被查询
+	Queries []ZoneExportQuery
+	// 是否在查询中设置 DO 位，以导出 DNSSEC 记录
+	DNSSEC bool
+}
+
+// ZoneExporter 签名区域导出器
+type ZoneExporter struct {
+	Config    ZoneExportConfig
+	Responser Responser
+}
+
+// NewZoneExporter 根据配置创建一个新的签名区域导出器
+// 其接受参数为：
+//   - conf ZoneExportConfig，导出器配置
+//   - responser Responser，回复查询的回复器
+//
+// 返回值为：
+//   - *ZoneExporter，签名区域导出器
+func NewZoneExporter(conf ZoneExportConfig, responser Responser) *ZoneExporter {
+	return &ZoneExporter{
+		Config:    conf,
+		Responser: responser,
+	}
+}
+
+// queries 返回去重后的查询，区域顶点的 SOA、NS 及 DNSKEY 位于最前
+func (e *ZoneExporter) queries() []ZoneExportQuery {
+	queries := []ZoneExportQuery{
+		{e.Config.Zone, dns.DNSRRTypeSOA},
+		{e.Config.Zone, dns.DNSRRTypeNS},
+	}
+	if e.Config.DNSSEC {
+		queries = append(queries, ZoneExportQuery{e.Config.Zone, dns.DNSRRTypeDNSKEY})
+	}
+	queries = append(queries, e.Config.Queries...)
+
+	seen := map[string]bool{}
+	result := queries[:0]
+	for _, q := range queries {
+		key := zoneCutKey(q.Name) + "/" + dns.FormatDNSType(q.Type)
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, q)
+		}
+	}
+	return result
+}
+
+// query 向回复器发出一个查询并解析其回复
+func (e *ZoneExporter) query(ctx context.Context, q ZoneExportQuery) (dns.DNSMessage, error) {
+	qry := dns.DNSMessage{
+		Header: dns.DNSHeader{ID: 1, QDCount: 1},
+		Question: dns.DNSQuestionSection{
+			{Name: *dns.NewDNSName(q.Name), Type: q.Type, Class: dns.DNSClassIN},
+		},
+	}
+	if e.Config.DNSSEC {
+		qry.Additional = dns.DNSResponseSection{
+			(&dns.DNSOPTRecord{UDPPayloadSize: 65535, DO: true}).ResourceRecord(),
+		}
+	}
+	FixCount(&qry)
+	data, err := Respond(ctx, e.Responser, ConnectionInfo{
+		Protocol: ProtocolTCP,
+		Address:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Packet:   qry.Encode(),
+	})
+	if err != nil {
+		return dns.DNSMessage{}, err
+	}
+	resp := dns.DNSMessage{}
+	if _, err := resp.DecodeFromBuffer(data, 0); err != nil {
+		return dns.DNSMessage{}, err
+	}
+	return resp, nil
+}
+
+// exportKey 返回用于去重的记录键，RRSIG 以其覆盖的 RRset 及签名密钥区分，
+// 使回复器对同一 RRset 重新生成的签名不被重复导出
+func exportKey(rr dns.DNSResourceRecord) string {
+	owner := zoneCutKey(rr.Name.DomainName)
+	if sig, ok := rr.RData.(*dns.DNSRDATARRSIG); ok {
+		return fmt.Sprintf("%s/RRSIG/%d/%d/%d/%s", owner, sig.TypeCovered, sig.Algorithm, sig.KeyTag, zoneCutKey(sig.SignerName))
+	}
+	return fmt.Sprintf("%s/%d/%x", owner, rr.Type, rr.RData.Encode())
+}
+
+// Collect 查询区域中的全部 名称/类型，并返回回复中属于该区域的记录，按规范顺序排列
+// 其接受参数为：
+//   - ctx context.Context，查询所使用的上下文
+//
+// 返回值为：
+//   - []dns.DNSResourceRecord，区域中的记录
+//   - error，查询失败或回复的 RCODE 既非 NOERROR 亦非 NXDOMAIN 时返回错误
+func (e *ZoneExporter) Collect(ctx context.Context) ([]dns.DNSResourceRecord, error) {
+	seen := map[string]bool{}
+	rrs := []dns.DNSResourceRecord{}
+	for _, q := range e.queries() {
+		resp, err := e.query(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("method ZoneExporter Collect failed: query %s %s failed.\n%v", q.Name, dns.FormatDNSType(q.Type), err)
+		}
+		if rCode := resp.Header.RCode; rCode != dns.DNSResponseCodeNoErr && rCode != dns.DNSResponseCodeNXDomain {
+			return nil, fmt.Errorf("method ZoneExporter Collect failed: query %s %s returned %s", q.Name, dns.FormatDNSType(q.Type), rCode)
+		}
+		for _, rr := range resp.Answer {
+			if !dns.IsSubDomain(rr.Name.DomainName, e.Config.Zone) {
+				continue
+			}
+			// 区域顶点的 DS 及其签名属于父区域
+			atApex := dns.EqualDomainName(rr.Name.DomainName, e.Config.Zone)
+			if sig, ok := rr.RData.(*dns.DNSRDATARRSIG); atApex && (rr.Type == dns.DNSRRTypeDS || ok && sig.TypeCovered == dns.DNSRRTypeDS) {
+				continue
+			}
+			if key := exportKey(rr); !seen[key] {
+				seen[key] = true
+				rrs = append(rrs, rr)
+			}
+		}
+	}
+	sortZone(rrs, e.Config.Zone)
+	return rrs, nil
+}
+
+// Export 查询区域中的全部记录，并将其以主文件格式写入 w
+// 其接受参数为：
+//   - ctx context.Context，查询所使用的上下文
+//   - w io.Writer，输出
+//
+// 返回值为：
+//   - int，导出的记录数
+//   - error，错误信息
+func (e *ZoneExporter) Export(ctx context.Context, w io.Writer) (int, error) {
+	rrs, err := e.Collect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := WriteMasterFile(w, e.Config.Zone, rrs); err != nil {
+		return 0, fmt.Errorf("method ZoneExporter Export failed: %v", err)
+	}
+	return len(rrs), nil
+}
+
+// sortZone 将记录按规范顺序排列：区域顶点的 SOA 及其签名位于最前，其余记录按所有者名称及类型排列，
+// RRSIG 紧随其覆盖的 RRset，同一 RRset 内保持原有顺序
+func sortZone(rrs []dns.DNSResourceRecord, zone string) {
+	rank := func(rr dns.DNSResourceRecord) (int, dns.DNSType, int) {
+		rrType, sigRank := rr.Type, 0
+		if sig, ok := rr.RData.(*dns.DNSRDATARRSIG); ok {
+			rrType, sigRank = sig.TypeCovered, 1
+		}
+		if rrType == dns.DNSRRTypeSOA && dns.EqualDomainName(rr.Name.DomainName, zone) {
+			return 0, rrType, sigRank
+		}
+		return 1, rrType, sigRank
+	}
+	sort.SliceStable(rrs, func(i, j int) bool {
+		ri, ti, si := rank(rrs[i])
+		rj, tj, sj := rank(rrs[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if c := dns.CompareDomainName(rrs[i].Name.DomainName, rrs[j].Name.DomainName); c != 0 {
+			return c < 0
+		}
+		if ti != tj {
+			return ti < tj
+		}
+		return si < sj
+	})
+}
+
+// WriteMasterFile 将记录以标准主文件格式写入 w，所有者名称均为绝对域名
+// 其接受参数为：
+//   - w io.Writer，输出
+//   - origin string，区域名称，写入 $ORIGIN 指令
+//   - rrs []dns.DNSResourceRecord，记录，按给定顺序写入
+//
+// 返回值为：
+//   - int64，写入的字节数
+//   - error，错误信息
+func WriteMasterFile(w io.Writer, origin string, rrs []dns.DNSResourceRecord) (int64, error) {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "$ORIGIN %s\n", fqdn(origin))
+	for _, rr := range rrs {
+		fmt.Fprintf(&sb, "%s\t%d\tIN\t%s\t%s\n", fqdn(rr.Name.DomainName), rr.TTL, dns.FormatDNSType(rr.Type), PresentRDATA(rr.RData))
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}